@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bench"
+	"packet"
+	"transport"
+)
+
+// 压测工具自检校准工具
+// 通过内存回环传输运行发布与订阅负载，测出本机压测工具自身的最大包速率与最低延迟，确认瓶颈不在压测工具而在代理
+
+var workers = flag.Int("workers", 1, "number of publisher and consumer pairs")
+var size = flag.Int("size", 64, "payload size in bytes")
+var duration = flag.Duration("duration", 5*time.Second, "duration of each phase")
+var rate = flag.Float64("rate", 1000, "publish rate per publisher in messages per second of the latency phase")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like rate>100000 or latency.p99<1ms (repeatable)")
+}
+
+// a phase runs the publishers against an in-memory broker that forwards every
+// publish packet to the consumer of the same worker
+type phase struct {
+	received  int64
+	latencies bench.Latencies
+}
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start calibration with %d workers on the in-memory loopback transport.\n", *workers)
+
+	result := bench.NewResult("calibrate")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	// measure the maximum rate with buffered sends
+	fmt.Printf("Measure maximum rate for %s...\n", *duration)
+	throughput := run(0, true)
+	maxRate := float64(throughput.received) / duration.Seconds()
+
+	// measure the latency floor with paced unbuffered sends
+	fmt.Printf("Measure latency floor at %.0f msg/s per publisher for %s...\n", *rate, *duration)
+	latency := run(*rate, false)
+
+	metrics := bench.Metrics{
+		"rate": maxRate,
+	}
+	for name, value := range latency.latencies.Metrics("latency.") {
+		metrics[name] = value
+	}
+
+	fmt.Printf("Maximum rate: %.0f msg/s\n", maxRate)
+	fmt.Printf("Latency floor: p50 %s - p90 %s - p99 %s - max %s\n", seconds(metrics["latency.p50"]),
+		seconds(metrics["latency.p90"]), seconds(metrics["latency.p99"]), seconds(metrics["latency.max"]))
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+// run runs a phase for the configured duration, a zero rate publishes as fast
+// as possible
+func run(rate float64, buffered bool) *phase {
+	p := &phase{}
+
+	var group sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < *workers; i++ {
+		publisher, in := transport.Pipe()
+		out, consumer := transport.Pipe()
+
+		group.Add(3)
+		go func() {
+			defer group.Done()
+			publish(publisher, rate, buffered, stop)
+		}()
+		go func() {
+			defer group.Done()
+			forward(in, out, buffered)
+		}()
+		go func() {
+			defer group.Done()
+			consume(consumer, p, !buffered)
+		}()
+	}
+
+	time.Sleep(*duration)
+	close(stop)
+
+	group.Wait()
+
+	return p
+}
+
+// publish sends publish packets until stopped
+func publish(conn transport.Conn, rate float64, buffered bool, stop chan struct{}) {
+	defer conn.Close()
+
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "calibrate"
+	publish.Message.Payload = bench.NewPayload(*size)
+
+	var limiter *bench.RateLimiter
+	if rate > 0 {
+		limiter = bench.NewRateLimiter(rate)
+	}
+
+	for seq := uint64(0); ; seq++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if limiter != nil {
+			limiter.Wait()
+		}
+
+		bench.PutHeader(publish.Message.Payload, bench.Header{Seq: seq, Time: time.Now()})
+
+		var err error
+		if buffered {
+			err = conn.BufferedSend(publish)
+		} else {
+			err = conn.Send(publish)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// forward acts as a broker that relays every received packet
+func forward(in, out transport.Conn, buffered bool) {
+	defer out.Close()
+
+	for {
+		pkt, err := in.Receive()
+		if err != nil {
+			return
+		}
+
+		if buffered {
+			err = out.BufferedSend(pkt)
+		} else {
+			err = out.Send(pkt)
+		}
+		if err != nil {
+			in.Close()
+			return
+		}
+	}
+}
+
+// consume receives packets and optionally measures their latency
+func consume(conn transport.Conn, p *phase, measure bool) {
+	defer conn.Close()
+
+	for {
+		pkt, err := conn.Receive()
+		if err != nil {
+			return
+		}
+
+		atomic.AddInt64(&p.received, 1)
+
+		publish, ok := pkt.(*packet.PublishPacket)
+		if !measure || !ok {
+			continue
+		}
+
+		header, err := bench.ParseHeader(publish.Message.Payload)
+		if err == nil {
+			p.latencies.Add(header.Latency(time.Now()))
+		}
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
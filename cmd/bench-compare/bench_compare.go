@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"bench"
+)
+
+// 测试结果对比工具
+// 本工具对比两次测试生成的JSON结果文件，按指标输出性能回退与提升
+
+var alpha = flag.Float64("alpha", 0.05, "significance level of the Mann-Whitney U test for metrics with samples")
+var minChange = flag.Float64("min-change", 0.05, "relative change treated as significant for metrics without samples")
+var failOnRegression = flag.Bool("fail", true, "exit with status 1 if a regression is found")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] base.json head.json\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base, err := bench.ReadResult(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	head, err := bench.ReadResult(flag.Arg(1))
+	if err != nil {
+		fail(err)
+	}
+
+	// warn about different test definitions
+	if base.Fingerprint != head.Fingerprint {
+		fmt.Println("warning: the results were produced by different configurations")
+
+		for _, name := range base.Config.Diff(head.Config) {
+			fmt.Printf("  %s: %q -> %q\n", name, base.Config[name], head.Config[name])
+		}
+
+		fmt.Println()
+	}
+
+	list := bench.Compare(base, head, *alpha, *minChange)
+	if len(list) == 0 {
+		fail(fmt.Errorf("no common metrics found"))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "metric\tbase\thead\tchange\tp-value\tverdict\t")
+
+	regressions := 0
+	for _, c := range list {
+		p := "-"
+		if !math.IsNaN(c.P) {
+			p = fmt.Sprintf("%.4f", c.P)
+		}
+
+		fmt.Fprintf(w, "%s\t%.6g\t%.6g\t%+.2f%%\t%s\t%s\t\n", c.Metric, c.Base, c.Head, c.Change*100, p, c.Verdict)
+
+		if c.Verdict == bench.Regression {
+			regressions++
+		}
+	}
+
+	w.Flush()
+
+	if regressions > 0 {
+		fmt.Printf("\n%d regression(s) found.\n", regressions)
+
+		if *failOnRegression {
+			os.Exit(1)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bench"
+)
+
+// 测试报告生成工具
+// 本工具读取一个或多个JSON结果文件，生成包含吞吐量、延迟分位数与错误统计图表的独立HTML报告
+
+var out = flag.String("out", "report.html", "the HTML file the report is written to")
+var title = flag.String("title", "Benchmark Report", "the title of the report")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] result.json [result.json...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// read results and label them by file name
+	var results []*bench.Result
+	var labels []string
+	for _, path := range flag.Args() {
+		result, err := bench.ReadResult(path)
+		if err != nil {
+			fail(err)
+		}
+
+		results = append(results, result)
+		labels = append(labels, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		fail(err)
+	}
+
+	err = bench.WriteReport(file, *title, results, labels)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("Report of %d result(s) written to %s.\n", len(results), *out)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"bench"
+)
+
+// 参数扫描工具
+// 本工具读取场景文件，将其中的列表参数展开为运行矩阵，依次执行测试工具并输出对比报告
+
+var metrics = flag.String("metrics", "throughput,loss,latency.p50,latency.p99", "comma separated metrics shown in the report")
+var dir = flag.String("dir", "", "directory for the results of the single runs (default a temporary directory)")
+var out = flag.String("out", "", "write the combined results as JSON to this file")
+var stop = flag.Bool("stop", false, "stop the sweep after the first failed run")
+
+type combined struct {
+	Params []string `json:"params"`
+	Runs   []run    `json:"runs"`
+}
+
+type run struct {
+	Params bench.Config  `json:"params"`
+	Args   []string      `json:"args"`
+	Result *bench.Result `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] scenario command [args...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// read scenario
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	scenario, err := bench.ParseScenario(file)
+	file.Close()
+	if err != nil {
+		fail(err)
+	}
+
+	// prepare result directory
+	if *dir == "" {
+		*dir, err = ioutil.TempDir("", "bench-sweep")
+		if err != nil {
+			fail(err)
+		}
+	} else {
+		err = os.MkdirAll(*dir, 0755)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	configs := scenario.Expand()
+	swept := scenario.Swept()
+
+	fmt.Printf("Sweep %s over %d runs (%s).\n", strings.Join(swept, ", "), len(configs), *dir)
+
+	// execute runs sequentially
+	var runs []bench.SweepRun
+	report := combined{Params: swept}
+	failed := 0
+	for i, config := range configs {
+		args := append(append([]string{}, flag.Args()[2:]...), scenario.Args(config)...)
+		path := filepath.Join(*dir, fmt.Sprintf("run-%d.json", i+1))
+
+		fmt.Printf("\n=== Run %d/%d: %s\n", i+1, len(configs), strings.Join(scenario.Args(config), " "))
+
+		params := bench.Config{}
+		for _, name := range swept {
+			params[name] = config[name]
+		}
+
+		result, err := execute(flag.Arg(1), append(args, "-out="+path), path)
+
+		runs = append(runs, bench.SweepRun{Params: params, Result: result, Error: err})
+		entry := run{Params: params, Args: args, Result: result}
+		if err != nil {
+			failed++
+			entry.Error = err.Error()
+			fmt.Println("Run failed:", err)
+		}
+
+		report.Runs = append(report.Runs, entry)
+
+		if err != nil && *stop {
+			break
+		}
+	}
+
+	// print report
+	fmt.Println()
+	err = bench.WriteSweep(os.Stdout, swept, strings.Split(*metrics, ","), runs)
+	if err != nil {
+		fail(err)
+	}
+
+	// write combined results
+	if *out != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fail(err)
+		}
+
+		err = ioutil.WriteFile(*out, append(data, '\n'), 0644)
+		if err != nil {
+			fmt.Println("Failed to write result:", err)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// execute runs the command and reads the result it wrote, a run that fails
+// after writing its result (e.g. a violated threshold) returns both
+func execute(command string, args []string, path string) (*bench.Result, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	runErr := cmd.Run()
+
+	result, err := bench.ReadResult(path)
+	if err != nil {
+		if runErr != nil {
+			return nil, runErr
+		}
+
+		return nil, err
+	}
+
+	return result, runErr
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(2)
+}
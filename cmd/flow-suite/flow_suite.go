@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"bench"
+	"packet"
+	"transport/flow"
+	"transport/flow/flows"
+)
+
+// 流程测试套件运行工具
+// 本工具注册一组命名的合规与回归流程，按 -run 过滤后并行地对目标服务器执行，并输出汇总表格
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var run = flag.String("run", "", "run only the flows matching the slash separated regular expressions")
+var parallel = flag.Int("parallel", runtime.GOMAXPROCS(0), "number of flows tested concurrently")
+var timeout = flag.Duration("timeout", 5*time.Second, "time after which a single flow fails")
+var list = flag.Bool("list", false, "list the matching flows and exit")
+var out = flag.String("out", "", "write the result as JSON to this file")
+var matrix = flag.String("matrix", "", "write the conformance matrix of the cited statements as JSON to this file")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file.flow ...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	suite := flow.NewSuite()
+	suite.Parallel = *parallel
+	suite.Timeout = *timeout
+
+	// register flows
+	register(suite)
+
+	for _, path := range flag.Args() {
+		err := load(suite, path)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	err := suite.Filter(*run)
+	if err != nil {
+		fail(fmt.Errorf("invalid -run pattern: %w", err))
+	}
+
+	if *list {
+		for _, name := range suite.Names() {
+			fmt.Println(name)
+		}
+
+		return
+	}
+
+	result := bench.NewResult("flow-suite")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	fmt.Printf("Start %d flows against %s.\n\n", len(suite.Names()), *urlString)
+
+	// run suite
+	report := suite.Run(*urlString)
+	report.WriteTable(os.Stdout)
+
+	// write conformance matrix
+	if *matrix != "" {
+		err := writeMatrix(*matrix, report)
+		if err != nil {
+			fmt.Println("Failed to write matrix:", err)
+		}
+	}
+
+	// write result
+	if *out != "" {
+		metrics := bench.Metrics{
+			"passed": float64(report.Passed()),
+			"failed": float64(report.Failed()),
+		}
+
+		for _, r := range report.Results {
+			passed := 0.0
+			if r.Passed() {
+				passed = 1
+			}
+
+			metrics["flow."+r.Name] = passed
+			metrics["flow."+r.Name+".duration"] = r.Duration.Seconds()
+		}
+
+		result.Metrics = metrics
+		bench.Finish(*out, result, nil)
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+// register adds the compliance flows of the catalog with the statements of the
+// MQTT 3.1.1 specification they verify, every flow uses its own client id so
+// that they can run concurrently
+func register(suite *flow.Suite) {
+	msg := packet.Message{
+		Topic:   "flow-suite",
+		Payload: []byte("flow-suite"),
+	}
+
+	add := func(name string, fn func(id string) *flow.Flow, statements ...string) {
+		id := "flow-suite/" + name
+		suite.Add(name, func() *flow.Flow {
+			return fn(id)
+		})
+		suite.Cite(name, statements...)
+	}
+
+	add("connect/clean", func(id string) *flow.Flow {
+		return flows.CleanConnect(id).Include(flows.Disconnect())
+	}, "MQTT-3.2.0-1")
+	add("connect/keepalive", func(id string) *flow.Flow {
+		return flows.CleanConnect(id).Include(flows.KeepAlive()).Include(flows.Disconnect())
+	}, "MQTT-3.12.4-1")
+	add("publish/qos1", func(id string) *flow.Flow {
+		return flows.CleanConnect(id).Include(flows.PublishQOS1(1, msg)).Include(flows.Disconnect())
+	}, "MQTT-4.3.2-2")
+	add("publish/qos2", func(id string) *flow.Flow {
+		return flows.CleanConnect(id).Include(flows.PublishQOS2(1, msg)).Include(flows.Disconnect())
+	}, "MQTT-4.3.3-2")
+	add("violation/duplicate_connect", flows.DuplicateConnect, "MQTT-3.1.0-2")
+	add("violation/publish_before_connect", func(string) *flow.Flow {
+		return flows.PublishBeforeConnect(msg)
+	}, "MQTT-3.1.0-1")
+	add("violation/reserved_type_0", func(id string) *flow.Flow {
+		return flows.ReservedType(id, 0)
+	}, "MQTT-4.8.0-1")
+	add("violation/reserved_type_15", func(id string) *flow.Flow {
+		return flows.ReservedType(id, 15)
+	}, "MQTT-4.8.0-1")
+}
+
+// writeMatrix writes the conformance matrix of the report to the file
+func writeMatrix(path string, report *flow.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = report.WriteMatrix(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// load adds a flow recorded by mqtt-decode -flow as a regression flow named
+// after the file
+func load(suite *flow.Suite, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// check format once
+	err = flow.New().UnmarshalBinary(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	name := "regression/" + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	return suite.Add(name, func() *flow.Flow {
+		f := flow.New()
+		f.UnmarshalBinary(data)
+		return f
+	})
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(2)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"capture"
+	"packet"
+	"transport/flow"
+)
+
+// 报文解码工具
+// 本工具读取十六进制、base64或pcap抓包数据并打印解码后的MQTT报文
+
+var format = flag.String("format", "hex", "input format (hex, base64, raw or pcap)")
+var port = flag.Int("port", 1883, "broker port used to select streams from pcap input (0 for all)")
+var dump = flag.Bool("dump", false, "print the raw bytes of every decoded packet")
+var record = flag.String("record", "", "write publishes sent to the broker to a recording for mqtt-replay (pcap only)")
+var flowPrefix = flag.String("flow", "", "write every client stream as a binary flow to <prefix>-<n>.flow for mqtt-replay (pcap only)")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file]\n\nReads from stdin if no file is given.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	data, err := readInput(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	switch *format {
+	case "hex":
+		data, err = decodeHex(data)
+	case "base64":
+		data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+	case "raw":
+	case "pcap":
+		err = decodePcap(data)
+		if err != nil {
+			fail(err)
+		}
+
+		return
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	n, err := capture.DecodeStream(data, func(offset int, pkt packet.GenericPacket, raw []byte) {
+		printPacket(fmt.Sprintf("%08x", offset), pkt, raw)
+	})
+	if err != nil {
+		fail(fmt.Errorf("offset %08x: %v", n, err))
+	}
+
+	if n < len(data) {
+		fail(fmt.Errorf("offset %08x: %d trailing bytes do not form a complete packet", n, len(data)-n))
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// decodeHex accepts plain hex dumps as well as common notations like
+// "0x10 0x0c", "10:0c" or "\x10\x0c".
+func decodeHex(data []byte) ([]byte, error) {
+	str := strings.ToLower(string(data))
+	str = strings.NewReplacer("0x", "", "\\x", "", ":", "", ",", "").Replace(str)
+	str = strings.Join(strings.Fields(str), "")
+
+	return hex.DecodeString(str)
+}
+
+func printPacket(prefix string, pkt packet.GenericPacket, raw []byte) {
+	fmt.Printf("%s %s\n", prefix, pkt.String())
+
+	if *dump {
+		fmt.Print(hex.Dump(raw))
+	}
+}
+
+func decodePcap(data []byte) error {
+	// prepare recorder
+	var recorder *capture.Recorder
+	if *record != "" {
+		file, err := os.Create(*record)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		recorder = capture.NewRecorder(file)
+	}
+
+	// prepare flow recorder
+	var flows *flowRecorder
+	if *flowPrefix != "" {
+		if *port == 0 {
+			return fmt.Errorf("recording flows requires a broker port")
+		}
+
+		flows = &flowRecorder{
+			streams: map[string]*flowStream{},
+		}
+	}
+
+	reader := capture.NewPcapReader(*port)
+	reader.Gap = func(ts time.Time, stream string, missing int) {
+		fmt.Printf("%s %s missing %d bytes, resyncing\n", ts.Format("15:04:05.000000"), stream, missing)
+	}
+	reader.Error = func(ts time.Time, stream string, err error) {
+		fmt.Printf("%s %s decode error: %v\n", ts.Format("15:04:05.000000"), stream, err)
+	}
+
+	var recordErr error
+	err := reader.Read(data, func(pkt *capture.Packet) {
+		printPacket(pkt.Time.Format("15:04:05.000000")+" "+pkt.Stream(), pkt.Packet, pkt.Raw)
+
+		// record publishes sent to the broker
+		if recorder != nil && recordErr == nil {
+			if entry, ok := capture.PublishEntry(pkt, *port); ok {
+				recordErr = recorder.Write(entry)
+			}
+		}
+
+		if flows != nil {
+			flows.add(pkt)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if recordErr != nil {
+		return recordErr
+	}
+
+	// write flows
+	if flows != nil {
+		return flows.write(*flowPrefix)
+	}
+
+	return nil
+}
+
+// a flow recorder turns every client stream of a capture into a flow
+type flowRecorder struct {
+	streams map[string]*flowStream
+	order   []*flowStream
+}
+
+type flowStream struct {
+	flow *flow.Flow
+	last time.Time
+}
+
+// add appends a packet to the flow of its client, packets sent to the broker
+// are sent by the flow and the answers of the broker are expected by it
+func (r *flowRecorder) add(pkt *capture.Packet) {
+	toBroker := pkt.Dst.Port == *port
+	client := pkt.Src.String()
+	if !toBroker {
+		client = pkt.Dst.String()
+	}
+
+	stream, ok := r.streams[client]
+	if !ok {
+		stream = &flowStream{flow: flow.New()}
+		r.streams[client] = stream
+		r.order = append(r.order, stream)
+	}
+
+	if toBroker {
+		// keep the pauses of the client
+		if gap := pkt.Time.Sub(stream.last).Round(time.Millisecond); !stream.last.IsZero() && gap > 0 {
+			stream.flow.Delay(gap)
+		}
+
+		stream.flow.Send(pkt.Packet)
+	} else {
+		stream.flow.Receive(pkt.Packet)
+	}
+
+	stream.last = pkt.Time
+}
+
+// write writes the flows in the order their streams have been captured
+func (r *flowRecorder) write(prefix string) error {
+	for i, stream := range r.order {
+		data, err := stream.flow.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(fmt.Sprintf("%s-%d.flow", prefix, i), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
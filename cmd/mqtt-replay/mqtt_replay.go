@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"capture"
+	"client"
+	"packet"
+	"transport"
+	"transport/flow"
+)
+
+// 流量回放工具
+// 本工具读取pcap抓包或mqtt-decode生成的录制文件，按原始时序向目标服务器重新发布消息
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var format = flag.String("format", "record", "input format (record, pcap or flow)")
+var port = flag.Int("port", 1883, "broker port used to select publishes from pcap input (0 for all)")
+var speed = flag.Float64("speed", 1, "replay speed factor (0 replays as fast as possible)")
+var qos = flag.Int("qos", -1, "override the qos of all messages (-1 keeps the recorded qos)")
+var prefix = flag.String("prefix", "", "prefix prepended to all topics")
+var loops = flag.Int("loop", 1, "number of times the recording is replayed")
+var wait = flag.Duration("wait", 5*time.Second, "time to wait for acknowledgments before disconnecting")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] file\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// test a recorded flow
+	if *format == "flow" {
+		err := replayFlow(flag.Arg(0))
+		if err != nil {
+			fail(err)
+		}
+
+		return
+	}
+
+	entries, err := load(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	if len(entries) == 0 {
+		fail(fmt.Errorf("no messages found in %s", flag.Arg(0)))
+	}
+
+	// connect one client per recorded source
+	clients := make(map[string]*client.Client)
+	for _, entry := range entries {
+		if _, ok := clients[entry.Source]; ok {
+			continue
+		}
+
+		c, err := connect("replay/" + strconv.Itoa(len(clients)))
+		if err != nil {
+			fail(err)
+		}
+
+		clients[entry.Source] = c
+	}
+
+	fmt.Printf("Replaying %d messages from %d sources to %s at %gx speed.\n", len(entries), len(clients), *urlString, *speed)
+
+	start := time.Now()
+	sent := 0
+
+	for i := 0; i < *loops; i++ {
+		err = capture.Replay(entries, *speed, func(entry *capture.Entry) error {
+			msg := entry.Message()
+			msg.Topic = *prefix + msg.Topic
+			if *qos >= 0 {
+				msg.QOS = uint8(*qos)
+			}
+
+			_, err := clients[entry.Source].PublishMessage(msg)
+			if err != nil {
+				return err
+			}
+
+			sent++
+
+			return nil
+		})
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	elapsed := time.Since(start)
+
+	for _, c := range clients {
+		c.Disconnect(*wait)
+	}
+
+	fmt.Printf("Sent %d messages in %s (%.0f msg/s).\n", sent, elapsed, float64(sent)/elapsed.Seconds())
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// replayFlow tests a flow recorded by mqtt-decode against the broker, the
+// flow fails if the broker answers differently than in the capture
+func replayFlow(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f := flow.New()
+	err = f.UnmarshalBinary(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Replaying flow %s to %s.\n", path, *urlString)
+
+	start := time.Now()
+
+	for i := 0; i < *loops; i++ {
+		conn, err := transport.Dial(*urlString)
+		if err != nil {
+			return err
+		}
+
+		err = f.Test(conn)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("loop %d: %w", i+1, err)
+		}
+	}
+
+	fmt.Printf("Replayed flow %d times in %s.\n", *loops, time.Since(start))
+
+	return nil
+}
+
+func load(path string) ([]*capture.Entry, error) {
+	switch *format {
+	case "record":
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return capture.ReadRecording(file)
+	case "pcap":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []*capture.Entry
+		err = capture.NewPcapReader(*port).Read(data, func(pkt *capture.Packet) {
+			if entry, ok := capture.PublishEntry(pkt, *port); ok {
+				entries = append(entries, entry)
+			}
+		})
+
+		return entries, err
+	}
+
+	return nil, fmt.Errorf("unknown format %q", *format)
+}
+
+func connect(id string) (*client.Client, error) {
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", id, err)
+		}
+
+		return nil
+	}
+
+	future, err := c.Connect(client.NewConfigWithClientID(*urlString, id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = future.Wait(10 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,62 @@
+// Package adapter implements minimal publish/subscribe clients for MQTT, NATS
+// and Redis behind a common interface, so that the same scenarios can be run
+// against different messaging systems for latency comparisons.
+package adapter
+
+import (
+	"errors"
+	"net/url"
+)
+
+// ErrUnsupportedScheme is returned by Dial if the URL scheme is not supported
+// by any adapter.
+var ErrUnsupportedScheme = errors.New("unsupported scheme")
+
+// A Message is a received message.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// A Conn is a publish/subscribe connection to a messaging system. Publish may
+// be called concurrently with Receive but not concurrently with itself.
+// Subscribe reads the confirmation from the connection and must not be called
+// concurrently with Receive or itself.
+type Conn interface {
+	// Subscribe will subscribe to the topic and wait until the subscription
+	// has been confirmed. Messages that arrive in the meantime are returned
+	// by the next calls to Receive. Messages are delivered at most once.
+	Subscribe(topic string) error
+
+	// Publish will send a message to the topic without waiting for an
+	// acknowledgement.
+	Publish(topic string, payload []byte) error
+
+	// Receive will wait for the next message of the subscribed topics.
+	Receive() (*Message, error)
+
+	// Close will close the connection.
+	Close() error
+}
+
+// Dial connects to the system at the specified URL. URLs with the "nats"
+// scheme use NATS, URLs with the "redis" scheme use Redis pub/sub and all
+// other URLs are dialed as MQTT brokers using the transport package. The
+// client id is only used by MQTT.
+func Dial(urlString, clientID string) (Conn, error) {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "nats":
+		return DialNATS(u)
+	case "redis":
+		return DialRedis(u)
+	case "":
+		return nil, ErrUnsupportedScheme
+	}
+
+	return DialMQTT(urlString, clientID)
+}
@@ -0,0 +1,164 @@
+package adapter
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"packet"
+	"transport"
+)
+
+// MQTTConn is a Conn that publishes and subscribes with QOS 0 on a MQTT
+// broker.
+type MQTTConn struct {
+	conn    transport.Conn
+	next    packet.ID
+	pending []*Message
+}
+
+// DialMQTT connects to the MQTT broker at the specified URL using the default
+// dialer and a clean session without keep alive.
+func DialMQTT(urlString, clientID string) (*MQTTConn, error) {
+	conn, err := transport.Dial(urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMQTTConn(conn, urlString, clientID)
+}
+
+// NewMQTTConn connects a client on the specified connection. Credentials in
+// the URL are sent with the CONNECT packet.
+func NewMQTTConn(conn transport.Conn, urlString, clientID string) (*MQTTConn, error) {
+	connect := packet.NewConnectPacket()
+	connect.ClientID = clientID
+	connect.CleanSession = true
+	connect.KeepAlive = 0
+
+	if u, err := url.Parse(urlString); err == nil && u.User != nil {
+		connect.Username = u.User.Username()
+		connect.Password, _ = u.User.Password()
+	}
+
+	err := conn.Send(connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// wait for connack
+	pkt, err := conn.Receive()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	connack, ok := pkt.(*packet.ConnackPacket)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("connection failed: expected connack, got %s", pkt.Type())
+	} else if connack.ReturnCode != packet.ConnectionAccepted {
+		conn.Close()
+		return nil, fmt.Errorf("connection failed: %w", connack.ReturnCode)
+	}
+
+	return &MQTTConn{conn: conn}, nil
+}
+
+// Subscribe implements the Conn interface.
+func (c *MQTTConn) Subscribe(topic string) error {
+	c.next++
+
+	subscribe := packet.NewSubscribePacket()
+	subscribe.ID = c.next
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: topic, QOS: 0},
+	}
+
+	err := c.conn.Send(subscribe)
+	if err != nil {
+		return err
+	}
+
+	// wait for suback
+	for {
+		pkt, err := c.conn.Receive()
+		if err != nil {
+			return err
+		}
+
+		// keep messages of earlier subscriptions for receive
+		if publish, ok := pkt.(*packet.PublishPacket); ok {
+			c.pending = append(c.pending, newMQTTMessage(publish))
+			continue
+		}
+
+		suback, ok := pkt.(*packet.SubackPacket)
+		if !ok || suback.ID != subscribe.ID {
+			continue
+		}
+
+		if len(suback.ReturnCodes) > 0 && suback.ReturnCodes[0] == packet.QOSFailure {
+			return fmt.Errorf("subscribe failed: %s", topic)
+		}
+
+		return nil
+	}
+}
+
+// Publish implements the Conn interface.
+func (c *MQTTConn) Publish(topic string, payload []byte) error {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = topic
+	publish.Message.Payload = payload
+
+	return c.conn.Send(publish)
+}
+
+// Receive implements the Conn interface.
+func (c *MQTTConn) Receive() (*Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+
+	for {
+		pkt, err := c.conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+
+		if publish, ok := pkt.(*packet.PublishPacket); ok {
+			return newMQTTMessage(publish), nil
+		}
+	}
+}
+
+// Close implements the Conn interface. A publish that is blocked by a broker
+// that stopped reading also blocks the DISCONNECT, which is then abandoned
+// and the blocked write is aborted after a second.
+func (c *MQTTConn) Close() error {
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		c.conn.Send(packet.NewDisconnectPacket())
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+	}
+
+	c.conn.SetCloseTimeout(time.Second)
+
+	return c.conn.Close()
+}
+
+func newMQTTMessage(publish *packet.PublishPacket) *Message {
+	return &Message{
+		Topic:   publish.Message.Topic,
+		Payload: publish.Message.Payload,
+	}
+}
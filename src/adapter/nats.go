@@ -0,0 +1,227 @@
+package adapter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NATSConn is a Conn that implements the core NATS client protocol.
+type NATSConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	sids    int
+	pending []*Message
+	mutex   sync.Mutex
+}
+
+// DialNATS connects to the NATS server at the specified URL. The default port
+// is 4222 and credentials in the URL are sent as user and password.
+func DialNATS(u *url.URL) (*NATSConn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNATSConn(conn, u.User)
+}
+
+// NewNATSConn performs the NATS handshake on the specified connection.
+func NewNATSConn(conn net.Conn, user *url.Userinfo) (*NATSConn, error) {
+	c := &NATSConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+
+	// read info
+	line, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	} else if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("nats: expected INFO, got %q", line)
+	}
+
+	// send connect
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "coolpy7_benchmark",
+	}
+
+	if user != nil {
+		options["user"] = user.Username()
+		options["pass"], _ = user.Password()
+	}
+
+	data, _ := json.Marshal(options)
+
+	err = c.write("CONNECT " + string(data) + "\r\n")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// check connection
+	err = c.ping()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Subscribe implements the Conn interface.
+func (c *NATSConn) Subscribe(topic string) error {
+	c.sids++
+
+	err := c.write("SUB " + topic + " " + strconv.Itoa(c.sids) + "\r\n")
+	if err != nil {
+		return err
+	}
+
+	// the server processes the subscription before the ping
+	return c.ping()
+}
+
+// Publish implements the Conn interface.
+func (c *NATSConn) Publish(topic string, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// the payload is terminated even if it is empty
+	c.writer.WriteString("PUB " + topic + " " + strconv.Itoa(len(payload)) + "\r\n")
+	c.writer.Write(payload)
+	c.writer.WriteString("\r\n")
+
+	return c.writer.Flush()
+}
+
+// Receive implements the Conn interface.
+func (c *NATSConn) Receive() (*Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+
+	for {
+		msg, _, err := c.read()
+		if err != nil {
+			return nil, err
+		} else if msg != nil {
+			return msg, nil
+		}
+	}
+}
+
+// Close implements the Conn interface.
+func (c *NATSConn) Close() error {
+	return c.conn.Close()
+}
+
+// ping sends a PING and waits for the PONG, it must not be called
+// concurrently with Receive. Messages received in the meantime are kept for
+// Receive.
+func (c *NATSConn) ping() error {
+	err := c.write("PING\r\n")
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, pong, err := c.read()
+		if err != nil {
+			return err
+		} else if msg != nil {
+			c.pending = append(c.pending, msg)
+		} else if pong {
+			return nil
+		}
+	}
+}
+
+// read reads the next line and returns the message of a MSG line with its
+// payload or whether the line was a PONG, server pings are answered and other
+// lines are skipped
+func (c *NATSConn) read() (*Message, bool, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// handle control lines
+	switch {
+	case line == "PING":
+		return nil, false, c.write("PONG\r\n")
+	case line == "PONG":
+		return nil, true, nil
+	case strings.HasPrefix(line, "-ERR"):
+		return nil, false, natsError(line)
+	case !strings.HasPrefix(line, "MSG "):
+		return nil, false, nil
+	}
+
+	// parse "MSG <subject> <sid> [reply-to] <#bytes>"
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(fields) > 5 {
+		return nil, false, fmt.Errorf("nats: invalid message %q", line)
+	}
+
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return nil, false, fmt.Errorf("nats: invalid message %q", line)
+	}
+
+	// read payload and trailing CRLF, which may contain line breaks
+	payload := make([]byte, size+2)
+	_, err = io.ReadFull(c.reader, payload)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &Message{
+		Topic:   fields[1],
+		Payload: payload[:size],
+	}, false, nil
+}
+
+// write writes and flushes the line
+func (c *NATSConn) write(line string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writer.WriteString(line)
+
+	return c.writer.Flush()
+}
+
+// readLine reads a line without the CRLF
+func (c *NATSConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func natsError(line string) error {
+	return errors.New("nats: " + strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+}
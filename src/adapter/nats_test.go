@@ -0,0 +1,142 @@
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeNATSServer(t *testing.T, conn net.Conn, lines chan<- string) {
+	reader := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+	if err != nil {
+		return
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			close(lines)
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		lines <- line
+
+		switch {
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "PUB "):
+			fields := strings.Fields(line)
+			payload, _ := reader.ReadString('\n')
+			conn.Write([]byte("PING\r\n+OK\r\nMSG " + fields[1] + " 1 " + fields[2] + "\r\n" + payload))
+		}
+	}
+}
+
+func TestNATSConn(t *testing.T) {
+	client, server := net.Pipe()
+
+	lines := make(chan string, 100)
+	go fakeNATSServer(t, server, lines)
+
+	conn, err := NewNATSConn(client, url.UserPassword("user", "secret"))
+	require.NoError(t, err)
+
+	connect := <-lines
+	assert.True(t, strings.HasPrefix(connect, "CONNECT {"))
+	assert.Contains(t, connect, `"user":"user"`)
+	assert.Contains(t, connect, `"pass":"secret"`)
+	assert.Equal(t, "PING", <-lines)
+
+	err = conn.Subscribe("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "SUB foo 1", <-lines)
+	assert.Equal(t, "PING", <-lines)
+
+	err = conn.Publish("foo", []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "PUB foo 5", <-lines)
+
+	msg, err := conn.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", msg.Topic)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+
+	// ping is answered while receiving
+	assert.Equal(t, "PONG", <-lines)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
+
+func TestNATSConnError(t *testing.T) {
+	client, server := net.Pipe()
+
+	go func() {
+		server.Write([]byte("INFO {}\r\n"))
+		reader := bufio.NewReader(server)
+		reader.ReadString('\n')
+		reader.ReadString('\n')
+		server.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+	}()
+
+	conn, err := NewNATSConn(client, nil)
+	assert.Nil(t, conn)
+	assert.EqualError(t, err, "nats: Authorization Violation")
+}
+
+func TestNATSConnSubscribeKeepsMessages(t *testing.T) {
+	client, server := net.Pipe()
+
+	go func() {
+		server.Write([]byte("INFO {}\r\n"))
+		reader := bufio.NewReader(server)
+		reader.ReadString('\n')
+		reader.ReadString('\n')
+		server.Write([]byte("PONG\r\n"))
+		reader.ReadString('\n')
+		reader.ReadString('\n')
+
+		// the payload of a message received before the pong contains a pong
+		server.Write([]byte("MSG foo 1 7\r\na\r\nPONG\r\nPONG\r\n"))
+	}()
+
+	conn, err := NewNATSConn(client, nil)
+	require.NoError(t, err)
+
+	err = conn.Subscribe("bar")
+	require.NoError(t, err)
+
+	msg, err := conn.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", msg.Topic)
+	assert.Equal(t, []byte("a\r\nPONG"), msg.Payload)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
+
+func TestNATSConnEmptyPayload(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &NATSConn{writer: bufio.NewWriter(&buf)}
+
+	// the empty payload is terminated so the next command is not consumed
+	err := conn.Publish("foo", nil)
+	require.NoError(t, err)
+
+	err = conn.Publish("foo", []byte{})
+	require.NoError(t, err)
+
+	err = conn.Publish("foo", []byte("hello"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "PUB foo 0\r\n\r\nPUB foo 0\r\n\r\nPUB foo 5\r\nhello\r\n", buf.String())
+}
@@ -0,0 +1,291 @@
+package adapter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// RedisConn is a Conn that uses Redis pub/sub. As a subscribed Redis
+// connection cannot publish, it opens a second connection for publishing.
+type RedisConn struct {
+	sub     *respConn
+	pub     *respConn
+	err     error
+	pending []*Message
+	mutex   sync.Mutex
+	closed  chan struct{}
+}
+
+// DialRedis connects to the Redis server at the specified URL. The default
+// port is 6379 and a password in the URL is sent with AUTH.
+func DialRedis(u *url.URL) (*RedisConn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	sub, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := net.Dial("tcp", host)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	return NewRedisConn(sub, pub, u.User)
+}
+
+// NewRedisConn authenticates the specified subscribe and publish connections
+// if the user info carries a password.
+func NewRedisConn(sub, pub net.Conn, user *url.Userinfo) (*RedisConn, error) {
+	c := &RedisConn{
+		sub:    newRESPConn(sub),
+		pub:    newRESPConn(pub),
+		closed: make(chan struct{}),
+	}
+
+	// authenticate
+	if password, ok := user.Password(); ok {
+		for _, conn := range []*respConn{c.sub, c.pub} {
+			_, err := conn.command("AUTH", user.Username(), password)
+			if err != nil {
+				c.sub.Close()
+				c.pub.Close()
+				return nil, err
+			}
+		}
+	}
+
+	// drain publish replies
+	go c.drain()
+
+	return c, nil
+}
+
+// Subscribe implements the Conn interface.
+func (c *RedisConn) Subscribe(topic string) error {
+	err := c.sub.write("SUBSCRIBE", topic)
+	if err != nil {
+		return err
+	}
+
+	for {
+		reply, err := c.sub.read()
+		if err != nil {
+			return err
+		}
+
+		// keep messages of earlier subscriptions for receive
+		if msg := redisMessage(reply); msg != nil {
+			c.pending = append(c.pending, msg)
+			continue
+		}
+
+		array, ok := reply.([]interface{})
+		if !ok || len(array) != 3 || !isBulk(array[0], "subscribe") {
+			return fmt.Errorf("redis: unexpected reply %v", reply)
+		}
+
+		return nil
+	}
+}
+
+// Publish implements the Conn interface. Errors returned by the server for a
+// previous publish are returned by the next call.
+func (c *RedisConn) Publish(topic string, payload []byte) error {
+	c.mutex.Lock()
+	err := c.err
+	c.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return c.pub.write("PUBLISH", topic, string(payload))
+}
+
+// Receive implements the Conn interface.
+func (c *RedisConn) Receive() (*Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+
+	for {
+		reply, err := c.sub.read()
+		if err != nil {
+			return nil, err
+		}
+
+		if msg := redisMessage(reply); msg != nil {
+			return msg, nil
+		}
+	}
+}
+
+// Close implements the Conn interface.
+func (c *RedisConn) Close() error {
+	err1 := c.sub.Close()
+	err2 := c.pub.Close()
+	<-c.closed
+
+	if err1 != nil {
+		return err1
+	}
+
+	return err2
+}
+
+func (c *RedisConn) drain() {
+	defer close(c.closed)
+
+	for {
+		_, err := c.pub.read()
+		if _, ok := err.(redisError); ok {
+			c.mutex.Lock()
+			c.err = err
+			c.mutex.Unlock()
+			continue
+		} else if err != nil {
+			return
+		}
+	}
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// respConn implements the RESP framing on top of a connection
+type respConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	mutex  sync.Mutex
+}
+
+func newRESPConn(conn net.Conn) *respConn {
+	return &respConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+}
+
+// command writes the command and reads the reply, it must not be called
+// concurrently with read
+func (c *respConn) command(args ...string) (interface{}, error) {
+	err := c.write(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.read()
+}
+
+// write writes and flushes the command as an array of bulk strings
+func (c *respConn) write(args ...string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.writer.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		c.writer.WriteString(arg)
+		c.writer.WriteString("\r\n")
+	}
+
+	return c.writer.Flush()
+}
+
+// read reads the next reply, bulk strings are returned as byte slices and
+// error replies as redisError
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	} else if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: invalid reply")
+	}
+
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		} else if size < 0 {
+			return nil, nil
+		}
+
+		// read data and trailing CRLF
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(c.reader, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return data[:size], nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		} else if size < 0 {
+			return nil, nil
+		}
+
+		array := make([]interface{}, size)
+		for i := range array {
+			array[i], err = c.read()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+	}
+
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
+
+// redisMessage returns the message of a ["message", channel, payload] reply
+// or nil for other replies
+func redisMessage(reply interface{}) *Message {
+	array, ok := reply.([]interface{})
+	if !ok || len(array) != 3 || !isBulk(array[0], "message") {
+		return nil
+	}
+
+	topic, _ := array[1].([]byte)
+	payload, _ := array[2].([]byte)
+
+	return &Message{
+		Topic:   string(topic),
+		Payload: payload,
+	}
+}
+
+func isBulk(value interface{}, str string) bool {
+	data, ok := value.([]byte)
+	return ok && string(data) == str
+}
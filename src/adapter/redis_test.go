@@ -0,0 +1,120 @@
+package adapter
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeRedisServer(conn net.Conn, commands chan<- []string, publish func([]string)) {
+	resp := newRESPConn(conn)
+
+	for {
+		reply, err := resp.read()
+		if err != nil {
+			close(commands)
+			return
+		}
+
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		commands <- args
+
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			conn.Write([]byte("+OK\r\n"))
+		case "SUBSCRIBE":
+			conn.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n:1\r\n"))
+		case "PUBLISH":
+			conn.Write([]byte(":1\r\n"))
+			publish(args)
+		}
+	}
+}
+
+func TestRedisConn(t *testing.T) {
+	subClient, subServer := net.Pipe()
+	pubClient, pubServer := net.Pipe()
+
+	subCommands := make(chan []string, 100)
+	pubCommands := make(chan []string, 100)
+
+	go fakeRedisServer(subServer, subCommands, nil)
+	go fakeRedisServer(pubServer, pubCommands, func(args []string) {
+		subServer.Write([]byte("*3\r\n$7\r\nmessage\r\n$3\r\n" + args[1] + "\r\n$5\r\n" + args[2] + "\r\n"))
+	})
+
+	conn, err := NewRedisConn(subClient, pubClient, url.UserPassword("", "secret"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AUTH", "", "secret"}, <-subCommands)
+	assert.Equal(t, []string{"AUTH", "", "secret"}, <-pubCommands)
+
+	err = conn.Subscribe("foo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SUBSCRIBE", "foo"}, <-subCommands)
+
+	err = conn.Publish("foo", []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PUBLISH", "foo", "hello"}, <-pubCommands)
+
+	msg, err := conn.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", msg.Topic)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
+
+func TestRedisConnSubscribeKeepsMessages(t *testing.T) {
+	subClient, subServer := net.Pipe()
+	pubClient, _ := net.Pipe()
+
+	go func() {
+		newRESPConn(subServer).read()
+		subServer.Write([]byte("*3\r\n$7\r\nmessage\r\n$3\r\nfoo\r\n$5\r\nhello\r\n" +
+			"*3\r\n$9\r\nsubscribe\r\n$3\r\nbar\r\n:2\r\n"))
+	}()
+
+	conn, err := NewRedisConn(subClient, pubClient, nil)
+	require.NoError(t, err)
+
+	err = conn.Subscribe("bar")
+	require.NoError(t, err)
+
+	msg, err := conn.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", msg.Topic)
+	assert.Equal(t, []byte("hello"), msg.Payload)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
+
+func TestRedisConnAuthError(t *testing.T) {
+	subClient, subServer := net.Pipe()
+	_, pubClient := net.Pipe()
+
+	go func() {
+		newRESPConn(subServer).read()
+		subServer.Write([]byte("-WRONGPASS invalid password\r\n"))
+	}()
+
+	conn, err := NewRedisConn(subClient, pubClient, url.UserPassword("", "wrong"))
+	assert.Nil(t, conn)
+	assert.EqualError(t, err, "redis: WRONGPASS invalid password")
+}
+
+func TestDialUnsupportedScheme(t *testing.T) {
+	conn, err := Dial("//localhost:1883", "test")
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrUnsupportedScheme, err)
+}
@@ -0,0 +1,60 @@
+package bench
+
+import (
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// cpuMask is a sched_setaffinity mask of up to 1024 CPUs
+type cpuMask [maxCPUs / 64]uint64
+
+// startPinned starts the command from a thread that is temporarily pinned to
+// the CPU set, the child process inherits the affinity of the forking thread
+func startPinned(cmd *exec.Cmd, cpus CPUSet) error {
+	var mask cpuMask
+	for _, cpu := range cpus {
+		if cpu >= len(mask)*64 {
+			return ErrInvalidCPUSet
+		}
+
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+
+	runtime.LockOSThread()
+
+	var previous cpuMask
+	err := schedAffinity(syscall.SYS_SCHED_GETAFFINITY, &previous)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+
+	err = schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &mask)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+
+	startErr := cmd.Start()
+
+	// keep the thread locked if the previous affinity cannot be restored so
+	// that no other goroutine is scheduled on it
+	err = schedAffinity(syscall.SYS_SCHED_SETAFFINITY, &previous)
+	if err == nil {
+		runtime.UnlockOSThread()
+	}
+
+	return startErr
+}
+
+// schedAffinity gets or sets the affinity of the current thread
+func schedAffinity(trap uintptr, mask *cpuMask) error {
+	_, _, errno := syscall.RawSyscall(trap, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
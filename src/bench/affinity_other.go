@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package bench
+
+import "os/exec"
+
+func startPinned(cmd *exec.Cmd, cpus CPUSet) error {
+	return ErrPinningUnsupported
+}
@@ -0,0 +1,127 @@
+package bench
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Barrier releases a fixed number of parties at the same instant once all
+// of them have arrived, e.g. to let thousands of connected publishers start a
+// burst together instead of staggered by their connect times. The release is
+// scheduled a lead time after the last arrival so that sleeping parties can
+// wake up in time. Every party sleeps until the release minus the tolerated
+// skew and spins for the rest, smaller skews therefore cost more CPU. It is
+// safe for concurrent use.
+type Barrier struct {
+	parties int
+	lead    time.Duration
+	skew    time.Duration
+
+	arrived  int
+	release  time.Time
+	canceled bool
+	ready    chan struct{}
+	mutex    sync.Mutex
+
+	deviations Latencies
+	late       int64
+}
+
+// NewBarrier returns a new Barrier for the specified number of parties that
+// releases them after the lead time and tolerates the specified skew.
+func NewBarrier(parties int, lead, skew time.Duration) *Barrier {
+	return &Barrier{
+		parties: parties,
+		lead:    lead,
+		skew:    skew,
+		ready:   make(chan struct{}),
+	}
+}
+
+// Arrive will record the arrival of a party that does not wait for the
+// release, e.g. a consumer that only has to be subscribed.
+func (b *Barrier) Arrive() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.arrived++
+	if b.arrived == b.parties && !b.canceled {
+		b.release = time.Now().Add(b.lead)
+		close(b.ready)
+	}
+}
+
+// Cancel will release the waiting parties immediately, e.g. because a party
+// failed to arrive. The parties of a canceled barrier are not measured.
+func (b *Barrier) Cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.canceled || b.arrived >= b.parties {
+		return
+	}
+
+	b.canceled = true
+	close(b.ready)
+}
+
+// Wait will record the arrival of a party and block until the release. It
+// returns the release time. Parties that arrive after the release, e.g.
+// workers added at runtime, return immediately and are not measured.
+func (b *Barrier) Wait() time.Time {
+	select {
+	case <-b.ready:
+		return b.release
+	default:
+	}
+
+	b.Arrive()
+	<-b.ready
+
+	b.mutex.Lock()
+	canceled := b.canceled
+	b.mutex.Unlock()
+
+	if canceled {
+		return time.Time{}
+	}
+
+	// sleep until shortly before the release and spin for the rest
+	if d := time.Until(b.release) - b.skew; d > 0 {
+		time.Sleep(d)
+	}
+
+	for time.Now().Before(b.release) {
+		runtime.Gosched()
+	}
+
+	// measure the deviation from the release
+	deviation := time.Since(b.release)
+	b.deviations.Add(deviation)
+	if deviation > b.skew {
+		atomic.AddInt64(&b.late, 1)
+	}
+
+	return b.release
+}
+
+// Released returns whether all parties have arrived.
+func (b *Barrier) Released() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.arrived >= b.parties && !b.canceled
+}
+
+// Metrics returns the percentiles of the deviation of the waiting parties
+// from the release and the number of parties that exceeded the skew using the
+// specified prefix for the names, e.g. "barrier.skew.p99" and "barrier.late".
+func (b *Barrier) Metrics(prefix string) Metrics {
+	metrics := b.deviations.Metrics(prefix + "skew.")
+	metrics[prefix+"late"] = float64(atomic.LoadInt64(&b.late))
+	metrics[prefix+"parties"] = float64(b.deviations.Len())
+
+	return metrics
+}
@@ -0,0 +1,93 @@
+package bench
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBarrier(t *testing.T) {
+	barrier := NewBarrier(11, 20*time.Millisecond, time.Millisecond)
+	barrier.Arrive()
+
+	// an early party blocks until the release
+	early := make(chan time.Time, 1)
+	go func() {
+		barrier.Wait()
+		early <- time.Now()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, barrier.Released())
+
+	select {
+	case <-early:
+		t.Fatal("party released before all parties arrived")
+	default:
+	}
+
+	var wg sync.WaitGroup
+	releases := make([]time.Time, 9)
+	returns := make([]time.Time, 9)
+	arrived := time.Now()
+	for i := range releases {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			releases[i] = barrier.Wait()
+			returns[i] = time.Now()
+		}(i)
+	}
+
+	wg.Wait()
+	assert.True(t, barrier.Released())
+
+	// the release is the lead time after the last arrival and no party
+	// returns before it
+	release := releases[0]
+	assert.False(t, release.Before(arrived.Add(20*time.Millisecond)))
+	assert.False(t, (<-early).Before(release))
+
+	for i := range releases {
+		assert.Equal(t, release, releases[i])
+		assert.False(t, returns[i].Before(release))
+	}
+
+	// late parties return immediately
+	assert.Equal(t, release, barrier.Wait())
+
+	// the deviations are bounded generously for loaded machines
+	metrics := barrier.Metrics("barrier.")
+	assert.Equal(t, 10.0, metrics["barrier.parties"])
+	assert.True(t, metrics["barrier.skew.p50"] >= 0)
+	assert.True(t, metrics["barrier.skew.p50"] < 0.05, metrics["barrier.skew.p50"])
+	assert.Contains(t, metrics, "barrier.late")
+}
+
+func TestBarrierCancel(t *testing.T) {
+	barrier := NewBarrier(3, time.Hour, time.Millisecond)
+
+	done := make(chan time.Time)
+	go func() {
+		done <- barrier.Wait()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	barrier.Cancel()
+
+	select {
+	case release := <-done:
+		assert.True(t, release.IsZero())
+	case <-time.After(time.Second):
+		t.Fatal("party not released")
+	}
+
+	// the barrier is not released by the remaining parties
+	barrier.Arrive()
+	barrier.Arrive()
+	assert.False(t, barrier.Released())
+	assert.True(t, barrier.Wait().IsZero())
+	assert.Equal(t, 0.0, barrier.Metrics("barrier.")["barrier.parties"])
+}
@@ -0,0 +1,55 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// BatchFrameSize is the size of the length prefix of every message in a
+// batch.
+const BatchFrameSize = 4
+
+// ErrInvalidBatch is returned by SplitBatch if a length prefix exceeds the
+// payload.
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// AppendBatch will append the message to the batch payload. The message is
+// framed with its length as a 32 bit big endian integer, the way applications
+// commonly concatenate messages to send them in a single publish.
+func AppendBatch(batch, message []byte) []byte {
+	var frame [BatchFrameSize]byte
+	binary.BigEndian.PutUint32(frame[:], uint32(len(message)))
+
+	batch = append(batch, frame[:]...)
+	batch = append(batch, message...)
+
+	return batch
+}
+
+// BatchSize returns the size of a batch payload of count messages with the
+// specified size.
+func BatchSize(count, size int) int {
+	return count * (BatchFrameSize + size)
+}
+
+// SplitBatch returns the messages of a batch payload created by AppendBatch.
+// The messages share the memory of the payload.
+func SplitBatch(payload []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(payload) > 0 {
+		if len(payload) < BatchFrameSize {
+			return messages, ErrInvalidBatch
+		}
+
+		size := binary.BigEndian.Uint32(payload)
+		payload = payload[BatchFrameSize:]
+		if uint64(size) > uint64(len(payload)) {
+			return messages, ErrInvalidBatch
+		}
+
+		messages = append(messages, payload[:size:size])
+		payload = payload[size:]
+	}
+
+	return messages, nil
+}
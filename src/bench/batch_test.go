@@ -0,0 +1,39 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	var batch []byte
+	batch = AppendBatch(batch, []byte("foo"))
+	batch = AppendBatch(batch, nil)
+	batch = AppendBatch(batch, []byte("barbaz"))
+	assert.Equal(t, 3*BatchFrameSize+9, len(batch))
+	assert.Equal(t, []byte{0, 0, 0, 3, 'f', 'o', 'o'}, batch[:7])
+
+	messages, err := SplitBatch(batch)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("foo"), {}, []byte("barbaz")}, messages)
+
+	messages, err = SplitBatch(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	assert.Equal(t, 3*(BatchFrameSize+16), BatchSize(3, 16))
+}
+
+func TestSplitBatchInvalid(t *testing.T) {
+	batch := AppendBatch(nil, []byte("foo"))
+
+	messages, err := SplitBatch(batch[:len(batch)-1])
+	assert.Equal(t, ErrInvalidBatch, err)
+	assert.Empty(t, messages)
+
+	messages, err = SplitBatch(append(batch, 0, 0))
+	assert.Equal(t, ErrInvalidBatch, err)
+	assert.Equal(t, [][]byte{[]byte("foo")}, messages)
+}
@@ -0,0 +1,6 @@
+// Package bench implements functionality shared by the benchmark tools.
+package bench
+
+// Metrics is a set of named values describing the result of a benchmark run.
+// Counts are stored as is, ratios as fractions and durations in seconds.
+type Metrics map[string]float64
@@ -0,0 +1,187 @@
+package bench
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrDuplicateClientID is returned by a generator created with UniqueIDs if a
+// client id has already been handed out.
+var ErrDuplicateClientID = errors.New("duplicate client id")
+
+// ErrClientIDsExhausted is returned by a generator created with FileIDs if
+// the file does not contain enough client ids.
+var ErrClientIDsExhausted = errors.New("client ids exhausted")
+
+// ErrInvalidIDGenerator is returned by ParseIDGenerator if the specification
+// is malformed.
+var ErrInvalidIDGenerator = errors.New("invalid client id generator")
+
+// An IDGenerator returns the client id for the connection with the specified
+// index. Implementations must be safe for concurrent use.
+type IDGenerator interface {
+	Next(index int) (string, error)
+}
+
+// The IDGeneratorFunc type allows the use of ordinary functions as
+// IDGenerators.
+type IDGeneratorFunc func(index int) (string, error)
+
+// Next calls f(index).
+func (f IDGeneratorFunc) Next(index int) (string, error) {
+	return f(index)
+}
+
+// PrefixIDs returns a generator that appends the connection index to the
+// specified prefix.
+func PrefixIDs(prefix string) IDGenerator {
+	return IDGeneratorFunc(func(index int) (string, error) {
+		return prefix + strconv.Itoa(index), nil
+	})
+}
+
+// SequentialIDs returns a generator that hands out increasing numbers starting
+// at start, independent of the connection index.
+func SequentialIDs(start int) IDGenerator {
+	var mutex sync.Mutex
+	next := start
+
+	return IDGeneratorFunc(func(int) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		id := strconv.Itoa(next)
+		next++
+
+		return id, nil
+	})
+}
+
+// UUIDIDs returns a generator that hands out random version 4 UUIDs.
+func UUIDIDs() IDGenerator {
+	return IDGeneratorFunc(func(int) (string, error) {
+		var b [16]byte
+		_, err := rand.Read(b[:])
+		if err != nil {
+			return "", err
+		}
+
+		// set version and variant
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+	})
+}
+
+// FileIDs returns a generator that hands out the client ids listed in the
+// specified file, one per line, by connection index. Empty lines and lines
+// starting with # are ignored.
+func FileIDs(path string) (IDGenerator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ids []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ids = append(ids, line)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return IDGeneratorFunc(func(index int) (string, error) {
+		if index < 0 || index >= len(ids) {
+			return "", ErrClientIDsExhausted
+		}
+
+		return ids[index], nil
+	}), nil
+}
+
+// UniqueIDs wraps the specified generator and returns ErrDuplicateClientID if
+// it hands out a client id for a second time.
+func UniqueIDs(generator IDGenerator) IDGenerator {
+	var mutex sync.Mutex
+	seen := make(map[string]bool)
+
+	return IDGeneratorFunc(func(index int) (string, error) {
+		id, err := generator.Next(index)
+		if err != nil {
+			return "", err
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// check collision
+		if seen[id] {
+			return "", fmt.Errorf("%w: %q", ErrDuplicateClientID, id)
+		}
+
+		seen[id] = true
+
+		return id, nil
+	})
+}
+
+// ParseIDGenerator creates a generator from a specification like "prefix:client",
+// "sequential:1000", "uuid" or "file:ids.txt". The returned generator detects
+// collisions using UniqueIDs.
+func ParseIDGenerator(spec string) (IDGenerator, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	var generator IDGenerator
+
+	switch kind {
+	case "prefix":
+		generator = PrefixIDs(arg)
+	case "sequential":
+		start := 0
+		if arg != "" {
+			var err error
+			start, err = strconv.Atoi(arg)
+			if err != nil {
+				return nil, ErrInvalidIDGenerator
+			}
+		}
+
+		generator = SequentialIDs(start)
+	case "uuid":
+		generator = UUIDIDs()
+	case "file":
+		if arg == "" {
+			return nil, ErrInvalidIDGenerator
+		}
+
+		var err error
+		generator, err = FileIDs(arg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidIDGenerator
+	}
+
+	return UniqueIDs(generator), nil
+}
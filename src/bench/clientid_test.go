@@ -0,0 +1,107 @@
+package bench
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixIDs(t *testing.T) {
+	generator := PrefixIDs("client")
+
+	id, err := generator.Next(7)
+	assert.NoError(t, err)
+	assert.Equal(t, "client7", id)
+}
+
+func TestSequentialIDs(t *testing.T) {
+	generator := SequentialIDs(100)
+
+	id, err := generator.Next(7)
+	assert.NoError(t, err)
+	assert.Equal(t, "100", id)
+
+	id, err = generator.Next(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "101", id)
+}
+
+func TestUUIDIDs(t *testing.T) {
+	generator := UUIDIDs()
+
+	id1, err := generator.Next(0)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id1)
+
+	id2, err := generator.Next(0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+}
+
+func TestFileIDs(t *testing.T) {
+	file, err := ioutil.TempFile("", "ids")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString("# ids\nfoo\n\n bar \n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	generator, err := FileIDs(file.Name())
+	assert.NoError(t, err)
+
+	id, err := generator.Next(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", id)
+
+	_, err = generator.Next(2)
+	assert.Equal(t, ErrClientIDsExhausted, err)
+
+	_, err = FileIDs(file.Name() + "-missing")
+	assert.Error(t, err)
+}
+
+func TestUniqueIDs(t *testing.T) {
+	generator := UniqueIDs(IDGeneratorFunc(func(index int) (string, error) {
+		return "foo", nil
+	}))
+
+	id, err := generator.Next(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", id)
+
+	_, err = generator.Next(1)
+	assert.True(t, errors.Is(err, ErrDuplicateClientID))
+	assert.EqualError(t, err, `duplicate client id: "foo"`)
+}
+
+func TestParseIDGenerator(t *testing.T) {
+	generator, err := ParseIDGenerator("prefix:client/")
+	assert.NoError(t, err)
+
+	id, err := generator.Next(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "client/1", id)
+
+	_, err = generator.Next(1)
+	assert.True(t, errors.Is(err, ErrDuplicateClientID))
+
+	generator, err = ParseIDGenerator("sequential:5")
+	assert.NoError(t, err)
+
+	id, err = generator.Next(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "5", id)
+
+	_, err = ParseIDGenerator("uuid")
+	assert.NoError(t, err)
+
+	for _, spec := range []string{"foo", "sequential:x", "file:", ""} {
+		_, err = ParseIDGenerator(spec)
+		assert.Equal(t, ErrInvalidIDGenerator, err, spec)
+	}
+}
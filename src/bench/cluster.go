@@ -0,0 +1,396 @@
+package bench
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidNode is returned by ParseNodes if a node specification is
+// malformed.
+var ErrInvalidNode = errors.New("invalid node")
+
+// ErrNoNodes is returned by NewCluster if no nodes have been specified.
+var ErrNoNodes = errors.New("no nodes")
+
+// ErrInvalidStrategy is returned by ParseStrategy if the strategy is unknown.
+var ErrInvalidStrategy = errors.New("invalid strategy")
+
+var nodeNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+var nodeWeightRegexp = regexp.MustCompile(`\*([0-9]+)$`)
+
+// A Node is a single broker of a cluster.
+type Node struct {
+	// The name used to tag the metrics of the node.
+	Name string
+
+	// The broker url of the node.
+	URL string
+
+	// The relative share of clients assigned to the node by the weighted
+	// and hash strategies.
+	Weight int
+
+	metrics Metrics
+	mutex   sync.Mutex
+}
+
+// Add will increment the specified metric of the node. It is safe for
+// concurrent use.
+func (n *Node) Add(metric string, delta float64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.metrics[metric] += delta
+}
+
+// Metrics returns a copy of the metrics recorded for the node.
+func (n *Node) Metrics() Metrics {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	metrics := Metrics{}
+	for name, value := range n.metrics {
+		metrics[name] = value
+	}
+
+	return metrics
+}
+
+// Transport returns the scheme of the node url like "tcp" or "wss", which
+// identifies the transport of its clients. Characters that are not allowed in
+// metric names are replaced with underscores.
+func (n *Node) Transport() string {
+	u, err := url.Parse(n.URL)
+	if err != nil || u.Scheme == "" {
+		return "unknown"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '+' || r == '-' || r == '.' {
+			return '_'
+		}
+
+		return r
+	}, u.Scheme)
+}
+
+// ParseNodes parses a comma separated list of nodes. Every node may be named
+// and weighted, e.g. "a=tcp://10.0.0.1:1883*2,b=tcp://10.0.0.2:1883". Unnamed
+// nodes are named by their position and the weight defaults to one. Only a
+// trailing "*" followed by digits is read as the weight, other asterisks are
+// kept in the url. Names must be unique.
+func ParseNodes(spec string) ([]*Node, error) {
+	var nodes []*Node
+	names := map[string]bool{}
+
+	for i, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		node := &Node{
+			Name:    "n" + strconv.Itoa(i),
+			Weight:  1,
+			metrics: Metrics{},
+		}
+
+		// get name
+		if j := strings.Index(part, "="); j >= 0 && !strings.Contains(part[:j], "://") {
+			node.Name, part = part[:j], part[j+1:]
+			if !nodeNameRegexp.MatchString(node.Name) {
+				return nil, ErrInvalidNode
+			}
+		}
+
+		// get weight
+		if m := nodeWeightRegexp.FindStringSubmatchIndex(part); m != nil {
+			weight, err := strconv.Atoi(part[m[2]:m[3]])
+			if err != nil || weight <= 0 {
+				return nil, ErrInvalidNode
+			}
+
+			node.Weight, part = weight, part[:m[0]]
+		}
+
+		if part == "" || names[node.Name] {
+			return nil, ErrInvalidNode
+		}
+
+		names[node.Name] = true
+
+		node.URL = part
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// A Strategy defines how clients are distributed across the nodes of a
+// cluster.
+type Strategy int
+
+// The available strategies.
+const (
+	// RoundRobin assigns clients to the nodes in turn and ignores weights.
+	RoundRobin Strategy = iota
+
+	// HashClientID assigns clients by the hash of their client id, which pins
+	// a client to the same node across runs.
+	HashClientID
+
+	// Weighted assigns clients in proportion to the node weights using a
+	// smooth weighted round-robin.
+	Weighted
+)
+
+// ParseStrategy returns the strategy with the specified name.
+func ParseStrategy(name string) (Strategy, error) {
+	switch name {
+	case "round-robin":
+		return RoundRobin, nil
+	case "hash":
+		return HashClientID, nil
+	case "weighted":
+		return Weighted, nil
+	}
+
+	return 0, ErrInvalidStrategy
+}
+
+// String returns the name of the strategy.
+func (s Strategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round-robin"
+	case HashClientID:
+		return "hash"
+	case Weighted:
+		return "weighted"
+	}
+
+	return "unknown"
+}
+
+// A Cluster distributes clients across a set of broker nodes and aggregates
+// the metrics recorded per node.
+type Cluster struct {
+	Nodes    []*Node
+	Strategy Strategy
+
+	next    int
+	current []int
+	mutex   sync.Mutex
+}
+
+// NewCluster returns a new Cluster for the specified nodes. It returns
+// ErrInvalidNode if two nodes share a name, as their metrics would be mixed.
+func NewCluster(nodes []*Node, strategy Strategy) (*Cluster, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	names := map[string]bool{}
+	for _, node := range nodes {
+		if names[node.Name] {
+			return nil, ErrInvalidNode
+		}
+
+		names[node.Name] = true
+
+		if node.metrics == nil {
+			node.metrics = Metrics{}
+		}
+
+		if node.Weight <= 0 {
+			node.Weight = 1
+		}
+	}
+
+	return &Cluster{
+		Nodes:    nodes,
+		Strategy: strategy,
+		current:  make([]int, len(nodes)),
+	}, nil
+}
+
+// String returns the nodes in the format of ParseNodes, e.g.
+// "a=tcp://10.0.0.1:1883*2,b=tcp://10.0.0.2:1883*1".
+func (c *Cluster) String() string {
+	parts := make([]string, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		parts = append(parts, node.Name+"="+node.URL+"*"+strconv.Itoa(node.Weight))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Pick returns the node the client with the specified id should connect to.
+// It is safe for concurrent use.
+func (c *Cluster) Pick(clientID string) *Node {
+	switch c.Strategy {
+	case HashClientID:
+		return c.hash(clientID)
+	case Weighted:
+		return c.weighted()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	node := c.Nodes[c.next%len(c.Nodes)]
+	c.next++
+
+	return node
+}
+
+func (c *Cluster) hash(clientID string) *Node {
+	// get total weight
+	total := 0
+	for _, node := range c.Nodes {
+		total += node.Weight
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+	slot := int(h.Sum32() % uint32(total))
+
+	// find node that owns the slot
+	for _, node := range c.Nodes {
+		if slot < node.Weight {
+			return node
+		}
+
+		slot -= node.Weight
+	}
+
+	return c.Nodes[len(c.Nodes)-1]
+}
+
+func (c *Cluster) weighted() *Node {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// increase all current weights and select the largest
+	total := 0
+	best := 0
+	for i, node := range c.Nodes {
+		c.current[i] += node.Weight
+		total += node.Weight
+
+		if c.current[i] > c.current[best] {
+			best = i
+		}
+	}
+
+	c.current[best] -= total
+
+	return c.Nodes[best]
+}
+
+// Metrics returns the metrics of all nodes tagged like "node.<name>.<metric>".
+// For every metric the largest ratio of a node value to the share of the total
+// expected on that node is added as "imbalance.<metric>", where 1 means
+// perfectly balanced. The expected share follows the node weights, except
+// with the round-robin strategy, which ignores them.
+func (c *Cluster) Metrics() Metrics {
+	metrics := Metrics{}
+	sums := map[string]float64{}
+	values := make([]Metrics, len(c.Nodes))
+
+	for i, node := range c.Nodes {
+		values[i] = node.Metrics()
+		for name, value := range values[i] {
+			metrics["node."+node.Name+"."+name] = value
+			sums[name] += value
+		}
+	}
+
+	for name, sum := range sums {
+		if sum <= 0 {
+			continue
+		}
+
+		var imbalance float64
+		for i := range c.Nodes {
+			if ratio := values[i][name] / (sum * c.share(i)); ratio > imbalance {
+				imbalance = ratio
+			}
+		}
+
+		metrics["imbalance."+name] = imbalance
+	}
+
+	return metrics
+}
+
+// share returns the fraction of all clients the strategy assigns to a node
+func (c *Cluster) share(i int) float64 {
+	if c.Strategy == RoundRobin {
+		return 1 / float64(len(c.Nodes))
+	}
+
+	total := 0
+	for _, node := range c.Nodes {
+		total += node.Weight
+	}
+
+	return float64(c.Nodes[i].Weight) / float64(total)
+}
+
+// TransportMetrics returns the metrics of all nodes summed per transport like
+// "transport.<scheme>.<metric>", which breaks down mixed workloads where e.g.
+// tcp and wss clients connect at the same time.
+func (c *Cluster) TransportMetrics() Metrics {
+	metrics := Metrics{}
+	for _, node := range c.Nodes {
+		for name, value := range node.Metrics() {
+			metrics["transport."+node.Transport()+"."+name] += value
+		}
+	}
+
+	return metrics
+}
+
+// Transports returns the sorted transports of the nodes.
+func (c *Cluster) Transports() []string {
+	seen := map[string]bool{}
+	for _, node := range c.Nodes {
+		seen[node.Transport()] = true
+	}
+
+	var transports []string
+	for transport := range seen {
+		transports = append(transports, transport)
+	}
+
+	sort.Strings(transports)
+
+	return transports
+}
+
+// Names returns the sorted names of the metrics recorded on any node.
+func (c *Cluster) Names() []string {
+	seen := map[string]bool{}
+	for _, node := range c.Nodes {
+		for name := range node.Metrics() {
+			seen[name] = true
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,175 @@
+package bench
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNodes(t *testing.T) {
+	nodes, err := ParseNodes("tcp://10.0.0.1:1883, a=tcp://10.0.0.2:1883*3,tcp://u:p@10.0.0.3:1883?x=1")
+	require.NoError(t, err)
+	require.Len(t, nodes, 3)
+
+	assert.Equal(t, "n0", nodes[0].Name)
+	assert.Equal(t, "tcp://10.0.0.1:1883", nodes[0].URL)
+	assert.Equal(t, 1, nodes[0].Weight)
+
+	assert.Equal(t, "a", nodes[1].Name)
+	assert.Equal(t, "tcp://10.0.0.2:1883", nodes[1].URL)
+	assert.Equal(t, 3, nodes[1].Weight)
+
+	assert.Equal(t, "n2", nodes[2].Name)
+	assert.Equal(t, "tcp://u:p@10.0.0.3:1883?x=1", nodes[2].URL)
+
+	// asterisks that are no weight suffix belong to the url
+	nodes, err = ParseNodes("ws://a/mqtt*x,ws://b/*/mqtt*2")
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+
+	assert.Equal(t, "ws://a/mqtt*x", nodes[0].URL)
+	assert.Equal(t, 1, nodes[0].Weight)
+	assert.Equal(t, "ws://b/*/mqtt", nodes[1].URL)
+	assert.Equal(t, 2, nodes[1].Weight)
+}
+
+func TestParseNodesError(t *testing.T) {
+	for _, spec := range []string{"tcp://a*0", "tcp://a*99999999999999999999", "*2", "a b=tcp://a", "a=", "a=tcp://a,a=tcp://b", "n1=tcp://a,tcp://b"} {
+		_, err := ParseNodes(spec)
+		assert.Equal(t, ErrInvalidNode, err, spec)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for _, strategy := range []Strategy{RoundRobin, HashClientID, Weighted} {
+		parsed, err := ParseStrategy(strategy.String())
+		assert.NoError(t, err)
+		assert.Equal(t, strategy, parsed)
+	}
+
+	_, err := ParseStrategy("foo")
+	assert.Equal(t, ErrInvalidStrategy, err)
+}
+
+func TestNewClusterNoNodes(t *testing.T) {
+	_, err := NewCluster(nil, RoundRobin)
+	assert.Equal(t, ErrNoNodes, err)
+}
+
+func TestNewClusterDuplicateNodes(t *testing.T) {
+	_, err := NewCluster([]*Node{{Name: "a", URL: "tcp://a"}, {Name: "a", URL: "tcp://b"}}, RoundRobin)
+	assert.Equal(t, ErrInvalidNode, err)
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	nodes, err := ParseNodes("tcp://a,tcp://b*5")
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(nodes, RoundRobin)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tcp://a", cluster.Pick("x").URL)
+	assert.Equal(t, "tcp://b", cluster.Pick("x").URL)
+	assert.Equal(t, "tcp://a", cluster.Pick("x").URL)
+}
+
+func TestClusterWeighted(t *testing.T) {
+	nodes, err := ParseNodes("tcp://a*5,tcp://b,tcp://c")
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(nodes, Weighted)
+	require.NoError(t, err)
+
+	var picks []string
+	for i := 0; i < 7; i++ {
+		picks = append(picks, cluster.Pick("").Name)
+	}
+
+	assert.Equal(t, []string{"n0", "n0", "n1", "n0", "n2", "n0", "n0"}, picks)
+}
+
+func TestClusterHashClientID(t *testing.T) {
+	nodes, err := ParseNodes("tcp://a,tcp://b,tcp://c*2")
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(nodes, HashClientID)
+	require.NoError(t, err)
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		id := "client" + strconv.Itoa(i)
+
+		node := cluster.Pick(id)
+		assert.Equal(t, node, cluster.Pick(id))
+
+		counts[node.Name]++
+	}
+
+	assert.InDelta(t, 250, counts["n0"], 50)
+	assert.InDelta(t, 250, counts["n1"], 50)
+	assert.InDelta(t, 500, counts["n2"], 50)
+}
+
+func TestClusterMetrics(t *testing.T) {
+	nodes, err := ParseNodes("a=tcp://a,b=tcp://b")
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(nodes, RoundRobin)
+	require.NoError(t, err)
+
+	cluster.Pick("").Add("connections", 3)
+	cluster.Pick("").Add("connections", 1)
+	nodes[0].Add("received", 10)
+
+	assert.Equal(t, []string{"connections", "received"}, cluster.Names())
+	assert.Equal(t, Metrics{
+		"node.a.connections":    3,
+		"node.b.connections":    1,
+		"node.a.received":       10,
+		"imbalance.connections": 1.5,
+		"imbalance.received":    2,
+	}, cluster.Metrics())
+}
+
+func TestClusterMetricsWeighted(t *testing.T) {
+	nodes, err := ParseNodes("a=tcp://a*3,b=tcp://b")
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(nodes, Weighted)
+	require.NoError(t, err)
+
+	// the connections follow the weights
+	nodes[0].Add("connections", 6)
+	nodes[1].Add("connections", 2)
+
+	// b got twice its share
+	nodes[0].Add("received", 4)
+	nodes[1].Add("received", 4)
+
+	metrics := cluster.Metrics()
+	assert.Equal(t, 1.0, metrics["imbalance.connections"])
+	assert.Equal(t, 2.0, metrics["imbalance.received"])
+}
+
+func TestClusterTransportMetrics(t *testing.T) {
+	nodes, err := ParseNodes("a=tcp://a*3,b=tcp://b,c=wss://c/mqtt,d=wss+h2://d")
+	require.NoError(t, err)
+
+	cluster, err := NewCluster(nodes, Weighted)
+	require.NoError(t, err)
+
+	assert.Equal(t, "tcp", nodes[0].Transport())
+	assert.Equal(t, "wss_h2", nodes[3].Transport())
+	assert.Equal(t, []string{"tcp", "wss", "wss_h2"}, cluster.Transports())
+
+	nodes[0].Add("sent", 3)
+	nodes[1].Add("sent", 1)
+	nodes[2].Add("sent", 2)
+
+	assert.Equal(t, Metrics{
+		"transport.tcp.sent": 4,
+		"transport.wss.sent": 2,
+	}, cluster.TransportMetrics())
+}
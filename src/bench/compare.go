@@ -0,0 +1,227 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// the names or last name components of metrics that improve when they
+// increase, e.g. "throughput", "node.a.received" or "intern.hit_rate"
+var higherNames = map[string]bool{
+	"sent":             true,
+	"received":         true,
+	"delivered":        true,
+	"acked":            true,
+	"throughput":       true,
+	"rate":             true,
+	"messages":         true,
+	"bytes":            true,
+	"connections":      true,
+	"connected":        true,
+	"accepted":         true,
+	"limit":            true,
+	"handshakes":       true,
+	"resumed":          true,
+	"passed":           true,
+	"pongs":            true,
+	"hit_rate":         true,
+	"reuse_rate":       true,
+	"packets_per_read": true,
+}
+
+// the prefixes of metrics that improve when they increase, e.g. transferred
+// bytes and packets, which grow with the throughput
+var higherPrefixes = []string{"goodput.", "wire.", "packets.", "bytes."}
+
+// the prefixes of metrics that improve when they decrease even if their last
+// name component is in higherNames, e.g. "overhead.wire.sent"
+var lowerPrefixes = []string{"overhead.", "throttled."}
+
+// HigherIsBetter returns whether an increase of the metric is an improvement.
+// For all other metrics (e.g. loss, errors or latencies) a decrease is an
+// improvement.
+func HigherIsBetter(name string) bool {
+	for _, prefix := range lowerPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+
+	for _, prefix := range higherPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return higherNames[name] || higherNames[name[strings.LastIndex(name, ".")+1:]]
+}
+
+// A Verdict classifies the difference of a metric between two runs.
+type Verdict string
+
+// All available verdicts.
+const (
+	Unchanged   Verdict = "unchanged"
+	Improvement Verdict = "improvement"
+	Regression  Verdict = "regression"
+)
+
+// A Comparison describes the difference of a single metric between a base
+// and a head run.
+type Comparison struct {
+	// The name of the compared metric.
+	Metric string
+
+	// The values of the metric in both runs.
+	Base float64
+	Head float64
+
+	// The relative change from base to head.
+	Change float64
+
+	// The two-sided p-value of the Mann-Whitney U test on the samples of
+	// both runs. It is NaN if not enough samples are available.
+	P float64
+
+	// The classification of the change.
+	Verdict Verdict
+}
+
+// Compare will compare all metrics that are available in both results. If
+// both runs provide at least two samples for a metric, a change is significant
+// if the p-value of the Mann-Whitney U test is below alpha. Otherwise a change
+// is significant if the relative change is at least minChange. Comparisons are
+// sorted by metric name.
+func Compare(base, head *Result, alpha, minChange float64) []Comparison {
+	// collect metric names
+	names := make(map[string]bool)
+	for name := range base.Metrics {
+		names[name] = true
+	}
+	for name := range base.Samples {
+		names[name] = true
+	}
+
+	var list []Comparison
+
+	for name := range names {
+		// get values
+		baseValue, ok1 := base.Value(name)
+		headValue, ok2 := head.Value(name)
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		comparison := Comparison{
+			Metric:  name,
+			Base:    baseValue,
+			Head:    headValue,
+			Change:  relativeChange(baseValue, headValue),
+			P:       math.NaN(),
+			Verdict: Unchanged,
+		}
+
+		// check significance
+		significant := math.Abs(comparison.Change) >= minChange
+		if len(base.Samples[name]) >= 2 && len(head.Samples[name]) >= 2 {
+			comparison.P = MannWhitney(base.Samples[name], head.Samples[name])
+			significant = comparison.P < alpha
+		}
+
+		// classify change
+		if significant && headValue != baseValue {
+			if (headValue > baseValue) == HigherIsBetter(name) {
+				comparison.Verdict = Improvement
+			} else {
+				comparison.Verdict = Regression
+			}
+		}
+
+		list = append(list, comparison)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Metric < list[j].Metric
+	})
+
+	return list
+}
+
+func relativeChange(base, head float64) float64 {
+	if base == head {
+		return 0
+	}
+
+	if base == 0 {
+		return math.Inf(int(math.Copysign(1, head)))
+	}
+
+	return (head - base) / math.Abs(base)
+}
+
+// MannWhitney returns the two-sided p-value of the Mann-Whitney U test for
+// the two samples using the normal approximation with tie and continuity
+// correction. It returns 1 if the samples are empty or all values are equal.
+func MannWhitney(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	// combine and sort samples
+	type value struct {
+		v     float64
+		first bool
+	}
+	values := make([]value, 0, len(a)+len(b))
+	for _, v := range a {
+		values = append(values, value{v, true})
+	}
+	for _, v := range b {
+		values = append(values, value{v, false})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].v < values[j].v
+	})
+
+	// assign average ranks to ties and sum ranks of the first sample
+	rankSum := 0.0
+	tieSum := 0.0
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if values[k].first {
+				rankSum += rank
+			}
+		}
+
+		t := float64(j - i)
+		tieSum += t*t*t - t
+		i = j
+	}
+
+	// compute statistic
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	n := n1 + n2
+	variance := n1 * n2 / 12 * ((n + 1) - tieSum/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+
+	// apply continuity correction
+	diff := math.Abs(u-mean) - 0.5
+	if diff < 0 {
+		diff = 0
+	}
+
+	z := diff / math.Sqrt(variance)
+
+	return math.Erfc(z / math.Sqrt2)
+}
@@ -0,0 +1,85 @@
+package bench
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMannWhitney(t *testing.T) {
+	// reference values of scipy.stats.mannwhitneyu using method="asymptotic"
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []float64{9, 10, 11, 12, 13, 14, 15, 16}
+	assert.InDelta(t, 0.000939, MannWhitney(a, b), 1e-6)
+
+	a = []float64{1, 3, 5, 7, 9}
+	b = []float64{2, 4, 6, 8, 10}
+	assert.InDelta(t, 0.676, MannWhitney(a, b), 1e-3)
+
+	assert.Equal(t, 1.0, MannWhitney(nil, b))
+	assert.Equal(t, 1.0, MannWhitney([]float64{1, 1}, []float64{1, 1}))
+}
+
+func TestCompare(t *testing.T) {
+	base := NewResult("test")
+	base.Metrics["loss"] = 0.01
+	base.Metrics["sent"] = 100
+	base.Metrics["errors"] = 2
+	base.Samples["throughput"] = []float64{100, 101, 102, 103, 104, 105, 106, 107}
+
+	head := NewResult("test")
+	head.Metrics["loss"] = 0.02
+	head.Metrics["sent"] = 101
+	head.Samples["throughput"] = []float64{120, 121, 122, 123, 124, 125, 126, 127}
+
+	list := Compare(base, head, 0.05, 0.05)
+	assert.Len(t, list, 3)
+
+	assert.Equal(t, "loss", list[0].Metric)
+	assert.Equal(t, Regression, list[0].Verdict)
+	assert.InDelta(t, 1, list[0].Change, 1e-9)
+	assert.True(t, math.IsNaN(list[0].P))
+
+	assert.Equal(t, "sent", list[1].Metric)
+	assert.Equal(t, Unchanged, list[1].Verdict)
+	assert.InDelta(t, 0.01, list[1].Change, 1e-9)
+
+	assert.Equal(t, "throughput", list[2].Metric)
+	assert.Equal(t, Improvement, list[2].Verdict)
+	assert.InDelta(t, 103.5, list[2].Base, 1e-9)
+	assert.InDelta(t, 123.5, list[2].Head, 1e-9)
+	assert.True(t, list[2].P < 0.05)
+}
+
+func TestHigherIsBetter(t *testing.T) {
+	for _, name := range []string{
+		"sent", "received", "throughput", "delivered", "acked", "intern.hit_rate",
+		"arena.reuse_rate", "read.packets_per_read", "capacity.connected", "capacity.limit",
+		"goodput.sent", "wire.received", "packets.sent.publish", "handshakes", "passed",
+		"ws.pongs", "node.a.received", "transport.tcp.connections", "connack.accepted",
+	} {
+		assert.True(t, HigherIsBetter(name), name)
+	}
+
+	for _, name := range []string{
+		"loss", "errors", "error_rate", "latency.p99", "reordered", "failures",
+		"connect.failures.refused", "overhead.wire.sent", "throttled.client", "capacity.evicted",
+		"ws.pong.p99", "barrier.skew.p50", "redelivered",
+	} {
+		assert.False(t, HigherIsBetter(name), name)
+	}
+}
+
+func TestCompareNotSignificant(t *testing.T) {
+	base := NewResult("test")
+	base.Samples["throughput"] = []float64{100, 130, 90, 120}
+
+	head := NewResult("test")
+	head.Samples["throughput"] = []float64{80, 125, 110, 105}
+
+	list := Compare(base, head, 0.05, 0.01)
+	assert.Len(t, list, 1)
+	assert.Equal(t, Unchanged, list[0].Verdict)
+	assert.True(t, list[0].P > 0.05)
+}
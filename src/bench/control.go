@@ -0,0 +1,186 @@
+package bench
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrInvalidSettings is returned by Control.Update for negative settings or
+// a rate that is not a finite number.
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// Settings are the load parameters that can be changed during a run.
+type Settings struct {
+	// The publish rate per publisher in messages per second, zero publishes
+	// as fast as possible.
+	Rate float64 `json:"rate"`
+
+	// The number of publisher and consumer pairs.
+	Workers int `json:"workers"`
+
+	// The payload size in bytes.
+	Size int `json:"size"`
+}
+
+// A Control holds the settings of a running benchmark and allows changing
+// them without restarting the run, e.g. to explore the capacity of a broker
+// interactively. Workers poll the version, which does not lock, to pick up
+// changes. It is safe for concurrent use.
+type Control struct {
+	settings Settings
+	version  int64
+	changed  chan struct{}
+	mutex    sync.Mutex
+}
+
+// NewControl returns a new Control with the initial settings.
+func NewControl(initial Settings) *Control {
+	return &Control{
+		settings: initial,
+		changed:  make(chan struct{}),
+	}
+}
+
+// Settings returns the current settings and their version.
+func (c *Control) Settings() (Settings, int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.settings, c.version
+}
+
+// Version returns the number of updates applied so far.
+func (c *Control) Version() int64 {
+	return atomic.LoadInt64(&c.version)
+}
+
+// Changed returns a channel that is closed on the next update.
+func (c *Control) Changed() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.changed
+}
+
+// Update replaces the settings and notifies the waiters of Changed.
+func (c *Control) Update(settings Settings) error {
+	// check settings
+	if settings.Rate < 0 || math.IsNaN(settings.Rate) || math.IsInf(settings.Rate, 0) ||
+		settings.Workers < 0 || settings.Size < 0 {
+		return ErrInvalidSettings
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.settings = settings
+	atomic.AddInt64(&c.version, 1)
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	return nil
+}
+
+// ServeHTTP returns the settings as JSON on GET requests. POST requests
+// update the settings from the query parameters "rate", "workers" and "size"
+// or a JSON body. Settings that are not specified remain unchanged. A rate
+// must be a finite number above zero.
+func (c *Control) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		settings, _ := c.Settings()
+
+		err := parseSettings(r, &settings)
+		if err == nil {
+			err = c.Update(settings)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, _ := c.Settings()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// parseSettings applies the settings of the request
+func parseSettings(r *http.Request, settings *Settings) error {
+	// decode body
+	if r.Header.Get("Content-Type") == "application/json" {
+		var body struct {
+			Rate    *float64 `json:"rate"`
+			Workers *int     `json:"workers"`
+			Size    *int     `json:"size"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			return err
+		}
+
+		if body.Rate != nil {
+			if !validRate(*body.Rate) {
+				return ErrInvalidSettings
+			}
+
+			settings.Rate = *body.Rate
+		}
+		if body.Workers != nil {
+			settings.Workers = *body.Workers
+		}
+		if body.Size != nil {
+			settings.Size = *body.Size
+		}
+
+		return nil
+	}
+
+	// parse query
+	query := r.URL.Query()
+	if value := query.Get("rate"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || !validRate(rate) {
+			return ErrInvalidSettings
+		}
+
+		settings.Rate = rate
+	}
+
+	if value := query.Get("workers"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil {
+			return ErrInvalidSettings
+		}
+
+		settings.Workers = workers
+	}
+
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return ErrInvalidSettings
+		}
+
+		settings.Size = size
+	}
+
+	return nil
+}
+
+// validRate returns whether a requested rate is a finite number above zero
+func validRate(rate float64) bool {
+	return rate > 0 && !math.IsInf(rate, 0)
+}
@@ -0,0 +1,94 @@
+package bench
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlUpdate(t *testing.T) {
+	control := NewControl(Settings{Rate: 10, Workers: 2, Size: 64})
+
+	settings, version := control.Settings()
+	assert.Equal(t, Settings{Rate: 10, Workers: 2, Size: 64}, settings)
+	assert.Equal(t, int64(0), version)
+
+	changed := control.Changed()
+
+	err := control.Update(Settings{Rate: 20, Workers: 4, Size: 128})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), control.Version())
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected change notification")
+	}
+
+	err = control.Update(Settings{Rate: -1})
+	assert.Equal(t, ErrInvalidSettings, err)
+	assert.Equal(t, int64(1), control.Version())
+
+	for _, rate := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		err = control.Update(Settings{Rate: rate})
+		assert.Equal(t, ErrInvalidSettings, err)
+	}
+	assert.Equal(t, int64(1), control.Version())
+}
+
+func TestControlHTTP(t *testing.T) {
+	control := NewControl(Settings{Rate: 10, Workers: 2, Size: 64})
+
+	server := httptest.NewServer(control)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// update from query
+	res, err = http.Post(server.URL+"?rate=50&workers=8", "", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	settings, _ := control.Settings()
+	assert.Equal(t, Settings{Rate: 50, Workers: 8, Size: 64}, settings)
+
+	// update from body
+	res, err = http.Post(server.URL, "application/json", strings.NewReader(`{"size":256}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	settings, _ = control.Settings()
+	assert.Equal(t, Settings{Rate: 50, Workers: 8, Size: 256}, settings)
+
+	// invalid values
+	res, err = http.Post(server.URL+"?workers=-1", "", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	for _, rate := range []string{"foo", "NaN", "Inf", "-Inf", "0", "-1", "1e400"} {
+		res, err = http.Post(server.URL+"?rate="+rate, "", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, rate)
+	}
+
+	for _, body := range []string{`{"rate":0}`, `{"rate":-5}`, `{"rate":1e400}`, `{"rate":"NaN"}`} {
+		res, err = http.Post(server.URL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+
+	assert.Equal(t, int64(2), control.Version())
+}
@@ -0,0 +1,383 @@
+package bench
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredentials is returned by OpenCredentials if the provider url
+// has an unknown scheme.
+var ErrInvalidCredentials = errors.New("invalid credentials provider")
+
+// ErrMissingCredentials is returned if a provider does not hold the username
+// or password.
+var ErrMissingCredentials = errors.New("missing credentials")
+
+// Credentials are the username and password sent with the CONNECT packet.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// A CredentialProvider resolves credentials from an external source, so that
+// they do not have to be part of the broker url or the scenario.
+type CredentialProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// OpenCredentials returns a provider for the specified url:
+//
+//	env://?username=MQTT_USERNAME&password=MQTT_PASSWORD   environment variables
+//	file:///path/to/credentials.json                       JSON file
+//	vault://host:8200/secret/data/mqtt                     HashiCorp Vault over HTTP
+//	vaults://host:8200/secret/data/mqtt                    HashiCorp Vault over HTTPS
+//	aws://eu-west-1/mqtt/credentials                       AWS Secrets Manager
+//
+// The file, Vault and AWS providers read a JSON object and take the values of
+// the "username" and "password" fields. Other field names can be selected
+// using the username and password query parameters. Vault requires the token
+// in VAULT_TOKEN and AWS the keys in AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and optionally AWS_SESSION_TOKEN.
+func OpenCredentials(providerURL string) (CredentialProvider, error) {
+	u, err := url.Parse(providerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// get field names
+	query := u.Query()
+	fields := [2]string{"username", "password"}
+	if name := query.Get("username"); name != "" {
+		fields[0] = name
+	}
+	if name := query.Get("password"); name != "" {
+		fields[1] = name
+	}
+
+	switch u.Scheme {
+	case "env":
+		provider := &EnvCredentials{
+			Username: "MQTT_USERNAME",
+			Password: "MQTT_PASSWORD",
+		}
+
+		if name := query.Get("username"); name != "" {
+			provider.Username = name
+		}
+		if name := query.Get("password"); name != "" {
+			provider.Password = name
+		}
+
+		return provider, nil
+	case "file":
+		return &FileCredentials{
+			Path:   u.Host + u.Path,
+			Fields: fields,
+		}, nil
+	case "vault", "vaults":
+		scheme := "http"
+		if u.Scheme == "vaults" {
+			scheme = "https"
+		}
+
+		return &VaultCredentials{
+			Address: scheme + "://" + u.Host,
+			Path:    strings.Trim(u.Path, "/"),
+			Token:   os.Getenv("VAULT_TOKEN"),
+			Fields:  fields,
+			Client:  &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "aws":
+		return &AWSCredentials{
+			Region:       u.Host,
+			SecretID:     strings.Trim(u.Path, "/"),
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			Fields:       fields,
+			Client:       &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// EnvCredentials reads the credentials from environment variables.
+type EnvCredentials struct {
+	// The names of the variables.
+	Username string
+	Password string
+}
+
+// Credentials implements the CredentialProvider interface.
+func (p *EnvCredentials) Credentials() (Credentials, error) {
+	username, ok := os.LookupEnv(p.Username)
+	if !ok {
+		return Credentials{}, fmt.Errorf("%s: %s not set", ErrMissingCredentials, p.Username)
+	}
+
+	return Credentials{
+		Username: username,
+		Password: os.Getenv(p.Password),
+	}, nil
+}
+
+// FileCredentials reads the credentials from a JSON file.
+type FileCredentials struct {
+	// The path of the file.
+	Path string
+
+	// The names of the username and password fields.
+	Fields [2]string
+}
+
+// Credentials implements the CredentialProvider interface.
+func (p *FileCredentials) Credentials() (Credentials, error) {
+	data, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return secretCredentials(data, p.Fields)
+}
+
+// VaultCredentials reads the credentials from a secret of HashiCorp Vault.
+// Both versions of the key/value secrets engine are supported.
+type VaultCredentials struct {
+	// The address of the server and the path of the secret, e.g.
+	// "secret/data/mqtt".
+	Address string
+	Path    string
+
+	// The token used to authenticate.
+	Token string
+
+	// The names of the username and password fields.
+	Fields [2]string
+
+	// The client used to send requests.
+	Client *http.Client
+}
+
+// Credentials implements the CredentialProvider interface.
+func (p *VaultCredentials) Credentials() (Credentials, error) {
+	req, err := http.NewRequest("GET", p.Address+"/v1/"+p.Path, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	data, err := readSecret(p.Client, req, "vault")
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	// unwrap response
+	var res struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	// unwrap version 2 secrets
+	var v2 struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+
+	err = json.Unmarshal(res.Data, &v2)
+	if err == nil && v2.Data != nil && v2.Metadata != nil {
+		return secretCredentials(v2.Data, p.Fields)
+	}
+
+	return secretCredentials(res.Data, p.Fields)
+}
+
+// AWSCredentials reads the credentials from a JSON secret of the AWS Secrets
+// Manager.
+type AWSCredentials struct {
+	// The region and the name or ARN of the secret.
+	Region   string
+	SecretID string
+
+	// The keys used to sign the request.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// The names of the username and password fields.
+	Fields [2]string
+
+	// The endpoint of the service. If empty, the regional endpoint is used.
+	Endpoint string
+
+	// The client used to send requests.
+	Client *http.Client
+}
+
+// Credentials implements the CredentialProvider interface.
+func (p *AWSCredentials) Credentials() (Credentials, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + p.Region + ".amazonaws.com"
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"SecretId": p.SecretID,
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if p.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+
+	signAWS(req, body, p.Region, "secretsmanager", p.AccessKey, p.SecretKey, time.Now())
+
+	data, err := readSecret(p.Client, req, "aws")
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	// get secret string
+	var res struct {
+		SecretString string `json:"SecretString"`
+	}
+
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return secretCredentials([]byte(res.SecretString), p.Fields)
+}
+
+// readSecret sends the request and returns the body of a successful response
+func readSecret(client *http.Client, req *http.Request, name string) ([]byte, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	// check status
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("%s request failed: %s: %s", name, res.Status, bytes.TrimSpace(body))
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// secretCredentials takes the credentials from the fields of a JSON object
+func secretCredentials(data []byte, fields [2]string) (Credentials, error) {
+	var secret map[string]interface{}
+	err := json.Unmarshal(data, &secret)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	username, ok := secret[fields[0]].(string)
+	if !ok {
+		return Credentials{}, fmt.Errorf("%s: field %q not found", ErrMissingCredentials, fields[0])
+	}
+
+	password, _ := secret[fields[1]].(string)
+
+	return Credentials{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// signAWS adds a signature version 4 authorization header to the request
+// that signs the host and all other headers
+func signAWS(req *http.Request, body []byte, region, service, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+
+	// canonicalize headers
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	// hash request
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	request := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(request))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + req.Header.Get("X-Amz-Date") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	// derive key and sign
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,151 @@
+package bench
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenCredentials(t *testing.T) {
+	provider, err := OpenCredentials("env://?username=USER&password=PASS")
+	assert.NoError(t, err)
+	assert.Equal(t, &EnvCredentials{Username: "USER", Password: "PASS"}, provider)
+
+	provider, err = OpenCredentials("file:///etc/mqtt.json?username=user")
+	assert.NoError(t, err)
+	assert.Equal(t, &FileCredentials{Path: "/etc/mqtt.json", Fields: [2]string{"user", "password"}}, provider)
+
+	provider, err = OpenCredentials("vaults://vault:8200/secret/data/mqtt")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://vault:8200", provider.(*VaultCredentials).Address)
+	assert.Equal(t, "secret/data/mqtt", provider.(*VaultCredentials).Path)
+
+	provider, err = OpenCredentials("aws://eu-west-1/mqtt/bench")
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", provider.(*AWSCredentials).Region)
+	assert.Equal(t, "mqtt/bench", provider.(*AWSCredentials).SecretID)
+
+	_, err = OpenCredentials("foo://bar")
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
+
+func TestEnvCredentials(t *testing.T) {
+	os.Setenv("BENCH_TEST_USER", "user")
+	os.Setenv("BENCH_TEST_PASS", "secret")
+	defer os.Unsetenv("BENCH_TEST_USER")
+	defer os.Unsetenv("BENCH_TEST_PASS")
+
+	credentials, err := (&EnvCredentials{Username: "BENCH_TEST_USER", Password: "BENCH_TEST_PASS"}).Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "secret"}, credentials)
+
+	_, err = (&EnvCredentials{Username: "BENCH_TEST_MISSING"}).Credentials()
+	assert.Error(t, err)
+}
+
+func TestFileCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials.json")
+	err = ioutil.WriteFile(path, []byte(`{"user": "user", "password": "secret"}`), 0600)
+	assert.NoError(t, err)
+
+	credentials, err := (&FileCredentials{Path: path, Fields: [2]string{"user", "password"}}).Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "secret"}, credentials)
+
+	_, err = (&FileCredentials{Path: path, Fields: [2]string{"username", "password"}}).Credentials()
+	assert.Error(t, err)
+}
+
+func TestVaultCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/mqtt":
+			w.Write([]byte(`{"data": {"data": {"username": "user", "password": "secret"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/mqtt":
+			w.Write([]byte(`{"data": {"username": "user", "password": "secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := &VaultCredentials{
+		Address: server.URL,
+		Path:    "secret/data/mqtt",
+		Token:   "token",
+		Fields:  [2]string{"username", "password"},
+		Client:  server.Client(),
+	}
+
+	credentials, err := provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "secret"}, credentials)
+
+	provider.Path = "kv/mqtt"
+	credentials, err = provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "secret"}, credentials)
+
+	provider.Token = "invalid"
+	_, err = provider.Credentials()
+	assert.Error(t, err)
+}
+
+func TestAWSCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"SecretId":"mqtt/bench"}`, string(body))
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request")
+
+		w.Write([]byte(`{"Name": "mqtt/bench", "SecretString": "{\"username\": \"user\", \"password\": \"secret\"}"}`))
+	}))
+	defer server.Close()
+
+	provider := &AWSCredentials{
+		Region:       "eu-west-1",
+		SecretID:     "mqtt/bench",
+		AccessKey:    "key",
+		SecretKey:    "secret",
+		SessionToken: "session",
+		Fields:       [2]string{"username", "password"},
+		Endpoint:     server.URL,
+		Client:       server.Client(),
+	}
+
+	credentials, err := provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{Username: "user", Password: "secret"}, credentials)
+}
+
+func TestSignAWS(t *testing.T) {
+	// get-vanilla of the signature version 4 test suite
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	assert.NoError(t, err)
+
+	signAWS(req, nil, "us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
@@ -0,0 +1,184 @@
+package bench
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ExpiryStats classifies the published messages of an Expiry.
+type ExpiryStats struct {
+	// The number of delivered messages and the number of them that have been
+	// delivered although they were older than the TTL.
+	Delivered int
+	Overdue   int
+
+	// The number of undelivered messages that exceeded the TTL before they
+	// could be delivered and are therefore intended drops.
+	Expired int
+
+	// The number of undelivered messages that were deliverable within the TTL
+	// and have been lost.
+	Lost int
+
+	// The number of undelivered messages that are younger than the TTL while
+	// the subscriber has not come back online yet. They may still be
+	// delivered or expire.
+	Pending int
+}
+
+// Metrics returns the counters using the specified prefix for the names,
+// e.g. "ttl.expired".
+func (s ExpiryStats) Metrics(prefix string) Metrics {
+	return Metrics{
+		prefix + "delivered": float64(s.Delivered),
+		prefix + "overdue":   float64(s.Overdue),
+		prefix + "expired":   float64(s.Expired),
+		prefix + "lost":      float64(s.Lost),
+		prefix + "pending":   float64(s.Pending),
+	}
+}
+
+// An Expiry correlates published and delivered messages with the message TTL
+// configured on the broker. Undelivered messages are classified as expired if
+// more than the TTL passed between their publish and the time the subscriber
+// was able to receive them, as pending if the subscriber is still offline and
+// the TTL has not passed yet, and as lost otherwise. It is safe for concurrent
+// use.
+type Expiry struct {
+	// The TTL configured on the broker.
+	TTL time.Duration
+
+	// The tolerance applied to the TTL to account for brokers that expire
+	// messages periodically.
+	Tolerance time.Duration
+
+	published map[uint64]time.Time
+	delivered map[uint64]bool
+	online    []time.Time
+	offline   []time.Time
+	stats     ExpiryStats
+	mutex     sync.Mutex
+}
+
+// NewExpiry returns a new Expiry for the specified TTL and tolerance. The
+// subscriber is initially considered to be online.
+func NewExpiry(ttl, tolerance time.Duration) *Expiry {
+	return &Expiry{
+		TTL:       ttl,
+		Tolerance: tolerance,
+		published: make(map[uint64]time.Time),
+		delivered: make(map[uint64]bool),
+		online:    []time.Time{{}},
+	}
+}
+
+// Offline records that the subscriber disconnected at the specified time.
+func (e *Expiry) Offline(t time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.offline = append(e.offline, t)
+}
+
+// Online records that the subscriber (re)connected at the specified time.
+func (e *Expiry) Online(t time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.online = append(e.online, t)
+}
+
+// Published records the publish of the message with the specified sequence.
+func (e *Expiry) Published(seq uint64, t time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.published[seq] = t
+}
+
+// Delivered records the delivery of the message with the specified sequence.
+// Duplicate deliveries and unknown messages are ignored.
+func (e *Expiry) Delivered(seq uint64, t time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	published, ok := e.published[seq]
+	if !ok || e.delivered[seq] {
+		return
+	}
+
+	e.delivered[seq] = true
+	e.stats.Delivered++
+
+	if t.Sub(published) > e.TTL+e.Tolerance {
+		e.stats.Overdue++
+	}
+}
+
+// Stats classifies the undelivered messages at the specified time and
+// returns the counters.
+func (e *Expiry) Stats(now time.Time) ExpiryStats {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	online := append([]time.Time(nil), e.online...)
+	offline := append([]time.Time(nil), e.offline...)
+	sort.Slice(online, func(i, j int) bool { return online[i].Before(online[j]) })
+	sort.Slice(offline, func(i, j int) bool { return offline[i].Before(offline[j]) })
+
+	stats := e.stats
+	for seq, published := range e.published {
+		if e.delivered[seq] {
+			continue
+		}
+
+		// a message expires if it was not deliverable before the TTL and is
+		// pending while it may still be delivered
+		deliverable, ok := deliverableAt(published, online, offline)
+		if !ok {
+			deliverable = now
+		}
+
+		if deliverable.Sub(published) >= e.TTL-e.Tolerance {
+			stats.Expired++
+		} else if !ok {
+			stats.Pending++
+		} else {
+			stats.Lost++
+		}
+	}
+
+	return stats
+}
+
+// returns the first time at or after the publish when the subscriber was
+// online, or false if it did not come online again
+func deliverableAt(published time.Time, online, offline []time.Time) (time.Time, bool) {
+	// get last transitions before the publish
+	var lastOnline, lastOffline time.Time
+	for _, t := range online {
+		if !t.After(published) {
+			lastOnline = t
+		}
+	}
+	for _, t := range offline {
+		if !t.After(published) {
+			lastOffline = t
+		}
+	}
+
+	// check if online during the publish
+	if !lastOnline.Before(lastOffline) {
+		return published, true
+	}
+
+	// find next connect
+	for _, t := range online {
+		if t.After(published) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,54 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiry(t *testing.T) {
+	base := time.Now()
+	at := func(s int) time.Time {
+		return base.Add(time.Duration(s) * time.Second)
+	}
+
+	e := NewExpiry(10*time.Second, time.Second)
+
+	// online: delivered, overdue and lost
+	e.Published(1, at(0))
+	e.Published(2, at(0))
+	e.Published(3, at(1))
+	e.Delivered(1, at(1))
+	e.Delivered(1, at(2))
+	e.Delivered(2, at(12))
+	e.Delivered(99, at(2))
+
+	// offline for 20s: the first message expires, the second is lost
+	e.Offline(at(5))
+	e.Published(4, at(6))
+	e.Published(5, at(20))
+	e.Online(at(25))
+
+	// offline until the end: the first message expires, the second is
+	// pending as it is younger than the TTL
+	e.Offline(at(30))
+	e.Published(6, at(31))
+	e.Published(7, at(50))
+
+	assert.Equal(t, ExpiryStats{
+		Delivered: 2,
+		Overdue:   1,
+		Expired:   2,
+		Lost:      2,
+		Pending:   1,
+	}, e.Stats(at(55)))
+
+	assert.Equal(t, Metrics{
+		"ttl.delivered": 2,
+		"ttl.overdue":   1,
+		"ttl.expired":   2,
+		"ttl.lost":      2,
+		"ttl.pending":   1,
+	}, e.Stats(at(55)).Metrics("ttl."))
+}
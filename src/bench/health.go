@@ -0,0 +1,143 @@
+package bench
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A Phase is the stage of a benchmark run.
+type Phase string
+
+// The available phases.
+const (
+	PhaseWarming  Phase = "warming"
+	PhaseRunning  Phase = "running"
+	PhaseDraining Phase = "draining"
+	PhaseDone     Phase = "done"
+)
+
+// A Status is the state of a run as reported by Health.
+type Status struct {
+	Phase  Phase              `json:"phase"`
+	Ready  bool               `json:"ready"`
+	Uptime float64            `json:"uptime"`
+	Rates  map[string]float64 `json:"rates"`
+	Errors map[string]int64   `json:"errors"`
+}
+
+// A Health tracks the phase, the current rates and the error counts of a run
+// and serves them over HTTP, so that orchestration systems can supervise long
+// runs. It is safe for concurrent use.
+type Health struct {
+	start  time.Time
+	phase  Phase
+	rates  map[string]float64
+	errors map[string]int64
+	mutex  sync.Mutex
+}
+
+// NewHealth returns a new Health for a run that started at the specified
+// time and is warming up.
+func NewHealth(start time.Time) *Health {
+	return &Health{
+		start:  start,
+		phase:  PhaseWarming,
+		rates:  map[string]float64{},
+		errors: map[string]int64{},
+	}
+}
+
+// SetPhase will change the phase of the run.
+func (h *Health) SetPhase(phase Phase) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.phase = phase
+}
+
+// Phase returns the current phase of the run.
+func (h *Health) Phase() Phase {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.phase
+}
+
+// SetRate will record the current value of the named rate.
+func (h *Health) SetRate(name string, value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.rates[name] = value
+}
+
+// AddError will add to the count of the named error.
+func (h *Health) AddError(name string, n int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.errors[name] += n
+}
+
+// Status returns a copy of the current state.
+func (h *Health) Status() Status {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	status := Status{
+		Phase:  h.phase,
+		Ready:  h.phase == PhaseRunning,
+		Uptime: time.Since(h.start).Seconds(),
+		Rates:  make(map[string]float64, len(h.rates)),
+		Errors: make(map[string]int64, len(h.errors)),
+	}
+
+	for name, value := range h.rates {
+		status.Rates[name] = value
+	}
+
+	for name, n := range h.errors {
+		status.Errors[name] = n
+	}
+
+	return status
+}
+
+// ServeHTTP serves the liveness probe on "/healthz", which succeeds as long
+// as the process responds, the readiness probe on "/readyz", which succeeds
+// only while the run is in the running phase, and the status as JSON on
+// "/status".
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := h.Status()
+
+	switch r.URL.Path {
+	case "/healthz":
+		w.Write([]byte("ok\n"))
+	case "/readyz":
+		if !status.Ready {
+			http.Error(w, string(status.Phase), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(status.Phase + "\n"))
+	case "/status":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Register will add the endpoints to the mux.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.Handle("/healthz", h)
+	mux.Handle("/readyz", h)
+	mux.Handle("/status", h)
+}
@@ -0,0 +1,70 @@
+package bench
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthStatus(t *testing.T) {
+	health := NewHealth(time.Now())
+	assert.Equal(t, PhaseWarming, health.Phase())
+
+	health.SetRate("sent", 100)
+	health.AddError("disconnects", 1)
+	health.AddError("disconnects", 2)
+	health.SetPhase(PhaseRunning)
+
+	status := health.Status()
+	assert.Equal(t, PhaseRunning, status.Phase)
+	assert.True(t, status.Ready)
+	assert.Equal(t, map[string]float64{"sent": 100}, status.Rates)
+	assert.Equal(t, map[string]int64{"disconnects": 3}, status.Errors)
+}
+
+func TestHealthHTTP(t *testing.T) {
+	health := NewHealth(time.Now())
+	health.SetRate("received", 50)
+
+	mux := http.NewServeMux()
+	health.Register(mux)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) *http.Response {
+		res, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := get("/healthz")
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// not ready while warming
+	res = get("/readyz")
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	health.SetPhase(PhaseRunning)
+
+	res = get("/readyz")
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = get("/status")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	var status Status
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	assert.Equal(t, PhaseRunning, status.Phase)
+	assert.Equal(t, 50.0, status.Rates["received"])
+}
@@ -0,0 +1,136 @@
+package bench
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHook is returned by ParseHook if the hook does not have the form
+// "offset:command".
+var ErrInvalidHook = errors.New("invalid hook")
+
+// A Hook is an external command that is executed at a scheduled offset from
+// the start of a run, e.g. to restart the broker under test.
+type Hook struct {
+	// The offset from the start of the run.
+	At time.Duration
+
+	// The command that is executed using "sh -c".
+	Command string
+}
+
+// ParseHook parses a hook like "30s:docker restart mqtt".
+func ParseHook(str string) (*Hook, error) {
+	i := strings.Index(str, ":")
+	if i < 0 {
+		return nil, ErrInvalidHook
+	}
+
+	at, err := time.ParseDuration(strings.TrimSpace(str[:i]))
+	if err != nil || at < 0 {
+		return nil, ErrInvalidHook
+	}
+
+	command := strings.TrimSpace(str[i+1:])
+	if command == "" {
+		return nil, ErrInvalidHook
+	}
+
+	return &Hook{
+		At:      at,
+		Command: command,
+	}, nil
+}
+
+// String returns the hook in the form accepted by ParseHook.
+func (h *Hook) String() string {
+	return h.At.String() + ":" + h.Command
+}
+
+// A HookRun is the outcome of an executed hook.
+type HookRun struct {
+	Hook *Hook
+
+	// The time the command was started and the time it exited.
+	Start time.Time
+	End   time.Time
+
+	// The combined standard output and error of the command.
+	Output []byte
+
+	// The error returned if the command could not be started or exited with a
+	// non-zero status.
+	Err error
+}
+
+// Run will execute the command and wait until it exits.
+func (h *Hook) Run() HookRun {
+	run := HookRun{
+		Hook:  h,
+		Start: time.Now(),
+	}
+
+	run.Output, run.Err = exec.Command("sh", "-c", h.Command).CombinedOutput()
+	run.End = time.Now()
+
+	return run
+}
+
+// Hooks is a list of hooks that implements flag.Value, so that it can be filled
+// using a repeated command line flag.
+type Hooks []*Hook
+
+// String returns a comma separated list of the hooks.
+func (h *Hooks) String() string {
+	list := make([]string, 0, len(*h))
+	for _, hook := range *h {
+		list = append(list, hook.String())
+	}
+
+	return strings.Join(list, ",")
+}
+
+// Set parses and adds a hook.
+func (h *Hooks) Set(str string) error {
+	hook, err := ParseHook(str)
+	if err != nil {
+		return err
+	}
+
+	*h = append(*h, hook)
+
+	return nil
+}
+
+// Schedule will run every hook at its offset from the specified start and
+// call fn with the outcome. The returned function cancels all hooks that have
+// not been started yet and waits for running hooks to exit.
+func (h Hooks) Schedule(start time.Time, fn func(HookRun)) func() {
+	var wg sync.WaitGroup
+	var timers []*time.Timer
+
+	for _, hook := range h {
+		hook := hook
+
+		wg.Add(1)
+		timer := time.AfterFunc(time.Until(start.Add(hook.At)), func() {
+			defer wg.Done()
+			fn(hook.Run())
+		})
+
+		timers = append(timers, timer)
+	}
+
+	return func() {
+		for _, timer := range timers {
+			if timer.Stop() {
+				wg.Done()
+			}
+		}
+
+		wg.Wait()
+	}
+}
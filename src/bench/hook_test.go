@@ -0,0 +1,71 @@
+package bench
+
+import (
+	"flag"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHook(t *testing.T) {
+	hook, err := ParseHook("30s:docker restart mqtt")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, hook.At)
+	assert.Equal(t, "docker restart mqtt", hook.Command)
+	assert.Equal(t, "30s:docker restart mqtt", hook.String())
+}
+
+func TestParseHookError(t *testing.T) {
+	for _, str := range []string{"docker restart", "foo:bar", "-1s:bar", "1s:", "1s: "} {
+		_, err := ParseHook(str)
+		assert.Equal(t, ErrInvalidHook, err, str)
+	}
+}
+
+func TestHookRun(t *testing.T) {
+	hook, _ := ParseHook("0s:echo hello")
+
+	run := hook.Run()
+	assert.NoError(t, run.Err)
+	assert.Equal(t, "hello\n", string(run.Output))
+	assert.False(t, run.End.Before(run.Start))
+
+	hook, _ = ParseHook("0s:exit 3")
+	assert.Error(t, hook.Run().Err)
+}
+
+func TestHooksFlag(t *testing.T) {
+	var hooks Hooks
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.Var(&hooks, "hook", "")
+
+	err := set.Parse([]string{"-hook", "1s:echo a", "-hook", "2s:echo b"})
+	assert.NoError(t, err)
+	assert.Len(t, hooks, 2)
+	assert.Equal(t, "1s:echo a,2s:echo b", hooks.String())
+}
+
+func TestHooksSchedule(t *testing.T) {
+	hooks := Hooks{
+		{At: 0, Command: "echo a"},
+		{At: time.Hour, Command: "echo b"},
+	}
+
+	var mutex sync.Mutex
+	var runs []HookRun
+
+	stop := hooks.Schedule(time.Now(), func(run HookRun) {
+		mutex.Lock()
+		runs = append(runs, run)
+		mutex.Unlock()
+	})
+
+	time.Sleep(200 * time.Millisecond)
+	stop()
+
+	assert.Len(t, runs, 1)
+	assert.Equal(t, "a\n", string(runs[0].Output))
+}
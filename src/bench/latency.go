@@ -0,0 +1,84 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latencies records durations and computes their percentiles. It is safe for
+// concurrent use.
+type Latencies struct {
+	samples []float64
+	sorted  bool
+	mutex   sync.Mutex
+}
+
+// Add will record a duration.
+func (l *Latencies) Add(d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.samples = append(l.samples, d.Seconds())
+	l.sorted = false
+}
+
+// Merge will record all durations recorded by the other Latencies. It allows
+// every goroutine to record into its own Latencies without contention.
+func (l *Latencies) Merge(other *Latencies) {
+	other.mutex.Lock()
+	samples := append([]float64(nil), other.samples...)
+	other.mutex.Unlock()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.samples = append(l.samples, samples...)
+	l.sorted = false
+}
+
+// Len returns the number of recorded durations.
+func (l *Latencies) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return len(l.samples)
+}
+
+// Percentile returns the nearest-rank percentile (0-100) of the recorded
+// durations in seconds. It returns zero if no durations have been recorded.
+func (l *Latencies) Percentile(p float64) float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.samples) == 0 {
+		return 0
+	}
+
+	// sort lazily
+	if !l.sorted {
+		sort.Float64s(l.samples)
+		l.sorted = true
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(l.samples))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(l.samples) {
+		rank = len(l.samples)
+	}
+
+	return l.samples[rank-1]
+}
+
+// Metrics returns the p50, p90, p99 and max percentiles using the specified
+// prefix for the names, e.g. "latency.p99".
+func (l *Latencies) Metrics(prefix string) Metrics {
+	return Metrics{
+		prefix + "p50": l.Percentile(50),
+		prefix + "p90": l.Percentile(90),
+		prefix + "p99": l.Percentile(99),
+		prefix + "max": l.Percentile(100),
+	}
+}
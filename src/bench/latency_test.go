@@ -0,0 +1,49 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencies(t *testing.T) {
+	var latencies Latencies
+	assert.Equal(t, 0.0, latencies.Percentile(50))
+
+	for i := 100; i >= 1; i-- {
+		latencies.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, 100, latencies.Len())
+	assert.Equal(t, 0.001, latencies.Percentile(0))
+	assert.Equal(t, 0.05, latencies.Percentile(50))
+	assert.Equal(t, 0.099, latencies.Percentile(99))
+
+	assert.Equal(t, Metrics{
+		"latency.p50": 0.05,
+		"latency.p90": 0.09,
+		"latency.p99": 0.099,
+		"latency.max": 0.1,
+	}, latencies.Metrics("latency."))
+}
+
+func TestLatenciesMerge(t *testing.T) {
+	var a, b, all Latencies
+
+	for i := 1; i <= 100; i++ {
+		if i%2 == 0 {
+			a.Add(time.Duration(i) * time.Millisecond)
+		} else {
+			b.Add(time.Duration(i) * time.Millisecond)
+		}
+	}
+
+	all.Merge(&a)
+	all.Merge(&b)
+
+	assert.Equal(t, 100, all.Len())
+	assert.Equal(t, 0.05, all.Percentile(50))
+	assert.Equal(t, 0.1, all.Percentile(100))
+	assert.Equal(t, 50, a.Len())
+}
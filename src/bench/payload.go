@@ -0,0 +1,62 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// HeaderSize is the size of the header at the start of generated payloads.
+const HeaderSize = 16
+
+// ErrShortPayload is returned by ParseHeader if the payload is smaller than
+// the header.
+var ErrShortPayload = errors.New("short payload")
+
+// A Header is embedded at the start of generated payloads. It carries the
+// sequence number of the message and the time it was published, which allows
+// subscribers to detect gaps and measure the end to end latency.
+type Header struct {
+	Seq  uint64
+	Time time.Time
+}
+
+// NewPayload returns a payload of the specified size with room for a header.
+// Payloads smaller than the header are grown to HeaderSize.
+func NewPayload(size int) []byte {
+	if size < HeaderSize {
+		size = HeaderSize
+	}
+
+	payload := make([]byte, size)
+	for i := HeaderSize; i < size; i++ {
+		payload[i] = 'f'
+	}
+
+	return payload
+}
+
+// PutHeader will write the header to the start of the payload. The payload
+// must be at least HeaderSize bytes long.
+func PutHeader(payload []byte, h Header) {
+	binary.BigEndian.PutUint64(payload, h.Seq)
+	binary.BigEndian.PutUint64(payload[8:], uint64(h.Time.UnixNano()))
+}
+
+// ParseHeader reads the header from the start of the payload.
+func ParseHeader(payload []byte) (Header, error) {
+	if len(payload) < HeaderSize {
+		return Header{}, ErrShortPayload
+	}
+
+	return Header{
+		Seq:  binary.BigEndian.Uint64(payload),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(payload[8:]))),
+	}, nil
+}
+
+// Latency returns the time elapsed between the publish time of the header and
+// the specified receive time.
+func (h Header) Latency(now time.Time) time.Duration {
+	return now.Sub(h.Time)
+}
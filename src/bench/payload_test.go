@@ -0,0 +1,31 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadHeader(t *testing.T) {
+	payload := NewPayload(64)
+	assert.Len(t, payload, 64)
+	assert.Equal(t, byte('f'), payload[HeaderSize])
+
+	now := time.Unix(0, 1234567890)
+	PutHeader(payload, Header{Seq: 42, Time: now})
+
+	header, err := ParseHeader(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), header.Seq)
+	assert.True(t, now.Equal(header.Time))
+	assert.Equal(t, 5*time.Millisecond, header.Latency(now.Add(5*time.Millisecond)))
+}
+
+func TestPayloadSmall(t *testing.T) {
+	payload := NewPayload(4)
+	assert.Len(t, payload, HeaderSize)
+
+	_, err := ParseHeader(payload[:8])
+	assert.Equal(t, ErrShortPayload, err)
+}
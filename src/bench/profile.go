@@ -0,0 +1,182 @@
+package bench
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidProfile is returned by ParseProfileKinds for unknown profiles.
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// The profiles that can be captured.
+var profileKinds = []string{"cpu", "heap", "allocs", "mutex", "block", "goroutine"}
+
+// ParseProfileKinds parses a comma separated list of profiles like
+// "cpu,heap,mutex".
+func ParseProfileKinds(spec string) ([]string, error) {
+	var kinds []string
+	for _, kind := range strings.Split(spec, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+
+		valid := false
+		for _, known := range profileKinds {
+			if kind == known {
+				valid = true
+			}
+		}
+
+		if !valid {
+			return nil, ErrInvalidProfile
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	return kinds, nil
+}
+
+// A Profiler captures pprof profiles of the benchmark process during a window
+// of a run, e.g. to investigate why the generator cannot reach the requested
+// rate. The CPU profile covers the window and the mutex and block profiles
+// the contention observed during the window. The other profiles are
+// snapshots taken at the end of the window.
+type Profiler struct {
+	// The profiles to capture.
+	Kinds []string
+
+	// The offset of the window from the start of the run and its length.
+	At       time.Duration
+	Duration time.Duration
+
+	// The directory the profiles are written to.
+	Dir string
+}
+
+// Schedule will capture the profiles during the window relative to the
+// specified start. The returned function ends a running window early, skips
+// a window that has not yet begun and returns the paths of the written
+// profiles. Nothing is captured if no profiles are selected.
+func (p *Profiler) Schedule(start time.Time) func() ([]string, error) {
+	// check kinds
+	if len(p.Kinds) == 0 {
+		return func() ([]string, error) {
+			return nil, nil
+		}
+	}
+
+	type outcome struct {
+		files []string
+		err   error
+	}
+
+	stop := make(chan struct{})
+	done := make(chan outcome, 1)
+
+	go func() {
+		select {
+		case <-time.After(time.Until(start.Add(p.At))):
+		case <-stop:
+			done <- outcome{}
+			return
+		}
+
+		files, err := p.capture(stop)
+		done <- outcome{files, err}
+	}()
+
+	var once sync.Once
+	return func() ([]string, error) {
+		once.Do(func() {
+			close(stop)
+		})
+
+		o := <-done
+		done <- o
+
+		return o.files, o.err
+	}
+}
+
+// capture records the profiles until the window ends or stop is closed
+func (p *Profiler) capture(stop chan struct{}) ([]string, error) {
+	err := os.MkdirAll(p.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	// begin window
+	var files []string
+	for _, kind := range p.Kinds {
+		switch kind {
+		case "cpu":
+			path := filepath.Join(p.Dir, "cpu.pprof")
+			file, err := os.Create(path)
+			if err != nil {
+				return nil, err
+			}
+
+			err = pprof.StartCPUProfile(file)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+
+			defer file.Close()
+			files = append(files, path)
+		case "mutex":
+			runtime.SetMutexProfileFraction(1)
+			defer runtime.SetMutexProfileFraction(0)
+		case "block":
+			runtime.SetBlockProfileRate(1)
+			defer runtime.SetBlockProfileRate(0)
+		}
+	}
+
+	select {
+	case <-time.After(p.Duration):
+	case <-stop:
+	}
+
+	// end window
+	for _, kind := range p.Kinds {
+		if kind == "cpu" {
+			pprof.StopCPUProfile()
+			continue
+		}
+
+		path := filepath.Join(p.Dir, kind+".pprof")
+		err := writeProfile(kind, path)
+		if err != nil {
+			return files, err
+		}
+
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// writeProfile writes the named runtime profile to the path
+func writeProfile(kind, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if kind == "heap" {
+		runtime.GC()
+	}
+
+	return pprof.Lookup(kind).WriteTo(file, 0)
+}
@@ -0,0 +1,67 @@
+package bench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProfileKinds(t *testing.T) {
+	kinds, err := ParseProfileKinds("cpu, heap,mutex")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu", "heap", "mutex"}, kinds)
+
+	_, err = ParseProfileKinds("cpu,foo")
+	assert.Equal(t, ErrInvalidProfile, err)
+}
+
+func TestProfiler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	profiler := &Profiler{
+		Kinds:    []string{"cpu", "heap", "mutex"},
+		Duration: 50 * time.Millisecond,
+		Dir:      filepath.Join(dir, "profiles"),
+	}
+
+	stop := profiler.Schedule(time.Now())
+	time.Sleep(100 * time.Millisecond)
+
+	files, err := stop()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "profiles", "cpu.pprof"),
+		filepath.Join(dir, "profiles", "heap.pprof"),
+		filepath.Join(dir, "profiles", "mutex.pprof"),
+	}, files)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.True(t, info.Size() > 0, file)
+	}
+
+	// calling stop again returns the same outcome
+	again, err := stop()
+	assert.NoError(t, err)
+	assert.Equal(t, files, again)
+}
+
+func TestProfilerSkipped(t *testing.T) {
+	profiler := &Profiler{
+		Kinds:    []string{"cpu"},
+		At:       time.Hour,
+		Duration: time.Minute,
+		Dir:      "unused",
+	}
+
+	files, err := profiler.Schedule(time.Now())()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
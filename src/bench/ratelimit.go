@@ -0,0 +1,76 @@
+package bench
+
+import (
+	"sync/atomic"
+	"time"
+
+	"clock"
+	"github.com/juju/ratelimit"
+)
+
+// A RateLimiter paces operations using a token bucket and records the time
+// spent waiting for tokens. A single limiter may be shared by many clients to
+// limit their aggregate rate. It is safe for concurrent use.
+type RateLimiter struct {
+	bucket    *ratelimit.Bucket
+	clock     clock.Clock
+	throttled int64
+	waits     int64
+}
+
+// NewRateLimiter returns a new RateLimiter that allows the specified number of
+// operations per second with a burst of one second.
+func NewRateLimiter(rate float64) *RateLimiter {
+	return newRateLimiter(rate, clock.Real)
+}
+
+// newRateLimiter returns a new RateLimiter that uses the specified clock
+func newRateLimiter(rate float64, c clock.Clock) *RateLimiter {
+	capacity := int64(rate)
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &RateLimiter{
+		bucket: ratelimit.NewBucketWithRateAndClock(rate, capacity, bucketClock{c}),
+		clock:  c,
+	}
+}
+
+// Wait will block until the next operation is allowed and return the time
+// spent waiting.
+func (l *RateLimiter) Wait() time.Duration {
+	d := l.Reserve()
+	if d > 0 {
+		<-l.clock.NewTimer(d).C()
+	}
+
+	return d
+}
+
+// Reserve will take the next operation without blocking and return the time
+// until it is allowed, which is recorded like a wait.
+func (l *RateLimiter) Reserve() time.Duration {
+	d := l.bucket.Take(1)
+	if d > 0 {
+		atomic.AddInt64(&l.throttled, int64(d))
+		atomic.AddInt64(&l.waits, 1)
+	}
+
+	return d
+}
+
+// Throttled returns the total time spent waiting and the number of operations
+// that had to wait.
+func (l *RateLimiter) Throttled() (time.Duration, int64) {
+	return time.Duration(atomic.LoadInt64(&l.throttled)), atomic.LoadInt64(&l.waits)
+}
+
+// bucketClock adapts a clock to the token bucket
+type bucketClock struct {
+	clock.Clock
+}
+
+func (c bucketClock) Sleep(d time.Duration) {
+	<-c.NewTimer(d).C()
+}
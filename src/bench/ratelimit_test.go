@@ -0,0 +1,71 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+	limiter := newRateLimiter(100, mock)
+
+	// the burst is not throttled
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, time.Duration(0), limiter.Wait())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, 10*time.Millisecond, limiter.Wait())
+		}
+
+		close(done)
+	}()
+
+	for i := 0; i < 5; i++ {
+		mock.BlockUntil(1)
+		mock.Advance(10 * time.Millisecond)
+	}
+
+	<-done
+
+	throttled, waits := limiter.Throttled()
+	assert.Equal(t, 50*time.Millisecond, throttled)
+	assert.Equal(t, int64(5), waits)
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+	limiter := newRateLimiter(0.5, mock)
+
+	go limiter.Wait()
+	go limiter.Wait()
+
+	// one client got the single token and the other is waiting
+	mock.BlockUntil(1)
+
+	throttled, waits := limiter.Throttled()
+	assert.Equal(t, 2*time.Second, throttled)
+	assert.Equal(t, int64(1), waits)
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+	limiter := newRateLimiter(100, mock)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, time.Duration(0), limiter.Reserve())
+	}
+
+	// reservations queue up without blocking
+	assert.Equal(t, 10*time.Millisecond, limiter.Reserve())
+	assert.Equal(t, 20*time.Millisecond, limiter.Reserve())
+
+	throttled, waits := limiter.Throttled()
+	assert.Equal(t, 30*time.Millisecond, throttled)
+	assert.Equal(t, int64(2), waits)
+}
@@ -0,0 +1,100 @@
+package bench
+
+import (
+	"sync"
+	"time"
+)
+
+// Recovery measures how clients recover from a broker outage, e.g. one
+// triggered by a Hook. It counts disconnects and reconnects, the peak rate of
+// reconnects and the longest period without received messages. It is safe for
+// concurrent use.
+type Recovery struct {
+	disconnects int
+	reconnects  int
+
+	firstDisconnect time.Time
+	lastReconnect   time.Time
+
+	// reconnects per second since the first disconnect
+	buckets map[int64]int
+
+	lastReceived time.Time
+	lossWindow   time.Duration
+
+	mutex sync.Mutex
+}
+
+// NewRecovery returns a new Recovery that measures receive gaps from the
+// specified start.
+func NewRecovery(start time.Time) *Recovery {
+	return &Recovery{
+		buckets:      make(map[int64]int),
+		lastReceived: start,
+	}
+}
+
+// Disconnected will record a lost connection.
+func (r *Recovery) Disconnected() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.disconnects == 0 {
+		r.firstDisconnect = time.Now()
+	}
+
+	r.disconnects++
+}
+
+// Reconnected will record a reestablished connection.
+func (r *Recovery) Reconnected() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.reconnects++
+	r.lastReconnect = now
+	r.buckets[now.Unix()]++
+}
+
+// Received will record a received message.
+func (r *Recovery) Received() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if gap := now.Sub(r.lastReceived); gap > r.lossWindow {
+		r.lossWindow = gap
+	}
+
+	r.lastReceived = now
+}
+
+// Metrics returns the "disconnects", "reconnects", "reconnect_storm" (the peak
+// number of reconnects in one second), "reconnect_duration" (from the first
+// disconnect to the last reconnect in seconds) and "loss_window" (the longest
+// period without received messages in seconds) metrics.
+func (r *Recovery) Metrics() Metrics {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	storm := 0
+	for _, n := range r.buckets {
+		if n > storm {
+			storm = n
+		}
+	}
+
+	duration := 0.0
+	if r.disconnects > 0 && r.lastReconnect.After(r.firstDisconnect) {
+		duration = r.lastReconnect.Sub(r.firstDisconnect).Seconds()
+	}
+
+	return Metrics{
+		"disconnects":        float64(r.disconnects),
+		"reconnects":         float64(r.reconnects),
+		"reconnect_storm":    float64(storm),
+		"reconnect_duration": duration,
+		"loss_window":        r.lossWindow.Seconds(),
+	}
+}
@@ -0,0 +1,39 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecovery(t *testing.T) {
+	recovery := NewRecovery(time.Now())
+
+	recovery.Received()
+	recovery.Disconnected()
+	recovery.Disconnected()
+
+	time.Sleep(50 * time.Millisecond)
+
+	recovery.Reconnected()
+	recovery.Reconnected()
+	recovery.Received()
+
+	metrics := recovery.Metrics()
+	assert.Equal(t, 2.0, metrics["disconnects"])
+	assert.Equal(t, 2.0, metrics["reconnects"])
+	assert.True(t, metrics["reconnect_storm"] >= 1)
+	assert.True(t, metrics["reconnect_duration"] >= 0.05)
+	assert.True(t, metrics["loss_window"] >= 0.05)
+}
+
+func TestRecoveryNoOutage(t *testing.T) {
+	recovery := NewRecovery(time.Now())
+	recovery.Received()
+
+	metrics := recovery.Metrics()
+	assert.Equal(t, 0.0, metrics["disconnects"])
+	assert.Equal(t, 0.0, metrics["reconnect_storm"])
+	assert.Equal(t, 0.0, metrics["reconnect_duration"])
+}
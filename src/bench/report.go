@@ -0,0 +1,562 @@
+package bench
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var latencyRegexp = regexp.MustCompile(`^(.*\.)?(p[0-9]+|max)$`)
+
+var errorRegexp = regexp.MustCompile(`(^|\.)(errors|failures|failed|rejected|timeouts|duplicates|lost)(\.|$)`)
+
+// the colors of the results in the charts
+var reportColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#9c755f"}
+
+// the dimensions of the charts in pixels
+const (
+	chartWidth   = 760.0
+	chartHeight  = 280.0
+	chartMargin  = 20.0
+	chartAxis    = 64.0
+	chartLabels  = 220.0
+	chartBar     = 14.0
+	chartRowSkip = 10.0
+)
+
+type reportTick struct {
+	Pos   float64
+	Label string
+}
+
+type reportLine struct {
+	Color  string
+	Points string
+}
+
+type reportBar struct {
+	X, Y, Width, Height float64
+	Color               string
+	Title               string
+}
+
+type reportChart struct {
+	Title string
+	Unit  string
+	Note  string
+
+	Width, Height            float64
+	Left, Right, Top, Bottom float64
+
+	XTicks []reportTick
+	YTicks []reportTick
+	Rows   []reportTick
+	Lines  []reportLine
+	Bars   []reportBar
+}
+
+type reportEntry struct {
+	Label  string
+	Color  string
+	Result *Result
+}
+
+type reportRow struct {
+	Name   string
+	Values []string
+	Differ bool
+}
+
+type reportData struct {
+	Title   string
+	Created string
+	Entries []reportEntry
+	Charts  []reportChart
+	Metrics []reportRow
+	Config  []reportRow
+}
+
+// WriteReport will write a self-contained HTML report of the results that
+// can be opened in any browser and shared without further tooling. It charts
+// the throughput over time, the latency percentiles and the error counts of
+// all results side by side and lists their metrics and configs. The labels
+// name the results in the legend, the result names are used if missing.
+func WriteReport(w io.Writer, title string, results []*Result, labels []string) error {
+	data := reportData{
+		Title:   title,
+		Created: time.Now().Format(time.RFC1123),
+	}
+
+	for i, result := range results {
+		label := result.Name
+		if i < len(labels) && labels[i] != "" {
+			label = labels[i]
+		}
+
+		data.Entries = append(data.Entries, reportEntry{
+			Label:  label,
+			Color:  reportColors[i%len(reportColors)],
+			Result: result,
+		})
+	}
+
+	data.Charts = append(data.Charts, throughputChart(results))
+	data.Charts = append(data.Charts, latencyCharts(results)...)
+	data.Charts = append(data.Charts, errorChart(results))
+
+	data.Metrics = metricRows(results)
+	data.Config = configRows(results)
+
+	return reportTemplate.Execute(w, data)
+}
+
+// throughputChart plots the throughput of every interval, or of every
+// sample if the result has no series
+func throughputChart(results []*Result) reportChart {
+	chart := newChart("Throughput over time", chartHeight, chartAxis)
+	chart.Unit = "operations per second over seconds since start"
+
+	var lines [][][2]float64
+	maxX, maxY := 0.0, 0.0
+	for _, result := range results {
+		var points [][2]float64
+		for _, interval := range result.Series {
+			if value, ok := interval.Metrics["throughput"]; ok {
+				points = append(points, [2]float64{interval.Offset, value})
+			}
+		}
+
+		if len(points) == 0 {
+			for i, value := range result.Samples["throughput"] {
+				points = append(points, [2]float64{float64(i + 1), value})
+			}
+		}
+
+		for _, point := range points {
+			maxX = math.Max(maxX, point[0])
+			maxY = math.Max(maxY, point[1])
+		}
+
+		lines = append(lines, points)
+	}
+
+	if maxX == 0 {
+		chart.Note = "No throughput series recorded."
+		return chart
+	}
+
+	xMax := chart.xTicks(maxX, formatValue)
+	yMax := chart.yTicks(maxY, formatValue)
+
+	for i, points := range lines {
+		if len(points) == 0 {
+			continue
+		}
+
+		coords := make([]string, 0, len(points))
+		for _, point := range points {
+			x := chart.Left + point[0]/xMax*(chart.Right-chart.Left)
+			y := chart.Bottom - point[1]/yMax*(chart.Bottom-chart.Top)
+			coords = append(coords, strconv.FormatFloat(x, 'f', 1, 64)+","+strconv.FormatFloat(y, 'f', 1, 64))
+		}
+
+		chart.Lines = append(chart.Lines, reportLine{
+			Color:  reportColors[i%len(reportColors)],
+			Points: strings.Join(coords, " "),
+		})
+	}
+
+	return chart
+}
+
+// latencyCharts returns a chart for every group of percentiles like
+// "latency.p50" to "latency.max" that includes the median
+func latencyCharts(results []*Result) []reportChart {
+	groups := map[string]map[string]bool{}
+	for _, result := range results {
+		for name := range result.Metrics {
+			if match := latencyRegexp.FindStringSubmatch(name); match != nil {
+				if groups[match[1]] == nil {
+					groups[match[1]] = map[string]bool{}
+				}
+
+				groups[match[1]][match[2]] = true
+			}
+		}
+	}
+
+	var prefixes []string
+	for prefix, percentiles := range groups {
+		if percentiles["p50"] {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	sort.Strings(prefixes)
+
+	var charts []reportChart
+	for _, prefix := range prefixes {
+		var percentiles []string
+		for percentile := range groups[prefix] {
+			percentiles = append(percentiles, percentile)
+		}
+
+		sort.Slice(percentiles, func(i, j int) bool {
+			return percentileRank(percentiles[i]) < percentileRank(percentiles[j])
+		})
+
+		var names []string
+		for _, percentile := range percentiles {
+			names = append(names, prefix+percentile)
+		}
+
+		title := "Latency percentiles"
+		if prefix != "latency." && prefix != "" {
+			title = "Percentiles of " + strings.TrimSuffix(prefix, ".")
+		}
+
+		chart := barChart(title, results, names, formatSeconds)
+		chart.Unit = "duration"
+		charts = append(charts, chart)
+	}
+
+	if len(charts) == 0 {
+		chart := newChart("Latency percentiles", chartHeight, chartLabels)
+		chart.Note = "No latencies recorded."
+		charts = append(charts, chart)
+	}
+
+	return charts
+}
+
+// errorChart shows the counters of errors, failures, rejections, timeouts,
+// duplicates and lost items
+func errorChart(results []*Result) reportChart {
+	seen := map[string]bool{}
+	for _, result := range results {
+		for name := range result.Metrics {
+			if errorRegexp.MatchString(name) && !latencyRegexp.MatchString(name) {
+				seen[name] = true
+			}
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		chart := newChart("Error breakdown", chartHeight, chartLabels)
+		chart.Note = "No errors recorded."
+		return chart
+	}
+
+	chart := barChart("Error breakdown", results, names, formatValue)
+	chart.Unit = "count"
+
+	return chart
+}
+
+// barChart returns a horizontal bar chart with a row per metric and a bar
+// per result
+func barChart(title string, results []*Result, names []string, format func(float64) string) reportChart {
+	rowHeight := float64(len(results))*chartBar + chartRowSkip
+	chart := newChart(title, float64(len(names))*rowHeight+chartMargin+chartAxis/2, chartLabels)
+
+	maxValue := 0.0
+	for _, result := range results {
+		for _, name := range names {
+			maxValue = math.Max(maxValue, result.Metrics[name])
+		}
+	}
+
+	xMax := chart.xTicks(maxValue, format)
+
+	for row, name := range names {
+		top := chart.Top + float64(row)*rowHeight
+		chart.Rows = append(chart.Rows, reportTick{
+			Pos:   top + rowHeight/2,
+			Label: name,
+		})
+
+		for i, result := range results {
+			value, ok := result.Metrics[name]
+			if !ok {
+				continue
+			}
+
+			chart.Bars = append(chart.Bars, reportBar{
+				X:      chart.Left,
+				Y:      top + chartRowSkip/2 + float64(i)*chartBar,
+				Width:  value / xMax * (chart.Right - chart.Left),
+				Height: chartBar - 2,
+				Color:  reportColors[i%len(reportColors)],
+				Title:  name + ": " + format(value),
+			})
+		}
+	}
+
+	return chart
+}
+
+func newChart(title string, height, left float64) reportChart {
+	return reportChart{
+		Title:  title,
+		Width:  chartWidth,
+		Height: height,
+		Left:   left,
+		Right:  chartWidth - chartMargin,
+		Top:    chartMargin,
+		Bottom: height - chartAxis/2,
+	}
+}
+
+// xTicks adds the ticks of the horizontal axis and returns its maximum
+func (c *reportChart) xTicks(max float64, format func(float64) string) float64 {
+	upper, step := niceScale(max)
+	for value := 0.0; value <= upper+step/2; value += step {
+		c.XTicks = append(c.XTicks, reportTick{
+			Pos:   c.Left + value/upper*(c.Right-c.Left),
+			Label: format(value),
+		})
+	}
+
+	return upper
+}
+
+// yTicks adds the ticks of the vertical axis and returns its maximum
+func (c *reportChart) yTicks(max float64, format func(float64) string) float64 {
+	upper, step := niceScale(max)
+	for value := 0.0; value <= upper+step/2; value += step {
+		c.YTicks = append(c.YTicks, reportTick{
+			Pos:   c.Bottom - value/upper*(c.Bottom-c.Top),
+			Label: format(value),
+		})
+	}
+
+	return upper
+}
+
+// niceScale returns an upper bound of the axis and a step of 1, 2 or 5 times
+// a power of ten that divide it into about four parts
+func niceScale(max float64) (float64, float64) {
+	if max <= 0 || math.IsNaN(max) || math.IsInf(max, 0) {
+		return 1, 0.25
+	}
+
+	raw := max / 4
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+
+	step := 10 * magnitude
+	for _, factor := range []float64{1, 2, 5} {
+		if raw <= factor*magnitude {
+			step = factor * magnitude
+			break
+		}
+	}
+
+	return math.Ceil(max/step) * step, step
+}
+
+// percentileRank orders percentiles like "p50" and "p99" with "max" last
+func percentileRank(percentile string) float64 {
+	if percentile == "max" {
+		return math.Inf(1)
+	}
+
+	// p999 is the 99.9th percentile
+	digits := strings.TrimPrefix(percentile, "p")
+	value, _ := strconv.ParseFloat(digits, 64)
+	if len(digits) > 2 {
+		value /= math.Pow(10, float64(len(digits)-2))
+	}
+
+	return value
+}
+
+// metricRows lists the metrics of all results
+func metricRows(results []*Result) []reportRow {
+	seen := map[string]bool{}
+	for _, result := range results {
+		for name := range result.Metrics {
+			seen[name] = true
+		}
+	}
+
+	var rows []reportRow
+	for name := range seen {
+		row := reportRow{Name: name}
+		for _, result := range results {
+			value, ok := result.Metrics[name]
+			if !ok {
+				row.Values = append(row.Values, "-")
+				continue
+			}
+
+			row.Values = append(row.Values, strconv.FormatFloat(value, 'g', 6, 64))
+		}
+
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name < rows[j].Name
+	})
+
+	return rows
+}
+
+// configRows lists the parameters of all results and marks those that
+// differ between them
+func configRows(results []*Result) []reportRow {
+	seen := map[string]bool{}
+	for _, result := range results {
+		for name := range result.Config {
+			seen[name] = true
+		}
+	}
+
+	var rows []reportRow
+	for name := range seen {
+		row := reportRow{Name: name}
+		for i, result := range results {
+			value, ok := result.Config[name]
+			if !ok {
+				value = "-"
+			}
+
+			row.Values = append(row.Values, value)
+			row.Differ = row.Differ || (i > 0 && value != row.Values[0])
+		}
+
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name < rows[j].Name
+	})
+
+	return rows
+}
+
+// formatValue formats a number with a metric suffix like "12.5k"
+func formatValue(value float64) string {
+	abs := math.Abs(value)
+	switch {
+	case abs >= 1e9:
+		return strconv.FormatFloat(value/1e9, 'g', 3, 64) + "G"
+	case abs >= 1e6:
+		return strconv.FormatFloat(value/1e6, 'g', 3, 64) + "M"
+	case abs >= 1e3:
+		return strconv.FormatFloat(value/1e3, 'g', 3, 64) + "k"
+	default:
+		return strconv.FormatFloat(value, 'g', 3, 64)
+	}
+}
+
+// formatSeconds formats a duration in seconds like "1.25ms"
+func formatSeconds(value float64) string {
+	switch {
+	case value == 0:
+		return "0"
+	case value >= 1:
+		return fmt.Sprintf("%.3gs", value)
+	case value >= 1e-3:
+		return fmt.Sprintf("%.3gms", value*1e3)
+	default:
+		return fmt.Sprintf("%.3gµs", value*1e6)
+	}
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"sub": func(a, b float64) float64 { return a - b },
+	"add": func(a, b float64) float64 { return a + b },
+	"seconds": func(d float64) string {
+		return (time.Duration(d * float64(time.Second))).Round(time.Millisecond).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; margin: 2em auto; max-width: 800px; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+table { border-collapse: collapse; font-size: 0.9em; margin: 1em 0; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 10px; text-align: left; }
+td.number { text-align: right; font-variant-numeric: tabular-nums; }
+tr.differ td { background: #fff4d6; }
+.swatch { display: inline-block; width: 12px; height: 12px; margin-right: 6px; vertical-align: middle; }
+.note { color: #777; font-style: italic; }
+.unit { color: #777; font-size: 0.85em; }
+svg text { font-size: 11px; fill: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="unit">Created {{.Created}}</p>
+<table>
+<tr><th>Result</th><th>Tool</th><th>Start</th><th>Duration</th><th>Fingerprint</th></tr>
+{{- range .Entries}}
+<tr><td><span class="swatch" style="background: {{.Color}}"></span>{{.Label}}</td><td>{{.Result.Name}}</td><td>{{.Result.Start.Format "2006-01-02 15:04:05"}}</td><td>{{seconds .Result.Duration}}</td><td>{{printf "%.12s" .Result.Fingerprint}}</td></tr>
+{{- end}}
+</table>
+{{- range .Charts}}
+<h2>{{.Title}}</h2>
+{{- if .Note}}
+<p class="note">{{.Note}}</p>
+{{- else}}
+<p class="unit">{{.Unit}}</p>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+{{- $c := .}}
+{{- range .XTicks}}
+<line x1="{{.Pos}}" y1="{{$c.Top}}" x2="{{.Pos}}" y2="{{$c.Bottom}}" stroke="#eee"/>
+<text x="{{.Pos}}" y="{{add $c.Bottom 16}}" text-anchor="middle">{{.Label}}</text>
+{{- end}}
+{{- range .YTicks}}
+<line x1="{{$c.Left}}" y1="{{.Pos}}" x2="{{$c.Right}}" y2="{{.Pos}}" stroke="#eee"/>
+<text x="{{sub $c.Left 6}}" y="{{add .Pos 4}}" text-anchor="end">{{.Label}}</text>
+{{- end}}
+{{- range .Rows}}
+<text x="{{sub $c.Left 6}}" y="{{add .Pos 4}}" text-anchor="end">{{.Label}}</text>
+{{- end}}
+<line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#999"/>
+<line x1="{{.Left}}" y1="{{.Top}}" x2="{{.Left}}" y2="{{.Bottom}}" stroke="#999"/>
+{{- range .Lines}}
+<polyline points="{{.Points}}" fill="none" stroke="{{.Color}}" stroke-width="2"/>
+{{- end}}
+{{- range .Bars}}
+<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}" fill="{{.Color}}"><title>{{.Title}}</title></rect>
+{{- end}}
+</svg>
+{{- end}}
+{{- end}}
+<h2>Metrics</h2>
+<table>
+<tr><th>Metric</th>{{range .Entries}}<th>{{.Label}}</th>{{end}}</tr>
+{{- range .Metrics}}
+<tr><td>{{.Name}}</td>{{range .Values}}<td class="number">{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- if .Config}}
+<h2>Configuration</h2>
+<table>
+<tr><th>Parameter</th>{{range .Entries}}<th>{{.Label}}</th>{{end}}</tr>
+{{- range .Config}}
+<tr{{if .Differ}} class="differ"{{end}}><td>{{.Name}}</td>{{range .Values}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,77 @@
+package bench
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReport(t *testing.T) {
+	base := NewResult("pubsub1max")
+	base.Metrics["throughput"] = 1000
+	base.Metrics["latency.p50"] = 0.002
+	base.Metrics["latency.p99"] = 0.015
+	base.Metrics["latency.max"] = 0.1
+	base.Metrics["connect.failures.refused"] = 3
+	base.Series = []Interval{
+		{Offset: 1, Length: 1, Metrics: Metrics{"throughput": 900}},
+		{Offset: 2, Length: 1, Metrics: Metrics{"throughput": 1100}},
+	}
+	base.SetConfig(Config{"qos": "1", "url": "tcp://broker:1883"})
+
+	head := NewResult("pubsub1max")
+	head.Metrics["throughput"] = 1200
+	head.Metrics["latency.p50"] = 0.001
+	head.Samples["throughput"] = []float64{1150, 1250}
+	head.SetConfig(Config{"qos": "2", "url": "tcp://broker:1883"})
+
+	var buf bytes.Buffer
+	err := WriteReport(&buf, "Nightly <run>", []*Result{base, head}, []string{"base"})
+	require.NoError(t, err)
+
+	html := buf.String()
+	assert.Contains(t, html, "<title>Nightly &lt;run&gt;</title>")
+	assert.Contains(t, html, "<h2>Throughput over time</h2>")
+	assert.Contains(t, html, "<h2>Latency percentiles</h2>")
+	assert.Contains(t, html, "<h2>Error breakdown</h2>")
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("<polyline")))
+	assert.Contains(t, html, "<title>latency.p99: 15ms</title>")
+	assert.Contains(t, html, "<title>connect.failures.refused: 3</title>")
+	assert.Contains(t, html, `<tr class="differ"><td>qos</td><td>1</td><td>2</td></tr>`)
+	assert.Contains(t, html, "<td>pubsub1max</td>")
+	assert.Contains(t, html, "background: #4e79a7")
+	assert.NotContains(t, html, "ZgotmplZ")
+}
+
+func TestWriteReportEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteReport(&buf, "Empty", []*Result{NewResult("test")}, nil)
+	require.NoError(t, err)
+
+	html := buf.String()
+	assert.Contains(t, html, "No throughput series recorded.")
+	assert.Contains(t, html, "No latencies recorded.")
+	assert.Contains(t, html, "No errors recorded.")
+}
+
+func TestNiceScale(t *testing.T) {
+	upper, step := niceScale(1234)
+	assert.Equal(t, 1500.0, upper)
+	assert.Equal(t, 500.0, step)
+
+	upper, step = niceScale(0.015)
+	assert.InDelta(t, 0.015, upper, 1e-9)
+	assert.InDelta(t, 0.005, step, 1e-9)
+
+	upper, step = niceScale(0)
+	assert.Equal(t, 1.0, upper)
+	assert.Equal(t, 0.25, step)
+}
+
+func TestPercentileRank(t *testing.T) {
+	assert.True(t, percentileRank("p50") < percentileRank("p90"))
+	assert.True(t, percentileRank("p99") < percentileRank("p999"))
+	assert.True(t, percentileRank("p999") < percentileRank("max"))
+}
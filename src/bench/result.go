@@ -0,0 +1,124 @@
+package bench
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// A Result is the structured outcome of a benchmark run that can be written
+// to a JSON file and compared against other runs.
+type Result struct {
+	// The name of the benchmark tool.
+	Name string `json:"name"`
+
+	// The time the run started and its duration in seconds.
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+
+	// The final metrics of the run.
+	Metrics Metrics `json:"metrics"`
+
+	// Repeated observations of a metric, e.g. the throughput of every second.
+	// Samples are used to test the significance of differences between runs.
+	Samples map[string][]float64 `json:"samples,omitempty"`
+
+	// The metrics of consecutive intervals of the run, e.g. of every second,
+	// which allow spotting degradation over time.
+	Series []Interval `json:"series,omitempty"`
+
+	// The resolved parameters of the run and their fingerprint, which ties
+	// the result to the exact test definition.
+	Config      Config `json:"config,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// The paths of the pprof profiles captured during the run.
+	Profiles []string `json:"profiles,omitempty"`
+
+	mutex sync.Mutex
+}
+
+// NewResult returns a new Result for the specified tool that started now.
+func NewResult(name string) *Result {
+	return &Result{
+		Name:    name,
+		Start:   time.Now(),
+		Metrics: Metrics{},
+		Samples: map[string][]float64{},
+	}
+}
+
+// SetConfig will set the parameters of the run and their fingerprint.
+func (r *Result) SetConfig(config Config) {
+	r.Config = config
+	r.Fingerprint = config.Fingerprint()
+}
+
+// AddSample will record an observation of the specified metric. It is safe
+// for concurrent use.
+func (r *Result) AddSample(metric string, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Samples[metric] = append(r.Samples[metric], value)
+}
+
+// AddInterval will append the metrics of an interval to the series. It is
+// safe for concurrent use.
+func (r *Result) AddInterval(interval Interval) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Series = append(r.Series, interval)
+}
+
+// Value returns the value of the specified metric. If the metric is not set
+// the mean of its samples is returned. The second return value reports whether
+// a value is available.
+func (r *Result) Value(metric string) (float64, bool) {
+	if value, ok := r.Metrics[metric]; ok {
+		return value, true
+	}
+
+	samples := r.Samples[metric]
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	sum := 0.0
+	for _, sample := range samples {
+		sum += sample
+	}
+
+	return sum / float64(len(samples)), true
+}
+
+// WriteResult will write the result as JSON to the specified file.
+func WriteResult(path string, result *Result) error {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadResult will read a result from the specified JSON file.
+func ReadResult(path string) (*Result, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
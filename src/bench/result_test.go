@@ -0,0 +1,57 @@
+package bench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultValue(t *testing.T) {
+	result := NewResult("test")
+	result.Metrics["loss"] = 0.5
+	result.AddSample("throughput", 10)
+	result.AddSample("throughput", 20)
+
+	value, ok := result.Value("loss")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, value)
+
+	value, ok = result.Value("throughput")
+	assert.True(t, ok)
+	assert.Equal(t, 15.0, value)
+
+	_, ok = result.Value("foo")
+	assert.False(t, ok)
+}
+
+func TestWriteReadResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "result")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	result := NewResult("test")
+	result.Duration = 1.5
+	result.Metrics["loss"] = 0.5
+	result.AddSample("throughput", 10)
+	result.AddInterval(Interval{Offset: 1, Length: 1, Metrics: Metrics{"throughput": 10}})
+
+	path := filepath.Join(dir, "result.json")
+
+	err = WriteResult(path, result)
+	assert.NoError(t, err)
+
+	read, err := ReadResult(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", read.Name)
+	assert.True(t, result.Start.Equal(read.Start))
+	assert.Equal(t, 1.5, read.Duration)
+	assert.Equal(t, result.Metrics, read.Metrics)
+	assert.Equal(t, result.Samples, read.Samples)
+	assert.Equal(t, result.Series, read.Series)
+
+	_, err = ReadResult(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,594 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"adapter"
+	"packet"
+	"transport"
+)
+
+// ErrUnsupportedQOS is returned by Run if the QOS level is not 0, 1 or 2, or
+// not 0 for adapter runs.
+var ErrUnsupportedQOS = errors.New("unsupported qos")
+
+// ErrUnsupportedAdapterOption is returned by Run if a cluster, a reconnect
+// delay or a publisher pool is set for an adapter run.
+var ErrUnsupportedAdapterOption = errors.New("option not supported by adapter runs")
+
+// A RunConfig describes a publish/subscribe load run. Every worker is a
+// consumer and a publisher pair on its own topic. The command line runner
+// pubsub1max maps its flags to a RunConfig.
+type RunConfig struct {
+	// The name of the result, "run" is used if empty.
+	Name string
+
+	// The broker URL and the dialer used for all connections. The default
+	// dialer is used if no dialer is set. The clients are distributed across
+	// the nodes of the cluster instead if a cluster is set.
+	URL     string
+	Dialer  *transport.Dialer
+	Cluster *Cluster
+
+	// The username and password sent by all clients, the user info of the
+	// URL is used if no credentials are set.
+	Credentials *Credentials
+
+	// Connect the workers with the adapter package, which also supports NATS
+	// and Redis URLs, to compare messaging systems under the same load. The
+	// adapters publish and subscribe with QOS 0 and ignore the dialer, the
+	// credentials and the read and write options.
+	Adapter bool
+
+	// The number of workers and the duration of the run. The run lasts until
+	// the context is canceled if no duration is set. The ids of the workers
+	// start at the offset, e.g. to split the workers across processes.
+	Workers      int
+	WorkerOffset int
+	Duration     time.Duration
+
+	// The messages per second of every publisher, across all publishers and
+	// of every consumer. Rates of zero are unlimited.
+	PublishRate float64
+	GlobalRate  float64
+	ReceiveRate float64
+
+	// The distribution of the publish intervals.
+	Jitter Jitter
+
+	// The number of goroutines that send the messages of all publishers.
+	// Every publisher sends on its own goroutine if zero. A bounded pool keeps
+	// the goroutines of runs with many paced workers at one per consumer and
+	// one per publisher with QOS 1 or 2, which only receive.
+	Publishers int
+
+	// The payload size in bytes and the prefix of the topics.
+	PayloadSize int
+	TopicPrefix string
+
+	// The prefix of the client ids, e.g. "consumer/0" with an empty prefix.
+	ClientIDPrefix string
+
+	// The QOS level of the subscriptions and publishes.
+	QOS byte
+
+	// The number of messages concatenated with a length prefix into every
+	// publish and unpacked by the consumers. Batching is disabled if the size
+	// is one or less.
+	BatchSize int
+
+	// The mean artificial processing time of every received message and its
+	// distribution.
+	ProcessDelay  time.Duration
+	ProcessJitter Jitter
+
+	// Coalesce publishes written within this delay, buffered sends are used
+	// if zero.
+	WriteDelay time.Duration
+
+	// The read buffer size of the consumers, the default is used if zero. If
+	// a maximum is set, the buffers grow and shrink between both sizes.
+	ReadBuffer    int
+	ReadBufferMax int
+
+	// The size of the topic table shared by the consumers and whether
+	// received packets are reused, both reduce the GC pressure. Interning is
+	// disabled if the size is zero.
+	Intern int
+	Arena  bool
+
+	// The delay after which lost connections are reconnected. The run fails
+	// on the first connection error if zero.
+	Reconnect time.Duration
+
+	// Start all publishers at the same instant this long after the last
+	// worker connected and the tolerated deviation from that instant. The
+	// publishers start as they connect if zero.
+	Barrier     time.Duration
+	BarrierSkew time.Duration
+
+	// The time to wait for in flight messages when finishing.
+	Drain time.Duration
+
+	// The commands run at their offsets from the start.
+	Hooks Hooks
+
+	// The sinks the metrics are written to every second and when finishing.
+	// The per second metrics are written on a background goroutine and
+	// dropped if the sinks fall behind. The sinks are not closed by the run.
+	Sinks Sinks
+
+	// The control that changes the rate, payload size and workers during the
+	// run, its initial settings replace PublishRate, PayloadSize and Workers.
+	// The health that tracks the phase, rates and errors of the run.
+	Control *Control
+	Health  *Health
+
+	// The function progress messages are logged with, they are discarded if
+	// no function is set.
+	Logf func(format string, args ...interface{})
+
+	// The acceptance criteria checked against the metrics of the run.
+	Thresholds Thresholds
+}
+
+// NewRunConfig returns a new RunConfig with the defaults of the command line
+// runner for the specified broker URL.
+func NewRunConfig(url string) RunConfig {
+	return RunConfig{
+		URL:         url,
+		Workers:     1,
+		Duration:    30 * time.Second,
+		PayloadSize: 500,
+		BatchSize:   1,
+		BarrierSkew: time.Millisecond,
+		Drain:       time.Second,
+	}
+}
+
+// Config returns the options using the names of the runner flags, so that
+// results of embedded runs carry a fingerprint like command line runs.
+func (c RunConfig) Config() Config {
+	config := Config{
+		"name":             c.Name,
+		"url":              normalize(c.URL),
+		"client-id-prefix": c.ClientIDPrefix,
+		"worker-offset":    strconv.Itoa(c.WorkerOffset),
+		"adapter":          strconv.FormatBool(c.Adapter),
+		"workers":          strconv.Itoa(c.Workers),
+		"duration":         c.Duration.String(),
+		"publish-rate":     strconv.FormatFloat(c.PublishRate, 'g', -1, 64),
+		"global-rate":      strconv.FormatFloat(c.GlobalRate, 'g', -1, 64),
+		"receive-rate":     strconv.FormatFloat(c.ReceiveRate, 'g', -1, 64),
+		"jitter":           c.Jitter.String(),
+		"publishers":       strconv.Itoa(c.Publishers),
+		"payload":          strconv.Itoa(c.PayloadSize),
+		"topic-prefix":     c.TopicPrefix,
+		"qos":              strconv.Itoa(int(c.QOS)),
+		"batch":            strconv.Itoa(c.BatchSize),
+		"process-delay":    c.ProcessDelay.String(),
+		"process-jitter":   c.ProcessJitter.String(),
+		"write-delay":      c.WriteDelay.String(),
+		"read-buffer":      strconv.Itoa(c.ReadBuffer),
+		"read-buffer-max":  strconv.Itoa(c.ReadBufferMax),
+		"intern":           strconv.Itoa(c.Intern),
+		"arena":            strconv.FormatBool(c.Arena),
+		"reconnect":        c.Reconnect.String(),
+		"barrier":          c.Barrier.String(),
+		"barrier-skew":     c.BarrierSkew.String(),
+		"drain":            c.Drain.String(),
+	}
+
+	// distinguish runs against different clusters
+	if c.Cluster != nil {
+		config["nodes"] = normalize(c.Cluster.String())
+		config["strategy"] = c.Cluster.Strategy.String()
+	}
+
+	return config
+}
+
+// A Report is the outcome of an embedded run.
+type Report struct {
+	// The result of the run with the same metrics as the command line runner,
+	// e.g. "throughput", "loss" and "latency.p99".
+	Result *Result
+
+	// The violated thresholds.
+	Violations []error
+}
+
+// Passed returns whether all thresholds have been met.
+func (r *Report) Passed() bool {
+	return len(r.Violations) == 0
+}
+
+// Run will connect the workers, publish until the duration elapsed or the
+// context is canceled and return the report. If a connection fails during the
+// run and no reconnect delay is set, the run is stopped and the report is
+// returned with the error. If the initial workers cannot connect, only the
+// error is returned. Connections that are blocked by a broker that stopped
+// reading are closed when finishing.
+func Run(ctx context.Context, config RunConfig) (*Report, error) {
+	if config.QOS > packet.QOSExactlyOnce || config.Adapter && config.QOS > 0 {
+		return nil, ErrUnsupportedQOS
+	} else if config.Adapter && (config.Cluster != nil || config.Reconnect > 0 || config.Publishers > 0) {
+		return nil, ErrUnsupportedAdapterOption
+	}
+
+	dialer := config.Dialer
+	if dialer == nil {
+		dialer = transport.DefaultDialer()
+	}
+
+	name := config.Name
+	if name == "" {
+		name = "run"
+	}
+
+	result := NewResult(name)
+	result.SetConfig(config.Config())
+
+	r := &run{
+		config:     config,
+		dialer:     dialer,
+		result:     result,
+		start:      result.Start,
+		control:    config.Control,
+		health:     config.Health,
+		recovery:   NewRecovery(result.Start),
+		window:     NewWindow(result.Start),
+		connects:   map[string]*Latencies{},
+		transports: map[string]*Latencies{},
+		connacks:   map[packet.ConnackCode]int64{},
+		failures:   map[transport.ErrorClass]int64{},
+		stop:       make(chan struct{}),
+		fail:       make(chan struct{}),
+	}
+
+	if r.control == nil {
+		r.control = NewControl(Settings{
+			Rate:    config.PublishRate,
+			Workers: config.Workers,
+			Size:    config.PayloadSize,
+		})
+	}
+
+	if r.health == nil {
+		r.health = NewHealth(r.start)
+	}
+
+	if config.GlobalRate > 0 {
+		r.global = NewRateLimiter(config.GlobalRate)
+	}
+
+	if config.Intern > 0 {
+		r.interner = packet.NewInterner(config.Intern)
+	}
+
+	if config.Arena {
+		r.arena = packet.NewArena()
+	}
+
+	settings, _ := r.control.Settings()
+	r.initial = settings.Workers
+
+	if config.Barrier > 0 {
+		r.barrier = NewBarrier(r.initial*2, config.Barrier, config.BarrierSkew)
+	}
+
+	if config.Publishers > 0 {
+		r.pool = newPool(config.Publishers, r.stop)
+	}
+
+	r.sinks = NewSinkWriter(config.Sinks, 60, func(err error) {
+		r.logf("Failed to write metrics: %s\n", err)
+	})
+
+	stopHooks := config.Hooks.Schedule(r.start, r.logHook)
+
+	// start workers
+	for i := 0; i < r.initial; i++ {
+		r.startWorker()
+	}
+
+	r.wg.Add(2)
+	go r.scaler()
+	go r.reporter()
+
+	// run until done
+	var timeout <-chan time.Time
+	if config.Duration > 0 {
+		timer := time.NewTimer(config.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		r.logf("Closing...\n")
+	case <-timeout:
+		r.logf("Finishing...\n")
+	case <-r.fail:
+	}
+
+	// stop publishers and hooks and wait for in flight messages
+	r.sampleGoroutines()
+	r.health.SetPhase(PhaseDraining)
+	atomic.StoreInt32(&r.stopped, 1)
+	close(r.stop)
+	stopHooks()
+
+	if r.barrier != nil {
+		r.barrier.Cancel()
+	}
+
+	deadline := time.Now().Add(config.Drain)
+	for atomic.LoadInt64(&r.received) < atomic.LoadInt64(&r.sent) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	elapsed := time.Since(r.start)
+
+	// closing the connections also unblocks publishers that are stuck on a
+	// broker that stopped reading
+	r.close()
+	r.sinks.Close()
+	r.health.SetPhase(PhaseDone)
+
+	err := r.error()
+	if err != nil && atomic.LoadInt32(&r.warmed) < int32(r.initial*2) {
+		return nil, err
+	}
+
+	// collect metrics
+	metrics := r.metrics(elapsed)
+
+	err2 := config.Sinks.Write(result, time.Now(), metrics)
+	if err2 != nil {
+		r.logf("Failed to write metrics: %s\n", err2)
+	}
+
+	result.Duration = elapsed.Seconds()
+	result.Metrics = metrics
+
+	report := &Report{
+		Result:     result,
+		Violations: config.Thresholds.Check(metrics),
+	}
+
+	return report, err
+}
+
+// run is the state of a single run
+type run struct {
+	config   RunConfig
+	dialer   *transport.Dialer
+	result   *Result
+	start    time.Time
+	initial  int
+	control  *Control
+	health   *Health
+	recovery *Recovery
+	window   *Window
+	barrier  *Barrier
+	global   *RateLimiter
+	pool     *publishPool
+	sinks    *SinkWriter
+	interner *packet.Interner
+	arena    *packet.Arena
+
+	sent       int64
+	received   int64
+	acked      int64
+	reordered  int64
+	invalid    int64
+	failed     int64
+	processing int64
+	goroutines int64
+	warmed     int32
+	stopped    int32
+
+	// the latencies of every consumer, which record them on their own to
+	// avoid contention
+	latencies    []*Latencies
+	subscribes   Latencies
+	resubscribes Latencies
+	unsubscribes Latencies
+	pongs        Latencies
+
+	// the connect times by address family and transport and the connect
+	// outcomes
+	connects   map[string]*Latencies
+	transports map[string]*Latencies
+	connacks   map[packet.ConnackCode]int64
+	failures   map[transport.ErrorClass]int64
+	limiters   []*RateLimiter
+
+	workers    []*runWorker
+	consumers  []transport.Conn
+	publishers []transport.Conn
+	adapters   []adapter.Conn
+
+	wg     sync.WaitGroup
+	stop   chan struct{}
+	fail   chan struct{}
+	err    error
+	closed bool
+	mutex  sync.Mutex
+}
+
+// logf logs a progress message if a log function is set
+func (r *run) logf(format string, args ...interface{}) {
+	if r.config.Logf != nil {
+		r.config.Logf(format, args...)
+	}
+}
+
+func (r *run) logHook(run HookRun) {
+	if run.Err != nil {
+		r.logf("Hook %s failed after %s: %s\n%s", run.Hook, run.End.Sub(run.Start), run.Err, run.Output)
+		return
+	}
+
+	r.logf("Hook %s finished after %s\n%s", run.Hook, run.End.Sub(run.Start), run.Output)
+}
+
+// stopping returns whether the run is finishing
+func (r *run) stopping() bool {
+	return atomic.LoadInt32(&r.stopped) == 1
+}
+
+// failWith records the first error of a connection and stops the run, errors
+// of connections that have been closed by the run are ignored
+func (r *run) failWith(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed || r.err != nil {
+		return
+	}
+
+	r.err = err
+	close(r.fail)
+}
+
+// error returns the recorded error
+func (r *run) error() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.err
+}
+
+// sampleGoroutines records the peak number of goroutines of the process
+func (r *run) sampleGoroutines() {
+	n := int64(runtime.NumGoroutine())
+	for {
+		peak := atomic.LoadInt64(&r.goroutines)
+		if n <= peak || atomic.CompareAndSwapInt64(&r.goroutines, peak, n) {
+			return
+		}
+	}
+}
+
+// countError records a failed operation of the run and its current interval
+func (r *run) countError() {
+	atomic.AddInt64(&r.failed, 1)
+	r.window.Fail()
+}
+
+// register stores the connection in the list at the index or appends it if
+// the index is negative and returns the index. The connection is closed and
+// false is returned if the run has been closed already.
+func (r *run) register(list *[]transport.Conn, index int, conn transport.Conn) (int, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// abort writes to a broker that stopped reading when closing
+	conn.SetCloseTimeout(time.Second)
+
+	if r.closed {
+		conn.Close()
+		return index, false
+	}
+
+	if index < 0 {
+		index = len(*list)
+		*list = append(*list, conn)
+	} else {
+		(*list)[index] = conn
+	}
+
+	return index, true
+}
+
+// close closes all connections and waits for the workers
+func (r *run) close() {
+	r.mutex.Lock()
+	r.closed = true
+	var conns []io.Closer
+	for _, conn := range r.consumers {
+		conns = append(conns, conn)
+	}
+	for _, conn := range r.publishers {
+		conns = append(conns, conn)
+	}
+	for _, conn := range r.adapters {
+		conns = append(conns, conn)
+	}
+	r.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn io.Closer) {
+			defer wg.Done()
+			conn.Close()
+		}(conn)
+	}
+
+	wg.Wait()
+	r.wg.Wait()
+}
+
+// reporter records the rates of every second until the run is stopped
+func (r *run) reporter() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastSent, lastReceived, iterations int64
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		sent := atomic.LoadInt64(&r.sent)
+		received := atomic.LoadInt64(&r.received)
+		curSent := sent - lastSent
+		curReceived := received - lastReceived
+		buffered := sent - received
+		lastSent, lastReceived = sent, received
+
+		iterations++
+
+		r.sampleGoroutines()
+		r.result.AddSample("throughput", float64(curReceived))
+
+		r.health.SetRate("sent", float64(curSent))
+		r.health.SetRate("received", float64(curReceived))
+		r.health.SetRate("buffered", float64(buffered))
+
+		// record interval
+		r.window.Add(curReceived)
+		interval := r.window.Flush(time.Now())
+		interval.Metrics["sent"] = float64(curSent)
+		interval.Metrics["buffered"] = float64(buffered)
+		r.result.AddInterval(interval)
+
+		err := r.sinks.Write(r.result, time.Now(), Metrics{
+			"sent":       float64(curSent),
+			"received":   float64(curReceived),
+			"buffered":   float64(buffered),
+			"throughput": float64(curReceived),
+		})
+		if err != nil {
+			r.logf("Failed to write metrics: %s\n", err)
+		}
+
+		r.logf("Sent: %d msgs - Received: %d msgs (Buffered: %d msgs) (Packets/Read: %.2f) (Average Throughput: %d msg/s)\n",
+			curSent, curReceived, buffered, r.readStats().PacketsPerRead(), received/iterations)
+	}
+}
@@ -0,0 +1,138 @@
+package bench
+
+import (
+	"sync/atomic"
+	"time"
+
+	"adapter"
+)
+
+// dialAdapter connects a client with the adapter package and records the
+// outcome
+func (r *run) dialAdapter(name string) (adapter.Conn, error) {
+	conn, err := adapter.Dial(r.config.URL, r.config.ClientIDPrefix+name)
+	r.outcome(err)
+
+	if err == nil {
+		r.logf("Connected: %s\n", name)
+	}
+
+	return conn, err
+}
+
+// registerAdapter stores the connection to be closed with the run, the
+// connection is closed and false is returned if the run has been closed
+// already
+func (r *run) registerAdapter(conn adapter.Conn) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		conn.Close()
+		return false
+	}
+
+	r.adapters = append(r.adapters, conn)
+
+	return true
+}
+
+func (r *run) adapterConsumer(w *runWorker) {
+	defer r.wg.Done()
+	defer w.ready()
+
+	conn, err := r.dialAdapter("consumer/" + w.id)
+	if err != nil {
+		r.failWith(err)
+		return
+	}
+
+	if !r.registerAdapter(conn) {
+		return
+	} else if !w.setAdapter(conn) {
+		conn.Close()
+		return
+	}
+
+	receiver := r.receiver(w)
+
+	// the adapters wait for the confirmation of the subscription
+	subscribed := time.Now()
+	err = conn.Subscribe(w.topic)
+	if err != nil {
+		r.failWith(err)
+		return
+	}
+
+	r.subscribes.Add(time.Since(subscribed))
+	w.ready()
+	r.warm()
+
+	if r.barrier != nil {
+		r.barrier.Arrive()
+	}
+
+	for {
+		msg, err := conn.Receive()
+		if err != nil && (!w.active() || r.stopping()) {
+			return
+		} else if err != nil {
+			r.failWith(err)
+			return
+		}
+
+		r.addReceived(nil, receiver.process(msg.Payload))
+	}
+}
+
+func (r *run) adapterPublisher(w *runWorker) {
+	defer r.wg.Done()
+
+	conn, err := r.dialAdapter("publisher/" + w.id)
+	if err != nil {
+		r.failWith(err)
+		return
+	}
+
+	if !r.registerAdapter(conn) {
+		return
+	}
+
+	// wait for the subscription to not lose the first messages
+	select {
+	case <-w.subscribed:
+	case <-r.stop:
+		return
+	}
+
+	r.warm()
+
+	// wait for all workers to start the burst together
+	if r.barrier != nil {
+		r.barrier.Wait()
+	}
+
+	stream := r.stream(w)
+
+	for {
+		payload, count, ok := stream.next()
+		if !ok {
+			break
+		}
+
+		err := conn.Publish(w.topic, payload)
+		if err != nil && r.stopping() {
+			return
+		} else if err != nil {
+			r.failWith(err)
+			return
+		}
+
+		atomic.AddInt64(&r.sent, int64(count))
+	}
+
+	// close the connection of a retired worker
+	if !r.stopping() {
+		conn.Close()
+	}
+}
@@ -0,0 +1,362 @@
+package bench
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"packet"
+	"transport"
+)
+
+// metrics collects the metrics of the finished run and logs a summary
+func (r *run) metrics(elapsed time.Duration) Metrics {
+	sent := float64(atomic.LoadInt64(&r.sent))
+	received := float64(atomic.LoadInt64(&r.received))
+	loss := 0.0
+	if sent > 0 && received < sent {
+		loss = (sent - received) / sent
+	}
+
+	failed := float64(atomic.LoadInt64(&r.failed))
+	errorRate := 0.0
+	if failed+received > 0 {
+		errorRate = failed / (failed + received)
+	}
+
+	metrics := Metrics{
+		"sent":       sent,
+		"received":   received,
+		"loss":       loss,
+		"throughput": received / elapsed.Seconds(),
+		"errors":     failed,
+		"error_rate": errorRate,
+	}
+
+	r.logf("Sent: %.0f msgs - Received: %.0f msgs (Loss: %.2f%%) (Throughput: %.0f msg/s) (Errors: %.0f)\n",
+		metrics["sent"], metrics["received"], metrics["loss"]*100, metrics["throughput"], metrics["errors"])
+
+	// add end to end latency metrics merged from all consumers
+	var merged Latencies
+	r.mutex.Lock()
+	for _, recorder := range r.latencies {
+		merged.Merge(recorder)
+	}
+	r.mutex.Unlock()
+
+	if merged.Len() > 0 {
+		for name, value := range merged.Metrics("latency.") {
+			metrics[name] = value
+		}
+
+		metrics["reordered"] = float64(atomic.LoadInt64(&r.reordered))
+
+		r.logf("Latency: p50 %.2fms - p90 %.2fms - p99 %.2fms - max %.2fms (Reordered: %.0f)\n",
+			metrics["latency.p50"]*1000, metrics["latency.p90"]*1000, metrics["latency.p99"]*1000,
+			metrics["latency.max"]*1000, metrics["reordered"])
+	}
+
+	// add acknowledgement metrics
+	if r.config.QOS > 0 {
+		metrics["acked"] = float64(atomic.LoadInt64(&r.acked))
+
+		r.logf("Acknowledged: %.0f publishes\n", metrics["acked"])
+	}
+
+	// add the peak goroutines of the process to compare worker models
+	metrics["goroutines"] = float64(atomic.LoadInt64(&r.goroutines))
+
+	// add subscribe latency metrics
+	if r.subscribes.Len() > 0 {
+		for name, value := range r.subscribes.Metrics("subscribe.") {
+			metrics[name] = value
+		}
+
+		r.logf("Subscribe: p50 %.2fms - p99 %.2fms - max %.2fms\n",
+			metrics["subscribe.p50"]*1000, metrics["subscribe.p99"]*1000, metrics["subscribe.max"]*1000)
+	}
+
+	if r.unsubscribes.Len() > 0 {
+		for name, value := range r.unsubscribes.Metrics("unsubscribe.") {
+			metrics[name] = value
+		}
+
+		r.logf("Unsubscribe: p50 %.2fms - p99 %.2fms - max %.2fms\n",
+			metrics["unsubscribe.p50"]*1000, metrics["unsubscribe.p99"]*1000, metrics["unsubscribe.max"]*1000)
+	}
+
+	if r.resubscribes.Len() > 0 {
+		for name, value := range r.resubscribes.Metrics("resubscribe.") {
+			metrics[name] = value
+		}
+
+		metrics["resubscribes"] = float64(r.resubscribes.Len())
+
+		r.logf("Resubscribe: p50 %.2fms - p99 %.2fms - max %.2fms (Resubscribes: %.0f)\n",
+			metrics["resubscribe.p50"]*1000, metrics["resubscribe.p99"]*1000, metrics["resubscribe.max"]*1000,
+			metrics["resubscribes"])
+	}
+
+	// add processing metrics
+	if r.config.ProcessDelay > 0 && received > 0 {
+		metrics["processing.mean"] = time.Duration(atomic.LoadInt64(&r.processing)).Seconds() / received
+	}
+
+	// add batching metrics
+	if r.config.BatchSize > 1 {
+		metrics["batch.invalid"] = float64(atomic.LoadInt64(&r.invalid))
+	}
+
+	// the adapters do not count reads, packets and wire bytes
+	if !r.config.Adapter {
+		// add read buffer metrics
+		reads := r.readStats()
+		metrics["read.packets_per_read"] = reads.PacketsPerRead()
+		metrics["read.buffer.total"] = float64(reads.BufferSize)
+		metrics["read.buffer.high_water"] = float64(reads.BufferHighWater)
+		metrics["read.buffer.resizes"] = float64(reads.Resizes)
+		metrics["read.packet.max"] = float64(reads.MaxPacket)
+
+		// add packet type metrics
+		stats, wire := r.connStats()
+		r.packetMetrics(metrics, "sent", stats.Sent)
+		r.packetMetrics(metrics, "received", stats.Received)
+
+		// add wire metrics
+		r.wireMetrics(metrics, "sent", wire.Sent, stats.Sent.Payload, elapsed.Seconds())
+		r.wireMetrics(metrics, "received", wire.Received, stats.Received.Payload, elapsed.Seconds())
+		if !wire.Complete {
+			r.logf("Wire bytes of HTTP bridge connections exclude the HTTP framing.\n")
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// add connect outcome metrics
+	attempts := int64(0)
+	for code, n := range r.connacks {
+		metrics["connack."+code.Name()] = float64(n)
+		attempts += n
+	}
+
+	for class, n := range r.failures {
+		metrics["connect.failures."+class.String()] = float64(n)
+		attempts += n
+	}
+
+	metrics["connect.attempts"] = float64(attempts)
+
+	outcomes := ""
+	for code := packet.ConnectionAccepted; code <= packet.ErrNotAuthorized; code++ {
+		if n := metrics["connack."+code.Name()]; n > 0 {
+			outcomes += fmt.Sprintf(" - %s: %.0f", code.Name(), n)
+		}
+	}
+
+	r.logf("Connect attempts: %d%s\n", attempts, outcomes)
+
+	// add address family metrics
+	for f, latencies := range r.connects {
+		for name, value := range latencies.Metrics("family." + f + ".connect.") {
+			metrics[name] = value
+		}
+
+		metrics["family."+f+".connections"] = float64(latencies.Len())
+
+		r.logf("Family %s: %d connections (Connect p50: %.2fms p99: %.2fms)\n", f, latencies.Len(),
+			metrics["family."+f+".connect.p50"]*1000, metrics["family."+f+".connect.p99"]*1000)
+	}
+
+	// add web socket pong metrics
+	if n := r.pongs.Len(); n > 0 {
+		for name, value := range r.pongs.Metrics("ws.pong.") {
+			metrics[name] = value
+		}
+
+		metrics["ws.pongs"] = float64(n)
+
+		r.logf("WebSocket pongs: %d (p50: %.2fms p99: %.2fms)\n", n,
+			metrics["ws.pong.p50"]*1000, metrics["ws.pong.p99"]*1000)
+	}
+
+	// add throttling metrics
+	if len(r.limiters) > 0 || r.global != nil {
+		var clientThrottled time.Duration
+		var clientWaits int64
+		for _, limiter := range r.limiters {
+			d, n := limiter.Throttled()
+			clientThrottled += d
+			clientWaits += n
+		}
+
+		var globalThrottled time.Duration
+		var globalWaits int64
+		if r.global != nil {
+			globalThrottled, globalWaits = r.global.Throttled()
+		}
+
+		metrics["throttled.client"] = clientThrottled.Seconds()
+		metrics["throttled.client_waits"] = float64(clientWaits)
+		metrics["throttled.global"] = globalThrottled.Seconds()
+		metrics["throttled.global_waits"] = float64(globalWaits)
+
+		r.logf("Throttled: %s by client limits (%d waits) - %s by global limit (%d waits)\n",
+			clientThrottled.Round(time.Millisecond), clientWaits, globalThrottled.Round(time.Millisecond), globalWaits)
+	}
+
+	// add interner metrics
+	if r.interner != nil {
+		stats := r.interner.Stats()
+		metrics["intern.hit_rate"] = stats.HitRate()
+		metrics["intern.entries"] = float64(stats.Entries)
+
+		r.logf("Interned Topics: %d (Hits: %d) (Misses: %d) (Hit Rate: %.2f%%)\n",
+			stats.Entries, stats.Hits, stats.Misses, stats.HitRate()*100)
+	}
+
+	// add arena metrics
+	if r.arena != nil {
+		stats := r.arena.Stats()
+		metrics["arena.reuse_rate"] = stats.ReuseRate()
+
+		r.logf("Arena Packets: %d (Reused: %d) (Reuse Rate: %.2f%%)\n",
+			stats.Packets, stats.Reused, stats.ReuseRate()*100)
+	}
+
+	// add barrier metrics
+	if r.barrier != nil && r.barrier.Released() {
+		for name, value := range r.barrier.Metrics("barrier.") {
+			metrics[name] = value
+		}
+
+		r.logf("Barrier: %.0f publishers (Skew p50: %.3fms p99: %.3fms max: %.3fms) (Late: %.0f)\n",
+			metrics["barrier.parties"], metrics["barrier.skew.p50"]*1000, metrics["barrier.skew.p99"]*1000,
+			metrics["barrier.skew.max"]*1000, metrics["barrier.late"])
+	}
+
+	// add recovery metrics
+	if len(r.config.Hooks) > 0 || r.config.Reconnect > 0 {
+		m := r.recovery.Metrics()
+		for name, value := range m {
+			metrics[name] = value
+		}
+
+		r.logf("Disconnects: %.0f - Reconnects: %.0f (Peak: %.0f/s) (Recovery: %.2fs) (Loss Window: %.2fs)\n",
+			m["disconnects"], m["reconnects"], m["reconnect_storm"], m["reconnect_duration"], m["loss_window"])
+	}
+
+	// add node metrics
+	if cluster := r.config.Cluster; cluster != nil {
+		for name, value := range cluster.Metrics() {
+			metrics[name] = value
+		}
+
+		for _, node := range cluster.Nodes {
+			m := node.Metrics()
+			r.logf("Node %s: %.0f connections - Sent: %.0f msgs - Received: %.0f msgs\n",
+				node.Name, m["connections"], m["sent"], m["received"])
+		}
+
+		for _, name := range cluster.Names() {
+			r.logf("Imbalance of %s: %.2f\n", name, metrics["imbalance."+name])
+		}
+
+		// add transport metrics
+		for name, value := range cluster.TransportMetrics() {
+			metrics[name] = value
+		}
+
+		for t, latencies := range r.transports {
+			for name, value := range latencies.Metrics("transport." + t + ".connect.") {
+				metrics[name] = value
+			}
+		}
+
+		for _, t := range cluster.Transports() {
+			prefix := "transport." + t + "."
+			r.logf("Transport %s: %.0f connections - Sent: %.0f msgs - Received: %.0f msgs (Connect p50: %.2fms p99: %.2fms)\n",
+				t, metrics[prefix+"connections"], metrics[prefix+"sent"], metrics[prefix+"received"],
+				metrics[prefix+"connect.p50"]*1000, metrics[prefix+"connect.p99"]*1000)
+		}
+	}
+
+	return metrics
+}
+
+// readStats returns the read counters of all consumers
+func (r *run) readStats() packet.DecoderStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var total packet.DecoderStats
+	for _, conn := range r.consumers {
+		stats := conn.ReadStats()
+		total.Reads += stats.Reads
+		total.Bytes += stats.Bytes
+		total.Packets += stats.Packets
+		total.BufferSize += stats.BufferSize
+		total.Resizes += stats.Resizes
+		if stats.BufferHighWater > total.BufferHighWater {
+			total.BufferHighWater = stats.BufferHighWater
+		}
+		if stats.MaxPacket > total.MaxPacket {
+			total.MaxPacket = stats.MaxPacket
+		}
+	}
+
+	return total
+}
+
+// connStats returns the packet and wire counters of all connections
+func (r *run) connStats() (transport.PacketStats, transport.WireStats) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var packets transport.PacketStats
+	wire := transport.WireStats{Complete: true}
+	for _, list := range [][]transport.Conn{r.consumers, r.publishers} {
+		for _, conn := range list {
+			packets = packets.Merge(conn.PacketStats())
+			wire = wire.Merge(conn.WireStats())
+		}
+	}
+
+	return packets, wire
+}
+
+func (r *run) wireMetrics(metrics Metrics, direction string, bytes int64, payload uint64, elapsed float64) {
+	metrics["bytes."+direction+".wire"] = float64(bytes)
+	metrics["wire."+direction] = float64(bytes) / elapsed
+	metrics["goodput."+direction] = float64(payload) / elapsed
+
+	// the share of bytes on the wire that are not publish payload
+	if payload > 0 {
+		metrics["overhead.wire."+direction] = (float64(bytes) - float64(payload)) / float64(payload)
+	}
+
+	r.logf("%-8s wire: %12d bytes (%.0f bytes/s) - goodput: %.0f bytes/s\n", direction, bytes,
+		metrics["wire."+direction], metrics["goodput."+direction])
+}
+
+func (r *run) packetMetrics(metrics Metrics, direction string, stats packet.TypeStats) {
+	for t := packet.CONNECT; t <= packet.DISCONNECT; t++ {
+		if stats.Packets[t] == 0 {
+			continue
+		}
+
+		name := strings.ToLower(t.String())
+		metrics["packets."+direction+"."+name] = float64(stats.Packets[t])
+		metrics["bytes."+direction+"."+name] = float64(stats.Bytes[t])
+
+		r.logf("%-8s %-11s %10d packets %12d bytes\n", direction, t, stats.Packets[t], stats.Bytes[t])
+	}
+
+	// the share of bytes that are not publish payload
+	_, bytes := stats.Total()
+	metrics["bytes."+direction+".payload"] = float64(stats.Payload)
+	if stats.Payload > 0 {
+		metrics["overhead."+direction] = float64(bytes-stats.Payload) / float64(stats.Payload)
+	}
+}
@@ -0,0 +1,204 @@
+package bench
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// the number of sends a pooled publisher may make in a row before it yields
+// to the other publishers
+const poolBurst = 16
+
+// a publishPool sends the messages of many publishers on a bounded number of
+// goroutines. The next message of every publisher is scheduled on a timer
+// that hands due publishers to the senders, like the client heartbeat.
+type publishPool struct {
+	senders int
+	tasks   taskQueue
+	wake    chan struct{}
+	work    chan *task
+	stop    <-chan struct{}
+	stopped bool
+	mutex   sync.Mutex
+}
+
+// a task is a scheduled publisher step, the function returns the delay until
+// the next step or false if the publisher finished
+type task struct {
+	fn    func() (time.Duration, bool)
+	at    time.Time
+	index int
+}
+
+// newPool returns a publishPool that runs until the stop channel is closed,
+// pending tasks are run immediately once stopped
+func newPool(senders int, stop <-chan struct{}) *publishPool {
+	p := &publishPool{
+		senders: senders,
+		wake:    make(chan struct{}, 1),
+		work:    make(chan *task),
+		stop:    stop,
+	}
+
+	go p.timer()
+
+	for i := 0; i < senders; i++ {
+		go p.sender()
+	}
+
+	return p
+}
+
+// schedule runs the function after the delay and whenever the returned delay
+// elapsed until it returns false
+func (p *publishPool) schedule(fn func() (time.Duration, bool), delay time.Duration) {
+	p.queue(&task{fn: fn, index: -1}, delay)
+}
+
+// queues a task or runs it until it finished if the pool has been stopped
+func (p *publishPool) queue(t *task, delay time.Duration) {
+	p.mutex.Lock()
+	if !p.stopped {
+		p.push(t, delay)
+		p.mutex.Unlock()
+		return
+	}
+	p.mutex.Unlock()
+
+	for {
+		_, ok := t.fn()
+		if !ok {
+			return
+		}
+	}
+}
+
+// pushes a task, the mutex must be held
+func (p *publishPool) push(t *task, delay time.Duration) {
+	t.at = time.Now().Add(delay)
+	heap.Push(&p.tasks, t)
+
+	// wake timer if the task is the next one
+	if t.index == 0 {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// hands due tasks to the senders
+func (p *publishPool) timer() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		p.mutex.Lock()
+
+		// dispatch due tasks
+		for len(p.tasks) > 0 && !p.tasks[0].at.After(time.Now()) {
+			t := heap.Pop(&p.tasks).(*task)
+			p.mutex.Unlock()
+
+			select {
+			case p.work <- t:
+			case <-p.stop:
+				p.shutdown(t)
+				return
+			}
+
+			p.mutex.Lock()
+		}
+
+		// arm timer for the next task
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		var next <-chan time.Time
+		if len(p.tasks) > 0 {
+			timer.Reset(time.Until(p.tasks[0].at))
+			next = timer.C
+		}
+
+		p.mutex.Unlock()
+
+		select {
+		case <-next:
+		case <-p.wake:
+		case <-p.stop:
+			p.shutdown(nil)
+			return
+		}
+	}
+}
+
+// hands the pending tasks to the senders, which run them until they finished,
+// and stops the senders
+func (p *publishPool) shutdown(pending *task) {
+	p.mutex.Lock()
+	p.stopped = true
+	tasks := p.tasks
+	p.tasks = nil
+	p.mutex.Unlock()
+
+	if pending != nil {
+		p.work <- pending
+	}
+
+	for _, t := range tasks {
+		p.work <- t
+	}
+
+	close(p.work)
+}
+
+// runs due tasks and reschedules them
+func (p *publishPool) sender() {
+	for t := range p.work {
+		for i := 0; ; i++ {
+			delay, ok := t.fn()
+			if !ok {
+				break
+			} else if delay <= 0 && i < poolBurst {
+				continue
+			}
+
+			p.queue(t, delay)
+			break
+		}
+	}
+}
+
+// a taskQueue is a min heap of tasks ordered by their time
+type taskQueue []*task
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *taskQueue) Push(x interface{}) {
+	t := x.(*task)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*q = old[:n-1]
+	return t
+}
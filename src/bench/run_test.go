@@ -0,0 +1,340 @@
+package bench
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+	"transport"
+)
+
+// runBroker is a minimal broker that forwards publishes to the subscribers of
+// the exact topic with their qos, clients whose id starts with the stall
+// prefix are not read from after connecting
+func runBroker(t *testing.T, code packet.ConnackCode, stall string) (string, func()) {
+	server, err := transport.Launch("tcp://localhost:0")
+	require.NoError(t, err)
+
+	var subscribers sync.Map
+
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				// sends are serialized as publishes are forwarded by the
+				// goroutines of the publishers
+				var mutex sync.Mutex
+				send := func(conn transport.Conn, mutex *sync.Mutex, pkt packet.GenericPacket) {
+					mutex.Lock()
+					conn.Send(pkt)
+					mutex.Unlock()
+				}
+
+				for {
+					pkt, err := conn.Receive()
+					if err != nil {
+						return
+					}
+
+					switch p := pkt.(type) {
+					case *packet.ConnectPacket:
+						connack := packet.NewConnackPacket()
+						connack.ReturnCode = code
+						send(conn, &mutex, connack)
+
+						if stall != "" && strings.HasPrefix(p.ClientID, stall) {
+							<-make(chan struct{})
+						}
+					case *packet.SubscribePacket:
+						for _, sub := range p.Subscriptions {
+							subscribers.Store(sub.Topic, [2]interface{}{conn, &mutex})
+						}
+
+						suback := packet.NewSubackPacket()
+						suback.ID = p.ID
+						suback.ReturnCodes = []uint8{p.Subscriptions[0].QOS}
+						send(conn, &mutex, suback)
+					case *packet.PublishPacket:
+						if sub, ok := subscribers.Load(p.Message.Topic); ok {
+							pair := sub.([2]interface{})
+							send(pair[0].(transport.Conn), pair[1].(*sync.Mutex), p)
+						}
+
+						switch p.Message.QOS {
+						case packet.QOSAtLeastOnce:
+							puback := packet.NewPubackPacket()
+							puback.ID = p.ID
+							send(conn, &mutex, puback)
+						case packet.QOSExactlyOnce:
+							pubrec := packet.NewPubrecPacket()
+							pubrec.ID = p.ID
+							send(conn, &mutex, pubrec)
+						}
+					case *packet.PubrecPacket:
+						pubrel := packet.NewPubrelPacket()
+						pubrel.ID = p.ID
+						send(conn, &mutex, pubrel)
+					case *packet.PubrelPacket:
+						pubcomp := packet.NewPubcompPacket()
+						pubcomp.ID = p.ID
+						send(conn, &mutex, pubcomp)
+					}
+				}
+			}()
+		}
+	}()
+
+	return "tcp://" + server.Addr().String(), func() {
+		server.Close()
+	}
+}
+
+func TestRun(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "")
+	defer stop()
+
+	config := NewRunConfig(url)
+	config.Workers = 2
+	config.Duration = 200 * time.Millisecond
+	config.PublishRate = 100
+	config.PayloadSize = 64
+	config.TopicPrefix = "run/"
+	require.NoError(t, config.Thresholds.Set("loss==0"))
+	require.NoError(t, config.Thresholds.Set("throughput>1e9"))
+
+	report, err := Run(context.Background(), config)
+	require.NoError(t, err)
+
+	metrics := report.Result.Metrics
+	assert.Equal(t, "run", report.Result.Name)
+	assert.True(t, metrics["sent"] > 0)
+	assert.Equal(t, metrics["sent"], metrics["received"])
+	assert.Equal(t, 0.0, metrics["loss"])
+	assert.True(t, metrics["latency.p99"] > 0)
+	assert.Equal(t, "2", report.Result.Config["workers"])
+	assert.NotEmpty(t, report.Result.Fingerprint)
+
+	assert.False(t, report.Passed())
+	assert.Len(t, report.Violations, 1)
+}
+
+func TestRunConfigFingerprint(t *testing.T) {
+	config := NewRunConfig("tcp://localhost:1883")
+	fingerprint := config.Config().Fingerprint()
+
+	// shards differ by their worker offset
+	shard := config
+	shard.WorkerOffset = 10
+	assert.NotEqual(t, fingerprint, shard.Config().Fingerprint())
+
+	named := config
+	named.Name = "other"
+	named.ClientIDPrefix = "other/"
+	assert.NotEqual(t, fingerprint, named.Config().Fingerprint())
+
+	// runs differ by their cluster nodes and strategy
+	nodes, err := ParseNodes("a=tcp://10.0.0.1:1883*2,b=tcp://10.0.0.2:1883")
+	require.NoError(t, err)
+
+	cluster1 := config
+	cluster1.Cluster, err = NewCluster(nodes, RoundRobin)
+	require.NoError(t, err)
+
+	cluster2 := config
+	cluster2.Cluster, err = NewCluster(nodes[:1], RoundRobin)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, cluster1.Config().Fingerprint(), cluster2.Config().Fingerprint())
+	assert.Equal(t, "a=tcp://10.0.0.1:1883*2,b=tcp://10.0.0.2:1883*1", cluster1.Config()["nodes"])
+	assert.Equal(t, "round-robin", cluster1.Config()["strategy"])
+}
+
+func TestRunContext(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "")
+	defer stop()
+
+	config := NewRunConfig(url)
+	config.Duration = 0
+	config.PublishRate = 100
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	report, err := Run(ctx, config)
+	require.NoError(t, err)
+	assert.True(t, report.Result.Duration < 5)
+	assert.True(t, report.Passed())
+}
+
+func TestRunConnectionDenied(t *testing.T) {
+	url, stop := runBroker(t, packet.ErrNotAuthorized, "")
+	defer stop()
+
+	report, err := Run(context.Background(), NewRunConfig(url))
+	assert.Error(t, err)
+	assert.Nil(t, report)
+}
+
+func TestRunQOS(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "")
+	defer stop()
+
+	for _, qos := range []byte{1, 2} {
+		config := NewRunConfig(url)
+		config.Workers = 2
+		config.Duration = 200 * time.Millisecond
+		config.PublishRate = 100
+		config.QOS = qos
+
+		report, err := Run(context.Background(), config)
+		require.NoError(t, err)
+
+		metrics := report.Result.Metrics
+		assert.True(t, metrics["sent"] > 0)
+		assert.Equal(t, metrics["sent"], metrics["received"])
+		assert.Equal(t, metrics["sent"], metrics["acked"])
+		assert.Equal(t, metrics["received"], metrics["packets.sent.puback"]+metrics["packets.sent.pubcomp"])
+	}
+
+	config := NewRunConfig(url)
+	config.QOS = 3
+
+	_, err := Run(context.Background(), config)
+	assert.Equal(t, ErrUnsupportedQOS, err)
+}
+
+func TestRunBatch(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "")
+	defer stop()
+
+	config := NewRunConfig(url)
+	config.Duration = 200 * time.Millisecond
+	config.PublishRate = 1000
+	config.BatchSize = 10
+	config.ReceiveRate = 1000
+	config.Intern = 10
+	config.Arena = true
+
+	report, err := Run(context.Background(), config)
+	require.NoError(t, err)
+
+	metrics := report.Result.Metrics
+	assert.True(t, metrics["sent"] >= 10)
+	assert.Equal(t, metrics["sent"], metrics["received"])
+	assert.Equal(t, metrics["sent"], metrics["packets.sent.publish"]*10)
+	assert.Equal(t, 0.0, metrics["batch.invalid"])
+	assert.Equal(t, "10", report.Result.Config["batch"])
+}
+
+func TestRunPublishers(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "")
+	defer stop()
+
+	goroutines := map[int]float64{}
+	for _, publishers := range []int{0, 2} {
+		for _, qos := range []byte{0, 1} {
+			config := NewRunConfig(url)
+			config.Workers = 50
+			config.Duration = 300 * time.Millisecond
+			config.PublishRate = 50
+			config.BatchSize = 2
+			config.QOS = qos
+			config.Publishers = publishers
+
+			report, err := Run(context.Background(), config)
+			require.NoError(t, err)
+
+			metrics := report.Result.Metrics
+			assert.True(t, metrics["sent"] >= 100)
+			assert.Equal(t, metrics["sent"], metrics["received"])
+			assert.Equal(t, strconv.Itoa(publishers), report.Result.Config["publishers"])
+
+			if qos == 0 {
+				goroutines[publishers] = metrics["goroutines"]
+			}
+		}
+	}
+
+	// the pool replaces the goroutine of every publisher
+	assert.True(t, goroutines[2] <= goroutines[0]-40, "%v", goroutines)
+}
+
+func TestRunAdapter(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "")
+	defer stop()
+
+	config := NewRunConfig(url)
+	config.Adapter = true
+	config.Workers = 2
+	config.Duration = 200 * time.Millisecond
+	config.PublishRate = 1000
+	config.BatchSize = 5
+
+	report, err := Run(context.Background(), config)
+	require.NoError(t, err)
+
+	metrics := report.Result.Metrics
+	assert.True(t, metrics["sent"] >= 10)
+	assert.Equal(t, metrics["sent"], metrics["received"])
+	assert.True(t, metrics["latency.p50"] > 0)
+	assert.True(t, metrics["subscribe.p50"] > 0)
+	assert.Equal(t, "true", report.Result.Config["adapter"])
+
+	config.QOS = 1
+	_, err = Run(context.Background(), config)
+	assert.Equal(t, ErrUnsupportedQOS, err)
+
+	config.QOS = 0
+	config.Reconnect = time.Second
+	_, err = Run(context.Background(), config)
+	assert.Equal(t, ErrUnsupportedAdapterOption, err)
+
+	config.Reconnect = 0
+	config.Publishers = 2
+	_, err = Run(context.Background(), config)
+	assert.Equal(t, ErrUnsupportedAdapterOption, err)
+}
+
+func TestRunBlockedPublisher(t *testing.T) {
+	url, stop := runBroker(t, packet.ConnectionAccepted, "publisher/")
+	defer stop()
+
+	for _, publishers := range []int{0, 1} {
+		config := NewRunConfig(url)
+		config.Duration = 0
+		config.PayloadSize = 65536
+		config.Publishers = publishers
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			report, err := Run(ctx, config)
+			assert.NoError(t, err)
+			assert.True(t, report.Result.Metrics["sent"] > 0)
+			assert.Equal(t, 0.0, report.Result.Metrics["received"])
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("run blocked by publisher")
+		}
+	}
+}
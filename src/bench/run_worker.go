@@ -0,0 +1,948 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"adapter"
+	"packet"
+	"transport"
+)
+
+// a runWorker is a consumer and publisher pair that can be retired while the
+// run is running
+type runWorker struct {
+	id           string
+	topic        string
+	retired      int32
+	unsubscribed int64
+	consumer     transport.Conn
+	adapter      adapter.Conn
+	subscribed   chan struct{}
+	once         sync.Once
+	mutex        sync.Mutex
+}
+
+// ready releases the publisher once the consumer has been subscribed or has
+// stopped
+func (w *runWorker) ready() {
+	w.once.Do(func() {
+		close(w.subscribed)
+	})
+}
+
+// setConsumer records the current consumer connection and returns whether
+// the worker is still active
+func (w *runWorker) setConsumer(conn transport.Conn) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.consumer = conn
+
+	return atomic.LoadInt32(&w.retired) == 0
+}
+
+// setAdapter records the adapter connection of the consumer and returns
+// whether the worker is still active
+func (w *runWorker) setAdapter(conn adapter.Conn) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.adapter = conn
+
+	return atomic.LoadInt32(&w.retired) == 0
+}
+
+// send sends a packet on the consumer connection, which is shared with the
+// unsubscribe of a retired worker
+func (w *runWorker) send(conn transport.Conn, pkt packet.GenericPacket) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return conn.Send(pkt)
+}
+
+// retire stops the publisher and unsubscribes the consumer after in flight
+// messages have been received, the consumer closes its connection once the
+// unsubscribe has been acknowledged or after another drain period. Adapter
+// consumers cannot unsubscribe and are closed after the first drain period.
+func (w *runWorker) retire(drain time.Duration) {
+	atomic.StoreInt32(&w.retired, 1)
+
+	time.AfterFunc(drain, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		if w.adapter != nil {
+			w.adapter.Close()
+			return
+		} else if w.consumer == nil {
+			return
+		}
+
+		consumer := w.consumer
+		atomic.StoreInt64(&w.unsubscribed, time.Now().UnixNano())
+
+		unsubscribe := packet.NewUnsubscribePacket()
+		unsubscribe.ID = 2
+		unsubscribe.Topics = []string{w.topic}
+
+		err := consumer.Send(unsubscribe)
+		if err != nil {
+			consumer.Close()
+			return
+		}
+
+		time.AfterFunc(drain, func() {
+			consumer.Close()
+		})
+	})
+}
+
+func (w *runWorker) active() bool {
+	return atomic.LoadInt32(&w.retired) == 0
+}
+
+// startWorker starts the consumer and publisher of the next worker
+func (r *run) startWorker() {
+	r.mutex.Lock()
+	id := strconv.Itoa(r.config.WorkerOffset + len(r.workers))
+	w := &runWorker{id: id, topic: r.config.TopicPrefix + id, subscribed: make(chan struct{})}
+	r.workers = append(r.workers, w)
+	r.mutex.Unlock()
+
+	r.wg.Add(2)
+	if r.config.Adapter {
+		go r.adapterConsumer(w)
+		go r.adapterPublisher(w)
+	} else {
+		go r.consumer(w)
+		go r.publisher(w)
+	}
+}
+
+// scaler starts and retires workers when the worker count is changed
+func (r *run) scaler() {
+	defer r.wg.Done()
+
+	changed := r.control.Changed()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-changed:
+		}
+
+		changed = r.control.Changed()
+
+		settings, _ := r.control.Settings()
+
+		r.mutex.Lock()
+		running := 0
+		for _, w := range r.workers {
+			if w.active() {
+				running++
+			}
+		}
+
+		// retire the latest workers first
+		for i := len(r.workers) - 1; i >= 0 && running > settings.Workers; i-- {
+			if r.workers[i].active() {
+				r.workers[i].retire(r.config.Drain)
+				running--
+			}
+		}
+		r.mutex.Unlock()
+
+		for ; running < settings.Workers; running++ {
+			r.startWorker()
+		}
+
+		r.logf("Control: %d workers - Rate: %.0f msg/s - Size: %d bytes\n", settings.Workers, settings.Rate, settings.Size)
+	}
+}
+
+// warm marks a connection of the initial workers as established, the run is
+// running once all of them are
+func (r *run) warm() {
+	if atomic.AddInt32(&r.warmed, 1) == int32(r.initial*2) {
+		r.health.SetPhase(PhaseRunning)
+	}
+}
+
+// reconnect waits for the reconnect delay and dials until a connection has
+// been established, it returns false if the run has been stopped
+func (r *run) reconnect(name string) (transport.Conn, *Node, bool) {
+	r.recovery.Disconnected()
+	r.health.AddError("disconnects", 1)
+	r.countError()
+
+	timer := time.NewTimer(r.config.Reconnect)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return nil, nil, false
+		case <-timer.C:
+		}
+
+		conn, node, err := r.dial(name)
+		if err == nil {
+			r.recovery.Reconnected()
+			return conn, node, true
+		}
+
+		r.countError()
+		r.logf("Reconnect failed: %s (%s)\n", name, err)
+
+		timer.Reset(r.config.Reconnect)
+	}
+}
+
+// dial connects a client and records the outcome
+func (r *run) dial(name string) (transport.Conn, *Node, error) {
+	conn, node, err := r.attempt(name)
+	r.outcome(err)
+
+	return conn, node, err
+}
+
+// outcome records the outcome of a connect
+func (r *run) outcome(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var code packet.ConnackCode
+	if err == nil {
+		r.connacks[packet.ConnectionAccepted]++
+	} else if errors.As(err, &code) {
+		r.connacks[code]++
+		r.health.AddError("connack."+code.Name(), 1)
+	} else {
+		class := transport.ClassifyError(err)
+		r.failures[class]++
+		r.health.AddError("connect."+class.String(), 1)
+	}
+}
+
+// attempt connects a client to the broker or the picked node and waits for
+// the connack
+func (r *run) attempt(name string) (transport.Conn, *Node, error) {
+	clientID := r.config.ClientIDPrefix + name
+
+	// pick node
+	brokerURL := r.config.URL
+	var node *Node
+	if r.config.Cluster != nil {
+		node = r.config.Cluster.Pick(clientID)
+		brokerURL = node.URL
+	}
+
+	connectStart := time.Now()
+	conn, err := r.dialer.Dial(brokerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	connect := packet.NewConnectPacket()
+	connect.ClientID = clientID
+	connect.CleanSession = true
+
+	if u, err := url.Parse(brokerURL); err == nil && u.User != nil {
+		connect.Username = u.User.Username()
+		connect.Password, _ = u.User.Password()
+	}
+
+	if r.config.Credentials != nil {
+		connect.Username = r.config.Credentials.Username
+		connect.Password = r.config.Credentials.Password
+	}
+
+	err = conn.Send(connect)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	pkt, err := conn.Receive()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	connack, ok := pkt.(*packet.ConnackPacket)
+	if !ok {
+		conn.Close()
+		return nil, nil, fmt.Errorf("connection failed: expected connack, got %s", pkt.Type())
+	} else if connack.ReturnCode != packet.ConnectionAccepted {
+		conn.Close()
+		return nil, nil, fmt.Errorf("connection failed: %w", connack.ReturnCode)
+	}
+
+	connectTime := time.Since(connectStart)
+
+	// measure the round trips of web socket pings
+	if ws, ok := conn.(*transport.WebSocketConn); ok && r.dialer.WebSocketPingInterval > 0 {
+		handler := r.dialer.WebSocketPongHandler
+		ws.SetPongHandler(func(rtt time.Duration) {
+			r.pongs.Add(rtt)
+
+			if handler != nil {
+				handler(rtt)
+			}
+		})
+	}
+
+	// record connect time per address family and transport
+	r.mutex.Lock()
+	if f := transport.AddrFamily(conn.RemoteAddr()); f != "" {
+		if r.connects[f] == nil {
+			r.connects[f] = &Latencies{}
+		}
+		r.connects[f].Add(connectTime)
+	}
+
+	if node != nil {
+		t := node.Transport()
+		if r.transports[t] == nil {
+			r.transports[t] = &Latencies{}
+		}
+		r.transports[t].Add(connectTime)
+	}
+	r.mutex.Unlock()
+
+	if node != nil {
+		node.Add("connections", 1)
+		r.logf("Connected: %s (%s)\n", name, node.Name)
+	} else {
+		r.logf("Connected: %s\n", name)
+	}
+
+	return conn, node, nil
+}
+
+// configure applies the read options to a consumer connection
+func (r *run) configure(conn transport.Conn) {
+	if r.config.ReadBuffer > 0 {
+		conn.SetReadBufferSize(r.config.ReadBuffer)
+	}
+
+	if r.config.ReadBufferMax > 0 {
+		conn.SetAdaptiveReadBuffer(r.config.ReadBuffer, r.config.ReadBufferMax)
+	}
+
+	if r.interner != nil {
+		conn.SetInterner(r.interner)
+	}
+
+	if r.arena != nil {
+		conn.SetArena(r.arena)
+	}
+}
+
+// subscribe sends the subscription of the worker, the suback is received by
+// the consumer
+func (r *run) subscribe(w *runWorker, conn transport.Conn) error {
+	subscribe := packet.NewSubscribePacket()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: w.topic, QOS: r.config.QOS},
+	}
+
+	return w.send(conn, subscribe)
+}
+
+func (r *run) consumer(w *runWorker) {
+	defer r.wg.Done()
+	defer w.ready()
+
+	name := "consumer/" + w.id
+	conn, node, err := r.dial(name)
+	if err != nil {
+		r.failWith(err)
+		return
+	}
+
+	index, ok := r.register(&r.consumers, -1, conn)
+	if !ok {
+		return
+	} else if !w.setConsumer(conn) {
+		conn.Close()
+		return
+	}
+
+	r.configure(conn)
+
+	receiver := r.receiver(w)
+
+	subscribed := time.Now()
+	subscribeTimes := &r.subscribes
+	err = r.subscribe(w, conn)
+	if err != nil {
+		r.failWith(err)
+		return
+	}
+
+	r.warm()
+
+	if r.barrier != nil {
+		r.barrier.Arrive()
+	}
+
+	for {
+		pkt, err := conn.Receive()
+		if err != nil && (!w.active() || r.stopping()) {
+			return
+		} else if err != nil && r.config.Reconnect > 0 {
+			conn.Close()
+
+			for err != nil {
+				conn, node, ok = r.reconnect(name)
+				if !ok {
+					return
+				}
+
+				subscribed = time.Now()
+				subscribeTimes = &r.resubscribes
+				err = r.subscribe(w, conn)
+				if err != nil {
+					conn.Close()
+				}
+			}
+
+			r.configure(conn)
+
+			_, ok = r.register(&r.consumers, index, conn)
+			if !ok {
+				return
+			} else if !w.setConsumer(conn) {
+				conn.Close()
+				return
+			}
+
+			continue
+		} else if err != nil {
+			r.failWith(err)
+			return
+		}
+
+		// measure the subscribe and unsubscribe latency when the ack is
+		// received, independent of the receive rate, and complete the qos 2
+		// flows
+		var publish *packet.PublishPacket
+		switch p := pkt.(type) {
+		case *packet.SubackPacket:
+			subscribeTimes.Add(time.Since(subscribed))
+			w.ready()
+			continue
+		case *packet.UnsubackPacket:
+			r.unsubscribes.Add(time.Since(time.Unix(0, atomic.LoadInt64(&w.unsubscribed))))
+			conn.Close()
+			return
+		case *packet.PubrelPacket:
+			pubcomp := packet.NewPubcompPacket()
+			pubcomp.ID = p.ID
+			w.send(conn, pubcomp)
+			continue
+		case *packet.PublishPacket:
+			publish = p
+		default:
+			continue
+		}
+
+		count := receiver.process(publish.Message.Payload)
+
+		// acknowledge the processed message, a failed send also fails the
+		// next receive
+		switch publish.Message.QOS {
+		case packet.QOSAtLeastOnce:
+			puback := packet.NewPubackPacket()
+			puback.ID = publish.ID
+			w.send(conn, puback)
+		case packet.QOSExactlyOnce:
+			pubrec := packet.NewPubrecPacket()
+			pubrec.ID = publish.ID
+			w.send(conn, pubrec)
+		}
+
+		// reuse the processed packet
+		if r.arena != nil {
+			r.arena.Release(publish)
+		}
+
+		r.addReceived(node, count)
+	}
+}
+
+// a runReceiver measures the messages of a consumer
+type runReceiver struct {
+	run      *run
+	recorder *Latencies
+	limiter  *RateLimiter
+	delay    *Delay
+	next     uint64
+}
+
+// receiver returns the receiver of the consumer of a worker
+func (r *run) receiver(w *runWorker) *runReceiver {
+	c := &runReceiver{
+		run:      r,
+		recorder: new(Latencies),
+	}
+
+	// every consumer records its own latencies to avoid contention
+	r.mutex.Lock()
+	r.latencies = append(r.latencies, c.recorder)
+	r.mutex.Unlock()
+
+	if r.config.ReceiveRate > 0 {
+		c.limiter = NewRateLimiter(r.config.ReceiveRate)
+	}
+
+	// simulate a slow consumer
+	if r.config.ProcessDelay > 0 {
+		seed, _ := strconv.ParseInt(w.id, 10, 64)
+		c.delay = NewDelay(r.config.ProcessDelay, r.config.ProcessJitter, r.start.UnixNano()+seed)
+	}
+
+	return c
+}
+
+// process waits for the receive rate, measures the end to end latency of the
+// messages of a payload and simulates their processing, it returns the number
+// of messages
+func (c *runReceiver) process(payload []byte) int {
+	if c.limiter != nil {
+		c.limiter.Wait()
+	}
+
+	// unpack batched messages
+	messages := [][]byte{payload}
+	if c.run.config.BatchSize > 1 {
+		var err error
+		messages, err = SplitBatch(payload)
+		if err != nil {
+			atomic.AddInt64(&c.run.invalid, 1)
+			c.run.countError()
+		}
+	}
+
+	now := time.Now()
+	for _, message := range messages {
+		header, err := ParseHeader(message)
+		if err == nil {
+			c.recorder.Add(header.Latency(now))
+
+			if header.Seq < c.next {
+				atomic.AddInt64(&c.run.reordered, 1)
+			} else {
+				c.next = header.Seq + 1
+			}
+		}
+	}
+
+	if c.delay != nil {
+		for range messages {
+			atomic.AddInt64(&c.run.processing, int64(c.delay.Sleep()))
+		}
+	}
+
+	return len(messages)
+}
+
+// addReceived counts the processed messages of a consumer
+func (r *run) addReceived(node *Node, count int) {
+	r.recovery.Received()
+	atomic.AddInt64(&r.received, int64(count))
+
+	if node != nil {
+		node.Add("received", float64(count))
+	}
+}
+
+// a runPublisher is the publisher connection of a worker
+type runPublisher struct {
+	run     *run
+	worker  *runWorker
+	name    string
+	index   int
+	conn    transport.Conn
+	node    *Node
+	mutex   *sync.Mutex
+	stream  *runStream
+	publish *packet.PublishPacket
+	due     bool
+}
+
+func (r *run) publisher(w *runWorker) {
+	p, ok := r.connectPublisher(w)
+	if !ok {
+		r.wg.Done()
+		return
+	}
+
+	// multiplex the publisher onto the pool
+	if r.pool != nil {
+		r.pool.schedule(p.step, 0)
+		return
+	}
+
+	defer r.wg.Done()
+
+	for {
+		payload, count, ok := p.stream.next()
+		if !ok {
+			break
+		}
+
+		err := p.send(payload, count)
+		if err != nil && !p.recover(err) {
+			return
+		}
+	}
+
+	p.finish()
+}
+
+// connectPublisher connects the publisher of a worker and waits until it may
+// start publishing
+func (r *run) connectPublisher(w *runWorker) (*runPublisher, bool) {
+	p := &runPublisher{run: r, worker: w, name: "publisher/" + w.id}
+
+	conn, node, err := r.dial(p.name)
+	if err != nil {
+		r.failWith(err)
+		return nil, false
+	}
+
+	index, ok := r.register(&r.publishers, -1, conn)
+	if !ok {
+		return nil, false
+	}
+
+	p.index = index
+	p.attach(conn, node)
+
+	// wait for the subscription to not lose the first messages
+	select {
+	case <-w.subscribed:
+	case <-r.stop:
+		return nil, false
+	}
+
+	r.warm()
+
+	// wait for all workers to start the burst together
+	if r.barrier != nil {
+		r.barrier.Wait()
+	}
+
+	p.stream = r.stream(w)
+	p.publish = packet.NewPublishPacket()
+	p.publish.Message.Topic = w.topic
+	p.publish.Message.QOS = r.config.QOS
+
+	return p, true
+}
+
+// attach configures a new connection of the publisher, the acknowledgements
+// are received and answered concurrently
+func (p *runPublisher) attach(conn transport.Conn, node *Node) {
+	r := p.run
+
+	p.conn = conn
+	p.node = node
+
+	if r.config.WriteDelay > 0 {
+		conn.SetWriteDelay(r.config.WriteDelay)
+	}
+
+	p.mutex = new(sync.Mutex)
+	if r.config.QOS > 0 {
+		r.wg.Add(1)
+		go r.acknowledge(conn, p.mutex)
+	}
+}
+
+// send publishes the payload and counts its messages
+func (p *runPublisher) send(payload []byte, count int) error {
+	r := p.run
+
+	p.publish.Message.Payload = payload
+
+	if p.publish.Message.QOS > 0 {
+		p.publish.ID++
+		if p.publish.ID == 0 {
+			p.publish.ID = 1
+		}
+	}
+
+	p.mutex.Lock()
+	err := p.conn.BufferedSend(p.publish)
+	p.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&r.sent, int64(count))
+
+	if p.node != nil {
+		p.node.Add("sent", float64(count))
+	}
+
+	return nil
+}
+
+// recover reconnects the publisher after a failed send if enabled and returns
+// whether it may continue
+func (p *runPublisher) recover(err error) bool {
+	r := p.run
+
+	if r.stopping() {
+		return false
+	} else if r.config.Reconnect <= 0 {
+		r.failWith(err)
+		return false
+	}
+
+	p.conn.Close()
+
+	conn, node, ok := r.reconnect(p.name)
+	if !ok {
+		return false
+	}
+
+	_, ok = r.register(&r.publishers, p.index, conn)
+	if !ok {
+		return false
+	}
+
+	p.attach(conn, node)
+
+	return true
+}
+
+// finish flushes the remaining messages of a retired worker
+func (p *runPublisher) finish() {
+	if !p.run.stopping() {
+		p.conn.Close()
+	}
+}
+
+// step is the pooled variant of the publish loop, it reserves the next
+// message and sends it once due. Reconnects are made on their own goroutine
+// to not block the pool.
+func (p *runPublisher) step() (time.Duration, bool) {
+	r := p.run
+
+	if r.stopping() || !p.worker.active() {
+		p.finish()
+		r.wg.Done()
+		return 0, false
+	}
+
+	// wait for the reserved message
+	if !p.due {
+		p.due = true
+		if d := p.stream.reserve(); d > 0 {
+			return d, true
+		}
+	}
+
+	p.due = false
+
+	payload, count, ok := p.stream.stamp()
+	if !ok {
+		return 0, true
+	}
+
+	err := p.send(payload, count)
+	if err != nil {
+		go func() {
+			if p.recover(err) {
+				r.pool.schedule(p.step, 0)
+			} else {
+				r.wg.Done()
+			}
+		}()
+
+		return 0, false
+	}
+
+	return 0, true
+}
+
+// a runStream produces the stamped messages of a publisher at the rate and
+// size of the current settings
+type runStream struct {
+	run      *run
+	worker   *runWorker
+	version  int64
+	message  []byte
+	batch    []byte
+	limiter  *RateLimiter
+	schedule *Schedule
+	seq      uint64
+	pending  int
+}
+
+// stream returns the stream of the publisher of a worker
+func (r *run) stream(w *runWorker) *runStream {
+	s := &runStream{run: r, worker: w}
+
+	settings, version := r.control.Settings()
+	s.version = version
+	s.message = NewPayload(settings.Size)
+	s.limiter, s.schedule = r.pacing(w.id, settings.Rate)
+
+	// the batch of concatenated messages
+	if r.config.BatchSize > 1 {
+		s.batch = make([]byte, 0, BatchSize(r.config.BatchSize, len(s.message)))
+	}
+
+	return s
+}
+
+// next waits for the next message or the next full batch and returns the
+// payload and its number of messages, false is returned once the run is
+// stopping or the worker has been retired. The payload is valid until the
+// next call.
+func (s *runStream) next() ([]byte, int, bool) {
+	r := s.run
+
+	for !r.stopping() && s.worker.active() {
+		s.update()
+
+		if s.schedule != nil {
+			s.schedule.Wait()
+		} else if s.limiter != nil {
+			s.limiter.Wait()
+		}
+
+		if r.global != nil {
+			r.global.Wait()
+		}
+
+		if r.stopping() {
+			break
+		}
+
+		payload, count, ok := s.stamp()
+		if ok {
+			return payload, count, true
+		}
+	}
+
+	return nil, 0, false
+}
+
+// reserve takes the next message from the pacing without blocking and
+// returns the time until it is due
+func (s *runStream) reserve() time.Duration {
+	r := s.run
+
+	s.update()
+
+	var d time.Duration
+	if s.schedule != nil {
+		d = s.schedule.Reserve()
+	} else if s.limiter != nil {
+		d = s.limiter.Reserve()
+	}
+
+	if r.global != nil {
+		if g := r.global.Reserve(); g > d {
+			d = g
+		}
+	}
+
+	return d
+}
+
+// update applies changed settings
+func (s *runStream) update() {
+	if v := s.run.control.Version(); v != s.version {
+		var settings Settings
+		settings, s.version = s.run.control.Settings()
+		s.limiter, s.schedule = s.run.pacing(s.worker.id, settings.Rate)
+		s.message = NewPayload(settings.Size)
+	}
+}
+
+// stamp stamps the next message for end to end latency and returns the
+// payload and its number of messages, false is returned while a batch is
+// not full
+func (s *runStream) stamp() ([]byte, int, bool) {
+	size := s.run.config.BatchSize
+
+	PutHeader(s.message, Header{Seq: s.seq, Time: time.Now()})
+	s.seq++
+
+	if size <= 1 {
+		return s.message, 1, true
+	}
+
+	// collect messages until the batch is full
+	s.batch = AppendBatch(s.batch, s.message)
+	s.pending++
+	if s.pending < size {
+		return nil, 0, false
+	}
+
+	batch, count := s.batch, s.pending
+	s.batch, s.pending = s.batch[:0], 0
+
+	return batch, count, true
+}
+
+// acknowledge receives the acknowledgements of a publisher and releases the
+// qos 2 messages until the connection is closed, the mutex serializes the
+// sends with the publisher
+func (r *run) acknowledge(conn transport.Conn, mutex *sync.Mutex) {
+	defer r.wg.Done()
+
+	for {
+		pkt, err := conn.Receive()
+		if err != nil {
+			return
+		}
+
+		switch p := pkt.(type) {
+		case *packet.PubackPacket, *packet.PubcompPacket:
+			atomic.AddInt64(&r.acked, 1)
+		case *packet.PubrecPacket:
+			pubrel := packet.NewPubrelPacket()
+			pubrel.ID = p.ID
+
+			mutex.Lock()
+			conn.Send(pubrel)
+			mutex.Unlock()
+		}
+	}
+}
+
+// pacing returns the limiter or schedule of a publisher, both are nil if the
+// rate is unlimited
+func (r *run) pacing(id string, rate float64) (*RateLimiter, *Schedule) {
+	if rate > 0 && r.config.Jitter != NoJitter {
+		seed, _ := strconv.ParseInt(id, 10, 64)
+		return nil, NewSchedule(rate, r.config.Jitter, r.start.UnixNano()+seed)
+	} else if rate > 0 {
+		limiter := NewRateLimiter(rate)
+
+		r.mutex.Lock()
+		r.limiters = append(r.limiters, limiter)
+		r.mutex.Unlock()
+
+		return limiter, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,240 @@
+package bench
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+)
+
+// ErrInvalidScenario is returned by ParseScenario if a line is not a valid
+// parameter.
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// the flags that may be given on multiple lines of a scenario, every line adds
+// a value that is passed to all runs
+var repeatedParams = map[string]bool{
+	"assert": true,
+	"hook":   true,
+	"sink":   true,
+}
+
+// A Param is a parameter of a scenario with one value or multiple values that
+// are swept. The values of a repeated parameter like "assert" are not swept
+// but all passed to every run.
+type Param struct {
+	Name     string
+	Values   []string
+	Repeated bool
+}
+
+// A Scenario is an ordered list of tool flags. Parameters with multiple
+// values expand into a matrix of runs.
+type Scenario struct {
+	Params []Param
+}
+
+// ParseScenario parses a scenario file with one flag per line in the form
+// "name: value". A value in brackets is a list that is swept, e.g.
+// "payload: [64, 256, 1024]". The repeatable flags "assert", "hook" and
+// "sink" may be given on multiple lines and their values are taken as is.
+// Empty lines and lines starting with "#" are ignored.
+func ParseScenario(r io.Reader) (*Scenario, error) {
+	scenario := &Scenario{}
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		// skip empty lines and comments
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// split name and value
+		i := strings.Index(text, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%w: line %d: missing colon", ErrInvalidScenario, line)
+		}
+
+		name := strings.TrimLeft(strings.TrimSpace(text[:i]), "-")
+		value := strings.TrimSpace(text[i+1:])
+		if name == "" {
+			return nil, fmt.Errorf("%w: line %d: missing name", ErrInvalidScenario, line)
+		} else if repeatedParams[name] {
+			scenario.add(name, value)
+			continue
+		} else if seen[name] {
+			return nil, fmt.Errorf("%w: line %d: duplicate parameter %s", ErrInvalidScenario, line, name)
+		}
+
+		seen[name] = true
+
+		// parse lists
+		values := []string{value}
+		if strings.HasPrefix(value, "[") {
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("%w: line %d: unterminated list", ErrInvalidScenario, line)
+			}
+
+			values = nil
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				item = strings.TrimSpace(item)
+				if item == "" {
+					return nil, fmt.Errorf("%w: line %d: empty list item", ErrInvalidScenario, line)
+				}
+
+				values = append(values, item)
+			}
+		}
+
+		scenario.Params = append(scenario.Params, Param{Name: name, Values: values})
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+// add appends the value of a repeated parameter
+func (s *Scenario) add(name, value string) {
+	for i, param := range s.Params {
+		if param.Name == name {
+			s.Params[i].Values = append(param.Values, value)
+			return
+		}
+	}
+
+	s.Params = append(s.Params, Param{Name: name, Values: []string{value}, Repeated: true})
+}
+
+// Swept returns the names of the parameters with multiple values.
+func (s *Scenario) Swept() []string {
+	var names []string
+	for _, param := range s.Params {
+		if len(param.Values) > 1 && !param.Repeated {
+			names = append(names, param.Name)
+		}
+	}
+
+	return names
+}
+
+// Expand returns the configs of all combinations of the swept values. The
+// first parameter changes slowest and the last parameter fastest. Repeated
+// parameters are not part of the configs.
+func (s *Scenario) Expand() []Config {
+	configs := []Config{{}}
+	for _, param := range s.Params {
+		if param.Repeated {
+			continue
+		}
+
+		next := make([]Config, 0, len(configs)*len(param.Values))
+		for _, config := range configs {
+			for _, value := range param.Values {
+				c := Config{}
+				for k, v := range config {
+					c[k] = v
+				}
+
+				c[param.Name] = value
+				next = append(next, c)
+			}
+		}
+
+		configs = next
+	}
+
+	return configs
+}
+
+// Args returns the config as command line flags in the order of the
+// scenario parameters, e.g. "-payload=64". Every value of a repeated parameter
+// is added as its own flag.
+func (s *Scenario) Args(config Config) []string {
+	args := make([]string, 0, len(s.Params))
+	for _, param := range s.Params {
+		if param.Repeated {
+			for _, value := range param.Values {
+				args = append(args, "-"+param.Name+"="+value)
+			}
+		} else if value, ok := config[param.Name]; ok {
+			args = append(args, "-"+param.Name+"="+value)
+		}
+	}
+
+	return args
+}
+
+// A SweepRun is a single run of a sweep.
+type SweepRun struct {
+	// The values of the swept parameters.
+	Params Config
+
+	// The result of the run and the error if it failed. A run may fail after
+	// writing its result, e.g. if a threshold has been violated.
+	Result *Result
+	Error  error
+}
+
+// WriteSweep will write a table with a row per run that shows the swept
+// parameters and the specified metrics. Every metric is followed by its
+// change relative to the first run with a result.
+func WriteSweep(w io.Writer, params []string, metrics []string, runs []SweepRun) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	// write header
+	header := append([]string{"run"}, params...)
+	for _, metric := range metrics {
+		header = append(header, metric, "change")
+	}
+
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+	// write rows
+	var base *Result
+	for i, run := range runs {
+		row := []string{fmt.Sprintf("%d", i+1)}
+		for _, name := range params {
+			row = append(row, run.Params[name])
+		}
+
+		if run.Result == nil {
+			row = append(row, "error: "+run.Error.Error())
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+			continue
+		}
+
+		if base == nil {
+			base = run.Result
+		}
+
+		for _, metric := range metrics {
+			value, ok := run.Result.Value(metric)
+			if !ok {
+				row = append(row, "-", "-")
+				continue
+			}
+
+			change := "-"
+			if baseValue, ok := base.Value(metric); ok {
+				if c := relativeChange(baseValue, value); !math.IsNaN(c) && !math.IsInf(c, 0) {
+					change = fmt.Sprintf("%+.2f%%", c*100)
+				}
+			}
+
+			row = append(row, fmt.Sprintf("%.6g", value), change)
+		}
+
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,96 @@
+package bench
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScenario(t *testing.T) {
+	scenario, err := ParseScenario(strings.NewReader(`
+# payload sweep
+workers: 10
+-payload: [64, 256, 1024]
+qos: [0,1]
+url: tcp://127.0.0.1:1883
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Param{
+		{Name: "workers", Values: []string{"10"}},
+		{Name: "payload", Values: []string{"64", "256", "1024"}},
+		{Name: "qos", Values: []string{"0", "1"}},
+		{Name: "url", Values: []string{"tcp://127.0.0.1:1883"}},
+	}, scenario.Params)
+	assert.Equal(t, []string{"payload", "qos"}, scenario.Swept())
+
+	configs := scenario.Expand()
+	require.Len(t, configs, 6)
+	assert.Equal(t, Config{"workers": "10", "payload": "64", "qos": "0", "url": "tcp://127.0.0.1:1883"}, configs[0])
+	assert.Equal(t, Config{"workers": "10", "payload": "64", "qos": "1", "url": "tcp://127.0.0.1:1883"}, configs[1])
+	assert.Equal(t, Config{"workers": "10", "payload": "1024", "qos": "1", "url": "tcp://127.0.0.1:1883"}, configs[5])
+
+	assert.Equal(t, []string{"-workers=10", "-payload=64", "-qos=0", "-url=tcp://127.0.0.1:1883"}, scenario.Args(configs[0]))
+}
+
+func TestParseScenarioRepeated(t *testing.T) {
+	scenario, err := ParseScenario(strings.NewReader(`
+payload: [64, 256]
+assert: loss==0
+assert: latency.p99<50ms
+-assert: error_rate<0.1%
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Param{
+		{Name: "payload", Values: []string{"64", "256"}},
+		{Name: "assert", Values: []string{"loss==0", "latency.p99<50ms", "error_rate<0.1%"}, Repeated: true},
+	}, scenario.Params)
+	assert.Equal(t, []string{"payload"}, scenario.Swept())
+
+	configs := scenario.Expand()
+	require.Len(t, configs, 2)
+	assert.Equal(t, Config{"payload": "256"}, configs[1])
+	assert.Equal(t, []string{
+		"-payload=256",
+		"-assert=loss==0",
+		"-assert=latency.p99<50ms",
+		"-assert=error_rate<0.1%",
+	}, scenario.Args(configs[1]))
+}
+
+func TestParseScenarioInvalid(t *testing.T) {
+	for _, str := range []string{
+		"workers",
+		": 10",
+		"workers: 1\nworkers: 2",
+		"payload: [64, 256",
+		"payload: [64, , 256]",
+	} {
+		_, err := ParseScenario(strings.NewReader(str))
+		assert.True(t, errors.Is(err, ErrInvalidScenario), str)
+	}
+}
+
+func TestWriteSweep(t *testing.T) {
+	runs := []SweepRun{
+		{Params: Config{"payload": "64"}, Result: &Result{Metrics: Metrics{"throughput": 1000}}},
+		{Params: Config{"payload": "256"}, Error: errors.New("failed")},
+		{Params: Config{"payload": "1024"}, Result: &Result{Metrics: Metrics{"throughput": 500}}},
+	}
+
+	var buf bytes.Buffer
+	err := WriteSweep(&buf, []string{"payload"}, []string{"throughput", "loss"}, runs)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, []string{"run", "payload", "throughput", "change", "loss", "change"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"1", "64", "1000", "+0.00%", "-", "-"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"2", "256", "error:", "failed"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"3", "1024", "500", "-50.00%", "-", "-"}, strings.Fields(lines[3]))
+}
@@ -0,0 +1,152 @@
+package bench
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrInvalidJitter is returned by ParseJitter if the distribution is unknown.
+var ErrInvalidJitter = errors.New("invalid jitter")
+
+// A Jitter defines the distribution of the intervals between scheduled sends.
+type Jitter int
+
+// The available distributions.
+const (
+	// NoJitter sends at a fixed rate.
+	NoJitter Jitter = iota
+
+	// UniformJitter draws the intervals uniformly between zero and twice the
+	// mean interval.
+	UniformJitter
+
+	// ExponentialJitter draws exponentially distributed intervals, which
+	// models Poisson traffic.
+	ExponentialJitter
+)
+
+// ParseJitter returns the distribution with the specified name.
+func ParseJitter(name string) (Jitter, error) {
+	switch name {
+	case "none":
+		return NoJitter, nil
+	case "uniform":
+		return UniformJitter, nil
+	case "exponential":
+		return ExponentialJitter, nil
+	}
+
+	return 0, ErrInvalidJitter
+}
+
+// String returns the name of the distribution.
+func (j Jitter) String() string {
+	switch j {
+	case NoJitter:
+		return "none"
+	case UniformJitter:
+		return "uniform"
+	case ExponentialJitter:
+		return "exponential"
+	}
+
+	return "unknown"
+}
+
+// draw returns a duration of the distribution with the specified mean
+func (j Jitter) draw(r *rand.Rand, mean time.Duration) time.Duration {
+	switch j {
+	case UniformJitter:
+		return time.Duration(r.Float64() * 2 * float64(mean))
+	case ExponentialJitter:
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+
+	return mean
+}
+
+// A Delay draws artificial delays, e.g. the processing time of a simulated
+// slow consumer. It is not safe for concurrent use.
+type Delay struct {
+	// The mean delay.
+	Mean time.Duration
+
+	// The distribution of the delays.
+	Jitter Jitter
+
+	rand *rand.Rand
+}
+
+// NewDelay returns a new Delay that draws delays using the specified seed.
+func NewDelay(mean time.Duration, jitter Jitter, seed int64) *Delay {
+	return &Delay{
+		Mean:   mean,
+		Jitter: jitter,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Next returns the next delay drawn from the distribution.
+func (d *Delay) Next() time.Duration {
+	return d.Jitter.draw(d.rand, d.Mean)
+}
+
+// Sleep will block for the next delay and return it.
+func (d *Delay) Sleep() time.Duration {
+	delay := d.Next()
+	time.Sleep(delay)
+	return delay
+}
+
+// A Schedule paces sends at a mean rate using the intervals of a jitter
+// distribution. It is not safe for concurrent use.
+type Schedule struct {
+	// The mean number of sends per second.
+	Rate float64
+
+	// The distribution of the intervals.
+	Jitter Jitter
+
+	rand *rand.Rand
+	next time.Time
+}
+
+// NewSchedule returns a new Schedule that draws intervals using the specified
+// seed.
+func NewSchedule(rate float64, jitter Jitter, seed int64) *Schedule {
+	return &Schedule{
+		Rate:   rate,
+		Jitter: jitter,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Interval returns the next interval drawn from the distribution.
+func (s *Schedule) Interval() time.Duration {
+	return s.Jitter.draw(s.rand, time.Duration(float64(time.Second)/s.Rate))
+}
+
+// Wait will block until the next send is due. The send times are computed
+// from the first call to Wait, so that slow sends do not lower the rate.
+func (s *Schedule) Wait() {
+	if d := s.Reserve(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Reserve will take the next send without blocking and return the time until
+// it is due, which is negative if the send is late.
+func (s *Schedule) Reserve() time.Duration {
+	now := time.Now()
+
+	// start schedule
+	if s.next.IsZero() {
+		s.next = now
+	}
+
+	d := s.next.Sub(now)
+	s.next = s.next.Add(s.Interval())
+
+	return d
+}
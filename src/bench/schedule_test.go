@@ -0,0 +1,86 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJitter(t *testing.T) {
+	for _, jitter := range []Jitter{NoJitter, UniformJitter, ExponentialJitter} {
+		parsed, err := ParseJitter(jitter.String())
+		assert.NoError(t, err)
+		assert.Equal(t, jitter, parsed)
+	}
+
+	_, err := ParseJitter("foo")
+	assert.Equal(t, ErrInvalidJitter, err)
+}
+
+func TestScheduleInterval(t *testing.T) {
+	schedule := NewSchedule(100, NoJitter, 1)
+	assert.Equal(t, 10*time.Millisecond, schedule.Interval())
+
+	for _, jitter := range []Jitter{UniformJitter, ExponentialJitter} {
+		schedule = NewSchedule(100, jitter, 1)
+
+		var sum time.Duration
+		var varies bool
+		for i := 0; i < 10000; i++ {
+			interval := schedule.Interval()
+			assert.True(t, interval >= 0)
+
+			if interval != 10*time.Millisecond {
+				varies = true
+			}
+
+			sum += interval
+		}
+
+		assert.True(t, varies, jitter.String())
+		assert.InDelta(t, 0.01, (sum / 10000).Seconds(), 0.001, jitter.String())
+	}
+}
+
+func TestScheduleWait(t *testing.T) {
+	schedule := NewSchedule(100, NoJitter, 1)
+
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		schedule.Wait()
+	}
+
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestScheduleReserve(t *testing.T) {
+	schedule := NewSchedule(100, NoJitter, 1)
+
+	assert.True(t, schedule.Reserve() <= 0)
+	assert.InDelta(t, 10*time.Millisecond, schedule.Reserve(), float64(time.Millisecond))
+	assert.InDelta(t, 20*time.Millisecond, schedule.Reserve(), float64(time.Millisecond))
+}
+
+func TestDelay(t *testing.T) {
+	delay := NewDelay(5*time.Millisecond, NoJitter, 1)
+	assert.Equal(t, 5*time.Millisecond, delay.Next())
+
+	for _, jitter := range []Jitter{UniformJitter, ExponentialJitter} {
+		delay = NewDelay(5*time.Millisecond, jitter, 1)
+
+		var sum time.Duration
+		for i := 0; i < 10000; i++ {
+			d := delay.Next()
+			assert.True(t, d >= 0)
+			sum += d
+		}
+
+		assert.InDelta(t, 0.005, (sum / 10000).Seconds(), 0.0005, jitter.String())
+	}
+
+	start := time.Now()
+	slept := NewDelay(10*time.Millisecond, NoJitter, 1).Sleep()
+	assert.Equal(t, 10*time.Millisecond, slept)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
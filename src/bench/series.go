@@ -0,0 +1,103 @@
+package bench
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An Interval holds the metrics observed during a part of a run.
+type Interval struct {
+	// The offset of the end of the interval from the start of the run and
+	// the length of the interval in seconds.
+	Offset float64 `json:"offset"`
+	Length float64 `json:"length"`
+
+	// The metrics observed during the interval.
+	Metrics Metrics `json:"metrics"`
+}
+
+// A Window accumulates the operations, errors and latencies of the current
+// interval until it is flushed. It is safe for concurrent use.
+type Window struct {
+	operations int64
+	errors     int64
+
+	start     time.Time
+	last      time.Time
+	latencies *Latencies
+	mutex     sync.Mutex
+}
+
+// NewWindow returns a new Window for a run that started at the specified
+// time.
+func NewWindow(start time.Time) *Window {
+	return &Window{
+		start:     start,
+		last:      start,
+		latencies: &Latencies{},
+	}
+}
+
+// Observe will record a completed operation and its latency.
+func (w *Window) Observe(d time.Duration) {
+	atomic.AddInt64(&w.operations, 1)
+
+	w.mutex.Lock()
+	latencies := w.latencies
+	w.mutex.Unlock()
+
+	latencies.Add(d)
+}
+
+// Add will record completed operations without a latency.
+func (w *Window) Add(n int64) {
+	atomic.AddInt64(&w.operations, n)
+}
+
+// Fail will record a failed operation.
+func (w *Window) Fail() {
+	atomic.AddInt64(&w.errors, 1)
+}
+
+// Flush will return the metrics of the interval that ended at the specified
+// time and start a new interval. The metrics include the throughput, the
+// number of errors, the error rate and the latency percentiles if latencies
+// have been observed.
+func (w *Window) Flush(now time.Time) Interval {
+	w.mutex.Lock()
+	latencies := w.latencies
+	w.latencies = &Latencies{}
+	length := now.Sub(w.last).Seconds()
+	w.last = now
+	w.mutex.Unlock()
+
+	operations := atomic.SwapInt64(&w.operations, 0)
+	errors := atomic.SwapInt64(&w.errors, 0)
+
+	metrics := Metrics{
+		"errors":     float64(errors),
+		"error_rate": 0,
+		"throughput": 0,
+	}
+
+	if operations+errors > 0 {
+		metrics["error_rate"] = float64(errors) / float64(operations+errors)
+	}
+
+	if length > 0 {
+		metrics["throughput"] = float64(operations) / length
+	}
+
+	if latencies.Len() > 0 {
+		for name, value := range latencies.Metrics("latency.") {
+			metrics[name] = value
+		}
+	}
+
+	return Interval{
+		Offset:  now.Sub(w.start).Seconds(),
+		Length:  length,
+		Metrics: metrics,
+	}
+}
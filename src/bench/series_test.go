@@ -0,0 +1,49 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow(t *testing.T) {
+	start := time.Now()
+	window := NewWindow(start)
+
+	window.Observe(10 * time.Millisecond)
+	window.Observe(20 * time.Millisecond)
+	window.Add(2)
+	window.Fail()
+
+	interval := window.Flush(start.Add(2 * time.Second))
+	assert.Equal(t, 2.0, interval.Offset)
+	assert.Equal(t, 2.0, interval.Length)
+	assert.Equal(t, Metrics{
+		"errors":      1,
+		"error_rate":  0.2,
+		"throughput":  2,
+		"latency.p50": 0.01,
+		"latency.p90": 0.02,
+		"latency.p99": 0.02,
+		"latency.max": 0.02,
+	}, interval.Metrics)
+
+	interval = window.Flush(start.Add(3 * time.Second))
+	assert.Equal(t, 3.0, interval.Offset)
+	assert.Equal(t, 1.0, interval.Length)
+	assert.Equal(t, Metrics{
+		"errors":     0,
+		"error_rate": 0,
+		"throughput": 0,
+	}, interval.Metrics)
+}
+
+func TestResultSeries(t *testing.T) {
+	result := NewResult("test")
+	result.AddInterval(Interval{Offset: 1, Length: 1, Metrics: Metrics{"throughput": 10}})
+	result.AddInterval(Interval{Offset: 2, Length: 1, Metrics: Metrics{"throughput": 20}})
+
+	assert.Len(t, result.Series, 2)
+	assert.Equal(t, 20.0, result.Series[1].Metrics["throughput"])
+}
@@ -0,0 +1,351 @@
+package bench
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCPUSet is returned by ParseCPUSet if a CPU list is malformed.
+var ErrInvalidCPUSet = errors.New("invalid cpu set")
+
+// ErrInvalidShard is returned by ParseShard if the shard is not of the form
+// "index/count".
+var ErrInvalidShard = errors.New("invalid shard")
+
+// ErrPinningUnsupported is returned when starting a pinned shard on a
+// platform without CPU affinity support.
+var ErrPinningUnsupported = errors.New("cpu pinning is not supported on this platform")
+
+var percentileRegexp = regexp.MustCompile(`(^|\.)(p[0-9]+|max|high_water)$`)
+
+// the number of logical CPUs that can be pinned
+const maxCPUs = 1024
+
+// A CPUSet is a sorted list of logical CPUs.
+type CPUSet []int
+
+// ParseCPUSet parses a CPU list in the format of taskset and cpusets like
+// "0-3,8,10-11". CPUs are limited to the 1024 that can be pinned.
+func ParseCPUSet(spec string) (CPUSet, error) {
+	seen := map[int]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, ErrInvalidCPUSet
+		}
+
+		first, last := item, item
+		if i := strings.Index(item, "-"); i >= 0 {
+			first, last = item[:i], item[i+1:]
+		}
+
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, ErrInvalidCPUSet
+		}
+
+		to, err := strconv.Atoi(last)
+		if err != nil || to < from || to >= maxCPUs {
+			return nil, ErrInvalidCPUSet
+		}
+
+		for cpu := from; cpu <= to; cpu++ {
+			seen[cpu] = true
+		}
+	}
+
+	set := make(CPUSet, 0, len(seen))
+	for cpu := range seen {
+		set = append(set, cpu)
+	}
+
+	sort.Ints(set)
+
+	return set, nil
+}
+
+// ParseCPUSets parses CPU lists separated by slashes like "0-3/4-7", one for
+// every shard.
+func ParseCPUSets(spec string) ([]CPUSet, error) {
+	var sets []CPUSet
+	for _, item := range strings.Split(spec, "/") {
+		set, err := ParseCPUSet(item)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// String returns the set in the form accepted by ParseCPUSet with
+// consecutive CPUs collapsed to ranges.
+func (s CPUSet) String() string {
+	var parts []string
+	for i := 0; i < len(s); i++ {
+		j := i
+		for j+1 < len(s) && s[j+1] == s[j]+1 {
+			j++
+		}
+
+		if i == j {
+			parts = append(parts, strconv.Itoa(s[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(s[i])+"-"+strconv.Itoa(s[j]))
+		}
+
+		i = j
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// ParseShard parses a shard like "1/4" into its zero based index and the
+// number of shards.
+func ParseShard(spec string) (int, int, error) {
+	i := strings.Index(spec, "/")
+	if i < 0 {
+		return 0, 0, ErrInvalidShard
+	}
+
+	index, err := strconv.Atoi(spec[:i])
+	if err != nil {
+		return 0, 0, ErrInvalidShard
+	}
+
+	count, err := strconv.Atoi(spec[i+1:])
+	if err != nil || index < 0 || index >= count {
+		return 0, 0, ErrInvalidShard
+	}
+
+	return index, count, nil
+}
+
+// ShardWorkers returns the offset of the first worker and the number of
+// workers of the specified shard. The remainder is spread across the first
+// shards so that the counts differ by at most one.
+func ShardWorkers(workers, index, count int) (int, int) {
+	size := workers / count
+	rest := workers % count
+
+	offset := index*size + rest
+	if index < rest {
+		offset = index * (size + 1)
+		size++
+	}
+
+	return offset, size
+}
+
+// ShardRate returns the part of a rate across all workers that the specified
+// shard paces, which is proportional to its share of the workers.
+func ShardRate(rate float64, workers, index, count int) float64 {
+	if workers <= 0 {
+		return rate / float64(count)
+	}
+
+	_, n := ShardWorkers(workers, index, count)
+
+	return rate * float64(n) / float64(workers)
+}
+
+// A Shard is a child process that runs a part of the workers of a run. The
+// main process starts the shards with the same flags, waits for them and
+// merges the results they have written.
+type Shard struct {
+	// The zero based index of the shard.
+	Index int
+
+	// The CPUs the process is pinned to, the process is not pinned if empty.
+	CPUs CPUSet
+
+	// The GOMAXPROCS of the process, the number of pinned CPUs is used if
+	// zero and the set is not empty.
+	Procs int
+
+	// The file the shard writes its result to.
+	Out string
+
+	cmd *exec.Cmd
+}
+
+// Start will start the command with the specified arguments. The standard
+// output and error are shared with the current process.
+func (s *Shard) Start(command string, args []string) error {
+	procs := s.Procs
+	if procs == 0 {
+		procs = len(s.CPUs)
+	}
+
+	s.cmd = exec.Command(command, args...)
+	s.cmd.Stdout = os.Stdout
+	s.cmd.Stderr = os.Stderr
+	s.cmd.Env = os.Environ()
+	if procs > 0 {
+		s.cmd.Env = append(s.cmd.Env, "GOMAXPROCS="+strconv.Itoa(procs))
+	}
+
+	if len(s.CPUs) == 0 {
+		return s.cmd.Start()
+	}
+
+	return startPinned(s.cmd, s.CPUs)
+}
+
+// Signal will send the signal to the process, e.g. to finish the run early.
+func (s *Shard) Signal(sig os.Signal) error {
+	return s.cmd.Process.Signal(sig)
+}
+
+// Wait will wait for the process to exit and read the result it wrote. A
+// shard that fails after writing its result returns both.
+func (s *Shard) Wait() (*Result, error) {
+	runErr := s.cmd.Wait()
+
+	result, err := ReadResult(s.Out)
+	if err != nil {
+		if runErr != nil {
+			return nil, runErr
+		}
+
+		return nil, err
+	}
+
+	return result, runErr
+}
+
+// MergeResults combines the results of the shards of a run into a single
+// result. Percentiles and maxima are merged to the largest value of any shard
+// which is an upper bound of the true value. Means and ratios are averaged,
+// the error rate weighted by the sent messages of every shard, the loss is
+// recomputed from the sent and received messages and all other metrics are
+// summed. Samples and series are merged per index the same way.
+func MergeResults(name string, results []*Result) *Result {
+	merged := NewResult(name)
+	if len(results) == 0 {
+		return merged
+	}
+
+	merged.Start = results[0].Start
+	merged.Config = results[0].Config
+	merged.Fingerprint = results[0].Fingerprint
+
+	var metrics []Metrics
+	for _, result := range results {
+		if result.Start.Before(merged.Start) {
+			merged.Start = result.Start
+		}
+
+		if result.Duration > merged.Duration {
+			merged.Duration = result.Duration
+		}
+
+		metrics = append(metrics, result.Metrics)
+
+		// sum samples per index
+		for metric, samples := range result.Samples {
+			sum := merged.Samples[metric]
+			for i, value := range samples {
+				if i < len(sum) {
+					sum[i] += value
+				} else {
+					sum = append(sum, value)
+				}
+			}
+
+			merged.Samples[metric] = sum
+		}
+
+		merged.Profiles = append(merged.Profiles, result.Profiles...)
+	}
+
+	merged.Metrics = mergeMetrics(metrics)
+
+	// merge series per index
+	for i := 0; ; i++ {
+		var interval *Interval
+		var intervals []Metrics
+		for _, result := range results {
+			if i < len(result.Series) {
+				if interval == nil {
+					interval = &Interval{
+						Offset: result.Series[i].Offset,
+						Length: result.Series[i].Length,
+					}
+				}
+
+				intervals = append(intervals, result.Series[i].Metrics)
+			}
+		}
+
+		if interval == nil {
+			break
+		}
+
+		interval.Metrics = mergeMetrics(intervals)
+		merged.Series = append(merged.Series, *interval)
+	}
+
+	return merged
+}
+
+// mergeMetrics combines the metrics of multiple shards
+func mergeMetrics(list []Metrics) Metrics {
+	merged := Metrics{}
+	counts := map[string]int{}
+
+	var errorRate, errorWeight float64
+	for _, metrics := range list {
+		if rate, ok := metrics["error_rate"]; ok {
+			errorRate += rate * metrics["sent"]
+			errorWeight += metrics["sent"]
+		}
+
+		for name, value := range metrics {
+			_, ok := merged[name]
+			counts[name]++
+
+			switch {
+			case percentileRegexp.MatchString(name):
+				if !ok || value > merged[name] {
+					merged[name] = value
+				}
+			case isRatio(name):
+				merged[name] += (value - merged[name]) / float64(counts[name])
+			default:
+				merged[name] += value
+			}
+		}
+	}
+
+	// weight the error rate by the sent messages, the mean is kept if no
+	// shard reported them
+	if errorWeight > 0 {
+		merged["error_rate"] = errorRate / errorWeight
+	}
+
+	// recompute the loss
+	if _, ok := merged["loss"]; ok {
+		merged["loss"] = 0
+		if sent := merged["sent"]; sent > 0 && merged["received"] < sent {
+			merged["loss"] = (sent - merged["received"]) / sent
+		}
+	}
+
+	return merged
+}
+
+// isRatio returns whether the metric is a mean or a ratio that cannot be
+// summed across shards
+func isRatio(name string) bool {
+	return strings.HasSuffix(name, ".mean") || strings.HasSuffix(name, "_rate") ||
+		strings.HasSuffix(name, "_per_read") || strings.HasPrefix(name, "overhead.") ||
+		strings.HasPrefix(name, "imbalance.")
+}
@@ -0,0 +1,135 @@
+package bench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUSet(t *testing.T) {
+	set, err := ParseCPUSet("8,0-3, 10-11,2")
+	assert.NoError(t, err)
+	assert.Equal(t, CPUSet{0, 1, 2, 3, 8, 10, 11}, set)
+	assert.Equal(t, "0-3,8,10-11", set.String())
+
+	set, err = ParseCPUSet("1020-1023")
+	assert.NoError(t, err)
+	assert.Len(t, set, 4)
+
+	for _, str := range []string{"", "a", "1-", "3-1", "-1", "1,,2", "1024", "0-9223372036854775807"} {
+		_, err := ParseCPUSet(str)
+		assert.Equal(t, ErrInvalidCPUSet, err, str)
+	}
+}
+
+func TestParseCPUSets(t *testing.T) {
+	sets, err := ParseCPUSets("0-3/4-7")
+	assert.NoError(t, err)
+	assert.Equal(t, []CPUSet{{0, 1, 2, 3}, {4, 5, 6, 7}}, sets)
+
+	_, err = ParseCPUSets("0-3/")
+	assert.Equal(t, ErrInvalidCPUSet, err)
+}
+
+func TestParseShard(t *testing.T) {
+	index, count, err := ParseShard("1/4")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, index)
+	assert.Equal(t, 4, count)
+
+	for _, str := range []string{"", "1", "4/4", "-1/4", "a/4", "1/a"} {
+		_, _, err := ParseShard(str)
+		assert.Equal(t, ErrInvalidShard, err, str)
+	}
+}
+
+func TestShardWorkers(t *testing.T) {
+	next := 0
+	for i, size := range []int{4, 4, 3, 3} {
+		offset, n := ShardWorkers(14, i, 4)
+		assert.Equal(t, next, offset)
+		assert.Equal(t, size, n)
+		next += n
+	}
+}
+
+func TestShardRate(t *testing.T) {
+	sum := 0.0
+	for i, rate := range []float64{400, 400, 300, 300} {
+		assert.Equal(t, rate, ShardRate(1400, 14, i, 4))
+		sum += rate
+	}
+
+	assert.Equal(t, 1400.0, sum)
+	assert.Equal(t, 250.0, ShardRate(1000, 0, 0, 4))
+}
+
+func TestShard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shard")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "result.json")
+	assert.NoError(t, WriteResult(out, &Result{Name: "test", Metrics: Metrics{"sent": 1}}))
+
+	shard := &Shard{CPUs: CPUSet{0}, Out: out}
+	err = shard.Start("sh", []string{"-c", "exit 0"})
+	if err == ErrPinningUnsupported {
+		t.Skip(err)
+	}
+
+	assert.NoError(t, err)
+
+	result, err := shard.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, Metrics{"sent": 1}, result.Metrics)
+}
+
+func TestMergeResults(t *testing.T) {
+	a := NewResult("test")
+	a.Duration = 10
+	a.Metrics = Metrics{"sent": 100, "received": 90, "loss": 0.1, "latency.p99": 0.02, "read.packets_per_read": 2}
+	a.Samples["throughput"] = []float64{10, 20}
+	a.Series = []Interval{{Offset: 1, Length: 1, Metrics: Metrics{"operations": 10}}}
+
+	b := NewResult("test")
+	b.Duration = 11
+	b.Metrics = Metrics{"sent": 100, "received": 100, "loss": 0, "latency.p99": 0.01, "read.packets_per_read": 4}
+	b.Samples["throughput"] = []float64{5, 5, 5}
+	b.Series = []Interval{{Offset: 1, Length: 1, Metrics: Metrics{"operations": 5}}, {Offset: 2, Length: 1, Metrics: Metrics{"operations": 5}}}
+
+	merged := MergeResults("test", []*Result{a, b})
+	assert.Equal(t, 11.0, merged.Duration)
+	assert.Equal(t, Metrics{
+		"sent":                  200,
+		"received":              190,
+		"loss":                  0.05,
+		"latency.p99":           0.02,
+		"read.packets_per_read": 3,
+	}, merged.Metrics)
+	assert.Equal(t, []float64{15, 25, 5}, merged.Samples["throughput"])
+	assert.Equal(t, []Interval{
+		{Offset: 1, Length: 1, Metrics: Metrics{"operations": 15}},
+		{Offset: 2, Length: 1, Metrics: Metrics{"operations": 5}},
+	}, merged.Series)
+}
+
+func TestMergeResultsErrorRate(t *testing.T) {
+	a := NewResult("test")
+	a.Metrics = Metrics{"sent": 900, "error_rate": 0}
+	a.Series = []Interval{{Metrics: Metrics{"error_rate": 0.2}}}
+
+	b := NewResult("test")
+	b.Metrics = Metrics{"sent": 100, "error_rate": 0.5}
+	b.Series = []Interval{{Metrics: Metrics{"error_rate": 0.4}}}
+
+	// the busy shard outweighs the failing one
+	merged := MergeResults("test", []*Result{a, b})
+	assert.InDelta(t, 0.05, merged.Metrics["error_rate"], 1e-9)
+
+	// intervals without sent messages are averaged
+	assert.InDelta(t, 0.3, merged.Series[0].Metrics["error_rate"], 1e-9)
+}
@@ -0,0 +1,188 @@
+package bench
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSinkError(t *testing.T) {
+	_, err := OpenSink("foo://bar")
+	assert.Equal(t, ErrInvalidSink, err)
+
+	_, err = OpenSink("influx://localhost:8086")
+	assert.Equal(t, ErrInvalidSink, err)
+
+	_, err = OpenSink("sqlite3:///tmp/results.db")
+	assert.Equal(t, ErrInvalidSink, err)
+
+	_, err = OpenSink("postgres://localhost/bench")
+	assert.True(t, errors.Is(err, ErrInvalidSink))
+}
+
+func TestInfluxSink(t *testing.T) {
+	var query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		query, body = r.URL.RawQuery, string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := OpenSink("influx://user:pass@" + strings.TrimPrefix(server.URL, "http://") + "/bench")
+	require.NoError(t, err)
+
+	result := &Result{Name: "pubsub1max", Start: time.Unix(0, 1)}
+	err = sink.Write(result, time.Unix(0, 5), Metrics{
+		"throughput":    1000,
+		"node.a b.sent": 2.5,
+		"latency.p99":   0.012,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "db=bench&p=pass&precision=ns&u=user", query)
+	assert.Equal(t, "pubsub1max,run=1 latency.p99=0.012,node.a\\ b.sent=2.5,throughput=1000 5\n", body)
+
+	assert.NoError(t, sink.Close())
+}
+
+func TestInfluxSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sink, err := OpenSink("influx://" + strings.TrimPrefix(server.URL, "http://") + "/bench")
+	require.NoError(t, err)
+
+	err = sink.Write(NewResult("test"), time.Now(), Metrics{"loss": 0})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "database not found")
+}
+
+func TestSinksFlag(t *testing.T) {
+	var sinks Sinks
+	assert.Error(t, sinks.Set("foo://bar"))
+
+	assert.NoError(t, sinks.Set("influx://localhost:8086/bench"))
+	assert.Equal(t, "1", sinks.String())
+	assert.NoError(t, sinks.Write(NewResult("test"), time.Now(), nil))
+	assert.NoError(t, sinks.Close())
+}
+
+// sqlDriver is a database/sql driver that records the executed statements
+type sqlDriver struct {
+	dsn   string
+	execs []string
+	args  [][]driver.Value
+}
+
+func (d *sqlDriver) Open(dsn string) (driver.Conn, error) {
+	d.dsn = dsn
+	return &sqlConn{d}, nil
+}
+
+type sqlConn struct {
+	driver *sqlDriver
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlStmt{c.driver, query}, nil
+}
+
+func (c *sqlConn) Close() error              { return nil }
+func (c *sqlConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *sqlConn) Commit() error             { return nil }
+func (c *sqlConn) Rollback() error           { return nil }
+
+type sqlStmt struct {
+	driver *sqlDriver
+	query  string
+}
+
+func (s *sqlStmt) Close() error  { return nil }
+func (s *sqlStmt) NumInput() int { return -1 }
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.execs = append(s.driver.execs, strings.Fields(s.query)[0])
+	s.driver.args = append(s.driver.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var testDriver = &sqlDriver{}
+
+func init() {
+	sql.Register("sqlite", testDriver)
+}
+
+func TestSQLSinkURL(t *testing.T) {
+	_, err := OpenSink("sqlite://")
+	assert.Equal(t, ErrInvalidSink, err)
+
+	sink, err := OpenSink("sqlite:///tmp/results.db?_journal=WAL")
+	require.NoError(t, err)
+
+	result := &Result{Name: "pubsub1max", Start: time.Unix(0, 1)}
+	assert.NoError(t, sink.Write(result, time.Unix(0, 5), Metrics{"throughput": 1000}))
+	assert.NoError(t, sink.Close())
+
+	assert.Equal(t, "/tmp/results.db?_journal=WAL", testDriver.dsn)
+	assert.Equal(t, []string{"CREATE", "INSERT"}, testDriver.execs)
+	assert.Equal(t, []driver.Value{"pubsub1max", "1", time.Unix(0, 5).UTC(), "throughput", 1000.0}, testDriver.args[1])
+}
+
+// blockingSink blocks every write until it is released
+type blockingSink struct {
+	release chan struct{}
+	mutex   sync.Mutex
+	writes  []float64
+}
+
+func (s *blockingSink) Write(result *Result, at time.Time, metrics Metrics) error {
+	<-s.release
+
+	s.mutex.Lock()
+	s.writes = append(s.writes, metrics["sent"])
+	s.mutex.Unlock()
+
+	return errors.New("failed")
+}
+
+func (s *blockingSink) Close() error {
+	return nil
+}
+
+func TestSinkWriter(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+
+	var errs []error
+	writer := NewSinkWriter(Sinks{sink}, 1, func(err error) {
+		errs = append(errs, err)
+	})
+
+	// the first write is taken by the goroutine, the second is buffered and
+	// the third is dropped without blocking
+	result := NewResult("test")
+	assert.NoError(t, writer.Write(result, time.Now(), Metrics{"sent": 1}))
+	assert.Eventually(t, func() bool { return len(writer.points) == 0 }, time.Second, time.Millisecond)
+	assert.NoError(t, writer.Write(result, time.Now(), Metrics{"sent": 2}))
+	assert.Equal(t, ErrSinkBufferFull, writer.Write(result, time.Now(), Metrics{"sent": 3}))
+
+	close(sink.release)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, []float64{1, 2}, sink.writes)
+	assert.Len(t, errs, 2)
+}
@@ -0,0 +1,200 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidThreshold is returned by ParseThreshold if the threshold does not
+// have the form "metric operator value".
+var ErrInvalidThreshold = errors.New("invalid threshold")
+
+// ErrThresholdsViolated is returned by Finish if a threshold has been
+// violated.
+var ErrThresholdsViolated = errors.New("thresholds violated")
+
+var thresholdRegexp = regexp.MustCompile(`^\s*([a-zA-Z0-9_.]+)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+// A Threshold is an acceptance criterion that is checked against the metrics
+// of a finished run, e.g. "loss==0", "error_rate<0.1%" or "latency.p99<50ms".
+type Threshold struct {
+	// The name of the checked metric.
+	Metric string
+
+	// The comparison operator.
+	Operator string
+
+	// The value the metric is compared to.
+	Value float64
+
+	raw string
+}
+
+// ParseThreshold parses a threshold. Values may be plain numbers, percentages
+// which are converted to fractions ("0.1%" is 0.001) or durations which are
+// converted to seconds ("50ms" is 0.05).
+func ParseThreshold(str string) (*Threshold, error) {
+	// match threshold
+	match := thresholdRegexp.FindStringSubmatch(str)
+	if match == nil {
+		return nil, ErrInvalidThreshold
+	}
+
+	// parse value
+	value, err := parseValue(match[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Threshold{
+		Metric:   match[1],
+		Operator: match[2],
+		Value:    value,
+		raw:      strings.TrimSpace(str),
+	}, nil
+}
+
+func parseValue(str string) (float64, error) {
+	// parse percentage
+	if strings.HasSuffix(str, "%") {
+		value, err := strconv.ParseFloat(strings.TrimSuffix(str, "%"), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return value / 100, nil
+	}
+
+	// parse number
+	value, err := strconv.ParseFloat(str, 64)
+	if err == nil {
+		return value, nil
+	}
+
+	// parse duration
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold value %q", str)
+	}
+
+	return duration.Seconds(), nil
+}
+
+// String returns the threshold as it has been parsed.
+func (t *Threshold) String() string {
+	return t.raw
+}
+
+// Check compares the metric against the threshold value and returns an error
+// if the threshold is violated or the metric is not available.
+func (t *Threshold) Check(metrics Metrics) error {
+	// get value
+	value, ok := metrics[t.Metric]
+	if !ok {
+		return fmt.Errorf("%s: unknown metric %q", t.raw, t.Metric)
+	}
+
+	// compare value
+	var pass bool
+	switch t.Operator {
+	case "<":
+		pass = value < t.Value
+	case "<=":
+		pass = value <= t.Value
+	case ">":
+		pass = value > t.Value
+	case ">=":
+		pass = value >= t.Value
+	case "==":
+		pass = value == t.Value
+	case "!=":
+		pass = value != t.Value
+	}
+
+	if !pass {
+		return fmt.Errorf("%s: violated with %s=%g", t.raw, t.Metric, value)
+	}
+
+	return nil
+}
+
+// Thresholds is a list of thresholds that implements flag.Value, so that it
+// can be filled using a repeated command line flag.
+type Thresholds []*Threshold
+
+// String returns a comma separated list of the thresholds.
+func (t *Thresholds) String() string {
+	list := make([]string, 0, len(*t))
+	for _, threshold := range *t {
+		list = append(list, threshold.String())
+	}
+
+	return strings.Join(list, ",")
+}
+
+// Set parses and adds a threshold.
+func (t *Thresholds) Set(str string) error {
+	threshold, err := ParseThreshold(str)
+	if err != nil {
+		return err
+	}
+
+	*t = append(*t, threshold)
+
+	return nil
+}
+
+// Check checks all thresholds and returns the violations.
+func (t Thresholds) Check(metrics Metrics) []error {
+	var errs []error
+	for _, threshold := range t {
+		err := threshold.Check(metrics)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Finish completes the result of a tool. It writes the result as JSON to the
+// path unless it is empty, prints every violated threshold as a "FAIL:" line
+// or "PASS" if thresholds are set, and returns ErrThresholdsViolated if one
+// has been violated, so that the tool can exit with a non-zero status. The
+// duration is measured from the start of the result if it is not set. A
+// failure to write the result is printed but not returned.
+func Finish(path string, result *Result, thresholds Thresholds) error {
+	if result.Duration == 0 {
+		result.Duration = time.Since(result.Start).Seconds()
+	}
+
+	// write result
+	if path != "" {
+		err := WriteResult(path, result)
+		if err != nil {
+			fmt.Println("Failed to write result:", err)
+		}
+	}
+
+	if len(thresholds) == 0 {
+		return nil
+	}
+
+	// check thresholds
+	errs := thresholds.Check(result.Metrics)
+	for _, err := range errs {
+		fmt.Println("FAIL:", err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrThresholdsViolated, len(errs), len(thresholds))
+	}
+
+	fmt.Println("PASS")
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package bench
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThreshold(t *testing.T) {
+	matrix := map[string]Threshold{
+		"loss==0":         {Metric: "loss", Operator: "==", Value: 0},
+		"errors<0.1%":     {Metric: "errors", Operator: "<", Value: 0.001},
+		"p99 < 50ms":      {Metric: "p99", Operator: "<", Value: 0.05},
+		"throughput>=1e3": {Metric: "throughput", Operator: ">=", Value: 1000},
+	}
+
+	for str, expected := range matrix {
+		threshold, err := ParseThreshold(str)
+		assert.NoError(t, err, str)
+		assert.Equal(t, expected.Metric, threshold.Metric, str)
+		assert.Equal(t, expected.Operator, threshold.Operator, str)
+		assert.InDelta(t, expected.Value, threshold.Value, 1e-9, str)
+		assert.Equal(t, str, threshold.String())
+	}
+}
+
+func TestParseThresholdError(t *testing.T) {
+	_, err := ParseThreshold("loss")
+	assert.Equal(t, ErrInvalidThreshold, err)
+
+	_, err = ParseThreshold("loss=0")
+	assert.Equal(t, ErrInvalidThreshold, err)
+
+	_, err = ParseThreshold("loss<foo")
+	assert.Error(t, err)
+}
+
+func TestThresholdCheck(t *testing.T) {
+	metrics := Metrics{
+		"loss": 0,
+		"p99":  0.07,
+	}
+
+	threshold, _ := ParseThreshold("loss==0")
+	assert.NoError(t, threshold.Check(metrics))
+
+	threshold, _ = ParseThreshold("p99<50ms")
+	assert.Error(t, threshold.Check(metrics))
+
+	threshold, _ = ParseThreshold("p99<=70ms")
+	assert.NoError(t, threshold.Check(metrics))
+
+	threshold, _ = ParseThreshold("errors<1%")
+	assert.Error(t, threshold.Check(metrics))
+}
+
+func TestThresholdsFlag(t *testing.T) {
+	var thresholds Thresholds
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&thresholds, "assert", "")
+
+	err := fs.Parse([]string{"-assert", "loss==0", "-assert", "throughput>100"})
+	assert.NoError(t, err)
+	assert.Len(t, thresholds, 2)
+	assert.Equal(t, "loss==0,throughput>100", thresholds.String())
+
+	errs := thresholds.Check(Metrics{"loss": 0, "throughput": 50})
+	assert.Len(t, errs, 1)
+
+	err = fs.Parse([]string{"-assert", "foo"})
+	assert.Error(t, err)
+}
+
+func TestFinish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "finish")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var thresholds Thresholds
+	require.NoError(t, thresholds.Set("loss==0"))
+	require.NoError(t, thresholds.Set("latency.p99<50ms"))
+
+	result := NewResult("test")
+	result.Metrics = Metrics{"loss": 0, "latency.p99": 0.01}
+
+	path := filepath.Join(dir, "result.json")
+	assert.NoError(t, Finish(path, result, thresholds))
+	assert.True(t, result.Duration > 0)
+
+	written, err := ReadResult(path)
+	require.NoError(t, err)
+	assert.Equal(t, result.Metrics, written.Metrics)
+
+	result.Metrics["loss"] = 0.1
+	err = Finish("", result, thresholds)
+	assert.True(t, errors.Is(err, ErrThresholdsViolated))
+	assert.EqualError(t, err, "thresholds violated: 1 of 2")
+
+	assert.NoError(t, Finish("", result, nil))
+}
@@ -0,0 +1,70 @@
+package bench
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// A TopicTree describes a synthetic topic hierarchy with a fixed depth where
+// every level has the same number of segments.
+type TopicTree struct {
+	// The first segment of all topics.
+	Prefix string
+
+	// The number of levels below the prefix.
+	Depth int
+
+	// The number of segments on every level.
+	Fanout int
+
+	// The probabilities of a filter level being a single-level (+) or a
+	// multi-level (#) wildcard. The multi-level wildcard is never used for
+	// the first level below the prefix.
+	SingleWildcard float64
+	MultiWildcard  float64
+}
+
+// NewTopicTree returns a new TopicTree with sensible wildcard probabilities.
+func NewTopicTree(prefix string, depth, fanout int) *TopicTree {
+	return &TopicTree{
+		Prefix:         prefix,
+		Depth:          depth,
+		Fanout:         fanout,
+		SingleWildcard: 0.3,
+		MultiWildcard:  0.1,
+	}
+}
+
+// Topic returns a random leaf topic of the tree.
+func (t *TopicTree) Topic(r *rand.Rand) string {
+	segments := []string{t.Prefix}
+	for i := 0; i < t.Depth; i++ {
+		segments = append(segments, strconv.Itoa(r.Intn(t.Fanout)))
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// Filter returns a random filter that matches leaf topics of the tree. Filters
+// generated from the same tree overlap through their wildcards.
+func (t *TopicTree) Filter(r *rand.Rand) string {
+	segments := []string{t.Prefix}
+	for i := 0; i < t.Depth; i++ {
+		p := r.Float64()
+
+		// end filter with a multi-level wildcard
+		if i > 0 && p < t.MultiWildcard {
+			segments = append(segments, "#")
+			break
+		}
+
+		if p < t.MultiWildcard+t.SingleWildcard {
+			segments = append(segments, "+")
+		} else {
+			segments = append(segments, strconv.Itoa(r.Intn(t.Fanout)))
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
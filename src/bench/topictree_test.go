@@ -0,0 +1,58 @@
+package bench
+
+import (
+	"math/rand"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"topic"
+)
+
+func TestTopicTreeTopic(t *testing.T) {
+	tree := NewTopicTree("bench", 3, 4)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100; i++ {
+		assert.Regexp(t, regexp.MustCompile(`^bench/[0-3]/[0-3]/[0-3]$`), tree.Topic(r))
+	}
+}
+
+func TestTopicTreeFilter(t *testing.T) {
+	tree := NewTopicTree("bench", 4, 3)
+	r := rand.New(rand.NewSource(1))
+
+	wildcards := 0
+	for i := 0; i < 1000; i++ {
+		filter := tree.Filter(r)
+
+		_, err := topic.Parse(filter, true)
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^bench/[0-2+](/[0-2+])*(/#)?$`), filter)
+
+		if topic.ContainsWildcards(filter) {
+			wildcards++
+		}
+	}
+
+	assert.True(t, wildcards > 500)
+}
+
+func TestTopicTreeFilterMatches(t *testing.T) {
+	tree := NewTopicTree("bench", 3, 2)
+	tree.SingleWildcard = 0
+	tree.MultiWildcard = 0
+	r := rand.New(rand.NewSource(1))
+
+	matches := topic.NewTree()
+	matches.Add(tree.Filter(r), 1)
+
+	found := false
+	for i := 0; i < 100; i++ {
+		if len(matches.Match(tree.Topic(r))) > 0 {
+			found = true
+		}
+	}
+
+	assert.True(t, found)
+}
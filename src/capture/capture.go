@@ -0,0 +1,39 @@
+// Package capture implements reading MQTT traffic from pcap files and the
+// line based recording format used to replay traffic against a broker.
+package capture
+
+import (
+	"packet"
+)
+
+// DecodeStream decodes all complete packets in buf and calls fn with the
+// offset, the decoded packet and its raw bytes. It returns the number of bytes
+// consumed. Incomplete trailing data is left unconsumed.
+func DecodeStream(buf []byte, fn func(int, packet.GenericPacket, []byte)) (int, error) {
+	total := 0
+
+	for total < len(buf) {
+		// detect packet
+		l, t := packet.DetectPacket(buf[total:])
+		if l == 0 || total+l > len(buf) {
+			return total, nil
+		}
+
+		// create packet
+		pkt, err := t.New()
+		if err != nil {
+			return total, err
+		}
+
+		// decode packet
+		_, err = pkt.Decode(buf[total : total+l])
+		if err != nil {
+			return total, err
+		}
+
+		fn(total, pkt, buf[total:total+l])
+		total += l
+	}
+
+	return total, nil
+}
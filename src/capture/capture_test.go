@@ -0,0 +1,60 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+func encode(t *testing.T, pkts ...packet.GenericPacket) []byte {
+	var buf []byte
+
+	for _, pkt := range pkts {
+		data := make([]byte, pkt.Len())
+		_, err := pkt.Encode(data)
+		assert.NoError(t, err)
+
+		buf = append(buf, data...)
+	}
+
+	return buf
+}
+
+func TestDecodeStream(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	data := encode(t, packet.NewPingreqPacket(), publish)
+
+	var offsets []int
+	var types []packet.Type
+
+	n, err := DecodeStream(data[:len(data)-1], func(offset int, pkt packet.GenericPacket, raw []byte) {
+		offsets = append(offsets, offset)
+		types = append(types, pkt.Type())
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int{0}, offsets)
+	assert.Equal(t, []packet.Type{packet.PINGREQ}, types)
+
+	n, err = DecodeStream(data, func(offset int, pkt packet.GenericPacket, raw []byte) {
+		offsets = append(offsets, offset)
+		types = append(types, pkt.Type())
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, []int{0, 0, 2}, offsets)
+	assert.Equal(t, []packet.Type{packet.PINGREQ, packet.PINGREQ, packet.PUBLISH}, types)
+}
+
+func TestDecodeStreamError(t *testing.T) {
+	data := encode(t, packet.NewPingreqPacket())
+	data = append(data, 0x62, 0) // pubrel with invalid remaining length
+
+	n, err := DecodeStream(data, func(int, packet.GenericPacket, []byte) {})
+	assert.Error(t, err)
+	assert.Equal(t, 2, n)
+}
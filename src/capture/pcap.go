@@ -0,0 +1,298 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"packet"
+)
+
+// ErrPcapTooShort is returned by PcapReader.Read if the data does not contain
+// a complete global header.
+var ErrPcapTooShort = errors.New("pcap: file too short")
+
+// ErrPcapUnknownMagic is returned by PcapReader.Read if the data is not a
+// classic pcap file. The pcapng format is not supported.
+var ErrPcapUnknownMagic = errors.New("pcap: unknown magic number (pcapng is not supported)")
+
+// ErrPcapTruncated is returned by PcapReader.Read if a record exceeds the
+// available data.
+var ErrPcapTruncated = errors.New("pcap: truncated record")
+
+// The supported pcap link types.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+)
+
+// A Packet is a MQTT packet that has been decoded from a captured stream.
+type Packet struct {
+	// The capture time of the segment that completed the packet.
+	Time time.Time
+
+	// The endpoints of the stream.
+	Src *net.TCPAddr
+	Dst *net.TCPAddr
+
+	// The decoded packet and its raw bytes.
+	Packet packet.GenericPacket
+	Raw    []byte
+}
+
+// Stream returns a description of the stream like "10.0.0.1:5000 > 10.0.0.2:1883".
+func (p *Packet) Stream() string {
+	return p.Src.String() + " > " + p.Dst.String()
+}
+
+// A PcapReader reassembles the TCP streams in a pcap capture and decodes the
+// MQTT packets they carry.
+type PcapReader struct {
+	// The broker port used to select streams. Zero selects all streams.
+	Port int
+
+	// Gap is called with the stream and the amount of missing bytes if a
+	// segment has not been captured. The stream is resynced afterwards.
+	Gap func(ts time.Time, stream string, missing int)
+
+	// Error is called if a stream contains data that cannot be decoded. The
+	// buffered data of the stream is discarded afterwards.
+	Error func(ts time.Time, stream string, err error)
+}
+
+// NewPcapReader returns a new PcapReader that selects streams of the
+// specified broker port.
+func NewPcapReader(port int) *PcapReader {
+	return &PcapReader{
+		Port: port,
+	}
+}
+
+type tcpStream struct {
+	buffer  []byte
+	nextSeq uint32
+	synced  bool
+}
+
+// Read will decode the pcap data and call fn for every complete packet in the
+// order they have been captured.
+func (r *PcapReader) Read(data []byte, fn func(*Packet)) error {
+	// check global header
+	if len(data) < 24 {
+		return ErrPcapTooShort
+	}
+
+	// detect byte order and timestamp resolution
+	var order binary.ByteOrder
+	var nano bool
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	default:
+		switch binary.BigEndian.Uint32(data) {
+		case 0xa1b2c3d4:
+			order = binary.BigEndian
+		case 0xa1b23c4d:
+			order, nano = binary.BigEndian, true
+		default:
+			return ErrPcapUnknownMagic
+		}
+	}
+
+	link := order.Uint32(data[20:])
+	streams := make(map[string]*tcpStream)
+
+	for off := 24; off+16 <= len(data); {
+		// read record header
+		sec := int64(order.Uint32(data[off:]))
+		frac := int64(order.Uint32(data[off+4:]))
+		incl := int(order.Uint32(data[off+8:]))
+		off += 16
+
+		if off+incl > len(data) {
+			return ErrPcapTruncated
+		}
+
+		frame := data[off : off+incl]
+		off += incl
+
+		// get timestamp
+		if !nano {
+			frac *= 1000
+		}
+		ts := time.Unix(sec, frac)
+
+		// unwrap link layer
+		ip, ok := unwrapLink(link, frame)
+		if !ok {
+			continue
+		}
+
+		// unwrap ip and tcp
+		src, dst, seq, syn, payload, ok := unwrapTCP(ip)
+		if !ok {
+			continue
+		}
+
+		// filter by port
+		if r.Port != 0 && src.Port != r.Port && dst.Port != r.Port {
+			continue
+		}
+
+		key := src.String() + " > " + dst.String()
+		stream, ok := streams[key]
+		if !ok {
+			stream = &tcpStream{}
+			streams[key] = stream
+		}
+
+		// handle handshake
+		if syn {
+			stream.buffer = nil
+			stream.nextSeq = seq + 1
+			stream.synced = true
+			continue
+		}
+
+		// sync on first data segment if the handshake was not captured
+		if !stream.synced {
+			stream.nextSeq = seq
+			stream.synced = true
+		}
+
+		// drop retransmitted data and resync on gaps
+		diff := int32(seq - stream.nextSeq)
+		if diff < 0 {
+			if int(-diff) >= len(payload) {
+				continue
+			}
+			payload = payload[-diff:]
+			seq = stream.nextSeq
+		} else if diff > 0 {
+			if r.Gap != nil {
+				r.Gap(ts, key, int(diff))
+			}
+			stream.buffer = nil
+		}
+
+		stream.nextSeq = seq + uint32(len(payload))
+		stream.buffer = append(stream.buffer, payload...)
+
+		// decode complete packets
+		n, err := DecodeStream(stream.buffer, func(_ int, pkt packet.GenericPacket, raw []byte) {
+			fn(&Packet{
+				Time:   ts,
+				Src:    src,
+				Dst:    dst,
+				Packet: pkt,
+				Raw:    raw,
+			})
+		})
+		if err != nil {
+			if r.Error != nil {
+				r.Error(ts, key, err)
+			}
+			stream.buffer = nil
+			continue
+		}
+
+		stream.buffer = stream.buffer[n:]
+	}
+
+	return nil
+}
+
+func unwrapLink(link uint32, frame []byte) ([]byte, bool) {
+	switch link {
+	case linkNull:
+		if len(frame) < 4 {
+			return nil, false
+		}
+
+		return frame[4:], true
+	case linkEthernet:
+		if len(frame) < 14 {
+			return nil, false
+		}
+
+		// skip vlan tags
+		etherType := binary.BigEndian.Uint16(frame[12:])
+		frame = frame[14:]
+		for etherType == 0x8100 && len(frame) >= 4 {
+			etherType = binary.BigEndian.Uint16(frame[2:])
+			frame = frame[4:]
+		}
+
+		return frame, etherType == 0x0800 || etherType == 0x86dd
+	case linkRaw:
+		return frame, true
+	case linkLinuxSLL:
+		if len(frame) < 16 {
+			return nil, false
+		}
+
+		return frame[16:], true
+	}
+
+	return nil, false
+}
+
+func unwrapTCP(ip []byte) (*net.TCPAddr, *net.TCPAddr, uint32, bool, []byte, bool) {
+	if len(ip) < 1 {
+		return nil, nil, 0, false, nil, false
+	}
+
+	var srcIP, dstIP net.IP
+	var segment []byte
+
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 || ip[9] != 6 {
+			return nil, nil, 0, false, nil, false
+		}
+
+		hl := int(ip[0]&0x0f) * 4
+		tl := int(binary.BigEndian.Uint16(ip[2:]))
+		if tl > len(ip) || hl > tl {
+			return nil, nil, 0, false, nil, false
+		}
+
+		srcIP, dstIP = net.IP(ip[12:16]), net.IP(ip[16:20])
+		segment = ip[hl:tl]
+	case 6:
+		if len(ip) < 40 || ip[6] != 6 {
+			return nil, nil, 0, false, nil, false
+		}
+
+		pl := int(binary.BigEndian.Uint16(ip[4:]))
+		if 40+pl > len(ip) {
+			return nil, nil, 0, false, nil, false
+		}
+
+		srcIP, dstIP = net.IP(ip[8:24]), net.IP(ip[24:40])
+		segment = ip[40 : 40+pl]
+	default:
+		return nil, nil, 0, false, nil, false
+	}
+
+	if len(segment) < 20 {
+		return nil, nil, 0, false, nil, false
+	}
+
+	dataOffset := int(segment[12]>>4) * 4
+	if dataOffset > len(segment) {
+		return nil, nil, 0, false, nil, false
+	}
+
+	src := &net.TCPAddr{IP: srcIP, Port: int(binary.BigEndian.Uint16(segment[0:]))}
+	dst := &net.TCPAddr{IP: dstIP, Port: int(binary.BigEndian.Uint16(segment[2:]))}
+	seq := binary.BigEndian.Uint32(segment[4:])
+	syn := segment[13]&0x02 != 0
+
+	return src, dst, seq, syn, segment[dataOffset:], true
+}
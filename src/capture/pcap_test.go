@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+type testSegment struct {
+	sec     uint32
+	srcPort uint16
+	dstPort uint16
+	seq     uint32
+	syn     bool
+	payload []byte
+}
+
+func testPcap(segments ...testSegment) []byte {
+	// global header (little endian, microseconds, ethernet)
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint32(data, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(data[4:], 2)
+	binary.LittleEndian.PutUint16(data[6:], 4)
+	binary.LittleEndian.PutUint32(data[16:], 65535)
+	binary.LittleEndian.PutUint32(data[20:], linkEthernet)
+
+	for _, s := range segments {
+		// tcp header
+		tcp := make([]byte, 20)
+		binary.BigEndian.PutUint16(tcp, s.srcPort)
+		binary.BigEndian.PutUint16(tcp[2:], s.dstPort)
+		binary.BigEndian.PutUint32(tcp[4:], s.seq)
+		tcp[12] = 5 << 4
+		if s.syn {
+			tcp[13] = 0x02
+		}
+		tcp = append(tcp, s.payload...)
+
+		// ip header
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		ip[9] = 6
+		copy(ip[12:], []byte{10, 0, 0, 1})
+		copy(ip[16:], []byte{10, 0, 0, 2})
+		ip = append(ip, tcp...)
+
+		// ethernet header
+		frame := make([]byte, 14)
+		binary.BigEndian.PutUint16(frame[12:], 0x0800)
+		frame = append(frame, ip...)
+
+		// record header
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, s.sec)
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+
+		data = append(data, record...)
+		data = append(data, frame...)
+	}
+
+	return data
+}
+
+func TestPcapReader(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	data := encode(t, packet.NewPingreqPacket(), publish)
+
+	capture := testPcap(
+		testSegment{sec: 1, srcPort: 5000, dstPort: 1883, seq: 99, syn: true},
+		testSegment{sec: 2, srcPort: 5000, dstPort: 1883, seq: 100, payload: data[:5]},
+		testSegment{sec: 3, srcPort: 5000, dstPort: 1883, seq: 100, payload: data[:5]},
+		testSegment{sec: 4, srcPort: 5000, dstPort: 1883, seq: 103, payload: data[3:]},
+		testSegment{sec: 5, srcPort: 6000, dstPort: 7000, seq: 1, payload: data},
+	)
+
+	var pkts []*Packet
+
+	reader := NewPcapReader(1883)
+	err := reader.Read(capture, func(pkt *Packet) {
+		pkts = append(pkts, pkt)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, pkts, 2)
+
+	assert.Equal(t, packet.PINGREQ, pkts[0].Packet.Type())
+	assert.Equal(t, time.Unix(2, 0), pkts[0].Time)
+	assert.Equal(t, "10.0.0.1:5000 > 10.0.0.2:1883", pkts[0].Stream())
+
+	assert.Equal(t, publish.String(), pkts[1].Packet.String())
+	assert.Equal(t, time.Unix(4, 0), pkts[1].Time)
+	assert.Equal(t, data[2:], pkts[1].Raw)
+}
+
+func TestPcapReaderGap(t *testing.T) {
+	data := encode(t, packet.NewPingreqPacket(), packet.NewPingreqPacket())
+
+	capture := testPcap(
+		testSegment{sec: 1, srcPort: 5000, dstPort: 1883, seq: 100, payload: data[:1]},
+		testSegment{sec: 2, srcPort: 5000, dstPort: 1883, seq: 102, payload: data[2:]},
+	)
+
+	var missing int
+	var pkts []*Packet
+
+	reader := NewPcapReader(0)
+	reader.Gap = func(ts time.Time, stream string, n int) {
+		missing = n
+	}
+	err := reader.Read(capture, func(pkt *Packet) {
+		pkts = append(pkts, pkt)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, missing)
+	assert.Len(t, pkts, 1)
+}
+
+func TestPcapReaderErrors(t *testing.T) {
+	reader := NewPcapReader(0)
+
+	err := reader.Read(make([]byte, 10), func(*Packet) {})
+	assert.Equal(t, ErrPcapTooShort, err)
+
+	err = reader.Read(make([]byte, 24), func(*Packet) {})
+	assert.Equal(t, ErrPcapUnknownMagic, err)
+
+	capture := testPcap(testSegment{sec: 1, srcPort: 5000, dstPort: 1883, seq: 1, payload: []byte{0xc0, 0}})
+	err = reader.Read(capture[:len(capture)-1], func(*Packet) {})
+	assert.Equal(t, ErrPcapTruncated, err)
+}
@@ -0,0 +1,152 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"packet"
+)
+
+// An Entry is a single recorded message. A recording is a stream of entries
+// encoded as one JSON object per line.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source,omitempty"`
+	Topic   string    `json:"topic"`
+	Payload []byte    `json:"payload"`
+	QOS     uint8     `json:"qos"`
+	Retain  bool      `json:"retain,omitempty"`
+}
+
+// NewEntry returns a new Entry for the specified message.
+func NewEntry(ts time.Time, source string, msg *packet.Message) *Entry {
+	return &Entry{
+		Time:    ts,
+		Source:  source,
+		Topic:   msg.Topic,
+		Payload: msg.Payload,
+		QOS:     msg.QOS,
+		Retain:  msg.Retain,
+	}
+}
+
+// Message returns the message described by the entry.
+func (e *Entry) Message() *packet.Message {
+	return &packet.Message{
+		Topic:   e.Topic,
+		Payload: e.Payload,
+		QOS:     e.QOS,
+		Retain:  e.Retain,
+	}
+}
+
+// PublishEntry returns an Entry if the captured packet is a PublishPacket sent
+// to the broker listening on the specified port. A port of zero accepts
+// publishes in both directions.
+func PublishEntry(pkt *Packet, port int) (*Entry, bool) {
+	publish, ok := pkt.Packet.(*packet.PublishPacket)
+	if !ok || publish.Dup {
+		return nil, false
+	}
+
+	if port != 0 && pkt.Dst.Port != port {
+		return nil, false
+	}
+
+	return NewEntry(pkt.Time, pkt.Src.String(), &publish.Message), true
+}
+
+// A Recorder writes entries to a recording. It is safe for concurrent use.
+type Recorder struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecorder returns a new Recorder that writes to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Record will write an entry for the specified message using the current time.
+func (r *Recorder) Record(source string, msg *packet.Message) error {
+	return r.Write(NewEntry(time.Now(), source, msg))
+}
+
+// Write will write the specified entry.
+func (r *Recorder) Write(entry *Entry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.encoder.Encode(entry)
+}
+
+// ReadRecording will read all entries from the specified recording. Empty
+// lines are ignored.
+func ReadRecording(reader io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), int(packet.MaxRemainingLength)*2)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		// skip empty lines
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := &Entry{}
+		err := json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Replay will call fn for every entry at the time offset it has been recorded
+// at relative to the first entry, divided by speed. A speed of zero or less
+// replays all entries as fast as possible. Replay stops and returns the first
+// error returned by fn.
+func Replay(entries []*Entry, speed float64, fn func(*Entry) error) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	first := entries[0].Time
+	start := time.Now()
+
+	for _, entry := range entries {
+		// wait for scheduled time
+		if speed > 0 {
+			offset := time.Duration(float64(entry.Time.Sub(first)) / speed)
+			wait := offset - time.Since(start)
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		err := fn(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+func TestRecording(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	msg := &packet.Message{
+		Topic:   "test",
+		Payload: []byte{0, 1, 2},
+		QOS:     1,
+		Retain:  true,
+	}
+
+	recorder := NewRecorder(buf)
+
+	err := recorder.Write(NewEntry(time.Unix(1, 0), "foo", msg))
+	assert.NoError(t, err)
+
+	err = recorder.Record("", msg)
+	assert.NoError(t, err)
+
+	buf.WriteString("\n")
+
+	entries, err := ReadRecording(buf)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.True(t, entries[0].Time.Equal(time.Unix(1, 0)))
+	assert.Equal(t, "foo", entries[0].Source)
+	assert.Equal(t, msg, entries[0].Message())
+	assert.Equal(t, "", entries[1].Source)
+	assert.Equal(t, msg, entries[1].Message())
+}
+
+func TestReadRecordingError(t *testing.T) {
+	_, err := ReadRecording(bytes.NewBufferString("{}\nfoo\n"))
+	assert.EqualError(t, err, "line 2: invalid character 'o' in literal false (expecting 'a')")
+}
+
+func TestPublishEntry(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+
+	client := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	broker := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1883}
+
+	entry, ok := PublishEntry(&Packet{Src: client, Dst: broker, Packet: publish}, 1883)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1:5000", entry.Source)
+	assert.Equal(t, "test", entry.Topic)
+
+	_, ok = PublishEntry(&Packet{Src: broker, Dst: client, Packet: publish}, 1883)
+	assert.False(t, ok)
+
+	_, ok = PublishEntry(&Packet{Src: client, Dst: broker, Packet: packet.NewPingreqPacket()}, 1883)
+	assert.False(t, ok)
+}
+
+func TestReplay(t *testing.T) {
+	entries := []*Entry{
+		{Time: time.Unix(10, 0)},
+		{Time: time.Unix(10, int64(100*time.Millisecond))},
+		{Time: time.Unix(10, int64(200*time.Millisecond))},
+	}
+
+	start := time.Now()
+	var offsets []time.Duration
+
+	err := Replay(entries, 2, func(*Entry) error {
+		offsets = append(offsets, time.Since(start))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, offsets, 3)
+	assert.True(t, offsets[1] >= 50*time.Millisecond)
+	assert.True(t, offsets[2] >= 100*time.Millisecond)
+	assert.True(t, offsets[2] < 200*time.Millisecond)
+
+	start = time.Now()
+	err = Replay(entries, 0, func(*Entry) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	count := 0
+	err = Replay(entries, 0, func(*Entry) error {
+		count++
+		return errors.New("foo")
+	})
+	assert.EqualError(t, err, "foo")
+	assert.Equal(t, 1, count)
+}
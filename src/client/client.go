@@ -12,6 +12,7 @@ import (
 
 	"client/future"
 	"clientsession"
+	"clock"
 	"gopkg.in/tomb.v2"
 	"packet"
 	"transport"
@@ -29,10 +30,27 @@ var ErrClientNotConnected = errors.New("client not connected")
 // the config while requesting to resume a session.
 var ErrClientMissingID = errors.New("client missing id")
 
-// ErrClientConnectionDenied is returned in the Callback if the connection has
-// been reject by the broker.
+// ErrClientConnectionDenied is matched by the ConnectionDeniedError returned in
+// the Callback if the connection has been reject by the broker.
 var ErrClientConnectionDenied = errors.New("client connection denied")
 
+// A ConnectionDeniedError is returned in the Callback if the connection has
+// been rejected by the broker. It carries the return code sent by the broker
+// and can be matched against ErrClientConnectionDenied using errors.Is.
+type ConnectionDeniedError struct {
+	ReturnCode packet.ConnackCode
+}
+
+// Error returns the error string including the reason of the broker.
+func (e *ConnectionDeniedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrClientConnectionDenied.Error(), e.ReturnCode.Error())
+}
+
+// Unwrap returns ErrClientConnectionDenied.
+func (e *ConnectionDeniedError) Unwrap() error {
+	return ErrClientConnectionDenied
+}
+
 // ErrClientMissingPong is returned in the Callback if the broker did not respond
 // in time to a PingreqPacket.
 var ErrClientMissingPong = errors.New("client missing pong")
@@ -112,18 +130,48 @@ type Client struct {
 	// encountering an error while processing incoming packets.
 	Callback Callback
 
+	// The hooks that are called on connects, disconnects, acknowledged
+	// publishes and incoming messages.
+	Hooks Hooks
+
 	// The logger that is used to log low level information about packets
 	// that have been successfully sent and received and details about the
 	// automatic keep alive handler.
 	Logger Logger
 
+	// The tracer that is used to create spans for connection attempts,
+	// outgoing publishes until their acknowledgment and incoming publishes
+	// until they have been acknowledged.
+	Tracer Tracer
+
+	// The heartbeat that schedules the automatic keep alive pings. The
+	// DefaultHeartbeat is used if not set.
+	Heartbeat *Heartbeat
+
+	// The clock used to track the keep alive window. The system clock is used
+	// if not set. A mocked clock must also be used by the Heartbeat.
+	Clock clock.Clock
+
 	clean bool
 
 	keepAlive     time.Duration
 	tracker       *tracker
+	beat          *beat
+	beatMutex     sync.Mutex
 	futureStore   *future.Store
 	connectFuture *future.Future
 
+	queue      chan *queuedPublish
+	queued     *queuedStore
+	queueStats QueueStats
+
+	deliveries *deliveryTracker
+
+	connectSpan  Span
+	spanMutex    sync.Mutex
+	publishSpans *spanStore
+	deliverSpans *spanStore
+
 	tomb   tomb.Tomb
 	mutex  sync.Mutex
 	finish sync.Once
@@ -132,9 +180,13 @@ type Client struct {
 // New returns a new client that by default uses a fresh MemorySession.
 func New() *Client {
 	return &Client{
-		state:       clientInitialized,
-		Session:     clientsession.NewMemorySession(),
-		futureStore: future.NewStore(),
+		state:        clientInitialized,
+		Session:      clientsession.NewMemorySession(),
+		futureStore:  future.NewStore(),
+		queued:       newQueuedStore(),
+		publishSpans: newSpanStore(),
+		deliverSpans: newSpanStore(),
+		deliveries:   newDeliveryTracker(),
 	}
 }
 
@@ -176,17 +228,29 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 
 	// allocate and initialize tracker
 	c.keepAlive = keepAlive
-	c.tracker = newTracker(keepAlive)
+	c.tracker = newTracker(keepAlive, c.clock())
+
+	// start connect span
+	c.spanMutex.Lock()
+	c.connectSpan = c.startSpan(ConnectSpan, Attributes{
+		"messaging.system":             "mqtt",
+		"messaging.client_id":          config.ClientID,
+		"messaging.mqtt.clean_session": config.CleanSession,
+		"net.peer.name":                urlParts.Host,
+	})
+	c.spanMutex.Unlock()
 
 	// dial broker (with custom dialer if present)
 	if config.Dialer != nil {
 		c.conn, err = config.Dialer.Dial(config.BrokerURL)
 		if err != nil {
+			c.endConnectSpan(err)
 			return nil, err
 		}
 	} else {
 		c.conn, err = transport.Dial(config.BrokerURL)
 		if err != nil {
+			c.endConnectSpan(err)
 			return nil, err
 		}
 	}
@@ -220,6 +284,11 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 		connect.Password, _ = urlParts.User.Password()
 	}
 
+	if config.Username != "" {
+		connect.Username = config.Username
+		connect.Password = config.Password
+	}
+
 	// set will
 	connect.Will = config.WillMessage
 
@@ -235,6 +304,12 @@ func (c *Client) Connect(config *Config) (ConnectFuture, error) {
 	// start process routine
 	c.tomb.Go(c.processor)
 
+	// start send routine if a queue is configured
+	if config.SendQueueSize > 0 {
+		c.queue = make(chan *queuedPublish, config.SendQueueSize)
+		c.tomb.Go(c.sender)
+	}
+
 	// wrap future
 	wrappedFuture := &connectFuture{c.connectFuture}
 
@@ -260,10 +335,10 @@ func (c *Client) Publish(topic string, payload []byte, qos uint8, retain bool) (
 // has been completed.
 func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
 
 	// check if connected
 	if atomic.LoadUint32(&c.state) != clientConnected {
+		c.mutex.Unlock()
 		return nil, ErrClientNotConnected
 	}
 
@@ -276,30 +351,70 @@ func (c *Client) PublishMessage(msg *packet.Message) (GenericFuture, error) {
 		publish.ID = c.Session.NextID()
 	}
 
-	// create future
+	// create future and start span
 	publishFuture := future.New()
+	span := c.startSpan(PublishSpan, messageAttributes(msg))
+	if span != nil {
+		span.SetAttribute("messaging.message_id", int(publish.ID))
+	}
 
-	// store future
-	c.futureStore.Put(publish.ID, publishFuture)
+	// store future and span by packet id if at least qos 1, qos 0 packets
+	// have no id and are tracked by their queued item instead
+	item := &queuedPublish{publish: publish, future: publishFuture}
+	if msg.QOS > 0 {
+		c.futureStore.Put(publish.ID, publishFuture)
+		if span != nil {
+			c.publishSpans.put(publish.ID, span)
+		}
+	} else {
+		item.span = span
+	}
 
 	// store packet if at least qos 1
 	if msg.QOS > 0 {
 		err := c.Session.SavePacket(clientsession.Outgoing, publish)
 		if err != nil {
-			return nil, c.cleanup(err, true, false)
+			err = c.cleanup(err, true, false)
+			c.mutex.Unlock()
+			return nil, err
+		}
+	}
+
+	// enqueue packet if a send queue is configured, the lock is released
+	// first as the queue may block until there is space
+	if c.queue != nil {
+		if msg.QOS == 0 {
+			c.queued.put(item)
+		}
+
+		c.mutex.Unlock()
+
+		err := c.enqueue(item)
+		if err != nil {
+			return nil, err
 		}
+
+		return publishFuture, nil
 	}
 
+	defer c.mutex.Unlock()
+
 	// send packet
 	err := c.send(publish, true)
 	if err != nil {
+		if item.span != nil {
+			item.span.End(err)
+		}
+
 		return nil, c.cleanup(err, false, false)
 	}
 
-	// complete and remove qos 0 future
+	// complete qos 0 future and span
 	if msg.QOS == 0 {
 		publishFuture.Complete()
-		c.futureStore.Delete(publish.ID)
+		if item.span != nil {
+			item.span.End(nil)
+		}
 	}
 
 	return publishFuture, nil
@@ -333,6 +448,7 @@ func (c *Client) SubscribeMultiple(subscriptions []packet.Subscription) (Subscri
 
 	// create future
 	subFuture := future.New()
+	subFuture.Data.Store(sentKey, c.clock().Now())
 
 	// store future
 	c.futureStore.Put(subscribe.ID, subFuture)
@@ -375,6 +491,7 @@ func (c *Client) UnsubscribeMultiple(topics []string) (GenericFuture, error) {
 
 	// create future
 	unsubscribeFuture := future.New()
+	unsubscribeFuture.Data.Store(sentKey, c.clock().Now())
 
 	// store future
 	c.futureStore.Put(unsubscribe.ID, unsubscribeFuture)
@@ -404,7 +521,9 @@ func (c *Client) Disconnect(timeout ...time.Duration) error {
 
 	// finish current packets
 	if len(timeout) > 0 {
+		deadline := time.Now().Add(timeout[0])
 		c.futureStore.Await(timeout[0])
+		c.queued.await(time.Until(deadline))
 	}
 
 	// set state
@@ -438,7 +557,7 @@ func (c *Client) processor() error {
 
 	// start keep alive if greater than zero
 	if c.keepAlive > 0 {
-		c.tomb.Go(c.pinger)
+		c.startPinger()
 	}
 
 	for {
@@ -474,6 +593,11 @@ func (c *Client) processor() error {
 			continue
 		}
 
+		// discard packets lost by fault injection
+		if c.Hooks.dropIncoming(pkt) {
+			continue
+		}
+
 		// call handlers for packet types and ignore other packets
 		switch typedPkt := pkt.(type) {
 		case *packet.SubackPacket:
@@ -515,9 +639,17 @@ func (c *Client) processConnack(connack *packet.ConnackPacket) error {
 	c.connectFuture.Data.Store(sessionPresentKey, connack.SessionPresent)
 	c.connectFuture.Data.Store(returnCodeKey, connack.ReturnCode)
 
+	// annotate connect span
+	c.annotateConnectSpan(Attributes{
+		"messaging.mqtt.session_present": connack.SessionPresent,
+		"messaging.mqtt.return_code":     int(connack.ReturnCode),
+	})
+
 	// return connection denied error and close connection if not accepted
 	if connack.ReturnCode != packet.ConnectionAccepted {
-		err := c.die(ErrClientConnectionDenied, true, false)
+		deniedErr := &ConnectionDeniedError{ReturnCode: connack.ReturnCode}
+		c.endConnectSpan(deniedErr)
+		err := c.die(deniedErr, true, false)
 		c.connectFuture.Cancel()
 		return err
 	}
@@ -525,9 +657,15 @@ func (c *Client) processConnack(connack *packet.ConnackPacket) error {
 	// set state to connected
 	atomic.StoreUint32(&c.state, clientConnected)
 
+	// end connect span
+	c.endConnectSpan(nil)
+
 	// complete future
 	c.connectFuture.Complete()
 
+	// call hook
+	c.Hooks.connect(connack.SessionPresent)
+
 	// retrieve stored packets
 	packets, err := c.Session.AllPackets(clientsession.Outgoing)
 	if err != nil {
@@ -584,6 +722,9 @@ func (c *Client) processSuback(suback *packet.SubackPacket) error {
 	subscribeFuture.Data.Store(returnCodesKey, suback.ReturnCodes)
 	subscribeFuture.Complete()
 
+	// call hook
+	c.Hooks.subscribeAcked(suback.ID, c.since(subscribeFuture))
+
 	return nil
 }
 
@@ -607,13 +748,29 @@ func (c *Client) processUnsuback(unsuback *packet.UnsubackPacket) error {
 	// remove future from store
 	c.futureStore.Delete(unsuback.ID)
 
+	// call hook
+	c.Hooks.unsubscribeAcked(unsuback.ID, c.since(unsubscribeFuture))
+
 	return nil
 }
 
 // handle an incoming PublishPacket
 func (c *Client) processPublish(publish *packet.PublishPacket) error {
-	// call callback for unacknowledged and directly acknowledged messages
+	// count delivery
+	c.deliveries.track(publish)
+
+	// start and store span
+	span := c.startSpan(DeliverSpan, messageAttributes(&publish.Message))
+	if span != nil {
+		span.SetAttribute("messaging.message_id", int(publish.ID))
+		c.deliverSpans.put(publish.ID, span)
+	}
+
+	// call hook and callback for unacknowledged and directly acknowledged
+	// messages
 	if publish.Message.QOS <= 1 {
+		c.Hooks.message(&publish.Message)
+
 		if c.Callback != nil {
 			err := c.Callback(&publish.Message, nil)
 			if err != nil {
@@ -633,6 +790,14 @@ func (c *Client) processPublish(publish *packet.PublishPacket) error {
 		if err != nil {
 			return c.die(err, false, false)
 		}
+
+		// end flight
+		c.deliveries.acked(1, publish.ID)
+	}
+
+	// end span of qos 0 and qos 1 publishes
+	if publish.Message.QOS <= 1 {
+		c.deliverSpans.end(publish.ID, nil)
 	}
 
 	// handle qos 2 flow
@@ -677,6 +842,12 @@ func (c *Client) processPubackAndPubcomp(id packet.ID) error {
 	// remove future from store
 	c.futureStore.Delete(id)
 
+	// end span
+	c.publishSpans.end(id, nil)
+
+	// call hook
+	c.Hooks.publishAcked(id)
+
 	return nil
 }
 
@@ -715,7 +886,9 @@ func (c *Client) processPubrel(id packet.ID) error {
 		return nil // ignore a wrongly sent PubrelPacket
 	}
 
-	// call callback
+	// call hook and callback
+	c.Hooks.message(&publish.Message)
+
 	if c.Callback != nil {
 		err = c.Callback(&publish.Message, nil)
 		if err != nil {
@@ -733,51 +906,137 @@ func (c *Client) processPubrel(id packet.ID) error {
 		return c.die(err, false, false)
 	}
 
+	// end flight
+	c.deliveries.acked(2, publish.ID)
+
 	// remove packet from store
 	err = c.Session.DeletePacket(clientsession.Incoming, id)
 	if err != nil {
 		return c.die(err, true, false)
 	}
 
+	// end span
+	c.deliverSpans.end(id, nil)
+
 	return nil
 }
 
-/* pinger goroutine */
+/* pinger */
 
-// manages the sending of ping packets to keep the connection alive
-func (c *Client) pinger() error {
-	for {
-		// get current window
-		window := c.tracker.window()
-
-		// check if ping is due
-		if window < 0 {
-			// check if a pong has already been sent
-			if c.tracker.pending() {
-				return c.die(ErrClientMissingPong, true, false)
-			}
+// schedules the keep alive checks
+func (c *Client) startPinger() {
+	c.beatMutex.Lock()
+	c.beat = c.heartbeat().schedule(c.pinger, 0)
+	c.beatMutex.Unlock()
+}
 
-			// send pingreq packet
-			err := c.send(packet.NewPingreqPacket(), true)
-			if err != nil {
-				return c.die(err, false, false)
-			}
+// sends a pingreq if due and returns the delay until the next check
+func (c *Client) pinger() (time.Duration, bool) {
+	err := c.ping()
+	if err == tomb.ErrDying {
+		return 0, false
+	} else if err != nil {
+		c.tomb.Kill(c.die(err, err == ErrClientMissingPong, false))
+		return 0, false
+	}
 
-			// save ping attempt
-			c.tracker.ping()
-		} else {
-			// log keep alive delay
-			if c.Logger != nil {
-				c.Logger(fmt.Sprintf("Delay KeepAlive by %s", window.String()))
-			}
-		}
+	return c.tracker.window(), true
+}
 
-		select {
-		case <-c.tomb.Dying():
-			return tomb.ErrDying
-		case <-time.After(window):
-			continue
+// checks the keep alive window and sends a pingreq if due
+func (c *Client) ping() error {
+	c.beatMutex.Lock()
+	defer c.beatMutex.Unlock()
+
+	// check if still alive
+	select {
+	case <-c.tomb.Dying():
+		return tomb.ErrDying
+	default:
+	}
+
+	// get current window
+	window := c.tracker.window()
+
+	// check if ping is due
+	if window > 0 {
+		// log keep alive delay
+		if c.Logger != nil {
+			c.Logger(fmt.Sprintf("Delay KeepAlive by %s", window.String()))
 		}
+
+		return nil
+	}
+
+	// check if a pong has already been sent
+	if c.tracker.pending() {
+		return ErrClientMissingPong
+	}
+
+	// save ping attempt, a write that is still stalled at the next check is
+	// reported as a missing pong which closes the connection
+	c.tracker.reset()
+	c.tracker.ping()
+
+	// send pingreq packet without blocking the shared heartbeat
+	go c.sendPing()
+
+	return nil
+}
+
+// sends a pingreq packet
+func (c *Client) sendPing() {
+	err := c.send(packet.NewPingreqPacket(), true)
+	if err == nil {
+		return
+	}
+
+	// ignore errors of a connection closed by Disconnect or Close
+	select {
+	case <-c.tomb.Dying():
+		return
+	default:
+	}
+
+	c.tomb.Kill(c.die(err, false, false))
+}
+
+// returns the clock used for keep alive checks
+func (c *Client) clock() clock.Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+
+	return clock.Real
+}
+
+// returns the time since the future's packet has been sent
+func (c *Client) since(f *future.Future) time.Duration {
+	sent, ok := f.Data.Load(sentKey)
+	if !ok {
+		return 0
+	}
+
+	return clock.Since(c.clock(), sent.(time.Time))
+}
+
+// returns the heartbeat used for keep alive checks
+func (c *Client) heartbeat() *Heartbeat {
+	if c.Heartbeat != nil {
+		return c.Heartbeat
+	}
+
+	return DefaultHeartbeat
+}
+
+// stops the keep alive checks and waits for a running check
+func (c *Client) stopPinger() {
+	c.beatMutex.Lock()
+	defer c.beatMutex.Unlock()
+
+	if c.beat != nil {
+		c.heartbeat().remove(c.beat)
+		c.beat = nil
 	}
 }
 
@@ -788,6 +1047,11 @@ func (c *Client) send(pkt packet.GenericPacket, buffered bool) error {
 	// reset keep alive tracker
 	c.tracker.reset()
 
+	// discard packets lost by fault injection
+	if c.Hooks.dropOutgoing(pkt) {
+		return nil
+	}
+
 	// send packet
 	var err error
 	if buffered {
@@ -815,7 +1079,7 @@ func (c *Client) cleanup(err error, doClose bool, possiblyClosed bool) error {
 	}
 
 	// set state
-	atomic.StoreUint32(&c.state, clientDisconnected)
+	previous := atomic.SwapUint32(&c.state, clientDisconnected)
 
 	// ensure that the connection gets closed
 	if doClose {
@@ -836,9 +1100,56 @@ func (c *Client) cleanup(err error, doClose bool, possiblyClosed bool) error {
 	// cancel all futures
 	c.futureStore.Clear()
 
+	// end all pending spans
+	spanErr := err
+	if spanErr == nil {
+		spanErr = future.ErrCanceled
+	}
+	c.endConnectSpan(spanErr)
+	c.queued.clear(spanErr)
+	c.publishSpans.clear(spanErr)
+	c.deliverSpans.clear(spanErr)
+
+	// call hook once for an accepted connection
+	if previous == clientConnected || previous == clientDisconnecting {
+		c.Hooks.disconnect(err)
+	}
+
 	return err
 }
 
+// starts a span if a tracer is configured
+func (c *Client) startSpan(name string, attrs Attributes) Span {
+	if c.Tracer == nil {
+		return nil
+	}
+
+	return c.Tracer.Start(name, attrs)
+}
+
+// adds attributes to the connect span if still pending
+func (c *Client) annotateConnectSpan(attrs Attributes) {
+	c.spanMutex.Lock()
+	defer c.spanMutex.Unlock()
+
+	if c.connectSpan != nil {
+		for key, value := range attrs {
+			c.connectSpan.SetAttribute(key, value)
+		}
+	}
+}
+
+// ends the connect span if still pending
+func (c *Client) endConnectSpan(err error) {
+	c.spanMutex.Lock()
+	defer c.spanMutex.Unlock()
+
+	if c.connectSpan != nil {
+		c.connectSpan.End(err)
+		c.connectSpan = nil
+	}
+}
+
 // used for closing and cleaning up from internal goroutines
 func (c *Client) die(err error, close bool, fromCallback bool) error {
 	c.finish.Do(func() {
@@ -862,6 +1173,7 @@ func (c *Client) end(err error, possiblyClosed bool) error {
 
 	// shutdown goroutines
 	c.tomb.Kill(nil)
+	c.stopPinger()
 
 	// wait for all goroutines to exit
 	// goroutines will send eventual errors through the callback
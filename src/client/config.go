@@ -14,6 +14,17 @@ type Config struct {
 	KeepAlive    string
 	WillMessage  *packet.Message
 	ValidateSubs bool
+
+	// If Username is set, the credentials are used instead of the ones
+	// contained in the broker url.
+	Username string
+	Password string
+
+	// If SendQueueSize is greater than zero, published messages are written
+	// to the connection by a separate goroutine using a queue of the specified
+	// size. SendQueuePolicy defines the behavior if the queue is full.
+	SendQueueSize   int
+	SendQueuePolicy QueuePolicy
 }
 
 // NewConfig creates a new Config using the specified URL.
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"sync"
+
+	"packet"
+)
+
+// DeliveryStats contains the counters of incoming publish packets per QoS
+// level. They quantify how many messages a broker delivers more than once
+// under the "at least once" guarantee.
+type DeliveryStats struct {
+	// The number of received publish packets.
+	Received [3]uint64
+
+	// The number of received publish packets with the Dup flag set.
+	Duplicates [3]uint64
+
+	// The number of received publish packets that have the same packet id
+	// and topic as a publish packet that is still in flight, i.e. has not yet
+	// been acknowledged by the client with a PUBACK or PUBCOMP. A broker may
+	// only reuse a packet id once the message has been acknowledged, so this
+	// detects brokers that redeliver without setting the Dup flag, e.g. after
+	// a connection loss, independent of the payloads.
+	Redelivered [3]uint64
+
+	// The number of received publish packets that have been counted as
+	// duplicates or redeliveries.
+	Deduplicated [3]uint64
+}
+
+// Total returns the number of received and deduplicated publish packets
+// across all QoS levels.
+func (s DeliveryStats) Total() (received, deduplicated uint64) {
+	for qos := 0; qos < 3; qos++ {
+		received += s.Received[qos]
+		deduplicated += s.Deduplicated[qos]
+	}
+
+	return received, deduplicated
+}
+
+// DeliveryStats returns the counters of the publish packets received by the
+// client.
+func (c *Client) DeliveryStats() DeliveryStats {
+	return c.deliveries.get()
+}
+
+// a deliveryTracker counts incoming publish packets and detects duplicates
+type deliveryTracker struct {
+	sync.Mutex
+
+	stats    DeliveryStats
+	inflight [3]map[packet.ID]string
+}
+
+// returns a new deliveryTracker
+func newDeliveryTracker() *deliveryTracker {
+	t := &deliveryTracker{}
+	for qos := range t.inflight {
+		t.inflight[qos] = make(map[packet.ID]string)
+	}
+
+	return t
+}
+
+// counts a received publish packet
+func (t *deliveryTracker) track(publish *packet.PublishPacket) {
+	qos := publish.Message.QOS
+	if qos > 2 {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.stats.Received[qos]++
+
+	duplicate := false
+	if publish.Dup {
+		t.stats.Duplicates[qos]++
+		duplicate = true
+	}
+
+	// qos 0 messages have no packet id
+	if qos > 0 {
+		topic, ok := t.inflight[qos][publish.ID]
+		if ok && topic == publish.Message.Topic {
+			t.stats.Redelivered[qos]++
+			duplicate = true
+		}
+
+		t.inflight[qos][publish.ID] = publish.Message.Topic
+	}
+
+	if duplicate {
+		t.stats.Deduplicated[qos]++
+	}
+}
+
+// ends the flight of a publish packet once the client acknowledged it, after
+// which the broker may reuse the packet id for a new message
+func (t *deliveryTracker) acked(qos uint8, id packet.ID) {
+	if qos > 2 {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.inflight[qos], id)
+}
+
+// returns a copy of the counters
+func (t *deliveryTracker) get() DeliveryStats {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.stats
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+	"transport/flow"
+)
+
+func deliveryPublish(id packet.ID, qos uint8, payload string, dup bool) *packet.PublishPacket {
+	publish := packet.NewPublishPacket()
+	publish.ID = id
+	publish.Dup = dup
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte(payload)
+	publish.Message.QOS = qos
+	return publish
+}
+
+func TestDeliveryTracker(t *testing.T) {
+	tracker := newDeliveryTracker()
+
+	tracker.track(deliveryPublish(0, 0, "a", false))
+	tracker.track(deliveryPublish(0, 0, "a", false))
+	tracker.track(deliveryPublish(1, 1, "a", false))
+	tracker.track(deliveryPublish(1, 1, "a", true))
+	tracker.track(deliveryPublish(1, 1, "b", false))
+	tracker.track(deliveryPublish(2, 2, "a", true))
+
+	stats := tracker.get()
+	assert.Equal(t, [3]uint64{2, 3, 1}, stats.Received)
+	assert.Equal(t, [3]uint64{0, 1, 1}, stats.Duplicates)
+	assert.Equal(t, [3]uint64{0, 2, 0}, stats.Redelivered)
+	assert.Equal(t, [3]uint64{0, 2, 1}, stats.Deduplicated)
+
+	received, deduplicated := stats.Total()
+	assert.Equal(t, uint64(6), received)
+	assert.Equal(t, uint64(3), deduplicated)
+}
+
+func TestDeliveryTrackerAcked(t *testing.T) {
+	tracker := newDeliveryTracker()
+
+	// the id has been reused after the acknowledgement
+	tracker.track(deliveryPublish(1, 1, "a", false))
+	tracker.acked(1, 1)
+	tracker.track(deliveryPublish(1, 1, "a", false))
+
+	// the id has been reused for another topic
+	other := deliveryPublish(1, 1, "a", false)
+	other.Message.Topic = "other"
+	tracker.track(other)
+
+	// the id is shared across qos levels
+	tracker.track(deliveryPublish(1, 2, "a", false))
+	tracker.acked(2, 1)
+	tracker.track(deliveryPublish(1, 2, "a", false))
+
+	stats := tracker.get()
+	assert.Equal(t, [3]uint64{0, 0, 0}, stats.Redelivered)
+	assert.Equal(t, [3]uint64{0, 3, 2}, stats.Received)
+}
+
+func TestClientDeliveryStats(t *testing.T) {
+	publish := deliveryPublish(1, 1, "test", false)
+	duplicate := deliveryPublish(1, 1, "test", true)
+
+	puback := packet.NewPubackPacket()
+	puback.ID = 1
+
+	// the pubrec is lost and the broker resends the publish without dup flag
+	exactlyOnce := deliveryPublish(2, 2, "test", false)
+
+	pubrec := packet.NewPubrecPacket()
+	pubrec.ID = 2
+
+	pubrel := packet.NewPubrelPacket()
+	pubrel.ID = 2
+
+	pubcomp := packet.NewPubcompPacket()
+	pubcomp.ID = 2
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Send(publish).
+		Receive(puback).
+		Send(duplicate).
+		Receive(puback).
+		Send(exactlyOnce).
+		Receive(pubrec).
+		Send(exactlyOnce).
+		Receive(pubrec).
+		Send(pubrel).
+		Receive(pubcomp).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	wait := make(chan struct{}, 3)
+
+	c := New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		wait <- struct{}{}
+		return nil
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	<-wait
+	<-wait
+	<-wait
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	// the duplicate was sent after the acknowledgement and only counts by
+	// its dup flag
+	stats := c.DeliveryStats()
+	assert.Equal(t, [3]uint64{0, 2, 2}, stats.Received)
+	assert.Equal(t, [3]uint64{0, 1, 0}, stats.Duplicates)
+	assert.Equal(t, [3]uint64{0, 0, 1}, stats.Redelivered)
+	assert.Equal(t, [3]uint64{0, 1, 1}, stats.Deduplicated)
+}
@@ -42,6 +42,7 @@ const (
 	sessionPresentKey futureKey = iota
 	returnCodeKey
 	returnCodesKey
+	sentKey
 )
 
 type connectFuture struct {
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"container/heap"
+	"runtime"
+	"sync"
+	"time"
+
+	"clock"
+)
+
+// DefaultHeartbeat is the Heartbeat used by clients that do not specify one.
+var DefaultHeartbeat = NewHeartbeat(runtime.NumCPU())
+
+// A Heartbeat schedules the keep alive checks of many clients using a single
+// timer goroutine and a small pool of sender goroutines instead of a dedicated
+// goroutine per client. This keeps the number of goroutines per connected
+// client at one, which allows simulating hundreds of thousands of connections
+// from a single host. The goroutines are started with the first scheduled
+// client and run until the Heartbeat is closed.
+type Heartbeat struct {
+	clock   clock.Clock
+	senders int
+	beats   beatQueue
+	wake    chan struct{}
+	work    chan *beat
+	done    chan struct{}
+	start   sync.Once
+	stop    sync.Once
+	mutex   sync.Mutex
+}
+
+// NewHeartbeat returns a new Heartbeat that uses the specified number of
+// sender goroutines.
+func NewHeartbeat(senders int) *Heartbeat {
+	return NewHeartbeatWithClock(senders, clock.Real)
+}
+
+// NewHeartbeatWithClock returns a new Heartbeat that schedules the checks
+// using the specified clock.
+func NewHeartbeatWithClock(senders int, c clock.Clock) *Heartbeat {
+	// check senders
+	if senders < 1 {
+		senders = 1
+	}
+
+	return &Heartbeat{
+		clock:   c,
+		senders: senders,
+		wake:    make(chan struct{}, 1),
+		work:    make(chan *beat),
+		done:    make(chan struct{}),
+	}
+}
+
+// Len returns the number of scheduled clients.
+func (h *Heartbeat) Len() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return len(h.beats)
+}
+
+// Close stops the goroutines of the Heartbeat. Scheduled clients will not be
+// checked anymore.
+func (h *Heartbeat) Close() {
+	h.stop.Do(func() {
+		close(h.done)
+	})
+}
+
+// a beat is a scheduled keep alive check, the function returns the delay until
+// the next check or false to stop
+type beat struct {
+	fn      func() (time.Duration, bool)
+	at      time.Time
+	index   int
+	removed bool
+}
+
+// schedules the function to be called after the delay
+func (h *Heartbeat) schedule(fn func() (time.Duration, bool), delay time.Duration) *beat {
+	// start goroutines
+	h.start.Do(func() {
+		go h.timer()
+
+		for i := 0; i < h.senders; i++ {
+			go h.sender()
+		}
+	})
+
+	b := &beat{fn: fn, index: -1}
+
+	h.mutex.Lock()
+	h.push(b, delay)
+	h.mutex.Unlock()
+
+	return b
+}
+
+// removes a scheduled beat, a running check is not interrupted
+func (h *Heartbeat) remove(b *beat) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	b.removed = true
+
+	if b.index >= 0 {
+		heap.Remove(&h.beats, b.index)
+	}
+}
+
+// queues a beat, the mutex must be held
+func (h *Heartbeat) push(b *beat, delay time.Duration) {
+	b.at = h.clock.Now().Add(delay)
+	heap.Push(&h.beats, b)
+
+	// wake timer if the beat is the next one
+	if b.index == 0 {
+		select {
+		case h.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// hands due beats to the senders
+func (h *Heartbeat) timer() {
+	// the timer is only armed while beats are scheduled
+	var timer clock.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		h.mutex.Lock()
+
+		// dispatch due beats
+		for len(h.beats) > 0 && !h.beats[0].at.After(h.clock.Now()) {
+			b := heap.Pop(&h.beats).(*beat)
+			h.mutex.Unlock()
+
+			select {
+			case h.work <- b:
+			case <-h.done:
+				return
+			}
+
+			h.mutex.Lock()
+		}
+
+		// stop timer
+		if timer != nil && !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+
+		// arm timer for the next beat
+		var next <-chan time.Time
+		if len(h.beats) > 0 {
+			wait := h.beats[0].at.Sub(h.clock.Now())
+			if timer == nil {
+				timer = h.clock.NewTimer(wait)
+			} else {
+				timer.Reset(wait)
+			}
+
+			next = timer.C()
+		}
+
+		h.mutex.Unlock()
+
+		select {
+		case <-next:
+		case <-h.wake:
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// runs due beats and reschedules them
+func (h *Heartbeat) sender() {
+	for {
+		select {
+		case b := <-h.work:
+			delay, ok := b.fn()
+			if !ok {
+				continue
+			}
+
+			h.mutex.Lock()
+			if !b.removed {
+				h.push(b, delay)
+			}
+			h.mutex.Unlock()
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// a beatQueue is a min heap of beats ordered by their time
+type beatQueue []*beat
+
+func (q beatQueue) Len() int { return len(q) }
+
+func (q beatQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+
+func (q beatQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *beatQueue) Push(x interface{}) {
+	b := x.(*beat)
+	b.index = len(*q)
+	*q = append(*q, b)
+}
+
+func (q *beatQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	b := old[n-1]
+	old[n-1] = nil
+	b.index = -1
+	*q = old[:n-1]
+	return b
+}
@@ -0,0 +1,335 @@
+package client
+
+import (
+	"net"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+	"transport"
+	"transport/flow"
+)
+
+func TestHeartbeat(t *testing.T) {
+	heartbeat := NewHeartbeat(2)
+	defer heartbeat.Close()
+
+	var calls int32
+	done := make(chan struct{})
+
+	heartbeat.schedule(func() (time.Duration, bool) {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			close(done)
+			return 0, false
+		}
+
+		return 5 * time.Millisecond, true
+	}, 0)
+
+	safeReceive(done)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0, heartbeat.Len())
+}
+
+func TestHeartbeatOrder(t *testing.T) {
+	heartbeat := NewHeartbeat(1)
+	defer heartbeat.Close()
+
+	order := make(chan int, 3)
+
+	for i, delay := range []time.Duration{30, 10, 20} {
+		i := i
+		heartbeat.schedule(func() (time.Duration, bool) {
+			order <- i
+			return 0, false
+		}, delay*time.Millisecond)
+	}
+
+	assert.Equal(t, 1, <-order)
+	assert.Equal(t, 2, <-order)
+	assert.Equal(t, 0, <-order)
+}
+
+func TestHeartbeatRemove(t *testing.T) {
+	heartbeat := NewHeartbeat(1)
+	defer heartbeat.Close()
+
+	var calls int32
+
+	b := heartbeat.schedule(func() (time.Duration, bool) {
+		atomic.AddInt32(&calls, 1)
+		return 0, false
+	}, 10*time.Millisecond)
+	assert.Equal(t, 1, heartbeat.Len())
+
+	heartbeat.remove(b)
+	assert.Equal(t, 0, heartbeat.Len())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestClientHeartbeat(t *testing.T) {
+	heartbeat := NewHeartbeat(1)
+	defer heartbeat.Close()
+
+	connect := connectPacket()
+	connect.KeepAlive = 0
+
+	broker := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Receive(packet.NewPingreqPacket()).
+		Send(packet.NewPingrespPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = errorCallback(t)
+	c.Heartbeat = heartbeat
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.KeepAlive = "50ms"
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+	assert.Equal(t, 1, heartbeat.Len())
+
+	<-time.After(75 * time.Millisecond)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, heartbeat.Len())
+
+	safeReceive(done)
+}
+
+func TestClientHeartbeatStalledPing(t *testing.T) {
+	heartbeat := NewHeartbeat(1)
+	defer heartbeat.Close()
+
+	connect := connectPacket()
+	connect.KeepAlive = 0
+
+	newBroker := func() *flow.Flow {
+		return flow.New().
+			Receive(connect).
+			Send(connackPacket()).
+			Receive(packet.NewPingreqPacket()).
+			Send(packet.NewPingrespPacket()).
+			Receive(disconnectPacket()).
+			End()
+	}
+
+	newClient := func(port string, pong chan struct{}, hooks Hooks) *Client {
+		c := New()
+		c.Hooks = hooks
+		c.Callback = errorCallback(t)
+		c.Heartbeat = heartbeat
+		c.Logger = func(message string) {
+			if strings.Contains(message, "Pingresp") {
+				close(pong)
+			}
+		}
+
+		config := NewConfig("tcp://localhost:" + port)
+		config.KeepAlive = "100ms"
+
+		connectFuture, err := c.Connect(config)
+		assert.NoError(t, err)
+		assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+		return c
+	}
+
+	// the write of the first client stalls until released
+	stalledDone, stalledPort := fakeBroker(t, newBroker())
+	stalledPong := make(chan struct{})
+	release := make(chan struct{})
+
+	stalled := newClient(stalledPort, stalledPong, Hooks{
+		DropOutgoing: func(pkt packet.GenericPacket) bool {
+			if pkt.Type() == packet.PINGREQ {
+				<-release
+			}
+
+			return false
+		},
+	})
+
+	done, port := fakeBroker(t, newBroker())
+	pong := make(chan struct{})
+
+	c := newClient(port, pong, Hooks{})
+
+	// the second client must not wait for the stalled one
+	safeReceive(pong)
+
+	close(release)
+	safeReceive(stalledPong)
+
+	assert.NoError(t, c.Disconnect())
+	assert.NoError(t, stalled.Disconnect())
+
+	safeReceive(done)
+	safeReceive(stalledDone)
+}
+
+// BenchmarkClientConnections connects a client per iteration and reports the
+// goroutines and memory that every connected client requires.
+func BenchmarkClientConnections(b *testing.B) {
+	server, err := transport.Launch("tcp://localhost:0")
+	require.NoError(b, err)
+
+	// accept connections and acknowledge the connect packets, the connections
+	// are kept to prevent them from being collected
+	var conns []transport.Conn
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			conns = append(conns, conn)
+
+			_, err = conn.Receive()
+			if err == nil {
+				err = conn.Send(packet.NewConnackPacket())
+			}
+			if err != nil {
+				conn.Close()
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.KeepAlive = "1m"
+
+	clients := make([]*Client, 0, b.N)
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	goroutines := runtime.NumGoroutine()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c := New()
+
+		cf, err := c.Connect(config)
+		if err == nil {
+			err = cf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		clients = append(clients, c)
+	}
+
+	b.StopTimer()
+
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines)/float64(b.N), "goroutines/client")
+	b.ReportMetric(float64(after.HeapInuse+after.StackInuse-before.HeapInuse-before.StackInuse)/float64(b.N), "bytes/client")
+
+	for _, c := range clients {
+		c.Close()
+	}
+
+	server.Close()
+}
+
+func TestHeartbeatWithClock(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+
+	heartbeat := NewHeartbeatWithClock(1, mock)
+	defer heartbeat.Close()
+
+	calls := make(chan time.Time, 3)
+
+	heartbeat.schedule(func() (time.Duration, bool) {
+		calls <- mock.Now()
+		return time.Minute, true
+	}, time.Minute)
+
+	start := mock.Now()
+
+	for i := 1; i <= 3; i++ {
+		mock.BlockUntil(1)
+		mock.Advance(time.Minute)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Minute), <-calls)
+	}
+}
+
+func TestClientKeepAliveWithClock(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+
+	heartbeat := NewHeartbeatWithClock(1, mock)
+	defer heartbeat.Close()
+
+	connect := connectPacket()
+	connect.KeepAlive = 60
+
+	broker := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Receive(packet.NewPingreqPacket()).
+		Send(packet.NewPingrespPacket()).
+		Receive(packet.NewPingreqPacket()).
+		Send(packet.NewPingrespPacket()).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	var pongs int32
+
+	c := New()
+	c.Callback = errorCallback(t)
+	c.Clock = mock
+	c.Heartbeat = heartbeat
+	c.Logger = func(message string) {
+		if strings.Contains(message, "Pingresp") {
+			atomic.AddInt32(&pongs, 1)
+		}
+	}
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.KeepAlive = "1m"
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	// two keep alive windows pass instantly
+	for i := int32(1); i <= 2; i++ {
+		mock.BlockUntil(1)
+		mock.Advance(time.Minute)
+
+		for atomic.LoadInt32(&pongs) < i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"time"
+
+	"packet"
+)
+
+// Hooks are optional functions that are called by the client on lifecycle
+// events. They allow embedders to attach custom logic like forwarding
+// messages or custom assertions without replacing the Callback. Hooks are
+// called synchronously from the goroutines of the client and should return
+// quickly.
+type Hooks struct {
+	// OnConnect is called once the broker accepted the connection.
+	OnConnect func(sessionPresent bool)
+
+	// OnDisconnect is called once a connection that has been accepted is
+	// closed. The error is nil if the connection has been closed by Disconnect
+	// or Close.
+	OnDisconnect func(err error)
+
+	// OnPublishAcked is called when the broker acknowledged an outgoing QOS 1
+	// or QOS 2 publish with the specified packet id.
+	OnPublishAcked func(id packet.ID)
+
+	// OnMessage is called for every incoming message before the Callback.
+	OnMessage func(msg *packet.Message)
+
+	// OnSubscribeAcked is called when the broker acknowledged a subscribe
+	// with the specified packet id and reports the time since it was sent.
+	OnSubscribeAcked func(id packet.ID, latency time.Duration)
+
+	// OnUnsubscribeAcked is called when the broker acknowledged an
+	// unsubscribe with the specified packet id and reports the time since it
+	// was sent.
+	OnUnsubscribeAcked func(id packet.ID, latency time.Duration)
+
+	// DropIncoming is called for every received packet after the CONNACK and
+	// before it is processed. Returning true discards the packet to simulate
+	// its loss, e.g. of a PUBREC to test the recovery of the QOS 2 flow.
+	DropIncoming func(pkt packet.GenericPacket) bool
+
+	// DropOutgoing is called for every packet before it is sent. Returning
+	// true discards the packet as if it had been lost on the way.
+	DropOutgoing func(pkt packet.GenericPacket) bool
+}
+
+func (h *Hooks) connect(sessionPresent bool) {
+	if h.OnConnect != nil {
+		h.OnConnect(sessionPresent)
+	}
+}
+
+func (h *Hooks) disconnect(err error) {
+	if h.OnDisconnect != nil {
+		h.OnDisconnect(err)
+	}
+}
+
+func (h *Hooks) publishAcked(id packet.ID) {
+	if h.OnPublishAcked != nil {
+		h.OnPublishAcked(id)
+	}
+}
+
+func (h *Hooks) message(msg *packet.Message) {
+	if h.OnMessage != nil {
+		h.OnMessage(msg)
+	}
+}
+
+func (h *Hooks) subscribeAcked(id packet.ID, latency time.Duration) {
+	if h.OnSubscribeAcked != nil {
+		h.OnSubscribeAcked(id, latency)
+	}
+}
+
+func (h *Hooks) dropIncoming(pkt packet.GenericPacket) bool {
+	return h.DropIncoming != nil && h.DropIncoming(pkt)
+}
+
+func (h *Hooks) dropOutgoing(pkt packet.GenericPacket) bool {
+	return h.DropOutgoing != nil && h.DropOutgoing(pkt)
+}
+
+func (h *Hooks) unsubscribeAcked(id packet.ID, latency time.Duration) {
+	if h.OnUnsubscribeAcked != nil {
+		h.OnUnsubscribeAcked(id, latency)
+	}
+}
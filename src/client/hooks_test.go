@@ -0,0 +1,343 @@
+package client
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"clientsession"
+	"github.com/stretchr/testify/assert"
+	"packet"
+	"transport/flow"
+)
+
+func TestClientHooks(t *testing.T) {
+	subscribe := packet.NewSubscribePacket()
+	subscribe.Subscriptions = []packet.Subscription{{Topic: "test", QOS: 1}}
+	subscribe.ID = 1
+
+	suback := packet.NewSubackPacket()
+	suback.ReturnCodes = []uint8{1}
+	suback.ID = 1
+
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+	publish.ID = 2
+
+	puback := packet.NewPubackPacket()
+	puback.ID = 2
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(subscribe).
+		Send(suback).
+		Receive(publish).
+		Send(puback).
+		Send(publish).
+		Receive(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	var events []string
+	var mutex sync.Mutex
+	record := func(event string) {
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}
+
+	wait := make(chan struct{})
+
+	c := New()
+	c.Hooks = Hooks{
+		OnConnect: func(sessionPresent bool) {
+			assert.False(t, sessionPresent)
+			record("connect")
+		},
+		OnDisconnect: func(err error) {
+			assert.NoError(t, err)
+			record("disconnect")
+		},
+		OnPublishAcked: func(id packet.ID) {
+			assert.Equal(t, packet.ID(2), id)
+			record("acked")
+		},
+		OnMessage: func(msg *packet.Message) {
+			assert.Equal(t, "test", msg.Topic)
+			record("message")
+		},
+		OnSubscribeAcked: func(id packet.ID, latency time.Duration) {
+			assert.Equal(t, packet.ID(1), id)
+			assert.True(t, latency > 0)
+			record("subscribed")
+		},
+	}
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		record("callback")
+		close(wait)
+		return nil
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	subscribeFuture, err := c.Subscribe("test", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, subscribeFuture.Wait(1*time.Second))
+
+	publishFuture, err := c.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, publishFuture.Wait(1*time.Second))
+
+	safeReceive(wait)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"connect", "subscribed", "acked", "message", "callback", "disconnect"}, events)
+}
+
+func TestClientHooksConnectionLost(t *testing.T) {
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Close()
+
+	done, port := fakeBroker(t, broker)
+
+	disconnected := make(chan struct{})
+
+	c := New()
+	c.Hooks.OnDisconnect = func(err error) {
+		assert.Equal(t, io.EOF, err)
+		close(disconnected)
+	}
+	c.Callback = func(msg *packet.Message, err error) error {
+		return nil
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	safeReceive(disconnected)
+	safeReceive(done)
+
+	// the hook is not called again
+	err = c.Close()
+	assert.NoError(t, err)
+}
+
+func TestClientHooksUnsubscribeLatency(t *testing.T) {
+	unsubscribe := packet.NewUnsubscribePacket()
+	unsubscribe.Topics = []string{"test"}
+	unsubscribe.ID = 1
+
+	unsuback := packet.NewUnsubackPacket()
+	unsuback.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(unsubscribe).
+		Delay(10 * time.Millisecond).
+		Send(unsuback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	acked := make(chan struct{})
+
+	c := New()
+	c.Callback = errorCallback(t)
+	c.Hooks.OnUnsubscribeAcked = func(id packet.ID, latency time.Duration) {
+		assert.Equal(t, packet.ID(1), id)
+		assert.True(t, latency >= 10*time.Millisecond)
+		close(acked)
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	unsubscribeFuture, err := c.Unsubscribe("test")
+	assert.NoError(t, err)
+	assert.NoError(t, unsubscribeFuture.Wait(1*time.Second))
+
+	safeReceive(acked)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestClientHooksDropPubrec(t *testing.T) {
+	connect := connectPacket()
+	connect.ClientID = "test"
+	connect.CleanSession = false
+
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 2
+	publish.ID = 1
+
+	dup := packet.NewPublishPacket()
+	dup.Message = publish.Message
+	dup.ID = 1
+	dup.Dup = true
+
+	pubrec := packet.NewPubrecPacket()
+	pubrec.ID = 1
+
+	pubrel := packet.NewPubrelPacket()
+	pubrel.ID = 1
+
+	pubcomp := packet.NewPubcompPacket()
+	pubcomp.ID = 1
+
+	lost := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Receive(publish).
+		Send(pubrec).
+		Receive(disconnectPacket()).
+		End()
+
+	resumed := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Receive(dup).
+		Send(pubrec).
+		Receive(pubrel).
+		Send(pubcomp).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, lost, resumed)
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.ClientID = "test"
+	config.CleanSession = false
+
+	dropped := make(chan struct{})
+
+	c := New()
+	c.Callback = errorCallback(t)
+	c.Hooks.DropIncoming = func(pkt packet.GenericPacket) bool {
+		if pkt.Type() == packet.PUBREC {
+			close(dropped)
+			return true
+		}
+
+		return false
+	}
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	_, err = c.Publish("test", []byte("test"), 2, false)
+	assert.NoError(t, err)
+
+	safeReceive(dropped)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	// the publish is resent with the dup flag by the next client
+	completed := make(chan struct{})
+
+	c2 := New()
+	c2.Session = c.Session
+	c2.Callback = errorCallback(t)
+	c2.Hooks.DropIncoming = func(pkt packet.GenericPacket) bool {
+		if pkt.Type() == packet.PUBCOMP {
+			close(completed)
+		}
+
+		return false
+	}
+
+	connectFuture, err = c2.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	safeReceive(completed)
+
+	err = c2.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	pkts, err := c2.Session.AllPackets(clientsession.Outgoing)
+	assert.NoError(t, err)
+	assert.Empty(t, pkts)
+}
+
+func TestClientHooksDropPubrel(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 2
+	publish.ID = 1
+
+	pubrec := packet.NewPubrecPacket()
+	pubrec.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		Send(pubrec).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	dropped := make(chan struct{})
+
+	c := New()
+	c.Callback = errorCallback(t)
+	c.Hooks.DropOutgoing = func(pkt packet.GenericPacket) bool {
+		if pkt.Type() == packet.PUBREL {
+			close(dropped)
+			return true
+		}
+
+		return false
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	_, err = c.Publish("test", []byte("test"), 2, false)
+	assert.NoError(t, err)
+
+	safeReceive(dropped)
+
+	// the pubrel is kept for a resend
+	pkt, err := c.Session.LookupPacket(clientsession.Outgoing, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.PUBREL, pkt.Type())
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
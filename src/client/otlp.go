@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the number of spans exported with a single request
+const otlpBatchSize = 512
+
+// An OTLPTracer is a Tracer that exports the spans of the client with the
+// OpenTelemetry protocol (OTLP/HTTP with JSON encoding) to a collector or to
+// any tracing backend that accepts OTLP, e.g. Jaeger or Tempo. Spans are
+// batched and exported in the background every second.
+type OTLPTracer struct {
+	endpoint string
+	service  string
+	client   *http.Client
+
+	spans   chan *otlpSpan
+	dropped uint64
+
+	err     error
+	closing chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewOTLPTracer returns a new OTLPTracer that exports to the specified OTLP
+// endpoint, e.g. "http://127.0.0.1:4318". The path defaults to "/v1/traces".
+// The service name is reported as the "service.name" resource attribute.
+func NewOTLPTracer(endpoint, service string) (*OTLPTracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// check scheme
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid otlp endpoint: %s", endpoint)
+	}
+
+	// set default path
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+
+	t := &OTLPTracer{
+		endpoint: u.String(),
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		spans:    make(chan *otlpSpan, 4*otlpBatchSize),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+
+	go t.export()
+
+	return t, nil
+}
+
+// Start implements the Tracer interface.
+func (t *OTLPTracer) Start(name string, attrs Attributes) Span {
+	span := &otlpSpan{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+		attrs:  make(Attributes, len(attrs)),
+	}
+
+	for key, value := range attrs {
+		span.attrs[key] = value
+	}
+
+	return span
+}
+
+// Dropped returns the number of spans that have been dropped because the
+// exporter could not keep up.
+func (t *OTLPTracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close will export the remaining spans and return the first error that
+// occurred while exporting.
+func (t *OTLPTracer) Close() error {
+	t.once.Do(func() {
+		close(t.closing)
+	})
+
+	<-t.closed
+
+	return t.err
+}
+
+// queues an ended span without blocking the client
+func (t *OTLPTracer) queue(span *otlpSpan) {
+	select {
+	case <-t.closing:
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	default:
+	}
+
+	select {
+	case t.spans <- span:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// batches and exports the queued spans
+func (t *OTLPTracer) export() {
+	defer close(t.closed)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var batch []*otlpSpan
+	flush := func() {
+		if len(batch) > 0 {
+			err := t.send(batch)
+			if err != nil && t.err == nil {
+				t.err = err
+			}
+
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case span := <-t.spans:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.closing:
+			// drain queue
+			for {
+				select {
+				case span := <-t.spans:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sends a batch of spans as an export request
+func (t *OTLPTracer) send(batch []*otlpSpan) error {
+	spans := make([]map[string]interface{}, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.encode())
+	}
+
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(Attributes{"service.name": t.service}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "client"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: unexpected status %s", res.Status)
+	}
+
+	return nil
+}
+
+// an otlpSpan is a span recorded by an OTLPTracer
+type otlpSpan struct {
+	tracer *OTLPTracer
+	name   string
+	start  time.Time
+
+	mutex sync.Mutex
+	attrs Attributes
+	end   time.Time
+	err   error
+	ended bool
+}
+
+// SetAttribute implements the Span interface.
+func (s *otlpSpan) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attrs[key] = value
+}
+
+// End implements the Span interface.
+func (s *otlpSpan) End(err error) {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mutex.Unlock()
+
+	s.tracer.queue(s)
+}
+
+// returns the span in the OTLP JSON encoding
+func (s *otlpSpan) encode() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// the client does not propagate a context, so every span is the root of
+	// its own trace
+	span := map[string]interface{}{
+		"traceId":           otlpID(16),
+		"spanId":            otlpID(8),
+		"name":              s.name,
+		"kind":              otlpKind(s.name),
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attrs),
+	}
+
+	// set status
+	if s.err != nil {
+		span["status"] = map[string]interface{}{"code": 2, "message": s.err.Error()}
+	} else {
+		span["status"] = map[string]interface{}{"code": 1}
+	}
+
+	return span
+}
+
+// returns the span kind for the span names of the client
+func otlpKind(name string) int {
+	switch name {
+	case ConnectSpan:
+		return 3 // client
+	case PublishSpan:
+		return 4 // producer
+	case DeliverSpan:
+		return 5 // consumer
+	}
+
+	return 1 // internal
+}
+
+// returns a random hex encoded id of the specified length in bytes
+func otlpID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// returns the attributes as OTLP key value pairs
+func otlpAttributes(attrs Attributes) []interface{} {
+	list := make([]interface{}, 0, len(attrs))
+	for key, value := range attrs {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": value}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+		case uint64:
+			v = map[string]interface{}{"intValue": strconv.FormatUint(value, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+
+		list = append(list, map[string]interface{}{"key": key, "value": v})
+	}
+
+	return list
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPTracer(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+	}))
+	defer server.Close()
+
+	tracer, err := NewOTLPTracer(server.URL, "test")
+	require.NoError(t, err)
+
+	span := tracer.Start(PublishSpan, Attributes{"messaging.destination": "foo"})
+	span.SetAttribute("messaging.message_id", 7)
+	span.End(nil)
+	span.End(nil)
+
+	tracer.Start(ConnectSpan, nil).End(errors.New("refused"))
+
+	require.NoError(t, tracer.Close())
+	assert.Equal(t, uint64(0), tracer.Dropped())
+	require.Len(t, requests, 1)
+
+	resourceSpans := requests[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resource := resourceSpans["resource"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "test"}},
+	}, resource["attributes"])
+
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	require.Len(t, spans, 2)
+
+	publish := spans[0].(map[string]interface{})
+	assert.Equal(t, PublishSpan, publish["name"])
+	assert.Equal(t, 4.0, publish["kind"])
+	assert.Len(t, publish["traceId"], 32)
+	assert.Len(t, publish["spanId"], 16)
+	assert.Equal(t, map[string]interface{}{"code": 1.0}, publish["status"])
+	assert.ElementsMatch(t, []interface{}{
+		map[string]interface{}{"key": "messaging.destination", "value": map[string]interface{}{"stringValue": "foo"}},
+		map[string]interface{}{"key": "messaging.message_id", "value": map[string]interface{}{"intValue": "7"}},
+	}, publish["attributes"])
+
+	connect := spans[1].(map[string]interface{})
+	assert.Equal(t, ConnectSpan, connect["name"])
+	assert.Equal(t, 3.0, connect["kind"])
+	assert.Equal(t, map[string]interface{}{"code": 2.0, "message": "refused"}, connect["status"])
+
+	// spans after close are dropped
+	tracer.Start(DeliverSpan, nil).End(nil)
+	assert.Equal(t, uint64(1), tracer.Dropped())
+}
+
+func TestOTLPTracerErrors(t *testing.T) {
+	_, err := NewOTLPTracer("grpc://127.0.0.1:4317", "test")
+	assert.Error(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	tracer, err := NewOTLPTracer(server.URL+"/custom", "test")
+	require.NoError(t, err)
+
+	tracer.Start(PublishSpan, nil).End(nil)
+	assert.Error(t, tracer.Close())
+}
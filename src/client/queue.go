@@ -0,0 +1,276 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"client/future"
+	"clientsession"
+	"gopkg.in/tomb.v2"
+	"packet"
+)
+
+// ErrSendQueueFull is returned by Publish and PublishMessage if the send queue
+// is full and the QueueError policy is configured. It is also used to end the
+// spans of dropped messages.
+var ErrSendQueueFull = errors.New("send queue full")
+
+// A QueuePolicy defines how the send queue handles new messages when it is
+// full.
+type QueuePolicy int
+
+// All available queue policies.
+const (
+	// QueueBlock blocks the publishing call until there is space in the queue.
+	QueueBlock QueuePolicy = iota
+
+	// QueueDropOldest removes the oldest queued message to make space for the
+	// new message.
+	QueueDropOldest
+
+	// QueueDropNewest drops the new message. The returned future is canceled.
+	QueueDropNewest
+
+	// QueueError drops the new message and returns ErrSendQueueFull.
+	QueueError
+)
+
+// ErrInvalidQueuePolicy is returned by ParseQueuePolicy if the policy name is
+// unknown.
+var ErrInvalidQueuePolicy = errors.New("invalid queue policy")
+
+// ParseQueuePolicy parses a policy name like "block", "drop-oldest",
+// "drop-newest" or "error".
+func ParseQueuePolicy(str string) (QueuePolicy, error) {
+	switch str {
+	case "block":
+		return QueueBlock, nil
+	case "drop-oldest":
+		return QueueDropOldest, nil
+	case "drop-newest":
+		return QueueDropNewest, nil
+	case "error":
+		return QueueError, nil
+	}
+
+	return 0, ErrInvalidQueuePolicy
+}
+
+// String returns the name of the policy.
+func (p QueuePolicy) String() string {
+	switch p {
+	case QueueBlock:
+		return "block"
+	case QueueDropOldest:
+		return "drop-oldest"
+	case QueueDropNewest:
+		return "drop-newest"
+	case QueueError:
+		return "error"
+	}
+
+	return "unknown"
+}
+
+// QueueStats contains the counters of a send queue.
+type QueueStats struct {
+	// The number of messages that have been added to the queue.
+	Queued uint64
+
+	// The number of messages that have been written to the connection.
+	Sent uint64
+
+	// The number of messages that have been dropped because the queue was full.
+	Dropped uint64
+
+	// The number of messages currently waiting in the queue.
+	Length int
+}
+
+// a queued outgoing publish packet and its future, qos 0 packets also carry
+// their span and the sequence they are stored with
+type queuedPublish struct {
+	publish *packet.PublishPacket
+	future  *future.Future
+	span    Span
+	seq     uint64
+}
+
+// a queuedStore keeps track of queued qos 0 publishes, which have no packet id
+// and are therefore keyed by a separate sequence
+type queuedStore struct {
+	sync.Mutex
+
+	seq   uint64
+	store map[uint64]*queuedPublish
+}
+
+// returns a new queuedStore
+func newQueuedStore() *queuedStore {
+	return &queuedStore{
+		store: make(map[uint64]*queuedPublish),
+	}
+}
+
+// assigns the next sequence to an item and stores it
+func (s *queuedStore) put(item *queuedPublish) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.seq++
+	item.seq = s.seq
+	s.store[item.seq] = item
+}
+
+// removes an item and ends its span if it is still stored
+func (s *queuedStore) remove(item *queuedPublish, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.store[item.seq]; ok {
+		delete(s.store, item.seq)
+		if item.span != nil {
+			item.span.End(err)
+		}
+	}
+}
+
+// cancels and removes all items and ends their spans
+func (s *queuedStore) clear(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for seq, item := range s.store {
+		delete(s.store, seq)
+		item.future.Cancel()
+		if item.span != nil {
+			item.span.End(err)
+		}
+	}
+}
+
+// waits until all items have been sent or dropped or the timeout is reached
+func (s *queuedStore) await(timeout time.Duration) {
+	stop := time.Now().Add(timeout)
+
+	for {
+		var next *queuedPublish
+		s.Lock()
+		for _, item := range s.store {
+			next = item
+			break
+		}
+		s.Unlock()
+
+		if next == nil || next.future.Wait(time.Until(stop)) != nil {
+			return
+		}
+	}
+}
+
+// SendQueueStats returns the counters of the send queue. All counters are zero
+// if no send queue has been configured.
+func (c *Client) SendQueueStats() QueueStats {
+	return QueueStats{
+		Queued:  atomic.LoadUint64(&c.queueStats.Queued),
+		Sent:    atomic.LoadUint64(&c.queueStats.Sent),
+		Dropped: atomic.LoadUint64(&c.queueStats.Dropped),
+		Length:  len(c.queue),
+	}
+}
+
+// adds an item to the queue according to the configured policy
+func (c *Client) enqueue(item *queuedPublish) error {
+	for {
+		// try to add item
+		select {
+		case c.queue <- item:
+			atomic.AddUint64(&c.queueStats.Queued, 1)
+			return nil
+		default:
+		}
+
+		// handle full queue
+		switch c.config.SendQueuePolicy {
+		case QueueBlock:
+			select {
+			case c.queue <- item:
+				atomic.AddUint64(&c.queueStats.Queued, 1)
+				return nil
+			case <-c.tomb.Dying():
+				return ErrClientNotConnected
+			}
+		case QueueDropOldest:
+			select {
+			case old := <-c.queue:
+				err := c.drop(old)
+				if err != nil {
+					return err
+				}
+			default:
+			}
+		case QueueDropNewest:
+			return c.drop(item)
+		default:
+			err := c.drop(item)
+			if err != nil {
+				return err
+			}
+
+			return ErrSendQueueFull
+		}
+	}
+}
+
+// cancels a queued item and removes it from the session
+func (c *Client) drop(item *queuedPublish) error {
+	atomic.AddUint64(&c.queueStats.Dropped, 1)
+
+	// remove and cancel future and end span
+	if item.publish.Message.QOS > 0 {
+		c.futureStore.Delete(item.publish.ID)
+		c.publishSpans.end(item.publish.ID, ErrSendQueueFull)
+	} else {
+		c.queued.remove(item, ErrSendQueueFull)
+	}
+
+	item.future.Cancel()
+
+	// remove stored packet
+	if item.publish.Message.QOS > 0 {
+		err := c.Session.DeletePacket(clientsession.Outgoing, item.publish.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* sender goroutine */
+
+// sends queued packets
+func (c *Client) sender() error {
+	for {
+		select {
+		case <-c.tomb.Dying():
+			return tomb.ErrDying
+		case item := <-c.queue:
+			// send packet
+			err := c.send(item.publish, true)
+			if err != nil {
+				return c.die(err, false, false)
+			}
+
+			atomic.AddUint64(&c.queueStats.Sent, 1)
+
+			// remove and complete qos 0 future and span
+			if item.publish.Message.QOS == 0 {
+				c.queued.remove(item, nil)
+				item.future.Complete()
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"client/future"
+	"clientsession"
+	"github.com/stretchr/testify/assert"
+	"packet"
+	"transport/flow"
+)
+
+func TestParseQueuePolicy(t *testing.T) {
+	for _, policy := range []QueuePolicy{QueueBlock, QueueDropOldest, QueueDropNewest, QueueError} {
+		parsed, err := ParseQueuePolicy(policy.String())
+		assert.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := ParseQueuePolicy("foo")
+	assert.Equal(t, ErrInvalidQueuePolicy, err)
+}
+
+func queuedClient(policy QueuePolicy) *Client {
+	c := New()
+	c.config = &Config{SendQueueSize: 1, SendQueuePolicy: policy}
+	c.queue = make(chan *queuedPublish, 1)
+	return c
+}
+
+func queuedItem(c *Client, id packet.ID) *queuedPublish {
+	publish := packet.NewPublishPacket()
+	publish.ID = id
+	publish.Message.Topic = "test"
+	publish.Message.QOS = 1
+
+	item := &queuedPublish{publish: publish, future: future.New()}
+	c.futureStore.Put(id, item.future)
+	c.Session.SavePacket(clientsession.Outgoing, publish)
+
+	return item
+}
+
+func TestClientSendQueueDropOldest(t *testing.T) {
+	c := queuedClient(QueueDropOldest)
+
+	item1 := queuedItem(c, 1)
+	item2 := queuedItem(c, 2)
+
+	assert.NoError(t, c.enqueue(item1))
+	assert.NoError(t, c.enqueue(item2))
+
+	assert.Equal(t, future.ErrCanceled, item1.future.Wait(10*time.Millisecond))
+	assert.Nil(t, c.futureStore.Get(1))
+
+	pkt, err := c.Session.LookupPacket(clientsession.Outgoing, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, pkt)
+
+	assert.Equal(t, item2, <-c.queue)
+	assert.Equal(t, QueueStats{Queued: 2, Dropped: 1}, c.SendQueueStats())
+}
+
+func TestClientSendQueueDropNewest(t *testing.T) {
+	c := queuedClient(QueueDropNewest)
+
+	item1 := queuedItem(c, 1)
+	item2 := queuedItem(c, 2)
+
+	assert.NoError(t, c.enqueue(item1))
+	assert.NoError(t, c.enqueue(item2))
+
+	assert.Equal(t, future.ErrCanceled, item2.future.Wait(10*time.Millisecond))
+	assert.Equal(t, QueueStats{Queued: 1, Dropped: 1, Length: 1}, c.SendQueueStats())
+}
+
+func TestClientSendQueueError(t *testing.T) {
+	c := queuedClient(QueueError)
+
+	item1 := queuedItem(c, 1)
+	item2 := queuedItem(c, 2)
+
+	assert.NoError(t, c.enqueue(item1))
+	assert.Equal(t, ErrSendQueueFull, c.enqueue(item2))
+
+	assert.Equal(t, future.ErrCanceled, item2.future.Wait(10*time.Millisecond))
+	assert.Equal(t, QueueStats{Queued: 1, Dropped: 1, Length: 1}, c.SendQueueStats())
+}
+
+func TestClientSendQueueBlock(t *testing.T) {
+	c := queuedClient(QueueBlock)
+
+	item1 := queuedItem(c, 1)
+	item2 := queuedItem(c, 2)
+
+	assert.NoError(t, c.enqueue(item1))
+
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, c.enqueue(item2))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		assert.Fail(t, "enqueue should block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	assert.Equal(t, item1, <-c.queue)
+	safeReceive(done)
+	assert.Equal(t, QueueStats{Queued: 2, Length: 1}, c.SendQueueStats())
+
+	item3 := queuedItem(c, 3)
+
+	c.tomb.Kill(nil)
+	assert.Equal(t, ErrClientNotConnected, c.enqueue(item3))
+}
+
+func TestClientSendQueue(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	publish1 := packet.NewPublishPacket()
+	publish1.Message = publish.Message
+	publish1.Message.QOS = 1
+	publish1.ID = 1
+
+	puback := packet.NewPubackPacket()
+	puback.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		Receive(publish1).
+		Send(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	c := New()
+	c.Callback = errorCallback(t)
+
+	config := NewConfig("tcp://localhost:" + port)
+	config.SendQueueSize = 10
+
+	connectFuture, err := c.Connect(config)
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	publishFuture, err := c.Publish("test", []byte("test"), 0, false)
+	assert.NoError(t, err)
+	assert.NoError(t, publishFuture.Wait(1*time.Second))
+
+	publishFuture, err = c.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, publishFuture.Wait(1*time.Second))
+
+	assert.Equal(t, QueueStats{Queued: 2, Sent: 2}, c.SendQueueStats())
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestClientSendQueueQOS0(t *testing.T) {
+	c := queuedClient(QueueDropOldest)
+	c.Tracer = &testTracer{}
+	atomic.StoreUint32(&c.state, clientConnected)
+
+	future1, err := c.Publish("test", []byte("1"), 0, false)
+	assert.NoError(t, err)
+
+	future2, err := c.Publish("test", []byte("2"), 0, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, future.ErrCanceled, future1.Wait(10*time.Millisecond))
+	assert.Len(t, c.queued.store, 1)
+
+	c.queued.clear(ErrClientNotConnected)
+	assert.Equal(t, future.ErrCanceled, future2.Wait(10*time.Millisecond))
+	assert.Empty(t, c.queued.store)
+
+	spans := c.Tracer.(*testTracer).all()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, ErrSendQueueFull, spans[0].err)
+	assert.Equal(t, ErrClientNotConnected, spans[1].err)
+}
+
+func TestClientSendQueueBlockUnlocked(t *testing.T) {
+	c := queuedClient(QueueBlock)
+	atomic.StoreUint32(&c.state, clientConnected)
+
+	_, err := c.Publish("test", []byte("1"), 0, false)
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		_, err := c.Publish("test", []byte("2"), 0, false)
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// the blocked publish must not hold the client lock
+	c.mutex.Lock()
+	c.mutex.Unlock()
+
+	<-c.queue
+	safeReceive(done)
+	assert.Len(t, c.queued.store, 2)
+}
@@ -1,11 +1,17 @@
 package client
 
 import (
+	"errors"
 	"time"
 
 	"packet"
 )
 
+// ErrSessionNotTakenOver is returned by VerifySessionTakeover if the broker
+// did not close the existing connection after a second client connected using
+// the same client id.
+var ErrSessionNotTakenOver = errors.New("session not taken over")
+
 // ClearSession will connect to the specified broker and request a clean session.
 func ClearSession(config *Config, timeout time.Duration) error {
 	// copy config
@@ -149,3 +155,73 @@ func ReceiveMessage(config *Config, topic string, qos byte, timeout time.Duratio
 
 	return msg, nil
 }
+
+// VerifySessionTakeover will connect to the specified broker and then connect
+// a second client using the same client id. As required by the spec, the broker
+// must close the first connection. If that does not happen within the timeout
+// ErrSessionNotTakenOver is returned.
+func VerifySessionTakeover(config *Config, timeout time.Duration) error {
+	// check client id
+	if config.ClientID == "" {
+		return ErrClientMissingID
+	}
+
+	// create first client
+	first := New()
+
+	// get notified when the first connection is closed
+	closed := make(chan struct{})
+	first.Callback = func(msg *packet.Message, err error) error {
+		if err != nil {
+			close(closed)
+		}
+
+		return nil
+	}
+
+	// connect first client
+	future, err := first.Connect(config)
+	if err != nil {
+		return err
+	}
+
+	// wait for future
+	err = future.Wait(timeout)
+	if err != nil {
+		return err
+	}
+
+	// create second client
+	second := New()
+
+	// connect second client
+	future, err = second.Connect(config)
+	if err != nil {
+		first.Close()
+		return err
+	}
+
+	// wait for future
+	err = future.Wait(timeout)
+	if err != nil {
+		first.Close()
+		return err
+	}
+
+	// wait for the first connection to be closed
+	select {
+	case <-closed:
+	case <-time.After(timeout):
+		first.Close()
+		second.Disconnect()
+		return ErrSessionNotTakenOver
+	}
+
+	// disconnect
+	err = second.Disconnect()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
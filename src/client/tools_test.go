@@ -1,11 +1,13 @@
 package client
 
 import (
+	"net"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"packet"
+	"transport"
 	"transport/flow"
 )
 
@@ -106,3 +108,87 @@ func TestReceiveMessage(t *testing.T) {
 
 	safeReceive(done)
 }
+
+func sessionTakeoverBroker(t *testing.T, takeover bool) (chan struct{}, string) {
+	done := make(chan struct{})
+
+	connect := connectPacket()
+	connect.ClientID = "test"
+
+	connected := make(chan struct{})
+
+	first := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Wait(connected)
+
+	if takeover {
+		first.Close()
+	} else {
+		first.End()
+	}
+
+	second := flow.New().
+		Receive(connect).
+		Send(connackPacket()).
+		Run(func() {
+			close(connected)
+		}).
+		Receive(disconnectPacket()).
+		End()
+
+	server, err := transport.Launch("tcp://localhost:0")
+	assert.NoError(t, err)
+
+	go func() {
+		conn1, err := server.Accept()
+		assert.NoError(t, err)
+
+		errCh := first.TestAsync(conn1, time.Second)
+
+		conn2, err := server.Accept()
+		assert.NoError(t, err)
+
+		err = second.Test(conn2)
+		assert.NoError(t, err)
+
+		err = <-errCh
+		assert.NoError(t, err)
+
+		err = server.Close()
+		assert.NoError(t, err)
+
+		close(done)
+	}()
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	return done, port
+}
+
+func TestVerifySessionTakeover(t *testing.T) {
+	done, port := sessionTakeoverBroker(t, true)
+
+	config := NewConfigWithClientID("tcp://localhost:"+port, "test")
+
+	err := VerifySessionTakeover(config, 100*time.Millisecond)
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func TestVerifySessionTakeoverError(t *testing.T) {
+	done, port := sessionTakeoverBroker(t, false)
+
+	config := NewConfigWithClientID("tcp://localhost:"+port, "test")
+
+	err := VerifySessionTakeover(config, 100*time.Millisecond)
+	assert.Equal(t, ErrSessionNotTakenOver, err)
+
+	safeReceive(done)
+}
+
+func TestVerifySessionTakeoverMissingID(t *testing.T) {
+	err := VerifySessionTakeover(NewConfig("tcp://localhost:1234"), time.Second)
+	assert.Equal(t, ErrClientMissingID, err)
+}
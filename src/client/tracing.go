@@ -0,0 +1,92 @@
+package client
+
+import (
+	"sync"
+
+	"packet"
+)
+
+// The span names used by the client.
+const (
+	ConnectSpan = "mqtt.connect"
+	PublishSpan = "mqtt.publish"
+	DeliverSpan = "mqtt.deliver"
+)
+
+// Attributes describe a span using the semantic keys of the messaging
+// conventions (e.g. "messaging.destination").
+type Attributes map[string]interface{}
+
+// A Tracer is used by the client to instrument the connect, publish and
+// acknowledgment paths. The interface mirrors the OpenTelemetry tracing API so
+// that an adapter for any OpenTelemetry tracer provider and exporter only
+// needs to forward the calls.
+type Tracer interface {
+	// Start will begin a new span with the specified name and attributes.
+	Start(name string, attrs Attributes) Span
+}
+
+// A Span represents a single traced operation.
+type Span interface {
+	// SetAttribute will add or overwrite an attribute of the span.
+	SetAttribute(key string, value interface{})
+
+	// End will finish the span. A non-nil error marks the span as failed.
+	End(err error)
+}
+
+// a spanStore keeps track of spans that wait for an acknowledgment
+type spanStore struct {
+	sync.Mutex
+
+	store map[packet.ID]Span
+}
+
+// returns a new spanStore
+func newSpanStore() *spanStore {
+	return &spanStore{
+		store: make(map[packet.ID]Span),
+	}
+}
+
+// stores a span
+func (s *spanStore) put(id packet.ID, span Span) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.store[id] = span
+}
+
+// ends and removes a span if present
+func (s *spanStore) end(id packet.ID, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	span, ok := s.store[id]
+	if ok {
+		delete(s.store, id)
+		span.End(err)
+	}
+}
+
+// ends and removes all spans
+func (s *spanStore) clear(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, span := range s.store {
+		delete(s.store, id)
+		span.End(err)
+	}
+}
+
+// returns the attributes of a message
+func messageAttributes(msg *packet.Message) Attributes {
+	return Attributes{
+		"messaging.system":               "mqtt",
+		"messaging.destination":          msg.Topic,
+		"messaging.message_payload_size": len(msg.Payload),
+		"messaging.mqtt.qos":             int(msg.QOS),
+		"messaging.mqtt.retain":          msg.Retain,
+	}
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"client/future"
+	"github.com/stretchr/testify/assert"
+	"packet"
+	"transport/flow"
+)
+
+type testSpan struct {
+	name  string
+	attrs Attributes
+	ended bool
+	err   error
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *testSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type testTracer struct {
+	sync.Mutex
+
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(name string, attrs Attributes) Span {
+	t.Lock()
+	defer t.Unlock()
+
+	span := &testSpan{name: name, attrs: attrs}
+	t.spans = append(t.spans, span)
+
+	return span
+}
+
+func (t *testTracer) all() []*testSpan {
+	t.Lock()
+	defer t.Unlock()
+
+	return append([]*testSpan{}, t.spans...)
+}
+
+func TestClientTracing(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+	publish.ID = 1
+
+	puback := packet.NewPubackPacket()
+	puback.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		Send(puback).
+		Send(publish).
+		Receive(puback).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	wait := make(chan struct{})
+
+	tracer := &testTracer{}
+
+	c := New()
+	c.Tracer = tracer
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.NoError(t, err)
+		close(wait)
+		return nil
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	publishFuture, err := c.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+	assert.NoError(t, publishFuture.Wait(1*time.Second))
+
+	safeReceive(wait)
+
+	err = c.Disconnect()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	spans := tracer.all()
+	assert.Len(t, spans, 3)
+
+	assert.Equal(t, ConnectSpan, spans[0].name)
+	assert.True(t, spans[0].ended)
+	assert.NoError(t, spans[0].err)
+	assert.Equal(t, int(packet.ConnectionAccepted), spans[0].attrs["messaging.mqtt.return_code"])
+
+	assert.Equal(t, PublishSpan, spans[1].name)
+	assert.True(t, spans[1].ended)
+	assert.NoError(t, spans[1].err)
+	assert.Equal(t, "test", spans[1].attrs["messaging.destination"])
+	assert.Equal(t, 1, spans[1].attrs["messaging.mqtt.qos"])
+	assert.Equal(t, 1, spans[1].attrs["messaging.message_id"])
+
+	assert.Equal(t, DeliverSpan, spans[2].name)
+	assert.True(t, spans[2].ended)
+	assert.NoError(t, spans[2].err)
+	assert.Equal(t, 4, spans[2].attrs["messaging.message_payload_size"])
+}
+
+func TestClientTracingCanceled(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+	publish.Message.QOS = 1
+	publish.ID = 1
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	tracer := &testTracer{}
+
+	c := New()
+	c.Tracer = tracer
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.NoError(t, connectFuture.Wait(1*time.Second))
+
+	publishFuture, err := c.Publish("test", []byte("test"), 1, false)
+	assert.NoError(t, err)
+
+	err = c.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, future.ErrCanceled, publishFuture.Wait(1*time.Second))
+
+	safeReceive(done)
+
+	spans := tracer.all()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, PublishSpan, spans[1].name)
+	assert.True(t, spans[1].ended)
+	assert.Equal(t, future.ErrCanceled, spans[1].err)
+}
+
+func TestClientTracingConnectionDenied(t *testing.T) {
+	connack := connackPacket()
+	connack.ReturnCode = packet.ErrNotAuthorized
+
+	broker := flow.New().
+		Receive(connectPacket()).
+		Send(connack).
+		End()
+
+	done, port := fakeBroker(t, broker)
+
+	wait := make(chan struct{})
+
+	tracer := &testTracer{}
+
+	c := New()
+	c.Tracer = tracer
+	c.Callback = func(msg *packet.Message, err error) error {
+		assert.True(t, errors.Is(err, ErrClientConnectionDenied))
+		close(wait)
+		return nil
+	}
+
+	connectFuture, err := c.Connect(NewConfig("tcp://localhost:" + port))
+	assert.NoError(t, err)
+	assert.Equal(t, future.ErrCanceled, connectFuture.Wait(1*time.Second))
+
+	safeReceive(wait)
+	safeReceive(done)
+
+	spans := tracer.all()
+	assert.Len(t, spans, 1)
+	assert.True(t, spans[0].ended)
+	assert.Equal(t, &ConnectionDeniedError{ReturnCode: packet.ErrNotAuthorized}, spans[0].err)
+	assert.Equal(t, int(packet.ErrNotAuthorized), spans[0].attrs["messaging.mqtt.return_code"])
+}
@@ -3,21 +3,25 @@ package client
 import (
 	"sync"
 	"time"
+
+	"clock"
 )
 
 // a tracker keeps track of keep alive intervals
 type tracker struct {
 	sync.RWMutex
 
+	clock   clock.Clock
 	last    time.Time
 	pings   uint8
 	timeout time.Duration
 }
 
 // returns a new tracker
-func newTracker(timeout time.Duration) *tracker {
+func newTracker(timeout time.Duration, c clock.Clock) *tracker {
 	return &tracker{
-		last:    time.Now(),
+		clock:   c,
+		last:    c.Now(),
 		timeout: timeout,
 	}
 }
@@ -27,7 +31,7 @@ func (t *tracker) reset() {
 	t.Lock()
 	defer t.Unlock()
 
-	t.last = time.Now()
+	t.last = t.clock.Now()
 }
 
 // returns the current time window
@@ -35,7 +39,7 @@ func (t *tracker) window() time.Duration {
 	t.RLock()
 	defer t.RUnlock()
 
-	return t.timeout - time.Since(t.last)
+	return t.timeout - clock.Since(t.clock, t.last)
 }
 
 // mark ping
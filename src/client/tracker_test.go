@@ -4,19 +4,22 @@ import (
 	"testing"
 	"time"
 
+	"clock"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestTracker(t *testing.T) {
-	tracker := newTracker(10 * time.Millisecond)
+	mock := clock.NewMock(time.Now())
+
+	tracker := newTracker(10*time.Millisecond, mock)
 	assert.False(t, tracker.pending())
-	assert.True(t, tracker.window() > 0)
+	assert.Equal(t, 10*time.Millisecond, tracker.window())
 
-	time.Sleep(10 * time.Millisecond)
-	assert.True(t, tracker.window() <= 0)
+	mock.Advance(10 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), tracker.window())
 
 	tracker.reset()
-	assert.True(t, tracker.window() > 0)
+	assert.Equal(t, 10*time.Millisecond, tracker.window())
 
 	tracker.ping()
 	assert.True(t, tracker.pending())
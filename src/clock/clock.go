@@ -0,0 +1,210 @@
+// Package clock provides an abstraction of time that allows replacing the
+// system clock with a manually advanced mock in tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and creates timers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a timer that fires after the duration.
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer sends the current time on its channel when it fires.
+type Timer interface {
+	// C returns the channel the time is sent on.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after the duration. It returns whether
+	// the timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// Real is the Clock backed by the system time.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t *realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// Since returns the time elapsed since t on the clock.
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// A Mock is a Clock that only advances when told to. Timers fire
+// synchronously during Advance and Set in the order of their deadlines, which
+// makes tests that depend on time instant and deterministic. It is safe for
+// concurrent use.
+type Mock struct {
+	now    time.Time
+	timers []*mockTimer
+	mutex  sync.Mutex
+	cond   *sync.Cond
+}
+
+// NewMock returns a new Mock that starts at the specified time.
+func NewMock(start time.Time) *Mock {
+	m := &Mock{
+		now: start,
+	}
+
+	m.cond = sync.NewCond(&m.mutex)
+
+	return m
+}
+
+// Now returns the current time of the mock.
+func (m *Mock) Now() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.now
+}
+
+// NewTimer returns a timer that fires once the mock has been advanced by the
+// duration. A timer with a non positive duration fires immediately.
+func (m *Mock) NewTimer(d time.Duration) Timer {
+	t := &mockTimer{
+		mock: m,
+		c:    make(chan time.Time, 1),
+	}
+
+	t.Reset(d)
+
+	return t
+}
+
+// Advance moves the time forward by the duration and fires the due timers.
+func (m *Mock) Advance(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
+
+// Set moves the time to the specified time and fires the due timers.
+func (m *Mock) Set(t time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.now = t
+
+	// fire due timers in order
+	sort.SliceStable(m.timers, func(i, j int) bool {
+		return m.timers[i].at.Before(m.timers[j].at)
+	})
+
+	for len(m.timers) > 0 && !m.timers[0].at.After(t) {
+		timer := m.timers[0]
+		m.timers = m.timers[1:]
+		timer.fire(t)
+	}
+
+	m.cond.Broadcast()
+}
+
+// Timers returns the number of pending timers.
+func (m *Mock) Timers() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.timers)
+}
+
+// BlockUntil waits until at least the specified number of timers are pending,
+// which allows a test to advance the mock only once the code under test has
+// started waiting.
+func (m *Mock) BlockUntil(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for len(m.timers) < n {
+		m.cond.Wait()
+	}
+}
+
+// removes a pending timer, the mutex must be held
+func (m *Mock) remove(t *mockTimer) bool {
+	for i, timer := range m.timers {
+		if timer == t {
+			m.timers = append(m.timers[:i], m.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+type mockTimer struct {
+	mock *Mock
+	at   time.Time
+	c    chan time.Time
+}
+
+func (t *mockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *mockTimer) Stop() bool {
+	t.mock.mutex.Lock()
+	defer t.mock.mutex.Unlock()
+
+	return t.mock.remove(t)
+}
+
+func (t *mockTimer) Reset(d time.Duration) bool {
+	t.mock.mutex.Lock()
+	defer t.mock.mutex.Unlock()
+
+	active := t.mock.remove(t)
+
+	t.at = t.mock.now.Add(d)
+	if d <= 0 {
+		t.fire(t.mock.now)
+		return active
+	}
+
+	t.mock.timers = append(t.mock.timers, t)
+	t.mock.cond.Broadcast()
+
+	return active
+}
+
+// sends the time without blocking like a system timer
+func (t *mockTimer) fire(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
@@ -0,0 +1,82 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReal(t *testing.T) {
+	start := Real.Now()
+
+	timer := Real.NewTimer(time.Millisecond)
+	<-timer.C()
+
+	assert.True(t, Since(Real, start) >= time.Millisecond)
+	assert.False(t, timer.Stop())
+}
+
+func TestMock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := NewMock(start)
+	assert.Equal(t, start, mock.Now())
+
+	t1 := mock.NewTimer(10 * time.Millisecond)
+	t2 := mock.NewTimer(5 * time.Millisecond)
+	assert.Equal(t, 2, mock.Timers())
+
+	mock.Advance(5 * time.Millisecond)
+	assert.Equal(t, start.Add(5*time.Millisecond), <-t2.C())
+	assert.Len(t, t1.C(), 0)
+	assert.Equal(t, 1, mock.Timers())
+
+	mock.Advance(5 * time.Millisecond)
+	assert.Equal(t, start.Add(10*time.Millisecond), <-t1.C())
+	assert.Equal(t, 0, mock.Timers())
+	assert.Equal(t, 10*time.Millisecond, Since(mock, start))
+}
+
+func TestMockStopReset(t *testing.T) {
+	mock := NewMock(time.Time{})
+
+	timer := mock.NewTimer(time.Second)
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+
+	mock.Advance(time.Second)
+	assert.Len(t, timer.C(), 0)
+
+	assert.False(t, timer.Reset(time.Second))
+	assert.True(t, timer.Reset(2*time.Second))
+
+	mock.Advance(time.Second)
+	assert.Len(t, timer.C(), 0)
+
+	mock.Advance(time.Second)
+	assert.Len(t, timer.C(), 1)
+
+	// immediate timers
+	timer = mock.NewTimer(0)
+	assert.Len(t, timer.C(), 1)
+}
+
+func TestMockBlockUntil(t *testing.T) {
+	mock := NewMock(time.Time{})
+
+	done := make(chan struct{})
+	go func() {
+		timer := mock.NewTimer(time.Hour)
+		<-timer.C()
+		close(done)
+	}()
+
+	mock.BlockUntil(1)
+	mock.Advance(time.Hour)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected timer to fire")
+	}
+}
@@ -0,0 +1,93 @@
+package packet
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MaxArenaPayload is the largest payload buffer capacity that is kept by a
+// released packet. Larger buffers are dropped on release so that a single
+// large message does not pin its memory in the arena.
+const MaxArenaPayload = 64 * 1024
+
+// ArenaStats holds counters about the packets handed out by an Arena.
+type ArenaStats struct {
+	// The number of packets handed out and the number of them that were
+	// reused from released packets.
+	Packets uint64
+	Reused  uint64
+
+	// The number of released packets.
+	Released uint64
+}
+
+// ReuseRate returns the share of handed out packets that were reused.
+func (s ArenaStats) ReuseRate() float64 {
+	if s.Packets == 0 {
+		return 0
+	}
+
+	return float64(s.Reused) / float64(s.Packets)
+}
+
+// An Arena pools decoded publish packets and their payload buffers. Decoders
+// that use an Arena take publish packets from it and decode payloads into the
+// buffer of a reused packet if it is large enough, which reduces the garbage
+// produced by subscribers that receive many messages. Packets are only
+// returned to the arena by an explicit Release; packets that are not released
+// are collected as usual. An Arena may be shared by multiple decoders.
+type Arena struct {
+	pool  sync.Pool
+	stats ArenaStats
+}
+
+// NewArena returns a new Arena.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// Publish returns a reset publish packet that may retain the payload buffer
+// of a released packet with a length of zero.
+func (a *Arena) Publish() *PublishPacket {
+	atomic.AddUint64(&a.stats.Packets, 1)
+
+	if pkt, ok := a.pool.Get().(*PublishPacket); ok {
+		atomic.AddUint64(&a.stats.Reused, 1)
+		return pkt
+	}
+
+	return NewPublishPacket()
+}
+
+// Release will reset the packet and return it to the arena. Packets of other
+// types are ignored. Neither the packet nor its payload or topic must be used
+// after it has been released, as they are handed out for the next decoded
+// packet.
+func (a *Arena) Release(pkt GenericPacket) {
+	publish, ok := pkt.(*PublishPacket)
+	if !ok || publish == nil {
+		return
+	}
+
+	// keep payload buffer
+	var payload []byte
+	if cap(publish.Message.Payload) <= MaxArenaPayload {
+		payload = publish.Message.Payload[:0]
+	}
+
+	*publish = PublishPacket{}
+	publish.Message.Payload = payload
+
+	atomic.AddUint64(&a.stats.Released, 1)
+	a.pool.Put(publish)
+}
+
+// Stats returns the current counters. It is safe to call Stats concurrently
+// with the other methods.
+func (a *Arena) Stats() ArenaStats {
+	return ArenaStats{
+		Packets:  atomic.LoadUint64(&a.stats.Packets),
+		Reused:   atomic.LoadUint64(&a.stats.Reused),
+		Released: atomic.LoadUint64(&a.stats.Released),
+	}
+}
@@ -0,0 +1,139 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArena(t *testing.T) {
+	arena := NewArena()
+
+	pkt := arena.Publish()
+	pkt.ID = 7
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = make([]byte, 3, 16)
+
+	arena.Release(pkt)
+	assert.Equal(t, ID(0), pkt.ID)
+	assert.Equal(t, "", pkt.Message.Topic)
+	assert.Len(t, pkt.Message.Payload, 0)
+	assert.Equal(t, 16, cap(pkt.Message.Payload))
+
+	// large payloads are dropped
+	pkt = NewPublishPacket()
+	pkt.Message.Payload = make([]byte, MaxArenaPayload+1)
+	arena.Release(pkt)
+	assert.Nil(t, pkt.Message.Payload)
+
+	// other packets are ignored
+	arena.Release(NewPingreqPacket())
+	arena.Release(nil)
+
+	stats := arena.Stats()
+	assert.Equal(t, uint64(1), stats.Packets)
+	assert.Equal(t, uint64(2), stats.Released)
+	assert.Equal(t, 0.0, stats.ReuseRate())
+}
+
+func TestDecoderArena(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	for _, payload := range []string{"hello", "bar", "", "world!"} {
+		pkt := NewPublishPacket()
+		pkt.Message.Topic = "foo"
+		pkt.Message.Payload = []byte(payload)
+
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	buf.Write([]byte{byte(PINGREQ << 4), 0})
+
+	dec := NewDecoder(buf)
+	dec.Arena = NewArena()
+
+	var payloads []string
+	for i := 0; i < 4; i++ {
+		pkt, err := dec.Read()
+		require.NoError(t, err)
+
+		publish := pkt.(*PublishPacket)
+		assert.Equal(t, "foo", publish.Message.Topic)
+		payloads = append(payloads, string(publish.Message.Payload))
+
+		dec.Arena.Release(pkt)
+	}
+
+	assert.Equal(t, []string{"hello", "bar", "", "world!"}, payloads)
+
+	pkt, err := dec.Read()
+	require.NoError(t, err)
+	assert.Equal(t, PINGREQ, pkt.Type())
+
+	stats := dec.Arena.Stats()
+	assert.Equal(t, uint64(4), stats.Packets)
+	assert.Equal(t, uint64(4), stats.Released)
+}
+
+func TestDecoderArenaAllocs(t *testing.T) {
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo/bar"
+	pkt.Message.Payload = make([]byte, 256)
+
+	data := make([]byte, pkt.Len())
+	pkt.Encode(data)
+
+	reader := bytes.NewReader(data)
+	dec := NewDecoder(reader)
+	dec.Interner = NewInterner(0)
+
+	read := func() {
+		reader.Reset(data)
+		pkt, err := dec.Read()
+		if err != nil {
+			panic(err)
+		}
+
+		if dec.Arena != nil {
+			dec.Arena.Release(pkt)
+		}
+	}
+
+	plain := testing.AllocsPerRun(100, read)
+
+	dec.Arena = NewArena()
+	read()
+
+	arena := testing.AllocsPerRun(100, read)
+	assert.True(t, arena < plain, "%v >= %v", arena, plain)
+}
+
+func BenchmarkDecoderArena(b *testing.B) {
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo/bar"
+	pkt.Message.Payload = make([]byte, 256)
+
+	data := make([]byte, pkt.Len())
+	pkt.Encode(data)
+
+	reader := bytes.NewReader(data)
+	dec := NewDecoder(reader)
+	dec.Arena = NewArena()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader.Reset(data)
+		pkt, err := dec.Read()
+		if err != nil {
+			panic(err)
+		}
+
+		dec.Arena.Release(pkt)
+	}
+}
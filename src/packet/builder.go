@@ -0,0 +1,402 @@
+package packet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validate encodes the packet to run the checks of the encoder
+func validate(pkt GenericPacket) error {
+	_, err := pkt.Encode(make([]byte, pkt.Len()))
+	return err
+}
+
+// validateFilter checks the placement of wildcards in a topic filter
+func validateFilter(t Type, filter string) error {
+	segments := strings.Split(filter, "/")
+	for i, segment := range segments {
+		if strings.Contains(segment, "#") && (segment != "#" || i != len(segments)-1) {
+			return fmt.Errorf("[%s] invalid multi-level wildcard in %q", t, filter)
+		}
+
+		if strings.Contains(segment, "+") && segment != "+" {
+			return fmt.Errorf("[%s] invalid single-level wildcard in %q", t, filter)
+		}
+	}
+
+	return nil
+}
+
+// A ConnectBuilder constructs a ConnectPacket.
+type ConnectBuilder struct {
+	packet *ConnectPacket
+}
+
+// Connect returns a builder for a ConnectPacket with the defaults of
+// NewConnectPacket.
+func Connect() *ConnectBuilder {
+	return &ConnectBuilder{
+		packet: NewConnectPacket(),
+	}
+}
+
+// ClientID sets the client id.
+func (b *ConnectBuilder) ClientID(id string) *ConnectBuilder {
+	b.packet.ClientID = id
+	return b
+}
+
+// KeepAlive sets the keep alive value in seconds.
+func (b *ConnectBuilder) KeepAlive(seconds uint16) *ConnectBuilder {
+	b.packet.KeepAlive = seconds
+	return b
+}
+
+// Username sets the authentication username.
+func (b *ConnectBuilder) Username(username string) *ConnectBuilder {
+	b.packet.Username = username
+	return b
+}
+
+// Password sets the authentication password.
+func (b *ConnectBuilder) Password(password string) *ConnectBuilder {
+	b.packet.Password = password
+	return b
+}
+
+// CleanSession sets the clean session flag.
+func (b *ConnectBuilder) CleanSession(clean bool) *ConnectBuilder {
+	b.packet.CleanSession = clean
+	return b
+}
+
+// Will sets the will message.
+func (b *ConnectBuilder) Will(topic string, payload []byte, qos byte, retain bool) *ConnectBuilder {
+	b.packet.Will = &Message{
+		Topic:   topic,
+		Payload: payload,
+		QOS:     qos,
+		Retain:  retain,
+	}
+
+	return b
+}
+
+// Version sets the MQTT version.
+func (b *ConnectBuilder) Version(version byte) *ConnectBuilder {
+	b.packet.Version = version
+	return b
+}
+
+// Build validates and returns the packet.
+func (b *ConnectBuilder) Build() (*ConnectPacket, error) {
+	// check will topic
+	if b.packet.Will != nil && strings.ContainsAny(b.packet.Will.Topic, "+#") {
+		return nil, fmt.Errorf("[%s] will topic contains wildcards", CONNECT)
+	}
+
+	err := validate(b.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.packet, nil
+}
+
+// MustBuild returns the packet like Build and panics if it is invalid.
+func (b *ConnectBuilder) MustBuild() *ConnectPacket {
+	pkt, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return pkt
+}
+
+// A ConnackBuilder constructs a ConnackPacket.
+type ConnackBuilder struct {
+	packet *ConnackPacket
+}
+
+// Connack returns a builder for a ConnackPacket that accepts the connection.
+func Connack() *ConnackBuilder {
+	return &ConnackBuilder{
+		packet: NewConnackPacket(),
+	}
+}
+
+// SessionPresent sets the session present flag.
+func (b *ConnackBuilder) SessionPresent(present bool) *ConnackBuilder {
+	b.packet.SessionPresent = present
+	return b
+}
+
+// ReturnCode sets the return code.
+func (b *ConnackBuilder) ReturnCode(code ConnackCode) *ConnackBuilder {
+	b.packet.ReturnCode = code
+	return b
+}
+
+// Build validates and returns the packet.
+func (b *ConnackBuilder) Build() (*ConnackPacket, error) {
+	// a session can only be present if the connection is accepted
+	if b.packet.SessionPresent && b.packet.ReturnCode != ConnectionAccepted {
+		return nil, fmt.Errorf("[%s] session present set on a denied connection", CONNACK)
+	}
+
+	err := validate(b.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.packet, nil
+}
+
+// MustBuild returns the packet like Build and panics if it is invalid.
+func (b *ConnackBuilder) MustBuild() *ConnackPacket {
+	pkt, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return pkt
+}
+
+// A PublishBuilder constructs a PublishPacket.
+type PublishBuilder struct {
+	packet *PublishPacket
+}
+
+// Publish returns a builder for a PublishPacket with the specified topic.
+func Publish(topic string) *PublishBuilder {
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = topic
+
+	return &PublishBuilder{
+		packet: pkt,
+	}
+}
+
+// Payload sets the payload.
+func (b *PublishBuilder) Payload(payload []byte) *PublishBuilder {
+	b.packet.Message.Payload = payload
+	return b
+}
+
+// QOS sets the QOS level.
+func (b *PublishBuilder) QOS(qos byte) *PublishBuilder {
+	b.packet.Message.QOS = qos
+	return b
+}
+
+// Retain sets the retain flag.
+func (b *PublishBuilder) Retain(retain bool) *PublishBuilder {
+	b.packet.Message.Retain = retain
+	return b
+}
+
+// ID sets the packet identifier.
+func (b *PublishBuilder) ID(id ID) *PublishBuilder {
+	b.packet.ID = id
+	return b
+}
+
+// Dup sets the dup flag.
+func (b *PublishBuilder) Dup(dup bool) *PublishBuilder {
+	b.packet.Dup = dup
+	return b
+}
+
+// Build validates and returns the packet.
+func (b *PublishBuilder) Build() (*PublishPacket, error) {
+	// check topic
+	if strings.ContainsAny(b.packet.Message.Topic, "+#") {
+		return nil, fmt.Errorf("[%s] topic name contains wildcards", PUBLISH)
+	}
+
+	// check dup flag
+	if b.packet.Dup && b.packet.Message.QOS == 0 {
+		return nil, fmt.Errorf("[%s] dup flag set on a qos 0 message", PUBLISH)
+	}
+
+	err := validate(b.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.packet, nil
+}
+
+// MustBuild returns the packet like Build and panics if it is invalid.
+func (b *PublishBuilder) MustBuild() *PublishPacket {
+	pkt, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return pkt
+}
+
+// A SubscribeBuilder constructs a SubscribePacket.
+type SubscribeBuilder struct {
+	packet *SubscribePacket
+}
+
+// Subscribe returns a builder for a SubscribePacket with the specified
+// packet identifier.
+func Subscribe(id ID) *SubscribeBuilder {
+	pkt := NewSubscribePacket()
+	pkt.ID = id
+
+	return &SubscribeBuilder{
+		packet: pkt,
+	}
+}
+
+// Topic adds a subscription.
+func (b *SubscribeBuilder) Topic(filter string, qos uint8) *SubscribeBuilder {
+	b.packet.Subscriptions = append(b.packet.Subscriptions, Subscription{
+		Topic: filter,
+		QOS:   qos,
+	})
+
+	return b
+}
+
+// Build validates and returns the packet.
+func (b *SubscribeBuilder) Build() (*SubscribePacket, error) {
+	// check subscriptions
+	if len(b.packet.Subscriptions) == 0 {
+		return nil, fmt.Errorf("[%s] empty subscription list", SUBSCRIBE)
+	}
+
+	for _, sub := range b.packet.Subscriptions {
+		if sub.Topic == "" {
+			return nil, fmt.Errorf("[%s] topic filter is empty", SUBSCRIBE)
+		} else if sub.QOS > 2 {
+			return nil, fmt.Errorf("[%s] invalid QOS level %d for %q", SUBSCRIBE, sub.QOS, sub.Topic)
+		}
+
+		err := validateFilter(SUBSCRIBE, sub.Topic)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := validate(b.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.packet, nil
+}
+
+// MustBuild returns the packet like Build and panics if it is invalid.
+func (b *SubscribeBuilder) MustBuild() *SubscribePacket {
+	pkt, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return pkt
+}
+
+// A SubackBuilder constructs a SubackPacket.
+type SubackBuilder struct {
+	packet *SubackPacket
+}
+
+// Suback returns a builder for a SubackPacket with the specified packet
+// identifier.
+func Suback(id ID) *SubackBuilder {
+	pkt := NewSubackPacket()
+	pkt.ID = id
+
+	return &SubackBuilder{
+		packet: pkt,
+	}
+}
+
+// ReturnCodes adds the granted QOS levels or QOSFailure.
+func (b *SubackBuilder) ReturnCodes(codes ...uint8) *SubackBuilder {
+	b.packet.ReturnCodes = append(b.packet.ReturnCodes, codes...)
+	return b
+}
+
+// Build validates and returns the packet.
+func (b *SubackBuilder) Build() (*SubackPacket, error) {
+	err := validate(b.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.packet, nil
+}
+
+// MustBuild returns the packet like Build and panics if it is invalid.
+func (b *SubackBuilder) MustBuild() *SubackPacket {
+	pkt, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return pkt
+}
+
+// An UnsubscribeBuilder constructs an UnsubscribePacket.
+type UnsubscribeBuilder struct {
+	packet *UnsubscribePacket
+}
+
+// Unsubscribe returns a builder for an UnsubscribePacket with the specified
+// packet identifier.
+func Unsubscribe(id ID) *UnsubscribeBuilder {
+	pkt := NewUnsubscribePacket()
+	pkt.ID = id
+
+	return &UnsubscribeBuilder{
+		packet: pkt,
+	}
+}
+
+// Topics adds topic filters.
+func (b *UnsubscribeBuilder) Topics(filters ...string) *UnsubscribeBuilder {
+	b.packet.Topics = append(b.packet.Topics, filters...)
+	return b
+}
+
+// Build validates and returns the packet.
+func (b *UnsubscribeBuilder) Build() (*UnsubscribePacket, error) {
+	// check topics
+	if len(b.packet.Topics) == 0 {
+		return nil, fmt.Errorf("[%s] empty topic list", UNSUBSCRIBE)
+	}
+
+	for _, filter := range b.packet.Topics {
+		if filter == "" {
+			return nil, fmt.Errorf("[%s] topic filter is empty", UNSUBSCRIBE)
+		}
+
+		err := validateFilter(UNSUBSCRIBE, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := validate(b.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.packet, nil
+}
+
+// MustBuild returns the packet like Build and panics if it is invalid.
+func (b *UnsubscribeBuilder) MustBuild() *UnsubscribePacket {
+	pkt, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return pkt
+}
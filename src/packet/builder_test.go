@@ -0,0 +1,134 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectBuilder(t *testing.T) {
+	pkt, err := Connect().
+		ClientID("x").
+		KeepAlive(30).
+		Username("u").
+		Password("p").
+		CleanSession(false).
+		Will("w", []byte("m"), QOSAtLeastOnce, true).
+		Build()
+	assert.NoError(t, err)
+
+	expected := NewConnectPacket()
+	expected.ClientID = "x"
+	expected.KeepAlive = 30
+	expected.Username = "u"
+	expected.Password = "p"
+	expected.CleanSession = false
+	expected.Will = &Message{Topic: "w", Payload: []byte("m"), QOS: QOSAtLeastOnce, Retain: true}
+	assert.Equal(t, expected, pkt)
+}
+
+func TestConnectBuilderError(t *testing.T) {
+	_, err := Connect().CleanSession(false).Build()
+	assert.Error(t, err)
+
+	_, err = Connect().Password("p").Build()
+	assert.Error(t, err)
+
+	_, err = Connect().Will("", nil, 0, false).Build()
+	assert.Error(t, err)
+
+	_, err = Connect().Will("w/#", nil, 0, false).Build()
+	assert.Error(t, err)
+
+	_, err = Connect().Will("w", nil, 3, false).Build()
+	assert.Error(t, err)
+
+	_, err = Connect().Version(5).Build()
+	assert.Error(t, err)
+
+	assert.Panics(t, func() {
+		Connect().Version(5).MustBuild()
+	})
+}
+
+func TestConnackBuilder(t *testing.T) {
+	pkt := Connack().SessionPresent(true).MustBuild()
+	assert.True(t, pkt.SessionPresent)
+	assert.Equal(t, ConnectionAccepted, pkt.ReturnCode)
+
+	_, err := Connack().SessionPresent(true).ReturnCode(ErrNotAuthorized).Build()
+	assert.Error(t, err)
+
+	_, err = Connack().ReturnCode(11).Build()
+	assert.Error(t, err)
+}
+
+func TestPublishBuilder(t *testing.T) {
+	pkt := Publish("a/b").Payload([]byte("p")).QOS(1).ID(7).Retain(true).Dup(true).MustBuild()
+
+	expected := NewPublishPacket()
+	expected.ID = 7
+	expected.Dup = true
+	expected.Message = Message{Topic: "a/b", Payload: []byte("p"), QOS: 1, Retain: true}
+	assert.Equal(t, expected, pkt)
+}
+
+func TestPublishBuilderError(t *testing.T) {
+	_, err := Publish("").Build()
+	assert.Error(t, err)
+
+	_, err = Publish("a/+").Build()
+	assert.Error(t, err)
+
+	_, err = Publish("a").QOS(1).Build()
+	assert.Error(t, err)
+
+	_, err = Publish("a").QOS(3).ID(1).Build()
+	assert.Error(t, err)
+
+	_, err = Publish("a").Dup(true).Build()
+	assert.Error(t, err)
+}
+
+func TestSubscribeBuilder(t *testing.T) {
+	pkt := Subscribe(1).Topic("a/+", 0).Topic("b/#", 1).MustBuild()
+	assert.Equal(t, ID(1), pkt.ID)
+	assert.Equal(t, []Subscription{{Topic: "a/+", QOS: 0}, {Topic: "b/#", QOS: 1}}, pkt.Subscriptions)
+}
+
+func TestSubscribeBuilderError(t *testing.T) {
+	_, err := Subscribe(1).Build()
+	assert.Error(t, err)
+
+	_, err = Subscribe(0).Topic("a", 0).Build()
+	assert.Error(t, err)
+
+	for _, filter := range []string{"", "a/#/b", "a/b#", "a+/b"} {
+		_, err = Subscribe(1).Topic(filter, 0).Build()
+		assert.Error(t, err, filter)
+	}
+
+	_, err = Subscribe(1).Topic("a", 3).Build()
+	assert.Error(t, err)
+}
+
+func TestSubackBuilder(t *testing.T) {
+	pkt := Suback(1).ReturnCodes(0, 1).ReturnCodes(QOSFailure).MustBuild()
+	assert.Equal(t, ID(1), pkt.ID)
+	assert.Equal(t, []uint8{0, 1, QOSFailure}, pkt.ReturnCodes)
+
+	_, err := Suback(1).ReturnCodes(3).Build()
+	assert.Error(t, err)
+}
+
+func TestUnsubscribeBuilder(t *testing.T) {
+	pkt := Unsubscribe(1).Topics("a", "b/#").MustBuild()
+	assert.Equal(t, ID(1), pkt.ID)
+	assert.Equal(t, []string{"a", "b/#"}, pkt.Topics)
+
+	_, err := Unsubscribe(1).Build()
+	assert.Error(t, err)
+
+	_, err = Unsubscribe(1).Topics("a/#/b").Build()
+	assert.Error(t, err)
+}
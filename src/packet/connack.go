@@ -40,6 +40,27 @@ func (cc ConnackCode) Error() string {
 	return "unknown error"
 }
 
+// Name returns a short name of the ConnackCode that can be used in metric
+// names, e.g. "server_unavailable".
+func (cc ConnackCode) Name() string {
+	switch cc {
+	case ConnectionAccepted:
+		return "accepted"
+	case ErrInvalidProtocolVersion:
+		return "unacceptable_protocol_version"
+	case ErrIdentifierRejected:
+		return "identifier_rejected"
+	case ErrServerUnavailable:
+		return "server_unavailable"
+	case ErrBadUsernameOrPassword:
+		return "bad_username_or_password"
+	case ErrNotAuthorized:
+		return "not_authorized"
+	}
+
+	return "unknown"
+}
+
 // A ConnackPacket is sent by the server in response to a ConnectPacket
 // received from a client.
 type ConnackPacket struct {
@@ -70,6 +91,12 @@ func (cp *ConnackPacket) String() string {
 		cp.SessionPresent, cp.ReturnCode)
 }
 
+// Clone returns a deep copy of the packet.
+func (cp *ConnackPacket) Clone() GenericPacket {
+	c := *cp
+	return &c
+}
+
 // Len returns the byte length of the encoded packet.
 func (cp *ConnackPacket) Len() int {
 	return headerLen(2) + 2
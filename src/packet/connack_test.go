@@ -16,6 +16,14 @@ func TestConnackReturnCodes(t *testing.T) {
 	assert.Equal(t, "unknown error", ConnackCode(6).Error())
 }
 
+func TestConnackCodeName(t *testing.T) {
+	assert.Equal(t, "accepted", ConnectionAccepted.Name())
+	assert.Equal(t, "server_unavailable", ErrServerUnavailable.Name())
+	assert.Equal(t, "bad_username_or_password", ErrBadUsernameOrPassword.Name())
+	assert.Equal(t, "not_authorized", ErrNotAuthorized.Name())
+	assert.Equal(t, "unknown", ConnackCode(6).Name())
+}
+
 func TestConnackInterface(t *testing.T) {
 	pkt := NewConnackPacket()
 
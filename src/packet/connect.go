@@ -73,6 +73,17 @@ func (cp *ConnectPacket) String() string {
 	)
 }
 
+// Clone returns a deep copy of the packet.
+func (cp *ConnectPacket) Clone() GenericPacket {
+	c := *cp
+
+	if cp.Will != nil {
+		c.Will = cp.Will.Clone()
+	}
+
+	return &c
+}
+
 // Len returns the byte length of the encoded packet.
 func (cp *ConnectPacket) Len() int {
 	ml := cp.len()
@@ -85,12 +96,15 @@ func (cp *ConnectPacket) Decode(src []byte) (int, error) {
 	total := 0
 
 	// decode header
-	hl, _, _, err := headerDecode(src[total:], CONNECT)
+	hl, _, rl, err := headerDecode(src[total:], CONNECT)
 	total += hl
 	if err != nil {
 		return total, err
 	}
 
+	// limit buffer to the packet
+	src = src[:hl+rl]
+
 	// read protocol string
 	protoName, n, err := readLPBytes(src[total:], false, cp.Type())
 	total += n
@@ -191,6 +205,11 @@ func (cp *ConnectPacket) Decode(src []byte) (int, error) {
 			return total, err
 		}
 
+		// check will topic
+		if len(cp.Will.Topic) == 0 {
+			return total, fmt.Errorf("[%s] will topic is empty", cp.Type())
+		}
+
 		cp.Will.Payload, n, err = readLPBytes(src[total:], true, cp.Type())
 		total += n
 		if err != nil {
@@ -63,7 +63,7 @@ func TestConnectPacketDecode1(t *testing.T) {
 func TestConnectPacketDecode2(t *testing.T) {
 	pktBytes := []byte{
 		byte(CONNECT << 4),
-		58,
+		60,
 		0, // Protocol String MSB
 		6, // Protocol String LSB
 		'M', 'Q', 'I', 's', 'd', 'p',
@@ -0,0 +1,154 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+)
+
+// An EqualOption relaxes the comparison performed by Equal.
+type EqualOption int
+
+const (
+	// IgnoreID ignores the packet identifiers, e.g. of publishes that have
+	// been assigned a new identifier by the broker.
+	IgnoreID EqualOption = iota + 1
+
+	// IgnoreDup ignores the DUP flag of publish packets, e.g. of messages that
+	// have been redelivered.
+	IgnoreDup
+)
+
+// equalOptions holds the enabled options of a comparison
+type equalOptions struct {
+	ignoreID  bool
+	ignoreDup bool
+}
+
+// Equal reports whether both packets are of the same type and have equal
+// fields. Payloads are compared byte by byte, also if they are streamed. A
+// streamed payload is read and its reader replaced with one over the read
+// bytes, so the packet can still be encoded afterwards. Packets of other
+// implementations are compared by their string representation.
+func Equal(a, b GenericPacket, opts ...EqualOption) bool {
+	var o equalOptions
+	for _, opt := range opts {
+		switch opt {
+		case IgnoreID:
+			o.ignoreID = true
+		case IgnoreDup:
+			o.ignoreDup = true
+		}
+	}
+
+	// check nil packets
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	// check types
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	sameID := func(a, b ID) bool {
+		return o.ignoreID || a == b
+	}
+
+	switch a := a.(type) {
+	case *ConnectPacket:
+		b, ok := b.(*ConnectPacket)
+		return ok && a.ClientID == b.ClientID && a.KeepAlive == b.KeepAlive &&
+			a.Username == b.Username && a.Password == b.Password &&
+			a.CleanSession == b.CleanSession && a.Version == b.Version &&
+			messageEqual(a.Will, b.Will)
+	case *ConnackPacket:
+		b, ok := b.(*ConnackPacket)
+		return ok && *a == *b
+	case *PublishPacket:
+		b, ok := b.(*PublishPacket)
+		return ok && sameID(a.ID, b.ID) && (o.ignoreDup || a.Dup == b.Dup) &&
+			messageEqual(&a.Message, &b.Message)
+	case *PubackPacket:
+		b, ok := b.(*PubackPacket)
+		return ok && sameID(a.ID, b.ID)
+	case *PubrecPacket:
+		b, ok := b.(*PubrecPacket)
+		return ok && sameID(a.ID, b.ID)
+	case *PubrelPacket:
+		b, ok := b.(*PubrelPacket)
+		return ok && sameID(a.ID, b.ID)
+	case *PubcompPacket:
+		b, ok := b.(*PubcompPacket)
+		return ok && sameID(a.ID, b.ID)
+	case *SubscribePacket:
+		b, ok := b.(*SubscribePacket)
+		if !ok || !sameID(a.ID, b.ID) || len(a.Subscriptions) != len(b.Subscriptions) {
+			return false
+		}
+
+		for i, subscription := range a.Subscriptions {
+			if subscription != b.Subscriptions[i] {
+				return false
+			}
+		}
+
+		return true
+	case *SubackPacket:
+		b, ok := b.(*SubackPacket)
+		return ok && sameID(a.ID, b.ID) && bytes.Equal(a.ReturnCodes, b.ReturnCodes)
+	case *UnsubscribePacket:
+		b, ok := b.(*UnsubscribePacket)
+		if !ok || !sameID(a.ID, b.ID) || len(a.Topics) != len(b.Topics) {
+			return false
+		}
+
+		for i, topic := range a.Topics {
+			if topic != b.Topics[i] {
+				return false
+			}
+		}
+
+		return true
+	case *UnsubackPacket:
+		b, ok := b.(*UnsubackPacket)
+		return ok && sameID(a.ID, b.ID)
+	case *PingreqPacket:
+		_, ok := b.(*PingreqPacket)
+		return ok
+	case *PingrespPacket:
+		_, ok := b.(*PingrespPacket)
+		return ok
+	case *DisconnectPacket:
+		_, ok := b.(*DisconnectPacket)
+		return ok
+	case *RawPacket:
+		b, ok := b.(*RawPacket)
+		return ok && bytes.Equal(a.Data, b.Data)
+	}
+
+	return a.String() == b.String()
+}
+
+// messageEqual reports whether both messages are nil or equal
+func messageEqual(a, b *Message) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Topic == b.Topic && a.QOS == b.QOS && a.Retain == b.Retain &&
+		a.payloadLen() == b.payloadLen() && bytes.Equal(a.readPayload(), b.readPayload())
+}
+
+// readPayload returns the payload of the message. A streamed payload is read
+// and the reader replaced with one over the read bytes.
+func (m *Message) readPayload() []byte {
+	if m.PayloadReader == nil {
+		return m.Payload
+	}
+
+	buf := make([]byte, m.PayloadLen)
+	n, _ := io.ReadFull(m.PayloadReader, buf)
+	m.PayloadReader = bytes.NewReader(buf[:n])
+
+	return buf[:n]
+}
@@ -0,0 +1,117 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEqual(t *testing.T) {
+	pkt1 := NewPublishPacket()
+	pkt1.ID = 1
+	pkt1.Message = Message{Topic: "foo", Payload: []byte{0, 1, 0xff}, QOS: 1}
+
+	pkt2 := pkt1.Clone().(*PublishPacket)
+	assert.True(t, Equal(pkt1, pkt2))
+	assert.True(t, Equal(nil, nil))
+	assert.False(t, Equal(pkt1, nil))
+	assert.False(t, Equal(pkt1, NewPubackPacket()))
+
+	pkt2.Message.Payload[2] = 0xfe
+	assert.False(t, Equal(pkt1, pkt2))
+
+	pkt2.Message.Payload[2] = 0xff
+	pkt2.Message.Retain = true
+	assert.False(t, Equal(pkt1, pkt2))
+
+	pkt2.Message.Retain = false
+	pkt2.ID = 2
+	pkt2.Dup = true
+	assert.False(t, Equal(pkt1, pkt2))
+	assert.False(t, Equal(pkt1, pkt2, IgnoreID))
+	assert.False(t, Equal(pkt1, pkt2, IgnoreDup))
+	assert.True(t, Equal(pkt1, pkt2, IgnoreID, IgnoreDup))
+
+	pkt2.Message.Payload = nil
+	pkt2.Message.PayloadReader = bytes.NewReader(pkt1.Message.Payload)
+	pkt2.Message.PayloadLen = 3
+	assert.True(t, Equal(pkt1, pkt2, IgnoreID, IgnoreDup))
+
+	// the streamed payload can still be written
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+	assert.NoError(t, enc.Write(pkt2))
+	assert.NoError(t, enc.Flush())
+	assert.Equal(t, pkt1.Message.Payload, buf.Bytes()[buf.Len()-3:])
+
+	pkt2.Message.PayloadReader = bytes.NewReader([]byte{0, 1, 0xfe})
+	assert.False(t, Equal(pkt1, pkt2, IgnoreID, IgnoreDup))
+	assert.False(t, Equal(pkt2, pkt1, IgnoreID, IgnoreDup))
+
+	// the zero option does not relax the comparison
+	pkt2.Message.PayloadReader = bytes.NewReader(pkt1.Message.Payload)
+	assert.False(t, Equal(pkt1, pkt2, EqualOption(0)))
+}
+
+func TestEqualTypes(t *testing.T) {
+	connect := NewConnectPacket()
+	connect.ClientID = "foo"
+	connect.Will = &Message{Topic: "will", Payload: []byte("bar")}
+
+	other := NewConnectPacket()
+	other.ClientID = "foo"
+	assert.False(t, Equal(connect, other))
+
+	other.Will = connect.Will.Clone()
+	assert.True(t, Equal(connect, other))
+
+	subscribe := NewSubscribePacket()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []Subscription{{Topic: "foo", QOS: 1}}
+
+	otherSubscribe := NewSubscribePacket()
+	otherSubscribe.ID = 2
+	otherSubscribe.Subscriptions = []Subscription{{Topic: "foo", QOS: 1}}
+	assert.False(t, Equal(subscribe, otherSubscribe))
+	assert.True(t, Equal(subscribe, otherSubscribe, IgnoreID))
+
+	otherSubscribe.Subscriptions[0].QOS = 2
+	assert.False(t, Equal(subscribe, otherSubscribe, IgnoreID))
+
+	suback := NewSubackPacket()
+	suback.ReturnCodes = []uint8{0, QOSFailure}
+	assert.True(t, Equal(suback, &SubackPacket{ReturnCodes: []uint8{0, QOSFailure}}))
+	assert.False(t, Equal(suback, &SubackPacket{ReturnCodes: []uint8{0}}))
+
+	unsubscribe := NewUnsubscribePacket()
+	unsubscribe.Topics = []string{"foo", "bar"}
+	assert.True(t, Equal(unsubscribe, &UnsubscribePacket{Topics: []string{"foo", "bar"}}))
+	assert.False(t, Equal(unsubscribe, &UnsubscribePacket{Topics: []string{"bar", "foo"}}))
+
+	assert.True(t, Equal(&PubrelPacket{ID: 1}, &PubrelPacket{ID: 1}))
+	assert.False(t, Equal(&PubrelPacket{ID: 1}, &PubrelPacket{ID: 2}))
+	assert.True(t, Equal(&PubrelPacket{ID: 1}, &PubrelPacket{ID: 2}, IgnoreID))
+	assert.True(t, Equal(NewPingreqPacket(), NewPingreqPacket()))
+	assert.False(t, Equal(NewConnackPacket(), &ConnackPacket{SessionPresent: true}))
+
+	// raw packets only equal raw packets
+	assert.True(t, Equal(NewRawPacket([]byte{0xc0, 0}), NewRawPacket([]byte{0xc0, 0})))
+	assert.False(t, Equal(NewRawPacket([]byte{0xc0, 0}), NewPingreqPacket()))
+	assert.False(t, Equal(NewRawPacket([]byte{0x40, 2, 0, 1}), &PubackPacket{ID: 1}))
+}
+
+func BenchmarkEqual(b *testing.B) {
+	pkt1 := NewPublishPacket()
+	pkt1.ID = 1
+	pkt1.Message = Message{Topic: "foo/bar", Payload: make([]byte, 256), QOS: 1}
+	pkt2 := pkt1.Clone()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if !Equal(pkt1, pkt2) {
+			b.Fatal("not equal")
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fuzzSeeds returns encoded packets of the type that are used as the corpus
+func fuzzSeeds(t Type) [][]byte {
+	var pkts []GenericPacket
+
+	switch t {
+	case CONNECT:
+		connect := NewConnectPacket()
+		connect.ClientID = "client"
+		connect.Username = "user"
+		connect.Password = "pass"
+		connect.Will = &Message{Topic: "will", Payload: []byte("bye"), QOS: 1}
+		pkts = append(pkts, NewConnectPacket(), connect)
+	case PUBLISH:
+		publish := NewPublishPacket()
+		publish.ID = 7
+		publish.Message = Message{Topic: "a/b", Payload: []byte("hello"), QOS: 1, Retain: true}
+		pkts = append(pkts, publish)
+	case SUBSCRIBE:
+		subscribe := NewSubscribePacket()
+		subscribe.ID = 7
+		subscribe.Subscriptions = []Subscription{{Topic: "a/#", QOS: 1}, {Topic: "b/+", QOS: 2}}
+		pkts = append(pkts, subscribe)
+	case SUBACK:
+		suback := NewSubackPacket()
+		suback.ID = 7
+		suback.ReturnCodes = []byte{0, 1, QOSFailure}
+		pkts = append(pkts, suback)
+	case UNSUBSCRIBE:
+		unsubscribe := NewUnsubscribePacket()
+		unsubscribe.ID = 7
+		unsubscribe.Topics = []string{"a/#", "b/+"}
+		pkts = append(pkts, unsubscribe)
+	default:
+		pkt, _ := t.New()
+		if id, ok := GetID(pkt); ok && id == 0 {
+			setID(pkt, 7)
+		}
+		pkts = append(pkts, pkt)
+	}
+
+	var seeds [][]byte
+	for _, pkt := range pkts {
+		buf := make([]byte, pkt.Len())
+		_, err := pkt.Encode(buf)
+		if err != nil {
+			panic(err)
+		}
+
+		seeds = append(seeds, buf)
+	}
+
+	return seeds
+}
+
+// setID sets the id of an acknowledgement packet
+func setID(pkt GenericPacket, id ID) {
+	switch pkt := pkt.(type) {
+	case *PubackPacket:
+		pkt.ID = id
+	case *PubrecPacket:
+		pkt.ID = id
+	case *PubrelPacket:
+		pkt.ID = id
+	case *PubcompPacket:
+		pkt.ID = id
+	case *UnsubackPacket:
+		pkt.ID = id
+	}
+}
+
+// fuzzDecode decodes the data as a packet of the type and checks that
+// successfully decoded packets can be encoded again
+func fuzzDecode(f *testing.F, t Type) {
+	for _, seed := range fuzzSeeds(t) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(tt *testing.T, data []byte) {
+		pkt, _ := t.New()
+
+		n, err := pkt.Decode(data)
+		if err != nil {
+			return
+		}
+
+		if n > len(data) {
+			tt.Fatalf("decoded %d bytes from %d bytes", n, len(data))
+		}
+
+		// encode decoded packet
+		buf := make([]byte, pkt.Len())
+		m, err := pkt.Encode(buf)
+		if err != nil {
+			tt.Fatalf("failed to encode decoded packet %s: %v", pkt, err)
+		}
+
+		// decode encoded packet
+		again, _ := t.New()
+		_, err = again.Decode(buf[:m])
+		if err != nil {
+			tt.Fatalf("failed to decode encoded packet %s: %v", pkt, err)
+		}
+
+		if pkt.String() != again.String() {
+			tt.Fatalf("expected %s but got %s", pkt, again)
+		}
+	})
+}
+
+func FuzzConnect(f *testing.F)     { fuzzDecode(f, CONNECT) }
+func FuzzConnack(f *testing.F)     { fuzzDecode(f, CONNACK) }
+func FuzzPublish(f *testing.F)     { fuzzDecode(f, PUBLISH) }
+func FuzzPuback(f *testing.F)      { fuzzDecode(f, PUBACK) }
+func FuzzPubrec(f *testing.F)      { fuzzDecode(f, PUBREC) }
+func FuzzPubrel(f *testing.F)      { fuzzDecode(f, PUBREL) }
+func FuzzPubcomp(f *testing.F)     { fuzzDecode(f, PUBCOMP) }
+func FuzzSubscribe(f *testing.F)   { fuzzDecode(f, SUBSCRIBE) }
+func FuzzSuback(f *testing.F)      { fuzzDecode(f, SUBACK) }
+func FuzzUnsubscribe(f *testing.F) { fuzzDecode(f, UNSUBSCRIBE) }
+func FuzzUnsuback(f *testing.F)    { fuzzDecode(f, UNSUBACK) }
+func FuzzPingreq(f *testing.F)     { fuzzDecode(f, PINGREQ) }
+func FuzzPingresp(f *testing.F)    { fuzzDecode(f, PINGRESP) }
+func FuzzDisconnect(f *testing.F)  { fuzzDecode(f, DISCONNECT) }
+
+func FuzzDecoder(f *testing.F) {
+	for t := CONNECT; t <= DISCONNECT; t++ {
+		for _, seed := range fuzzSeeds(t) {
+			f.Add(seed)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := NewDecoderSize(bytes.NewReader(data), 16)
+		dec.Limit = 1 << 16
+		dec.StreamThreshold = 8
+
+		for {
+			pkt, err := dec.Read()
+			if err != nil {
+				return
+			}
+
+			// consume streamed payloads
+			if publish, ok := pkt.(*PublishPacket); ok && publish.Message.PayloadReader != nil {
+				_, err = io.Copy(ioutil.Discard, publish.Message.PayloadReader)
+				if err != nil {
+					return
+				}
+			}
+		}
+	})
+}
@@ -57,6 +57,22 @@ func headerEncode(dst []byte, flags byte, rl int, tl int, t Type) (int, error) {
 }
 
 func headerDecode(src []byte, t Type) (int, byte, int, error) {
+	total, flags, rl, err := headerDecodePrefix(src, t)
+	if err != nil {
+		return total, flags, rl, err
+	}
+
+	// check remaining buffer
+	if rl > len(src[total:]) {
+		return total, 0, 0, fmt.Errorf("[%s] remaining length (%d) is greater than remaining buffer (%d)", t, rl, len(src[total:]))
+	}
+
+	return total, flags, rl, nil
+}
+
+// headerDecodePrefix decodes the header without checking that the remaining
+// length is available in the buffer
+func headerDecodePrefix(src []byte, t Type) (int, byte, int, error) {
 	total := 0
 
 	// check buffer size
@@ -88,11 +104,8 @@ func headerDecode(src []byte, t Type) (int, byte, int, error) {
 	// check resulting remaining length
 	if m <= 0 {
 		return total, 0, 0, fmt.Errorf("[%s] error reading remaining length", t)
-	}
-
-	// check remaining buffer
-	if rl > len(src[total:]) {
-		return total, 0, 0, fmt.Errorf("[%s] remaining length (%d) is greater than remaining buffer (%d)", t, rl, len(src[total:]))
+	} else if m > 4 || _rl > MaxRemainingLength {
+		return total, 0, 0, fmt.Errorf("[%s] remaining length out of bound (max %d)", t, MaxRemainingLength)
 	}
 
 	return total, flags, rl, nil
@@ -46,6 +46,18 @@ func TestPacketHeaderDecodeError5(t *testing.T) {
 	assert.Equal(t, 1, n)
 }
 
+func TestPacketHeaderDecodeError6(t *testing.T) {
+	// remaining length with five bytes
+	buf := []byte{0x62, 0xff, 0xff, 0xff, 0xff, 0x01, 0x00}
+
+	n, _, _, err := headerDecodePrefix(buf, 6)
+	assert.Error(t, err)
+	assert.Equal(t, 6, n)
+
+	length, _ := DetectPacket(buf)
+	assert.Equal(t, 0, length)
+}
+
 func TestPacketHeaderEncode1(t *testing.T) {
 	headerBytes := []byte{0x62, 193, 2}
 
@@ -102,6 +102,12 @@ func (pp *PubackPacket) String() string {
 	return fmt.Sprintf("<PubackPacket ID=%d>", pp.ID)
 }
 
+// Clone returns a deep copy of the packet.
+func (pp *PubackPacket) Clone() GenericPacket {
+	c := *pp
+	return &c
+}
+
 // A PubcompPacket is the response to a PubrelPacket. It is the fourth and
 // final packet of the QOS 2 protocol exchange.
 type PubcompPacket struct {
@@ -146,6 +152,12 @@ func (pp *PubcompPacket) String() string {
 	return fmt.Sprintf("<PubcompPacket ID=%d>", pp.ID)
 }
 
+// Clone returns a deep copy of the packet.
+func (pp *PubcompPacket) Clone() GenericPacket {
+	c := *pp
+	return &c
+}
+
 // A PubrecPacket is the response to a PublishPacket with QOS 2. It is the
 // second packet of the QOS 2 protocol exchange.
 type PubrecPacket struct {
@@ -188,6 +200,12 @@ func (pp *PubrecPacket) String() string {
 	return fmt.Sprintf("<PubrecPacket ID=%d>", pp.ID)
 }
 
+// Clone returns a deep copy of the packet.
+func (pp *PubrecPacket) Clone() GenericPacket {
+	c := *pp
+	return &c
+}
+
 // A PubrelPacket is the response to a PubrecPacket. It is the third packet of
 // the QOS 2 protocol exchange.
 type PubrelPacket struct {
@@ -232,6 +250,12 @@ func (pp *PubrelPacket) String() string {
 	return fmt.Sprintf("<PubrelPacket ID=%d>", pp.ID)
 }
 
+// Clone returns a deep copy of the packet.
+func (pp *PubrelPacket) Clone() GenericPacket {
+	c := *pp
+	return &c
+}
+
 // An UnsubackPacket is sent by the server to the client to confirm receipt of
 // an UnsubscribePacket.
 type UnsubackPacket struct {
@@ -273,3 +297,9 @@ func (up *UnsubackPacket) Encode(dst []byte) (int, error) {
 func (up *UnsubackPacket) String() string {
 	return fmt.Sprintf("<UnsubackPacket ID=%d>", up.ID)
 }
+
+// Clone returns a deep copy of the packet.
+func (up *UnsubackPacket) Clone() GenericPacket {
+	c := *up
+	return &c
+}
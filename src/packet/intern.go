@@ -0,0 +1,138 @@
+package packet
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultInternerSize is the maximum number of strings stored by an Interner
+// created with NewInterner(0).
+const DefaultInternerSize = 4096
+
+// InternerStats holds counters about the lookups performed by an Interner.
+type InternerStats struct {
+	// The number of lookups that returned a stored string.
+	Hits uint64
+
+	// The number of lookups that allocated a new string.
+	Misses uint64
+
+	// The number of stored strings.
+	Entries int
+}
+
+// HitRate returns the share of lookups that returned a stored string.
+func (s InternerStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// the number of independently locked parts of an Interner
+const internerShards = 16
+
+// An Interner is a string table that returns the same string for equal byte
+// slices. Decoders use it for topics, so that many publishes to a small set
+// of topics do not allocate a new string per packet. Once the table is full,
+// unknown strings are allocated but not stored. An Interner may be shared by
+// multiple decoders, the table is split into shards by hash that are looked
+// up with a read lock to not serialize the decoders.
+type Interner struct {
+	max     int64
+	entries int64
+	shards  [internerShards]*internerShard
+}
+
+type internerShard struct {
+	hits   uint64
+	misses uint64
+	table  map[string]string
+	mutex  sync.RWMutex
+
+	// avoid false sharing of the counters of neighbouring shards
+	_ [64]byte
+}
+
+// NewInterner returns a new Interner that stores up to the specified number of
+// strings or DefaultInternerSize if the size is zero.
+func NewInterner(size int) *Interner {
+	if size <= 0 {
+		size = DefaultInternerSize
+	}
+
+	i := &Interner{
+		max: int64(size),
+	}
+
+	for j := range i.shards {
+		i.shards[j] = &internerShard{
+			table: make(map[string]string),
+		}
+	}
+
+	return i
+}
+
+// Intern returns the stored string for the bytes or allocates and stores it.
+func (i *Interner) Intern(b []byte) string {
+	shard := i.shards[internHash(b)%internerShards]
+
+	// the conversion in the lookup does not allocate
+	shard.mutex.RLock()
+	str, ok := shard.table[string(b)]
+	shard.mutex.RUnlock()
+
+	if ok {
+		atomic.AddUint64(&shard.hits, 1)
+		return str
+	}
+
+	atomic.AddUint64(&shard.misses, 1)
+
+	str = string(b)
+	if atomic.LoadInt64(&i.entries) >= i.max {
+		return str
+	}
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	// another decoder may have stored the string in the meantime
+	if stored, ok := shard.table[str]; ok {
+		return stored
+	}
+
+	if atomic.AddInt64(&i.entries, 1) <= i.max {
+		shard.table[str] = str
+	} else {
+		atomic.AddInt64(&i.entries, -1)
+	}
+
+	return str
+}
+
+// Stats returns the current lookup counters.
+func (i *Interner) Stats() InternerStats {
+	var stats InternerStats
+	for _, shard := range i.shards {
+		stats.Hits += atomic.LoadUint64(&shard.hits)
+		stats.Misses += atomic.LoadUint64(&shard.misses)
+	}
+
+	stats.Entries = int(atomic.LoadInt64(&i.entries))
+
+	return stats
+}
+
+// internHash returns the FNV-1a hash of the bytes
+func internHash(b []byte) uint32 {
+	hash := uint32(2166136261)
+	for _, c := range b {
+		hash ^= uint32(c)
+		hash *= 16777619
+	}
+
+	return hash
+}
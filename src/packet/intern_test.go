@@ -0,0 +1,104 @@
+package packet
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterner(t *testing.T) {
+	interner := NewInterner(2)
+	assert.Equal(t, 0.0, interner.Stats().HitRate())
+
+	assert.Equal(t, "a", interner.Intern([]byte("a")))
+	assert.Equal(t, "a", interner.Intern([]byte("a")))
+	assert.Equal(t, "b", interner.Intern([]byte("b")))
+	assert.Equal(t, "c", interner.Intern([]byte("c")))
+	assert.Equal(t, "c", interner.Intern([]byte("c")))
+
+	stats := interner.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(4), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 0.2, stats.HitRate())
+}
+
+func TestInternerAllocs(t *testing.T) {
+	interner := NewInterner(0)
+	topic := []byte("foo/bar")
+	interner.Intern(topic)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		interner.Intern(topic)
+	})
+
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestInternerConcurrency(t *testing.T) {
+	interner := NewInterner(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				topic := "topic/" + strconv.Itoa(j%20)
+				assert.Equal(t, topic, interner.Intern([]byte(topic)))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// the size is not exceeded by concurrent inserts
+	stats := interner.Stats()
+	assert.Equal(t, 10, stats.Entries)
+	assert.Equal(t, uint64(8000), stats.Hits+stats.Misses)
+}
+
+func TestDecoderInterner(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	for i := 0; i < 3; i++ {
+		pkt := NewPublishPacket()
+		pkt.Message.Topic = "foo"
+		pkt.Message.Payload = []byte("bar")
+
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	dec := NewDecoder(buf)
+	dec.Interner = NewInterner(0)
+
+	for i := 0; i < 3; i++ {
+		pkt, err := dec.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, "foo", pkt.(*PublishPacket).Message.Topic)
+		assert.Equal(t, []byte("bar"), pkt.(*PublishPacket).Message.Payload)
+	}
+
+	stats := dec.Interner.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestPublishPacketDecodeInternedError(t *testing.T) {
+	pktBytes := []byte{
+		byte(PUBLISH << 4),
+		2,
+		0, // topic name MSB
+		2, // topic name LSB
+	}
+
+	pkt := NewPublishPacket()
+	_, err := pkt.DecodeInterned(pktBytes, NewInterner(0))
+	assert.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package packet
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 // A Message bundles data that is published between brokers and clients.
 type Message struct {
@@ -10,6 +13,12 @@ type Message struct {
 	// The Payload of the message.
 	Payload []byte
 
+	// The PayloadReader streams the payload instead of Payload, which allows
+	// payloads that are too large to be held in memory. PayloadLen must be
+	// set to the exact number of bytes provided by the reader.
+	PayloadReader io.Reader
+	PayloadLen    int
+
 	// The QOS indicates the level of assurance for delivery.
 	QOS byte
 
@@ -25,7 +34,37 @@ func (m *Message) String() string {
 		m.Topic, m.QOS, m.Retain, m.Payload)
 }
 
+// payloadLen returns the length of the payload or the streamed payload.
+func (m *Message) payloadLen() int {
+	if m.PayloadReader != nil {
+		return m.PayloadLen
+	}
+
+	return len(m.Payload)
+}
+
 // Copy returns a copy of the message.
 func (m Message) Copy() *Message {
 	return &m
 }
+
+// Clone returns a deep copy of the message including the payload. A
+// PayloadReader cannot be copied and is shared with the original.
+func (m *Message) Clone() *Message {
+	c := *m
+	c.Payload = cloneBytes(m.Payload)
+
+	return &c
+}
+
+// cloneBytes returns a copy of the bytes that preserves nil.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	c := make([]byte, len(b))
+	copy(c, b)
+
+	return c
+}
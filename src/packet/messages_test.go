@@ -29,3 +29,19 @@ func TestMessageCopy(t *testing.T) {
 	msg1.Retain = true
 	assert.False(t, msg2.Retain)
 }
+
+func TestMessageClone(t *testing.T) {
+	msg1 := &Message{
+		Topic:   "w",
+		Payload: []byte("m"),
+		QOS:     QOSAtLeastOnce,
+	}
+
+	msg2 := msg1.Clone()
+	assert.Equal(t, msg1, msg2)
+
+	msg1.Payload[0] = 'x'
+	assert.Equal(t, []byte("m"), msg2.Payload)
+
+	assert.Nil(t, (&Message{}).Clone().Payload)
+}
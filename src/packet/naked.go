@@ -63,6 +63,11 @@ func (dp *DisconnectPacket) String() string {
 	return "<DisconnectPacket>"
 }
 
+// Clone returns a deep copy of the packet.
+func (dp *DisconnectPacket) Clone() GenericPacket {
+	return &DisconnectPacket{}
+}
+
 // A PingreqPacket is sent from a client to the server.
 type PingreqPacket struct{}
 
@@ -99,6 +104,11 @@ func (pp *PingreqPacket) String() string {
 	return "<PingreqPacket>"
 }
 
+// Clone returns a deep copy of the packet.
+func (pp *PingreqPacket) Clone() GenericPacket {
+	return &PingreqPacket{}
+}
+
 // A PingrespPacket is sent by the server to the client in response to a
 // PingreqPacket. It indicates that the server is alive.
 type PingrespPacket struct{}
@@ -137,3 +147,8 @@ func (pp *PingrespPacket) Encode(dst []byte) (int, error) {
 func (pp *PingrespPacket) String() string {
 	return "<PingrespPacket>"
 }
+
+// Clone returns a deep copy of the packet.
+func (pp *PingrespPacket) Clone() GenericPacket {
+	return &PingrespPacket{}
+}
@@ -42,6 +42,10 @@ type GenericPacket interface {
 
 	// String returns a string representation of the packet.
 	String() string
+
+	// Clone returns a deep copy of the packet that can be mutated and used
+	// concurrently without affecting the original.
+	Clone() GenericPacket
 }
 
 // DetectPacket tries to detect the next packet in a buffer. It returns a length
@@ -57,7 +61,7 @@ func DetectPacket(src []byte) (int, Type) {
 
 	// get remaining length
 	rl, n := binary.Uvarint(src[1:])
-	if n <= 0 {
+	if n <= 0 || n > 4 {
 		return 0, 0
 	}
 
@@ -133,6 +133,87 @@ func TestGetID(t *testing.T) {
 	}
 }
 
+func TestClone(t *testing.T) {
+	connect := NewConnectPacket()
+	connect.ClientID = "c"
+	connect.Will = &Message{Topic: "will", Payload: []byte("w")}
+
+	publish := NewPublishPacket()
+	publish.ID = 1
+	publish.Message = Message{Topic: "t", Payload: []byte("p"), QOS: 1}
+
+	subscribe := NewSubscribePacket()
+	subscribe.ID = 2
+	subscribe.Subscriptions = []Subscription{{Topic: "t", QOS: 1}}
+
+	suback := NewSubackPacket()
+	suback.ID = 2
+	suback.ReturnCodes = []uint8{1}
+
+	unsubscribe := NewUnsubscribePacket()
+	unsubscribe.ID = 3
+	unsubscribe.Topics = []string{"t"}
+
+	packets := []GenericPacket{
+		connect,
+		NewConnackPacket(),
+		publish,
+		NewPubackPacket(),
+		NewPubrecPacket(),
+		NewPubrelPacket(),
+		NewPubcompPacket(),
+		subscribe,
+		suback,
+		unsubscribe,
+		NewUnsubackPacket(),
+		NewPingreqPacket(),
+		NewPingrespPacket(),
+		NewDisconnectPacket(),
+		NewRawPacket([]byte{0xf0, 0}),
+	}
+
+	for _, pkt := range packets {
+		clone := pkt.Clone()
+		assert.Equal(t, pkt, clone, pkt.Type().String())
+	}
+}
+
+func TestCloneIndependent(t *testing.T) {
+	publish := NewPublishPacket()
+	publish.ID = 1
+	publish.Message = Message{Topic: "t", Payload: []byte("p")}
+
+	clone := publish.Clone().(*PublishPacket)
+	publish.ID = 2
+	publish.Message.Payload[0] = 'x'
+	publish.Message.Topic = "x"
+
+	assert.Equal(t, ID(1), clone.ID)
+	assert.Equal(t, []byte("p"), clone.Message.Payload)
+	assert.Equal(t, "t", clone.Message.Topic)
+
+	connect := NewConnectPacket()
+	connect.Will = &Message{Topic: "will", Payload: []byte("w")}
+
+	cclone := connect.Clone().(*ConnectPacket)
+	connect.Will.Payload[0] = 'x'
+	assert.Equal(t, []byte("w"), cclone.Will.Payload)
+
+	subscribe := NewSubscribePacket()
+	subscribe.Subscriptions = []Subscription{{Topic: "t"}}
+
+	sclone := subscribe.Clone().(*SubscribePacket)
+	subscribe.Subscriptions[0].Topic = "x"
+	assert.Equal(t, "t", sclone.Subscriptions[0].Topic)
+
+	suback := NewSubackPacket()
+	suback.ReturnCodes = []uint8{1}
+
+	saclone := suback.Clone().(*SubackPacket)
+	suback.ReturnCodes[0] = QOSFailure
+	assert.Equal(t, []uint8{1}, saclone.ReturnCodes)
+}
+
 func TestFuzz(t *testing.T) {
 	// too small buffer
 	assert.Equal(t, 1, Fuzz([]byte{}))
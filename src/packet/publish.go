@@ -2,9 +2,15 @@ package packet
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
+// ErrStreamedPayload is returned by Encode if the payload of the message is
+// streamed using a PayloadReader. Such packets can only be written using an
+// Encoder.
+var ErrStreamedPayload = errors.New("streamed payload")
+
 // A PublishPacket is sent from a client to a server or from server to a client
 // to transport an application message.
 type PublishPacket struct {
@@ -37,6 +43,14 @@ func (pp *PublishPacket) String() string {
 		pp.ID, pp.Message.String(), pp.Dup)
 }
 
+// Clone returns a deep copy of the packet.
+func (pp *PublishPacket) Clone() GenericPacket {
+	c := *pp
+	c.Message = *pp.Message.Clone()
+
+	return &c
+}
+
 // Len returns the byte length of the encoded packet.
 func (pp *PublishPacket) Len() int {
 	ml := pp.len()
@@ -46,15 +60,78 @@ func (pp *PublishPacket) Len() int {
 // Decode reads from the byte slice argument. It returns the total number of
 // bytes decoded, and whether there have been any errors during the process.
 func (pp *PublishPacket) Decode(src []byte) (int, error) {
-	total := 0
+	return pp.decode(src, nil, false)
+}
+
+// DecodeInterned reads from the byte slice argument like Decode, but looks
+// up the topic in the specified Interner.
+func (pp *PublishPacket) DecodeInterned(src []byte, interner *Interner) (int, error) {
+	return pp.decode(src, interner, false)
+}
 
+// decodes the packet, optionally interns the topic and reuses the payload
+// buffer of the packet if it is large enough
+func (pp *PublishPacket) decode(src []byte, interner *Interner, reuse bool) (int, error) {
 	// decode header
-	hl, flags, rl, err := headerDecode(src[total:], PUBLISH)
-	total += hl
+	hl, flags, rl, err := headerDecode(src, PUBLISH)
+	if err != nil {
+		return hl, err
+	}
+
+	// limit buffer to the packet
+	src = src[:hl+rl]
+
+	// decode variable header
+	total, err := pp.decodeVariableHeader(src, hl, flags, interner)
 	if err != nil {
 		return total, err
 	}
 
+	// calculate payload length
+	l := int(rl) - (total - hl)
+
+	// read payload
+	if l > 0 && reuse && cap(pp.Message.Payload) >= l {
+		pp.Message.Payload = pp.Message.Payload[:l]
+		copy(pp.Message.Payload, src[total:total+l])
+		total += len(pp.Message.Payload)
+	} else if l > 0 {
+		pp.Message.Payload = make([]byte, l)
+		copy(pp.Message.Payload, src[total:total+l])
+		total += len(pp.Message.Payload)
+	} else if reuse {
+		pp.Message.Payload = nil
+	}
+
+	return total, nil
+}
+
+// decodeStreamed decodes the headers of a packet whose payload is not part of
+// the buffer and returns the number of bytes decoded and the payload length
+func (pp *PublishPacket) decodeStreamed(src []byte, interner *Interner) (int, int, error) {
+	// decode header
+	hl, flags, rl, err := headerDecodePrefix(src, PUBLISH)
+	if err != nil {
+		return hl, 0, err
+	}
+
+	// decode variable header
+	total, err := pp.decodeVariableHeader(src, hl, flags, interner)
+	if err != nil {
+		return total, 0, err
+	}
+
+	// calculate payload length
+	l := int(rl) - (total - hl)
+	if l < 0 {
+		return total, 0, fmt.Errorf("[%s] remaining length (%d) is smaller than the variable header (%d)", pp.Type(), rl, total-hl)
+	}
+
+	return total, l, nil
+}
+
+// decodes the flags, the topic and the packet id
+func (pp *PublishPacket) decodeVariableHeader(src []byte, total int, flags byte, interner *Interner) (int, error) {
 	// read flags
 	pp.Dup = ((flags >> 3) & 0x1) == 1
 	pp.Message.Retain = (flags & 0x1) == 1
@@ -70,15 +147,30 @@ func (pp *PublishPacket) Decode(src []byte) (int, error) {
 		return total, fmt.Errorf("[%s] insufficient buffer size, expected %d, got %d", pp.Type(), total+2, len(src))
 	}
 
-	n := 0
+	var n int
+	var err error
 
 	// read topic
-	pp.Message.Topic, n, err = readLPString(src[total:], pp.Type())
+	if interner != nil {
+		var topic []byte
+		topic, n, err = readLPBytes(src[total:], false, pp.Type())
+		if err == nil {
+			pp.Message.Topic = interner.Intern(topic)
+		}
+	} else {
+		pp.Message.Topic, n, err = readLPString(src[total:], pp.Type())
+	}
+
 	total += n
 	if err != nil {
 		return total, err
 	}
 
+	// check topic
+	if len(pp.Message.Topic) == 0 {
+		return total, fmt.Errorf("[%s] topic name is empty", pp.Type())
+	}
+
 	if pp.Message.QOS != 0 {
 		// check buffer length
 		if len(src) < total+2 {
@@ -95,16 +187,6 @@ func (pp *PublishPacket) Decode(src []byte) (int, error) {
 		}
 	}
 
-	// calculate payload length
-	l := int(rl) - (total - hl)
-
-	// read payload
-	if l > 0 {
-		pp.Message.Payload = make([]byte, l)
-		copy(pp.Message.Payload, src[total:total+l])
-		total += len(pp.Message.Payload)
-	}
-
 	return total, nil
 }
 
@@ -112,6 +194,31 @@ func (pp *PublishPacket) Decode(src []byte) (int, error) {
 // returns the number of bytes encoded and whether there's any errors along
 // the way. If there is an error, the byte slice should be considered invalid.
 func (pp *PublishPacket) Encode(dst []byte) (int, error) {
+	// check payload
+	if pp.Message.PayloadReader != nil {
+		return 0, ErrStreamedPayload
+	}
+
+	// encode headers
+	total, err := pp.encodeHead(dst, pp.Len())
+	if err != nil {
+		return total, err
+	}
+
+	// write payload
+	copy(dst[total:], pp.Message.Payload)
+	total += len(pp.Message.Payload)
+
+	return total, nil
+}
+
+// headLen returns the byte length of the encoded packet without the payload.
+func (pp *PublishPacket) headLen() int {
+	return pp.Len() - pp.Message.payloadLen()
+}
+
+// encodes the fixed and variable header into a buffer of the specified length
+func (pp *PublishPacket) encodeHead(dst []byte, length int) (int, error) {
 	total := 0
 
 	// check topic length
@@ -149,7 +256,7 @@ func (pp *PublishPacket) Encode(dst []byte) (int, error) {
 	flags = (flags & 249) | (pp.Message.QOS << 1) // 249 = 11111001
 
 	// encode header
-	n, err := headerEncode(dst[total:], flags, pp.len(), pp.Len(), PUBLISH)
+	n, err := headerEncode(dst[total:], flags, pp.len(), length, PUBLISH)
 	total += n
 	if err != nil {
 		return total, err
@@ -168,16 +275,12 @@ func (pp *PublishPacket) Encode(dst []byte) (int, error) {
 		total += 2
 	}
 
-	// write payload
-	copy(dst[total:], pp.Message.Payload)
-	total += len(pp.Message.Payload)
-
 	return total, nil
 }
 
 // Returns the payload length.
 func (pp *PublishPacket) len() int {
-	total := 2 + len(pp.Message.Topic) + len(pp.Message.Payload)
+	total := 2 + len(pp.Message.Topic) + pp.Message.payloadLen()
 	if pp.Message.QOS != 0 {
 		total += 2
 	}
@@ -318,3 +318,26 @@ func BenchmarkPublishDecode(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkPublishDecodeInterned(b *testing.B) {
+	pktBytes := []byte{
+		byte(PUBLISH<<4) | 2,
+		6,
+		0, // topic name MSB
+		1, // topic name LSB
+		't',
+		0, // packet ID MSB
+		1, // packet ID LSB
+		'p',
+	}
+
+	pkt := NewPublishPacket()
+	interner := NewInterner(0)
+
+	for i := 0; i < b.N; i++ {
+		_, err := pkt.DecodeInterned(pktBytes, interner)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
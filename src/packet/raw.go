@@ -0,0 +1,67 @@
+package packet
+
+import "fmt"
+
+// A RawPacket holds arbitrary bytes that are written as they are. It can be
+// used to send malformed packets or packets of reserved types to test how the
+// other side handles protocol violations.
+type RawPacket struct {
+	Data []byte
+}
+
+// NewRawPacket creates a new RawPacket with the specified bytes.
+func NewRawPacket(data []byte) *RawPacket {
+	return &RawPacket{
+		Data: data,
+	}
+}
+
+// NewReservedPacket creates a RawPacket of the specified type with no flags
+// and a zero remaining length, e.g. of the reserved types 0 and 15.
+func NewReservedPacket(t Type) *RawPacket {
+	return NewRawPacket([]byte{byte(t) << 4, 0})
+}
+
+// Type returns the type encoded in the first byte.
+func (rp *RawPacket) Type() Type {
+	if len(rp.Data) == 0 {
+		return 0
+	}
+
+	return Type(rp.Data[0] >> 4)
+}
+
+// Len returns the byte length of the encoded packet.
+func (rp *RawPacket) Len() int {
+	return len(rp.Data)
+}
+
+// Decode reads from the byte slice argument. It returns the total number of
+// bytes decoded, and whether there have been any errors during the process.
+func (rp *RawPacket) Decode(src []byte) (int, error) {
+	rp.Data = append(rp.Data[:0], src...)
+	return len(src), nil
+}
+
+// Encode writes the packet bytes into the byte slice from the argument. It
+// returns the number of bytes encoded and whether there's any errors along
+// the way. If there is an error, the byte slice should be considered invalid.
+func (rp *RawPacket) Encode(dst []byte) (int, error) {
+	if len(dst) < len(rp.Data) {
+		return 0, fmt.Errorf("[Raw] insufficient buffer size, expected %d, got %d", len(rp.Data), len(dst))
+	}
+
+	return copy(dst, rp.Data), nil
+}
+
+// String returns a string representation of the packet.
+func (rp *RawPacket) String() string {
+	return fmt.Sprintf("<RawPacket Data=%x>", rp.Data)
+}
+
+// Clone returns a deep copy of the packet.
+func (rp *RawPacket) Clone() GenericPacket {
+	return &RawPacket{
+		Data: cloneBytes(rp.Data),
+	}
+}
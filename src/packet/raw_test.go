@@ -0,0 +1,44 @@
+package packet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawPacket(t *testing.T) {
+	pkt := NewReservedPacket(15)
+	assert.Equal(t, Type(15), pkt.Type())
+	assert.Equal(t, 2, pkt.Len())
+	assert.Equal(t, "<RawPacket Data=f000>", pkt.String())
+
+	dst := make([]byte, pkt.Len())
+	n, err := pkt.Encode(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []byte{0xf0, 0}, dst)
+
+	_, err = pkt.Encode(make([]byte, 1))
+	assert.Error(t, err)
+
+	decoded := &RawPacket{}
+	n, err = decoded.Decode(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, pkt, decoded)
+
+	assert.Equal(t, Type(0), NewRawPacket(nil).Type())
+}
+
+func TestEncoderRawPacket(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	err := enc.Write(NewReservedPacket(0))
+	assert.NoError(t, err)
+
+	err = enc.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0}, buf.Bytes())
+}
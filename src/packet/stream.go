@@ -3,10 +3,21 @@ package packet
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"sync/atomic"
 )
 
+// DefaultReadBufferSize is the size of the read buffer used by a Decoder if
+// not changed using SetBufferSize.
+const DefaultReadBufferSize = 4096
+
+// the number of packets after which an adaptive read buffer is resized
+const adaptiveWindow = 64
+
 // ErrDetectionOverflow is returned by the Decoder if the next packet couldn't
 // be detect from the initial header bytes.
 var ErrDetectionOverflow = errors.New("detection overflow")
@@ -30,8 +41,15 @@ func NewEncoder(writer io.Writer) *Encoder {
 	}
 }
 
-// Write encodes and writes the passed packet to the write buffer.
+// Write encodes and writes the passed packet to the write buffer. The payload
+// of a publish packet with a PayloadReader is copied from the reader without
+// buffering the whole packet.
 func (e *Encoder) Write(pkt GenericPacket) error {
+	// stream payload if requested
+	if publish, ok := pkt.(*PublishPacket); ok && publish.Message.PayloadReader != nil {
+		return e.writeStreamed(publish)
+	}
+
 	// reset and eventually grow buffer
 	packetLength := pkt.Len()
 	e.buffer.Reset()
@@ -53,28 +71,328 @@ func (e *Encoder) Write(pkt GenericPacket) error {
 	return nil
 }
 
+// writes the headers of the packet and copies the payload from its reader
+func (e *Encoder) writeStreamed(pkt *PublishPacket) error {
+	// reset and eventually grow buffer
+	headLength := pkt.headLen()
+	e.buffer.Reset()
+	e.buffer.Grow(headLength)
+	buf := e.buffer.Bytes()[0:headLength]
+
+	// encode headers
+	_, err := pkt.encodeHead(buf, headLength)
+	if err != nil {
+		return err
+	}
+
+	// write buffer
+	_, err = e.writer.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	// copy payload
+	_, err = io.CopyN(e.writer, pkt.Message.PayloadReader, int64(pkt.Message.PayloadLen))
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Flush flushes the writer buffer.
 func (e *Encoder) Flush() error {
 	return e.writer.Flush()
 }
 
-// A Decoder wraps a Reader and continuously decodes packets.
+// DecoderStats holds counters about the reads performed by a Decoder.
+type DecoderStats struct {
+	// The number of reads issued to the underlying reader.
+	Reads uint64
+
+	// The number of bytes returned by the underlying reader.
+	Bytes uint64
+
+	// The number of successfully decoded packets.
+	Packets uint64
+
+	// The current size of the read buffer and the largest size it had.
+	BufferSize      uint64
+	BufferHighWater uint64
+
+	// The size of the largest decoded packet.
+	MaxPacket uint64
+
+	// The number of times the read buffer has been resized.
+	Resizes uint64
+}
+
+// PacketsPerRead returns the average number of packets decoded per read.
+func (s DecoderStats) PacketsPerRead() float64 {
+	if s.Reads == 0 {
+		return 0
+	}
+
+	return float64(s.Packets) / float64(s.Reads)
+}
+
+// counts the reads issued to the underlying reader
+type countingReader struct {
+	reader io.Reader
+	reads  uint64
+	bytes  uint64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	atomic.AddUint64(&r.reads, 1)
+	atomic.AddUint64(&r.bytes, uint64(n))
+	return n, err
+}
+
+// a leftoverReader returns the left over data before reading from the reader
+type leftoverReader struct {
+	data   []byte
+	reader io.Reader
+}
+
+func (r *leftoverReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+
+	return r.reader.Read(p)
+}
+
+// A Decoder wraps a Reader and continuously decodes packets. The reader is
+// read using a buffer so that multiple small packets can be decoded from a
+// single read.
 type Decoder struct {
 	Limit int64
 
-	reader *bufio.Reader
-	buffer bytes.Buffer
+	// The Interner used for the topics of publish packets, if set.
+	Interner *Interner
+
+	// The Arena publish packets are taken from, if set. Decoded publish
+	// packets should be released to the arena once they have been processed.
+	// Streamed publish packets are not taken from the arena.
+	Arena *Arena
+
+	// Publish packets larger than the threshold are returned with a
+	// PayloadReader that streams the payload from the underlying reader
+	// instead of a Payload, if the threshold is greater than zero. The
+	// payload should be consumed before the next packet is read, any unread
+	// bytes are otherwise discarded by the next Read.
+	StreamThreshold int
+
+	source   *countingReader
+	leftover *leftoverReader
+	reader   *bufio.Reader
+	buffer   bytes.Buffer
+	packets  uint64
+	pending  *payloadReader
+
+	bufferSize uint64
+	highWater  uint64
+	maxPacket  uint64
+	resizes    uint64
+
+	adaptiveMin int
+	adaptiveMax int
+	window      adaptiveWindowStats
+}
+
+// the packets and reads observed since the last adaptive resize
+type adaptiveWindowStats struct {
+	packets   int
+	maxPacket int
+	reads     uint64
+	bytes     uint64
 }
 
 // NewDecoder returns a new Decoder.
 func NewDecoder(reader io.Reader) *Decoder {
-	return &Decoder{
-		reader: bufio.NewReader(reader),
+	return NewDecoderSize(reader, DefaultReadBufferSize)
+}
+
+// NewDecoderSize returns a new Decoder that uses a read buffer of the
+// specified size.
+func NewDecoderSize(reader io.Reader, size int) *Decoder {
+	source := &countingReader{reader: reader}
+
+	d := &Decoder{
+		source: source,
+		reader: bufio.NewReaderSize(source, size),
+	}
+
+	d.trackSize()
+
+	return d
+}
+
+// SetBufferSize changes the size of the read buffer. Already buffered data is
+// preserved. The method must not be called concurrently with Read or while a
+// streamed payload is being read.
+func (d *Decoder) SetBufferSize(size int) {
+	// check size
+	if size == d.reader.Size() {
+		return
+	}
+
+	// keep buffered data and the data left over from a previous resize that
+	// has not been read into the buffer yet
+	buffered, _ := d.reader.Peek(d.reader.Buffered())
+	buffered = append([]byte(nil), buffered...)
+	if d.leftover != nil {
+		buffered = append(buffered, d.leftover.data...)
+	}
+
+	var reader io.Reader = d.source
+	d.leftover = nil
+	if len(buffered) > 0 {
+		d.leftover = &leftoverReader{data: buffered, reader: d.source}
+		reader = d.leftover
+	}
+
+	d.reader = bufio.NewReaderSize(reader, size)
+	d.trackSize()
+	atomic.AddUint64(&d.resizes, 1)
+}
+
+// SetAdaptiveBuffer lets the decoder grow and shrink its read buffer between
+// min and max bytes based on the observed packet sizes and reads. The buffer
+// is doubled if reads fill most of it or packets do not fit into it, and
+// halved if packets and reads only use a small part of it. Packets larger
+// than max are read into a temporary buffer that is released afterwards
+// instead of being kept for the lifetime of the decoder. A max of zero
+// disables the adaptive sizing. The method must not be called concurrently
+// with Read.
+func (d *Decoder) SetAdaptiveBuffer(min, max int) {
+	if min < 16 {
+		min = 16
+	}
+	if max > 0 && max < min {
+		max = min
+	}
+
+	d.adaptiveMin = min
+	d.adaptiveMax = max
+	d.window = adaptiveWindowStats{
+		reads: atomic.LoadUint64(&d.source.reads),
+		bytes: atomic.LoadUint64(&d.source.bytes),
+	}
+
+	// move into range
+	if max > 0 {
+		size := d.reader.Size()
+		if size < min {
+			d.SetBufferSize(min)
+		} else if size > max {
+			d.SetBufferSize(max)
+		}
+	}
+}
+
+// Stats returns the current read counters. It is safe to call Stats
+// concurrently with Read.
+func (d *Decoder) Stats() DecoderStats {
+	return DecoderStats{
+		Reads:           atomic.LoadUint64(&d.source.reads),
+		Bytes:           atomic.LoadUint64(&d.source.bytes),
+		Packets:         atomic.LoadUint64(&d.packets),
+		BufferSize:      atomic.LoadUint64(&d.bufferSize),
+		BufferHighWater: atomic.LoadUint64(&d.highWater),
+		MaxPacket:       atomic.LoadUint64(&d.maxPacket),
+		Resizes:         atomic.LoadUint64(&d.resizes),
 	}
 }
 
+// records the current buffer size and the high water mark
+func (d *Decoder) trackSize() {
+	size := uint64(d.reader.Size())
+	atomic.StoreUint64(&d.bufferSize, size)
+	if size > atomic.LoadUint64(&d.highWater) {
+		atomic.StoreUint64(&d.highWater, size)
+	}
+}
+
+// records a decoded packet and adapts the buffer at the end of a window or
+// when the packet did not fit into the buffer
+func (d *Decoder) observe(packetLength int) {
+	atomic.AddUint64(&d.packets, 1)
+	if uint64(packetLength) > atomic.LoadUint64(&d.maxPacket) {
+		atomic.StoreUint64(&d.maxPacket, uint64(packetLength))
+	}
+
+	// check mode
+	if d.adaptiveMax <= 0 {
+		return
+	}
+
+	// release a temporary buffer for packets above the maximum
+	if d.buffer.Cap() > d.adaptiveMax {
+		d.buffer = bytes.Buffer{}
+	}
+
+	// update window
+	d.window.packets++
+	if packetLength > d.window.maxPacket {
+		d.window.maxPacket = packetLength
+	}
+
+	size := d.reader.Size()
+	if d.window.packets < adaptiveWindow && packetLength <= size {
+		return
+	}
+
+	// get reads and bytes of window
+	reads := atomic.LoadUint64(&d.source.reads)
+	read := atomic.LoadUint64(&d.source.bytes)
+	perRead := 0
+	if reads > d.window.reads {
+		perRead = int((read - d.window.bytes) / (reads - d.window.reads))
+	}
+
+	maxPacket := d.window.maxPacket
+	d.window = adaptiveWindowStats{reads: reads, bytes: read}
+
+	// grow if packets did not fit or reads filled the buffer, shrink if
+	// packets and reads only used a quarter of it
+	next := size
+	if maxPacket > size || perRead >= size*3/4 {
+		next = size * 2
+		for next < maxPacket && next < d.adaptiveMax {
+			next *= 2
+		}
+	} else if maxPacket <= size/4 && perRead <= size/4 {
+		next = size / 2
+	}
+
+	// apply range
+	if next > d.adaptiveMax {
+		next = d.adaptiveMax
+	} else if next < d.adaptiveMin {
+		next = d.adaptiveMin
+	}
+
+	d.SetBufferSize(next)
+}
+
 // Read reads the next packet from the buffered reader.
 func (d *Decoder) Read() (GenericPacket, error) {
+	// discard the unread part of a streamed payload
+	if d.pending != nil {
+		_, err := io.Copy(ioutil.Discard, d.pending)
+		d.pending = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// initial detection length
 	detectionLength := 2
 
@@ -108,10 +426,41 @@ func (d *Decoder) Read() (GenericPacket, error) {
 			return nil, ErrReadLimitExceeded
 		}
 
+		// stream large publish packets
+		if packetType == PUBLISH && d.StreamThreshold > 0 && packetLength > d.StreamThreshold {
+			return d.readStreamed(detectionLength, packetLength)
+		}
+
 		// create packet
-		pkt, err := packetType.New()
-		if err != nil {
-			return nil, err
+		var pkt GenericPacket
+		if packetType == PUBLISH && d.Arena != nil {
+			pkt = d.Arena.Publish()
+		} else {
+			pkt, err = packetType.New()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// decode directly from the read buffer if the packet fits
+		if packetLength <= d.reader.Size() {
+			buf, err := d.reader.Peek(packetLength)
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			} else if err != nil {
+				return nil, err
+			}
+
+			// decode buffer and consume it afterwards
+			err = d.decode(pkt, buf)
+			d.reader.Discard(packetLength)
+			if err != nil {
+				return nil, err
+			}
+
+			d.observe(packetLength)
+
+			return pkt, nil
 		}
 
 		// reset and eventually grow buffer
@@ -126,15 +475,114 @@ func (d *Decoder) Read() (GenericPacket, error) {
 		}
 
 		// decode buffer
-		_, err = pkt.Decode(buf)
+		err = d.decode(pkt, buf)
 		if err != nil {
 			return nil, err
 		}
 
+		d.observe(packetLength)
+
 		return pkt, nil
 	}
 }
 
+// reads the headers of a publish packet and returns it with a reader for the
+// remaining payload
+func (d *Decoder) readStreamed(headerLength, packetLength int) (GenericPacket, error) {
+	// peek the flags and topic length
+	buf, err := d.reader.Peek(headerLength + 2)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	// get length of the fixed and variable headers
+	headLength := headerLength + 2 + int(binary.BigEndian.Uint16(buf[headerLength:]))
+	if (buf[0]>>1)&0x3 != 0 {
+		headLength += 2
+	}
+
+	// check length
+	if headLength > packetLength {
+		return nil, fmt.Errorf("[%s] remaining length (%d) is smaller than the variable header (%d)", PUBLISH, packetLength-headerLength, headLength-headerLength)
+	}
+
+	// reset and eventually grow buffer
+	d.buffer.Reset()
+	d.buffer.Grow(headLength)
+	buf = d.buffer.Bytes()[0:headLength]
+
+	// read headers (will not return EOF)
+	_, err = io.ReadFull(d.reader, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode headers
+	pkt := NewPublishPacket()
+	_, payloadLength, err := pkt.decodeStreamed(buf, d.Interner)
+	if err != nil {
+		return nil, err
+	}
+
+	// attach payload reader
+	d.pending = &payloadReader{
+		reader:    d.reader,
+		remaining: int64(payloadLength),
+	}
+	pkt.Message.PayloadReader = d.pending
+	pkt.Message.PayloadLen = payloadLength
+
+	atomic.AddUint64(&d.packets, 1)
+
+	return pkt, nil
+}
+
+// reads the remaining payload of a streamed publish packet
+type payloadReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	// check remaining
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	// limit read
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	// an EOF before the end of the payload is unexpected
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// decodes the packet, interns the topic of publish packets and reuses the
+// payload buffers of arena packets
+func (d *Decoder) decode(pkt GenericPacket, buf []byte) error {
+	if publish, ok := pkt.(*PublishPacket); ok && (d.Interner != nil || d.Arena != nil) {
+		_, err := publish.decode(buf, d.Interner, d.Arena != nil)
+		if err != nil && d.Arena != nil {
+			d.Arena.Release(publish)
+		}
+
+		return err
+	}
+
+	_, err := pkt.Decode(buf)
+	return err
+}
+
 // A Stream combines an Encoder and Decoder
 type Stream struct {
 	Decoder
@@ -144,9 +592,7 @@ type Stream struct {
 // NewStream creates a new Stream.
 func NewStream(reader io.Reader, writer io.Writer) *Stream {
 	return &Stream{
-		Decoder: Decoder{
-			reader: bufio.NewReader(reader),
-		},
+		Decoder: *NewDecoder(reader),
 		Encoder: Encoder{
 			writer: bufio.NewWriter(writer),
 		},
@@ -157,3 +157,356 @@ func TestStream(t *testing.T) {
 	assert.NotNil(t, pkt)
 	assert.NoError(t, err)
 }
+
+func TestDecoderStats(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	for i := 1; i <= 10; i++ {
+		pkt := NewPubackPacket()
+		pkt.ID = ID(i)
+
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	dec := NewDecoder(buf)
+
+	for i := 1; i <= 10; i++ {
+		pkt, err := dec.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, ID(i), pkt.(*PubackPacket).ID)
+	}
+
+	stats := dec.Stats()
+	assert.Equal(t, uint64(10), stats.Packets)
+	assert.Equal(t, uint64(40), stats.Bytes)
+	assert.Equal(t, uint64(1), stats.Reads)
+	assert.Equal(t, 10.0, stats.PacketsPerRead())
+}
+
+func TestDecoderSetBufferSize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoderSize(buf, 16)
+
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = make([]byte, 64) // < bigger than read buffer
+
+	for i := 0; i < 3; i++ {
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	pkt2, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt.String(), pkt2.String())
+
+	dec.SetBufferSize(1024)
+
+	pkt2, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt.String(), pkt2.String())
+
+	pkt2, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, pkt.String(), pkt2.String())
+
+	assert.Equal(t, uint64(3), dec.Stats().Packets)
+}
+
+func TestDecoderSetBufferSizeTwice(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoderSize(buf, 64)
+
+	for i := 1; i <= 20; i++ {
+		pkt := NewPubackPacket()
+		pkt.ID = ID(i)
+
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	// every resize happens with data buffered, the second one while data of
+	// the first one has not been read into the buffer yet
+	for i, size := range []int{16, 32, 16, 1024} {
+		pkt, err := dec.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, ID(i+1), pkt.(*PubackPacket).ID)
+
+		dec.SetBufferSize(size)
+	}
+
+	for i := 5; i <= 20; i++ {
+		pkt, err := dec.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, ID(i), pkt.(*PubackPacket).ID)
+	}
+
+	_, err := dec.Read()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, uint64(4), dec.Stats().Resizes)
+}
+
+// a chunkReader returns at most one chunk per read
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+
+	return n, nil
+}
+
+func TestDecoderAdaptiveBufferResizeBuffered(t *testing.T) {
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = make([]byte, 13)
+
+	b := make([]byte, pkt.Len())
+	pkt.Encode(b)
+	assert.Len(t, b, 20)
+
+	// single packet reads shrink the buffer, a large chunk is then buffered
+	// during the following resizes
+	reader := &chunkReader{}
+	for i := 0; i < 63; i++ {
+		reader.chunks = append(reader.chunks, b)
+	}
+	reader.chunks = append(reader.chunks, bytes.Repeat(b, 200))
+
+	dec := NewDecoderSize(reader, 4096)
+	dec.SetAdaptiveBuffer(16, 65536)
+
+	for i := 0; i < 263; i++ {
+		pkt2, err := dec.Read()
+		if !assert.NoError(t, err, i) {
+			return
+		}
+		assert.Equal(t, pkt.String(), pkt2.String())
+	}
+
+	_, err := dec.Read()
+	assert.Equal(t, io.EOF, err)
+	assert.True(t, dec.Stats().Resizes > 1)
+}
+
+func TestDecoderAdaptiveBufferGrow(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	for i := 1; i <= 1000; i++ {
+		pkt := NewPubackPacket()
+		pkt.ID = ID(i)
+
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	dec := NewDecoderSize(buf, 16)
+	dec.SetAdaptiveBuffer(16, 1024)
+
+	for i := 1; i <= 1000; i++ {
+		pkt, err := dec.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, ID(i), pkt.(*PubackPacket).ID)
+	}
+
+	// reads filled the buffer
+	stats := dec.Stats()
+	assert.Equal(t, uint64(1000), stats.Packets)
+	assert.Equal(t, uint64(4), stats.MaxPacket)
+	assert.True(t, stats.BufferSize > 16)
+	assert.True(t, stats.BufferHighWater <= 1024)
+	assert.True(t, stats.Resizes > 0)
+	assert.True(t, stats.Reads < 1000/4)
+}
+
+func TestDecoderAdaptiveBufferShrink(t *testing.T) {
+	in, out := io.Pipe()
+
+	dec := NewDecoderSize(in, 4096)
+	dec.SetAdaptiveBuffer(64, 4096)
+
+	go func() {
+		// send packets one by one, every window halves the buffer
+		for i := 1; i <= 500; i++ {
+			pkt := NewPubackPacket()
+			pkt.ID = ID(i)
+
+			b := make([]byte, pkt.Len())
+			pkt.Encode(b)
+			out.Write(b)
+		}
+	}()
+
+	for i := 1; i <= 500; i++ {
+		pkt, err := dec.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, ID(i), pkt.(*PubackPacket).ID)
+	}
+
+	stats := dec.Stats()
+	assert.Equal(t, uint64(64), stats.BufferSize)
+	assert.Equal(t, uint64(4096), stats.BufferHighWater)
+}
+
+func TestDecoderAdaptiveBufferLargePacket(t *testing.T) {
+	buf := new(bytes.Buffer)
+	dec := NewDecoderSize(buf, 64)
+	dec.SetAdaptiveBuffer(64, 1024)
+
+	small := NewPublishPacket()
+	small.Message.Topic = "foo"
+	small.Message.Payload = make([]byte, 200)
+
+	large := NewPublishPacket()
+	large.Message.Topic = "foo"
+	large.Message.Payload = make([]byte, 4096)
+
+	for _, pkt := range []*PublishPacket{small, large, small} {
+		b := make([]byte, pkt.Len())
+		pkt.Encode(b)
+		buf.Write(b)
+	}
+
+	// grow for packets that do not fit
+	pkt, err := dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, small.String(), pkt.String())
+	assert.Equal(t, uint64(256), dec.Stats().BufferSize)
+
+	// limit buffer and release temporary buffer
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, large.String(), pkt.String())
+	assert.Equal(t, uint64(1024), dec.Stats().BufferSize)
+	assert.Equal(t, 0, dec.buffer.Cap())
+
+	pkt, err = dec.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, small.String(), pkt.String())
+
+	stats := dec.Stats()
+	assert.Equal(t, uint64(large.Len()), stats.MaxPacket)
+	assert.Equal(t, uint64(1024), stats.BufferHighWater)
+}
+
+func TestStreamedPayload(t *testing.T) {
+	buf := new(bytes.Buffer)
+	stream := NewStream(buf, buf)
+	stream.StreamThreshold = 1024
+
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+
+	pkt := NewPublishPacket()
+	pkt.ID = 1
+	pkt.Message.Topic = "foo"
+	pkt.Message.QOS = 1
+	pkt.Message.PayloadReader = bytes.NewReader(payload)
+	pkt.Message.PayloadLen = len(payload)
+
+	err := stream.Write(pkt)
+	assert.NoError(t, err)
+
+	err = stream.Write(NewPingreqPacket())
+	assert.NoError(t, err)
+
+	err = stream.Flush()
+	assert.NoError(t, err)
+
+	assert.Equal(t, pkt.Len()+2, buf.Len())
+
+	out, err := stream.Read()
+	assert.NoError(t, err)
+
+	publish := out.(*PublishPacket)
+	assert.Equal(t, ID(1), publish.ID)
+	assert.Equal(t, "foo", publish.Message.Topic)
+	assert.Nil(t, publish.Message.Payload)
+	assert.Equal(t, len(payload), publish.Message.PayloadLen)
+
+	data, err := io.ReadAll(publish.Message.PayloadReader)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, data)
+
+	out, err = stream.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, PINGREQ, out.Type())
+}
+
+func TestStreamedPayloadDiscard(t *testing.T) {
+	buf := new(bytes.Buffer)
+	stream := NewStream(buf, buf)
+	stream.StreamThreshold = 1024
+
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo"
+	pkt.Message.PayloadReader = bytes.NewReader(make([]byte, 4096))
+	pkt.Message.PayloadLen = 4096
+
+	err := stream.Write(pkt)
+	assert.NoError(t, err)
+
+	pkt.Message.PayloadReader = nil
+	pkt.Message.Payload = []byte("bar")
+
+	err = stream.Write(pkt)
+	assert.NoError(t, err)
+
+	err = stream.Flush()
+	assert.NoError(t, err)
+
+	out, err := stream.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, 4096, out.(*PublishPacket).Message.PayloadLen)
+
+	// the unread payload is discarded
+	out, err = stream.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar"), out.(*PublishPacket).Message.Payload)
+}
+
+func TestStreamedPayloadShortReader(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer))
+
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo"
+	pkt.Message.PayloadReader = bytes.NewReader(make([]byte, 10))
+	pkt.Message.PayloadLen = 20
+
+	err := enc.Write(pkt)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = pkt.Encode(make([]byte, pkt.Len()))
+	assert.Equal(t, ErrStreamedPayload, err)
+}
+
+func TestStreamedPayloadUnexpectedEOF(t *testing.T) {
+	pkt := NewPublishPacket()
+	pkt.Message.Topic = "foo"
+	pkt.Message.Payload = make([]byte, 4096)
+
+	b := make([]byte, pkt.Len())
+	pkt.Encode(b)
+
+	dec := NewDecoder(bytes.NewReader(b[:2048]))
+	dec.StreamThreshold = 1024
+
+	out, err := dec.Read()
+	assert.NoError(t, err)
+
+	_, err = io.ReadAll(out.(*PublishPacket).Message.PayloadReader)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
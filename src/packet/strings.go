@@ -7,6 +7,12 @@ import (
 
 const maxLPLength uint16 = 65535
 
+// MaxStringLength is the maximum length of the strings and binary fields like
+// topics, client ids and passwords accepted when decoding packets. Longer
+// fields are rejected as malformed. It may be lowered to guard against
+// oversized fields from a misbehaving peer.
+var MaxStringLength = int(maxLPLength)
+
 // read length prefixed bytes
 func readLPBytes(buf []byte, safe bool, t Type) ([]byte, int, error) {
 	if len(buf) < 2 {
@@ -19,6 +25,10 @@ func readLPBytes(buf []byte, safe bool, t Type) ([]byte, int, error) {
 	total += 2
 	total += n
 
+	if n > MaxStringLength {
+		return nil, total, fmt.Errorf("[%s] length (%d) greater than %d bytes", t, n, MaxStringLength)
+	}
+
 	if len(buf) < total {
 		return nil, total, fmt.Errorf("[%s] insufficient buffer size, expected %d, got %d", t, total, len(buf))
 	}
@@ -45,6 +55,10 @@ func readLPString(buf []byte, t Type) (string, int, error) {
 	total += 2
 	total += n
 
+	if n > MaxStringLength {
+		return "", total, fmt.Errorf("[%s] length (%d) greater than %d bytes", t, n, MaxStringLength)
+	}
+
 	if len(buf) < total {
 		return "", total, fmt.Errorf("[%s] insufficient buffer size, expected %d, got %d", t, total, len(buf))
 	}
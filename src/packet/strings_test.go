@@ -53,6 +53,22 @@ func TestReadLPStringErrors(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestMaxStringLength(t *testing.T) {
+	MaxStringLength = 3
+	defer func() {
+		MaxStringLength = int(maxLPLength)
+	}()
+
+	_, _, err := readLPString([]byte{0, 3, 'f', 'o', 'o'}, CONNECT)
+	assert.NoError(t, err)
+
+	_, _, err = readLPString([]byte{0, 4, 'f', 'o', 'o', 'o'}, CONNECT)
+	assert.Error(t, err)
+
+	_, _, err = readLPBytes([]byte{0, 4, 'f', 'o', 'o', 'o'}, true, CONNECT)
+	assert.Error(t, err)
+}
+
 func TestWriteLPBytes(t *testing.T) {
 	total := 0
 	buf := make([]byte, 127)
@@ -39,6 +39,14 @@ func (sp *SubackPacket) String() string {
 		sp.ID, strings.Join(codes, ", "))
 }
 
+// Clone returns a deep copy of the packet.
+func (sp *SubackPacket) Clone() GenericPacket {
+	c := *sp
+	c.ReturnCodes = cloneBytes(sp.ReturnCodes)
+
+	return &c
+}
+
 // Len returns the byte length of the encoded packet.
 func (sp *SubackPacket) Len() int {
 	ml := sp.len()
@@ -52,6 +52,18 @@ func (sp *SubscribePacket) String() string {
 		sp.ID, strings.Join(subscriptions, ", "))
 }
 
+// Clone returns a deep copy of the packet.
+func (sp *SubscribePacket) Clone() GenericPacket {
+	c := *sp
+
+	if sp.Subscriptions != nil {
+		c.Subscriptions = make([]Subscription, len(sp.Subscriptions))
+		copy(c.Subscriptions, sp.Subscriptions)
+	}
+
+	return &c
+}
+
 // Len returns the byte length of the encoded packet.
 func (sp *SubscribePacket) Len() int {
 	ml := sp.len()
@@ -70,6 +82,9 @@ func (sp *SubscribePacket) Decode(src []byte) (int, error) {
 		return total, err
 	}
 
+	// limit buffer to the packet
+	src = src[:hl+rl]
+
 	// check buffer length
 	if len(src) < total+2 {
 		return total, fmt.Errorf("[%s] insufficient buffer size, expected %d, got %d", sp.Type(), total+2, len(src))
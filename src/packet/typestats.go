@@ -0,0 +1,47 @@
+package packet
+
+// TypeStats counts packets and their encoded bytes by packet type. The arrays
+// are indexed by Type.
+type TypeStats struct {
+	// The number of packets of every type.
+	Packets [16]uint64
+
+	// The number of encoded bytes of every type including headers.
+	Bytes [16]uint64
+
+	// The number of payload bytes carried by publish packets.
+	Payload uint64
+}
+
+// Add will count the packet using its encoded length.
+func (s *TypeStats) Add(pkt GenericPacket) {
+	t := pkt.Type() & 0xf
+	s.Packets[t]++
+	s.Bytes[t] += uint64(pkt.Len())
+
+	if publish, ok := pkt.(*PublishPacket); ok {
+		s.Payload += uint64(publish.Message.payloadLen())
+	}
+}
+
+// Merge returns the sum of both counters.
+func (s TypeStats) Merge(other TypeStats) TypeStats {
+	for t := range s.Packets {
+		s.Packets[t] += other.Packets[t]
+		s.Bytes[t] += other.Bytes[t]
+	}
+
+	s.Payload += other.Payload
+
+	return s
+}
+
+// Total returns the number of packets and bytes across all types.
+func (s TypeStats) Total() (packets, bytes uint64) {
+	for t := range s.Packets {
+		packets += s.Packets[t]
+		bytes += s.Bytes[t]
+	}
+
+	return packets, bytes
+}
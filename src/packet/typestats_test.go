@@ -0,0 +1,34 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypeStats(t *testing.T) {
+	var stats TypeStats
+
+	publish := NewPublishPacket()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = []byte("bar")
+
+	stats.Add(publish)
+	stats.Add(publish)
+	stats.Add(NewPubackPacket())
+
+	assert.Equal(t, uint64(2), stats.Packets[PUBLISH])
+	assert.Equal(t, uint64(2*publish.Len()), stats.Bytes[PUBLISH])
+	assert.Equal(t, uint64(1), stats.Packets[PUBACK])
+	assert.Equal(t, uint64(4), stats.Bytes[PUBACK])
+	assert.Equal(t, uint64(6), stats.Payload)
+
+	merged := stats.Merge(stats)
+	assert.Equal(t, uint64(4), merged.Packets[PUBLISH])
+	assert.Equal(t, uint64(12), merged.Payload)
+	assert.Equal(t, uint64(2), stats.Packets[PUBLISH])
+
+	packets, bytes := merged.Total()
+	assert.Equal(t, uint64(6), packets)
+	assert.Equal(t, uint64(4*publish.Len()+8), bytes)
+}
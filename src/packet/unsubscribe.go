@@ -37,6 +37,18 @@ func (up *UnsubscribePacket) String() string {
 		strings.Join(topics, ", "))
 }
 
+// Clone returns a deep copy of the packet.
+func (up *UnsubscribePacket) Clone() GenericPacket {
+	c := *up
+
+	if up.Topics != nil {
+		c.Topics = make([]string, len(up.Topics))
+		copy(c.Topics, up.Topics)
+	}
+
+	return &c
+}
+
 // Len returns the byte length of the encoded packet.
 func (up *UnsubscribePacket) Len() int {
 	ml := up.len()
@@ -55,6 +67,9 @@ func (up *UnsubscribePacket) Decode(src []byte) (int, error) {
 		return total, err
 	}
 
+	// limit buffer to the packet
+	src = src[:hl+rl]
+
 	// check buffer length
 	if len(src) < total+2 {
 		return total, fmt.Errorf("[%s] insufficient buffer size, expected %d, got %d", up.Type(), total+2, len(src))
@@ -87,7 +102,7 @@ func (up *UnsubscribePacket) Decode(src []byte) (int, error) {
 		up.Topics = append(up.Topics, t)
 
 		// decrement counter
-		tl = tl - n - 1
+		tl = tl - n
 	}
 
 	// check for empty list
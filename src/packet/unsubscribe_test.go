@@ -118,6 +118,23 @@ func TestUnsubscribePacketDecodeError5(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestUnsubscribePacketDecodeError6(t *testing.T) {
+	pktBytes := []byte{
+		byte(UNSUBSCRIBE<<4) | 2,
+		6,
+		0, // packet ID MSB
+		1, // packet ID LSB
+		0, // topic name MSB
+		6, // topic name LSB < exceeds remaining length
+		'g', 'o', 'm', 'q', 't', 't',
+	}
+
+	pkt := NewUnsubscribePacket()
+	_, err := pkt.Decode(pktBytes)
+
+	assert.Error(t, err)
+}
+
 func TestUnsubscribePacketEncode(t *testing.T) {
 	pktBytes := []byte{
 		byte(UNSUBSCRIBE<<4) | 2,
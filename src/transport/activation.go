@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+)
+
+// ErrInvalidActivation is returned by ActivationListeners if the socket
+// activation environment is malformed.
+var ErrInvalidActivation = errors.New("invalid socket activation environment")
+
+// the first file descriptor passed by the service manager
+const activationFD = 3
+
+// ActivationListeners returns the listening sockets passed by a service
+// manager using the systemd socket activation protocol (LISTEN_PID and
+// LISTEN_FDS). It returns no listeners if the process has not been socket
+// activated. The variables are removed from the environment so that child
+// processes do not adopt the sockets as well.
+func ActivationListeners() ([]net.Listener, error) {
+	pid := os.Getenv("LISTEN_PID")
+	fds := os.Getenv("LISTEN_FDS")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// check if the sockets are meant for this process
+	if fds == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, ErrInvalidActivation
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		// the listener uses a duplicate of the descriptor
+		file := os.NewFile(uintptr(activationFD+i), "LISTEN_FD_"+strconv.Itoa(activationFD+i))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+
+			return nil, err
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
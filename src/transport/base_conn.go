@@ -1,8 +1,10 @@
 package transport
 
 import (
+	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"packet"
@@ -18,36 +20,88 @@ type Carrier interface {
 // A BaseConn manages the low-level plumbing between the Carrier and the packet
 // Stream.
 type BaseConn struct {
-	carrier Carrier
+	carrier *statsCarrier
 
 	stream *packet.Stream
 
-	flushTimer *time.Timer
-	flushError error
+	flushTimer   *time.Timer
+	flushError   error
+	flushPending bool
+	writeDelay   time.Duration
 
 	sMutex sync.Mutex
 	rMutex sync.Mutex
 
-	readTimeout time.Duration
+	readTimeout  time.Duration
+	closeTimeout time.Duration
+
+	stats      PacketStats
+	statsMutex sync.Mutex
+
+	// the counted network connection below the carrier and whether the
+	// carrier is the network connection itself
+	wire  *wireConn
+	plain bool
+}
+
+// PacketStats holds the packet counters of a connection by direction.
+type PacketStats struct {
+	Sent     packet.TypeStats
+	Received packet.TypeStats
+}
+
+// Merge returns the sum of both counters.
+func (s PacketStats) Merge(other PacketStats) PacketStats {
+	return PacketStats{
+		Sent:     s.Sent.Merge(other.Sent),
+		Received: s.Received.Merge(other.Received),
+	}
 }
 
 // NewBaseConn creates a new BaseConn using the specified Carrier.
 func NewBaseConn(c Carrier) *BaseConn {
+	carrier := &statsCarrier{Carrier: c}
+
 	return &BaseConn{
-		carrier: c,
-		stream:  packet.NewStream(c, c),
+		carrier: carrier,
+		stream:  packet.NewStream(carrier, carrier),
 	}
 }
 
+// SetStatsHandler attaches the handler to the connection and reports the
+// connection as opened. It should be set before the connection is used as
+// the call blocks while a Send or Receive is in progress.
+func (c *BaseConn) SetStatsHandler(handler StatsHandler) {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.carrier.handler = handler
+	handler.ConnOpened(c.carrier.owner)
+}
+
+// setOwner sets the Conn reported to the StatsHandler, which is the type
+// embedding the BaseConn
+func (c *BaseConn) setOwner(conn Conn) {
+	c.carrier.owner = conn
+}
+
 // Send will write the packet to the underlying connection. It will return
 // an Error if there was an error while encoding or writing to the
-// underlying connection.
+// underlying connection. If a write delay has been set, the packet is
+// coalesced with other packets as in BufferedSend.
 //
 // Note: Only one goroutine can Send at the same time.
 func (c *BaseConn) Send(pkt packet.GenericPacket) error {
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
+	// coalesce packet if requested
+	if c.writeDelay > 0 {
+		return c.bufferedSend(pkt, c.writeDelay)
+	}
+
 	// write packet
 	err := c.write(pkt)
 	if err != nil {
@@ -55,9 +109,7 @@ func (c *BaseConn) Send(pkt packet.GenericPacket) error {
 	}
 
 	// stop the timer if existing
-	if c.flushTimer != nil {
-		c.flushTimer.Stop()
-	}
+	c.stopTimer()
 
 	// flush buffer
 	return c.flush()
@@ -73,9 +125,48 @@ func (c *BaseConn) BufferedSend(pkt packet.GenericPacket) error {
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
+	// get delay
+	delay := flushTimeout
+	if c.writeDelay > 0 {
+		delay = c.writeDelay
+	}
+
+	return c.bufferedSend(pkt, delay)
+}
+
+// Flush will immediately write all packets that have been buffered using
+// BufferedSend or a coalescing Send.
+func (c *BaseConn) Flush() error {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	// stop the timer if existing
+	c.stopTimer()
+
+	// return any error from asyncFlush
+	if c.flushError != nil {
+		return c.flushError
+	}
+
+	return c.flush()
+}
+
+// SetWriteDelay sets the maximum time packets are buffered before they are
+// written to the underlying connection. If the delay is greater than zero,
+// Send will coalesce packets like BufferedSend, which allows many small
+// packets to be written with a single write. Network errors are then returned
+// on the next call as in BufferedSend.
+func (c *BaseConn) SetWriteDelay(delay time.Duration) {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	c.writeDelay = delay
+}
+
+func (c *BaseConn) bufferedSend(pkt packet.GenericPacket, delay time.Duration) error {
 	// create the timer if missing
 	if c.flushTimer == nil {
-		c.flushTimer = time.AfterFunc(flushTimeout, c.asyncFlush)
+		c.flushTimer = time.AfterFunc(delay, c.asyncFlush)
 		c.flushTimer.Stop()
 	}
 
@@ -90,21 +181,41 @@ func (c *BaseConn) BufferedSend(pkt packet.GenericPacket) error {
 		return err
 	}
 
-	// queue asyncFlush
-	c.flushTimer.Reset(flushTimeout)
+	// queue asyncFlush, the first buffered packet determines the flush time
+	if !c.flushPending {
+		c.flushPending = true
+		c.flushTimer.Reset(delay)
+	}
 
 	return nil
 }
 
+func (c *BaseConn) stopTimer() {
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+	}
+
+	c.flushPending = false
+}
+
 func (c *BaseConn) write(pkt packet.GenericPacket) error {
 	err := c.stream.Write(pkt)
 	if err != nil {
 		// ensure connection gets closed
 		c.carrier.Close()
+		c.carrier.close(err)
 
 		return err
 	}
 
+	c.statsMutex.Lock()
+	c.stats.Sent.Add(pkt)
+	c.statsMutex.Unlock()
+
+	if c.carrier.handler != nil {
+		c.carrier.handler.PacketSent(c.carrier.owner, pkt)
+	}
+
 	return nil
 }
 
@@ -113,6 +224,7 @@ func (c *BaseConn) flush() error {
 	if err != nil {
 		// ensure connection gets closed
 		c.carrier.Close()
+		c.carrier.close(err)
 
 		return err
 	}
@@ -124,6 +236,13 @@ func (c *BaseConn) asyncFlush() {
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
+	// check if already flushed
+	if !c.flushPending {
+		return
+	}
+
+	c.flushPending = false
+
 	// flush buffer and save an eventual error
 	err := c.flush()
 	if err != nil {
@@ -145,6 +264,7 @@ func (c *BaseConn) Receive() (packet.GenericPacket, error) {
 	if err != nil {
 		// ensure connection gets closed
 		c.carrier.Close()
+		c.carrier.close(err)
 
 		return nil, err
 	}
@@ -152,16 +272,98 @@ func (c *BaseConn) Receive() (packet.GenericPacket, error) {
 	// reset timeout
 	c.resetTimeout()
 
+	c.statsMutex.Lock()
+	c.stats.Received.Add(pkt)
+	c.statsMutex.Unlock()
+
+	if c.carrier.handler != nil {
+		c.carrier.handler.PacketReceived(c.carrier.owner, pkt)
+	}
+
+	return pkt, nil
+}
+
+// SendContext will write the packet like Send. If the context is canceled
+// before the write completes, the underlying connection is closed to unblock
+// the write and the context's error is returned.
+func (c *BaseConn) SendContext(ctx context.Context, pkt packet.GenericPacket) error {
+	return c.withContext(ctx, func() error {
+		return c.Send(pkt)
+	})
+}
+
+// ReceiveContext will read the next packet like Receive. If the context is
+// canceled before a packet is received, the underlying connection is closed to
+// unblock the read and the context's error is returned.
+func (c *BaseConn) ReceiveContext(ctx context.Context) (packet.GenericPacket, error) {
+	var pkt packet.GenericPacket
+
+	err := c.withContext(ctx, func() error {
+		var err error
+		pkt, err = c.Receive()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return pkt, nil
 }
 
+func (c *BaseConn) withContext(ctx context.Context, fn func() error) error {
+	// run directly if the context cannot be canceled
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	// check if already canceled
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	// close carrier if the context gets canceled while running
+	var canceled int32
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&canceled, 1)
+			c.carrier.Close()
+		case <-done:
+		}
+	}()
+
+	err = fn()
+	close(done)
+
+	if atomic.LoadInt32(&canceled) == 1 {
+		return ctx.Err()
+	}
+
+	return err
+}
+
 // Close will close the underlying connection and cleanup resources. It will
 // return an Error if there was an error while closing the underlying
 // connection.
 func (c *BaseConn) Close() error {
+	// close the carrier if a blocked write keeps the send mutex locked or
+	// the cached writes cannot be flushed
+	if c.closeTimeout > 0 {
+		abort := time.AfterFunc(c.closeTimeout, func() {
+			c.carrier.Close()
+		})
+
+		defer abort.Stop()
+	}
+
 	c.sMutex.Lock()
 	defer c.sMutex.Unlock()
 
+	// stop the timer if existing
+	c.stopTimer()
+
 	// flush any cached writes
 	err := c.flush()
 	if err != nil {
@@ -170,6 +372,7 @@ func (c *BaseConn) Close() error {
 
 	// close carrier
 	err = c.carrier.Close()
+	c.carrier.close(err)
 	if err != nil {
 		return err
 	}
@@ -184,6 +387,99 @@ func (c *BaseConn) SetReadLimit(limit int64) {
 	c.stream.Decoder.Limit = limit
 }
 
+// SetReadBufferSize sets the size of the buffer used to read from the
+// underlying connection. Larger buffers allow multiple small packets to be
+// decoded from a single read. The size should be set before receiving packets
+// as the call blocks while a Receive is in progress.
+func (c *BaseConn) SetReadBufferSize(size int) {
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.stream.Decoder.SetBufferSize(size)
+}
+
+// SetAdaptiveReadBuffer lets the read buffer grow and shrink between min and
+// max bytes based on the observed packet sizes and reads. Small packets
+// arriving in bursts grow the buffer to avoid a read per packet, while packets
+// above max are read into a temporary buffer that is released afterwards. A
+// max of zero disables the adaptive sizing. It should be set before receiving
+// packets as the call blocks while a Receive is in progress.
+func (c *BaseConn) SetAdaptiveReadBuffer(min, max int) {
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.stream.Decoder.SetAdaptiveBuffer(min, max)
+}
+
+// SetStreamThreshold sets the size above which received publish packets
+// stream their payload from the connection using a PayloadReader instead of
+// being read into memory. The payload must be consumed before the next
+// Receive, unread bytes are otherwise discarded. It should be set before
+// receiving packets as the call blocks while a Receive is in progress.
+func (c *BaseConn) SetStreamThreshold(threshold int) {
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.stream.Decoder.StreamThreshold = threshold
+}
+
+// SetInterner sets the Interner used to look up the topics of received publish
+// packets. An Interner can be shared by multiple connections. It should be
+// set before receiving packets as the call blocks while a Receive is in
+// progress.
+func (c *BaseConn) SetInterner(interner *packet.Interner) {
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.stream.Decoder.Interner = interner
+}
+
+// SetArena sets the Arena received publish packets are taken from. An Arena
+// can be shared by multiple connections. It should be set before receiving
+// packets as the call blocks while a Receive is in progress.
+func (c *BaseConn) SetArena(arena *packet.Arena) {
+	c.rMutex.Lock()
+	defer c.rMutex.Unlock()
+
+	c.stream.Decoder.Arena = arena
+}
+
+// ReadStats returns counters about the reads performed on the underlying
+// connection and the packets decoded from them.
+func (c *BaseConn) ReadStats() packet.DecoderStats {
+	return c.stream.Decoder.Stats()
+}
+
+// PacketStats returns the number of packets and bytes sent and received by
+// packet type. Buffered packets are counted as sent once they are encoded.
+func (c *BaseConn) PacketStats() PacketStats {
+	c.statsMutex.Lock()
+	defer c.statsMutex.Unlock()
+
+	return c.stats
+}
+
+// WireStats returns the number of bytes written to and read from the network
+// including the framing of TLS and WebSocket. Connections that cannot measure
+// the framing, e.g. HTTP bridge connections, return the bytes of the MQTT
+// packets and report the stats as incomplete.
+func (c *BaseConn) WireStats() WireStats {
+	if c.wire != nil {
+		return c.wire.stats()
+	}
+
+	return WireStats{
+		Sent:     atomic.LoadInt64(&c.carrier.written),
+		Received: atomic.LoadInt64(&c.carrier.read),
+		Complete: c.plain,
+	}
+}
+
+// setWire sets the counted network connection below the carrier
+func (c *BaseConn) setWire(wire *wireConn) {
+	c.wire = wire
+}
+
 // SetReadTimeout sets the maximum time that can pass between reads.
 // If no data is received in the set duration the connection will be closed
 // and Read returns an error.
@@ -192,6 +488,13 @@ func (c *BaseConn) SetReadTimeout(timeout time.Duration) {
 	c.resetTimeout()
 }
 
+// SetCloseTimeout sets the maximum time Close waits for a blocked write,
+// e.g. to a peer that stopped reading, before it closes the underlying
+// connection. Close waits indefinitely if the timeout is zero.
+func (c *BaseConn) SetCloseTimeout(timeout time.Duration) {
+	c.closeTimeout = timeout
+}
+
 func (c *BaseConn) resetTimeout() {
 	if c.readTimeout > 0 {
 		c.carrier.SetReadDeadline(time.Now().Add(c.readTimeout))
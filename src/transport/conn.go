@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"context"
 	"net"
 	"time"
 
@@ -19,6 +20,11 @@ type Conn interface {
 	// Note: Only one goroutine can Send at the same time.
 	Send(pkt packet.GenericPacket) error
 
+	// SendContext will write the packet like Send. If the context is canceled
+	// before the write completes, the underlying connection is closed to
+	// unblock the write and the context's error is returned.
+	SendContext(ctx context.Context, pkt packet.GenericPacket) error
+
 	// BufferedSend will write the packet to an internal buffer. It will flush
 	// the internal buffer automatically when it gets stale. Encoding errors are
 	// directly returned as in Send, but any network errors caught while flushing
@@ -27,6 +33,16 @@ type Conn interface {
 	// Note: Only one goroutine can call BufferedSend at the same time.
 	BufferedSend(pkt packet.GenericPacket) error
 
+	// Flush will immediately write all packets that have been buffered using
+	// BufferedSend or a coalescing Send.
+	Flush() error
+
+	// SetWriteDelay sets the maximum time packets are buffered before they are
+	// written to the underlying connection. If the delay is greater than zero,
+	// Send will coalesce packets like BufferedSend, which allows many small
+	// packets to be written with a single write.
+	SetWriteDelay(delay time.Duration)
+
 	// Receive will read from the underlying connection and return a fully read
 	// packet. It will return an Error if there was an error while decoding or
 	// reading from the underlying connection.
@@ -34,6 +50,11 @@ type Conn interface {
 	// Note: Only one goroutine can Receive at the same time.
 	Receive() (packet.GenericPacket, error)
 
+	// ReceiveContext will read the next packet like Receive. If the context is
+	// canceled before a packet is received, the underlying connection is
+	// closed to unblock the read and the context's error is returned.
+	ReceiveContext(ctx context.Context) (packet.GenericPacket, error)
+
 	// Close will close the underlying connection and cleanup resources. It will
 	// return an Error if there was an error while closing the underlying
 	// connection.
@@ -44,11 +65,56 @@ type Conn interface {
 	// return an Error if receiving the next packet will exceed the limit.
 	SetReadLimit(limit int64)
 
+	// SetReadBufferSize sets the size of the buffer used to read from the
+	// underlying connection. Larger buffers allow multiple small packets to be
+	// decoded from a single read.
+	SetReadBufferSize(size int)
+
+	// SetAdaptiveReadBuffer lets the read buffer grow and shrink between min
+	// and max bytes based on the observed packet sizes and reads. A max of
+	// zero disables the adaptive sizing.
+	SetAdaptiveReadBuffer(min, max int)
+
+	// SetStreamThreshold sets the size above which received publish packets
+	// stream their payload from the connection using a PayloadReader instead
+	// of being read into memory. The payload must be consumed before the next
+	// Receive, unread bytes are otherwise discarded.
+	SetStreamThreshold(threshold int)
+
+	// SetInterner sets the Interner used to look up the topics of received
+	// publish packets. An Interner can be shared by multiple connections.
+	SetInterner(interner *packet.Interner)
+
+	// SetArena sets the Arena received publish packets are taken from. The
+	// packets should be released to the arena once they have been processed.
+	SetArena(arena *packet.Arena)
+
+	// ReadStats returns counters about the reads performed on the underlying
+	// connection and the packets decoded from them.
+	ReadStats() packet.DecoderStats
+
+	// PacketStats returns the number of packets and bytes sent and received by
+	// packet type.
+	PacketStats() PacketStats
+
+	// WireStats returns the number of bytes written to and read from the
+	// network including the framing of TLS and WebSocket.
+	WireStats() WireStats
+
 	// SetReadTimeout sets the maximum time that can pass between reads.
 	// If no data is received in the set duration the connection will be closed
 	// and Read returns an error.
 	SetReadTimeout(timeout time.Duration)
 
+	// SetCloseTimeout sets the maximum time Close waits for a blocked write,
+	// e.g. to a peer that stopped reading, before it closes the underlying
+	// connection. Close waits indefinitely if the timeout is zero.
+	SetCloseTimeout(timeout time.Duration)
+
+	// SetStatsHandler attaches the handler to the connection and reports the
+	// connection as opened. It should be set before the connection is used.
+	SetStatsHandler(handler StatsHandler)
+
 	// LocalAddr will return the underlying connection's local net address.
 	LocalAddr() net.Addr
 
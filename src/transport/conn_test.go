@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"testing"
 	"time"
@@ -74,6 +76,8 @@ func abstractConnDecodeErrorTest(t *testing.T, protocol string) {
 			netConn.conn.Write(buf)
 		} else if webSocketConn, ok := conn1.(*WebSocketConn); ok {
 			webSocketConn.conn.WriteMessage(websocket.BinaryMessage, buf)
+		} else if httpConn, ok := conn1.(*HTTPConn); ok {
+			httpConn.stream.Write(buf)
 		}
 
 		pkt, err := conn1.Receive()
@@ -129,6 +133,52 @@ func abstractConnCloseWhileSendTest(t *testing.T, protocol string) {
 	safeReceive(done)
 }
 
+func abstractConnCloseWhileBlockedTest(t *testing.T, protocol string) {
+	wait := make(chan struct{})
+
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		// stop reading until the blocked writer has been closed
+		<-wait
+
+		conn1.Close()
+	})
+
+	conn2.SetCloseTimeout(100 * time.Millisecond)
+
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = make([]byte, 65536)
+
+	blocked := make(chan struct{})
+
+	go func() {
+		defer close(blocked)
+
+		for {
+			err := conn2.BufferedSend(publish)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// let the writer fill the socket buffers
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+		conn2.Close()
+	}()
+
+	safeReceive(closed)
+	safeReceive(blocked)
+
+	close(wait)
+	safeReceive(done)
+}
+
 func abstractConnSendAndCloseTest(t *testing.T, protocol string) {
 	wait := make(chan struct{})
 
@@ -347,3 +397,308 @@ func abstractConnBigBufferedSendAfterCloseTest(t *testing.T, protocol string) {
 
 	safeReceive(done)
 }
+
+func abstractConnReadBatchTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.SetReadBufferSize(64 * 1024)
+
+		for i := 1; i <= 10; i++ {
+			pkt, err := conn1.Receive()
+			assert.Equal(t, pkt.Type(), packet.PUBACK)
+			assert.NoError(t, err)
+		}
+
+		stats := conn1.ReadStats()
+		assert.Equal(t, uint64(10), stats.Packets)
+		assert.True(t, stats.Reads < 10)
+		assert.True(t, stats.PacketsPerRead() > 1)
+
+		pkt, err := conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	for i := 1; i <= 10; i++ {
+		pkt := packet.NewPubackPacket()
+		pkt.ID = packet.ID(i)
+
+		err := conn2.BufferedSend(pkt)
+		assert.NoError(t, err)
+	}
+
+	err := conn2.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func abstractConnInternerTest(t *testing.T, protocol string) {
+	interner := packet.NewInterner(0)
+
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.SetInterner(interner)
+
+		for i := 0; i < 5; i++ {
+			pkt, err := conn1.Receive()
+			assert.NoError(t, err)
+			assert.Equal(t, "foo/bar", pkt.(*packet.PublishPacket).Message.Topic)
+		}
+
+		pkt, err := conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	for i := 0; i < 5; i++ {
+		pub := packet.NewPublishPacket()
+		pub.Message.Topic = "foo/bar"
+
+		err := conn2.Send(pub)
+		assert.NoError(t, err)
+	}
+
+	err := conn2.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	stats := interner.Stats()
+	assert.Equal(t, uint64(4), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func abstractConnPacketStatsTest(t *testing.T, protocol string) {
+	pub := packet.NewPublishPacket()
+	pub.Message.Topic = "foo"
+	pub.Message.Payload = []byte("bar")
+	pub.Message.QOS = 1
+	pub.ID = 1
+
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.PUBLISH, pkt.Type())
+
+		puback := packet.NewPubackPacket()
+		puback.ID = 1
+
+		err = conn1.Send(puback)
+		assert.NoError(t, err)
+
+		stats := conn1.PacketStats()
+		assert.Equal(t, uint64(1), stats.Received.Packets[packet.PUBLISH])
+		assert.Equal(t, uint64(pub.Len()), stats.Received.Bytes[packet.PUBLISH])
+		assert.Equal(t, uint64(3), stats.Received.Payload)
+		assert.Equal(t, uint64(1), stats.Sent.Packets[packet.PUBACK])
+		assert.Equal(t, uint64(4), stats.Sent.Bytes[packet.PUBACK])
+
+		err = conn1.Close()
+		assert.NoError(t, err)
+	})
+
+	err := conn2.Send(pub)
+	assert.NoError(t, err)
+
+	pkt, err := conn2.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.PUBACK, pkt.Type())
+
+	safeReceive(done)
+
+	stats := conn2.PacketStats()
+	assert.Equal(t, uint64(1), stats.Sent.Packets[packet.PUBLISH])
+	assert.Equal(t, uint64(1), stats.Received.Packets[packet.PUBACK])
+
+	total := stats.Merge(stats)
+	assert.Equal(t, uint64(2), total.Sent.Packets[packet.PUBLISH])
+}
+
+func abstractConnWireStatsTest(t *testing.T, protocol string, framed, complete bool) {
+	pub := packet.NewPublishPacket()
+	pub.Message.Topic = "foo"
+	pub.Message.Payload = []byte("bar")
+
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.PUBLISH, pkt.Type())
+
+		stats := conn1.WireStats()
+		assert.Equal(t, complete, stats.Complete)
+		if framed {
+			assert.True(t, stats.Received > int64(pub.Len()))
+		} else {
+			assert.Equal(t, int64(pub.Len()), stats.Received)
+		}
+
+		err = conn1.Close()
+		assert.NoError(t, err)
+	})
+
+	err := conn2.Send(pub)
+	assert.NoError(t, err)
+
+	_, err = conn2.Receive()
+	assert.Error(t, err)
+
+	safeReceive(done)
+
+	stats := conn2.WireStats()
+	assert.Equal(t, complete, stats.Complete)
+	if framed {
+		assert.True(t, stats.Sent > int64(pub.Len()))
+		assert.True(t, stats.Received > 0)
+	} else {
+		assert.Equal(t, int64(pub.Len()), stats.Sent)
+	}
+
+	total := stats.Merge(WireStats{Sent: 1, Complete: true})
+	assert.Equal(t, stats.Sent+1, total.Sent)
+	assert.Equal(t, complete, total.Complete)
+}
+
+func abstractConnFlushTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.Equal(t, pkt.Type(), packet.CONNECT)
+		assert.NoError(t, err)
+
+		err = conn1.Close()
+		assert.NoError(t, err)
+	})
+
+	conn2.SetWriteDelay(time.Minute)
+
+	err := conn2.BufferedSend(packet.NewConnectPacket())
+	assert.NoError(t, err)
+
+	err = conn2.Flush()
+	assert.NoError(t, err)
+
+	pkt, err := conn2.Receive()
+	assert.Nil(t, pkt)
+	assert.Equal(t, io.EOF, err)
+
+	safeReceive(done)
+}
+
+func abstractConnWriteDelayTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		for i := 1; i <= 3; i++ {
+			pkt, err := conn1.Receive()
+			assert.Equal(t, pkt.Type(), packet.PUBACK)
+			assert.NoError(t, err)
+		}
+
+		assert.True(t, conn1.ReadStats().Reads < 3)
+
+		err := conn1.Send(packet.NewConnackPacket())
+		assert.NoError(t, err)
+
+		pkt, err := conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	conn2.SetWriteDelay(10 * time.Millisecond)
+
+	for i := 1; i <= 3; i++ {
+		pkt := packet.NewPubackPacket()
+		pkt.ID = packet.ID(i)
+
+		err := conn2.Send(pkt)
+		assert.NoError(t, err)
+	}
+
+	pkt, err := conn2.Receive()
+	assert.Equal(t, pkt.Type(), packet.CONNACK)
+	assert.NoError(t, err)
+
+	err = conn2.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func abstractConnSendContextTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.Equal(t, pkt.Type(), packet.CONNECT)
+		assert.NoError(t, err)
+
+		pkt, err = conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := conn2.SendContext(ctx, packet.NewConnectPacket())
+	assert.NoError(t, err)
+
+	cancel()
+
+	err = conn2.SendContext(ctx, packet.NewConnectPacket())
+	assert.Equal(t, context.Canceled, err)
+
+	err = conn2.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
+
+func abstractConnReceiveContextTest(t *testing.T, protocol string) {
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		pkt, err := conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Error(t, err)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	pkt, err := conn2.ReceiveContext(ctx)
+	assert.Nil(t, pkt)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	err = conn2.Send(packet.NewConnectPacket())
+	assert.Error(t, err)
+
+	safeReceive(done)
+}
+
+func abstractConnStreamedPayloadTest(t *testing.T, protocol string) {
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+
+	conn2, done := connectionPair(protocol, func(conn1 Conn) {
+		conn1.SetStreamThreshold(1024)
+
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+
+		pub := pkt.(*packet.PublishPacket)
+		assert.Equal(t, len(payload), pub.Message.PayloadLen)
+
+		data, err := io.ReadAll(pub.Message.PayloadReader)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, data)
+
+		pkt, err = conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	pub := packet.NewPublishPacket()
+	pub.Message.Topic = "foo"
+	pub.Message.PayloadReader = bytes.NewReader(payload)
+	pub.Message.PayloadLen = len(payload)
+
+	err := conn2.Send(pub)
+	assert.NoError(t, err)
+
+	err = conn2.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+}
@@ -3,14 +3,16 @@ package transport
 import (
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 
 	"github.com/gorilla/websocket"
 	"log"
 	"strings"
-	"errors"
+	"time"
 )
 
 // The Dialer handles connecting to a server and creating a connection.
@@ -23,10 +25,46 @@ type Dialer struct {
 	DefaultWSPort  string
 	DefaultWSSPort string
 
-	webSocketDialer *websocket.Dialer
+	// The network used for TCP based connections: "tcp" (dual-stack), "tcp4"
+	// or "tcp6". Dual-stack is used if empty.
+	Network string
+
+	// The policy used to retry failed dials. Dials are not retried if no
+	// policy is set.
+	Retry *RetryPolicy
+
+	// The pool of local addresses IPv4 TCP connections are bound to. The
+	// kernel selects the local address if no pool is set or the pool has no
+	// IPs.
+	Sources *SourcePool
+
+	// The handler attached to dialed connections. Connections are not
+	// observed if no handler is set.
+	StatsHandler StatsHandler
+
+	// The interval of WebSocket ping frames sent by dialed WebSocket
+	// connections independent of the MQTT keep alive. No pings are sent if
+	// zero.
+	WebSocketPingInterval time.Duration
 
-	Ips   map[int]net.IP
-	IpIdx int
+	// The function called with the round trip time of the pongs received by
+	// dialed WebSocket connections.
+	WebSocketPongHandler func(rtt time.Duration)
+
+	// The writer the TLS session keys of dialed connections are written to in
+	// the NSS key log format, which Wireshark uses to decrypt captured
+	// traffic. Keys are not logged if no writer is set.
+	//
+	// Note: Logged keys compromise the security of the connections and should
+	// only be used for debugging.
+	KeyLogWriter io.Writer
+
+	// The revocation check run at the end of every TLS handshake, e.g. to
+	// require stapled OCSP responses. Revocation is not checked if no check
+	// is set.
+	Revocation *RevocationCheck
+
+	webSocketDialer *websocket.Dialer
 }
 
 // NewDialer returns a new Dialer.
@@ -40,47 +78,98 @@ func NewDialer() *Dialer {
 			Proxy:        http.ProxyFromEnvironment,
 			Subprotocols: []string{"mqtt"},
 		},
-		Ips:   make(map[int]net.IP),
-		IpIdx: 0,
+		Sources: NewSourcePool(),
 	}
 }
 
+// OpenKeyLog opens the key log file at the specified path for appending and
+// creates it if necessary, so it can be used as the KeyLogWriter of a Dialer.
+func OpenKeyLog(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
 var sharedDialer *Dialer
 
 func init() {
 	sharedDialer = NewDialer()
+
+	// log session keys if requested like browsers and curl
+	if path := os.Getenv("SSLKEYLOGFILE"); path != "" {
+		file, err := OpenKeyLog(path)
+		if err != nil {
+			log.Println("init ", err)
+		} else {
+			sharedDialer.KeyLogWriter = file
+		}
+	}
+
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		log.Println("init ", err)
 	}
-	idx := 0
 	for _, address := range addrs {
 		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 			if ipnet.IP.To4() != nil && strings.HasPrefix(ipnet.IP.String(), "192.168.") {
-				sharedDialer.Ips[idx] = ipnet.IP
-				idx++
-				log.Println(idx, ipnet.IP.String())
+				sharedDialer.Sources.IPs = append(sharedDialer.Sources.IPs, ipnet.IP)
 			}
 		}
 	}
 }
 
+// DefaultDialer returns the Dialer used by the Dial shorthand function.
+func DefaultDialer() *Dialer {
+	return sharedDialer
+}
+
 // Dial is a shorthand function.
 func Dial(urlString string) (Conn, error) {
 	return sharedDialer.Dial(urlString)
 }
 
 // Dial initiates a connection based in information extracted from an URL.
+// Failed dials are retried according to the retry policy.
 func (d *Dialer) Dial(urlString string) (Conn, error) {
-	urlParts, err := url.ParseRequestURI(urlString)
+	var conn Conn
+	var err error
+	if d.Retry == nil {
+		conn, err = d.dial(urlString)
+	} else {
+		conn, err = d.Retry.run(func() (Conn, error) {
+			return d.dial(urlString)
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	host, port, err := net.SplitHostPort(urlParts.Host)
+	// attach handler
+	if d.StatsHandler != nil {
+		conn.SetStatsHandler(d.StatsHandler)
+	}
+
+	// configure web socket keep alive
+	if wsConn, ok := conn.(*WebSocketConn); ok {
+		wsConn.SetPongHandler(d.WebSocketPongHandler)
+		wsConn.SetPingInterval(d.WebSocketPingInterval)
+	}
+
+	return conn, nil
+}
+
+// dial makes a single attempt to connect
+func (d *Dialer) dial(urlString string) (Conn, error) {
+	urlParts, err := url.ParseRequestURI(urlString)
 	if err != nil {
-		host = urlParts.Host
-		port = ""
+		return nil, err
+	}
+
+	// get host without brackets of IPv6 literals
+	host := urlParts.Hostname()
+	port := urlParts.Port()
+
+	network := d.Network
+	if network == "" {
+		network = "tcp"
 	}
 
 	switch urlParts.Scheme {
@@ -88,17 +177,20 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 		if port == "" {
 			port = d.DefaultTCPPort
 		}
-	RELOAD:
-		if len(d.Ips) == 0 {
-			return nil, errors.New("no ip cat use")
+
+		// the local addresses are IPv4 only
+		if network == "tcp6" || isIPv6(host) || d.Sources == nil || d.Sources.Len() == 0 {
+			conn, err := net.Dial(network, net.JoinHostPort(host, port))
+			if err != nil {
+				return nil, err
+			}
+
+			return NewNetConn(conn), nil
 		}
-		localaddr := &net.TCPAddr{IP: d.Ips[d.IpIdx]}
-		dl := net.Dialer{LocalAddr: localaddr}
-		conn, err := dl.Dial("tcp", net.JoinHostPort(host, port))
+
+		conn, err := d.Sources.Dial(network, net.JoinHostPort(host, port))
 		if err != nil {
-			d.IpIdx++
-			log.Println(d.IpIdx, "change local address")
-			goto RELOAD
+			return nil, err
 		}
 
 		return NewNetConn(conn), nil
@@ -107,40 +199,113 @@ func (d *Dialer) Dial(urlString string) (Conn, error) {
 			port = d.DefaultTLSPort
 		}
 
-		conn, err := tls.Dial("tcp", net.JoinHostPort(host, port), d.TLSConfig)
+		conn, wire, err := dialTLS(network, net.JoinHostPort(host, port), d.tlsConfig())
 		if err != nil {
 			return nil, err
 		}
 
-		return NewNetConn(conn), nil
+		c := NewNetConn(conn)
+		c.setWire(wire)
+
+		return c, nil
 	case "ws":
 		if port == "" {
 			port = d.DefaultWSPort
 		}
 
-		wsURL := fmt.Sprintf("ws://%s:%s%s", host, port, urlParts.Path)
+		wsURL := fmt.Sprintf("ws://%s%s", net.JoinHostPort(host, port), urlParts.Path)
 
-		conn, _, err := d.webSocketDialer.Dial(wsURL, d.RequestHeader)
+		var wire *wireConn
+		conn, _, err := d.newWebSocketDialer(network, nil, &wire).Dial(wsURL, d.RequestHeader)
 		if err != nil {
 			return nil, err
 		}
 
-		return NewWebSocketConn(conn), nil
+		c := NewWebSocketConn(conn)
+		c.setWire(wire)
+
+		return c, nil
 	case "wss":
 		if port == "" {
 			port = d.DefaultWSSPort
 		}
 
-		wsURL := fmt.Sprintf("wss://%s:%s%s", host, port, urlParts.Path)
+		wsURL := fmt.Sprintf("wss://%s%s", net.JoinHostPort(host, port), urlParts.Path)
+
+		var wire *wireConn
+		conn, _, err := d.newWebSocketDialer(network, d.tlsConfig(), &wire).Dial(wsURL, d.RequestHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		c := NewWebSocketConn(conn)
+		c.setWire(wire)
+
+		return c, nil
+	case "wss+h2":
+		if port == "" {
+			port = d.DefaultWSSPort
+		}
+
+		wsURL := fmt.Sprintf("wss://%s%s", net.JoinHostPort(host, port), urlParts.Path)
 
-		d.webSocketDialer.TLSClientConfig = d.TLSConfig
-		conn, _, err := d.webSocketDialer.Dial(wsURL, d.RequestHeader)
+		conn, err := DialWebSocketH2(network, wsURL, d.tlsConfig(), d.RequestHeader)
 		if err != nil {
 			return nil, err
 		}
 
-		return NewWebSocketConn(conn), nil
+		return conn, nil
+	case "http+poll", "http+sse", "https+poll", "https+sse":
+		scheme, mode := splitHTTPScheme(urlParts.Scheme)
+
+		if port == "" {
+			port = d.DefaultWSPort
+			if scheme == "https" {
+				port = d.DefaultWSSPort
+			}
+		}
+
+		httpURL := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, port), urlParts.Path)
+
+		return DialHTTP(httpURL, mode, d.tlsConfig(), d.RequestHeader)
+	case "npipe":
+		path, err := PipePath(urlParts)
+		if err != nil {
+			return nil, err
+		}
+
+		return DialPipe(path)
 	}
 
 	return nil, ErrUnsupportedProtocol
 }
+
+// returns a copy of the web socket dialer for a single dial, the shared dialer
+// is never modified as dials may run concurrently
+func (d *Dialer) newWebSocketDialer(network string, config *tls.Config, wire **wireConn) *websocket.Dialer {
+	dialer := *d.webSocketDialer
+	dialer.TLSClientConfig = config
+	dialer.NetDial = wireDial(network, wire)
+
+	return &dialer
+}
+
+// returns the TLS config with the key log writer and revocation check if set
+func (d *Dialer) tlsConfig() *tls.Config {
+	if d.KeyLogWriter == nil && d.Revocation == nil {
+		return d.TLSConfig
+	}
+
+	config := &tls.Config{}
+	if d.Revocation != nil {
+		config = d.Revocation.Apply(d.TLSConfig)
+	} else if d.TLSConfig != nil {
+		config = d.TLSConfig.Clone()
+	}
+
+	if d.KeyLogWriter != nil {
+		config.KeyLogWriter = d.KeyLogWriter
+	}
+
+	return config
+}
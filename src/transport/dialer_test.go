@@ -1,7 +1,9 @@
 package transport
 
 import (
+	"bytes"
 	"io"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -73,6 +75,18 @@ func TestDialerWSSError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDialerHTTPError(t *testing.T) {
+	conn, err := Dial("http+poll://localhost:1234567")
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+}
+
+func TestDialerHTTPSError(t *testing.T) {
+	conn, err := Dial("https+sse://localhost:1234567")
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+}
+
 func abstractDefaultPortTest(t *testing.T, protocol string) {
 	server, err := testLauncher.Launch(protocol + "://localhost:0")
 	require.NoError(t, err)
@@ -118,3 +132,149 @@ func TestWSDefaultPort(t *testing.T) {
 func TestWSSDefaultPort(t *testing.T) {
 	abstractDefaultPortTest(t, "wss")
 }
+
+func TestHTTPDefaultPort(t *testing.T) {
+	abstractDefaultPortTest(t, "http+poll")
+}
+
+func TestHTTPSDefaultPort(t *testing.T) {
+	abstractDefaultPortTest(t, "https+sse")
+}
+
+func abstractKeyLogTest(t *testing.T, protocol string) {
+	server, err := testLauncher.Launch(protocol + "://localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+	}()
+
+	var keys bytes.Buffer
+
+	dialer := NewDialer()
+	dialer.TLSConfig = clientTLSConfig
+	dialer.KeyLogWriter = &keys
+
+	conn, err := dialer.Dial(getURL(server, protocol))
+	require.NoError(t, err)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	// the shared config is not modified
+	assert.Nil(t, clientTLSConfig.KeyLogWriter)
+	assert.Contains(t, keys.String(), "CLIENT_")
+}
+
+func TestTLSKeyLog(t *testing.T) {
+	abstractKeyLogTest(t, "tls")
+}
+
+func TestWSSKeyLog(t *testing.T) {
+	abstractKeyLogTest(t, "wss")
+}
+
+func TestDialerIPv6(t *testing.T) {
+	for _, protocol := range []string{"tcp", "ws"} {
+		server, err := testLauncher.Launch(protocol + "://[::1]:0")
+		require.NoError(t, err)
+
+		wait := make(chan struct{})
+
+		go func() {
+			conn, err := server.Accept()
+			require.NoError(t, err)
+			assert.Equal(t, "v6", AddrFamily(conn.RemoteAddr()))
+
+			pkt, err := conn.Receive()
+			assert.Nil(t, pkt)
+			assert.Equal(t, io.EOF, err)
+
+			close(wait)
+		}()
+
+		conn, err := NewDialer().Dial(getURL(server, protocol))
+		require.NoError(t, err)
+		assert.Equal(t, "v6", AddrFamily(conn.RemoteAddr()))
+
+		err = conn.Close()
+		assert.NoError(t, err)
+
+		safeReceive(wait)
+
+		err = server.Close()
+		assert.NoError(t, err)
+	}
+}
+
+func TestDialerNetwork(t *testing.T) {
+	server, err := testLauncher.Launch("ws://[::1]:0")
+	require.NoError(t, err)
+
+	dialer := NewDialer()
+	dialer.Network = "tcp4"
+
+	conn, err := dialer.Dial(getURL(server, "ws"))
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestDefaultDialer(t *testing.T) {
+	assert.Equal(t, sharedDialer, DefaultDialer())
+}
+
+func abstractConcurrentDialTest(t *testing.T, protocol string) {
+	server, err := testLauncher.Launch(protocol + "://localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = clientTLSConfig
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := dialer.Dial(getURL(server, protocol))
+			if assert.NoError(t, err) {
+				conn.Close()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestWSConcurrentDial(t *testing.T) {
+	abstractConcurrentDialTest(t, "ws")
+}
+
+func TestWSSConcurrentDial(t *testing.T) {
+	abstractConcurrentDialTest(t, "wss")
+}
@@ -0,0 +1,41 @@
+package transport
+
+import (
+	"net"
+	"strings"
+)
+
+// AddrFamily returns "v4" or "v6" for the IP family of a TCP or UDP address
+// or an empty string if the address has no IP.
+func AddrFamily(addr net.Addr) string {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return ""
+	}
+
+	if ip == nil {
+		return ""
+	} else if ip.To4() != nil {
+		return "v4"
+	}
+
+	return "v6"
+}
+
+// isIPv6 returns whether the host is an IPv6 literal
+func isIPv6(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil && strings.Contains(host, ":")
+}
+
+// netDial returns a dial function that uses the specified network
+func netDial(network string) func(string, string) (net.Conn, error) {
+	return func(_, addr string) (net.Conn, error) {
+		return net.Dial(network, addr)
+	}
+}
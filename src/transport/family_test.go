@@ -0,0 +1,24 @@
+package transport
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrFamily(t *testing.T) {
+	assert.Equal(t, "v4", AddrFamily(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}))
+	assert.Equal(t, "v6", AddrFamily(&net.TCPAddr{IP: net.ParseIP("::1")}))
+	assert.Equal(t, "v4", AddrFamily(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")}))
+	assert.Equal(t, "", AddrFamily(&net.TCPAddr{}))
+	assert.Equal(t, "", AddrFamily(&net.UnixAddr{Name: "foo"}))
+}
+
+func TestIsIPv6(t *testing.T) {
+	assert.True(t, isIPv6("::1"))
+	assert.True(t, isIPv6("fe80::1"))
+	assert.False(t, isIPv6("127.0.0.1"))
+	assert.False(t, isIPv6("::ffff:127.0.0.1"))
+	assert.False(t, isIPv6("localhost"))
+}
@@ -0,0 +1,86 @@
+package flow
+
+import (
+	"fmt"
+	"sync"
+
+	"transport"
+)
+
+// A Loop tests flows on the connections accepted by a server.
+type Loop struct {
+	accepted int
+	errs     []error
+	mutex    sync.Mutex
+
+	group sync.WaitGroup
+	done  chan struct{}
+}
+
+// AcceptLoop will accept connections from the server until it is closed and
+// test the flow returned by fn on every connection concurrently. The function
+// may return a connection specific flow or nil to close the connection
+// immediately. Flows that are returned for multiple connections must not be
+// randomized.
+func AcceptLoop(server transport.Server, fn func(conn transport.Conn) *Flow) *Loop {
+	l := &Loop{
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(l.done)
+
+		for {
+			// accept next connection
+			conn, err := server.Accept()
+			if err != nil {
+				break
+			}
+
+			l.mutex.Lock()
+			l.accepted++
+			l.mutex.Unlock()
+
+			f := fn(conn)
+			if f == nil {
+				conn.Close()
+				continue
+			}
+
+			l.group.Add(1)
+			go func() {
+				defer l.group.Done()
+
+				err := f.Test(conn)
+				if err != nil {
+					l.mutex.Lock()
+					l.errs = append(l.errs, fmt.Errorf("%s: %v", conn.RemoteAddr(), err))
+					l.mutex.Unlock()
+				}
+			}()
+		}
+
+		l.group.Wait()
+	}()
+
+	return l
+}
+
+// Accepted returns the number of accepted connections.
+func (l *Loop) Accepted() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.accepted
+}
+
+// Wait will wait until the server has been closed and all flows have
+// completed. It returns the errors of the failed flows.
+func (l *Loop) Wait() []error {
+	<-l.done
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.errs
+}
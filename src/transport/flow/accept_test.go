@@ -0,0 +1,92 @@
+package flow
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+	"transport"
+)
+
+func TestAcceptLoop(t *testing.T) {
+	server, err := transport.NewNetServer("localhost:0")
+	require.NoError(t, err)
+
+	connect := packet.NewConnectPacket()
+	connect.ClientID = "test"
+
+	// reject every third connection
+	var count int
+	loop := AcceptLoop(server, func(conn transport.Conn) *Flow {
+		count++
+		if count%3 == 0 {
+			return nil
+		}
+
+		return New().
+			Receive(connect).
+			Send(packet.NewConnackPacket()).
+			End()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c, err := net.Dial("tcp", server.Addr().String())
+			require.NoError(t, err)
+
+			conn := transport.NewNetConn(c)
+
+			err = conn.Send(connect)
+			assert.NoError(t, err)
+
+			pkt, err := conn.Receive()
+			if err == nil {
+				assert.Equal(t, packet.CONNACK, pkt.Type())
+			}
+
+			conn.Close()
+		}()
+	}
+
+	wg.Wait()
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	assert.Empty(t, loop.Wait())
+	assert.Equal(t, 6, loop.Accepted())
+}
+
+func TestAcceptLoopError(t *testing.T) {
+	server, err := transport.NewNetServer("localhost:0")
+	require.NoError(t, err)
+
+	loop := AcceptLoop(server, func(conn transport.Conn) *Flow {
+		return New().Receive(packet.NewPingreqPacket())
+	})
+
+	c, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+
+	conn := transport.NewNetConn(c)
+	err = conn.Send(packet.NewPingrespPacket())
+	assert.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+	conn.Close()
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	errs := loop.Wait()
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "expected packet of")
+}
@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Background will start the actions of the sub flow in the background once the
+// action is reached. The sub flow runs alongside the remaining actions and is
+// canceled when the flow ends. If the interval is positive the sub flow is
+// repeated after every interval, e.g. to send PINGREQ packets as a keep alive.
+// Background flows share the context and clock of the flow and send on the
+// same connection, which must support concurrent sends. They must not receive
+// packets as those are consumed by the flow. A failed background flow fails
+// the flow once the remaining actions completed.
+func (f *Flow) Background(interval time.Duration, sub *Flow) *Flow {
+	f.add(&action{
+		kind:     actionBackground,
+		duration: interval,
+		flow:     sub,
+	})
+
+	return f
+}
+
+// background manages the background flows of a single test
+type background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	group  sync.WaitGroup
+	once   sync.Once
+	mutex  sync.Mutex
+	err    error
+}
+
+func newBackground(ctx context.Context) *background {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &background{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// start runs the sub flow of the action until the test ends
+func (b *background) start(f *Flow, action *action, conn Conn) {
+	sub := &Flow{
+		actions: action.flow.actions,
+		context: f.context,
+		clock:   f.clock,
+	}
+
+	b.group.Add(1)
+	go func() {
+		defer b.group.Done()
+
+		for {
+			err := sub.TestContext(b.ctx, conn)
+			if err != nil && b.ctx.Err() == nil {
+				b.fail(action, err)
+				return
+			} else if err != nil || action.duration <= 0 {
+				return
+			}
+
+			// wait for next run
+			timer := f.clock.NewTimer(action.duration)
+			select {
+			case <-timer.C():
+			case <-b.ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// fail records the first failure
+func (b *background) fail(action *action, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.err != nil {
+		return
+	}
+
+	b.err = fmt.Errorf("background flow failed: %v", err)
+	if action.name != "" {
+		b.err = fmt.Errorf("%s: %w", action.name, b.err)
+	}
+}
+
+// stop cancels the background flows, waits until they returned and returns
+// the first failure
+func (b *background) stop() error {
+	b.once.Do(func() {
+		b.cancel()
+		b.group.Wait()
+	})
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.err
+}
@@ -0,0 +1,71 @@
+package flow
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+func TestFlowBackground(t *testing.T) {
+	pipe := NewPipeSize(100)
+
+	var pings int32
+	ping := New().Send(packet.NewPingreqPacket()).Run(func() {
+		atomic.AddInt32(&pings, 1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for atomic.LoadInt32(&pings) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+
+		close(done)
+	}()
+
+	flow := New().
+		Background(time.Millisecond, ping).
+		Wait(done).
+		SkipN(3)
+
+	err := flow.Test(pipe)
+	assert.NoError(t, err)
+
+	// background flow is canceled
+	count := atomic.LoadInt32(&pings)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, count, atomic.LoadInt32(&pings))
+}
+
+func TestFlowBackgroundOnce(t *testing.T) {
+	pipe := NewPipe()
+
+	flow := New().
+		Background(0, New().Send(packet.NewPingreqPacket())).
+		Receive(packet.NewPingreqPacket())
+
+	err := flow.Test(pipe)
+	assert.NoError(t, err)
+}
+
+func TestFlowBackgroundError(t *testing.T) {
+	pipe := NewPipe()
+	pipe.Close()
+
+	flow := New().
+		Background(0, New().Send(packet.NewPingreqPacket())).Named("keep alive").
+		Delay(10 * time.Millisecond)
+
+	err := flow.Test(pipe)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "keep alive: background flow failed")
+
+	flow.ContinueOnFailure()
+
+	err = flow.Test(pipe)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "background flow failed")
+}
@@ -0,0 +1,441 @@
+package flow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"packet"
+)
+
+// ErrNotSerializable is returned by MarshalBinary if the flow contains actions
+// that reference code or channels, like Run, Wait, EndMatching or Receive with
+// payload matchers.
+var ErrNotSerializable = errors.New("flow not serializable")
+
+// ErrInvalidFormat is returned by UnmarshalBinary if the data is not a valid
+// encoded flow.
+var ErrInvalidFormat = errors.New("invalid flow format")
+
+// the magic and version at the start of an encoded flow
+var codecMagic = []byte("MQFL")
+
+const codecVersion = 2
+
+// the version before the comparison options of receive actions were encoded
+const codecVersionV1 = 1
+
+// the comparison options that can be encoded, as a bit mask in this order
+var codecEqualOptions = []packet.EqualOption{packet.IgnoreID, packet.IgnoreDup}
+
+// the flags of an encoded flow
+const (
+	codecContinueOnFailure = 1 << iota
+	codecRandomized
+)
+
+// MarshalBinary encodes the flow to a compact binary format that can be
+// stored or transferred and decoded with UnmarshalBinary. The format contains
+// the actions with their packets, names and nested flows as well as the
+// failure mode and the randomization seed. The context, clock and golden file
+// are not encoded.
+func (f *Flow) MarshalBinary() ([]byte, error) {
+	e := &encoder{}
+
+	// write header
+	e.buf = append(e.buf, codecMagic...)
+	e.buf = append(e.buf, codecVersion)
+
+	var flags byte
+	if f.continueOnFailure {
+		flags |= codecContinueOnFailure
+	}
+	if f.rand != nil {
+		flags |= codecRandomized
+	}
+
+	e.buf = append(e.buf, flags)
+	if f.rand != nil {
+		e.varint(f.seed)
+	}
+
+	// write actions
+	err := e.actions(f.actions)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary replaces the actions, the failure mode and the
+// randomization of the flow with the ones decoded from data.
+func (f *Flow) UnmarshalBinary(data []byte) error {
+	d := &decoder{buf: data}
+
+	// read header
+	magic := d.bytes(len(codecMagic))
+	d.version = d.byte()
+	if d.err == nil && (string(magic) != string(codecMagic) || (d.version != codecVersion && d.version != codecVersionV1)) {
+		return ErrInvalidFormat
+	}
+
+	flags := d.byte()
+
+	var seed int64
+	if flags&codecRandomized != 0 {
+		seed = d.varint()
+	}
+
+	// read actions
+	actions := d.actions()
+	if d.err != nil {
+		return d.err
+	} else if len(d.buf) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidFormat, len(d.buf))
+	}
+
+	f.actions = actions
+	f.continueOnFailure = flags&codecContinueOnFailure != 0
+	f.rand = nil
+	f.seed = 0
+	if flags&codecRandomized != 0 {
+		f.Randomize(seed)
+	}
+
+	return nil
+}
+
+// an encoder appends the encoded parts of a flow to a buffer
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uvarint(n uint64) {
+	e.buf = binary.AppendUvarint(e.buf, n)
+}
+
+func (e *encoder) varint(n int64) {
+	e.buf = binary.AppendVarint(e.buf, n)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) packet(pkt packet.GenericPacket) error {
+	// grow buffer
+	start := len(e.buf)
+	e.buf = append(e.buf, make([]byte, pkt.Len())...)
+
+	_, err := pkt.Encode(e.buf[start:])
+	return err
+}
+
+func (e *encoder) equal(opts []packet.EqualOption) {
+	var mask byte
+	for i, known := range codecEqualOptions {
+		for _, opt := range opts {
+			if opt == known {
+				mask |= 1 << i
+			}
+		}
+	}
+
+	e.byte(mask)
+}
+
+func (e *encoder) actions(actions []*action) error {
+	e.uvarint(uint64(len(actions)))
+
+	for i, a := range actions {
+		err := e.action(a)
+		if err != nil {
+			return fmt.Errorf("action %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) action(a *action) error {
+	e.byte(a.kind)
+	e.string(a.name)
+
+	switch a.kind {
+	case actionSend:
+		return e.packet(a.packet)
+	case actionReceive:
+		if len(a.matchers) > 0 {
+			return fmt.Errorf("%w: payload matchers", ErrNotSerializable)
+		}
+
+		e.equal(a.equal)
+		return e.packet(a.packet)
+	case actionReceiveAll:
+		e.equal(a.equal)
+		e.uvarint(uint64(len(a.packets)))
+		for _, pkt := range a.packets {
+			err := e.packet(pkt)
+			if err != nil {
+				return err
+			}
+		}
+	case actionSkip:
+		e.uvarint(uint64(a.count))
+	case actionSkipWhile, actionReceiveType:
+		e.byte(byte(a.packetType))
+	case actionDelay:
+		e.varint(int64(a.duration))
+	case actionRetry:
+		e.uvarint(uint64(a.count))
+		e.varint(int64(a.duration))
+		return e.actions(a.flow.actions)
+	case actionBackground:
+		e.varint(int64(a.duration))
+		return e.actions(a.flow.actions)
+	case actionClose:
+	case actionEnd:
+		if a.matcher != nil {
+			return fmt.Errorf("%w: end matching function", ErrNotSerializable)
+		}
+
+		e.uvarint(uint64(len(a.ends)))
+		for _, kind := range a.ends {
+			e.byte(byte(kind))
+		}
+	case actionInterleave:
+		e.uvarint(uint64(len(a.groups)))
+		for _, group := range a.groups {
+			e.string(group.name)
+			e.uvarint(uint64(len(group.after)))
+			for _, name := range group.after {
+				e.string(name)
+			}
+
+			err := e.actions(group.flow.actions)
+			if err != nil {
+				return fmt.Errorf("group %s: %w", group.name, err)
+			}
+		}
+	case actionWait:
+		return fmt.Errorf("%w: wait channel", ErrNotSerializable)
+	case actionRun:
+		return fmt.Errorf("%w: run function", ErrNotSerializable)
+	default:
+		return fmt.Errorf("%w: unknown action %d", ErrNotSerializable, a.kind)
+	}
+
+	return nil
+}
+
+// a decoder consumes the encoded parts of a flow from a buffer, the first
+// error is kept and stops all further reads
+type decoder struct {
+	buf     []byte
+	err     error
+	version byte
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidFormat}, args...)...)
+	}
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	} else if n < 0 || n > len(d.buf) {
+		d.fail("unexpected end")
+		return nil
+	}
+
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	n, l := binary.Uvarint(d.buf)
+	if l <= 0 {
+		d.fail("malformed varint")
+		return 0
+	}
+
+	d.buf = d.buf[l:]
+
+	return n
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	n, l := binary.Varint(d.buf)
+	if l <= 0 {
+		d.fail("malformed varint")
+		return 0
+	}
+
+	d.buf = d.buf[l:]
+
+	return n
+}
+
+// count reads a length and checks that it does not exceed the remaining data,
+// which prevents huge allocations for corrupt input
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail("count %d exceeds data", n)
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.count()))
+}
+
+func (d *decoder) packet() packet.GenericPacket {
+	if d.err != nil {
+		return nil
+	}
+
+	// detect packet
+	l, t := packet.DetectPacket(d.buf)
+	if l == 0 || l > len(d.buf) {
+		d.fail("incomplete packet")
+		return nil
+	}
+
+	// create packet
+	pkt, err := t.New()
+	if err != nil {
+		d.fail("%v", err)
+		return nil
+	}
+
+	// decode packet
+	_, err = pkt.Decode(d.bytes(l))
+	if err != nil {
+		d.fail("%v", err)
+		return nil
+	}
+
+	return pkt
+}
+
+func (d *decoder) equal() []packet.EqualOption {
+	// flows of the first version have no options
+	if d.version == codecVersionV1 {
+		return nil
+	}
+
+	mask := d.byte()
+	if mask>>len(codecEqualOptions) != 0 {
+		d.fail("unknown comparison options %#x", mask)
+		return nil
+	}
+
+	var opts []packet.EqualOption
+	for i, opt := range codecEqualOptions {
+		if mask&(1<<i) != 0 {
+			opts = append(opts, opt)
+		}
+	}
+
+	return opts
+}
+
+func (d *decoder) actions() []*action {
+	n := d.count()
+
+	actions := make([]*action, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		actions = append(actions, d.action())
+	}
+
+	return actions
+}
+
+func (d *decoder) action() *action {
+	a := &action{
+		kind: d.byte(),
+		name: d.string(),
+	}
+
+	switch a.kind {
+	case actionSend:
+		a.packet = d.packet()
+	case actionReceive:
+		a.equal = d.equal()
+		a.packet = d.packet()
+	case actionReceiveAll:
+		a.equal = d.equal()
+		n := d.count()
+		for i := 0; i < n && d.err == nil; i++ {
+			a.packets = append(a.packets, d.packet())
+		}
+	case actionSkip:
+		a.count = int(d.uvarint())
+	case actionSkipWhile, actionReceiveType:
+		a.packetType = packet.Type(d.byte())
+	case actionDelay:
+		a.duration = time.Duration(d.varint())
+	case actionRetry:
+		a.count = int(d.uvarint())
+		a.duration = time.Duration(d.varint())
+		a.flow = New()
+		a.flow.actions = d.actions()
+	case actionBackground:
+		a.duration = time.Duration(d.varint())
+		a.flow = New()
+		a.flow.actions = d.actions()
+	case actionClose:
+	case actionEnd:
+		n := d.count()
+		for i := 0; i < n && d.err == nil; i++ {
+			a.ends = append(a.ends, EndKind(d.byte()))
+		}
+	case actionInterleave:
+		n := d.count()
+		for i := 0; i < n && d.err == nil; i++ {
+			group := NewGroup(d.string(), New())
+			m := d.count()
+			for j := 0; j < m && d.err == nil; j++ {
+				group.after = append(group.after, d.string())
+			}
+
+			group.flow.actions = d.actions()
+			a.groups = append(a.groups, group)
+		}
+	default:
+		d.fail("unknown action %d", a.kind)
+	}
+
+	return a
+}
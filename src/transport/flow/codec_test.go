@@ -0,0 +1,131 @@
+package flow
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+)
+
+func TestFlowBinary(t *testing.T) {
+	connect := packet.NewConnectPacket()
+	connect.ClientID = "codec"
+
+	publish := packet.NewPublishPacket()
+	publish.ID = 1
+	publish.Message = packet.Message{Topic: "test", Payload: []byte("hello"), QOS: 1}
+
+	puback := packet.NewPubackPacket()
+	puback.ID = 1
+
+	original := New().
+		ContinueOnFailure().
+		Randomize(42).
+		Send(connect).Named("connect").
+		Receive(packet.NewConnackPacket()).Named("expect CONNACK").
+		Delay(time.Millisecond).
+		Retry(2, time.Second, New().Send(packet.NewPingreqPacket()).Receive(packet.NewPingrespPacket())).
+		Interleave(
+			NewGroup("publish", New().Send(publish).Receive(puback)),
+			NewGroup("ping", New().Send(packet.NewPingreqPacket())).After("publish"),
+		).
+		Ignore(packet.IgnoreDup).
+		ReceiveAllOf(packet.NewPingrespPacket(), packet.NewPingrespPacket()).
+		SkipN(2).
+		SkipWhile(packet.PINGRESP).
+		ReceiveType(packet.PUBACK).
+		Close().
+		EndWith(EndEOF, EndReset).
+		Background(time.Second, New().Send(packet.NewPingreqPacket()))
+
+	data, err := original.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, "MQFL", string(data[:4]))
+
+	decoded := New()
+	err = decoded.UnmarshalBinary(data)
+	require.NoError(t, err)
+
+	assert.True(t, decoded.continueOnFailure)
+	assert.Equal(t, int64(42), decoded.seed)
+	assert.NotNil(t, decoded.rand)
+	require.Len(t, decoded.actions, len(original.actions))
+	assert.Equal(t, "expect CONNACK", decoded.actions[1].name)
+	assert.Equal(t, connect.String(), decoded.actions[0].packet.String())
+	assert.Equal(t, time.Millisecond, decoded.actions[2].duration)
+	assert.Equal(t, []string{"publish"}, decoded.actions[4].groups[1].after)
+	assert.Equal(t, publish.String(), decoded.actions[4].groups[0].flow.actions[0].packet.String())
+	assert.Empty(t, decoded.actions[1].equal)
+	assert.Equal(t, []packet.EqualOption{packet.IgnoreDup}, decoded.actions[5].equal)
+	assert.Equal(t, packet.PUBACK, decoded.actions[8].packetType)
+	assert.Equal(t, []EndKind{EndEOF, EndReset}, decoded.actions[10].ends)
+	assert.Equal(t, time.Second, decoded.actions[11].duration)
+	assert.Len(t, decoded.actions[11].flow.actions, 1)
+
+	// encoding is stable
+	again, err := decoded.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+}
+
+func TestFlowBinaryTest(t *testing.T) {
+	data, err := New().
+		Receive(packet.NewPingreqPacket()).
+		Send(packet.NewPingrespPacket()).
+		MarshalBinary()
+	require.NoError(t, err)
+
+	f := New()
+	require.NoError(t, f.UnmarshalBinary(data))
+
+	pipe := NewPipeSize(1)
+	pipe.Send(packet.NewPingreqPacket())
+
+	assert.NoError(t, f.Test(pipe))
+
+	pkt, err := pipe.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, packet.PINGRESP, pkt.Type())
+}
+
+func TestFlowBinaryVersion1(t *testing.T) {
+	// a flow encoded before the comparison options were added
+	f := New()
+	require.NoError(t, f.UnmarshalBinary([]byte{'M', 'Q', 'F', 'L', 1, 0, 1, actionReceive, 0, 0xd0, 0}))
+	require.Len(t, f.actions, 1)
+	assert.Equal(t, packet.PINGRESP, f.actions[0].packet.Type())
+	assert.Empty(t, f.actions[0].equal)
+}
+
+func TestFlowBinaryNotSerializable(t *testing.T) {
+	for _, f := range []*Flow{
+		New().Run(func() {}),
+		New().Wait(make(chan struct{})),
+		New().EndMatching(func(error) bool { return true }),
+		New().Receive(packet.NewPublishPacket(), PayloadEquals([]byte("x"))),
+		New().Retry(1, 0, New().Run(func() {})),
+	} {
+		_, err := f.MarshalBinary()
+		assert.True(t, errors.Is(err, ErrNotSerializable), err)
+	}
+}
+
+func TestFlowBinaryInvalid(t *testing.T) {
+	data, err := New().Send(packet.NewPingreqPacket()).MarshalBinary()
+	require.NoError(t, err)
+
+	for _, bad := range [][]byte{
+		nil,
+		[]byte("JUNK\x01\x00\x00"),
+		data[:len(data)-1],
+		append(append([]byte{}, data...), 0),
+		{'M', 'Q', 'F', 'L', codecVersion, 0, 0xff, 0xff, 0xff, 0xff, 0x0f},
+		{'M', 'Q', 'F', 'L', codecVersion, 0, 1, actionReceive, 0, 0x80, 0xd0, 0},
+	} {
+		err = New().UnmarshalBinary(bad)
+		assert.True(t, errors.Is(err, ErrInvalidFormat), err)
+	}
+}
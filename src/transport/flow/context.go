@@ -0,0 +1,58 @@
+package flow
+
+import "sync"
+
+// A Context is a key/value store that is attached to a flow and handed to
+// callbacks and matchers. It is safe for concurrent use, which allows flows
+// that run in parallel to share state when they are attached to the same
+// context.
+type Context struct {
+	values map[string]interface{}
+	mutex  sync.RWMutex
+}
+
+// NewContext returns a new Context.
+func NewContext() *Context {
+	return &Context{
+		values: make(map[string]interface{}),
+	}
+}
+
+// Set will store the value under the specified key.
+func (c *Context) Set(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.values[key] = value
+}
+
+// Get returns the value stored under the specified key and whether it exists.
+func (c *Context) Get(key string) (interface{}, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	value, ok := c.values[key]
+
+	return value, ok
+}
+
+// Delete will remove the value stored under the specified key.
+func (c *Context) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.values, key)
+}
+
+// Update will atomically replace the value stored under the specified key
+// with the value returned by fn. The function receives nil if the key does not
+// exist and must not access the context itself.
+func (c *Context) Update(key string, fn func(value interface{}) interface{}) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value := fn(c.values[key])
+	c.values[key] = value
+
+	return value
+}
@@ -0,0 +1,51 @@
+package flow
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	ctx := NewContext()
+
+	value, ok := ctx.Get("foo")
+	assert.Nil(t, value)
+	assert.False(t, ok)
+
+	ctx.Set("foo", "bar")
+
+	value, ok = ctx.Get("foo")
+	assert.Equal(t, "bar", value)
+	assert.True(t, ok)
+
+	ctx.Delete("foo")
+
+	_, ok = ctx.Get("foo")
+	assert.False(t, ok)
+}
+
+func TestContextUpdate(t *testing.T) {
+	ctx := NewContext()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				ctx.Update("counter", func(value interface{}) interface{} {
+					n, _ := value.(int)
+					return n + 1
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	value, _ := ctx.Get("counter")
+	assert.Equal(t, 1000, value)
+}
@@ -0,0 +1,53 @@
+package flow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A StepError is the failure of a single action of a flow.
+type StepError struct {
+	// The one based position of the action in the flow.
+	Step int
+
+	// The error of the action.
+	Err error
+}
+
+// Error returns the error prefixed with the step.
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d: %v", e.Step, e.Err)
+}
+
+// Unwrap returns the error of the action.
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Failures is returned by flows that continue on failure and lists the
+// failures in the order they occurred.
+type Failures struct {
+	// The number of actions of the flow.
+	Steps int
+
+	// The errors of the failed actions.
+	Errors []error
+}
+
+// Error returns a summary of all failures.
+func (f *Failures) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d steps failed:", len(f.Errors), f.Steps)
+
+	for _, err := range f.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(err.Error())
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the errors of the failed actions.
+func (f *Failures) Unwrap() []error {
+	return f.Errors
+}
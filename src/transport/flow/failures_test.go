@@ -0,0 +1,52 @@
+package flow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+)
+
+func TestFlowContinueOnFailure(t *testing.T) {
+	pipe := NewPipeSize(3)
+	pipe.Send(packet.NewPingreqPacket())
+	pipe.Send(packet.NewPingrespPacket())
+	pipe.Send(packet.NewDisconnectPacket())
+
+	err := New().
+		ContinueOnFailure().
+		Receive(packet.NewConnectPacket()).Named("expect CONNECT").
+		Receive(packet.NewPingrespPacket()).
+		RunContext(func(ctx *Context) {}).
+		Receive(packet.NewPingreqPacket()).
+		Test(pipe)
+	require.Error(t, err)
+
+	var failures *Failures
+	require.True(t, errors.As(err, &failures))
+	assert.Equal(t, 4, failures.Steps)
+	assert.Len(t, failures.Errors, 2)
+
+	var step *StepError
+	require.True(t, errors.As(failures.Errors[0], &step))
+	assert.Equal(t, 1, step.Step)
+	assert.Contains(t, step.Error(), "step 1: expect CONNECT: expected packet of")
+
+	require.True(t, errors.As(failures.Errors[1], &step))
+	assert.Equal(t, 4, step.Step)
+
+	assert.Contains(t, err.Error(), "2 of 4 steps failed:\n  step 1: ")
+}
+
+func TestFlowContinueOnFailureSuccess(t *testing.T) {
+	pipe := NewPipeSize(1)
+	pipe.Send(packet.NewPingreqPacket())
+
+	err := New().
+		ContinueOnFailure().
+		Receive(packet.NewPingreqPacket()).
+		Test(pipe)
+	assert.NoError(t, err)
+}
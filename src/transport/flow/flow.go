@@ -2,12 +2,18 @@
 package flow
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"clock"
 	"packet"
 )
 
@@ -18,79 +24,357 @@ type Conn interface {
 	Close() error
 }
 
+// A ContextConn is a Conn whose blocking operations can be canceled. Flows
+// tested with a context use these methods if the connection implements them.
+type ContextConn interface {
+	Conn
+
+	SendContext(ctx context.Context, pkt packet.GenericPacket) error
+	ReceiveContext(ctx context.Context) (packet.GenericPacket, error)
+}
+
+// ErrPipeFull is returned by TrySend if the packet cannot be queued without
+// blocking.
+var ErrPipeFull = errors.New("pipe full")
+
+// ErrPipeClosed is returned by the send methods if the pipe has been closed.
+var ErrPipeClosed = errors.New("already closed")
+
 // The Pipe pipes packets from Send to Receive.
 type Pipe struct {
-	pipe  chan packet.GenericPacket
-	close chan struct{}
+	capacity int
+	queue    []packet.GenericPacket
+	sent     uint64
+	received uint64
+	waiting  int
+	closed   bool
+	changed  chan struct{}
+	mutex    sync.Mutex
 }
 
-// NewPipe returns a new Pipe.
+// NewPipe returns a new Pipe that has no capacity. Send blocks until the
+// packet has been received.
 func NewPipe() *Pipe {
+	return NewPipeSize(0)
+}
+
+// NewPipeSize returns a new Pipe that queues up to the specified number of
+// packets before Send blocks, which allows simulating slow consumers.
+func NewPipeSize(capacity int) *Pipe {
 	return &Pipe{
-		pipe:  make(chan packet.GenericPacket),
-		close: make(chan struct{}),
+		capacity: capacity,
+		changed:  make(chan struct{}),
 	}
 }
 
 // Send returns packet on next Receive call.
 func (conn *Pipe) Send(pkt packet.GenericPacket) error {
-	select {
-	case conn.pipe <- pkt:
-		return nil
-	case <-conn.close:
-		return errors.New("already closed")
-	}
+	return conn.SendContext(context.Background(), pkt)
 }
 
 // Receive returns the packet being sent with Send.
 func (conn *Pipe) Receive() (packet.GenericPacket, error) {
-	select {
-	case pkt := <-conn.pipe:
-		return pkt, nil
-	case <-conn.close:
+	return conn.ReceiveContext(context.Background())
+}
+
+// SendContext returns packet on next Receive call or the context's error if it
+// is canceled before.
+func (conn *Pipe) SendContext(ctx context.Context, pkt packet.GenericPacket) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	// wait for space
+	for !conn.closed && !conn.space() {
+		err := conn.wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if conn.closed {
+		return ErrPipeClosed
+	}
+
+	conn.push(pkt)
+
+	// without capacity wait until the packet has been received
+	seq := conn.sent
+	for conn.capacity == 0 && conn.received < seq {
+		if conn.closed {
+			return ErrPipeClosed
+		}
+
+		err := conn.wait(ctx)
+		if err != nil && conn.received < seq {
+			conn.queue = conn.queue[:0]
+			conn.sent--
+			conn.notify()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrySend queues the packet if it can be done without blocking and returns
+// ErrPipeFull otherwise. Without capacity the packet is only accepted if a
+// receiver is waiting.
+func (conn *Pipe) TrySend(pkt packet.GenericPacket) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.closed {
+		return ErrPipeClosed
+	}
+
+	if !conn.space() || (conn.capacity == 0 && conn.waiting == 0) {
+		return ErrPipeFull
+	}
+
+	conn.push(pkt)
+
+	return nil
+}
+
+// ReceiveContext returns the packet being sent with Send or the context's
+// error if it is canceled before.
+func (conn *Pipe) ReceiveContext(ctx context.Context) (packet.GenericPacket, error) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	// wait for a packet
+	conn.waiting++
+	for !conn.closed && len(conn.queue) == 0 {
+		err := conn.wait(ctx)
+		if err != nil {
+			conn.waiting--
+			return nil, err
+		}
+	}
+	conn.waiting--
+
+	if conn.closed {
 		return nil, io.EOF
 	}
+
+	// pop packet
+	pkt := conn.queue[0]
+	conn.queue[0] = nil
+	conn.queue = conn.queue[1:]
+	conn.received++
+	conn.notify()
+
+	return pkt, nil
+}
+
+// Len returns the number of queued packets.
+func (conn *Pipe) Len() int {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return len(conn.queue)
+}
+
+// Cap returns the capacity of the pipe.
+func (conn *Pipe) Cap() int {
+	return conn.capacity
+}
+
+// Queued returns the packets that have been sent but not yet received.
+func (conn *Pipe) Queued() []packet.GenericPacket {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return append([]packet.GenericPacket(nil), conn.queue...)
 }
 
 // Close will close the conn and let Send and Receive return errors.
 func (conn *Pipe) Close() error {
-	close(conn.close)
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.closed {
+		return ErrPipeClosed
+	}
+
+	conn.closed = true
+	conn.notify()
+
 	return nil
 }
 
+// space reports whether another packet can be queued
+func (conn *Pipe) space() bool {
+	if conn.capacity == 0 {
+		return len(conn.queue) == 0
+	}
+
+	return len(conn.queue) < conn.capacity
+}
+
+// push queues the packet and wakes up receivers
+func (conn *Pipe) push(pkt packet.GenericPacket) {
+	conn.queue = append(conn.queue, pkt)
+	conn.sent++
+	conn.notify()
+}
+
+// notify wakes up all waiters, the mutex must be held
+func (conn *Pipe) notify() {
+	close(conn.changed)
+	conn.changed = make(chan struct{})
+}
+
+// wait releases the mutex until the state changes or the context is canceled
+func (conn *Pipe) wait(ctx context.Context) error {
+	changed := conn.changed
+
+	conn.mutex.Unlock()
+	defer conn.mutex.Lock()
+
+	select {
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// An EndKind describes how the peer is expected to close the connection.
+type EndKind int
+
+// All available end kinds.
+const (
+	// EndAny matches any error that mentions EOF.
+	EndAny EndKind = iota
+
+	// EndEOF matches an orderly close at a packet boundary. This is a TCP FIN,
+	// a WebSocket close frame or a TLS close_notify alert. Note: The TLS
+	// implementation also reports a FIN at a record boundary without a
+	// preceding close_notify as a regular EOF.
+	EndEOF
+
+	// EndUnexpectedEOF matches a close in the middle of a packet or a TLS
+	// record.
+	EndUnexpectedEOF
+
+	// EndReset matches a connection that has been reset by the peer (RST).
+	EndReset
+)
+
+// String returns the name of the end kind.
+func (k EndKind) String() string {
+	switch k {
+	case EndAny:
+		return "any EOF"
+	case EndEOF:
+		return "EOF"
+	case EndUnexpectedEOF:
+		return "unexpected EOF"
+	case EndReset:
+		return "connection reset"
+	}
+
+	return "unknown"
+}
+
+// match returns whether the error matches the end kind.
+func (k EndKind) match(err error) bool {
+	switch k {
+	case EndAny:
+		return strings.Contains(err.Error(), "EOF")
+	case EndEOF:
+		return errors.Is(err, io.EOF)
+	case EndUnexpectedEOF:
+		return errors.Is(err, io.ErrUnexpectedEOF)
+	case EndReset:
+		return errors.Is(err, syscall.ECONNRESET)
+	}
+
+	return false
+}
+
 // All available action types.
 const (
 	actionSend byte = iota
 	actionReceive
 	actionSkip
+	actionSkipWhile
 	actionWait
 	actionRun
 	actionDelay
 	actionClose
 	actionEnd
+	actionInterleave
+	actionReceiveAll
+	actionRetry
+	actionBackground
+	actionReceiveType
 )
 
 // An Action is a step in a flow.
 type action struct {
-	kind     byte
-	packet   packet.GenericPacket
-	fn       func()
-	ch       chan struct{}
-	duration time.Duration
+	kind       byte
+	packet     packet.GenericPacket
+	packetType packet.Type
+	count      int
+	fn         func(*Context)
+	ch         chan struct{}
+	duration   time.Duration
+	ends       []EndKind
+	matcher    func(*Context, error) bool
+	groups     []*Group
+	packets    []packet.GenericPacket
+	flow       *Flow
+	name       string
+	matchers   []Matcher
+	equal      []packet.EqualOption
 }
 
 // A Flow is a sequence of actions that can be tested against a connection.
 type Flow struct {
-	actions []*action
+	actions           []*action
+	context           *Context
+	rand              *rand.Rand
+	seed              int64
+	timeline          *Timeline
+	golden            string
+	clock             clock.Clock
+	continueOnFailure bool
+	equal             []packet.EqualOption
 }
 
 // New returns a new flow.
 func New() *Flow {
 	return &Flow{
 		actions: make([]*action, 0),
+		context: NewContext(),
+		clock:   clock.Real,
 	}
 }
 
+// WithClock will use the specified clock for delays, retry backoffs, timeouts
+// and the timeline. A clock.Mock lets flows that delay run instantly and
+// deterministically in unit tests.
+func (f *Flow) WithClock(c clock.Clock) *Flow {
+	f.clock = c
+
+	return f
+}
+
+// WithContext will attach the specified context to the flow. Flows that share
+// a context can exchange state while they are tested in parallel.
+func (f *Flow) WithContext(ctx *Context) *Flow {
+	f.context = ctx
+
+	return f
+}
+
+// Context returns the context attached to the flow.
+func (f *Flow) Context() *Context {
+	return f.context
+}
+
 // Send will send and one packet.
 func (f *Flow) Send(pkt packet.GenericPacket) *Flow {
 	f.add(&action{
@@ -101,11 +385,56 @@ func (f *Flow) Send(pkt packet.GenericPacket) *Flow {
 	return f
 }
 
-// Receive will receive and match one packet.
-func (f *Flow) Receive(pkt packet.GenericPacket) *Flow {
+// Receive will receive and match one packet. If matchers are specified, the
+// packet must be a publish packet whose payload is checked by the matchers
+// instead of being compared to the payload of the expected packet.
+func (f *Flow) Receive(pkt packet.GenericPacket, matchers ...Matcher) *Flow {
+	if _, ok := pkt.(*packet.PublishPacket); len(matchers) > 0 && !ok {
+		panic("flow: payload matchers require a publish packet")
+	}
+
 	f.add(&action{
-		kind:   actionReceive,
-		packet: pkt,
+		kind:     actionReceive,
+		packet:   pkt,
+		matchers: matchers,
+		equal:    f.equal,
+	})
+
+	return f
+}
+
+// ReceiveType will receive one packet and only check its type. It is useful
+// if the contents of the packet are determined by the broker, e.g. the packet
+// id of a PUBACK or the return codes of a SUBACK.
+func (f *Flow) ReceiveType(t packet.Type) *Flow {
+	f.add(&action{
+		kind:       actionReceiveType,
+		packetType: t,
+	})
+
+	return f
+}
+
+// Ignore will relax the comparison of the packets expected by the following
+// Receive and ReceiveAllOf actions with the specified options, e.g.
+// packet.IgnoreID for publishes that the broker assigned a new identifier or
+// packet.IgnoreDup for redeliveries. Calling Ignore without options restores
+// the exact comparison.
+func (f *Flow) Ignore(opts ...packet.EqualOption) *Flow {
+	f.equal = append([]packet.EqualOption(nil), opts...)
+
+	return f
+}
+
+// ReceiveAllOf will receive as many packets as specified and match them in
+// any order. Every received packet must match one of the packets that have
+// not yet been matched, which allows deliveries that are reordered by the
+// broker, e.g. across topics.
+func (f *Flow) ReceiveAllOf(pkts ...packet.GenericPacket) *Flow {
+	f.add(&action{
+		kind:    actionReceiveAll,
+		packets: pkts,
+		equal:   f.equal,
 	})
 
 	return f
@@ -113,8 +442,25 @@ func (f *Flow) Receive(pkt packet.GenericPacket) *Flow {
 
 // Skip will receive one packet without matching it.
 func (f *Flow) Skip() *Flow {
+	return f.SkipN(1)
+}
+
+// SkipN will receive the specified number of packets without matching them.
+func (f *Flow) SkipN(n int) *Flow {
 	f.add(&action{
-		kind: actionSkip,
+		kind:  actionSkip,
+		count: n,
+	})
+
+	return f
+}
+
+// SkipWhile will receive and ignore packets as long as they have the specified
+// type. The first packet with a different type is handed to the next action.
+func (f *Flow) SkipWhile(t packet.Type) *Flow {
+	f.add(&action{
+		kind:       actionSkipWhile,
+		packetType: t,
 	})
 
 	return f
@@ -132,6 +478,14 @@ func (f *Flow) Wait(ch chan struct{}) *Flow {
 
 // Run will call the supplied function and wait until it returns.
 func (f *Flow) Run(fn func()) *Flow {
+	return f.RunContext(func(*Context) {
+		fn()
+	})
+}
+
+// RunContext will call the supplied function with the flow context and wait
+// until it returns.
+func (f *Flow) RunContext(fn func(ctx *Context)) *Flow {
 	f.add(&action{
 		kind: actionRun,
 		fn:   fn,
@@ -150,6 +504,53 @@ func (f *Flow) Delay(d time.Duration) *Flow {
 	return f
 }
 
+// Retry will run the actions of the sub flow and retry them up to n times if
+// they fail. The delay before the first retry is the specified backoff and
+// doubles with every retry. Packets received by a failed attempt are not
+// handed to the next attempt.
+func (f *Flow) Retry(n int, backoff time.Duration, sub *Flow) *Flow {
+	f.add(&action{
+		kind:     actionRetry,
+		count:    n,
+		duration: backoff,
+		flow:     sub,
+	})
+
+	return f
+}
+
+// Named will name the last added action, e.g. "expect CONNACK". The name is
+// prepended to the error of a failed action and recorded in the timeline,
+// which makes failures of long flows easier to locate.
+func (f *Flow) Named(name string) *Flow {
+	if len(f.actions) == 0 {
+		panic("flow: no action to name")
+	}
+
+	f.actions[len(f.actions)-1].name = name
+
+	return f
+}
+
+// ContinueOnFailure will make the flow continue with the next action when an
+// action fails instead of stopping. Test returns a Failures error that lists
+// all failed actions, which prevents one failure from masking the results of
+// the remaining checks, e.g. in compliance runs. Actions that consume packets
+// still consume them when they fail. Testing stops if the context is canceled.
+func (f *Flow) ContinueOnFailure() *Flow {
+	f.continueOnFailure = true
+
+	return f
+}
+
+// Include will append the actions of the specified flow, which allows
+// composing flows from prebuilt building blocks.
+func (f *Flow) Include(sub *Flow) *Flow {
+	f.actions = append(f.actions, sub.actions...)
+
+	return f
+}
+
 // Close will immediately close the connection.
 func (f *Flow) Close() *Flow {
 	f.add(&action{
@@ -161,8 +562,34 @@ func (f *Flow) Close() *Flow {
 
 // End will match proper connection close.
 func (f *Flow) End() *Flow {
+	return f.EndWith(EndAny)
+}
+
+// EndWith will match a connection close of one of the specified kinds.
+func (f *Flow) EndWith(kinds ...EndKind) *Flow {
 	f.add(&action{
 		kind: actionEnd,
+		ends: kinds,
+	})
+
+	return f
+}
+
+// EndMatching will match a connection close using the specified function that
+// receives the error returned by the connection.
+func (f *Flow) EndMatching(fn func(error) bool) *Flow {
+	return f.EndMatchingContext(func(_ *Context, err error) bool {
+		return fn(err)
+	})
+}
+
+// EndMatchingContext will match a connection close using the specified
+// function that receives the flow context and the error returned by the
+// connection.
+func (f *Flow) EndMatchingContext(fn func(ctx *Context, err error) bool) *Flow {
+	f.add(&action{
+		kind:    actionEnd,
+		matcher: fn,
 	})
 
 	return f
@@ -170,67 +597,342 @@ func (f *Flow) End() *Flow {
 
 // Test starts the flow on the given Conn and reports to the specified test.
 func (f *Flow) Test(conn Conn) error {
-	for _, action := range f.actions {
+	return f.TestContext(context.Background(), conn)
+}
+
+// TestContext starts the flow on the given Conn and stops when the context is
+// canceled. Blocked sends and receives are only canceled if the connection
+// implements ContextConn.
+func (f *Flow) TestContext(ctx context.Context, conn Conn) error {
+	// a packet received by SkipWhile that has to be handled by the next action
+	var pending packet.GenericPacket
+
+	send := conn.Send
+	receive := conn.Receive
+	if contextConn, ok := conn.(ContextConn); ok {
+		send = func(pkt packet.GenericPacket) error {
+			return contextConn.SendContext(ctx, pkt)
+		}
+		receive = func() (packet.GenericPacket, error) {
+			return contextConn.ReceiveContext(ctx)
+		}
+	}
+
+	// record the exchange for the golden file
+	var record *transcript
+	if f.golden != "" {
+		record = &transcript{}
+		connSend, connReceive := send, receive
+		send = func(pkt packet.GenericPacket) error {
+			record.sent(pkt)
+			return connSend(pkt)
+		}
+		receive = func() (packet.GenericPacket, error) {
+			pkt, err := connReceive()
+			record.received(pkt, err)
+			return pkt, err
+		}
+	}
+
+	next := func() (packet.GenericPacket, error) {
+		if pending != nil {
+			pkt := pending
+			pending = nil
+			return pkt, nil
+		}
+
+		return receive()
+	}
+
+	// run background flows until the flow ends
+	bg := newBackground(ctx)
+	defer bg.stop()
+
+	// run the actions and the actions of interleaved groups
+	var run func(actions []*action) error
+
+	// step runs a single action
+	step := func(action *action) error {
+		// check if canceled
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
 		switch action.kind {
 		case actionSend:
-			err := conn.Send(action.packet)
+			err := send(action.packet)
 			if err != nil {
 				return fmt.Errorf("error sending packet: %v", err)
 			}
 		case actionReceive:
-			pkt, err := conn.Receive()
+			pkt, err := next()
 			if err != nil {
 				return fmt.Errorf("expected to receive a packet but got error: %v", err)
 			}
 
-			if want, got := action.packet.String(), pkt.String(); want != got {
-				return fmt.Errorf("expected packet of %q but got %q", want, got)
+			err = match(action.packet, pkt, action.matchers, action.equal)
+			if err != nil {
+				return err
 			}
-		case actionSkip:
-			_, err := conn.Receive()
+		case actionReceiveType:
+			pkt, err := next()
 			if err != nil {
-				return fmt.Errorf("expected to skip over a received packet but got error: %v", err)
+				return fmt.Errorf("expected to receive a %s packet but got error: %v", action.packetType, err)
+			}
+
+			if pkt.Type() != action.packetType {
+				return fmt.Errorf("expected %s packet but got %q", action.packetType, pkt.String())
+			}
+		case actionReceiveAll:
+			// the expected packets that have not yet been received
+			missing := append([]packet.GenericPacket(nil), action.packets...)
+
+			for len(missing) > 0 {
+				pkt, err := next()
+				if err != nil {
+					return fmt.Errorf("expected to receive %d more packets but got error: %v", len(missing), err)
+				}
+
+				index := -1
+				for i, want := range missing {
+					if packet.Equal(want, pkt, action.equal...) {
+						index = i
+						break
+					}
+				}
+
+				if index < 0 {
+					return fmt.Errorf("expected one of %q but got %q", packetStrings(missing), pkt.String())
+				}
+
+				missing = append(missing[:index], missing[index+1:]...)
+			}
+		case actionSkip:
+			for i := 0; i < action.count; i++ {
+				_, err := next()
+				if err != nil {
+					return fmt.Errorf("expected to skip over a received packet but got error: %v", err)
+				}
+			}
+		case actionSkipWhile:
+			for {
+				pkt, err := next()
+				if err != nil {
+					return fmt.Errorf("expected to skip over %s packets but got error: %v", action.packetType, err)
+				}
+
+				if pkt.Type() != action.packetType {
+					pending = pkt
+					break
+				}
 			}
 		case actionWait:
-			<-action.ch
+			select {
+			case <-action.ch:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		case actionRun:
-			action.fn()
+			action.fn(f.context)
 		case actionDelay:
-			time.Sleep(action.duration)
+			timer := f.clock.NewTimer(action.duration)
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
 		case actionClose:
 			err := conn.Close()
 			if err != nil {
 				return fmt.Errorf("expected connection to close successfully but got error: %v", err)
 			}
 		case actionEnd:
-			pkt, err := conn.Receive()
-			if err != nil && !strings.Contains(err.Error(), "EOF") {
-				return fmt.Errorf("expected EOF but got %v", err)
-			}
+			pkt, err := next()
 			if pkt != nil {
 				return fmt.Errorf("expected no packet but got %v", pkt)
 			}
+			if err != nil && !action.matchEnd(f.context, err) {
+				return fmt.Errorf("expected %s but got %v", action.describeEnd(), err)
+			}
+		case actionRetry:
+			delay := action.duration
+			for attempt := 1; ; attempt++ {
+				err := run(action.flow.actions)
+				if err == nil {
+					break
+				} else if ctx.Err() != nil {
+					return ctx.Err()
+				} else if attempt > action.count {
+					return fmt.Errorf("%v (after %d attempts)", err, attempt)
+				}
+
+				// wait before the next attempt
+				timer := f.clock.NewTimer(delay)
+				select {
+				case <-timer.C():
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+
+				delay *= 2
+			}
+		case actionBackground:
+			bg.start(f, action, conn)
+		case actionInterleave:
+			order, err := f.order(action.groups)
+			if err != nil {
+				return err
+			}
+
+			for _, group := range order {
+				err = run(group.flow.actions)
+				if err != nil && f.rand != nil {
+					return fmt.Errorf("%v (interleaving %q of seed %d)", err, names(order), f.seed)
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	// runAction runs and records a single action
+	runAction := func(action *action) error {
+		start := f.clock.Now()
+		err := step(action)
+
+		// record step
+		if f.timeline != nil {
+			f.timeline.add(action, start, clock.Since(f.clock, start), err)
+		}
+
+		if err != nil && action.name != "" {
+			return fmt.Errorf("%s: %w", action.name, err)
+		}
+
+		return err
+	}
+
+	run = func(actions []*action) error {
+		for _, action := range actions {
+			err := runAction(action)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// stop at the first failure
+	if !f.continueOnFailure {
+		err := run(f.actions)
+		if err == nil {
+			err = bg.stop()
+		}
+		if err != nil || record == nil {
+			return err
+		}
+
+		return record.check(f.golden)
+	}
+
+	// collect all failures
+	failures := Failures{Steps: len(f.actions)}
+	for i, action := range f.actions {
+		err := runAction(action)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			failures.Errors = append(failures.Errors, &StepError{Step: i + 1, Err: err})
+		}
+	}
+
+	err := bg.stop()
+	if err != nil {
+		failures.Errors = append(failures.Errors, err)
+	}
+
+	if record != nil {
+		err := record.check(f.golden)
+		if err != nil {
+			failures.Errors = append(failures.Errors, err)
 		}
 	}
 
+	if len(failures.Errors) > 0 {
+		return &failures
+	}
+
 	return nil
 }
 
 // TestAsync starts the flow on the given Conn and reports to the specified test
-// asynchronously.
+// asynchronously. The flow is canceled when the timeout is reached.
 func (f *Flow) TestAsync(conn Conn, timeout time.Duration) <-chan error {
-	errCh := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// cancel the flow when the timeout is reached
+	var timedOut int32
+	timer := f.clock.NewTimer(timeout)
 	go func() {
 		select {
-		case <-time.After(timeout):
-			errCh <- errors.New("timed out waiting for flow to complete")
-		case errCh <- f.Test(conn):
+		case <-timer.C():
+			atomic.StoreInt32(&timedOut, 1)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer cancel()
+		defer timer.Stop()
+
+		err := f.TestContext(ctx, conn)
+		if err != nil && atomic.LoadInt32(&timedOut) == 1 {
+			err = errors.New("timed out waiting for flow to complete")
 		}
+
+		errCh <- err
 	}()
 
 	return errCh
 }
 
+// matchEnd returns whether the error matches the expected close.
+func (a *action) matchEnd(ctx *Context, err error) bool {
+	if a.matcher != nil {
+		return a.matcher(ctx, err)
+	}
+
+	for _, kind := range a.ends {
+		if kind.match(err) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// describeEnd returns a description of the expected close.
+func (a *action) describeEnd() string {
+	if a.matcher != nil {
+		return "matching close"
+	}
+
+	names := make([]string, 0, len(a.ends))
+	for _, kind := range a.ends {
+		names = append(names, kind.String())
+	}
+
+	return strings.Join(names, " or ")
+}
+
 // add will add the specified action.
 func (f *Flow) add(action *action) {
 	f.actions = append(f.actions, action)
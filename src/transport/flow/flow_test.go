@@ -1,9 +1,17 @@
 package flow
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"clock"
 	"github.com/stretchr/testify/assert"
 	"packet"
 )
@@ -61,3 +69,609 @@ func TestAlreadyClosedError(t *testing.T) {
 	err := pipe.Send(nil)
 	assert.Error(t, err)
 }
+
+func TestPipeSize(t *testing.T) {
+	pipe := NewPipeSize(2)
+	assert.Equal(t, 2, pipe.Cap())
+
+	connect := packet.NewConnectPacket()
+	publish := packet.NewPublishPacket()
+
+	assert.NoError(t, pipe.TrySend(connect))
+	assert.NoError(t, pipe.Send(publish))
+	assert.Equal(t, ErrPipeFull, pipe.TrySend(publish))
+	assert.Equal(t, 2, pipe.Len())
+	assert.Equal(t, []packet.GenericPacket{connect, publish}, pipe.Queued())
+
+	// a blocked send continues once the consumer catches up
+	sent := make(chan error, 1)
+	go func() {
+		sent <- pipe.Send(publish)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("send should block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	pkt, err := pipe.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, connect, pkt)
+	assert.NoError(t, <-sent)
+	assert.Equal(t, 2, pipe.Len())
+
+	pipe.Close()
+	assert.Equal(t, ErrPipeClosed, pipe.TrySend(publish))
+
+	_, err = pipe.Receive()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestPipeTrySend(t *testing.T) {
+	pipe := NewPipe()
+	assert.Equal(t, ErrPipeFull, pipe.TrySend(packet.NewConnectPacket()))
+
+	received := make(chan packet.GenericPacket, 1)
+	go func() {
+		pkt, _ := pipe.Receive()
+		received <- pkt
+	}()
+
+	// wait for the receiver
+	var err error
+	for i := 0; i < 100; i++ {
+		err = pipe.TrySend(packet.NewConnectPacket())
+		if err != ErrPipeFull {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNECT, (<-received).Type())
+	assert.Equal(t, 0, pipe.Len())
+}
+
+func TestPipeSendContextCanceled(t *testing.T) {
+	pipe := NewPipe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := pipe.SendContext(ctx, packet.NewConnectPacket())
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, pipe.Len())
+}
+
+func TestFlowSkipN(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+
+	puback := packet.NewPubackPacket()
+	puback.ID = 1
+
+	server := New().
+		Send(publish).
+		Send(publish).
+		Send(puback).
+		Close()
+
+	client := New().
+		SkipN(2).
+		Receive(puback).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowSkipWhile(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+
+	suback := packet.NewSubackPacket()
+	suback.ID = 1
+	suback.ReturnCodes = []byte{0}
+
+	server := New().
+		Send(publish).
+		Send(publish).
+		Send(publish).
+		Send(suback).
+		Close()
+
+	client := New().
+		SkipWhile(packet.PUBLISH).
+		Receive(suback).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowSkipWhileError(t *testing.T) {
+	pipe := NewPipe()
+	pipe.Close()
+
+	err := New().SkipWhile(packet.PUBLISH).Test(pipe)
+	assert.Error(t, err)
+}
+
+func TestFlowReceiveType(t *testing.T) {
+	puback := packet.NewPubackPacket()
+	puback.ID = 42
+
+	server := New().
+		Send(puback).
+		Send(packet.NewPingrespPacket()).
+		Close()
+
+	client := New().
+		ReceiveType(packet.PUBACK).
+		ReceiveType(packet.PUBACK).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.EqualError(t, err, `expected Puback packet but got "<PingrespPacket>"`)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowReceiveAllOf(t *testing.T) {
+	publish1 := packet.NewPublishPacket()
+	publish1.Message.Topic = "foo"
+
+	publish2 := packet.NewPublishPacket()
+	publish2.Message.Topic = "bar"
+
+	suback := packet.NewSubackPacket()
+	suback.ID = 1
+	suback.ReturnCodes = []byte{0}
+
+	server := New().
+		Send(publish2).
+		Send(suback).
+		Send(publish1).
+		Close()
+
+	client := New().
+		ReceiveAllOf(publish1, publish2, suback).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowReceiveAllOfMismatch(t *testing.T) {
+	publish1 := packet.NewPublishPacket()
+	publish1.Message.Topic = "foo"
+
+	publish2 := packet.NewPublishPacket()
+	publish2.Message.Topic = "bar"
+
+	server := New().
+		Send(publish1).
+		Send(publish1).
+		Close()
+
+	client := New().
+		ReceiveAllOf(publish1, publish2)
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected one of")
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowIgnore(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.ID = 1
+	publish.Message = packet.Message{Topic: "foo", Payload: []byte("bar"), QOS: 1}
+
+	redelivered := packet.NewPublishPacket()
+	redelivered.ID = 7
+	redelivered.Dup = true
+	redelivered.Message = publish.Message
+
+	server := New().
+		Send(redelivered).
+		Send(redelivered).
+		Send(redelivered).
+		Close()
+
+	client := New().
+		Ignore(packet.IgnoreID, packet.IgnoreDup).
+		Receive(publish).
+		ReceiveAllOf(publish).
+		Receive(publish, PayloadEquals([]byte("bar"))).
+		Ignore().
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+
+	// the options only apply to the following actions
+	client = New().
+		Receive(publish).
+		Ignore(packet.IgnoreID, packet.IgnoreDup)
+
+	pipe = NewPipe()
+
+	errCh = server.TestAsync(pipe, 100*time.Millisecond)
+
+	err = client.Test(pipe)
+	assert.Error(t, err)
+
+	<-errCh
+}
+
+func TestFlowInclude(t *testing.T) {
+	connect := packet.NewConnectPacket()
+	connack := packet.NewConnackPacket()
+
+	server := New().
+		Include(New().Receive(connect).Send(connack)).
+		Close()
+
+	client := New().
+		Include(New().Send(connect)).
+		Include(New().Receive(connack)).
+		End()
+
+	assert.Len(t, client.actions, 3)
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowNamed(t *testing.T) {
+	connect := packet.NewConnectPacket()
+	connack := packet.NewConnackPacket()
+	connack.ReturnCode = packet.ErrNotAuthorized
+
+	server := New().
+		Receive(connect).
+		Send(connack).
+		Close()
+
+	client := New().
+		Send(connect).Named("connect").
+		Receive(packet.NewConnackPacket()).Named("expect CONNACK").
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "expect CONNACK: expected packet of"), err.Error())
+
+	<-errCh
+
+	assert.Panics(t, func() {
+		New().Named("foo")
+	})
+}
+
+func TestFlowRetry(t *testing.T) {
+	retained := packet.NewPublishPacket()
+	retained.Message.Topic = "test"
+	retained.Message.Retain = true
+
+	other := packet.NewPublishPacket()
+	other.Message.Topic = "other"
+
+	attempts := 0
+
+	server := New().
+		Send(other).
+		Send(other).
+		Send(retained).
+		Close()
+
+	client := New().
+		Retry(3, time.Millisecond, New().
+			Run(func() {
+				attempts++
+			}).
+			Receive(retained)).
+		End()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowRetryExhausted(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+
+	other := packet.NewPublishPacket()
+	other.Message.Topic = "other"
+
+	server := New().
+		Send(other).
+		Send(other).
+		Close()
+
+	client := New().
+		Retry(1, time.Millisecond, New().Receive(publish))
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "(after 2 attempts)")
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+type errConn struct {
+	err error
+}
+
+func (c *errConn) Send(pkt packet.GenericPacket) error {
+	return c.err
+}
+
+func (c *errConn) Receive() (packet.GenericPacket, error) {
+	return nil, c.err
+}
+
+func (c *errConn) Close() error {
+	return nil
+}
+
+func TestFlowEndWith(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	matrix := []struct {
+		err   error
+		kinds []EndKind
+		ok    bool
+	}{
+		{io.EOF, []EndKind{EndAny}, true},
+		{io.EOF, []EndKind{EndEOF}, true},
+		{io.EOF, []EndKind{EndReset}, false},
+		{io.ErrUnexpectedEOF, []EndKind{EndAny}, true},
+		{io.ErrUnexpectedEOF, []EndKind{EndEOF}, false},
+		{io.ErrUnexpectedEOF, []EndKind{EndUnexpectedEOF}, true},
+		{reset, []EndKind{EndAny}, false},
+		{reset, []EndKind{EndEOF}, false},
+		{reset, []EndKind{EndReset}, true},
+		{reset, []EndKind{EndEOF, EndReset}, true},
+	}
+
+	for _, item := range matrix {
+		err := New().EndWith(item.kinds...).Test(&errConn{err: item.err})
+		if item.ok {
+			assert.NoError(t, err, item.err.Error())
+		} else {
+			assert.Error(t, err, item.err.Error())
+		}
+	}
+
+	err := New().EndWith(EndEOF, EndReset).Test(&errConn{err: io.ErrUnexpectedEOF})
+	assert.EqualError(t, err, "expected EOF or connection reset but got unexpected EOF")
+}
+
+func TestFlowEndMatching(t *testing.T) {
+	err := New().EndMatching(func(err error) bool {
+		return err == io.ErrUnexpectedEOF
+	}).Test(&errConn{err: io.ErrUnexpectedEOF})
+	assert.NoError(t, err)
+
+	err = New().EndMatching(func(err error) bool {
+		return false
+	}).Test(&errConn{err: io.EOF})
+	assert.EqualError(t, err, "expected matching close but got EOF")
+}
+
+func TestFlowContext(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+
+	ctx := NewContext()
+
+	server := New().WithContext(ctx).
+		RunContext(func(ctx *Context) {
+			ctx.Set("topic", "test")
+		}).
+		Send(publish).
+		Close()
+
+	client := New().WithContext(ctx).
+		Receive(publish).
+		EndMatchingContext(func(ctx *Context, err error) bool {
+			topic, _ := ctx.Get("topic")
+			return topic == "test" && err == io.EOF
+		})
+
+	assert.Equal(t, ctx, server.Context())
+	assert.Equal(t, ctx, client.Context())
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowTestAsyncTimeout(t *testing.T) {
+	pipe := NewPipe()
+
+	errCh := New().
+		Receive(packet.NewConnectPacket()).
+		TestAsync(pipe, 10*time.Millisecond)
+
+	err := <-errCh
+	assert.EqualError(t, err, "timed out waiting for flow to complete")
+
+	// the flow must not receive anymore
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = pipe.SendContext(ctx, packet.NewConnectPacket())
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestFlowTestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := New().
+		Send(packet.NewConnectPacket()).
+		TestContext(ctx, NewPipe())
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestFlowEndReset(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		assert.NoError(t, err)
+
+		// wait for client
+		_, err = conn.Read(make([]byte, 1))
+		assert.NoError(t, err)
+
+		// close with RST
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte{0})
+	assert.NoError(t, err)
+
+	err = New().EndWith(EndReset).Test(&netConn{conn: conn, decoder: packet.NewDecoder(conn)})
+	assert.NoError(t, err)
+}
+
+type netConn struct {
+	conn    net.Conn
+	decoder *packet.Decoder
+}
+
+func (c *netConn) Send(pkt packet.GenericPacket) error {
+	return errors.New("not supported")
+}
+
+func (c *netConn) Receive() (packet.GenericPacket, error) {
+	return c.decoder.Read()
+}
+
+func (c *netConn) Close() error {
+	return c.conn.Close()
+}
+
+func TestFlowWithClock(t *testing.T) {
+	mock := clock.NewMock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	timeline := NewTimeline()
+
+	server := New().
+		WithClock(mock).
+		WithTimeline(timeline).
+		Delay(time.Hour).
+		Send(packet.NewPingreqPacket())
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 2*time.Hour)
+
+	// wait for the delay and the timeout
+	mock.BlockUntil(2)
+	mock.Advance(time.Hour)
+
+	pkt, err := pipe.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.PINGREQ, pkt.Type())
+	assert.NoError(t, <-errCh)
+
+	steps := timeline.Steps()
+	assert.Equal(t, 3600.0, steps[0].Duration)
+	assert.Equal(t, mock.Now().Add(-time.Hour), steps[0].Start)
+}
+
+func TestFlowWithClockTimeout(t *testing.T) {
+	mock := clock.NewMock(time.Time{})
+
+	errCh := New().
+		WithClock(mock).
+		Receive(packet.NewPingreqPacket()).
+		TestAsync(NewPipe(), time.Minute)
+
+	mock.BlockUntil(1)
+	mock.Advance(time.Minute)
+
+	assert.EqualError(t, <-errCh, "timed out waiting for flow to complete")
+}
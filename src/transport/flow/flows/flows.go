@@ -0,0 +1,175 @@
+// Package flows provides a catalog of canonical MQTT packet flows that can be
+// composed into larger tests using Flow.Include.
+//
+// Every building block is available from the perspective of the client,
+// which is tested against a broker, and of the broker, which is used to fake
+// a broker when testing clients.
+package flows
+
+import (
+	"packet"
+	"transport/flow"
+)
+
+// ConnectPacket returns the CONNECT packet of a clean session.
+func ConnectPacket(clientID string) *packet.ConnectPacket {
+	connect := packet.NewConnectPacket()
+	connect.ClientID = clientID
+	connect.CleanSession = true
+
+	return connect
+}
+
+// ConnackPacket returns the CONNACK packet that accepts a clean session.
+func ConnackPacket() *packet.ConnackPacket {
+	connack := packet.NewConnackPacket()
+	connack.ReturnCode = packet.ConnectionAccepted
+	connack.SessionPresent = false
+
+	return connack
+}
+
+// PublishPacket returns a PUBLISH packet of the message using the specified
+// packet id.
+func PublishPacket(id packet.ID, msg packet.Message) *packet.PublishPacket {
+	publish := packet.NewPublishPacket()
+	publish.ID = id
+	publish.Message = msg
+
+	return publish
+}
+
+// CleanConnect sends a CONNECT packet with a clean session and expects the
+// connection to be accepted without a present session.
+func CleanConnect(clientID string) *flow.Flow {
+	return flow.New().
+		Send(ConnectPacket(clientID)).
+		Receive(ConnackPacket())
+}
+
+// AcceptCleanConnect is the broker side of CleanConnect.
+func AcceptCleanConnect(clientID string) *flow.Flow {
+	return flow.New().
+		Receive(ConnectPacket(clientID)).
+		Send(ConnackPacket())
+}
+
+// PublishQOS1 publishes the message with QOS 1 and expects it to be
+// acknowledged.
+func PublishQOS1(id packet.ID, msg packet.Message) *flow.Flow {
+	msg.QOS = 1
+
+	puback := packet.NewPubackPacket()
+	puback.ID = id
+
+	return flow.New().
+		Send(PublishPacket(id, msg)).
+		Receive(puback)
+}
+
+// AcceptPublishQOS1 is the broker side of PublishQOS1.
+func AcceptPublishQOS1(id packet.ID, msg packet.Message) *flow.Flow {
+	msg.QOS = 1
+
+	puback := packet.NewPubackPacket()
+	puback.ID = id
+
+	return flow.New().
+		Receive(PublishPacket(id, msg)).
+		Send(puback)
+}
+
+// PublishQOS2 publishes the message with QOS 2 and completes the exactly once
+// delivery handshake.
+func PublishQOS2(id packet.ID, msg packet.Message) *flow.Flow {
+	msg.QOS = 2
+	pubrec, pubrel, pubcomp := qos2Packets(id)
+
+	return flow.New().
+		Send(PublishPacket(id, msg)).
+		Receive(pubrec).
+		Send(pubrel).
+		Receive(pubcomp)
+}
+
+// AcceptPublishQOS2 is the broker side of PublishQOS2.
+func AcceptPublishQOS2(id packet.ID, msg packet.Message) *flow.Flow {
+	msg.QOS = 2
+	pubrec, pubrel, pubcomp := qos2Packets(id)
+
+	return flow.New().
+		Receive(PublishPacket(id, msg)).
+		Send(pubrec).
+		Receive(pubrel).
+		Send(pubcomp)
+}
+
+// KeepAlive sends a PINGREQ packet and expects a PINGRESP packet.
+func KeepAlive() *flow.Flow {
+	return flow.New().
+		Send(packet.NewPingreqPacket()).
+		Receive(packet.NewPingrespPacket())
+}
+
+// AcceptKeepAlive is the broker side of KeepAlive.
+func AcceptKeepAlive() *flow.Flow {
+	return flow.New().
+		Receive(packet.NewPingreqPacket()).
+		Send(packet.NewPingrespPacket())
+}
+
+// Disconnect sends a DISCONNECT packet and expects the broker to close the
+// connection.
+func Disconnect() *flow.Flow {
+	return flow.New().
+		Send(packet.NewDisconnectPacket()).
+		End()
+}
+
+// AcceptDisconnect is the broker side of Disconnect.
+func AcceptDisconnect() *flow.Flow {
+	return flow.New().
+		Receive(packet.NewDisconnectPacket()).
+		Close()
+}
+
+// DuplicateConnect connects and sends a second CONNECT packet, which is a
+// protocol violation the broker must answer by closing the connection
+// [MQTT-3.1.0-2].
+func DuplicateConnect(clientID string) *flow.Flow {
+	return CleanConnect(clientID).
+		Send(ConnectPacket(clientID)).
+		End()
+}
+
+// PublishBeforeConnect sends a PUBLISH packet as the first packet, which the
+// broker must answer by closing the connection [MQTT-3.1.0-1].
+func PublishBeforeConnect(msg packet.Message) *flow.Flow {
+	msg.QOS = 0
+
+	return flow.New().
+		Send(PublishPacket(0, msg)).
+		End()
+}
+
+// ReservedType connects and sends a packet of the reserved type 0 or 15,
+// which the broker must treat as malformed and close the connection
+// [MQTT-4.8.0-1].
+func ReservedType(clientID string, t packet.Type) *flow.Flow {
+	return CleanConnect(clientID).
+		Send(packet.NewReservedPacket(t)).
+		End()
+}
+
+func qos2Packets(id packet.ID) (*packet.PubrecPacket, *packet.PubrelPacket, *packet.PubcompPacket) {
+	pubrec := packet.NewPubrecPacket()
+	pubrec.ID = id
+
+	pubrel := packet.NewPubrelPacket()
+	pubrel.ID = id
+
+	pubcomp := packet.NewPubcompPacket()
+	pubcomp.ID = id
+
+	return pubrec, pubrel, pubcomp
+}
@@ -0,0 +1,117 @@
+package flows
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+	"transport/flow"
+)
+
+func TestFlows(t *testing.T) {
+	msg := packet.Message{
+		Topic:   "test",
+		Payload: []byte("test"),
+	}
+
+	broker := flow.New().
+		Include(AcceptCleanConnect("test")).
+		Include(AcceptPublishQOS1(1, msg)).
+		Include(AcceptPublishQOS2(2, msg)).
+		Include(AcceptKeepAlive()).
+		Include(AcceptDisconnect())
+
+	client := flow.New().
+		Include(CleanConnect("test")).
+		Include(PublishQOS1(1, msg)).
+		Include(PublishQOS2(2, msg)).
+		Include(KeepAlive()).
+		Include(Disconnect())
+
+	pipe := flow.NewPipe()
+
+	errCh := broker.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowsMismatch(t *testing.T) {
+	msg := packet.Message{
+		Topic: "test",
+	}
+
+	broker := flow.New().
+		Include(AcceptCleanConnect("test")).
+		Include(AcceptPublishQOS2(1, msg))
+
+	client := flow.New().
+		Include(CleanConnect("test")).
+		Include(PublishQOS1(1, msg))
+
+	pipe := flow.NewPipe()
+
+	errCh := client.TestAsync(pipe, 100*time.Millisecond)
+
+	err := broker.Test(pipe)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Publish")
+
+	pipe.Close()
+	<-errCh
+}
+
+func TestFlowsViolations(t *testing.T) {
+	msg := packet.Message{
+		Topic: "test",
+	}
+
+	matrix := map[string][2]*flow.Flow{
+		"duplicate connect": {
+			DuplicateConnect("test"),
+			AcceptCleanConnect("test").Receive(ConnectPacket("test")).Close(),
+		},
+		"publish before connect": {
+			PublishBeforeConnect(msg),
+			flow.New().Receive(PublishPacket(0, msg)).Close(),
+		},
+		"reserved type": {
+			ReservedType("test", 15),
+			AcceptCleanConnect("test").Receive(packet.NewReservedPacket(15)).Close(),
+		},
+	}
+
+	for name, flows := range matrix {
+		pipe := flow.NewPipe()
+
+		errCh := flows[1].TestAsync(pipe, 100*time.Millisecond)
+
+		err := flows[0].Test(pipe)
+		assert.NoError(t, err, name)
+
+		err = <-errCh
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestFlowsViolationIgnored(t *testing.T) {
+	broker := AcceptCleanConnect("test").
+		Skip().
+		Send(packet.NewPingrespPacket())
+
+	client := DuplicateConnect("test")
+
+	pipe := flow.NewPipe()
+
+	errCh := broker.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.Error(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
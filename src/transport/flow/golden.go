@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"packet"
+)
+
+// UpdateGolden can be set to rewrite existing golden files with the live
+// exchange instead of comparing against them, e.g. from a flag of the test.
+var UpdateGolden = false
+
+// Golden will record the packets exchanged while the flow is tested and
+// compare them against the specified golden file. If the file does not yet
+// exist, the exchange is written to it instead. This turns an exploratory
+// flow, e.g. one that skips over the packets of a broker, into a regression
+// test that fails as soon as the broker answers differently.
+func (f *Flow) Golden(path string) *Flow {
+	f.golden = path
+
+	return f
+}
+
+// A transcript records the packets of an exchange
+type transcript struct {
+	lines []string
+}
+
+func (t *transcript) sent(pkt packet.GenericPacket) {
+	t.lines = append(t.lines, "> "+pkt.String())
+}
+
+func (t *transcript) received(pkt packet.GenericPacket, err error) {
+	if err != nil {
+		t.lines = append(t.lines, "< end")
+		return
+	}
+
+	t.lines = append(t.lines, "< "+pkt.String())
+}
+
+// check compares the transcript against the golden file or writes it
+func (t *transcript) check(path string) error {
+	live := strings.Join(t.lines, "\n") + "\n"
+
+	// write missing or outdated file
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) || UpdateGolden {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(path, []byte(live), 0644)
+	} else if err != nil {
+		return err
+	}
+
+	// compare lines
+	golden := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := 0; i < len(golden) || i < len(t.lines); i++ {
+		var want, got string
+		if i < len(golden) {
+			want = golden[i]
+		}
+		if i < len(t.lines) {
+			got = t.lines[i]
+		}
+
+		if want != got {
+			return fmt.Errorf("exchange differs from golden file %s at line %d: expected %q but got %q", path, i+1, want, got)
+		}
+	}
+
+	return nil
+}
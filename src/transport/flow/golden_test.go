@@ -0,0 +1,72 @@
+package flow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+)
+
+func goldenExchange(t *testing.T, path string, reply packet.GenericPacket) error {
+	server := New().
+		Receive(packet.NewConnectPacket()).
+		Send(reply).
+		Close()
+
+	client := New().
+		Send(packet.NewConnectPacket()).
+		Skip().
+		End().
+		Golden(path)
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+
+	assert.NoError(t, <-errCh)
+
+	return err
+}
+
+func TestFlowGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "testdata", "connect.golden")
+
+	// first run writes the file
+	err = goldenExchange(t, path, packet.NewConnackPacket())
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "> "+packet.NewConnectPacket().String()+"\n"+
+		"< "+packet.NewConnackPacket().String()+"\n"+
+		"< end\n", string(data))
+
+	// same exchange passes
+	err = goldenExchange(t, path, packet.NewConnackPacket())
+	assert.NoError(t, err)
+
+	// different exchange fails
+	err = goldenExchange(t, path, packet.NewPingrespPacket())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "at line 2")
+
+	// update rewrites the file
+	UpdateGolden = true
+	err = goldenExchange(t, path, packet.NewPingrespPacket())
+	UpdateGolden = false
+	assert.NoError(t, err)
+
+	err = goldenExchange(t, path, packet.NewPingrespPacket())
+	assert.NoError(t, err)
+}
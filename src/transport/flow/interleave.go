@@ -0,0 +1,123 @@
+package flow
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+)
+
+// ErrInvalidOrdering is returned if the ordering constraints of interleaved
+// groups reference unknown groups or contain a cycle.
+var ErrInvalidOrdering = errors.New("invalid ordering constraints")
+
+// A Group is a named sequence of actions that may be reordered with other
+// groups of the same Interleave action.
+type Group struct {
+	name  string
+	flow  *Flow
+	after []string
+}
+
+// NewGroup returns a new group that runs the actions of the specified flow.
+func NewGroup(name string, flow *Flow) *Group {
+	return &Group{
+		name: name,
+		flow: flow,
+	}
+}
+
+// After declares that the group must run after the named groups.
+func (g *Group) After(names ...string) *Group {
+	g.after = append(g.after, names...)
+
+	return g
+}
+
+// Interleave will run the specified groups in an order that satisfies their
+// ordering constraints. The groups run in declaration order unless the flow is
+// randomized.
+func (f *Flow) Interleave(groups ...*Group) *Flow {
+	f.add(&action{
+		kind:   actionInterleave,
+		groups: groups,
+	})
+
+	return f
+}
+
+// Randomize will shuffle the groups of every Interleave action using the
+// specified seed. Repeated tests of the flow draw new orders from the same
+// source, so that a sequence of runs is reproducible. A randomized flow must
+// not be tested concurrently.
+func (f *Flow) Randomize(seed int64) *Flow {
+	f.rand = rand.New(rand.NewSource(seed))
+	f.seed = seed
+
+	return f
+}
+
+// order returns the groups in an order that satisfies their constraints
+func (f *Flow) order(groups []*Group) ([]*Group, error) {
+	// index groups
+	index := make(map[string]int, len(groups))
+	for i, group := range groups {
+		index[group.name] = i
+	}
+
+	// count dependencies
+	pending := make([]int, len(groups))
+	dependents := make([][]int, len(groups))
+	for i, group := range groups {
+		for _, name := range group.after {
+			j, ok := index[name]
+			if !ok || j == i {
+				return nil, ErrInvalidOrdering
+			}
+
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	done := make([]bool, len(groups))
+	order := make([]*Group, 0, len(groups))
+
+	for len(order) < len(groups) {
+		// collect ready groups
+		var ready []int
+		for i := range groups {
+			if !done[i] && pending[i] == 0 {
+				ready = append(ready, i)
+			}
+		}
+
+		if len(ready) == 0 {
+			return nil, ErrInvalidOrdering
+		}
+
+		// pick first or random group
+		next := ready[0]
+		if f.rand != nil {
+			next = ready[f.rand.Intn(len(ready))]
+		}
+
+		done[next] = true
+		order = append(order, groups[next])
+
+		for _, i := range dependents[next] {
+			pending[i]--
+		}
+	}
+
+	return order, nil
+}
+
+// names returns the names of the groups
+func names(groups []*Group) string {
+	list := make([]string, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, group.name)
+	}
+
+	return strings.Join(list, " ")
+}
@@ -0,0 +1,75 @@
+package flow
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+func TestFlowInterleave(t *testing.T) {
+	var order []string
+	record := func(name string) *Group {
+		return NewGroup(name, New().Run(func() {
+			order = append(order, name)
+		}))
+	}
+
+	flow := New().Interleave(
+		record("a"),
+		record("b").After("a"),
+		record("c"),
+	)
+
+	err := flow.Test(NewPipe())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, order)
+
+	flow.Randomize(1)
+
+	orders := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		order = nil
+
+		err = flow.Test(NewPipe())
+		assert.NoError(t, err)
+		assert.Len(t, order, 3)
+
+		str := strings.Join(order, "")
+		assert.True(t, strings.Index(str, "a") < strings.Index(str, "b"), str)
+		orders[str] = true
+	}
+
+	assert.Len(t, orders, 3)
+}
+
+func TestFlowInterleaveInvalidOrdering(t *testing.T) {
+	flow := New().Interleave(
+		NewGroup("a", New()).After("b"),
+		NewGroup("b", New()).After("a"),
+	)
+
+	err := flow.Test(NewPipe())
+	assert.Equal(t, ErrInvalidOrdering, err)
+
+	flow = New().Interleave(
+		NewGroup("a", New()).After("c"),
+	)
+
+	err = flow.Test(NewPipe())
+	assert.Equal(t, ErrInvalidOrdering, err)
+}
+
+func TestFlowInterleaveError(t *testing.T) {
+	pipe := NewPipe()
+	pipe.Close()
+
+	flow := New().Interleave(
+		NewGroup("a", New().Receive(packet.NewPingreqPacket())),
+	).Randomize(7)
+
+	err := flow.Test(pipe)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `interleaving "a" of seed 7`)
+}
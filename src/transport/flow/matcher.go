@@ -0,0 +1,165 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"packet"
+)
+
+// A Matcher checks the payload of a received publish packet. It returns an
+// error describing the mismatch.
+type Matcher func(payload []byte) error
+
+// PayloadEquals matches payloads that are equal to the specified bytes.
+func PayloadEquals(payload []byte) Matcher {
+	return func(got []byte) error {
+		if !bytes.Equal(got, payload) {
+			return fmt.Errorf("expected payload %q but got %q", payload, got)
+		}
+
+		return nil
+	}
+}
+
+// PayloadPrefix matches payloads that start with the specified bytes.
+func PayloadPrefix(prefix []byte) Matcher {
+	return func(got []byte) error {
+		if !bytes.HasPrefix(got, prefix) {
+			return fmt.Errorf("expected payload with prefix %q but got %q", prefix, got)
+		}
+
+		return nil
+	}
+}
+
+// PayloadRegexp matches payloads that contain a match of the regular
+// expression. It panics if the expression cannot be parsed.
+func PayloadRegexp(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+
+	return func(got []byte) error {
+		if !re.Match(got) {
+			return fmt.Errorf("expected payload matching %q but got %q", expr, got)
+		}
+
+		return nil
+	}
+}
+
+// PayloadJSON matches JSON payloads that have the specified value at the path.
+// The path is a dot separated list of object keys and array indexes like
+// "sensor.values.0", an empty path refers to the whole document. Values are
+// compared by their JSON encoding, which ignores the type of numbers.
+func PayloadJSON(path string, value interface{}) Matcher {
+	want, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(got []byte) error {
+		var doc interface{}
+		err := json.Unmarshal(got, &doc)
+		if err != nil {
+			return fmt.Errorf("expected JSON payload but got %q: %v", got, err)
+		}
+
+		// find value
+		found, err := lookupJSON(doc, path)
+		if err != nil {
+			return err
+		}
+
+		actual, err := json.Marshal(found)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(actual, want) {
+			return fmt.Errorf("expected %s at %q but got %s", want, path, actual)
+		}
+
+		return nil
+	}
+}
+
+// lookupJSON returns the value at the path of a decoded JSON document
+func lookupJSON(doc interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return doc, nil
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch value := doc.(type) {
+		case map[string]interface{}:
+			next, ok := value[key]
+			if !ok {
+				return nil, fmt.Errorf("expected %q in JSON payload but %q is missing", path, key)
+			}
+
+			doc = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, fmt.Errorf("expected %q in JSON payload but index %q is invalid", path, key)
+			}
+
+			doc = value[index]
+		default:
+			return nil, fmt.Errorf("expected %q in JSON payload but %q is not an object or array", path, key)
+		}
+	}
+
+	return doc, nil
+}
+
+// match compares the received packet with the expected packet. If matchers
+// are specified, the payload of a publish packet is checked by the matchers
+// instead of being compared. The options relax the comparison.
+func match(want, got packet.GenericPacket, matchers []Matcher, opts []packet.EqualOption) error {
+	if len(matchers) == 0 {
+		if !packet.Equal(want, got, opts...) {
+			return fmt.Errorf("expected packet of %q but got %q", want.String(), got.String())
+		}
+
+		return nil
+	}
+
+	expected := want.(*packet.PublishPacket)
+
+	publish, ok := got.(*packet.PublishPacket)
+	if !ok {
+		return fmt.Errorf("expected publish packet but got %q", got.String())
+	}
+
+	// compare packet without payload
+	stripped := *publish
+	stripped.Message.Payload = expected.Message.Payload
+	if !packet.Equal(expected, &stripped, opts...) {
+		return fmt.Errorf("expected packet of %q but got %q", expected.String(), publish.String())
+	}
+
+	// check payload
+	for _, matcher := range matchers {
+		err := matcher(publish.Message.Payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// packetStrings returns the string representations of the packets
+func packetStrings(pkts []packet.GenericPacket) []string {
+	strs := make([]string, 0, len(pkts))
+	for _, pkt := range pkts {
+		strs = append(strs, pkt.String())
+	}
+
+	return strs
+}
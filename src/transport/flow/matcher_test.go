@@ -0,0 +1,93 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+func TestPayloadMatchers(t *testing.T) {
+	payload := []byte(`{"sensor":{"id":"s1","values":[1,2.5,3]},"ok":true}`)
+
+	assert.NoError(t, PayloadEquals(payload)(payload))
+	assert.Error(t, PayloadEquals([]byte("foo"))(payload))
+
+	assert.NoError(t, PayloadPrefix([]byte(`{"sensor"`))(payload))
+	assert.Error(t, PayloadPrefix([]byte("foo"))(payload))
+
+	assert.NoError(t, PayloadRegexp(`"id":"s\d"`)(payload))
+	assert.Error(t, PayloadRegexp(`"id":"x\d"`)(payload))
+
+	assert.NoError(t, PayloadJSON("sensor.id", "s1")(payload))
+	assert.NoError(t, PayloadJSON("sensor.values.1", 2.5)(payload))
+	assert.NoError(t, PayloadJSON("sensor.values.2", 3)(payload))
+	assert.NoError(t, PayloadJSON("sensor.values", []float64{1, 2.5, 3})(payload))
+	assert.NoError(t, PayloadJSON("ok", true)(payload))
+	assert.Error(t, PayloadJSON("sensor.id", "s2")(payload))
+	assert.Error(t, PayloadJSON("sensor.name", "s1")(payload))
+	assert.Error(t, PayloadJSON("sensor.values.3", 1)(payload))
+	assert.Error(t, PayloadJSON("ok.foo", 1)(payload))
+	assert.Error(t, PayloadJSON("", nil)([]byte("foo")))
+}
+
+func TestFlowReceiveMatching(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte(`{"seq":1,"msg":"hello world"}`)
+
+	expected := packet.NewPublishPacket()
+	expected.Message.Topic = "test"
+
+	server := New().
+		Receive(expected, PayloadPrefix([]byte("{")), PayloadJSON("seq", 1), PayloadRegexp("hello")).
+		End()
+
+	client := New().
+		Send(publish).
+		Close()
+
+	pipe := NewPipe()
+
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+
+	err = <-errCh
+	assert.NoError(t, err)
+}
+
+func TestFlowReceiveMatchingError(t *testing.T) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte(`{"seq":1}`)
+
+	expected := packet.NewPublishPacket()
+	expected.Message.Topic = "test"
+
+	// mismatching payload
+	pipe := NewPipeSize(1)
+	pipe.Send(publish)
+
+	err := New().Receive(expected, PayloadJSON("seq", 2)).Test(pipe)
+	assert.EqualError(t, err, `expected 2 at "seq" but got 1`)
+
+	// mismatching topic
+	expected.Message.Topic = "other"
+	pipe.Send(publish)
+
+	err = New().Receive(expected, PayloadJSON("seq", 1)).Test(pipe)
+	assert.Error(t, err)
+
+	// other packet
+	pipe.Send(packet.NewPingreqPacket())
+
+	err = New().Receive(expected, PayloadJSON("seq", 1)).Test(pipe)
+	assert.Error(t, err)
+
+	assert.Panics(t, func() {
+		New().Receive(packet.NewPingreqPacket(), PayloadEquals(nil))
+	})
+}
@@ -0,0 +1,334 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"transport"
+)
+
+// ErrDuplicateFlow is returned by Add if a flow with the same name has
+// already been registered.
+var ErrDuplicateFlow = errors.New("duplicate flow")
+
+// A Suite is a set of named flows that are tested in parallel against a broker
+// like the tests of a test binary.
+type Suite struct {
+	// The number of flows that are tested concurrently, defaults to one.
+	Parallel int
+
+	// The time after which a single flow is canceled, zero disables the
+	// timeout.
+	Timeout time.Duration
+
+	names  map[string]bool
+	flows  []suiteFlow
+	filter []*regexp.Regexp
+}
+
+type suiteFlow struct {
+	name       string
+	fn         func() *Flow
+	statements []string
+}
+
+// NewSuite returns a new Suite.
+func NewSuite() *Suite {
+	return &Suite{
+		Parallel: 1,
+		names:    make(map[string]bool),
+	}
+}
+
+// Add will register the flow returned by fn under the specified name. The
+// function is called for every run, so flows can be randomized or keep state
+// in their context. Names may be structured with slashes, e.g. "qos/2/retry",
+// and must be unique.
+func (s *Suite) Add(name string, fn func() *Flow) error {
+	if s.names[name] {
+		return fmt.Errorf("%w: %s", ErrDuplicateFlow, name)
+	}
+
+	s.names[name] = true
+	s.flows = append(s.flows, suiteFlow{name: name, fn: fn})
+
+	return nil
+}
+
+// Cite will attach the identifiers of the specification statements that the
+// named flow verifies, e.g. "MQTT-3.1.0-1". The statements are reported in the
+// conformance matrix of a run.
+func (s *Suite) Cite(name string, statements ...string) error {
+	for i, f := range s.flows {
+		if f.name == name {
+			s.flows[i].statements = append(f.statements, statements...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown flow: %s", name)
+}
+
+// Names returns the names of the registered flows that match the filter in
+// registration order.
+func (s *Suite) Names() []string {
+	var names []string
+	for _, f := range s.flows {
+		if s.Match(f.name) {
+			names = append(names, f.name)
+		}
+	}
+
+	return names
+}
+
+// Filter will only run the flows that match the pattern. Like the -run flag
+// of go test the pattern is split by slashes and every element is an
+// unanchored regular expression that has to match the corresponding element
+// of the name, e.g. "qos/2" runs "qos/2/retry" but not "qos/1/retry" or
+// "connect". An empty pattern matches all flows.
+func (s *Suite) Filter(pattern string) error {
+	s.filter = nil
+	if pattern == "" {
+		return nil
+	}
+
+	for _, part := range strings.Split(pattern, "/") {
+		re, err := regexp.Compile(part)
+		if err != nil {
+			return err
+		}
+
+		s.filter = append(s.filter, re)
+	}
+
+	return nil
+}
+
+// Match returns whether the name matches the filter.
+func (s *Suite) Match(name string) bool {
+	parts := strings.Split(name, "/")
+	if len(s.filter) > len(parts) {
+		return false
+	}
+
+	for i, re := range s.filter {
+		if !re.MatchString(parts[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Run will test the matching flows against the broker at the specified URL.
+// Every flow is tested on its own connection.
+func (s *Suite) Run(url string) *Report {
+	return s.RunWith(func() (Conn, error) {
+		return transport.Dial(url)
+	})
+}
+
+// RunWith will test the matching flows on the connections returned by dial.
+// The connections are closed once their flow completed.
+func (s *Suite) RunWith(dial func() (Conn, error)) *Report {
+	report := &Report{}
+
+	// select flows
+	var flows []suiteFlow
+	for _, f := range s.flows {
+		if s.Match(f.name) {
+			flows = append(flows, f)
+		} else {
+			report.Skipped = append(report.Skipped, SuiteResult{Name: f.name, Statements: f.statements})
+		}
+	}
+
+	report.Results = make([]SuiteResult, len(flows))
+
+	parallel := s.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	start := time.Now()
+
+	// test flows
+	tokens := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, f := range flows {
+		wg.Add(1)
+		tokens <- struct{}{}
+
+		go func(i int, f suiteFlow) {
+			defer wg.Done()
+			defer func() { <-tokens }()
+
+			report.Results[i] = s.test(f, dial)
+		}(i, f)
+	}
+
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+
+	return report
+}
+
+func (s *Suite) test(f suiteFlow, dial func() (Conn, error)) SuiteResult {
+	start := time.Now()
+	result := SuiteResult{Name: f.name, Statements: f.statements}
+
+	// connect
+	conn, err := dial()
+	if err != nil {
+		result.Error = fmt.Errorf("dial: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	defer conn.Close()
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	// test flow
+	result.Error = f.fn().TestContext(ctx, conn)
+	result.Duration = time.Since(start)
+
+	return result
+}
+
+// A SuiteResult is the outcome of a single flow of a suite.
+type SuiteResult struct {
+	Name       string
+	Statements []string
+	Duration   time.Duration
+	Error      error
+}
+
+// Passed returns whether the flow completed without an error.
+func (r SuiteResult) Passed() bool {
+	return r.Error == nil
+}
+
+// A Report contains the results of a suite run in registration order.
+type Report struct {
+	Results  []SuiteResult
+	Duration time.Duration
+
+	// The flows that did not match the filter.
+	Skipped []SuiteResult
+}
+
+// Passed returns the number of passed flows.
+func (r *Report) Passed() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Passed() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Failed returns the number of failed flows.
+func (r *Report) Failed() int {
+	return len(r.Results) - r.Passed()
+}
+
+// OK returns whether all flows passed.
+func (r *Report) OK() bool {
+	return r.Failed() == 0
+}
+
+// Matrix returns the conformance matrix of the run that maps every cited
+// statement to "pass" if all tested flows citing it passed, to "fail" if one of
+// them failed and to "skip" if none of them has been tested.
+func (r *Report) Matrix() map[string]string {
+	matrix := make(map[string]string)
+
+	for _, result := range r.Skipped {
+		for _, statement := range result.Statements {
+			if matrix[statement] == "" {
+				matrix[statement] = "skip"
+			}
+		}
+	}
+
+	for _, result := range r.Results {
+		for _, statement := range result.Statements {
+			if !result.Passed() {
+				matrix[statement] = "fail"
+			} else if matrix[statement] != "fail" {
+				matrix[statement] = "pass"
+			}
+		}
+	}
+
+	return matrix
+}
+
+// WriteMatrix will write the conformance matrix as an indented JSON object
+// with sorted statements.
+func (r *Report) WriteMatrix(w io.Writer) error {
+	data, err := json.MarshalIndent(r.Matrix(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+
+	return err
+}
+
+// WriteTable will write a table with the status, duration and name of every
+// flow followed by the errors of the failed flows and a summary line.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tDURATION\tNAME")
+
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, result.Duration.Round(time.Millisecond), result.Name)
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	// write errors
+	for _, result := range r.Results {
+		if !result.Passed() {
+			fmt.Fprintf(w, "\n--- FAIL: %s\n    %s\n", result.Name, strings.Replace(result.Error.Error(), "\n", "\n    ", -1))
+		}
+	}
+
+	// write summary
+	status := "ok"
+	if !r.OK() {
+		status = "FAIL"
+	}
+
+	_, err = fmt.Fprintf(w, "\n%s: %d passed, %d failed in %s\n", status, r.Passed(), r.Failed(), r.Duration.Round(time.Millisecond))
+
+	return err
+}
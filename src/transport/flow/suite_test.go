@@ -0,0 +1,124 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+)
+
+func TestSuiteFilter(t *testing.T) {
+	s := NewSuite()
+	for _, name := range []string{"connect", "qos/1/publish", "qos/2/publish", "qos/2/retry"} {
+		require.NoError(t, s.Add(name, New))
+	}
+
+	err := s.Add("connect", New)
+	assert.True(t, errors.Is(err, ErrDuplicateFlow))
+
+	assert.Len(t, s.Names(), 4)
+
+	require.NoError(t, s.Filter("qos/2"))
+	assert.Equal(t, []string{"qos/2/publish", "qos/2/retry"}, s.Names())
+
+	require.NoError(t, s.Filter("qos//retry"))
+	assert.Equal(t, []string{"qos/2/retry"}, s.Names())
+
+	require.NoError(t, s.Filter("^conn"))
+	assert.Equal(t, []string{"connect"}, s.Names())
+
+	require.NoError(t, s.Filter("connect/extra"))
+	assert.Empty(t, s.Names())
+
+	assert.Error(t, s.Filter("("))
+}
+
+func TestSuiteRun(t *testing.T) {
+	s := NewSuite()
+	s.Parallel = 2
+	s.Timeout = 50 * time.Millisecond
+
+	require.NoError(t, s.Add("ping", func() *Flow {
+		return New().Send(packet.NewPingreqPacket()).Receive(packet.NewPingreqPacket())
+	}))
+	require.NoError(t, s.Add("mismatch", func() *Flow {
+		return New().Send(packet.NewPingreqPacket()).Receive(packet.NewPingrespPacket())
+	}))
+	require.NoError(t, s.Add("timeout", func() *Flow {
+		return New().Receive(packet.NewPingreqPacket())
+	}))
+
+	var dials int32
+	report := s.RunWith(func() (Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return NewPipeSize(1), nil
+	})
+
+	assert.Equal(t, int32(3), dials)
+	require.Len(t, report.Results, 3)
+	assert.Equal(t, "ping", report.Results[0].Name)
+	assert.True(t, report.Results[0].Passed())
+	assert.False(t, report.Results[1].Passed())
+	assert.Contains(t, report.Results[2].Error.Error(), context.DeadlineExceeded.Error())
+	assert.Equal(t, 1, report.Passed())
+	assert.Equal(t, 2, report.Failed())
+	assert.False(t, report.OK())
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteTable(&buf))
+	assert.Contains(t, buf.String(), "STATUS")
+	assert.Contains(t, buf.String(), "--- FAIL: mismatch")
+	assert.Contains(t, buf.String(), "FAIL: 1 passed, 2 failed")
+}
+
+func TestSuiteDialError(t *testing.T) {
+	s := NewSuite()
+	require.NoError(t, s.Add("dial", New))
+
+	report := s.RunWith(func() (Conn, error) {
+		return nil, errors.New("refused")
+	})
+
+	require.Len(t, report.Results, 1)
+	assert.EqualError(t, report.Results[0].Error, "dial: refused")
+}
+
+func TestSuiteMatrix(t *testing.T) {
+	s := NewSuite()
+	require.NoError(t, s.Add("ping", func() *Flow {
+		return New().Send(packet.NewPingreqPacket()).Receive(packet.NewPingreqPacket())
+	}))
+	require.NoError(t, s.Add("mismatch", func() *Flow {
+		return New().Send(packet.NewPingreqPacket()).Receive(packet.NewPingrespPacket())
+	}))
+	require.NoError(t, s.Add("skipped", New))
+
+	require.NoError(t, s.Cite("ping", "MQTT-1", "MQTT-2"))
+	require.NoError(t, s.Cite("mismatch", "MQTT-2"))
+	require.NoError(t, s.Cite("skipped", "MQTT-1", "MQTT-3"))
+	assert.Error(t, s.Cite("unknown", "MQTT-4"))
+
+	require.NoError(t, s.Filter("ping|mismatch"))
+
+	report := s.RunWith(func() (Conn, error) {
+		return NewPipeSize(1), nil
+	})
+
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, "skipped", report.Skipped[0].Name)
+	assert.Equal(t, map[string]string{
+		"MQTT-1": "pass",
+		"MQTT-2": "fail",
+		"MQTT-3": "skip",
+	}, report.Matrix())
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteMatrix(&buf))
+	assert.Equal(t, "{\n  \"MQTT-1\": \"pass\",\n  \"MQTT-2\": \"fail\",\n  \"MQTT-3\": \"skip\"\n}\n", buf.String())
+}
@@ -0,0 +1,143 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Step is the record of a single action executed by a flow.
+type Step struct {
+	// The position of the step in the timeline.
+	Index int `json:"index"`
+
+	// A description of the action, e.g. "receive Connack".
+	Action string `json:"action"`
+
+	// The name of the action if it has been named.
+	Name string `json:"name,omitempty"`
+
+	// The time the action started and its duration in seconds.
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+
+	// The error returned by the action, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// A Timeline records the steps executed by the flows it is attached to. It is
+// safe for concurrent use.
+type Timeline struct {
+	steps []Step
+	mutex sync.Mutex
+}
+
+// NewTimeline returns a new Timeline.
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+// WithTimeline will record the actions executed by the flow in the specified
+// timeline.
+func (f *Flow) WithTimeline(timeline *Timeline) *Flow {
+	f.timeline = timeline
+
+	return f
+}
+
+// Steps returns a copy of the recorded steps.
+func (t *Timeline) Steps() []Step {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]Step(nil), t.steps...)
+}
+
+// Slowest returns up to n recorded steps ordered by decreasing duration.
+func (t *Timeline) Slowest(n int) []Step {
+	steps := t.Steps()
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Duration > steps[j].Duration
+	})
+
+	if n < len(steps) {
+		steps = steps[:n]
+	}
+
+	return steps
+}
+
+// WriteJSON will write the recorded steps as a JSON array.
+func (t *Timeline) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(t.Steps())
+}
+
+// add will record an executed action
+func (t *Timeline) add(action *action, start time.Time, duration time.Duration, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	step := Step{
+		Index:    len(t.steps),
+		Action:   action.describe(),
+		Name:     action.name,
+		Start:    start,
+		Duration: duration.Seconds(),
+	}
+
+	if err != nil {
+		step.Error = err.Error()
+	}
+
+	t.steps = append(t.steps, step)
+}
+
+// describe returns a description of the action
+func (a *action) describe() string {
+	switch a.kind {
+	case actionSend:
+		return "send " + a.packet.Type().String()
+	case actionReceive:
+		return "receive " + a.packet.Type().String()
+	case actionReceiveType:
+		return "receive any " + a.packetType.String()
+	case actionReceiveAll:
+		types := make([]string, 0, len(a.packets))
+		for _, pkt := range a.packets {
+			types = append(types, pkt.Type().String())
+		}
+		return "receive all of " + strings.Join(types, ", ")
+	case actionSkip:
+		return fmt.Sprintf("skip %d", a.count)
+	case actionSkipWhile:
+		return "skip while " + a.packetType.String()
+	case actionWait:
+		return "wait"
+	case actionRun:
+		return "run"
+	case actionDelay:
+		return "delay " + a.duration.String()
+	case actionClose:
+		return "close"
+	case actionEnd:
+		return "end with " + a.describeEnd()
+	case actionInterleave:
+		return "interleave " + names(a.groups)
+	case actionRetry:
+		return fmt.Sprintf("retry %d with %s", a.count, a.duration)
+	case actionBackground:
+		if a.duration > 0 {
+			return "background every " + a.duration.String()
+		}
+		return "background"
+	}
+
+	return "unknown"
+}
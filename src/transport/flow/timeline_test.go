@@ -0,0 +1,86 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+func TestFlowTimeline(t *testing.T) {
+	timeline := NewTimeline()
+
+	server := New().
+		Receive(packet.NewConnectPacket()).
+		Send(packet.NewConnackPacket()).
+		Close()
+
+	client := New().
+		WithTimeline(timeline).
+		Send(packet.NewConnectPacket()).
+		Delay(20 * time.Millisecond).
+		Receive(packet.NewConnackPacket()).Named("expect CONNACK").
+		Interleave(
+			NewGroup("a", New().Run(func() {})),
+		).
+		End()
+
+	pipe := NewPipe()
+	errCh := server.TestAsync(pipe, 100*time.Millisecond)
+
+	err := client.Test(pipe)
+	assert.NoError(t, err)
+	assert.NoError(t, <-errCh)
+
+	var actions []string
+	for i, step := range timeline.Steps() {
+		assert.Equal(t, i, step.Index)
+		assert.Empty(t, step.Error)
+		actions = append(actions, step.Action)
+	}
+
+	assert.Equal(t, []string{
+		"send Connect",
+		"delay 20ms",
+		"receive Connack",
+		"run",
+		"interleave a",
+		"end with any EOF",
+	}, actions)
+
+	assert.Equal(t, "expect CONNACK", timeline.Steps()[2].Name)
+
+	slowest := timeline.Slowest(1)
+	assert.Len(t, slowest, 1)
+	assert.Equal(t, "delay 20ms", slowest[0].Action)
+	assert.True(t, slowest[0].Duration >= 0.02)
+
+	var buf bytes.Buffer
+	err = timeline.WriteJSON(&buf)
+	assert.NoError(t, err)
+
+	var steps []Step
+	err = json.Unmarshal(buf.Bytes(), &steps)
+	assert.NoError(t, err)
+	assert.Len(t, steps, 6)
+}
+
+func TestFlowTimelineError(t *testing.T) {
+	timeline := NewTimeline()
+
+	pipe := NewPipe()
+	pipe.Close()
+
+	err := New().
+		WithTimeline(timeline).
+		Receive(packet.NewPingreqPacket()).
+		Test(pipe)
+	assert.Error(t, err)
+
+	steps := timeline.Steps()
+	assert.Len(t, steps, 1)
+	assert.Equal(t, err.Error(), steps[0].Error)
+}
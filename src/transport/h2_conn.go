@@ -0,0 +1,636 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ErrHTTP2NotNegotiated is returned when dialing a WebSocket over HTTP/2 and
+// the server does not select h2 during the TLS handshake.
+var ErrHTTP2NotNegotiated = errors.New("http/2 not negotiated")
+
+// ErrExtendedConnectNotSupported is returned when dialing a WebSocket over
+// HTTP/2 and the server does not enable the extended CONNECT method.
+var ErrExtendedConnectNotSupported = errors.New("extended connect not supported")
+
+// the setting that enables the extended connect method (RFC 8441)
+const h2SettingEnableConnectProtocol http2.SettingID = 0x8
+
+// the default http/2 flow control window and frame size
+const (
+	h2DefaultWindow    = 65535
+	h2DefaultFrameSize = 16384
+)
+
+// the stream used for the web socket
+const h2Stream = 1
+
+// the guid used to compute Sec-WebSocket-Accept
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DialWebSocketH2 will bootstrap a WebSocket over an HTTP/2 stream using the
+// extended CONNECT method (RFC 8441). The TLS connection must negotiate h2.
+// The url must use the wss scheme.
+func DialWebSocketH2(network, urlString string, config *tls.Config, requestHeader http.Header) (*WebSocketConn, error) {
+	// parse url
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	// prepare config
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	config = config.Clone()
+	config.NextProtos = []string{"h2"}
+
+	// dial tls
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	tlsConn, wire, err := dialTLS(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// check protocol
+	if tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		tlsConn.Close()
+		return nil, ErrHTTP2NotNegotiated
+	}
+
+	// run web socket handshake over the stream, the ws scheme prevents a
+	// second tls handshake
+	stream, err := newH2WebSocketStream(tlsConn)
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+
+	wsURL := *u
+	wsURL.Scheme = "ws"
+
+	// request the mqtt sub protocol as the regular web socket dialer
+	header := http.Header{}
+	for name, values := range requestHeader {
+		header[name] = values
+	}
+
+	if header.Get("Sec-WebSocket-Protocol") == "" {
+		header.Set("Sec-WebSocket-Protocol", "mqtt")
+	}
+
+	conn, _, err := websocket.NewClient(stream, &wsURL, header, 0, 0)
+	if err != nil {
+		stream.Close()
+
+		// return the reason of a failed extended connect
+		stream.hMutex.Lock()
+		handshakeErr := stream.handshakeErr
+		stream.hMutex.Unlock()
+		if handshakeErr != nil {
+			return nil, handshakeErr
+		}
+
+		return nil, err
+	}
+
+	c := NewWebSocketConn(conn)
+	c.setWire(wire)
+
+	return c, nil
+}
+
+// An h2WebSocketStream is a net.Conn that carries a web socket over a single
+// http/2 stream. The HTTP/1.1 upgrade request written by the web socket
+// client is translated to an extended CONNECT request and the response is
+// translated back to an upgrade response.
+type h2WebSocketStream struct {
+	conn   net.Conn
+	framer *http2.Framer
+
+	// serializes frame writes, frames are only read by the loop
+	wMutex    sync.Mutex
+	closeOnce sync.Once
+
+	// guarded by hMutex
+	hMutex       sync.Mutex
+	encoder      *hpack.Encoder
+	encoded      bytes.Buffer
+	request      bytes.Buffer
+	upgraded     bool
+	reply        *bytes.Reader
+	handshakeErr error
+
+	// guarded by mutex
+	mutex         sync.Mutex
+	cond          *sync.Cond
+	settings      bool
+	connect       bool
+	maxFrame      int
+	sendWindow    int64
+	streamWindow  int64
+	initialWindow int64
+	status        int
+	response      http.Header
+	data          bytes.Buffer
+	err           error
+	readDeadline  time.Time
+	deadlineTimer *time.Timer
+}
+
+// newH2WebSocketStream sends the connection preface and starts reading frames
+func newH2WebSocketStream(conn net.Conn) (*h2WebSocketStream, error) {
+	s := &h2WebSocketStream{
+		conn:          conn,
+		framer:        http2.NewFramer(conn, bufio.NewReader(conn)),
+		maxFrame:      h2DefaultFrameSize,
+		sendWindow:    h2DefaultWindow,
+		streamWindow:  h2DefaultWindow,
+		initialWindow: h2DefaultWindow,
+	}
+
+	s.cond = sync.NewCond(&s.mutex)
+	s.encoder = hpack.NewEncoder(&s.encoded)
+
+	// merge header and continuation frames
+	s.framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+
+	// write preface and settings
+	_, err := io.WriteString(conn, http2.ClientPreface)
+	if err == nil {
+		err = s.framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 0})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go s.loop()
+
+	return s, nil
+}
+
+// Read returns the translated upgrade response and then the stream data.
+func (s *h2WebSocketStream) Read(p []byte) (int, error) {
+	// return upgrade response first
+	s.hMutex.Lock()
+	reply := s.reply
+	s.hMutex.Unlock()
+	if reply != nil && reply.Len() > 0 {
+		return reply.Read(p)
+	}
+
+	s.mutex.Lock()
+
+	// wait for data
+	for s.data.Len() == 0 && s.err == nil {
+		if !s.readDeadline.IsZero() && !time.Now().Before(s.readDeadline) {
+			s.mutex.Unlock()
+			return 0, timeoutError{}
+		}
+
+		s.cond.Wait()
+	}
+
+	if s.data.Len() == 0 {
+		err := s.err
+		s.mutex.Unlock()
+		return 0, err
+	}
+
+	n, _ := s.data.Read(p)
+	s.mutex.Unlock()
+
+	// return consumed flow control window
+	err := s.windowUpdate(n)
+	if err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Write translates the upgrade request and then writes data frames.
+func (s *h2WebSocketStream) Write(p []byte) (int, error) {
+	s.hMutex.Lock()
+
+	// collect upgrade request
+	if !s.upgraded {
+		defer s.hMutex.Unlock()
+
+		s.request.Write(p)
+		if !bytes.Contains(s.request.Bytes(), []byte("\r\n\r\n")) {
+			return len(p), nil
+		}
+
+		err := s.extendedConnect()
+		if err != nil {
+			s.handshakeErr = err
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	s.hMutex.Unlock()
+
+	total := 0
+	for len(p) > 0 {
+		s.mutex.Lock()
+
+		// wait for flow control window
+		for (s.sendWindow <= 0 || s.streamWindow <= 0) && s.err == nil {
+			s.cond.Wait()
+		}
+
+		if s.err != nil {
+			err := s.err
+			s.mutex.Unlock()
+			return total, err
+		}
+
+		n := int64(len(p))
+		if n > int64(s.maxFrame) {
+			n = int64(s.maxFrame)
+		}
+		if n > s.sendWindow {
+			n = s.sendWindow
+		}
+		if n > s.streamWindow {
+			n = s.streamWindow
+		}
+
+		s.sendWindow -= n
+		s.streamWindow -= n
+		s.mutex.Unlock()
+
+		// write frame
+		err := s.write(func() error {
+			return s.framer.WriteData(h2Stream, false, p[:n])
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += int(n)
+		p = p[n:]
+	}
+
+	return total, nil
+}
+
+// extendedConnect sends the collected upgrade request as an extended connect
+// request and prepares the upgrade response
+func (s *h2WebSocketStream) extendedConnect() error {
+	// parse request
+	req, err := http.ReadRequest(bufio.NewReader(&s.request))
+	if err != nil {
+		return err
+	}
+
+	// wait for server settings
+	s.mutex.Lock()
+	for !s.settings && s.err == nil {
+		s.cond.Wait()
+	}
+	connect, err := s.connect, s.err
+	maxFrame := s.maxFrame
+	s.mutex.Unlock()
+
+	if err != nil {
+		return err
+	} else if !connect {
+		return ErrExtendedConnectNotSupported
+	}
+
+	// encode headers
+	s.encoded.Reset()
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: "CONNECT"},
+		{Name: ":protocol", Value: "websocket"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: req.Host},
+		{Name: ":path", Value: req.URL.RequestURI()},
+	}
+
+	for name, values := range req.Header {
+		switch name {
+		case "Connection", "Upgrade", "Sec-Websocket-Key":
+			continue
+		}
+
+		for _, value := range values {
+			fields = append(fields, hpack.HeaderField{Name: strings.ToLower(name), Value: value})
+		}
+	}
+
+	for _, field := range fields {
+		err = s.encoder.WriteField(field)
+		if err != nil {
+			return err
+		}
+	}
+
+	// write headers and continuations
+	err = s.write(func() error {
+		block := s.encoded.Bytes()
+		first := true
+		for first || len(block) > 0 {
+			n := len(block)
+			if n > maxFrame {
+				n = maxFrame
+			}
+
+			var err error
+			if first {
+				err = s.framer.WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      h2Stream,
+					BlockFragment: block[:n],
+					EndHeaders:    n == len(block),
+				})
+			} else {
+				err = s.framer.WriteContinuation(h2Stream, n == len(block), block[:n])
+			}
+			if err != nil {
+				return err
+			}
+
+			block = block[n:]
+			first = false
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// wait for response
+	s.mutex.Lock()
+	for s.status == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	status, response, err := s.status, s.response, s.err
+	s.mutex.Unlock()
+
+	if status == 0 {
+		return err
+	} else if status != http.StatusOK {
+		return fmt.Errorf("extended connect failed: %d %s", status, http.StatusText(status))
+	}
+
+	// compute accept key
+	hash := sha1.Sum([]byte(req.Header.Get("Sec-Websocket-Key") + webSocketGUID))
+
+	// prepare upgrade response
+	var reply bytes.Buffer
+	reply.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	reply.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	reply.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n")
+	for _, name := range []string{"Sec-Websocket-Protocol", "Sec-Websocket-Extensions"} {
+		for _, value := range response[name] {
+			reply.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	reply.WriteString("\r\n")
+
+	s.reply = bytes.NewReader(reply.Bytes())
+	s.upgraded = true
+
+	return nil
+}
+
+// loop reads frames until the connection fails
+func (s *h2WebSocketStream) loop() {
+	fail := func(err error) {
+		s.mutex.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+	}
+
+	for {
+		frame, err := s.framer.ReadFrame()
+		if err != nil {
+			fail(err)
+			s.conn.Close()
+			return
+		}
+
+		switch frame := frame.(type) {
+		case *http2.SettingsFrame:
+			if frame.IsAck() {
+				continue
+			}
+
+			s.mutex.Lock()
+			frame.ForeachSetting(func(setting http2.Setting) error {
+				switch setting.ID {
+				case http2.SettingInitialWindowSize:
+					s.streamWindow += int64(setting.Val) - s.initialWindow
+					s.initialWindow = int64(setting.Val)
+				case http2.SettingMaxFrameSize:
+					s.maxFrame = int(setting.Val)
+				case h2SettingEnableConnectProtocol:
+					s.connect = setting.Val == 1
+				}
+
+				return nil
+			})
+			s.settings = true
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+
+			err = s.write(s.framer.WriteSettingsAck)
+		case *http2.PingFrame:
+			if !frame.IsAck() {
+				err = s.write(func() error {
+					return s.framer.WritePing(true, frame.Data)
+				})
+			}
+		case *http2.WindowUpdateFrame:
+			s.mutex.Lock()
+			if frame.StreamID == 0 {
+				s.sendWindow += int64(frame.Increment)
+			} else if frame.StreamID == h2Stream {
+				s.streamWindow += int64(frame.Increment)
+			}
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+		case *http2.MetaHeadersFrame:
+			if frame.StreamID != h2Stream {
+				continue
+			}
+
+			s.mutex.Lock()
+			if s.status == 0 {
+				s.status, _ = strconv.Atoi(frame.PseudoValue("status"))
+				s.response = http.Header{}
+				for _, field := range frame.RegularFields() {
+					s.response.Add(field.Name, field.Value)
+				}
+			}
+			if frame.StreamEnded() && s.err == nil {
+				s.err = io.EOF
+			}
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+		case *http2.DataFrame:
+			if frame.StreamID != h2Stream {
+				continue
+			}
+
+			data := frame.Data()
+
+			s.mutex.Lock()
+			s.data.Write(data)
+			if frame.StreamEnded() && s.err == nil {
+				s.err = io.EOF
+			}
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+
+			// return the window of the padding immediately
+			err = s.windowUpdate(int(frame.Header().Length) - len(data))
+		case *http2.RSTStreamFrame:
+			if frame.StreamID == h2Stream {
+				err = fmt.Errorf("stream reset by peer: %s", frame.ErrCode)
+			}
+		case *http2.GoAwayFrame:
+			if frame.ErrCode != http2.ErrCodeNo {
+				err = fmt.Errorf("connection closed by peer: %s", frame.ErrCode)
+			}
+		}
+
+		if err != nil {
+			fail(err)
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// write runs a frame write of the framer while holding the write mutex
+func (s *h2WebSocketStream) write(fn func() error) error {
+	s.wMutex.Lock()
+	defer s.wMutex.Unlock()
+
+	return fn()
+}
+
+// windowUpdate returns consumed flow control window to the peer
+func (s *h2WebSocketStream) windowUpdate(n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	return s.write(func() error {
+		err := s.framer.WriteWindowUpdate(0, uint32(n))
+		if err != nil {
+			return err
+		}
+
+		return s.framer.WriteWindowUpdate(h2Stream, uint32(n))
+	})
+}
+
+// Close will end the stream and close the connection.
+func (s *h2WebSocketStream) Close() error {
+	err := net.ErrClosed
+
+	s.closeOnce.Do(func() {
+		// end stream and connection
+		s.write(func() error {
+			s.framer.WriteData(h2Stream, true, nil)
+			return s.framer.WriteGoAway(0, http2.ErrCodeNo, nil)
+		})
+
+		s.mutex.Lock()
+		if s.err == nil {
+			s.err = net.ErrClosed
+		}
+		if s.deadlineTimer != nil {
+			s.deadlineTimer.Stop()
+		}
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+
+		err = s.conn.Close()
+	})
+
+	return err
+}
+
+// LocalAddr returns the local address of the connection.
+func (s *h2WebSocketStream) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (s *h2WebSocketStream) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadline.
+func (s *h2WebSocketStream) SetDeadline(t time.Time) error {
+	err := s.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+
+	return s.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of blocked and future reads.
+func (s *h2WebSocketStream) SetReadDeadline(t time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.readDeadline = t
+
+	// wake up readers at the deadline
+	if s.deadlineTimer != nil {
+		s.deadlineTimer.Stop()
+		s.deadlineTimer = nil
+	}
+
+	if !t.IsZero() {
+		s.deadlineTimer = time.AfterFunc(time.Until(t), func() {
+			s.mutex.Lock()
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+		})
+	}
+
+	s.cond.Broadcast()
+
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the underlying connection.
+func (s *h2WebSocketStream) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,184 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"packet"
+)
+
+// the extended connect method of the net/http server is only enabled by this
+// setting, which is read once at startup
+const h2ExtendedConnect = "http2xconnect=1"
+
+// runs the test in a new process with the extended connect method enabled and
+// returns false if the test has been run in the current process already
+func withExtendedConnect(t *testing.T) bool {
+	if strings.Contains(os.Getenv("GODEBUG"), h2ExtendedConnect) {
+		return true
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")
+	cmd.Env = append(os.Environ(), "GODEBUG="+h2ExtendedConnect)
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+
+	return false
+}
+
+// h2EchoServer returns a net/http server that answers extended connect
+// requests and echoes the received web socket frames
+func h2EchoServer(t *testing.T, h2 bool) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HTTP/2.0", r.Proto)
+		assert.Equal(t, http.MethodConnect, r.Method)
+		assert.Equal(t, "websocket", r.Header.Get(":protocol"))
+		assert.Equal(t, "/mqtt", r.URL.Path)
+		assert.Equal(t, "13", r.Header.Get("Sec-Websocket-Version"))
+		assert.Equal(t, "mqtt", r.Header.Get("Sec-Websocket-Protocol"))
+
+		w.Header().Set("Sec-Websocket-Protocol", "mqtt")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		// echo masked frames unmasked until the stream ends
+		reader := bufio.NewReader(r.Body)
+		for {
+			var header [2]byte
+			_, err := io.ReadFull(reader, header[:])
+			if err != nil {
+				return
+			}
+
+			length := uint64(header[1] & 0x7f)
+			var extended []byte
+			switch length {
+			case 126:
+				extended = make([]byte, 2)
+				_, err = io.ReadFull(reader, extended)
+				length = uint64(binary.BigEndian.Uint16(extended))
+			case 127:
+				extended = make([]byte, 8)
+				_, err = io.ReadFull(reader, extended)
+				length = binary.BigEndian.Uint64(extended)
+			}
+
+			var mask [4]byte
+			if err == nil {
+				_, err = io.ReadFull(reader, mask[:])
+			}
+
+			payload := make([]byte, length)
+			if err == nil {
+				_, err = io.ReadFull(reader, payload)
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+
+			frame := append([]byte{header[0], header[1] & 0x7f}, extended...)
+			frame = append(frame, payload...)
+
+			_, err = w.Write(frame)
+			if err != nil {
+				return
+			}
+
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	server.TLS = serverTLSConfig.Clone()
+	server.EnableHTTP2 = h2
+	if !h2 {
+		// negotiate no protocol at all instead of rejecting the handshake
+		server.TLS.NextProtos = []string{}
+	}
+	server.StartTLS()
+
+	return server
+}
+
+func TestDialWebSocketH2(t *testing.T) {
+	if !withExtendedConnect(t) {
+		return
+	}
+
+	server := h2EchoServer(t, true)
+	defer server.Close()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = clientTLSConfig
+
+	conn, err := dialer.Dial("wss+h2://" + server.Listener.Addr().String() + "/mqtt")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	connect := packet.NewConnectPacket()
+	connect.ClientID = "foo"
+
+	err = conn.Send(connect)
+	assert.NoError(t, err)
+
+	pkt, err := conn.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, connect.String(), pkt.String())
+
+	// larger than the default frame size and window
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "foo"
+	publish.Message.Payload = bytes.Repeat([]byte("x"), 100000)
+
+	err = conn.Send(publish)
+	assert.NoError(t, err)
+
+	pkt, err = conn.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, publish.String(), pkt.String())
+
+	err = conn.Close()
+	assert.NoError(t, err)
+}
+
+func TestDialWebSocketH2NotSupported(t *testing.T) {
+	if strings.Contains(os.Getenv("GODEBUG"), h2ExtendedConnect) {
+		t.Skip("extended connect enabled")
+	}
+
+	server := h2EchoServer(t, true)
+	defer server.Close()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = clientTLSConfig
+
+	conn, err := dialer.Dial("wss+h2://" + server.Listener.Addr().String() + "/mqtt")
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrExtendedConnectNotSupported, err)
+}
+
+func TestDialWebSocketH2NotNegotiated(t *testing.T) {
+	server := h2EchoServer(t, false)
+	defer server.Close()
+
+	dialer := NewDialer()
+	dialer.TLSConfig = clientTLSConfig
+
+	conn, err := dialer.Dial("wss+h2://" + server.Listener.Addr().String() + "/mqtt")
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrHTTP2NotNegotiated, err)
+}
@@ -0,0 +1,390 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrHTTPSessionClosed is returned by an HTTPConn if the bridge session has
+// been closed by the other side.
+var ErrHTTPSessionClosed = errors.New("http session closed")
+
+// The modes used to receive packets over an HTTP bridge.
+const (
+	HTTPLongPoll = "poll"
+	HTTPEvents   = "sse"
+)
+
+// the paths of the bridge endpoints relative to the bridge url
+const (
+	httpConnectPath = "/connect"
+	httpSendPath    = "/send"
+	httpPollPath    = "/poll"
+	httpEventsPath  = "/events"
+	httpClosePath   = "/close"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// a chunkQueue turns a sequence of byte slices into a reader that supports
+// read deadlines
+type chunkQueue struct {
+	chunks  chan []byte
+	done    chan struct{}
+	once    sync.Once
+	err     error
+	current []byte
+
+	deadline      time.Time
+	deadlineMutex sync.Mutex
+}
+
+func newChunkQueue() *chunkQueue {
+	return &chunkQueue{
+		chunks: make(chan []byte, 16),
+		done:   make(chan struct{}),
+	}
+}
+
+func (q *chunkQueue) push(chunk []byte) error {
+	select {
+	case <-q.done:
+		return ErrHTTPSessionClosed
+	default:
+	}
+
+	select {
+	case q.chunks <- chunk:
+		return nil
+	case <-q.done:
+		return ErrHTTPSessionClosed
+	}
+}
+
+func (q *chunkQueue) close(err error) {
+	q.once.Do(func() {
+		q.err = err
+		close(q.done)
+	})
+}
+
+func (q *chunkQueue) Read(p []byte) (int, error) {
+	// get next chunk if current has been consumed
+	for len(q.current) == 0 {
+		// prefer queued chunks over a close
+		select {
+		case q.current = <-q.chunks:
+			continue
+		default:
+		}
+
+		// prepare deadline
+		var timeout <-chan time.Time
+		q.deadlineMutex.Lock()
+		deadline := q.deadline
+		q.deadlineMutex.Unlock()
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case q.current = <-q.chunks:
+		case <-q.done:
+			return 0, q.err
+		case <-timeout:
+			return 0, timeoutError{}
+		}
+	}
+
+	n := copy(p, q.current)
+	q.current = q.current[n:]
+
+	return n, nil
+}
+
+func (q *chunkQueue) SetReadDeadline(t time.Time) error {
+	q.deadlineMutex.Lock()
+	defer q.deadlineMutex.Unlock()
+
+	q.deadline = t
+
+	return nil
+}
+
+// httpStream is the client side carrier of an HTTP bridge session
+type httpStream struct {
+	*chunkQueue
+
+	client *http.Client
+	header http.Header
+	url    string
+	cancel context.CancelFunc
+
+	closeOnce sync.Once
+}
+
+func (s *httpStream) request(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+
+	return s.client.Do(req.WithContext(ctx))
+}
+
+func (s *httpStream) Write(p []byte) (int, error) {
+	// check if closed
+	select {
+	case <-s.done:
+		return 0, ErrHTTPSessionClosed
+	default:
+	}
+
+	// post data
+	res, err := s.request(context.Background(), http.MethodPost, httpSendPath, p)
+	if err != nil {
+		return 0, err
+	}
+
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	// check status
+	if res.StatusCode == http.StatusGone {
+		return 0, ErrHTTPSessionClosed
+	} else if res.StatusCode != http.StatusNoContent {
+		return 0, fmt.Errorf("http bridge: unexpected status %q", res.Status)
+	}
+
+	return len(p), nil
+}
+
+func (s *httpStream) Close() error {
+	err := ErrHTTPSessionClosed
+
+	s.closeOnce.Do(func() {
+		err = nil
+
+		// stop receiving
+		s.close(io.EOF)
+		s.cancel()
+
+		// announce close, the session might already be gone
+		res, reqErr := s.request(context.Background(), http.MethodPost, httpClosePath, nil)
+		if reqErr == nil {
+			res.Body.Close()
+		}
+
+		s.client.Transport.(*http.Transport).CloseIdleConnections()
+	})
+
+	return err
+}
+
+// polls for downstream data until the session is closed
+func (s *httpStream) poll(ctx context.Context) {
+	for {
+		res, err := s.request(ctx, http.MethodGet, httpPollPath, nil)
+		if err != nil {
+			s.close(err)
+			return
+		}
+
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			s.close(err)
+			return
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			if s.push(data) != nil {
+				return
+			}
+		case http.StatusNoContent:
+			// poll timed out without data
+		case http.StatusGone, http.StatusNotFound:
+			s.close(io.EOF)
+			return
+		default:
+			s.close(fmt.Errorf("http bridge: unexpected status %q", res.Status))
+			return
+		}
+	}
+}
+
+// reads server-sent events until the session is closed
+func (s *httpStream) events(ctx context.Context) {
+	res, err := s.request(ctx, http.MethodGet, httpEventsPath, nil)
+	if err != nil {
+		s.close(err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusGone || res.StatusCode == http.StatusNotFound {
+		s.close(io.EOF)
+		return
+	} else if res.StatusCode != http.StatusOK {
+		s.close(fmt.Errorf("http bridge: unexpected status %q", res.Status))
+		return
+	}
+
+	reader := bufio.NewReader(res.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			s.close(io.EOF)
+			return
+		} else if err != nil {
+			s.close(err)
+			return
+		}
+
+		// ignore everything but data fields
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[5:]))
+		if err != nil {
+			s.close(err)
+			return
+		}
+
+		if s.push(data) != nil {
+			return
+		}
+	}
+}
+
+// The HTTPConn tunnels packets over HTTP requests for environments where only
+// HTTP egress is allowed. Packets are sent using POST requests while incoming
+// packets are either received using long-polling or a Server-Sent Events
+// stream. The bridge endpoint is provided by an HTTPServer.
+type HTTPConn struct {
+	BaseConn
+
+	stream     io.ReadWriteCloser
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+// DialHTTP opens a bridge session at the specified url (e.g. "http://host/mqtt")
+// and receives packets using the specified mode. The optional header is added
+// to all requests.
+func DialHTTP(url, mode string, config *tls.Config, header http.Header) (*HTTPConn, error) {
+	// check mode
+	if mode != HTTPLongPoll && mode != HTTPEvents {
+		return nil, ErrUnsupportedProtocol
+	}
+
+	// prepare client
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := &httpStream{
+		chunkQueue: newChunkQueue(),
+		client:     client,
+		header:     header,
+		url:        strings.TrimSuffix(url, "/"),
+		cancel:     cancel,
+	}
+
+	// capture addresses of the used connection
+	var localAddr, remoteAddr net.Addr
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			localAddr = info.Conn.LocalAddr()
+			remoteAddr = info.Conn.RemoteAddr()
+		},
+	}
+
+	// create session
+	res, err := stream.request(httptrace.WithClientTrace(ctx, trace), http.MethodPost, httpConnectPath, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	id, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		cancel()
+		return nil, err
+	} else if res.StatusCode != http.StatusOK {
+		cancel()
+		return nil, fmt.Errorf("http bridge: unexpected status %q", res.Status)
+	}
+
+	stream.url += "/" + string(id)
+
+	// start receiving
+	if mode == HTTPEvents {
+		go stream.events(ctx)
+	} else {
+		go stream.poll(ctx)
+	}
+
+	conn := &HTTPConn{
+		BaseConn:   *NewBaseConn(stream),
+		stream:     stream,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+	}
+
+	conn.setOwner(conn)
+
+	return conn, nil
+}
+
+// LocalAddr returns the local network address.
+func (c *HTTPConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the remote network address.
+func (c *HTTPConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// splits a scheme like "https+sse" into the HTTP scheme and the receive mode
+func splitHTTPScheme(scheme string) (string, string) {
+	i := strings.Index(scheme, "+")
+	if i < 0 {
+		return scheme, HTTPLongPoll
+	}
+
+	return scheme[:i], scheme[i+1:]
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"testing"
+)
+
+func TestHTTPConnConnection(t *testing.T) {
+	abstractConnConnectTest(t, "http+poll")
+	abstractConnConnectTest(t, "http+sse")
+}
+
+func TestHTTPConnClose(t *testing.T) {
+	abstractConnCloseTest(t, "http+poll")
+	abstractConnCloseTest(t, "http+sse")
+}
+
+func TestHTTPConnEncodeError(t *testing.T) {
+	abstractConnEncodeErrorTest(t, "http+poll")
+	abstractConnEncodeErrorTest(t, "http+sse")
+}
+
+func TestHTTPConnDecodeError(t *testing.T) {
+	abstractConnDecodeErrorTest(t, "http+poll")
+	abstractConnDecodeErrorTest(t, "http+sse")
+}
+
+func TestHTTPConnSendAfterClose(t *testing.T) {
+	abstractConnSendAfterCloseTest(t, "http+poll")
+	abstractConnSendAfterCloseTest(t, "http+sse")
+}
+
+func TestHTTPConnCloseWhileSend(t *testing.T) {
+	abstractConnCloseWhileSendTest(t, "http+poll")
+	abstractConnCloseWhileSendTest(t, "http+sse")
+}
+
+func TestHTTPConnSendAndClose(t *testing.T) {
+	abstractConnSendAndCloseTest(t, "http+poll")
+	abstractConnSendAndCloseTest(t, "http+sse")
+}
+
+func TestHTTPConnReadLimit(t *testing.T) {
+	abstractConnReadLimitTest(t, "http+poll")
+	abstractConnReadLimitTest(t, "http+sse")
+}
+
+func TestHTTPConnReadTimeout(t *testing.T) {
+	abstractConnReadTimeoutTest(t, "http+poll")
+	abstractConnReadTimeoutTest(t, "http+sse")
+}
+
+func TestHTTPConnCloseAfterClose(t *testing.T) {
+	abstractConnCloseAfterCloseTest(t, "http+poll")
+	abstractConnCloseAfterCloseTest(t, "http+sse")
+}
+
+func TestHTTPConnAddr(t *testing.T) {
+	abstractConnAddrTest(t, "http+poll")
+	abstractConnAddrTest(t, "http+sse")
+}
+
+func TestHTTPConnBufferedSend(t *testing.T) {
+	abstractConnBufferedSendTest(t, "http+poll")
+	abstractConnBufferedSendTest(t, "http+sse")
+}
+
+func TestHTTPConnSendAfterBufferedSend(t *testing.T) {
+	abstractConnSendAfterBufferedSendTest(t, "http+poll")
+	abstractConnSendAfterBufferedSendTest(t, "http+sse")
+}
+
+func TestHTTPConnBufferedSendAfterClose(t *testing.T) {
+	abstractConnBufferedSendAfterCloseTest(t, "http+poll")
+	abstractConnBufferedSendAfterCloseTest(t, "http+sse")
+}
+
+func TestHTTPConnCloseAfterBufferedSend(t *testing.T) {
+	abstractConnCloseAfterBufferedSendTest(t, "http+poll")
+	abstractConnCloseAfterBufferedSendTest(t, "http+sse")
+}
+
+func TestHTTPConnBigBufferedSendAfterClose(t *testing.T) {
+	abstractConnBigBufferedSendAfterCloseTest(t, "http+poll")
+	abstractConnBigBufferedSendAfterCloseTest(t, "http+sse")
+}
+
+func TestHTTPConnReadBatch(t *testing.T) {
+	abstractConnReadBatchTest(t, "http+poll")
+	abstractConnReadBatchTest(t, "http+sse")
+}
+
+func TestHTTPConnFlush(t *testing.T) {
+	abstractConnFlushTest(t, "http+poll")
+	abstractConnFlushTest(t, "http+sse")
+}
+
+func TestHTTPConnWriteDelay(t *testing.T) {
+	abstractConnWriteDelayTest(t, "http+poll")
+	abstractConnWriteDelayTest(t, "http+sse")
+}
+
+func TestHTTPConnSendContext(t *testing.T) {
+	abstractConnSendContextTest(t, "http+poll")
+	abstractConnSendContextTest(t, "http+sse")
+}
+
+func TestHTTPConnReceiveContext(t *testing.T) {
+	abstractConnReceiveContextTest(t, "http+poll")
+	abstractConnReceiveContextTest(t, "http+sse")
+}
+
+func TestHTTPConnPacketStats(t *testing.T) {
+	abstractConnPacketStatsTest(t, "http+poll")
+	abstractConnPacketStatsTest(t, "http+sse")
+}
+
+func TestHTTPConnWireStats(t *testing.T) {
+	abstractConnWireStatsTest(t, "http+poll", false, false)
+}
+
+func TestHTTPConnStreamedPayload(t *testing.T) {
+	abstractConnStreamedPayloadTest(t, "http+poll")
+	abstractConnStreamedPayloadTest(t, "http+sse")
+}
+
+func TestHTTPConnInterner(t *testing.T) {
+	abstractConnInternerTest(t, "http+poll")
+	abstractConnInternerTest(t, "http+sse")
+}
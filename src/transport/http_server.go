@@ -0,0 +1,458 @@
+package transport
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/tomb.v2"
+)
+
+// httpSession is the server side carrier of an HTTP bridge session
+type httpSession struct {
+	*chunkQueue
+
+	downstream chan []byte
+	closed     chan struct{}
+	closeOnce  sync.Once
+	remove     func()
+
+	requests int32
+	lastSeen int64
+}
+
+func newHTTPSession(remove func()) *httpSession {
+	return &httpSession{
+		chunkQueue: newChunkQueue(),
+		downstream: make(chan []byte, 16),
+		closed:     make(chan struct{}),
+		remove:     remove,
+		lastSeen:   time.Now().UnixNano(),
+	}
+}
+
+// marks the start of a request of the session
+func (s *httpSession) begin() {
+	atomic.AddInt32(&s.requests, 1)
+	atomic.StoreInt64(&s.lastSeen, time.Now().UnixNano())
+}
+
+// marks the end of a request of the session
+func (s *httpSession) end() {
+	atomic.StoreInt64(&s.lastSeen, time.Now().UnixNano())
+	atomic.AddInt32(&s.requests, -1)
+}
+
+// returns whether the session has no running request and the last one ended
+// more than the timeout ago
+func (s *httpSession) idle(now time.Time, timeout time.Duration) bool {
+	if atomic.LoadInt32(&s.requests) > 0 {
+		return false
+	}
+
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastSeen))) > timeout
+}
+
+func (s *httpSession) Write(p []byte) (int, error) {
+	// check if closed
+	select {
+	case <-s.closed:
+		return 0, ErrHTTPSessionClosed
+	default:
+	}
+
+	// the buffer might be reused by the caller
+	chunk := make([]byte, len(p))
+	copy(chunk, p)
+
+	select {
+	case s.downstream <- chunk:
+		return len(p), nil
+	case <-s.closed:
+		return 0, ErrHTTPSessionClosed
+	}
+}
+
+func (s *httpSession) Close() error {
+	err := ErrHTTPSessionClosed
+
+	s.closeOnce.Do(func() {
+		err = nil
+
+		s.close(io.EOF)
+		close(s.closed)
+		s.remove()
+	})
+
+	return err
+}
+
+// returns the next downstream chunk or nil if the session has been closed and
+// all pending chunks have been delivered
+func (s *httpSession) next(timeout <-chan time.Time, dying <-chan struct{}) ([]byte, bool) {
+	// prefer pending chunks over a close
+	select {
+	case chunk := <-s.downstream:
+		return chunk, true
+	default:
+	}
+
+	select {
+	case chunk := <-s.downstream:
+		return chunk, true
+	case <-s.closed:
+		// deliver chunks that raced with the close
+		select {
+		case chunk := <-s.downstream:
+			return chunk, true
+		default:
+			return nil, false
+		}
+	case <-timeout:
+		return nil, true
+	case <-dying:
+		return nil, false
+	}
+}
+
+// The HTTPServer accepts HTTPConn based connections. It exposes the endpoints
+// of the HTTP bridge below any path and serves both long-polling and
+// Server-Sent Events clients.
+type HTTPServer struct {
+	// PollTimeout is the time a long-poll request is held open if no data is
+	// available. It also sets the interval of keep-alive comments sent on
+	// event streams.
+	PollTimeout time.Duration
+
+	// SessionTimeout is the time a closed session remains available so that
+	// the other side can fetch the remaining data.
+	SessionTimeout time.Duration
+
+	// IdleTimeout is the time after which a session without any running or
+	// new request is considered abandoned, closed and removed. Sessions are
+	// not expired if zero.
+	IdleTimeout time.Duration
+
+	listener net.Listener
+	incoming chan *HTTPConn
+
+	sessions map[string]*httpSession
+	mutex    sync.Mutex
+
+	tomb tomb.Tomb
+}
+
+func newHTTPServer(listener net.Listener) *HTTPServer {
+	return &HTTPServer{
+		PollTimeout:    20 * time.Second,
+		SessionTimeout: 60 * time.Second,
+		IdleTimeout:    60 * time.Second,
+		listener:       listener,
+		incoming:       make(chan *HTTPConn),
+		sessions:       make(map[string]*httpSession),
+	}
+}
+
+// NewHTTPServer creates a new HTTP bridge server that listens on the provided
+// address.
+func NewHTTPServer(address string) (*HTTPServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newHTTPServer(listener)
+	s.serveHTTP()
+
+	return s, nil
+}
+
+// NewSecureHTTPServer creates a new HTTPS bridge server that listens on the
+// provided address.
+func NewSecureHTTPServer(address string, config *tls.Config) (*HTTPServer, error) {
+	listener, err := tls.Listen("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newHTTPServer(listener)
+	s.serveHTTP()
+
+	return s, nil
+}
+
+func (s *HTTPServer) serveHTTP() {
+	h := &http.Server{
+		Handler: http.HandlerFunc(s.requestHandler),
+	}
+
+	s.tomb.Go(func() error {
+		err := h.Serve(s.listener)
+
+		// Server will always return an error
+		return err
+	})
+
+	s.tomb.Go(s.expirer)
+}
+
+// expirer closes and removes abandoned sessions
+func (s *HTTPServer) expirer() error {
+	for {
+		interval := s.IdleTimeout / 2
+		if interval <= 0 {
+			interval = time.Second
+		}
+
+		select {
+		case <-s.tomb.Dying():
+			return tomb.ErrDying
+		case <-time.After(interval):
+		}
+
+		if s.IdleTimeout <= 0 {
+			continue
+		}
+
+		// collect and remove idle sessions
+		now := time.Now()
+		var idle []*httpSession
+		s.mutex.Lock()
+		for id, session := range s.sessions {
+			if session.idle(now, s.IdleTimeout) {
+				idle = append(idle, session)
+				delete(s.sessions, id)
+			}
+		}
+		s.mutex.Unlock()
+
+		for _, session := range idle {
+			session.Close()
+		}
+	}
+}
+
+func (s *HTTPServer) requestHandler(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+
+	// handle connect
+	if segments[len(segments)-1] == "connect" {
+		s.handleConnect(w, r)
+		return
+	}
+
+	// check path
+	if len(segments) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// get session
+	s.mutex.Lock()
+	session, ok := s.sessions[segments[len(segments)-2]]
+	s.mutex.Unlock()
+	if !ok {
+		http.Error(w, ErrHTTPSessionClosed.Error(), http.StatusGone)
+		return
+	}
+
+	// keep session alive
+	session.begin()
+	defer session.end()
+
+	switch segments[len(segments)-1] {
+	case "send":
+		s.handleSend(w, r, session)
+	case "poll":
+		s.handlePoll(w, r, session)
+	case "events":
+		s.handleEvents(w, r, session)
+	case "close":
+		session.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *HTTPServer) handleConnect(w http.ResponseWriter, r *http.Request) {
+	// check method
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// generate id
+	var buf [16]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id := hex.EncodeToString(buf[:])
+
+	// create session, closed sessions are kept around for a while so that
+	// the client can drain the remaining data
+	session := newHTTPSession(func() {
+		time.AfterFunc(s.SessionTimeout, func() {
+			s.mutex.Lock()
+			delete(s.sessions, id)
+			s.mutex.Unlock()
+		})
+	})
+
+	// get remote address
+	remoteAddr, _ := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+
+	conn := &HTTPConn{
+		BaseConn:   *NewBaseConn(session),
+		stream:     session,
+		localAddr:  s.listener.Addr(),
+		remoteAddr: remoteAddr,
+	}
+
+	conn.setOwner(conn)
+
+	select {
+	case s.incoming <- conn:
+	case <-s.tomb.Dying():
+		http.Error(w, ErrAcceptAfterClose.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	s.mutex.Lock()
+	s.sessions[id] = session
+	s.mutex.Unlock()
+
+	io.WriteString(w, id)
+}
+
+func (s *HTTPServer) handleSend(w http.ResponseWriter, r *http.Request, session *httpSession) {
+	// check method
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// queue data, blocks if the reader is behind
+	err = session.push(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HTTPServer) handlePoll(w http.ResponseWriter, r *http.Request, session *httpSession) {
+	timer := time.NewTimer(s.PollTimeout)
+	defer timer.Stop()
+
+	chunk, ok := session.next(timer.C, s.tomb.Dying())
+	if !ok {
+		http.Error(w, ErrHTTPSessionClosed.Error(), http.StatusGone)
+		return
+	} else if chunk == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// append all pending chunks
+	for len(session.downstream) > 0 {
+		chunk = append(chunk, <-session.downstream...)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(chunk)
+}
+
+func (s *HTTPServer) handleEvents(w http.ResponseWriter, r *http.Request, session *httpSession) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(s.PollTimeout)
+	defer ticker.Stop()
+
+	for {
+		chunk, ok := session.next(ticker.C, s.tomb.Dying())
+		if !ok {
+			return
+		}
+
+		var err error
+		if chunk == nil {
+			_, err = io.WriteString(w, ": ping\n\n")
+		} else {
+			_, err = io.WriteString(w, "data: "+base64.StdEncoding.EncodeToString(chunk)+"\n\n")
+		}
+
+		// close session if the client went away
+		if err != nil {
+			session.Close()
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// Accept will return the next available connection or block until a
+// connection becomes available, otherwise returns an Error.
+func (s *HTTPServer) Accept() (Conn, error) {
+	select {
+	case <-s.tomb.Dying():
+		if s.tomb.Err() == errManualClose {
+			// server has been closed manually
+			return nil, ErrAcceptAfterClose
+		}
+
+		// return the previously caught error
+		return nil, s.tomb.Err()
+	case conn := <-s.incoming:
+		return conn, nil
+	}
+}
+
+// Close will close the underlying listener and cleanup resources. It will
+// return an Error if the underlying listener didn't close cleanly.
+func (s *HTTPServer) Close() error {
+	s.tomb.Kill(errManualClose)
+
+	err := s.listener.Close()
+	s.tomb.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Addr returns the server's network address.
+func (s *HTTPServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
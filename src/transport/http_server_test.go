@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServerIdleTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	server := newHTTPServer(listener)
+	server.IdleTimeout = 50 * time.Millisecond
+	server.serveHTTP()
+
+	url := "http://" + listener.Addr().String() + "/mqtt/"
+
+	// open a session and abandon it
+	go func() {
+		resp, err := http.Post(url+"connect", "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}()
+
+	conn, err := server.Accept()
+	require.NoError(t, err)
+
+	// the session is closed and removed
+	pkt, err := conn.Receive()
+	assert.Nil(t, pkt)
+	assert.Equal(t, io.EOF, err)
+
+	server.mutex.Lock()
+	assert.Empty(t, server.sessions)
+	server.mutex.Unlock()
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestHTTPServerIdleTimeoutPoll(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	server := newHTTPServer(listener)
+	server.PollTimeout = 200 * time.Millisecond
+	server.IdleTimeout = 50 * time.Millisecond
+	server.serveHTTP()
+
+	url := "http://" + listener.Addr().String() + "/mqtt/"
+
+	ids := make(chan string, 1)
+	go func() {
+		resp, err := http.Post(url+"connect", "", nil)
+		require.NoError(t, err)
+		id, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		ids <- string(id)
+	}()
+
+	_, err = server.Accept()
+	require.NoError(t, err)
+
+	// a running poll keeps the session alive
+	resp, err := http.Get(url + <-ids + "/poll")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
@@ -2,12 +2,41 @@ package transport
 
 import (
 	"crypto/tls"
+	"net"
 	"net/url"
+	"strconv"
+	"sync"
 )
 
+// the schemes of servers that can adopt a listener
+var adoptingSchemes = map[string]bool{
+	"tcp": true, "mqtt": true, "tls": true, "mqtts": true, "ws": true, "wss": true,
+	"http": true, "http+poll": true, "http+sse": true,
+	"https": true, "https+poll": true, "https+sse": true,
+}
+
+// the schemes that require certificates
+var secureSchemes = map[string]bool{
+	"tls": true, "mqtts": true, "wss": true, "https": true, "https+poll": true, "https+sse": true,
+}
+
 // The Launcher helps with launching a server and accepting connections.
 type Launcher struct {
 	TLSConfig *tls.Config
+
+	// The handler attached to accepted connections. Connections are not
+	// observed if no handler is set.
+	StatsHandler StatsHandler
+
+	// Listeners that have been opened in advance, e.g. by a service manager
+	// using socket activation (see ActivationListeners). A TCP based server
+	// adopts the listener with the port of its URL and a matching or
+	// unspecified host instead of listening itself. Adopted listeners are
+	// removed from the list. This allows restarting a scripted broker without
+	// dropping the listening socket.
+	Listeners []net.Listener
+
+	mutex sync.Mutex
 }
 
 // NewLauncher returns a new Launcher.
@@ -28,11 +57,39 @@ func Launch(urlString string) (Server, error) {
 
 // Launch will launch a server based on information extracted from an URL.
 func (l *Launcher) Launch(urlString string) (Server, error) {
+	server, err := l.launch(urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	// attach handler
+	if l.StatsHandler != nil {
+		return &statsServer{Server: server, handler: l.StatsHandler}, nil
+	}
+
+	return server, nil
+}
+
+// launch creates the server for the url
+func (l *Launcher) launch(urlString string) (Server, error) {
 	urlParts, err := url.ParseRequestURI(urlString)
 	if err != nil {
 		return nil, err
 	}
 
+	// secure schemes fail without certificates before a listener is adopted
+	if secureSchemes[urlParts.Scheme] {
+		err = checkTLSConfig(l.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// adopt a listener opened in advance
+	if listener := l.adopt(urlParts.Scheme, urlParts.Host); listener != nil {
+		return l.serve(urlParts.Scheme, listener), nil
+	}
+
 	switch urlParts.Scheme {
 	case "tcp", "mqtt":
 		return NewNetServer(urlParts.Host)
@@ -42,7 +99,81 @@ func (l *Launcher) Launch(urlString string) (Server, error) {
 		return NewWebSocketServer(urlParts.Host)
 	case "wss":
 		return NewSecureWebSocketServer(urlParts.Host, l.TLSConfig)
+	case "http", "http+poll", "http+sse":
+		return NewHTTPServer(urlParts.Host)
+	case "https", "https+poll", "https+sse":
+		return NewSecureHTTPServer(urlParts.Host, l.TLSConfig)
+	case "npipe":
+		path, err := PipePath(urlParts)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewPipeServer(path)
 	}
 
 	return nil, ErrUnsupportedProtocol
 }
+
+// adopt removes and returns the listener matching the address
+func (l *Launcher) adopt(scheme, address string) net.Listener {
+	if !adoptingSchemes[scheme] {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i, listener := range l.Listeners {
+		addr, ok := listener.Addr().(*net.TCPAddr)
+		if !ok || strconv.Itoa(addr.Port) != port {
+			continue
+		}
+
+		// host names only match by port
+		if ip == nil || ip.IsUnspecified() || addr.IP.IsUnspecified() || ip.Equal(addr.IP) {
+			l.Listeners = append(l.Listeners[:i:i], l.Listeners[i+1:]...)
+			return listener
+		}
+	}
+
+	return nil
+}
+
+// serve creates the server for an adopted listener
+func (l *Launcher) serve(scheme string, listener net.Listener) Server {
+	switch scheme {
+	case "tls", "mqtts":
+		return &NetServer{
+			listener: listener,
+			config:   l.TLSConfig,
+		}
+	case "ws":
+		s := newWebSocketServer(listener, nil)
+		s.serveHTTP()
+		return s
+	case "wss":
+		s := newWebSocketServer(listener, l.TLSConfig)
+		s.serveHTTP()
+		return s
+	case "http", "http+poll", "http+sse":
+		s := newHTTPServer(listener)
+		s.serveHTTP()
+		return s
+	case "https", "https+poll", "https+sse":
+		s := newHTTPServer(tls.NewListener(listener, l.TLSConfig))
+		s.serveHTTP()
+		return s
+	}
+
+	return &NetServer{
+		listener: listener,
+	}
+}
@@ -1,6 +1,9 @@
 package transport
 
 import (
+	"net"
+	"os"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,3 +29,122 @@ func TestLauncherUnsupportedProtocol(t *testing.T) {
 	assert.Nil(t, conn)
 	assert.Equal(t, ErrUnsupportedProtocol, err)
 }
+
+func TestLauncherAdoptListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer other.Close()
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	launcher := NewLauncher()
+	launcher.Listeners = []net.Listener{other, listener}
+
+	server, err := launcher.Launch("tcp://0.0.0.0:" + port)
+	require.NoError(t, err)
+	assert.Equal(t, listener.Addr(), server.Addr())
+	assert.Equal(t, []net.Listener{other}, launcher.Listeners)
+
+	done := make(chan struct{})
+	go func() {
+		conn, err := server.Accept()
+		assert.NoError(t, err)
+		assert.NotNil(t, conn)
+		close(done)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	<-done
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestLauncherAdoptListenerMismatch(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	launcher := NewLauncher()
+	launcher.Listeners = []net.Listener{listener}
+
+	// different host
+	server, err := launcher.Launch("tcp://127.0.0.2:" + port)
+	require.NoError(t, err)
+	assert.NotEqual(t, listener.Addr(), server.Addr())
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	// unsupported scheme
+	assert.Nil(t, launcher.adopt("npipe", "127.0.0.1:"+port))
+
+	assert.Len(t, launcher.Listeners, 1)
+}
+
+func TestLauncherAdoptWebSocketListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	launcher := NewLauncher()
+	launcher.Listeners = []net.Listener{listener}
+
+	server, err := launcher.Launch("ws://localhost:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port))
+	require.NoError(t, err)
+	_, ok := server.(*WebSocketServer)
+	assert.True(t, ok)
+	assert.Empty(t, launcher.Listeners)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestLauncherAdoptSecureListenerWithoutCertificates(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	launcher := NewLauncher()
+	launcher.Listeners = []net.Listener{listener}
+
+	for _, scheme := range []string{"tls", "mqtts", "wss", "https"} {
+		server, err := launcher.Launch(scheme + "://127.0.0.1:" + port)
+		assert.Nil(t, server, scheme)
+		assert.Equal(t, errMissingCertificate, err, scheme)
+	}
+
+	assert.Len(t, launcher.Listeners, 1)
+}
+
+func TestActivationListeners(t *testing.T) {
+	// not activated
+	listeners, err := ActivationListeners()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	// other process
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	listeners, err = ActivationListeners()
+	assert.NoError(t, err)
+	assert.Empty(t, listeners)
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	// invalid count
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "foo")
+	listeners, err = ActivationListeners()
+	assert.Equal(t, ErrInvalidActivation, err)
+	assert.Empty(t, listeners)
+	assert.Empty(t, os.Getenv("LISTEN_PID"))
+}
@@ -1,6 +1,9 @@
 package transport
 
-import "net"
+import (
+	"crypto/tls"
+	"net"
+)
 
 // A NetConn is a wrapper around a basic TCP connection.
 type NetConn struct {
@@ -11,10 +14,18 @@ type NetConn struct {
 
 // NewNetConn returns a new NetConn.
 func NewNetConn(conn net.Conn) *NetConn {
-	return &NetConn{
+	c := &NetConn{
 		BaseConn: *NewBaseConn(conn),
 		conn:     conn,
 	}
+
+	c.setOwner(c)
+
+	// the bytes of a plain connection are the bytes on the wire
+	_, secure := conn.(*tls.Conn)
+	c.plain = !secure
+
+	return c
 }
 
 // LocalAddr returns the local network address.
@@ -31,3 +42,12 @@ func (c *NetConn) RemoteAddr() net.Addr {
 func (c *NetConn) UnderlyingConn() net.Conn {
 	return c.conn
 }
+
+// Pipe returns two connected in-memory connections. Packets sent on one
+// connection are encoded and received on the other, which allows measuring
+// the overhead of the transport without a network.
+func Pipe() (*NetConn, *NetConn) {
+	a, b := net.Pipe()
+
+	return NewNetConn(a), NewNetConn(b)
+}
@@ -32,6 +32,10 @@ func TestNetConnCloseWhileSend(t *testing.T) {
 	abstractConnCloseWhileSendTest(t, "tcp")
 }
 
+func TestNetConnCloseWhileBlocked(t *testing.T) {
+	abstractConnCloseWhileBlockedTest(t, "tcp")
+}
+
 func TestNetConnSendAndCloseTest(t *testing.T) {
 	abstractConnSendAndCloseTest(t, "tcp")
 }
@@ -72,6 +76,43 @@ func TestNetConnBigBufferedSendAfterClose(t *testing.T) {
 	abstractConnBigBufferedSendAfterCloseTest(t, "tcp")
 }
 
+func TestNetConnReadBatch(t *testing.T) {
+	abstractConnReadBatchTest(t, "tcp")
+}
+
+func TestNetConnFlush(t *testing.T) {
+	abstractConnFlushTest(t, "tcp")
+}
+
+func TestNetConnWriteDelay(t *testing.T) {
+	abstractConnWriteDelayTest(t, "tcp")
+}
+
+func TestNetConnSendContext(t *testing.T) {
+	abstractConnSendContextTest(t, "tcp")
+}
+
+func TestNetConnReceiveContext(t *testing.T) {
+	abstractConnReceiveContextTest(t, "tcp")
+}
+
+func TestNetConnInterner(t *testing.T) {
+	abstractConnInternerTest(t, "tcp")
+}
+
+func TestNetConnPacketStats(t *testing.T) {
+	abstractConnPacketStatsTest(t, "tcp")
+}
+
+func TestNetConnWireStats(t *testing.T) {
+	abstractConnWireStatsTest(t, "tcp", false, true)
+	abstractConnWireStatsTest(t, "tls", true, true)
+}
+
+func TestNetConnStreamedPayload(t *testing.T) {
+	abstractConnStreamedPayloadTest(t, "tcp")
+}
+
 func TestNetConnCloseWhileReadError(t *testing.T) {
 	conn2, done := connectionPair("tcp", func(conn1 Conn) {
 		pkt := packet.NewPublishPacket()
@@ -186,3 +227,29 @@ func BenchmarkNetConnBuffered(b *testing.B) {
 
 	safeReceive(done)
 }
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe()
+
+	go func() {
+		pkt, err := b.Receive()
+		assert.NoError(t, err)
+		assert.NoError(t, b.Send(pkt))
+	}()
+
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("hello")
+
+	err := a.Send(publish)
+	assert.NoError(t, err)
+
+	pkt, err := a.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, publish.String(), pkt.String())
+
+	assert.NoError(t, a.Close())
+
+	_, err = b.Receive()
+	assert.Error(t, err)
+}
@@ -8,6 +8,9 @@ import (
 // A NetServer accepts net.Conn based connections.
 type NetServer struct {
 	listener net.Listener
+
+	// the config of TLS servers
+	config *tls.Config
 }
 
 // NewNetServer creates a new TCP server that listens on the provided address.
@@ -24,13 +27,20 @@ func NewNetServer(address string) (*NetServer, error) {
 
 // NewSecureNetServer creates a new TLS server that listens on the provided address.
 func NewSecureNetServer(address string, config *tls.Config) (*NetServer, error) {
-	listener, err := tls.Listen("tcp", address, config)
+	err := checkTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshake is run on the counted connection
+	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
 	return &NetServer{
 		listener: listener,
+		config:   config,
 	}, nil
 }
 
@@ -42,7 +52,15 @@ func (s *NetServer) Accept() (Conn, error) {
 		return nil, err
 	}
 
-	return NewNetConn(conn), nil
+	if s.config == nil {
+		return NewNetConn(conn), nil
+	}
+
+	wire := newWireConn(conn)
+	c := NewNetConn(tls.Server(wire, s.config))
+	c.setWire(wire)
+
+	return c, nil
 }
 
 // Close will close the underlying listener and cleanup resources. It will
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNamedPipesUnsupported is returned by the dialer and launcher for npipe://
+// URLs on platforms other than Windows.
+var ErrNamedPipesUnsupported = errors.New("named pipes are only supported on windows")
+
+// ErrInvalidPipeName is returned for npipe:// URLs without a pipe name.
+var ErrInvalidPipeName = errors.New("invalid pipe name")
+
+// the time a dial waits for a busy pipe to accept another client
+const pipeBusyTimeout = 5 * time.Second
+
+// PipePath returns the Windows path of the named pipe addressed by the URL.
+// The host selects the server and defaults to the local machine, the path is
+// the name of the pipe, e.g. "npipe:///mqtt" is "\\.\pipe\mqtt" and
+// "npipe://broker/mqtt/1" is "\\broker\pipe\mqtt\1".
+func PipePath(u *url.URL) (string, error) {
+	// get name
+	name := strings.Trim(u.Path, "/")
+	if name == "" {
+		return "", ErrInvalidPipeName
+	}
+
+	// get server
+	server := u.Host
+	if server == "" {
+		server = "."
+	}
+
+	return `\\` + server + `\pipe\` + strings.Replace(name, "/", `\`, -1), nil
+}
+
+// NewPipeServer creates a new server that accepts connections on the named
+// pipe with the specified path. It is only supported on Windows.
+func NewPipeServer(path string) (*NetServer, error) {
+	listener, err := listenPipe(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetServer{
+		listener: listener,
+	}, nil
+}
+
+// DialPipe connects to the named pipe with the specified path and waits up to
+// five seconds if all instances of the pipe are busy. It is only supported on
+// Windows.
+func DialPipe(path string) (*NetConn, error) {
+	conn, err := dialPipe(path, pipeBusyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNetConn(conn), nil
+}
+
+// A pipeAddr is the address of a named pipe.
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
+
+var _ net.Addr = pipeAddr("")
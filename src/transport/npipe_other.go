@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package transport
+
+import (
+	"net"
+	"time"
+)
+
+func listenPipe(path string) (net.Listener, error) {
+	return nil, ErrNamedPipesUnsupported
+}
+
+func dialPipe(path string, timeout time.Duration) (net.Conn, error) {
+	return nil, ErrNamedPipesUnsupported
+}
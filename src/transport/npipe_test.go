@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"net/url"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipePath(t *testing.T) {
+	for str, path := range map[string]string{
+		"npipe:///mqtt":          `\\.\pipe\mqtt`,
+		"npipe://./mqtt":         `\\.\pipe\mqtt`,
+		"npipe://broker/mqtt":    `\\broker\pipe\mqtt`,
+		"npipe:///mqtt/broker/1": `\\.\pipe\mqtt\broker\1`,
+	} {
+		u, err := url.Parse(str)
+		require.NoError(t, err)
+
+		p, err := PipePath(u)
+		assert.NoError(t, err, str)
+		assert.Equal(t, path, p, str)
+	}
+}
+
+func TestPipePathInvalid(t *testing.T) {
+	for _, str := range []string{"npipe://", "npipe:///", "npipe://broker/"} {
+		u, err := url.Parse(str)
+		require.NoError(t, err)
+
+		_, err = PipePath(u)
+		assert.Equal(t, ErrInvalidPipeName, err, str)
+	}
+}
+
+func TestPipeUnsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are supported")
+	}
+
+	_, err := Dial("npipe:///mqtt")
+	assert.Equal(t, ErrNamedPipesUnsupported, err)
+
+	_, err = Launch("npipe:///mqtt")
+	assert.Equal(t, ErrNamedPipesUnsupported, err)
+}
@@ -0,0 +1,552 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	kernel32                   = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW       = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe       = kernel32.NewProc("ConnectNamedPipe")
+	procWaitNamedPipeW         = kernel32.NewProc("WaitNamedPipeW")
+	procCreateEventW           = kernel32.NewProc("CreateEventW")
+	procSetEvent               = kernel32.NewProc("SetEvent")
+	procResetEvent             = kernel32.NewProc("ResetEvent")
+	procWaitForMultipleObjects = kernel32.NewProc("WaitForMultipleObjects")
+	procGetOverlapped          = kernel32.NewProc("GetOverlappedResult")
+)
+
+const (
+	pipeAccessDuplex       = 0x3
+	pipeFirstInstance      = 0x80000
+	pipeUnlimitedInstances = 255
+	pipeBufferSize         = 64 * 1024
+	fileFlagOverlapped     = 0x40000000
+	waitObject0            = 0
+	errorPipeBusy          = syscall.Errno(231)
+	errorNoData            = syscall.Errno(232)
+	errorPipeNotConnected  = syscall.Errno(233)
+	errorPipeConnected     = syscall.Errno(535)
+)
+
+// createPipe creates a new overlapped byte mode instance of the named pipe
+func createPipe(path string, first bool) (syscall.Handle, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return syscall.InvalidHandle, err
+	}
+
+	mode := uint32(pipeAccessDuplex | fileFlagOverlapped)
+	if first {
+		mode |= pipeFirstInstance
+	}
+
+	h, _, err := procCreateNamedPipeW.Call(uintptr(unsafe.Pointer(name)), uintptr(mode), 0,
+		pipeUnlimitedInstances, pipeBufferSize, pipeBufferSize, 0, 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return syscall.InvalidHandle, &net.OpError{Op: "listen", Net: "pipe", Addr: pipeAddr(path), Err: err}
+	}
+
+	return syscall.Handle(h), nil
+}
+
+// newEvent creates a manual reset event that is not signaled
+func newEvent() (syscall.Handle, error) {
+	r, _, err := procCreateEventW.Call(0, 1, 0, 0)
+	if r == 0 {
+		return syscall.InvalidHandle, err
+	}
+
+	return syscall.Handle(r), nil
+}
+
+func setEvent(h syscall.Handle) {
+	procSetEvent.Call(uintptr(h))
+}
+
+func resetEvent(h syscall.Handle) {
+	procResetEvent.Call(uintptr(h))
+}
+
+// overlapped runs an overlapped operation that signals the event on completion
+// and waits until it completes or one of the cancel events is signaled. A
+// canceled operation is awaited as well, so the overlapped structure and the
+// buffer are never used by the system after the call returns.
+func overlapped(h, event syscall.Handle, cancel []syscall.Handle, fn func(ov *syscall.Overlapped) error) (uint32, error) {
+	resetEvent(event)
+	ov := &syscall.Overlapped{HEvent: event}
+
+	// start operation
+	err := fn(ov)
+	if err != nil && err != syscall.ERROR_IO_PENDING {
+		return 0, err
+	}
+
+	// wait for the completion or a cancellation
+	handles := append([]syscall.Handle{event}, cancel...)
+	r, _, _ := procWaitForMultipleObjects.Call(uintptr(len(handles)), uintptr(unsafe.Pointer(&handles[0])),
+		0, syscall.INFINITE)
+	if r != waitObject0 {
+		syscall.CancelIoEx(h, ov)
+	}
+
+	// get the result, which is immediately available after a cancellation
+	var n uint32
+	r, _, err = procGetOverlapped.Call(uintptr(h), uintptr(unsafe.Pointer(ov)), uintptr(unsafe.Pointer(&n)), 1)
+	if r == 0 {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// A pipeListener accepts connections on a named pipe.
+type pipeListener struct {
+	path   string
+	handle syscall.Handle
+	event  syscall.Handle
+	closer syscall.Handle
+	closed int32
+	once   sync.Once
+	mutex  sync.Mutex
+}
+
+func listenPipe(path string) (net.Listener, error) {
+	// create the first instance to claim the name
+	h, err := createPipe(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// create events
+	event, err := newEvent()
+	if err != nil {
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+
+	closer, err := newEvent()
+	if err != nil {
+		syscall.CloseHandle(event)
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+
+	return &pipeListener{
+		path:   path,
+		handle: h,
+		event:  event,
+		closer: closer,
+	}, nil
+}
+
+// Accept waits for a client to connect to the current instance of the pipe and
+// creates the next instance for the following client.
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for {
+		// check state
+		if atomic.LoadInt32(&l.closed) == 1 {
+			return nil, l.error(net.ErrClosed)
+		}
+
+		// wait for a client
+		h := l.handle
+		_, err := overlapped(h, l.event, []syscall.Handle{l.closer}, func(ov *syscall.Overlapped) error {
+			r, _, err := procConnectNamedPipe.Call(uintptr(h), uintptr(unsafe.Pointer(ov)))
+			if r != 0 {
+				return nil
+			}
+
+			return err
+		})
+		if err == errorPipeConnected {
+			err = nil
+		}
+
+		if err != nil && err != errorNoData {
+			if atomic.LoadInt32(&l.closed) == 1 {
+				err = net.ErrClosed
+			}
+
+			return nil, l.error(err)
+		}
+
+		// create next instance, the listener fails without one
+		next, nerr := createPipe(l.path, false)
+		if nerr != nil {
+			syscall.CloseHandle(h)
+			l.handle = syscall.InvalidHandle
+			return nil, nerr
+		}
+
+		l.handle = next
+
+		// skip clients that disconnected before they were accepted
+		if err == errorNoData {
+			syscall.CloseHandle(h)
+			continue
+		}
+
+		conn, err := newPipeConn(h, l.path)
+		if err != nil {
+			return nil, l.error(err)
+		}
+
+		return conn, nil
+	}
+}
+
+// Close will cancel a pending Accept and close the current instance once it
+// returned.
+func (l *pipeListener) Close() error {
+	err := l.error(net.ErrClosed)
+	l.once.Do(func() {
+		atomic.StoreInt32(&l.closed, 1)
+		setEvent(l.closer)
+
+		// wait for a pending accept to return
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		err = nil
+		if l.handle != syscall.InvalidHandle {
+			err = syscall.CloseHandle(l.handle)
+		}
+
+		syscall.CloseHandle(l.event)
+		syscall.CloseHandle(l.closer)
+	})
+
+	return err
+}
+
+// Addr returns the path of the pipe.
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+func (l *pipeListener) error(err error) error {
+	return &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.path), Err: err}
+}
+
+func dialPipe(path string, timeout time.Duration) (net.Conn, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		// open pipe
+		h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+			syscall.OPEN_EXISTING, fileFlagOverlapped, 0)
+		if err == nil {
+			conn, err := newPipeConn(h, path)
+			if err != nil {
+				return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr(path), Err: err}
+			}
+
+			return conn, nil
+		} else if err != errorPipeBusy || time.Now().After(deadline) {
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr(path), Err: err}
+		}
+
+		// wait for a free instance
+		ms := time.Until(deadline) / time.Millisecond
+		if ms < 1 {
+			ms = 1
+		}
+
+		procWaitNamedPipeW.Call(uintptr(unsafe.Pointer(name)), uintptr(ms))
+	}
+}
+
+// A pipeDeadline signals its event when the deadline is exceeded.
+type pipeDeadline struct {
+	event    syscall.Handle
+	timer    *time.Timer
+	version  uint64
+	exceeded bool
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func newPipeDeadline() (*pipeDeadline, error) {
+	event, err := newEvent()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeDeadline{
+		event: event,
+	}, nil
+}
+
+func (d *pipeDeadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	// stop the timer, a timer that already fired is ignored by its version
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+
+	d.version++
+	d.exceeded = false
+	resetEvent(d.event)
+
+	if t.IsZero() {
+		return
+	}
+
+	// signal immediately if in the past
+	wait := time.Until(t)
+	if wait <= 0 {
+		d.exceed()
+		return
+	}
+
+	version := d.version
+	d.timer = time.AfterFunc(wait, func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		if d.version == version && !d.closed {
+			d.exceed()
+		}
+	})
+}
+
+// exceed signals the event, the mutex must be held
+func (d *pipeDeadline) exceed() {
+	d.exceeded = true
+	setEvent(d.event)
+}
+
+func (d *pipeDeadline) isExceeded() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.exceeded
+}
+
+func (d *pipeDeadline) close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	d.closed = true
+	syscall.CloseHandle(d.event)
+}
+
+// A pipeConn is a connection over an instance of a named pipe. Reads and
+// writes wait for their completion, the close event or their deadline event
+// without additional goroutines.
+type pipeConn struct {
+	handle syscall.Handle
+	path   string
+
+	read       *pipeDeadline
+	write      *pipeDeadline
+	readEvent  syscall.Handle
+	writeEvent syscall.Handle
+	closer     syscall.Handle
+
+	rMutex sync.Mutex
+	wMutex sync.Mutex
+
+	// held for reading by operations, Close waits for them before the
+	// handles are released
+	active sync.RWMutex
+	closed int32
+	once   sync.Once
+}
+
+// newPipeConn returns a connection over the pipe instance, which is closed if
+// the connection cannot be created
+func newPipeConn(h syscall.Handle, path string) (*pipeConn, error) {
+	c := &pipeConn{
+		handle: h,
+		path:   path,
+	}
+
+	// create events and deadlines
+	var err error
+	for _, event := range []*syscall.Handle{&c.readEvent, &c.writeEvent, &c.closer} {
+		h, err := newEvent()
+		if err != nil {
+			c.release()
+			return nil, err
+		}
+
+		*event = h
+	}
+
+	c.read, err = newPipeDeadline()
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+
+	c.write, err = newPipeDeadline()
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// do runs an overlapped operation that is canceled by the deadline or close
+func (c *pipeConn) do(op string, mutex *sync.Mutex, event syscall.Handle, deadline *pipeDeadline,
+	fn func(ov *syscall.Overlapped) error) (int, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	c.active.RLock()
+	defer c.active.RUnlock()
+
+	// check state
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return 0, c.error(op, net.ErrClosed)
+	} else if deadline.isExceeded() {
+		return 0, c.error(op, os.ErrDeadlineExceeded)
+	}
+
+	n, err := overlapped(c.handle, event, []syscall.Handle{c.closer, deadline.event}, fn)
+	if err == nil {
+		return int(n), nil
+	}
+
+	// translate error
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return int(n), c.error(op, net.ErrClosed)
+	} else if deadline.isExceeded() {
+		return int(n), c.error(op, os.ErrDeadlineExceeded)
+	}
+
+	switch err {
+	case syscall.ERROR_BROKEN_PIPE, errorNoData, errorPipeNotConnected:
+		if op == "read" {
+			return int(n), io.EOF
+		}
+
+		return int(n), c.error(op, syscall.EPIPE)
+	}
+
+	return int(n), c.error(op, err)
+}
+
+func (c *pipeConn) error(op string, err error) error {
+	return &net.OpError{Op: op, Net: "pipe", Addr: pipeAddr(c.path), Err: err}
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	return c.do("read", &c.rMutex, c.readEvent, c.read, func(ov *syscall.Overlapped) error {
+		var n uint32
+		return syscall.ReadFile(c.handle, b, &n, ov)
+	})
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		n, err := c.do("write", &c.wMutex, c.writeEvent, c.write, func(ov *syscall.Overlapped) error {
+			var n uint32
+			return syscall.WriteFile(c.handle, b[total:], &n, ov)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// Close cancels pending operations and releases the handles once they
+// returned.
+func (c *pipeConn) Close() error {
+	err := c.error("close", net.ErrClosed)
+	c.once.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		setEvent(c.closer)
+
+		// wait for pending operations
+		c.active.Lock()
+		defer c.active.Unlock()
+
+		err = c.release()
+	})
+
+	return err
+}
+
+// release closes the pipe and all created events and deadlines
+func (c *pipeConn) release() error {
+	err := syscall.CloseHandle(c.handle)
+
+	for _, event := range []syscall.Handle{c.readEvent, c.writeEvent, c.closer} {
+		if event != 0 {
+			syscall.CloseHandle(event)
+		}
+	}
+
+	for _, deadline := range []*pipeDeadline{c.read, c.write} {
+		if deadline != nil {
+			deadline.close()
+		}
+	}
+
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return pipeAddr(c.path)
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return pipeAddr(c.path)
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.read.set(t)
+	c.write.set(t)
+
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.read.set(t)
+
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.write.set(t)
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"packet"
+)
+
+func pipeURL() string {
+	return fmt.Sprintf("npipe:///transport-test-%d", time.Now().UnixNano())
+}
+
+func TestPipeServer(t *testing.T) {
+	url := pipeURL()
+
+	server, err := testLauncher.Launch(url)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn1, err := server.Accept()
+		require.NoError(t, err)
+
+		pkt, err := conn1.Receive()
+		assert.NoError(t, err)
+		assert.Equal(t, packet.CONNECT, pkt.Type())
+
+		err = conn1.Send(packet.NewConnackPacket())
+		assert.NoError(t, err)
+
+		pkt, err = conn1.Receive()
+		assert.Nil(t, pkt)
+		assert.Equal(t, io.EOF, err)
+
+		err = conn1.Close()
+		assert.NoError(t, err)
+	}()
+
+	conn2, err := testDialer.Dial(url)
+	require.NoError(t, err)
+
+	err = conn2.Send(packet.NewConnectPacket())
+	assert.NoError(t, err)
+
+	pkt, err := conn2.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, packet.CONNACK, pkt.Type())
+
+	err = conn2.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
+
+func TestPipeServerCloseWhileAccepting(t *testing.T) {
+	server, err := testLauncher.Launch(pipeURL())
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn, err := server.Accept()
+		assert.Nil(t, conn)
+		assert.Error(t, err)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	err = server.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	err = server.Close()
+	assert.Error(t, err)
+}
+
+func TestPipeConnCloseWhileReading(t *testing.T) {
+	url := pipeURL()
+
+	server, err := testLauncher.Launch(url)
+	require.NoError(t, err)
+	defer server.Close()
+
+	accepted := make(chan Conn, 1)
+
+	go func() {
+		conn, err := server.Accept()
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+
+	conn, err := testDialer.Dial(url)
+	require.NoError(t, err)
+
+	remote := <-accepted
+	defer remote.Close()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		pkt, err := conn.Receive()
+		assert.Nil(t, pkt)
+		assert.Error(t, err)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// the pending read is canceled before the handle is released
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	safeReceive(done)
+
+	err = conn.Send(packet.NewConnectPacket())
+	assert.Error(t, err)
+}
+
+func TestPipeConnReadDeadline(t *testing.T) {
+	path := `\\.\pipe\` + pipeURL()[len("npipe:///"):]
+
+	listener, err := listenPipe(path)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+
+	conn, err := dialPipe(path, time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	remote := <-accepted
+	defer remote.Close()
+
+	// an exceeded deadline cancels the read
+	err = conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	assert.NoError(t, err)
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.True(t, os.IsTimeout(err), err)
+
+	// a cleared deadline allows reading again
+	err = conn.SetReadDeadline(time.Time{})
+	assert.NoError(t, err)
+
+	n, err := remote.Write([]byte("x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	buf := make([]byte, 1)
+	n, err = conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "x", string(buf))
+}
@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/jpillora/backoff"
+)
+
+// An ErrorClass categorizes dial errors to decide whether they are retried.
+type ErrorClass int
+
+// All available error classes.
+const (
+	// ErrorOther is any error that is not covered by another class, e.g. an
+	// invalid url or a failed TLS handshake.
+	ErrorOther ErrorClass = iota
+
+	// ErrorDNS is a failed host name lookup.
+	ErrorDNS
+
+	// ErrorTimeout is a dial or handshake that timed out.
+	ErrorTimeout
+
+	// ErrorRefused is a connection refused by the server.
+	ErrorRefused
+
+	// ErrorReset is a connection reset or closed by the server during the
+	// handshake.
+	ErrorReset
+
+	// ErrorAddress is an exhausted or unavailable local address, which is
+	// common when many connections are opened at once.
+	ErrorAddress
+
+	// ErrorUnreachable is an unreachable host or network.
+	ErrorUnreachable
+)
+
+// String returns the name of the error class.
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorOther:
+		return "other"
+	case ErrorDNS:
+		return "dns"
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorRefused:
+		return "refused"
+	case ErrorReset:
+		return "reset"
+	case ErrorAddress:
+		return "address"
+	case ErrorUnreachable:
+		return "unreachable"
+	}
+
+	return "unknown"
+}
+
+// ClassifyError returns the class of a dial error.
+func ClassifyError(err error) ErrorClass {
+	// check dns
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorDNS
+	}
+
+	// check system errors
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorReset
+	case errors.Is(err, syscall.EADDRNOTAVAIL), errors.Is(err, syscall.EADDRINUSE):
+		return ErrorAddress
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ErrorUnreachable
+	case errors.Is(err, syscall.ETIMEDOUT):
+		return ErrorTimeout
+	}
+
+	// check timeouts
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	return ErrorOther
+}
+
+// A RetryPolicy defines how often and for which errors a Dialer retries a
+// failed dial.
+type RetryPolicy struct {
+	// The maximum number of dial attempts including the first one.
+	MaxAttempts int
+
+	// The delay before the first retry, which doubles with every retry up to
+	// the maximum.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// The error classes that are retried.
+	Classes []ErrorClass
+}
+
+// NewRetryPolicy returns a new RetryPolicy that makes up to three attempts
+// and retries DNS, timeout, address and unreachable errors.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+		Classes:     []ErrorClass{ErrorDNS, ErrorTimeout, ErrorAddress, ErrorUnreachable},
+	}
+}
+
+// Retryable returns whether the error belongs to a retried class.
+func (p *RetryPolicy) Retryable(err error) bool {
+	class := ClassifyError(err)
+	for _, c := range p.Classes {
+		if c == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run will call fn until it succeeds, the error is not retryable or the
+// attempts are exhausted
+func (p *RetryPolicy) run(fn func() (Conn, error)) (Conn, error) {
+	b := &backoff.Backoff{
+		Min:    p.MinBackoff,
+		Max:    p.MaxBackoff,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for attempt := 1; ; attempt++ {
+		conn, err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.Retryable(err) {
+			return conn, err
+		}
+
+		time.Sleep(b.Duration())
+	}
+}
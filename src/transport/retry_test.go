@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func opError(err error) error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+}
+
+func TestClassifyError(t *testing.T) {
+	matrix := map[ErrorClass]error{
+		ErrorOther:       errors.New("foo"),
+		ErrorDNS:         &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "foo"}},
+		ErrorTimeout:     &net.OpError{Op: "dial", Err: timeoutError{}},
+		ErrorRefused:     opError(syscall.ECONNREFUSED),
+		ErrorReset:       opError(syscall.ECONNRESET),
+		ErrorAddress:     opError(syscall.EADDRNOTAVAIL),
+		ErrorUnreachable: opError(syscall.EHOSTUNREACH),
+	}
+
+	for class, err := range matrix {
+		assert.Equal(t, class, ClassifyError(err), class.String())
+	}
+
+	assert.Equal(t, ErrorTimeout, ClassifyError(opError(syscall.ETIMEDOUT)))
+	assert.Equal(t, "unknown", ErrorClass(100).String())
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := NewRetryPolicy()
+	assert.True(t, policy.Retryable(opError(syscall.EADDRNOTAVAIL)))
+	assert.False(t, policy.Retryable(opError(syscall.ECONNREFUSED)))
+	assert.False(t, policy.Retryable(ErrUnsupportedProtocol))
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Classes:     []ErrorClass{ErrorAddress},
+	}
+
+	attempts := 0
+	_, err := policy.run(func() (Conn, error) {
+		attempts++
+		return nil, opError(syscall.EADDRNOTAVAIL)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	_, err = policy.run(func() (Conn, error) {
+		attempts++
+		if attempts < 2 {
+			return nil, opError(syscall.EADDRNOTAVAIL)
+		}
+
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	_, err = policy.run(func() (Conn, error) {
+		attempts++
+		return nil, opError(syscall.ECONNREFUSED)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDialerRetry(t *testing.T) {
+	// get a free port
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	dialer := NewDialer()
+	dialer.Retry = &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  10 * time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+		Classes:     []ErrorClass{ErrorRefused},
+	}
+
+	start := time.Now()
+	conn, err := dialer.Dial("ws://localhost:" + port)
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrorRefused, ClassifyError(err))
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+
+	conn, err = dialer.Dial("foo://localhost")
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrUnsupportedProtocol, err)
+}
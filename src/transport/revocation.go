@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrOCSPStapleMissing is returned by RevocationCheck.Verify if the server
+// did not staple an OCSP response although it is required.
+var ErrOCSPStapleMissing = errors.New("ocsp staple missing")
+
+// ErrCertificateRevoked is returned by RevocationCheck.Verify if a certificate
+// of the server has been revoked.
+var ErrCertificateRevoked = errors.New("certificate revoked")
+
+// A RevocationCheck verifies the revocation status of the server certificates
+// at the end of every TLS handshake. It is run after the regular verification
+// of the certificate chain.
+type RevocationCheck struct {
+	// Whether the server must staple a good and current OCSP response for its
+	// certificate to the handshake.
+	RequireOCSPStaple bool
+
+	// The revocation lists the certificates of the server are checked
+	// against. A certificate is checked against the lists of its issuer and
+	// is not checked if no list has been issued by it. The signature of a
+	// list must verify against the issuer in the chain, so the last
+	// certificate of a chain is only checked if it is self-signed.
+	CRLs []*x509.RevocationList
+
+	// The function called with the time the checks of a handshake took and
+	// their error, e.g. to report the verification latency.
+	Handler func(latency time.Duration, err error)
+}
+
+// Apply returns a copy of the config that runs the check after the
+// verification of the connection configured in the config.
+func (r *RevocationCheck) Apply(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	verify := config.VerifyConnection
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			err := verify(cs)
+			if err != nil {
+				return err
+			}
+		}
+
+		return r.Verify(cs)
+	}
+
+	return config
+}
+
+// Verify checks the stapled OCSP response and the revocation lists for the
+// certificates of the specified connection.
+func (r *RevocationCheck) Verify(cs tls.ConnectionState) error {
+	start := time.Now()
+	err := r.verify(cs)
+
+	// call handler
+	if r.Handler != nil {
+		r.Handler(time.Since(start), err)
+	}
+
+	return err
+}
+
+func (r *RevocationCheck) verify(cs tls.ConnectionState) error {
+	// get chain
+	chain := cs.PeerCertificates
+	if len(cs.VerifiedChains) > 0 {
+		chain = cs.VerifiedChains[0]
+	}
+
+	if len(chain) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	now := time.Now()
+
+	// check stapled response
+	if r.RequireOCSPStaple {
+		if len(cs.OCSPResponse) == 0 {
+			return ErrOCSPStapleMissing
+		} else if len(chain) < 2 {
+			return errors.New("ocsp: missing issuer certificate")
+		}
+
+		res, err := ocsp.ParseResponseForCert(cs.OCSPResponse, chain[0], chain[1])
+		if err != nil {
+			return fmt.Errorf("ocsp: %w", err)
+		}
+
+		switch {
+		case res.Status == ocsp.Revoked:
+			return fmt.Errorf("%w: ocsp: serial %s", ErrCertificateRevoked, chain[0].SerialNumber)
+		case res.Status != ocsp.Good:
+			return fmt.Errorf("ocsp: unknown certificate status")
+		case !res.NextUpdate.IsZero() && now.After(res.NextUpdate):
+			return fmt.Errorf("ocsp: response expired at %s", res.NextUpdate.Format(time.RFC3339))
+		}
+	}
+
+	// check revocation lists
+	for i, cert := range chain {
+		// get issuer, a list cannot be verified without it
+		var issuer *x509.Certificate
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		} else if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			issuer = cert
+		} else {
+			continue
+		}
+
+		for _, crl := range r.CRLs {
+			if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+				continue
+			}
+
+			// verify list
+			err := crl.CheckSignatureFrom(issuer)
+			if err != nil {
+				return fmt.Errorf("crl: %w", err)
+			}
+
+			if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+				return fmt.Errorf("crl: list of %s expired at %s", crl.Issuer, crl.NextUpdate.Format(time.RFC3339))
+			}
+
+			for _, entry := range crl.RevokedCertificateEntries {
+				if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return fmt.Errorf("%w: crl: serial %s", ErrCertificateRevoked, cert.SerialNumber)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadCRL reads a PEM or DER encoded certificate revocation list from the
+// specified file.
+func LoadCRL(path string) (*x509.RevocationList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode pem
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	return x509.ParseRevocationList(data)
+}
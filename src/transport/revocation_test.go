@@ -0,0 +1,220 @@
+package transport
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testPKI struct {
+	ca    *x509.Certificate
+	caKey crypto.Signer
+	leaf  *x509.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	require.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca, leafKey.Public(), caKey)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testPKI{ca: ca, caKey: caKey, leaf: leaf}
+}
+
+func (p *testPKI) ocsp(t *testing.T, status int, nextUpdate time.Time) []byte {
+	res, err := ocsp.CreateResponse(p.ca, p.ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: p.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, p.caKey)
+	require.NoError(t, err)
+
+	return res
+}
+
+func (p *testPKI) crl(t *testing.T, serials ...int64) []byte {
+	var entries []x509.RevocationListEntry
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, p.ca, p.caKey)
+	require.NoError(t, err)
+
+	return der
+}
+
+func (p *testPKI) state(staple []byte) tls.ConnectionState {
+	return tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{p.leaf, p.ca},
+		OCSPResponse:     staple,
+	}
+}
+
+func TestRevocationCheckOCSP(t *testing.T) {
+	pki := newTestPKI(t)
+
+	var latencies []time.Duration
+	check := &RevocationCheck{
+		RequireOCSPStaple: true,
+		Handler: func(latency time.Duration, err error) {
+			latencies = append(latencies, latency)
+		},
+	}
+
+	err := check.Verify(pki.state(nil))
+	assert.Equal(t, ErrOCSPStapleMissing, err)
+
+	err = check.Verify(pki.state(pki.ocsp(t, ocsp.Good, time.Now().Add(time.Hour))))
+	assert.NoError(t, err)
+
+	err = check.Verify(pki.state(pki.ocsp(t, ocsp.Revoked, time.Now().Add(time.Hour))))
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCertificateRevoked))
+
+	err = check.Verify(pki.state(pki.ocsp(t, ocsp.Good, time.Now().Add(-time.Second))))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expired")
+
+	err = check.Verify(pki.state([]byte("foo")))
+	assert.Error(t, err)
+
+	assert.Len(t, latencies, 5)
+}
+
+func TestRevocationCheckCRL(t *testing.T) {
+	pki := newTestPKI(t)
+
+	dir, err := ioutil.TempDir("", "crl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// load pem and der lists
+	path := filepath.Join(dir, "revoked.pem")
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: pki.crl(t, 42)}), 0600)
+	require.NoError(t, err)
+
+	revoked, err := LoadCRL(path)
+	require.NoError(t, err)
+
+	path = filepath.Join(dir, "valid.der")
+	err = ioutil.WriteFile(path, pki.crl(t, 7), 0600)
+	require.NoError(t, err)
+
+	valid, err := LoadCRL(path)
+	require.NoError(t, err)
+
+	check := &RevocationCheck{CRLs: []*x509.RevocationList{valid}}
+	err = check.Verify(pki.state(nil))
+	assert.NoError(t, err)
+
+	check.CRLs = append(check.CRLs, revoked)
+	err = check.Verify(pki.state(nil))
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCertificateRevoked))
+
+	// the list of an issuer that is not in the chain cannot be verified
+	err = check.Verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{pki.leaf}})
+	assert.NoError(t, err)
+
+	// a list of the same issuer name signed by another key is rejected
+	forged := newTestPKI(t)
+	list, err := x509.ParseRevocationList(forged.crl(t, 42))
+	require.NoError(t, err)
+
+	check.CRLs = []*x509.RevocationList{list}
+	err = check.Verify(pki.state(nil))
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrCertificateRevoked))
+	assert.Contains(t, err.Error(), "crl:")
+
+	_, err = LoadCRL(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestDialerRevocation(t *testing.T) {
+	server, err := testLauncher.Launch("tls://localhost:0")
+	require.NoError(t, err)
+
+	defer server.Close()
+
+	go func() {
+		conn, err := server.Accept()
+		if err == nil {
+			conn.Receive()
+		}
+	}()
+
+	var checks int
+
+	dialer := NewDialer()
+	dialer.TLSConfig = clientTLSConfig
+	dialer.Revocation = &RevocationCheck{
+		RequireOCSPStaple: true,
+		Handler: func(time.Duration, error) {
+			checks++
+		},
+	}
+
+	_, err = dialer.Dial(getURL(server, "tls"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ErrOCSPStapleMissing.Error())
+	assert.Equal(t, 1, checks)
+
+	// the shared config is not modified
+	assert.Nil(t, clientTLSConfig.VerifyConnection)
+}
@@ -0,0 +1,10 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package transport
+
+import "errors"
+
+func setReuseAddr(fd uintptr) error {
+	return errors.New("SO_REUSEADDR is not supported on this platform")
+}
@@ -0,0 +1,327 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ErrNoSourceAddress is returned by a SourcePool if all of its local
+// addresses are exhausted.
+var ErrNoSourceAddress = errors.New("no source address available")
+
+// A SourceStrategy selects the local address of the next connection.
+type SourceStrategy int
+
+const (
+	// SourceFill uses a local address until it is exhausted and continues
+	// with the next one.
+	SourceFill SourceStrategy = iota
+
+	// SourceRoundRobin spreads the connections evenly across all local
+	// addresses.
+	SourceRoundRobin
+)
+
+// String returns the name of the strategy.
+func (s SourceStrategy) String() string {
+	switch s {
+	case SourceFill:
+		return "fill"
+	case SourceRoundRobin:
+		return "round-robin"
+	}
+
+	return "unknown"
+}
+
+// ParseSourceStrategy returns the strategy with the specified name.
+func ParseSourceStrategy(name string) (SourceStrategy, error) {
+	switch name {
+	case "fill":
+		return SourceFill, nil
+	case "round-robin":
+		return SourceRoundRobin, nil
+	}
+
+	return 0, fmt.Errorf("invalid source strategy: %s", name)
+}
+
+// A SourcePool manages the local addresses and ports of outgoing TCP
+// connections. A single IP can only open about 64k connections to the same
+// broker endpoint, so load generators that exceed this number bind their
+// connections to multiple local IPs. It is safe for concurrent use.
+type SourcePool struct {
+	// The local IPs connections are bound to.
+	IPs []net.IP
+
+	// The strategy used to select the local IP.
+	Strategy SourceStrategy
+
+	// If set, the local ports are assigned from this range instead of the
+	// ephemeral range of the kernel, which allows up to PortMax-PortMin+1
+	// connections per IP.
+	PortMin int
+	PortMax int
+
+	// If set, SO_REUSEADDR is enabled before binding, so that local ports in
+	// the TIME_WAIT state of earlier connections can be bound again.
+	ReuseAddr bool
+
+	mutex     sync.Mutex
+	index     int
+	ports     map[int]int
+	failures  map[int]int
+	exhausted map[int]bool
+	conns     map[int]int
+}
+
+// NewSourcePool returns a new SourcePool for the specified local IPs that
+// uses the fill strategy.
+func NewSourcePool(ips ...net.IP) *SourcePool {
+	return &SourcePool{
+		IPs: ips,
+	}
+}
+
+// ParseSourceIPs parses a comma separated list of IPs, IP ranges like
+// "10.0.0.10-10.0.0.20" and networks like "10.0.1.0/28". The network and
+// broadcast addresses of IPv4 networks are omitted.
+func ParseSourceIPs(spec string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		// check network
+		if strings.Contains(item, "/") {
+			ip, network, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, err
+			}
+
+			ones, bits := network.Mask.Size()
+			if bits-ones > 16 {
+				return nil, fmt.Errorf("source network too large: %s", item)
+			}
+
+			var list []net.IP
+			for cur := ip.Mask(network.Mask); network.Contains(cur); cur = nextIP(cur) {
+				list = append(list, cur)
+			}
+
+			if ip.To4() != nil && len(list) > 2 {
+				list = list[1 : len(list)-1]
+			}
+
+			ips = append(ips, list...)
+			continue
+		}
+
+		// check range
+		if i := strings.Index(item, "-"); i > 0 {
+			first := net.ParseIP(item[:i])
+			last := net.ParseIP(item[i+1:])
+			if first == nil || last == nil || compareIP(first, last) > 0 {
+				return nil, fmt.Errorf("invalid source range: %s", item)
+			}
+
+			for cur := first; compareIP(cur, last) <= 0; cur = nextIP(cur) {
+				ips = append(ips, cur)
+			}
+
+			continue
+		}
+
+		ip := net.ParseIP(item)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source ip: %s", item)
+		}
+
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// ParsePortRange parses a port range like "1024-65535".
+func ParsePortRange(spec string) (int, int, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range: %s", spec)
+	}
+
+	min, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	max, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid port range: %s", spec)
+	}
+
+	return min, max, nil
+}
+
+// Len returns the number of local IPs.
+func (p *SourcePool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.IPs)
+}
+
+// Connections returns the number of connections opened per local IP.
+func (p *SourcePool) Connections() map[string]int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	conns := make(map[string]int, len(p.conns))
+	for i, n := range p.conns {
+		conns[p.IPs[i].String()] = n
+	}
+
+	return conns
+}
+
+// Dial connects to the address using the next available local address. Local
+// addresses that fail with an address error are skipped and IPs whose ports
+// are exhausted are not used again.
+func (p *SourcePool) Dial(network, address string) (net.Conn, error) {
+	for {
+		i, addr, ok := p.next()
+		if !ok {
+			return nil, ErrNoSourceAddress
+		}
+
+		dialer := net.Dialer{LocalAddr: addr}
+		if p.ReuseAddr {
+			dialer.Control = reuseAddr
+		}
+
+		conn, err := dialer.Dial(network, address)
+		if err != nil && ClassifyError(err) == ErrorAddress {
+			p.fail(i)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		p.succeed(i)
+
+		return conn, nil
+	}
+}
+
+// next returns the index and the local address of the next connection
+func (p *SourcePool) next() (int, *net.TCPAddr, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for n := 0; n < len(p.IPs); n++ {
+		i := p.index % len(p.IPs)
+
+		// skip exhausted addresses
+		if p.exhausted[i] {
+			p.index++
+			continue
+		}
+
+		if p.Strategy == SourceRoundRobin {
+			p.index++
+		}
+
+		addr := &net.TCPAddr{IP: p.IPs[i]}
+
+		// assign port explicitly
+		if p.PortMax > 0 {
+			if p.ports == nil {
+				p.ports = map[int]int{}
+			}
+
+			port, ok := p.ports[i]
+			if !ok || port > p.PortMax {
+				port = p.PortMin
+			}
+
+			addr.Port = port
+			p.ports[i] = port + 1
+		}
+
+		return i, addr, true
+	}
+
+	return 0, nil, false
+}
+
+// fail records an address error of the specified local IP
+func (p *SourcePool) fail(i int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.failures == nil {
+		p.failures = map[int]int{}
+		p.exhausted = map[int]bool{}
+	}
+
+	// with explicit ports a single port may still be in use, the IP is only
+	// exhausted if every port of the range failed in a row
+	p.failures[i]++
+	if p.PortMax == 0 || p.failures[i] > p.PortMax-p.PortMin {
+		p.exhausted[i] = true
+	}
+}
+
+// succeed records a connection of the specified local IP
+func (p *SourcePool) succeed(i int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.conns == nil {
+		p.conns = map[int]int{}
+	}
+
+	p.conns[i]++
+	delete(p.failures, i)
+}
+
+// reuseAddr enables SO_REUSEADDR on the socket before it is bound
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var err error
+	cErr := c.Control(func(fd uintptr) {
+		err = setReuseAddr(fd)
+	})
+	if cErr != nil {
+		return cErr
+	}
+
+	return err
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+func compareIP(a, b net.IP) int {
+	a, b = a.To16(), b.To16()
+	for i := range a {
+		if a[i] != b[i] {
+			return int(a[i]) - int(b[i])
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourceIPs(t *testing.T) {
+	ips, err := ParseSourceIPs("10.0.0.1, 10.0.1.254-10.0.2.1,10.0.3.0/30")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.1",
+		"10.0.1.254", "10.0.1.255", "10.0.2.0", "10.0.2.1",
+		"10.0.3.1", "10.0.3.2",
+	}, ipStrings(ips))
+
+	_, err = ParseSourceIPs("foo")
+	assert.Error(t, err)
+
+	_, err = ParseSourceIPs("10.0.0.2-10.0.0.1")
+	assert.Error(t, err)
+
+	_, err = ParseSourceIPs("10.0.0.0/8")
+	assert.Error(t, err)
+}
+
+func TestParsePortRange(t *testing.T) {
+	min, max, err := ParsePortRange("1024-65535")
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, min)
+	assert.Equal(t, 65535, max)
+
+	for _, spec := range []string{"1024", "0-10", "10-5", "1-70000", "a-b"} {
+		_, _, err = ParsePortRange(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseSourceStrategy(t *testing.T) {
+	for _, s := range []SourceStrategy{SourceFill, SourceRoundRobin} {
+		parsed, err := ParseSourceStrategy(s.String())
+		assert.NoError(t, err)
+		assert.Equal(t, s, parsed)
+	}
+
+	_, err := ParseSourceStrategy("foo")
+	assert.Error(t, err)
+}
+
+func TestSourcePoolDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go acceptAll(listener)
+
+	matrix := map[SourceStrategy]map[string]int{
+		SourceFill:       {"127.0.0.1": 4},
+		SourceRoundRobin: {"127.0.0.1": 2, "127.0.0.2": 2},
+	}
+
+	for strategy, expected := range matrix {
+		pool := NewSourcePool(net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"))
+		pool.Strategy = strategy
+
+		for i := 0; i < 4; i++ {
+			conn, err := pool.Dial("tcp", listener.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+		}
+
+		assert.Equal(t, expected, pool.Connections(), strategy.String())
+	}
+}
+
+func TestSourcePoolPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go acceptAll(listener)
+
+	// the range is reused after it has been used once
+	pool := NewSourcePool(net.ParseIP("127.0.0.1"))
+	pool.PortMin = 47311
+	pool.PortMax = 47312
+	pool.ReuseAddr = true
+
+	conn, err := pool.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, 47311, conn.LocalAddr().(*net.TCPAddr).Port)
+	conn.Close()
+
+	conn, err = pool.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, 47312, conn.LocalAddr().(*net.TCPAddr).Port)
+	conn.Close()
+}
+
+func TestSourcePoolExhausted(t *testing.T) {
+	// an address of the documentation network is not assigned locally
+	pool := NewSourcePool(net.ParseIP("192.0.2.1"))
+
+	_, err := pool.Dial("tcp", "127.0.0.1:1883")
+	assert.Equal(t, ErrNoSourceAddress, err)
+
+	_, err = NewSourcePool().Dial("tcp", "127.0.0.1:1883")
+	assert.Equal(t, ErrNoSourceAddress, err)
+}
+
+func acceptAll(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+	}
+}
+
+func ipStrings(ips []net.IP) []string {
+	var list []string
+	for _, ip := range ips {
+		list = append(list, ip.String())
+	}
+
+	return list
+}
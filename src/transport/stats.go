@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"sync/atomic"
+
+	"packet"
+)
+
+// A StatsHandler is notified about the events of connections it has been
+// attached to using SetStatsHandler, which allows metrics and tracing
+// integrations to observe connections without wrapping them. The methods are
+// called synchronously from the goroutines using the connection and should
+// therefore return quickly. A handler shared by multiple connections must be
+// safe for concurrent use.
+type StatsHandler interface {
+	// ConnOpened is called when the handler is attached to the connection.
+	ConnOpened(conn Conn)
+
+	// ConnClosed is called once when the connection is closed, either
+	// explicitly or because of an error. The error is nil if the connection
+	// has been closed cleanly.
+	ConnClosed(conn Conn, err error)
+
+	// PacketSent is called for every packet encoded to the connection.
+	// Buffered packets are reported before they are flushed.
+	PacketSent(conn Conn, pkt packet.GenericPacket)
+
+	// PacketReceived is called for every packet decoded from the connection.
+	PacketReceived(conn Conn, pkt packet.GenericPacket)
+
+	// BytesIO is called for every read from and write to the underlying
+	// connection with the number of bytes read and written.
+	BytesIO(conn Conn, read, written int)
+}
+
+// statsCarrier reports the bytes transferred by a Carrier and holds the
+// handler of the connection
+type statsCarrier struct {
+	read    int64
+	written int64
+
+	Carrier
+
+	handler StatsHandler
+	owner   Conn
+	closed  int32
+}
+
+func (c *statsCarrier) Read(p []byte) (int, error) {
+	n, err := c.Carrier.Read(p)
+	atomic.AddInt64(&c.read, int64(n))
+	if n > 0 && c.handler != nil {
+		c.handler.BytesIO(c.owner, n, 0)
+	}
+
+	return n, err
+}
+
+func (c *statsCarrier) Write(p []byte) (int, error) {
+	n, err := c.Carrier.Write(p)
+	atomic.AddInt64(&c.written, int64(n))
+	if n > 0 && c.handler != nil {
+		c.handler.BytesIO(c.owner, 0, n)
+	}
+
+	return n, err
+}
+
+// close reports the closing of the connection once
+func (c *statsCarrier) close(err error) {
+	if c.handler != nil && atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.handler.ConnClosed(c.owner, err)
+	}
+}
+
+// statsServer attaches a StatsHandler to accepted connections
+type statsServer struct {
+	Server
+
+	handler StatsHandler
+}
+
+func (s *statsServer) Accept() (Conn, error) {
+	conn, err := s.Server.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetStatsHandler(s.handler)
+
+	return conn, nil
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStatsHandler struct {
+	mutex   sync.Mutex
+	events  []string
+	read    int
+	written int
+}
+
+func (h *testStatsHandler) record(event string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.events = append(h.events, event)
+}
+
+func (h *testStatsHandler) ConnOpened(conn Conn) {
+	h.record("opened")
+}
+
+func (h *testStatsHandler) ConnClosed(conn Conn, err error) {
+	h.record(fmt.Sprintf("closed %v", err))
+}
+
+func (h *testStatsHandler) PacketSent(conn Conn, pkt packet.GenericPacket) {
+	h.record("sent " + pkt.Type().String())
+}
+
+func (h *testStatsHandler) PacketReceived(conn Conn, pkt packet.GenericPacket) {
+	h.record("received " + pkt.Type().String())
+}
+
+func (h *testStatsHandler) BytesIO(conn Conn, read, written int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.read += read
+	h.written += written
+}
+
+func (h *testStatsHandler) Events() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append([]string(nil), h.events...)
+}
+
+func TestStatsHandler(t *testing.T) {
+	a, b := net.Pipe()
+
+	handler := &testStatsHandler{}
+	conn := NewNetConn(a)
+	conn.SetStatsHandler(handler)
+
+	peer := NewNetConn(b)
+
+	go func() {
+		pkt, err := peer.Receive()
+		if err == nil {
+			peer.Send(pkt)
+		}
+
+		peer.Close()
+	}()
+
+	err := conn.Send(packet.NewPingreqPacket())
+	require.NoError(t, err)
+
+	_, err = conn.Receive()
+	require.NoError(t, err)
+
+	_, err = conn.Receive()
+	assert.Error(t, err)
+
+	// closing again is not reported
+	conn.Close()
+
+	events := handler.Events()
+	assert.Equal(t, []string{"opened", "sent Pingreq", "received Pingreq", "closed EOF"}, events)
+	assert.Equal(t, 2, handler.read)
+	assert.Equal(t, 2, handler.written)
+}
+
+func TestStatsHandlerDialerLauncher(t *testing.T) {
+	serverHandler := &testStatsHandler{}
+	launcher := NewLauncher()
+	launcher.StatsHandler = serverHandler
+
+	server, err := launcher.Launch("ws://localhost:0")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+
+		pkt, err := conn.Receive()
+		if err == nil {
+			conn.Send(pkt)
+		}
+
+		conn.Close()
+	}()
+
+	clientHandler := &testStatsHandler{}
+	dialer := NewDialer()
+	dialer.StatsHandler = clientHandler
+
+	conn, err := dialer.Dial(fmt.Sprintf("ws://localhost:%s", getPort(server)))
+	require.NoError(t, err)
+
+	err = conn.Send(packet.NewPingreqPacket())
+	require.NoError(t, err)
+
+	_, err = conn.Receive()
+	require.NoError(t, err)
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	<-done
+	server.Close()
+
+	assert.Equal(t, []string{"opened", "sent Pingreq", "received Pingreq", "closed <nil>"}, clientHandler.Events())
+	assert.Equal(t, []string{"opened", "received Pingreq", "sent Pingreq", "closed <nil>"}, serverHandler.Events())
+	assert.True(t, clientHandler.read > 0)
+	assert.True(t, clientHandler.written > 0)
+}
@@ -1,9 +1,11 @@
 package transport
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -100,14 +102,103 @@ type WebSocketConn struct {
 	BaseConn
 
 	conn *websocket.Conn
+
+	pingStop  chan struct{}
+	onPong    func(time.Duration)
+	pingMutex sync.Mutex
 }
 
 // NewWebSocketConn returns a new WebSocketConn.
 func NewWebSocketConn(conn *websocket.Conn) *WebSocketConn {
-	return &WebSocketConn{
+	c := &WebSocketConn{
 		BaseConn: *NewBaseConn(&wsStream{conn: conn}),
 		conn:     conn,
 	}
+
+	c.setOwner(c)
+	conn.SetPongHandler(c.handlePong)
+
+	return c
+}
+
+// SetPingInterval starts sending WebSocket ping frames at the specified
+// interval, independent of the MQTT keep alive. Proxies often close idle
+// connections based on their own timeouts at the WebSocket layer. A zero
+// interval stops sending pings, which is the default.
+func (c *WebSocketConn) SetPingInterval(interval time.Duration) {
+	c.pingMutex.Lock()
+	defer c.pingMutex.Unlock()
+
+	// stop current pinger
+	if c.pingStop != nil {
+		close(c.pingStop)
+		c.pingStop = nil
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	c.pingStop = make(chan struct{})
+	go c.pinger(interval, c.pingStop)
+}
+
+// SetPongHandler sets a function that is called with the round trip time of
+// every pong frame that answers a ping sent by the connection. Pongs are only
+// processed while the connection is receiving.
+func (c *WebSocketConn) SetPongHandler(fn func(rtt time.Duration)) {
+	c.pingMutex.Lock()
+	defer c.pingMutex.Unlock()
+
+	c.onPong = fn
+}
+
+// Close stops sending pings and closes the connection.
+func (c *WebSocketConn) Close() error {
+	c.SetPingInterval(0)
+
+	return c.BaseConn.Close()
+}
+
+// sends ping frames carrying their send time until stopped
+func (c *WebSocketConn) pinger(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	payload := make([]byte, 8)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+
+		err := c.conn.WriteControl(websocket.PingMessage, payload, time.Now().Add(interval))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// reports the round trip time of a pong
+func (c *WebSocketConn) handlePong(data string) error {
+	if len(data) != 8 {
+		return nil
+	}
+
+	c.pingMutex.Lock()
+	fn := c.onPong
+	c.pingMutex.Unlock()
+
+	if fn != nil {
+		sent := int64(binary.BigEndian.Uint64([]byte(data)))
+		fn(time.Since(time.Unix(0, sent)))
+	}
+
+	return nil
 }
 
 // LocalAddr returns the local network address.
@@ -3,9 +3,11 @@ package transport
 import (
 	"io"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"packet"
 )
 
@@ -33,6 +35,10 @@ func TestWebSocketConnCloseWhileSend(t *testing.T) {
 	abstractConnCloseWhileSendTest(t, "ws")
 }
 
+func TestWebSocketConnCloseWhileBlocked(t *testing.T) {
+	abstractConnCloseWhileBlockedTest(t, "ws")
+}
+
 func TestWebSocketSendAndCloseTest(t *testing.T) {
 	abstractConnSendAndCloseTest(t, "ws")
 }
@@ -73,6 +79,43 @@ func TestWebSocketConnBigBufferedSendAfterClose(t *testing.T) {
 	abstractConnBigBufferedSendAfterCloseTest(t, "ws")
 }
 
+func TestWebSocketConnReadBatch(t *testing.T) {
+	abstractConnReadBatchTest(t, "ws")
+}
+
+func TestWebSocketConnFlush(t *testing.T) {
+	abstractConnFlushTest(t, "ws")
+}
+
+func TestWebSocketConnWriteDelay(t *testing.T) {
+	abstractConnWriteDelayTest(t, "ws")
+}
+
+func TestWebSocketConnSendContext(t *testing.T) {
+	abstractConnSendContextTest(t, "ws")
+}
+
+func TestWebSocketConnReceiveContext(t *testing.T) {
+	abstractConnReceiveContextTest(t, "ws")
+}
+
+func TestWebSocketConnInterner(t *testing.T) {
+	abstractConnInternerTest(t, "ws")
+}
+
+func TestWebSocketConnPacketStats(t *testing.T) {
+	abstractConnPacketStatsTest(t, "ws")
+}
+
+func TestWebSocketConnWireStats(t *testing.T) {
+	abstractConnWireStatsTest(t, "ws", true, true)
+	abstractConnWireStatsTest(t, "wss", true, true)
+}
+
+func TestWebSocketConnStreamedPayload(t *testing.T) {
+	abstractConnStreamedPayloadTest(t, "ws")
+}
+
 func TestWebSocketBadFrameError(t *testing.T) {
 	conn2, done := connectionPair("ws", func(conn1 Conn) {
 		buf := []byte{0x07, 0x00, 0x00, 0x00, 0x00} // < bad frame
@@ -219,3 +262,43 @@ func BenchmarkWebSocketConnBuffered(b *testing.B) {
 
 	safeReceive(done)
 }
+
+func TestWebSocketConnPing(t *testing.T) {
+	server, err := testLauncher.Launch("ws://localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		conn, err := server.Accept()
+		require.NoError(t, err)
+
+		// pings are answered while receiving
+		_, err = conn.Receive()
+		assert.Error(t, err)
+	}()
+
+	pongs := make(chan time.Duration, 10)
+
+	dialer := NewDialer()
+	dialer.WebSocketPingInterval = 10 * time.Millisecond
+	dialer.WebSocketPongHandler = func(rtt time.Duration) {
+		pongs <- rtt
+	}
+
+	conn, err := dialer.Dial(getURL(server, "ws"))
+	require.NoError(t, err)
+
+	go conn.Receive()
+
+	select {
+	case rtt := <-pongs:
+		assert.True(t, rtt > 0)
+	case <-time.After(time.Second):
+		t.Fatal("expected pong")
+	}
+
+	err = conn.Close()
+	assert.NoError(t, err)
+
+	err = server.Close()
+	assert.NoError(t, err)
+}
@@ -16,6 +16,7 @@ var errManualClose = errors.New("internal: manual close")
 // The WebSocketServer accepts websocket.Conn based connections.
 type WebSocketServer struct {
 	listener      net.Listener
+	wires         *wireListener
 	mux           *http.ServeMux
 	fallback      http.Handler
 	upgrader      *websocket.Upgrader
@@ -25,9 +26,17 @@ type WebSocketServer struct {
 	tomb tomb.Tomb
 }
 
-func newWebSocketServer(listener net.Listener) *WebSocketServer {
+func newWebSocketServer(listener net.Listener, config *tls.Config) *WebSocketServer {
+	// count the bytes below the tls layer
+	wires := newWireListener(listener)
+	listener = wires
+	if config != nil {
+		listener = tls.NewListener(wires, config)
+	}
+
 	ws := &WebSocketServer{
 		listener: listener,
+		wires:    wires,
 		upgrader: &websocket.Upgrader{
 			HandshakeTimeout: 60 * time.Second,
 			Subprotocols:     []string{"mqtt", "mqttv3.1"},
@@ -54,7 +63,7 @@ func NewWebSocketServer(address string) (*WebSocketServer, error) {
 		return nil, err
 	}
 
-	s := newWebSocketServer(listener)
+	s := newWebSocketServer(listener, nil)
 	s.serveHTTP()
 
 	return s, nil
@@ -63,12 +72,17 @@ func NewWebSocketServer(address string) (*WebSocketServer, error) {
 // NewSecureWebSocketServer creates a new WSS server that listens on the
 // provided address.
 func NewSecureWebSocketServer(address string, config *tls.Config) (*WebSocketServer, error) {
-	listener, err := tls.Listen("tcp", address, config)
+	err := checkTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
-	s := newWebSocketServer(listener)
+	s := newWebSocketServer(listener, config)
 	s.serveHTTP()
 
 	return s, nil
@@ -118,6 +132,9 @@ func (s *WebSocketServer) requestHandler(w http.ResponseWriter, r *http.Request)
 
 	// create connection
 	webSocketConn := NewWebSocketConn(conn)
+	if wire := s.wires.lookup(r.RemoteAddr); wire != nil {
+		webSocketConn.setWire(wire)
+	}
 
 	select {
 	case s.incoming <- webSocketConn:
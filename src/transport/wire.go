@@ -0,0 +1,193 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// the error of tls.Listen for configs without certificates
+var errMissingCertificate = errors.New("tls: neither Certificates, GetCertificate, nor GetConfigForClient set in Config")
+
+// WireStats holds the number of bytes a connection has written to and read
+// from the network.
+type WireStats struct {
+	// The bytes sent and received including the framing of TLS records and
+	// WebSocket frames and the handshakes of both.
+	Sent     int64
+	Received int64
+
+	// Whether the framing below MQTT has been measured. Connections that
+	// tunnel MQTT through protocols that hide the network, e.g. the HTTP
+	// bridge, only count the bytes of the MQTT packets.
+	Complete bool
+}
+
+// Merge returns the sum of both counters. The sum is only complete if both
+// counters are.
+func (s WireStats) Merge(other WireStats) WireStats {
+	return WireStats{
+		Sent:     s.Sent + other.Sent,
+		Received: s.Received + other.Received,
+		Complete: s.Complete && other.Complete,
+	}
+}
+
+// wireConn counts the bytes transferred on a network connection below any
+// TLS or WebSocket framing
+type wireConn struct {
+	sent     int64
+	received int64
+
+	net.Conn
+
+	onClose   func()
+	closeOnce sync.Once
+}
+
+func newWireConn(conn net.Conn) *wireConn {
+	return &wireConn{
+		Conn: conn,
+	}
+}
+
+func (c *wireConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.received, int64(n))
+
+	return n, err
+}
+
+func (c *wireConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.sent, int64(n))
+
+	return n, err
+}
+
+func (c *wireConn) Close() error {
+	c.closeOnce.Do(func() {
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+
+	return c.Conn.Close()
+}
+
+func (c *wireConn) stats() WireStats {
+	return WireStats{
+		Sent:     atomic.LoadInt64(&c.sent),
+		Received: atomic.LoadInt64(&c.received),
+		Complete: true,
+	}
+}
+
+// wireListener counts the bytes of accepted connections and tracks them by
+// their remote address, so that servers which hand the connections to
+// net/http can look them up for a request
+type wireListener struct {
+	net.Listener
+
+	conns map[string]*wireConn
+	mutex sync.Mutex
+}
+
+func newWireListener(listener net.Listener) *wireListener {
+	return &wireListener{
+		Listener: listener,
+		conns:    make(map[string]*wireConn),
+	}
+}
+
+func (l *wireListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	wire := newWireConn(conn)
+	addr := conn.RemoteAddr().String()
+
+	l.mutex.Lock()
+	l.conns[addr] = wire
+	l.mutex.Unlock()
+
+	wire.onClose = func() {
+		l.mutex.Lock()
+		delete(l.conns, addr)
+		l.mutex.Unlock()
+	}
+
+	return wire, nil
+}
+
+// lookup returns the accepted connection with the remote address
+func (l *wireListener) lookup(addr string) *wireConn {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.conns[addr]
+}
+
+// dialTLS dials a TLS connection like tls.Dial and counts its bytes
+func dialTLS(network, addr string, config *tls.Config) (*tls.Conn, *wireConn, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// verify the host like tls.Dial
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	wire := newWireConn(conn)
+	tlsConn := tls.Client(wire, config)
+
+	err = tlsConn.Handshake()
+	if err != nil {
+		wire.Close()
+		return nil, nil, err
+	}
+
+	return tlsConn, wire, nil
+}
+
+// wireDial returns a dial function like netDial that stores the counted
+// connection it dialed
+func wireDial(network string, wire **wireConn) func(string, string) (net.Conn, error) {
+	dial := netDial(network)
+
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		*wire = newWireConn(conn)
+
+		return *wire, nil
+	}
+}
+
+// checkTLSConfig fails like tls.Listen for configs without certificates
+func checkTLSConfig(config *tls.Config) error {
+	if config == nil || len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return errMissingCertificate
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"bench"
+)
+
+// 跨系统延迟对比工具
+// 以相同的发布/订阅场景分别运行于 MQTT、NATS 或 Redis，使用统一的指标与结果输出，便于同条件下比较端到端延迟
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "system url (nats://, redis:// or a broker url)")
+var workers = flag.Int("workers", 1, "number of publisher and subscriber pairs")
+var rate = flag.Int("rate", 1000, "messages per second per worker")
+var size = flag.Int("size", 64, "payload size in bytes")
+var duration = flag.Duration("duration", 30*time.Second, "time messages are published")
+var drain = flag.Duration("drain", 2*time.Second, "time to wait for outstanding messages")
+var topicPrefix = flag.String("topic", "bench", "prefix of the per worker topics")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like latency.p99<0.01 (repeatable)")
+}
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start comparison on %s with %d workers at %d msg/s each.\n", *urlString, *workers, *rate)
+
+	// the same run as pubsub1max, but connected with the adapters
+	config := bench.NewRunConfig(*urlString)
+	config.Name = "adapter"
+	config.Adapter = true
+	config.Workers = *workers
+	config.PublishRate = float64(*rate)
+	config.PayloadSize = *size
+	config.Duration = *duration
+	config.Drain = *drain
+	config.TopicPrefix = *topicPrefix + "-"
+	config.ClientIDPrefix = "adapter-"
+	config.Thresholds = thresholds
+	config.Logf = func(format string, args ...interface{}) {
+		fmt.Printf(format, args...)
+	}
+
+	// finish early on signals
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+
+		<-done
+		cancel()
+	}()
+
+	report, runErr := bench.Run(ctx, config)
+	if report == nil {
+		fmt.Println("Run failed:", runErr)
+		os.Exit(1)
+	}
+
+	result := report.Result
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	if runErr != nil {
+		fmt.Println("Run failed:", runErr)
+	}
+
+	// write result and check thresholds
+	err := bench.Finish(*out, result, thresholds)
+	if runErr != nil || err != nil {
+		os.Exit(1)
+	}
+}
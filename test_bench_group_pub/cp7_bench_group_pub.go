@@ -1,13 +1,13 @@
 package main
 
 import (
+	"bench"
 	"client"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 )
@@ -19,6 +19,7 @@ var interval = flag.Int("i", 10, "interval of connecting to the broker(ms)")
 var interval_of_msg = flag.Int("I", 1000, "interval of publishing message(ms)")
 var size = flag.Int("s", 4096, "payload size")
 var cs = flag.String("cid", "client", "client id start with")
+var cidGen = flag.String("cid-gen", "", "client id generator (prefix:<p>, sequential:<start>, uuid or file:<path>), defaults to prefix:<cid>")
 var qos = flag.Uint("qos", 0, "pub qos level")
 var clearsession = flag.Bool("clear", true, "clear session")
 var pingtime = flag.String("keepalive", "300s", "keepalive")
@@ -26,10 +27,23 @@ var pingtime = flag.String("keepalive", "300s", "keepalive")
 func main() {
 	flag.Parse()
 
+	spec := *cidGen
+	if spec == "" {
+		spec = "prefix:" + *cs
+	}
+
+	ids, err := bench.ParseIDGenerator(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	clients := make(map[string]*client.Client)
 
 	for i := 0; i < *workers; i++ {
-		id := strconv.Itoa(i)
+		clientID, err := ids.Next(i)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		cl := client.New()
 		cf, err := cl.Connect(&client.Config{
@@ -37,7 +51,7 @@ func main() {
 			CleanSession: *clearsession,
 			KeepAlive:    *pingtime,
 			ValidateSubs: true,
-			ClientID:     *cs + id,
+			ClientID:     clientID,
 		})
 		if err != nil {
 			log.Println("conn", err)
@@ -48,7 +62,7 @@ func main() {
 			log.Println("conn wait", err)
 		}
 
-		clients[*cs+id] = cl
+		clients[clientID] = cl
 		time.Sleep(time.Duration(*interval) * time.Millisecond)
 	}
 
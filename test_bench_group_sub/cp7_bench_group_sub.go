@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bench"
 	"client"
 	"flag"
 	"fmt"
@@ -17,6 +18,7 @@ var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
 var topic = flag.String("topic", "$share/group1", "the used topic")
 var workers = flag.Int("workers", 30, "number of workers")
 var cs = flag.String("cid", "testclient", "client id start with")
+var cidGen = flag.String("cid-gen", "", "client id generator (prefix:<p>, sequential:<start>, uuid or file:<path>), defaults to prefix:<cid>")
 var qos = flag.Uint("qos", 0, "sub qos level")
 var clearsession = flag.Bool("clear", true, "clear session")
 var pingtime = flag.String("keepalive", "300s", "keepalive")
@@ -24,13 +26,31 @@ var pingtime = flag.String("keepalive", "300s", "keepalive")
 func main() {
 	flag.Parse()
 
+	spec := *cidGen
+	if spec == "" {
+		spec = "prefix:" + *cs
+	}
+
+	ids, err := bench.ParseIDGenerator(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var clients []*client.Client
+
 	for i := 0; i < *workers; i++ {
 		id := strconv.Itoa(i)
 		if i%1000 == 0 {
 			log.Println(id)
 		}
 
+		clientID, err := ids.Next(i)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		cl := client.New()
+		clients = append(clients, cl)
 		cl.Callback = func(msg *packet.Message, err error) error {
 			if err != nil {
 				log.Println("callback", err)
@@ -47,7 +67,7 @@ func main() {
 			CleanSession: *clearsession,
 			KeepAlive:    *pingtime,
 			ValidateSubs: true,
-			ClientID:     *cs + id,
+			ClientID:     clientID,
 		})
 		if err != nil {
 			log.Println("conn", err)
@@ -82,4 +102,24 @@ func main() {
 		}
 	}()
 	<-cleanupDone
+
+	// report duplicate deliveries
+	var stats client.DeliveryStats
+	for _, cl := range clients {
+		s := cl.DeliveryStats()
+		for qos := 0; qos < 3; qos++ {
+			stats.Received[qos] += s.Received[qos]
+			stats.Duplicates[qos] += s.Duplicates[qos]
+			stats.Redelivered[qos] += s.Redelivered[qos]
+			stats.Deduplicated[qos] += s.Deduplicated[qos]
+		}
+	}
+
+	for qos := 0; qos < 3; qos++ {
+		if stats.Received[qos] > 0 {
+			fmt.Printf("qos %d: received %d, dup %d, redelivered %d, deduplicated %d (%.2f%%)\n", qos, stats.Received[qos],
+				stats.Duplicates[qos], stats.Redelivered[qos], stats.Deduplicated[qos],
+				float64(stats.Deduplicated[qos])/float64(stats.Received[qos])*100)
+		}
+	}
 }
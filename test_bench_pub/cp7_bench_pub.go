@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bench"
 	"client"
 	"flag"
 	"fmt"
@@ -21,25 +22,60 @@ var interval = flag.Int("i", 10, "interval of connecting to the broker(ms)")
 var interval_of_msg = flag.Int("I", 1000, "interval of publishing message(ms)")
 var size = flag.Int("s", 256, "payload size")
 var cs = flag.String("cid", "client", "client id start with")
+var cidGen = flag.String("cid-gen", "", "client id generator (prefix:<p>, sequential:<start>, uuid or file:<path>), defaults to prefix:<cid>")
 var qos = flag.Uint("qos", 0, "pub qos level")
 var clearsession = flag.Bool("clear", true, "clear session")
 var pingtime = flag.String("keepalive", "300s", "keepalive")
+var queueSize = flag.Int("queue", 0, "per client send queue size (0 sends directly)")
+var queuePolicy = flag.String("queue-policy", "block", "policy if the send queue is full (block, drop-oldest, drop-newest or error)")
+var trace = flag.String("trace", "", "export connect, publish and ack spans to this OTLP/HTTP endpoint (e.g. http://127.0.0.1:4318)")
 
 func main() {
 	flag.Parse()
 
+	spec := *cidGen
+	if spec == "" {
+		spec = "prefix:" + *cs
+	}
+
+	ids, err := bench.ParseIDGenerator(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tracer *client.OTLPTracer
+	if *trace != "" {
+		tracer, err = client.NewOTLPTracer(*trace, "cp7_bench_pub")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	policy, err := client.ParseQueuePolicy(*queuePolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	clients := make(map[string]*client.Client)
 
 	for i := 0; i < *workers; i++ {
-		id := strconv.Itoa(i)
+		clientID, err := ids.Next(i)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		cl := client.New()
+		if tracer != nil {
+			cl.Tracer = tracer
+		}
 		cf, err := cl.Connect(&client.Config{
-			BrokerURL:    *urlString,
-			CleanSession: *clearsession,
-			KeepAlive:    *pingtime,
-			ValidateSubs: true,
-			ClientID:     *cs + id,
+			BrokerURL:       *urlString,
+			CleanSession:    *clearsession,
+			KeepAlive:       *pingtime,
+			ValidateSubs:    true,
+			ClientID:        clientID,
+			SendQueueSize:   *queueSize,
+			SendQueuePolicy: policy,
 		})
 		if err != nil {
 			log.Println("conn", err)
@@ -50,7 +86,7 @@ func main() {
 			log.Println("conn wait", err)
 		}
 
-		clients[*cs+id] = cl
+		clients[clientID] = cl
 		time.Sleep(time.Duration(*interval) * time.Millisecond)
 	}
 
@@ -82,4 +118,26 @@ func main() {
 		}
 	}()
 	<-cleanupDone
+
+	// export remaining spans
+	if tracer != nil {
+		err := tracer.Close()
+		if err != nil {
+			log.Println("trace", err)
+		}
+	}
+
+	// report send queue counters
+	if *queueSize > 0 {
+		var stats client.QueueStats
+		for _, cl := range clients {
+			s := cl.SendQueueStats()
+			stats.Queued += s.Queued
+			stats.Sent += s.Sent
+			stats.Dropped += s.Dropped
+			stats.Length += s.Length
+		}
+
+		fmt.Printf("queue: queued %d, sent %d, dropped %d, pending %d\n", stats.Queued, stats.Sent, stats.Dropped, stats.Length)
+	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bench"
 	"client"
 	"flag"
 	"fmt"
@@ -18,20 +19,51 @@ var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
 var topic = flag.String("topic", "cp7sub%i", "the used topic")
 var workers = flag.Int("workers", 200, "number of workers")
 var cs = flag.String("cid", "testclient", "client id start with")
+var cidGen = flag.String("cid-gen", "", "client id generator (prefix:<p>, sequential:<start>, uuid or file:<path>), defaults to prefix:<cid>")
 var qos = flag.Uint("qos", 0, "sub qos level")
 var clearsession = flag.Bool("clear", true, "clear session")
 var pingtime = flag.String("keepalive", "300s", "keepalive")
+var trace = flag.String("trace", "", "export connect, publish and ack spans to this OTLP/HTTP endpoint (e.g. http://127.0.0.1:4318)")
 
 func main() {
 	flag.Parse()
 
+	spec := *cidGen
+	if spec == "" {
+		spec = "prefix:" + *cs
+	}
+
+	ids, err := bench.ParseIDGenerator(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tracer *client.OTLPTracer
+	if *trace != "" {
+		tracer, err = client.NewOTLPTracer(*trace, "cp7_bench_sub")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var clients []*client.Client
+
 	for i := 0; i < *workers; i++ {
 		id := strconv.Itoa(i)
 		if i%1000 == 0 {
 			log.Println(id)
 		}
 
+		clientID, err := ids.Next(i)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		cl := client.New()
+		if tracer != nil {
+			cl.Tracer = tracer
+		}
+		clients = append(clients, cl)
 		cl.Callback = func(msg *packet.Message, err error) error {
 			if err != nil {
 				log.Println("callback", err)
@@ -45,7 +77,7 @@ func main() {
 			CleanSession: *clearsession,
 			KeepAlive:    *pingtime,
 			ValidateSubs: true,
-			ClientID:     *cs + id,
+			ClientID:     clientID,
 		})
 		if err != nil {
 			log.Println("conn", err)
@@ -80,4 +112,32 @@ func main() {
 		}
 	}()
 	<-cleanupDone
+
+	// export remaining spans
+	if tracer != nil {
+		err := tracer.Close()
+		if err != nil {
+			log.Println("trace", err)
+		}
+	}
+
+	// report duplicate deliveries
+	var stats client.DeliveryStats
+	for _, cl := range clients {
+		s := cl.DeliveryStats()
+		for qos := 0; qos < 3; qos++ {
+			stats.Received[qos] += s.Received[qos]
+			stats.Duplicates[qos] += s.Duplicates[qos]
+			stats.Redelivered[qos] += s.Redelivered[qos]
+			stats.Deduplicated[qos] += s.Deduplicated[qos]
+		}
+	}
+
+	for qos := 0; qos < 3; qos++ {
+		if stats.Received[qos] > 0 {
+			fmt.Printf("qos %d: received %d, dup %d, redelivered %d, deduplicated %d (%.2f%%)\n", qos, stats.Received[qos],
+				stats.Duplicates[qos], stats.Redelivered[qos], stats.Deduplicated[qos],
+				float64(stats.Deduplicated[qos])/float64(stats.Received[qos])*100)
+		}
+	}
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"bench"
+	"packet"
+	"transport"
+)
+
+// 大消息流式传输测试工具
+// 以流式方式发布数十 MB 的消息（如固件升级包），订阅端同样以流式方式读取消息体，无需在内存中保存完整报文，测量大消息的传输耗时与吞吐量
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var size = flag.Int("size", 32<<20, "payload size in bytes")
+var count = flag.Int("count", 10, "number of messages")
+var topic = flag.String("topic", "bigstream", "topic of the messages")
+var threshold = flag.Int("threshold", 64<<10, "stream received payloads larger than this size in bytes")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like transfer.p99<5s or throughput>50000000 (repeatable)")
+}
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start streaming %d messages of %d bytes to %s.\n", *count, *size, *urlString)
+
+	result := bench.NewResult("bigstream")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	// connect clients
+	consumer := connect("bigstream/sub")
+	consumer.SetStreamThreshold(*threshold)
+
+	subscribe := packet.NewSubscribePacket()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: *topic, QOS: 0},
+	}
+
+	err := consumer.Send(subscribe)
+	if err != nil {
+		fmt.Println("subscribe", err)
+		os.Exit(1)
+	}
+
+	_, err = consumer.Receive()
+	if err != nil {
+		fmt.Println("suback", err)
+		os.Exit(1)
+	}
+
+	publisher := connect("bigstream/pub")
+
+	// receive messages
+	var transfers bench.Latencies
+	var bytes int64
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < *count; i++ {
+			start := time.Now()
+
+			pkt, err := consumer.Receive()
+			if err != nil {
+				done <- err
+				return
+			}
+
+			publish, ok := pkt.(*packet.PublishPacket)
+			if !ok {
+				i--
+				continue
+			}
+
+			// read payload
+			n := int64(len(publish.Message.Payload))
+			if publish.Message.PayloadReader != nil {
+				n, err = io.Copy(ioutil.Discard, publish.Message.PayloadReader)
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+
+			if n != int64(*size) {
+				done <- fmt.Errorf("expected %d payload bytes, got %d", *size, n)
+				return
+			}
+
+			transfers.Add(time.Since(start))
+			bytes += n
+
+			fmt.Printf("Received: %d/%d (%s)\n", i+1, *count, time.Since(start).Round(time.Millisecond))
+		}
+
+		done <- nil
+	}()
+
+	// publish messages
+	start := time.Now()
+	for i := 0; i < *count; i++ {
+		publish := packet.NewPublishPacket()
+		publish.Message.Topic = *topic
+		publish.Message.PayloadReader = io.LimitReader(pattern{}, int64(*size))
+		publish.Message.PayloadLen = *size
+
+		err := publisher.Send(publish)
+		if err != nil {
+			fmt.Println("publish", err)
+			os.Exit(1)
+		}
+	}
+
+	err = <-done
+	if err != nil {
+		fmt.Println("receive", err)
+		os.Exit(1)
+	}
+
+	elapsed := time.Since(start).Seconds()
+
+	publisher.Send(packet.NewDisconnectPacket())
+	publisher.Close()
+	consumer.Send(packet.NewDisconnectPacket())
+	consumer.Close()
+
+	// collect metrics
+	metrics := bench.Metrics{
+		"messages":   float64(transfers.Len()),
+		"bytes":      float64(bytes),
+		"throughput": float64(bytes) / elapsed,
+	}
+
+	for name, value := range transfers.Metrics("transfer.") {
+		metrics[name] = value
+	}
+
+	fmt.Printf("Messages: %.0f - Bytes: %.0f - Throughput: %.2f MB/s - Transfer p50: %.2fs p99: %.2fs\n",
+		metrics["messages"], metrics["bytes"], metrics["throughput"]/(1<<20),
+		metrics["transfer.p50"], metrics["transfer.p99"])
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func connect(clientID string) transport.Conn {
+	conn, err := transport.Dial(*urlString)
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	connect := packet.NewConnectPacket()
+	connect.ClientID = clientID
+	connect.CleanSession = true
+
+	err = conn.Send(connect)
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	pkt, err := conn.Receive()
+	if err != nil {
+		fmt.Println("connack", err)
+		os.Exit(1)
+	}
+
+	connack, ok := pkt.(*packet.ConnackPacket)
+	if !ok || connack.ReturnCode != packet.ConnectionAccepted {
+		fmt.Println("connection failed:", pkt)
+		os.Exit(1)
+	}
+
+	return conn
+}
+
+// pattern is an endless reader of generated payload bytes
+type pattern struct{}
+
+func (pattern) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+)
+
+// 代理桥接拓扑测试工具
+// 向代理 A 发布消息并在代理 B 上订阅，测量经过桥接的端到端延迟，并通过统计每条消息在各代理上出现的次数（跳数计数）检测路由环路
+
+var urlA = flag.String("a", "tcp://127.0.0.1:1883", "url of the broker the messages are published to")
+var urlB = flag.String("b", "tcp://127.0.0.1:1884", "url of the broker the messages are bridged to")
+var topic = flag.String("topic", "bridge/test", "topic that is bridged between the brokers")
+var count = flag.Int("count", 1000, "number of messages to publish")
+var rate = flag.Int("rate", 100, "publish rate in messages per second")
+var size = flag.Int("size", 64, "payload size in bytes")
+var qos = flag.Uint("qos", 1, "sub and pub qos level")
+var settle = flag.Duration("settle", 2*time.Second, "time to wait for looping copies after the last message arrived")
+var timeout = flag.Duration("timeout", time.Minute, "maximum time to wait for the bridged messages")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like latency.p99<100ms, loss==0 or loops==0 (repeatable)")
+}
+
+// a hops tracker counts the copies of every message received from a broker
+type hops struct {
+	copies    map[uint64]int
+	latencies bench.Latencies
+	last      time.Time
+	done      chan struct{}
+	mutex     sync.Mutex
+}
+
+func newHops() *hops {
+	return &hops{
+		copies: make(map[uint64]int, *count),
+		done:   make(chan struct{}),
+	}
+}
+
+func (h *hops) add(payload []byte) {
+	header, err := bench.ParseHeader(payload)
+	if err != nil {
+		return
+	}
+
+	seq := header.Seq
+	sent := header.Time
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.copies[seq]++
+	h.last = time.Now()
+
+	// measure the latency of the first copy
+	if h.copies[seq] == 1 {
+		h.latencies.Add(time.Since(sent))
+
+		if len(h.copies) == *count {
+			close(h.done)
+		}
+	}
+}
+
+// stats returns the unique messages, the extra copies, the messages that have
+// been received more than once and the highest number of copies
+func (h *hops) stats() (unique, extra, looped, max int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, n := range h.copies {
+		extra += n - 1
+		if n > 1 {
+			looped++
+		}
+		if n > max {
+			max = n
+		}
+	}
+
+	return len(h.copies), extra, looped, max
+}
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start bridge benchmark from %s to %s on %s.\n", *urlA, *urlB, *topic)
+
+	result := bench.NewResult("bridge")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	// subscribe on both brokers, copies received from A reveal messages that
+	// are bridged back to their origin
+	remote := newHops()
+	local := newHops()
+
+	subscriberB := connect(*urlB, "bridge/sub/b", remote)
+	subscriberA := connect(*urlA, "bridge/sub/a", local)
+	publisher := connect(*urlA, "bridge/pub", nil)
+
+	// publish messages
+	start := time.Now()
+	schedule := bench.NewSchedule(float64(*rate), bench.NoJitter, start.UnixNano())
+	for seq := 0; seq < *count; seq++ {
+		payload := bench.NewPayload(*size)
+		bench.PutHeader(payload, bench.Header{Seq: uint64(seq), Time: time.Now()})
+
+		pf, err := publisher.Publish(*topic, payload, uint8(*qos), false)
+		if err == nil && *qos > 0 {
+			err = pf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			fmt.Println("publish", err)
+			os.Exit(1)
+		}
+
+		schedule.Wait()
+	}
+	publishTime := time.Since(start)
+
+	// wait for the bridged messages
+	select {
+	case <-remote.done:
+	case <-time.After(*timeout):
+	}
+
+	// wait until no more copies arrive, a loop may never settle
+	deadline := time.Now().Add(*timeout)
+	for time.Now().Before(deadline) {
+		remote.mutex.Lock()
+		last := remote.last
+		remote.mutex.Unlock()
+
+		local.mutex.Lock()
+		if local.last.After(last) {
+			last = local.last
+		}
+		local.mutex.Unlock()
+
+		wait := *settle - time.Since(last)
+		if wait <= 0 {
+			break
+		}
+
+		time.Sleep(wait)
+	}
+
+	publisher.Disconnect()
+	subscriberA.Disconnect()
+	subscriberB.Disconnect()
+
+	// collect metrics
+	received, duplicates, looped, maxB := remote.stats()
+	_, echoes, echoed, maxA := local.stats()
+
+	hopsMax := maxB
+	if maxA > hopsMax {
+		hopsMax = maxA
+	}
+
+	metrics := bench.Metrics{
+		"sent":       float64(*count),
+		"received":   float64(received),
+		"loss":       float64(*count-received) / float64(*count),
+		"duplicates": float64(duplicates),
+		"echoes":     float64(echoes),
+		"loops":      float64(looped + echoed),
+		"hops.max":   float64(hopsMax),
+		"publish":    publishTime.Seconds(),
+	}
+
+	remote.mutex.Lock()
+	for name, value := range remote.latencies.Metrics("latency.") {
+		metrics[name] = value
+	}
+	remote.mutex.Unlock()
+
+	fmt.Printf("Sent: %d msgs - Received: %d msgs (Loss: %.2f%%)\n", *count, received, metrics["loss"]*100)
+	fmt.Printf("Latency: p50 %s - p90 %s - p99 %s - max %s\n", seconds(metrics["latency.p50"]),
+		seconds(metrics["latency.p90"]), seconds(metrics["latency.p99"]), seconds(metrics["latency.max"]))
+	fmt.Printf("Duplicates on B: %d - Echoes on A: %d - Max copies: %d\n", duplicates, echoes, hopsMax)
+
+	if looped+echoed > 0 {
+		fmt.Printf("LOOP: %d messages have been routed more than once\n", looped+echoed)
+	}
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func connect(url, clientID string, tracker *hops) *client.Client {
+	c := client.New()
+	if tracker != nil {
+		c.Callback = func(msg *packet.Message, err error) error {
+			if err != nil {
+				fmt.Println("callback", err)
+				return nil
+			}
+
+			tracker.add(msg.Payload)
+
+			return nil
+		}
+	}
+
+	cf, err := c.Connect(&client.Config{
+		BrokerURL:    url,
+		ClientID:     clientID,
+		CleanSession: true,
+		KeepAlive:    "30s",
+	})
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	// subscribe to the bridged topic
+	if tracker != nil {
+		sf, err := c.Subscribe(*topic, uint8(*qos))
+		if err == nil {
+			err = sf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			fmt.Println("subscribe", err)
+			os.Exit(1)
+		}
+	}
+
+	return c
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
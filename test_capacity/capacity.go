@@ -0,0 +1,244 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+	"transport"
+)
+
+// 代理连接容量探测工具
+// 按步长逐级增加并发连接数，监测 CONNACK 拒绝与代理主动断开，报告代理开始拒绝或驱逐连接时的连接数，实现容量的自动发现
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var start = flag.Int("start", 1000, "number of connections of the first step")
+var step = flag.Int("step", 1000, "number of connections added per step")
+var maximum = flag.Int("max", 100000, "maximum number of connections")
+var rate = flag.Int("rate", 500, "connects per second")
+var hold = flag.Duration("hold", 10*time.Second, "time every step is held to detect evictions")
+var keepAlive = flag.Duration("keepalive", 30*time.Second, "keep alive of the connections")
+var timeout = flag.Duration("timeout", 10*time.Second, "timeout of a single connect")
+var tolerance = flag.Float64("tolerance", 0.01, "share of failed connects and evictions per step that ends the probe")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like capacity.limit>50000 (repeatable)")
+}
+
+var connected int64
+var evicted int64
+var limit int64 = -1
+
+var connects bench.Latencies
+var connackCodes = map[packet.ConnackCode]int64{}
+var connectFailures = map[transport.ErrorClass]int64{}
+var failuresMutex sync.Mutex
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start capacity probe of %s from %d to %d connections in steps of %d.\n", *urlString, *start, *maximum, *step)
+
+	result := bench.NewResult("capacity")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	// handle signals
+	stop := make(chan struct{})
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+
+		<-done
+		fmt.Println("Closing...")
+		close(stop)
+	}()
+
+	metrics := bench.Metrics{}
+
+	var clients []*client.Client
+	var mutex sync.Mutex
+	var next int
+
+	fmt.Println("Step  Target  Connected  Rejected  Evicted  Connect p50")
+
+	// increase connections in steps
+	steps := 0
+	target := *start
+	for target <= *maximum {
+		steps++
+
+		var rejected int64
+		evictedBefore := atomic.LoadInt64(&evicted)
+		added := target - int(atomic.LoadInt64(&connected))
+		limiter := bench.NewRateLimiter(float64(*rate))
+
+		// open new connections
+		var wg sync.WaitGroup
+		for i := 0; i < added; i++ {
+			if stopped(stop) {
+				break
+			}
+
+			limiter.Wait()
+
+			next++
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+
+				c, err := connect("capacity/" + strconv.Itoa(id))
+				if err != nil {
+					atomic.AddInt64(&rejected, 1)
+					observe()
+					return
+				}
+
+				mutex.Lock()
+				clients = append(clients, c)
+				mutex.Unlock()
+			}(next)
+		}
+
+		wg.Wait()
+
+		// hold step
+		select {
+		case <-time.After(*hold):
+		case <-stop:
+		}
+
+		stepEvicted := atomic.LoadInt64(&evicted) - evictedBefore
+		current := atomic.LoadInt64(&connected)
+
+		prefix := "step_" + strconv.Itoa(steps) + "."
+		metrics[prefix+"target"] = float64(target)
+		metrics[prefix+"connected"] = float64(current)
+		metrics[prefix+"rejected"] = float64(rejected)
+		metrics[prefix+"evicted"] = float64(stepEvicted)
+
+		fmt.Printf("%4d  %6d  %9d  %8d  %7d  %11s\n", steps, target, current, rejected, stepEvicted,
+			seconds(connects.Percentile(50)))
+
+		// check failures
+		if float64(rejected+stepEvicted) > *tolerance*float64(added) || stopped(stop) {
+			break
+		}
+
+		target += *step
+	}
+
+	// collect metrics
+	metrics["capacity.limit"] = float64(atomic.LoadInt64(&limit))
+	metrics["capacity.connected"] = float64(atomic.LoadInt64(&connected))
+	metrics["capacity.evicted"] = float64(atomic.LoadInt64(&evicted))
+	metrics["capacity.steps"] = float64(steps)
+
+	for name, value := range connects.Metrics("connect.") {
+		metrics[name] = value
+	}
+
+	failuresMutex.Lock()
+	for code, n := range connackCodes {
+		metrics["connack."+code.Name()] = float64(n)
+	}
+	for class, n := range connectFailures {
+		metrics["connect.failures."+class.String()] = float64(n)
+	}
+	failuresMutex.Unlock()
+
+	if metrics["capacity.limit"] < 0 {
+		fmt.Printf("No rejections or evictions up to %.0f connections.\n", metrics["capacity.connected"])
+	} else {
+		fmt.Printf("Broker started rejecting or evicting at %.0f connections.\n", metrics["capacity.limit"])
+	}
+
+	// close connections
+	mutex.Lock()
+	for _, c := range clients {
+		c.Close()
+	}
+	mutex.Unlock()
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func connect(clientID string) (*client.Client, error) {
+	c := client.New()
+	c.Hooks.OnDisconnect = func(err error) {
+		// closes by the tool are reported without an error
+		if err == nil {
+			return
+		}
+
+		atomic.AddInt64(&connected, -1)
+		atomic.AddInt64(&evicted, 1)
+		observe()
+	}
+
+	begin := time.Now()
+
+	cf, err := c.Connect(&client.Config{
+		BrokerURL:    *urlString,
+		ClientID:     clientID,
+		CleanSession: true,
+		KeepAlive:    keepAlive.String(),
+	})
+	if err == nil {
+		err = cf.Wait(*timeout)
+	}
+
+	// record outcome
+	failuresMutex.Lock()
+	if err == nil {
+		connackCodes[packet.ConnectionAccepted]++
+	} else if cf != nil && cf.ReturnCode() != packet.ConnectionAccepted {
+		connackCodes[cf.ReturnCode()]++
+	} else {
+		connectFailures[transport.ClassifyError(err)]++
+	}
+	failuresMutex.Unlock()
+
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	connects.Add(time.Since(begin))
+	atomic.AddInt64(&connected, 1)
+
+	return c, nil
+}
+
+// observe records the connection count at the first rejection or eviction
+func observe() {
+	atomic.CompareAndSwapInt64(&limit, -1, atomic.LoadInt64(&connected))
+}
+
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+)
+
+// 订阅/退订抖动测试工具
+// 在稳定的发布流量下，由一组客户端以固定速率持续订阅和退订相同的主题，对比无抖动阶段与抖动阶段的投递延迟，评估订阅表争用对消息投递的影响
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var topics = flag.Int("topics", 10, "number of topics")
+var subscribers = flag.Int("subscribers", 10, "number of steady subscribers per topic")
+var churners = flag.Int("churners", 10, "number of clients that subscribe and unsubscribe")
+var churnRate = flag.Int("churn-rate", 100, "subscribes and unsubscribes per second across all churners")
+var rate = flag.Int("rate", 100, "messages published per second")
+var baseline = flag.Duration("baseline", 10*time.Second, "duration of the phase without churn")
+var duration = flag.Duration("duration", 30*time.Second, "duration of the phase with churn")
+var qos = flag.Uint("qos", 0, "sub and pub qos level")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like churn.p99<50ms or churn.slowdown<2 (repeatable)")
+}
+
+var latencies atomic.Value
+var received int64
+
+var subscribeTimes bench.Latencies
+var unsubscribeTimes bench.Latencies
+var churnFailures int64
+
+var window *bench.Window
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start churn benchmark of %s using %d topics, %d subscribers and %d churners.\n",
+		*urlString, *topics, *topics**subscribers, *churners)
+
+	result := bench.NewResult("churn")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+	latencies.Store(&bench.Latencies{})
+	window = bench.NewWindow(result.Start)
+
+	// connect steady subscribers
+	var steady []*client.Client
+	for i := 0; i < *topics; i++ {
+		for j := 0; j < *subscribers; j++ {
+			c := connect("churn/sub/"+strconv.Itoa(i)+"/"+strconv.Itoa(j), func(msg *packet.Message, err error) error {
+				if err != nil {
+					fmt.Println("callback", err)
+					return nil
+				}
+
+				if len(msg.Payload) >= 8 {
+					sent := int64(binary.BigEndian.Uint64(msg.Payload))
+					latency := time.Duration(time.Now().UnixNano() - sent)
+					latencies.Load().(*bench.Latencies).Add(latency)
+					window.Observe(latency)
+				} else {
+					window.Add(1)
+				}
+
+				atomic.AddInt64(&received, 1)
+
+				return nil
+			})
+
+			sf, err := c.Subscribe(name(i), uint8(*qos))
+			if err == nil {
+				err = sf.Wait(10 * time.Second)
+			}
+			if err != nil {
+				fmt.Println("subscribe", err)
+				os.Exit(1)
+			}
+
+			steady = append(steady, c)
+		}
+	}
+
+	publisher := connect("churn/pub", nil)
+
+	// handle signals
+	stop := make(chan struct{})
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+
+		<-done
+		fmt.Println("Closing...")
+		close(stop)
+	}()
+
+	// publish until stopped
+	var sent int64
+	var publishing sync.WaitGroup
+	stopPublishing := make(chan struct{})
+	publishing.Add(1)
+	go func() {
+		defer publishing.Done()
+
+		limiter := bench.NewRateLimiter(float64(*rate))
+		for i := 0; ; i++ {
+			select {
+			case <-stopPublishing:
+				return
+			default:
+			}
+
+			limiter.Wait()
+
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+
+			_, err := publisher.Publish(name(i%*topics), payload, uint8(*qos), false)
+			if err != nil {
+				fmt.Println("publish", err)
+				os.Exit(1)
+			}
+
+			atomic.AddInt64(&sent, 1)
+		}
+	}()
+
+	// record intervals until stopped
+	go func() {
+		for {
+			select {
+			case <-time.After(time.Second):
+			case <-stopPublishing:
+				return
+			}
+
+			result.AddInterval(window.Flush(time.Now()))
+		}
+	}()
+
+	metrics := bench.Metrics{}
+
+	fmt.Println("Phase     Sent  Received  Subscribes  Unsubscribes  p50  p90  p99  max")
+
+	// measure without churn
+	measure("baseline", *baseline, &sent, stop, metrics)
+
+	// measure with churn
+	var wg sync.WaitGroup
+	churning := make(chan struct{})
+	limiter := bench.NewRateLimiter(float64(*churnRate))
+	for i := 0; i < *churners; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			churn(id, limiter, churning)
+		}(i)
+	}
+
+	measure("churn", *duration, &sent, stop, metrics)
+
+	close(churning)
+	wg.Wait()
+
+	// add churn metrics
+	metrics["churn.subscribes"] = float64(subscribeTimes.Len())
+	metrics["churn.unsubscribes"] = float64(unsubscribeTimes.Len())
+	metrics["churn.failures"] = float64(atomic.LoadInt64(&churnFailures))
+	metrics["churn.rate"] = float64(subscribeTimes.Len()+unsubscribeTimes.Len()) / duration.Seconds()
+
+	for key, value := range subscribeTimes.Metrics("churn.subscribe.") {
+		metrics[key] = value
+	}
+
+	for key, value := range unsubscribeTimes.Metrics("churn.unsubscribe.") {
+		metrics[key] = value
+	}
+
+	// compare phases
+	if metrics["baseline.p99"] > 0 {
+		metrics["churn.slowdown"] = metrics["churn.p99"] / metrics["baseline.p99"]
+	}
+
+	fmt.Printf("Churn: %.0f ops/s (Failures: %.0f) - Suback p99: %s - Unsuback p99: %s - Delivery p99 slowdown: %.2fx\n",
+		metrics["churn.rate"], metrics["churn.failures"], seconds(metrics["churn.subscribe.p99"]),
+		seconds(metrics["churn.unsubscribe.p99"]), metrics["churn.slowdown"])
+
+	// disconnect clients
+	close(stopPublishing)
+	publishing.Wait()
+	publisher.Disconnect()
+
+	for _, c := range steady {
+		c.Disconnect()
+	}
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func measure(phase string, d time.Duration, sent *int64, stop chan struct{}, metrics bench.Metrics) {
+	// reset counters
+	step := &bench.Latencies{}
+	latencies.Store(step)
+	atomic.StoreInt64(&received, 0)
+	startSent := atomic.LoadInt64(sent)
+	startSubscribes := subscribeTimes.Len()
+	startUnsubscribes := unsubscribeTimes.Len()
+
+	select {
+	case <-time.After(d):
+	case <-stop:
+		fmt.Println("Finishing...")
+	}
+
+	prefix := phase + "."
+	for key, value := range step.Metrics(prefix) {
+		metrics[key] = value
+	}
+
+	metrics[prefix+"sent"] = float64(atomic.LoadInt64(sent) - startSent)
+	metrics[prefix+"received"] = float64(atomic.LoadInt64(&received))
+
+	fmt.Printf("%-8s  %4.0f  %8.0f  %10d  %12d  %s  %s  %s  %s\n", phase, metrics[prefix+"sent"],
+		metrics[prefix+"received"], subscribeTimes.Len()-startSubscribes, unsubscribeTimes.Len()-startUnsubscribes,
+		seconds(metrics[prefix+"p50"]), seconds(metrics[prefix+"p90"]), seconds(metrics[prefix+"p99"]),
+		seconds(metrics[prefix+"max"]))
+}
+
+func churn(id int, limiter *bench.RateLimiter, stop chan struct{}) {
+	c := connect("churn/churner/"+strconv.Itoa(id), func(msg *packet.Message, err error) error {
+		return nil
+	})
+	defer c.Disconnect()
+
+	for i := id; ; i++ {
+		t := name(i % *topics)
+
+		// subscribe
+		limiter.Wait()
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		start := time.Now()
+		sf, err := c.Subscribe(t, uint8(*qos))
+		if err == nil {
+			err = sf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			atomic.AddInt64(&churnFailures, 1)
+			window.Fail()
+			fmt.Println("subscribe", err)
+			continue
+		}
+
+		subscribeTimes.Add(time.Since(start))
+
+		// unsubscribe
+		limiter.Wait()
+
+		start = time.Now()
+		uf, err := c.Unsubscribe(t)
+		if err == nil {
+			err = uf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			atomic.AddInt64(&churnFailures, 1)
+			window.Fail()
+			fmt.Println("unsubscribe", err)
+			continue
+		}
+
+		unsubscribeTimes.Add(time.Since(start))
+	}
+}
+
+func connect(clientID string, callback client.Callback) *client.Client {
+	c := client.New()
+	c.Callback = callback
+
+	cf, err := c.Connect(&client.Config{
+		BrokerURL:    *urlString,
+		ClientID:     clientID,
+		CleanSession: true,
+		KeepAlive:    "30s",
+	})
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	return c
+}
+
+func name(i int) string {
+	return "churn/" + strconv.Itoa(i)
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
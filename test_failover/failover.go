@@ -0,0 +1,345 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+)
+
+// 集群代理故障转移测试工具
+// 终止订阅者所连接的集群节点后重新连接到其他节点，验证持久会话的订阅与离线消息在故障转移后依然保留，并按每次故障事件统计消息丢失
+
+var urls = flag.String("urls", "tcp://127.0.0.1:1883,tcp://127.0.0.1:1884,tcp://127.0.0.1:1885", "comma separated urls of the cluster nodes")
+var kill = flag.String("kill", "", "command that kills a node, {node} and {url} are replaced with the index and url of the node")
+var restart = flag.String("restart", "", "command that restarts a killed node, supports the same placeholders as -kill")
+var recovery = flag.Duration("recovery", 5*time.Second, "time to wait after restarting a node")
+var events = flag.Int("events", 3, "number of failover events")
+var topic = flag.String("topic", "failover/test", "topic the messages are published to")
+var count = flag.Int("count", 100, "number of messages published in every phase of an event")
+var rate = flag.Int("rate", 100, "publish rate in messages per second")
+var size = flag.Int("size", 64, "payload size in bytes")
+var qos = flag.Uint("qos", 1, "sub and pub qos level")
+var timeout = flag.Duration("timeout", 30*time.Second, "maximum time to wait for the messages of a phase")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like queued.loss==0, subscriptions.lost==0 or failover.max<5s (repeatable)")
+}
+
+const subscriberID = "failover/sub"
+
+// The phases of a failover event.
+const (
+	phaseLive   = "live"
+	phaseQueued = "queued"
+	phaseAfter  = "after"
+)
+
+var phases = []string{phaseLive, phaseQueued, phaseAfter}
+
+// a tracker records the messages received by the subscriber
+type tracker struct {
+	copies     map[uint64]int
+	duplicates int
+	mutex      sync.Mutex
+}
+
+func (t *tracker) add(seq uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.copies[seq]++
+	if t.copies[seq] > 1 {
+		t.duplicates++
+	}
+}
+
+// received returns the number of distinct messages in the range
+func (t *tracker) received(from, to uint64) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	n := 0
+	for seq := from; seq < to; seq++ {
+		if t.copies[seq] > 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// wait waits until all messages in the range have been received or the
+// timeout is reached
+func (t *tracker) wait(from, to uint64) int {
+	deadline := time.Now().Add(*timeout)
+	for {
+		n := t.received(from, to)
+		if n == int(to-from) || time.Now().After(deadline) {
+			return n
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	// parse nodes
+	var nodes []string
+	for _, str := range strings.Split(*urls, ",") {
+		if str = strings.TrimSpace(str); str != "" {
+			nodes = append(nodes, str)
+		}
+	}
+
+	if len(nodes) < 2 {
+		fmt.Println("at least two nodes are required")
+		os.Exit(2)
+	}
+	if *kill == "" {
+		fmt.Println("a kill command is required")
+		os.Exit(2)
+	}
+
+	fmt.Printf("Start failover test of %d nodes with %d events.\n", len(nodes), *events)
+
+	result := bench.NewResult("failover")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	t := &tracker{
+		copies: map[uint64]int{},
+	}
+
+	// create the persistent session on the first node
+	connect(nodes[0], subscriberID, true, nil).Disconnect()
+	subscriber := connect(nodes[0], subscriberID, false, t.callback)
+
+	sf, err := subscriber.Subscribe(*topic, uint8(*qos))
+	if err == nil {
+		err = sf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("subscribe", err)
+		os.Exit(1)
+	}
+
+	metrics := bench.Metrics{}
+	var failover bench.Latencies
+	expected := map[string]int{}
+	received := map[string]int{}
+	sessionsLost := 0
+	subscriptionsLost := 0
+	var seq uint64
+
+	fmt.Println("Event  Killed  Target  Failover  Session  Live  Queued  After")
+
+	for event := 1; event <= *events; event++ {
+		killed := (event - 1) % len(nodes)
+		target := event % len(nodes)
+
+		// publish through the node that will take over
+		publisher := connect(nodes[target], "failover/pub", true, nil)
+
+		prefix := "event_" + strconv.Itoa(event) + "."
+		counts := map[string]int{}
+
+		// publish while the subscriber is attached
+		from := seq
+		seq = publish(publisher, seq)
+		counts[phaseLive] = t.wait(from, seq)
+
+		// kill the node of the subscriber
+		killStart := time.Now()
+		run(*kill, killed, nodes[killed])
+		killTime := time.Since(killStart)
+
+		// publish while the subscriber is offline
+		queuedFrom := seq
+		seq = publish(publisher, seq)
+		queuedTo := seq
+
+		// reconnect to the target node without subscribing again
+		subscriber.Close()
+		subscriber = client.New()
+		subscriber.Callback = t.callback
+
+		reconnectStart := time.Now()
+		cf, err := subscriber.Connect(config(nodes[target], subscriberID, false))
+		if err == nil {
+			err = cf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			fmt.Println("reconnect", err)
+			os.Exit(1)
+		}
+
+		// the failover spans the kill and the reconnect but not the publishes
+		// of the queued phase in between
+		failoverTime := killTime + time.Since(reconnectStart)
+		failover.Add(failoverTime)
+
+		session := cf.SessionPresent()
+		if !session {
+			sessionsLost++
+		}
+
+		// publish after the failover
+		afterFrom := seq
+		seq = publish(publisher, seq)
+
+		counts[phaseQueued] = t.wait(queuedFrom, queuedTo)
+		counts[phaseAfter] = t.wait(afterFrom, seq)
+		if counts[phaseAfter] == 0 {
+			subscriptionsLost++
+		}
+
+		publisher.Disconnect()
+
+		// collect event metrics
+		metrics[prefix+"failover"] = failoverTime.Seconds()
+		metrics[prefix+"session"] = boolMetric(session)
+		for _, phase := range phases {
+			metrics[prefix+phase+".loss"] = float64(*count-counts[phase]) / float64(*count)
+			expected[phase] += *count
+			received[phase] += counts[phase]
+		}
+
+		fmt.Printf("%5d  %6d  %6d  %8s  %7t  %4d  %6d  %5d\n", event, killed, target, failoverTime.Round(time.Millisecond),
+			session, counts[phaseLive], counts[phaseQueued], counts[phaseAfter])
+
+		// restart the killed node
+		if *restart != "" {
+			run(*restart, killed, nodes[killed])
+			time.Sleep(*recovery)
+		}
+	}
+
+	// clean up session
+	subscriber.Close()
+	connect(nodes[*events%len(nodes)], subscriberID, true, nil).Disconnect()
+
+	// collect metrics
+	totalExpected, totalReceived := 0, 0
+	for _, phase := range phases {
+		metrics[phase+".loss"] = float64(expected[phase]-received[phase]) / float64(expected[phase])
+		totalExpected += expected[phase]
+		totalReceived += received[phase]
+	}
+
+	metrics["loss"] = float64(totalExpected-totalReceived) / float64(totalExpected)
+	metrics["duplicates"] = float64(t.duplicates)
+	metrics["sessions.lost"] = float64(sessionsLost)
+	metrics["subscriptions.lost"] = float64(subscriptionsLost)
+	for name, value := range failover.Metrics("failover.") {
+		metrics[name] = value
+	}
+
+	fmt.Printf("Loss: %.2f%% (live %.2f%% - queued %.2f%% - after %.2f%%) - Duplicates: %d\n", metrics["loss"]*100,
+		metrics["live.loss"]*100, metrics["queued.loss"]*100, metrics["after.loss"]*100, t.duplicates)
+	fmt.Printf("Sessions lost: %d - Subscriptions lost: %d - Failover: p50 %s - max %s\n", sessionsLost,
+		subscriptionsLost, seconds(metrics["failover.p50"]), seconds(metrics["failover.max"]))
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func (t *tracker) callback(msg *packet.Message, err error) error {
+	if err != nil {
+		// the connection is expected to fail when the node is killed
+		return nil
+	}
+
+	header, err := bench.ParseHeader(msg.Payload)
+	if err == nil {
+		t.add(header.Seq)
+	}
+
+	return nil
+}
+
+// publish publishes a phase of messages starting at the sequence number and
+// returns the next sequence number
+func publish(c *client.Client, seq uint64) uint64 {
+	for i := 0; i < *count; i++ {
+		payload := bench.NewPayload(*size)
+		bench.PutHeader(payload, bench.Header{Seq: seq, Time: time.Now()})
+		seq++
+
+		pf, err := c.Publish(*topic, payload, uint8(*qos), false)
+		if err == nil && *qos > 0 {
+			err = pf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			fmt.Println("publish", err)
+			os.Exit(1)
+		}
+
+		time.Sleep(time.Second / time.Duration(*rate))
+	}
+
+	return seq
+}
+
+// run runs a node command with the placeholders replaced
+func run(command string, node int, url string) {
+	command = strings.NewReplacer("{node}", strconv.Itoa(node), "{url}", url).Replace(command)
+
+	output, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil {
+		fmt.Printf("command %q failed: %s\n%s", command, err, output)
+		os.Exit(1)
+	}
+}
+
+func config(url, clientID string, cleanSession bool) *client.Config {
+	return &client.Config{
+		BrokerURL:    url,
+		ClientID:     clientID,
+		CleanSession: cleanSession,
+		KeepAlive:    "30s",
+	}
+}
+
+func connect(url, clientID string, cleanSession bool, callback client.Callback) *client.Client {
+	c := client.New()
+	c.Callback = callback
+
+	cf, err := c.Connect(config(url, clientID, cleanSession))
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	return c
+}
+
+func boolMetric(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Millisecond)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+	"transport"
+)
+
+// 边缘网关设备群模拟工具
+// 模拟物联网设备群：数万个客户端各自以每分钟一条的低频率向独立主题发布消息，重点测量每连接内存占用与稀疏流量下的端到端延迟，而非最大吞吐
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var clients = flag.Int("clients", 10000, "number of simulated devices")
+var interval = flag.Duration("interval", time.Minute, "publish interval of every device")
+var connectRate = flag.Int("connect-rate", 500, "connections opened per second while ramping up")
+var duration = flag.Duration("duration", 5*time.Minute, "duration of the traffic phase after all devices are connected")
+var size = flag.Int("size", 64, "payload size in bytes")
+var qos = flag.Uint("qos", 0, "pub and sub qos level")
+var brokerPID = flag.Int("broker-pid", 0, "pid of a local broker whose resident memory is measured (linux only)")
+var drain = flag.Duration("drain", 5*time.Second, "time to wait for in flight messages after the traffic phase")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like latency.p99<100ms or memory.broker<20000 (repeatable)")
+}
+
+var sent int64
+var received int64
+var latencies bench.Latencies
+var connectTimes bench.Latencies
+
+// closed to stop the devices
+var stop = make(chan struct{})
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start fleet simulation of %s with %d devices publishing every %s.\n", *urlString, *clients, *interval)
+
+	result := bench.NewResult("fleet")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	// subscribe to all devices
+	subscriber := subscribe()
+
+	// measure memory before connecting
+	toolBefore := toolMemory()
+	brokerBefore, _ := brokerMemory()
+
+	// connect devices, every device starts publishing as soon as it is
+	// connected to keep its connection alive during the ramp up
+	fmt.Printf("Connect %d devices at %d/s...\n", *clients, *connectRate)
+	conns := make([]transport.Conn, 0, *clients)
+	limiter := bench.NewRateLimiter(float64(*connectRate))
+	failures := 0
+	start := time.Now()
+	var group sync.WaitGroup
+	for i := 0; i < *clients; i++ {
+		limiter.Wait()
+
+		conn, err := connect(i)
+		if err != nil {
+			failures++
+			continue
+		}
+
+		conns = append(conns, conn)
+
+		group.Add(1)
+		go func(i int, conn transport.Conn) {
+			defer group.Done()
+			device(i, conn)
+		}(i, conn)
+	}
+
+	// measure memory after connecting
+	metrics := bench.Metrics{
+		"clients":          float64(*clients),
+		"connected":        float64(len(conns)),
+		"connect.failures": float64(failures),
+	}
+	for name, value := range connectTimes.Metrics("connect.") {
+		metrics[name] = value
+	}
+
+	if len(conns) > 0 {
+		metrics["memory.client"] = float64(toolMemory()-toolBefore) / float64(len(conns))
+
+		brokerAfter, err := brokerMemory()
+		if err == nil && *brokerPID > 0 {
+			metrics["memory.broker"] = float64(brokerAfter-brokerBefore) / float64(len(conns))
+		} else if err != nil {
+			fmt.Println("Failed to read broker memory:", err)
+		}
+	}
+
+	fmt.Printf("Connected: %d devices (%d failures) - Memory per connection: tool %.0f B", len(conns), failures, metrics["memory.client"])
+	if value, ok := metrics["memory.broker"]; ok {
+		fmt.Printf(" - broker %.0f B", value)
+	}
+	fmt.Println()
+
+	// publish sparse traffic with staggered devices
+	fmt.Printf("Publish for %s...\n", *duration)
+	time.Sleep(*duration)
+	close(stop)
+	elapsed := time.Since(start)
+
+	// wait for in flight messages
+	time.Sleep(*drain)
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	group.Wait()
+	subscriber.Disconnect()
+
+	// collect metrics
+	totalSent := atomic.LoadInt64(&sent)
+	totalReceived := atomic.LoadInt64(&received)
+
+	metrics["sent"] = float64(totalSent)
+	metrics["received"] = float64(totalReceived)
+	metrics["rate"] = float64(totalSent) / elapsed.Seconds()
+	if totalSent > 0 {
+		metrics["loss"] = float64(totalSent-totalReceived) / float64(totalSent)
+	}
+	for name, value := range latencies.Metrics("latency.") {
+		metrics[name] = value
+	}
+
+	fmt.Printf("Sent: %d msgs (%.1f msg/s) - Received: %d msgs (Loss: %.2f%%)\n", totalSent, metrics["rate"],
+		totalReceived, metrics["loss"]*100)
+	fmt.Printf("Latency: p50 %s - p90 %s - p99 %s - max %s\n", seconds(metrics["latency.p50"]),
+		seconds(metrics["latency.p90"]), seconds(metrics["latency.p99"]), seconds(metrics["latency.max"]))
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+// device publishes on its own topic once per interval, the first publish is
+// delayed randomly to spread the devices over the interval. Pings are sent in
+// between if the interval exceeds half of the keep alive.
+func device(i int, conn transport.Conn) {
+	publish := packet.NewPublishPacket()
+	publish.Message.Topic = "fleet/" + strconv.Itoa(i)
+	publish.Message.Payload = bench.NewPayload(*size)
+	publish.Message.QOS = uint8(*qos)
+
+	next := time.Now().Add(time.Duration(rand.Int63n(int64(*interval))))
+	ping := keepAlive() / 2
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	id := packet.ID(1)
+	for {
+		// wait for the next publish or ping
+		wait := time.Until(next)
+		pinging := wait > ping
+		if pinging {
+			wait = ping
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(wait)
+		} else {
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-timer.C:
+		case <-stop:
+			return
+		}
+
+		if pinging {
+			err := conn.Send(packet.NewPingreqPacket())
+			if err == nil {
+				_, err = conn.Receive()
+			}
+			if err != nil {
+				return
+			}
+
+			continue
+		}
+
+		next = next.Add(*interval)
+
+		if publish.Message.QOS > 0 {
+			if id == 0 {
+				id = 1
+			}
+			publish.ID = id
+		}
+
+		bench.PutHeader(publish.Message.Payload, bench.Header{Seq: uint64(id), Time: time.Now()})
+
+		err := conn.Send(publish)
+		if err != nil {
+			return
+		}
+
+		// wait for the acknowledgment
+		if publish.Message.QOS > 0 {
+			_, err = conn.Receive()
+			if err != nil {
+				return
+			}
+		}
+
+		atomic.AddInt64(&sent, 1)
+		id++
+	}
+}
+
+// keepAlive returns the keep alive of the devices, which is twice the interval
+// up to the maximum of the protocol
+func keepAlive() time.Duration {
+	keepAlive := 2 * *interval
+	if max := time.Duration(math.MaxUint16) * time.Second; keepAlive > max {
+		keepAlive = max
+	}
+
+	return keepAlive
+}
+
+// connect opens the connection of a device
+func connect(i int) (transport.Conn, error) {
+	start := time.Now()
+
+	conn, err := transport.Dial(*urlString)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the connection alive with the publishes
+	connect := packet.NewConnectPacket()
+	connect.ClientID = "fleet/" + strconv.Itoa(i)
+	connect.CleanSession = true
+	connect.KeepAlive = uint16(keepAlive().Seconds())
+
+	err = conn.Send(connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	pkt, err := conn.Receive()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	connack, ok := pkt.(*packet.ConnackPacket)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("expected connack but got %s", pkt.Type())
+	} else if connack.ReturnCode != packet.ConnectionAccepted {
+		conn.Close()
+		return nil, connack.ReturnCode
+	}
+
+	connectTimes.Add(time.Since(start))
+
+	return conn, nil
+}
+
+// subscribe connects a client that receives the messages of all devices
+func subscribe() *client.Client {
+	c := client.New()
+	c.Callback = func(msg *packet.Message, err error) error {
+		if err != nil {
+			fmt.Println("callback", err)
+			return nil
+		}
+
+		header, err := bench.ParseHeader(msg.Payload)
+		if err == nil {
+			latencies.Add(header.Latency(time.Now()))
+		}
+
+		atomic.AddInt64(&received, 1)
+
+		return nil
+	}
+
+	cf, err := c.Connect(client.NewConfigWithClientID(*urlString, "fleet/sub"))
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	sf, err := c.Subscribe("fleet/+", uint8(*qos))
+	if err == nil {
+		err = sf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("subscribe", err)
+		os.Exit(1)
+	}
+
+	return c
+}
+
+// toolMemory returns the heap and stack memory in use by the tool
+func toolMemory() uint64 {
+	runtime.GC()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return stats.HeapInuse + stats.StackInuse
+}
+
+// brokerMemory returns the resident memory of the broker process in bytes
+func brokerMemory() (uint64, error) {
+	if *brokerPID <= 0 {
+		return 0, nil
+	}
+
+	file, err := os.Open("/proc/" + strconv.Itoa(*brokerPID) + "/status")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+
+			return kb * 1024, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no resident memory in status of %d", *brokerPID)
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"bench"
+	"transport"
+)
+
+// TLS 握手压力测试工具
+// 以目标速率只建立 TCP 连接并完成 TLS 握手，不发送任何 MQTT 报文，单独测量代理 TLS 终结能力的吞吐量与失败率
+
+var address = flag.String("address", "127.0.0.1:8883", "broker tls address")
+var serverName = flag.String("server-name", "", "server name used for SNI and verification (defaults to the host of the address)")
+var insecure = flag.Bool("insecure", false, "skip the verification of the server certificate")
+var ocspStaple = flag.Bool("ocsp-staple", false, "require a stapled ocsp response for the server certificate")
+var crls = flag.String("crl", "", "comma separated revocation lists the server certificates are checked against")
+var resume = flag.Bool("resume", false, "resume sessions using tickets to measure abbreviated handshakes")
+var rate = flag.Int("rate", 100, "handshakes per second")
+var workers = flag.Int("workers", 100, "maximum number of concurrent handshakes")
+var timeout = flag.Duration("timeout", 10*time.Second, "timeout of a single handshake")
+var duration = flag.Duration("duration", 30*time.Second, "duration of the benchmark")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like throughput>500 or failures==0 (repeatable)")
+}
+
+var handshakes int64
+var resumed int64
+var failures int64
+
+var failureClasses = map[transport.ErrorClass]int64{}
+var failureClassesMutex sync.Mutex
+
+var connectTimes bench.Latencies
+var handshakeTimes bench.Latencies
+var verifyTimes bench.Latencies
+
+var window *bench.Window
+
+func main() {
+	flag.Parse()
+
+	// prepare tls config
+	host, _, err := net.SplitHostPort(*address)
+	if err != nil {
+		fmt.Println("invalid address:", *address)
+		os.Exit(2)
+	}
+
+	config := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: *insecure,
+	}
+
+	if *serverName != "" {
+		config.ServerName = *serverName
+	}
+
+	// check revocation
+	if *ocspStaple || *crls != "" {
+		check := &transport.RevocationCheck{
+			RequireOCSPStaple: *ocspStaple,
+			Handler: func(latency time.Duration, err error) {
+				verifyTimes.Add(latency)
+			},
+		}
+
+		if *crls != "" {
+			for _, path := range strings.Split(*crls, ",") {
+				crl, err := transport.LoadCRL(path)
+				if err != nil {
+					fmt.Println("invalid crl:", err)
+					os.Exit(2)
+				}
+
+				check.CRLs = append(check.CRLs, crl)
+			}
+		}
+
+		config = check.Apply(config)
+	}
+
+	if *resume {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(*workers)
+	}
+
+	fmt.Printf("Start TLS handshake benchmark of %s at %d handshakes/s using %d workers for %s.\n", *address, *rate, *workers, *duration)
+
+	result := bench.NewResult("handshake")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+	window = bench.NewWindow(result.Start)
+	stop := make(chan struct{})
+
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+
+		select {
+		case <-done:
+			fmt.Println("Closing...")
+		case <-time.After(*duration):
+			fmt.Println("Finishing...")
+		}
+
+		close(stop)
+	}()
+
+	// report progress
+	go func() {
+		var last int64
+
+		for {
+			select {
+			case <-time.After(time.Second):
+			case <-stop:
+				return
+			}
+
+			result.AddInterval(window.Flush(time.Now()))
+
+			cur := atomic.LoadInt64(&handshakes)
+			fmt.Printf("Handshakes: %d/s - Total: %d (Resumed: %d) - Failures: %d - Handshake p50: %s\n",
+				cur-last, cur, atomic.LoadInt64(&resumed), atomic.LoadInt64(&failures),
+				seconds(handshakeTimes.Percentile(50)))
+
+			last = cur
+		}
+	}()
+
+	// run workers paced by a shared limiter
+	limiter := bench.NewRateLimiter(float64(*rate))
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				limiter.Wait()
+
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				handshake(config)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// collect metrics
+	elapsed := time.Since(result.Start).Seconds()
+	metrics := bench.Metrics{
+		"handshakes": float64(atomic.LoadInt64(&handshakes)),
+		"resumed":    float64(atomic.LoadInt64(&resumed)),
+		"failures":   float64(atomic.LoadInt64(&failures)),
+		"throughput": float64(atomic.LoadInt64(&handshakes)) / elapsed,
+	}
+
+	for name, value := range connectTimes.Metrics("connect.") {
+		metrics[name] = value
+	}
+
+	for name, value := range handshakeTimes.Metrics("handshake.") {
+		metrics[name] = value
+	}
+
+	if *ocspStaple || *crls != "" {
+		for name, value := range verifyTimes.Metrics("verify.") {
+			metrics[name] = value
+		}
+	}
+
+	failureClassesMutex.Lock()
+	for class, n := range failureClasses {
+		metrics["failures."+class.String()] = float64(n)
+	}
+	failureClassesMutex.Unlock()
+
+	fmt.Printf("Handshakes: %.0f (Resumed: %.0f) - Failures: %.0f - Throughput: %.0f/s - Connect p99: %s - Handshake p50: %s p99: %s\n",
+		metrics["handshakes"], metrics["resumed"], metrics["failures"], metrics["throughput"],
+		seconds(metrics["connect.p99"]), seconds(metrics["handshake.p50"]), seconds(metrics["handshake.p99"]))
+
+	// write result and check thresholds
+	result.Duration = elapsed
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func handshake(config *tls.Config) {
+	// connect
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", *address, *timeout)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	defer conn.Close()
+
+	connectTimes.Add(time.Since(start))
+
+	// perform handshake only
+	start = time.Now()
+	conn.SetDeadline(start.Add(*timeout))
+
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.Handshake()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	elapsed := time.Since(start)
+	handshakeTimes.Add(elapsed)
+	window.Observe(elapsed)
+	atomic.AddInt64(&handshakes, 1)
+
+	if tlsConn.ConnectionState().DidResume {
+		atomic.AddInt64(&resumed, 1)
+	}
+}
+
+func fail(err error) {
+	atomic.AddInt64(&failures, 1)
+	window.Fail()
+
+	failureClassesMutex.Lock()
+	failureClasses[transport.ClassifyError(err)]++
+	failureClassesMutex.Unlock()
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+)
+
+// 离线消息队列深度测试工具
+// 持久会话订阅者断开后向其主题发布 N 条消息，再重新连接，测量随队列深度增长代理下发离线消息的耗时与丢失率，评估代理持久化性能
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var subscribers = flag.Int("subscribers", 1, "number of persistent session subscribers")
+var depths = flag.String("depths", "100,1000,10000", "comma separated numbers of queued messages to measure")
+var size = flag.Int("size", 64, "payload size in bytes")
+var qos = flag.Uint("qos", 1, "sub and pub qos level")
+var timeout = flag.Duration("timeout", time.Minute, "maximum time to wait for the queued messages")
+var offline = flag.Duration("offline", 0, "time the subscribers stay offline after the messages have been published")
+var ttl = flag.Duration("ttl", 0, "message ttl configured on the broker to classify undelivered messages as expired or lost (0 disables)")
+var ttlTolerance = flag.Duration("ttl-tolerance", time.Second, "tolerance of the broker when expiring messages")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like depth_10000.flush<5s or depth_10000.loss==0 (repeatable)")
+}
+
+// a tracker counts the unique messages received by a subscriber
+type tracker struct {
+	seen       map[uint64]bool
+	duplicates int
+	first      time.Time
+	last       time.Time
+	done       chan struct{}
+	expected   int
+	mutex      sync.Mutex
+}
+
+func (t *tracker) reset(expected int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.seen = make(map[uint64]bool, expected)
+	t.duplicates = 0
+	t.first = time.Time{}
+	t.last = time.Time{}
+	t.done = make(chan struct{})
+	t.expected = expected
+}
+
+func (t *tracker) add(seq uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if t.first.IsZero() {
+		t.first = now
+	}
+
+	if t.seen[seq] {
+		t.duplicates++
+		return
+	}
+
+	t.seen[seq] = true
+	t.last = now
+
+	if len(t.seen) == t.expected {
+		close(t.done)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	// parse depths
+	var targets []int
+	for _, str := range strings.Split(*depths, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil || n <= 0 {
+			fmt.Println("invalid depth:", str)
+			os.Exit(2)
+		}
+
+		targets = append(targets, n)
+	}
+
+	fmt.Printf("Start offline queue benchmark of %s using %d subscribers.\n", *urlString, *subscribers)
+
+	result := bench.NewResult("offline")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+	publisher := connect("offline/pub", true, nil)
+
+	// create persistent sessions
+	trackers := make([]*tracker, *subscribers)
+	for i := range trackers {
+		trackers[i] = &tracker{}
+		trackers[i].reset(0)
+
+		c := connect(clientID(i), false, nil)
+
+		sf, err := c.Subscribe(name(i), uint8(*qos))
+		if err == nil {
+			err = sf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			fmt.Println("subscribe", err)
+			os.Exit(1)
+		}
+
+		c.Disconnect()
+	}
+
+	// the payload starts with a sequence number
+	payloadSize := *size
+	if payloadSize < 8 {
+		payloadSize = 8
+	}
+
+	metrics := bench.Metrics{}
+	var seq uint64
+
+	fmt.Println("Depth  Publish  Reconnect  First  Flush  Received  Duplicates  Loss")
+
+	for _, depth := range targets {
+		// correlate undelivered messages with the ttl
+		var expiry *bench.Expiry
+		if *ttl > 0 {
+			expiry = bench.NewExpiry(*ttl, *ttlTolerance)
+		}
+
+		// pump messages while the subscribers are offline
+		publishStart := time.Now()
+		if expiry != nil {
+			expiry.Offline(publishStart)
+		}
+
+		for i := range trackers {
+			trackers[i].reset(depth)
+
+			for j := 0; j < depth; j++ {
+				payload := make([]byte, payloadSize)
+				binary.BigEndian.PutUint64(payload, seq)
+				seq++
+
+				if expiry != nil {
+					expiry.Published(seq-1, time.Now())
+				}
+
+				pf, err := publisher.Publish(name(i), payload, uint8(*qos), false)
+				if err == nil && *qos > 0 {
+					err = pf.Wait(10 * time.Second)
+				}
+				if err != nil {
+					fmt.Println("publish", err)
+					os.Exit(1)
+				}
+			}
+		}
+		publishTime := time.Since(publishStart)
+
+		// let messages age
+		time.Sleep(*offline)
+
+		// reconnect and wait for the queued messages
+		reconnectStart := time.Now()
+		if expiry != nil {
+			expiry.Online(reconnectStart)
+		}
+
+		var reconnect bench.Latencies
+		var first bench.Latencies
+		var flush bench.Latencies
+		received, duplicates := 0, 0
+
+		clients := make([]*client.Client, len(trackers))
+		for i, t := range trackers {
+			t := t
+			start := time.Now()
+			clients[i] = connect(clientID(i), false, func(msg *packet.Message, err error) error {
+				if err != nil {
+					fmt.Println("callback", err)
+					return nil
+				}
+
+				if len(msg.Payload) >= 8 {
+					seq := binary.BigEndian.Uint64(msg.Payload)
+					t.add(seq)
+
+					if expiry != nil {
+						expiry.Delivered(seq, time.Now())
+					}
+				}
+
+				return nil
+			})
+			reconnect.Add(time.Since(start))
+		}
+
+		deadline := time.After(*timeout)
+		for i, t := range trackers {
+			select {
+			case <-t.done:
+			case <-deadline:
+			}
+
+			t.mutex.Lock()
+			if !t.first.IsZero() {
+				first.Add(t.first.Sub(reconnectStart))
+				flush.Add(t.last.Sub(reconnectStart))
+			}
+			received += len(t.seen)
+			duplicates += t.duplicates
+			t.mutex.Unlock()
+
+			clients[i].Disconnect()
+		}
+
+		// collect metrics
+		expected := depth * len(trackers)
+		loss := float64(expected-received) / float64(expected)
+
+		prefix := "depth_" + strconv.Itoa(depth) + "."
+		metrics[prefix+"publish"] = publishTime.Seconds()
+		metrics[prefix+"reconnect"] = reconnect.Percentile(100)
+		metrics[prefix+"first"] = first.Percentile(100)
+		metrics[prefix+"flush"] = flush.Percentile(100)
+		metrics[prefix+"received"] = float64(received)
+		metrics[prefix+"duplicates"] = float64(duplicates)
+		metrics[prefix+"loss"] = loss
+		if flush.Percentile(100) > 0 {
+			metrics[prefix+"throughput"] = float64(received) / flush.Percentile(100)
+		}
+
+		fmt.Printf("%5d  %7s  %9s  %5s  %5s  %8d  %10d  %.2f%%\n", depth, publishTime.Round(time.Millisecond),
+			seconds(metrics[prefix+"reconnect"]), seconds(metrics[prefix+"first"]), seconds(metrics[prefix+"flush"]),
+			received, duplicates, loss*100)
+
+		// classify undelivered messages
+		if expiry != nil {
+			stats := expiry.Stats(time.Now())
+			for name, value := range stats.Metrics(prefix + "ttl.") {
+				metrics[name] = value
+			}
+
+			fmt.Printf("       Expired: %d - Lost: %d - Pending: %d - Overdue: %d\n", stats.Expired, stats.Lost,
+				stats.Pending, stats.Overdue)
+		}
+	}
+
+	// clean up sessions
+	for i := range trackers {
+		connect(clientID(i), true, nil).Disconnect()
+	}
+
+	publisher.Disconnect()
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func connect(clientID string, cleanSession bool, callback client.Callback) *client.Client {
+	c := client.New()
+	c.Callback = callback
+
+	cf, err := c.Connect(&client.Config{
+		BrokerURL:    *urlString,
+		ClientID:     clientID,
+		CleanSession: cleanSession,
+		KeepAlive:    "30s",
+	})
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	return c
+}
+
+func clientID(i int) string {
+	return "offline/sub/" + strconv.Itoa(i)
+}
+
+func name(i int) string {
+	return "offline/" + strconv.Itoa(i)
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Millisecond)
+}
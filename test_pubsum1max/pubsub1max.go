@@ -1,19 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"net/url"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
-	"sync"
-	"sync/atomic"
+	"path/filepath"
 	"syscall"
 	"time"
 
-	"github.com/juju/ratelimit"
-	"packet"
+	"bench"
 	"transport"
 )
 
@@ -24,174 +23,461 @@ var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
 var workers = flag.Int("workers", 1, "number of workers")
 var duration = flag.Int("duration", 30, "duration in seconds")
 var publishRate = flag.Int("publish-rate", 0, "messages per second")
+var globalRate = flag.Int("global-rate", 0, "messages per second across all publishers")
 var receiveRate = flag.Int("receive-rate", 0, "messages per second")
+var processDelay = flag.Duration("process-delay", 0, "mean artificial processing time of every received message")
+var processJitter = flag.String("process-jitter", "none", "distribution of the processing times (none, uniform or exponential)")
+var writeDelay = flag.Duration("write-delay", 0, "coalesce publishes written within this delay (0 uses buffered sends)")
+var batchSize = flag.Int("batch", 1, "concatenate this many messages with a length prefix into every publish and unpack them on the consumer (1 disables batching)")
+var readBuffer = flag.Int("read-buffer", 0, "consumer read buffer size in bytes (0 for default)")
+var readBufferMax = flag.Int("read-buffer-max", 0, "grow and shrink the consumer read buffer between -read-buffer and this size in bytes (0 disables)")
+var intern = flag.Int("intern", 0, "size of the topic table shared by consumers (0 disables interning)")
+var useArena = flag.Bool("arena", false, "reuse received publish packets and their payloads to reduce gc pressure")
+var payloadSize = flag.Int("payload", 500, "payload size in bytes")
+var qos = flag.Int("qos", 0, "qos level of the subscriptions and publishes (0, 1 or 2)")
+var drain = flag.Duration("drain", time.Second, "time to wait for in flight messages when finishing")
+var out = flag.String("out", "", "write the result as JSON to this file")
+var nodes = flag.String("nodes", "", "comma separated broker nodes like a=tcp://10.0.0.1:1883*2 (overrides -url)")
+var strategy = flag.String("strategy", "round-robin", "distribution of clients across nodes (round-robin, hash or weighted)")
+var family = flag.String("family", "dual", "address family of tcp connections (dual, v4 or v6)")
+var sources = flag.String("sources", "", "local ips, ranges or networks tcp connections are bound to like 10.0.0.10-10.0.0.20 (defaults to 192.168.* interface addresses)")
+var sourcePorts = flag.String("source-ports", "", "assign local ports from a range like 1024-65535 instead of the ephemeral range")
+var sourceStrategy = flag.String("source-strategy", "fill", "selection of the local ip (fill or round-robin)")
+var reuseAddr = flag.Bool("reuse-addr", false, "enable SO_REUSEADDR to rebind local ports in TIME_WAIT")
+var jitter = flag.String("jitter", "none", "distribution of the publish intervals (none, uniform or exponential)")
+var publishers = flag.Int("publishers", 0, "send the messages of all publishers on a pool of this many goroutines (0 uses one per publisher)")
+var credentialsURL = flag.String("credentials", "", "read the username and password from env://, file://, vault:// or aws:// (overrides -url)")
+var profile = flag.String("profile", "", "comma separated pprof profiles to capture (cpu, heap, allocs, mutex, block or goroutine)")
+var profileAt = flag.Duration("profile-at", 0, "offset of the profiling window from the start")
+var profileDuration = flag.Duration("profile-duration", 30*time.Second, "length of the profiling window")
+var profileDir = flag.String("profile-dir", "profiles", "directory the profiles are written to")
+var reconnect = flag.Duration("reconnect", 0, "reconnect lost connections after this delay (0 fails on errors)")
+var controlAddr = flag.String("control", "", "serve the runtime control api on this address like :8080")
+var healthAddr = flag.String("health", "", "serve /healthz, /readyz and /status on this address like :8081 (also served by -control)")
+var keyLog = flag.String("keylog", "", "append the tls session keys to this file for decrypting captures in wireshark")
+var wsPing = flag.Duration("ws-ping", 0, "interval of web socket ping frames independent of the mqtt keep alive (0 disables)")
+var barrierLead = flag.Duration("barrier", 0, "start all publishers at the same instant this long after the last worker connected (0 starts them as they connect)")
+var barrierSkew = flag.Duration("barrier-skew", time.Millisecond, "tolerated deviation of the publisher starts from the barrier release")
+var shards = flag.Int("shards", 0, "split the workers across this many processes (0 runs in this process)")
+var cpus = flag.String("cpus", "", "pin the shards to cpu sets like 0-3/4-7 (one set per shard, implies -shards)")
+var procs = flag.Int("procs", 0, "GOMAXPROCS of every shard (0 uses the size of its cpu set)")
+var shard = flag.String("shard", "", "run the workers of a shard like 0/4 (set by the main process)")
+
+var thresholds bench.Thresholds
+var hooks bench.Hooks
+var sinks bench.Sinks
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like loss==0, error_rate<0.1% or latency.p99<50ms (repeatable)")
+	flag.Var(&hooks, "hook", "command to run at an offset like 30s:docker restart mqtt (repeatable)")
+	flag.Var(&sinks, "sink", "stream metrics to influx://host:8086/db, influxs://host:8086/db or sqlite:///path/results.db (repeatable)")
+}
 
-var sent int32
-var received int32
-var delta int32
-var total int32
-
-var wg sync.WaitGroup
+// the flags of the main process that are not passed to the shards
+var mainFlags = []string{"shards", "cpus", "procs", "shard", "out", "assert", "hook", "sink", "control", "health",
+	"profile", "profile-at", "profile-duration", "profile-dir"}
 
 func main() {
 	flag.Parse()
 
-	fmt.Printf("Start benchmark of %s using %d workers for %d seconds.\n", *urlString, *workers, *duration)
-
-	go func() {
-		finish := make(chan os.Signal, 1)
-		signal.Notify(finish, syscall.SIGINT, syscall.SIGTERM)
+	// run shards
+	var sets []bench.CPUSet
+	if *cpus != "" {
+		var err error
+		sets, err = bench.ParseCPUSets(*cpus)
+		if err != nil {
+			panic(err)
+		}
 
-		<-finish
-		fmt.Println("Closing...")
-		os.Exit(0)
-	}()
+		if *shards == 0 {
+			*shards = len(sets)
+		} else if *shards != len(sets) {
+			panic("expected one cpu set per shard")
+		}
+	}
 
-	if int(*duration) > 0 {
-		time.AfterFunc(time.Duration(*duration)*time.Second, func() {
-			fmt.Println("Finishing...")
-			os.Exit(0)
-		})
+	if *shards > 1 && *shard == "" {
+		coordinate(*shards, sets)
+		return
 	}
 
-	wg.Add(*workers * 2)
+	// select the workers of this shard and its part of the global rate
+	workerOffset := 0
+	global := float64(*globalRate)
+	if *shard != "" {
+		index, count, err := bench.ParseShard(*shard)
+		if err != nil {
+			panic(err)
+		}
 
-	for i := 0; i < *workers; i++ {
-		id := strconv.Itoa(i)
+		global = bench.ShardRate(global, *workers, index, count)
+		workerOffset, *workers = bench.ShardWorkers(*workers, index, count)
+	}
 
-		go consumer(id)
-		go publisher(id)
+	config := bench.NewRunConfig(*urlString)
+	config.Name = "pubsub1max"
+	config.ClientIDPrefix = "benchmark/"
+	config.Workers = *workers
+	config.WorkerOffset = workerOffset
+	config.Duration = time.Duration(*duration) * time.Second
+	config.PublishRate = float64(*publishRate)
+	config.Publishers = *publishers
+	config.GlobalRate = global
+	config.ReceiveRate = float64(*receiveRate)
+	config.PayloadSize = *payloadSize
+	config.QOS = byte(*qos)
+	config.BatchSize = *batchSize
+	config.ProcessDelay = *processDelay
+	config.WriteDelay = *writeDelay
+	config.ReadBuffer = *readBuffer
+	config.ReadBufferMax = *readBufferMax
+	config.Intern = *intern
+	config.Arena = *useArena
+	config.Reconnect = *reconnect
+	config.Barrier = *barrierLead
+	config.BarrierSkew = *barrierSkew
+	config.Drain = *drain
+	config.Hooks = hooks
+	config.Sinks = sinks
+	config.Thresholds = thresholds
+	config.Logf = func(format string, args ...interface{}) {
+		fmt.Printf(format, args...)
 	}
 
-	go reporter()
+	// prepare cluster
+	if *nodes != "" {
+		list, err := bench.ParseNodes(*nodes)
+		if err != nil {
+			panic(err)
+		}
 
-	wg.Wait()
-}
+		s, err := bench.ParseStrategy(*strategy)
+		if err != nil {
+			panic(err)
+		}
 
-func connection(id string) transport.Conn {
-	conn, err := transport.Dial(*urlString)
+		config.Cluster, err = bench.NewCluster(list, s)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Start benchmark of %d nodes (%s) using %d workers for %d seconds.\n", len(list), s, *workers, *duration)
+	} else {
+		fmt.Printf("Start benchmark of %s using %d workers for %d seconds.\n", *urlString, *workers, *duration)
+	}
+
+	// parse jitter
+	var err error
+	config.Jitter, err = bench.ParseJitter(*jitter)
 	if err != nil {
 		panic(err)
 	}
 
-	mqttURL, err := url.Parse(*urlString)
+	config.ProcessJitter, err = bench.ParseJitter(*processJitter)
 	if err != nil {
 		panic(err)
 	}
 
-	connect := packet.NewConnectPacket()
-	connect.ClientID = "benchmark/" + id
+	// select address family
+	switch *family {
+	case "dual":
+	case "v4":
+		transport.DefaultDialer().Network = "tcp4"
+	case "v6":
+		transport.DefaultDialer().Network = "tcp6"
+	default:
+		panic("invalid family: " + *family)
+	}
 
-	if mqttURL.User != nil {
-		connect.Username = mqttURL.User.Username()
-		pw, _ := mqttURL.User.Password()
-		connect.Password = pw
+	// send web socket pings
+	if *wsPing > 0 {
+		transport.DefaultDialer().WebSocketPingInterval = *wsPing
 	}
 
-	err = conn.Send(connect)
+	// log tls session keys
+	if *keyLog != "" {
+		file, err := transport.OpenKeyLog(*keyLog)
+		if err != nil {
+			panic(err)
+		}
+
+		defer file.Close()
+
+		transport.DefaultDialer().KeyLogWriter = file
+	}
+
+	// resolve credentials
+	if *credentialsURL != "" {
+		provider, err := bench.OpenCredentials(*credentialsURL)
+		if err != nil {
+			panic(err)
+		}
+
+		c, err := provider.Credentials()
+		if err != nil {
+			panic(err)
+		}
+
+		config.Credentials = &c
+	}
+
+	// prepare source addresses
+	pool := transport.DefaultDialer().Sources
+	if *sources != "" {
+		pool.IPs, err = transport.ParseSourceIPs(*sources)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if *sourcePorts != "" {
+		pool.PortMin, pool.PortMax, err = transport.ParsePortRange(*sourcePorts)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	pool.Strategy, err = transport.ParseSourceStrategy(*sourceStrategy)
 	if err != nil {
 		panic(err)
 	}
 
-	pkt, err := conn.Receive()
+	pool.ReuseAddr = *reuseAddr
+
+	// serve control api
+	start := time.Now()
+	config.Health = bench.NewHealth(start)
+	config.Control = bench.NewControl(bench.Settings{
+		Rate:    config.PublishRate,
+		Workers: config.Workers,
+		Size:    config.PayloadSize,
+	})
+
+	if *controlAddr != "" {
+		// the pattern "/" matches every path, serve the api on the root only
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+
+			config.Control.ServeHTTP(w, r)
+		})
+		config.Health.Register(mux)
+
+		go func() {
+			err := http.ListenAndServe(*controlAddr, mux)
+			if err != nil {
+				fmt.Println("Failed to serve control api:", err)
+			}
+		}()
+	}
+
+	// serve health endpoints
+	if *healthAddr != "" {
+		mux := http.NewServeMux()
+		config.Health.Register(mux)
+
+		go func() {
+			err := http.ListenAndServe(*healthAddr, mux)
+			if err != nil {
+				fmt.Println("Failed to serve health endpoints:", err)
+			}
+		}()
+	}
+
+	// schedule profiling
+	kinds, err := bench.ParseProfileKinds(*profile)
 	if err != nil {
 		panic(err)
 	}
 
-	if connack, ok := pkt.(*packet.ConnackPacket); ok {
-		if connack.ReturnCode == packet.ConnectionAccepted {
-			fmt.Printf("Connected: %s\n", id)
+	profiler := &bench.Profiler{
+		Kinds:    kinds,
+		At:       *profileAt,
+		Duration: *profileDuration,
+		Dir:      *profileDir,
+	}
 
-			return conn
-		}
+	stopProfiler := profiler.Schedule(start)
+
+	// finish early on signals
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+
+		<-done
+		cancel()
+	}()
+
+	report, runErr := bench.Run(ctx, config)
+
+	// write profiles
+	files, err := stopProfiler()
+	if err != nil {
+		fmt.Println("Failed to write profiles:", err)
 	}
 
-	panic("connection failed")
-}
+	for _, file := range files {
+		fmt.Println("Profile:", file)
+	}
+
+	sinks.Close()
+
+	if report == nil {
+		fmt.Println("Run failed:", runErr)
+		os.Exit(1)
+	}
+
+	result := report.Result
+	result.Profiles = files
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out", "sink", "profile", "profile-at", "profile-duration", "profile-dir", "keylog"))
+
+	if runErr != nil {
+		fmt.Println("Run failed:", runErr)
+	}
 
-func consumer(id string) {
-	name := "consumer/" + id
-	conn := connection(name)
+	// write result and check thresholds
+	err = bench.Finish(*out, result, thresholds)
+	if runErr != nil || err != nil {
+		os.Exit(1)
+	}
+}
 
-	subscribe := packet.NewSubscribePacket()
-	subscribe.ID = 1
-	subscribe.Subscriptions = []packet.Subscription{
-		{Topic: id, QOS: 0},
+func logHook(run bench.HookRun) {
+	if run.Err != nil {
+		fmt.Printf("Hook %s failed after %s: %s\n%s", run.Hook, run.End.Sub(run.Start), run.Err, run.Output)
+		return
 	}
 
-	err := conn.Send(subscribe)
+	fmt.Printf("Hook %s finished after %s\n%s", run.Hook, run.End.Sub(run.Start), run.Output)
+}
+
+// coordinate starts the shards with the flags of this process, optionally
+// pinned to the cpu sets, and reports their merged result. The shards start
+// independently, so their measurement windows are not aligned.
+func coordinate(count int, sets []bench.CPUSet) {
+	fmt.Printf("Start %d shards of %d workers for %d seconds.\n", count, *workers, *duration)
+
+	dir, err := ioutil.TempDir("", "pubsub1max")
 	if err != nil {
 		panic(err)
 	}
 
-	var bucket *ratelimit.Bucket
-	if *receiveRate > 0 {
-		bucket = ratelimit.NewBucketWithRate(float64(*receiveRate), int64(*receiveRate))
-	}
+	start := time.Now()
+	args := bench.FlagArgs(flag.CommandLine, mainFlags...)
 
-	for {
-		if bucket != nil {
-			bucket.Wait(1)
+	list := make([]*bench.Shard, count)
+	for i := range list {
+		s := &bench.Shard{
+			Index: i,
+			Procs: *procs,
+			Out:   filepath.Join(dir, fmt.Sprintf("shard-%d.json", i)),
 		}
 
-		_, err := conn.Receive()
+		if len(sets) > 0 {
+			s.CPUs = sets[i]
+		}
+
+		shardArgs := append(append([]string{}, args...), fmt.Sprintf("-shard=%d/%d", i, count), "-out="+s.Out)
+		err := s.Start(os.Args[0], shardArgs)
 		if err != nil {
 			panic(err)
 		}
 
-		atomic.AddInt32(&received, 1)
-		atomic.AddInt32(&delta, -1)
-		atomic.AddInt32(&total, 1)
+		offset, n := bench.ShardWorkers(*workers, i, count)
+		if *globalRate > 0 {
+			fmt.Printf("Shard %d: workers %d-%d - Global Rate: %.0f msg/s (CPUs: %s)\n", i, offset, offset+n-1,
+				bench.ShardRate(float64(*globalRate), *workers, i, count), s.CPUs)
+		} else {
+			fmt.Printf("Shard %d: workers %d-%d (CPUs: %s)\n", i, offset, offset+n-1, s.CPUs)
+		}
+
+		list[i] = s
 	}
-}
 
-func publisher(id string) {
-	name := "publisher/" + id
-	conn := connection(name)
+	// forward signals to finish the shards early
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
 
-	publish := packet.NewPublishPacket()
-	publish.Message.Topic = id
-	publish.Message.Payload = []byte("foofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofofoofoofoofoofoofoofo")
+		for sig := range done {
+			for _, s := range list {
+				s.Signal(sig)
+			}
+		}
+	}()
 
-	var bucket *ratelimit.Bucket
-	if *publishRate > 0 {
-		bucket = ratelimit.NewBucketWithRate(float64(*publishRate), int64(*publishRate))
-	}
+	stopHooks := hooks.Schedule(start, logHook)
 
-	for {
-		if bucket != nil {
-			bucket.Wait(1)
+	// wait for the shards
+	var results []*bench.Result
+	for _, s := range list {
+		result, err := s.Wait()
+		if err != nil {
+			fmt.Printf("Shard %d failed: %s\n", s.Index, err)
 		}
 
-		err := conn.BufferedSend(publish)
-		if err != nil {
-			panic(err)
+		if result != nil {
+			results = append(results, result)
 		}
+	}
+
+	stopHooks()
+	os.RemoveAll(dir)
 
-		atomic.AddInt32(&sent, 1)
-		atomic.AddInt32(&delta, 1)
+	if len(results) == 0 {
+		os.Exit(1)
+	}
+
+	// merge results
+	result := bench.MergeResults("pubsub1max", results)
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out", "sink", "profile", "profile-at", "profile-duration", "profile-dir", "keylog", "shard"))
+	metrics := result.Metrics
+
+	fmt.Printf("Shards: %d of %d - Sent: %.0f msgs - Received: %.0f msgs (Loss: %.2f%%) (Throughput: %.0f msg/s)\n",
+		len(results), count, metrics["sent"], metrics["received"], metrics["loss"]*100, metrics["throughput"])
+
+	if _, ok := metrics["latency.p50"]; ok {
+		fmt.Printf("Latency (upper bound): p50 %.2fms - p90 %.2fms - p99 %.2fms - max %.2fms\n",
+			metrics["latency.p50"]*1000, metrics["latency.p90"]*1000, metrics["latency.p99"]*1000,
+			metrics["latency.max"]*1000)
+	}
+
+	// write final metrics
+	err = sinks.Write(result, time.Now(), metrics)
+	if err != nil {
+		fmt.Println("Failed to write metrics:", err)
 	}
-}
 
-func reporter() {
-	var iterations int32
+	sinks.Close()
 
-	for {
-		time.Sleep(1 * time.Second)
+	// write result
+	if *out != "" {
+		err := bench.WriteResult(*out, result)
+		if err != nil {
+			fmt.Println("Failed to write result:", err)
+		}
+	}
 
-		curSent := atomic.LoadInt32(&sent)
-		curReceived := atomic.LoadInt32(&received)
-		curDelta := atomic.LoadInt32(&delta)
-		curTotal := atomic.LoadInt32(&total)
+	// check thresholds
+	if len(thresholds) > 0 {
+		errs := thresholds.Check(metrics)
+		for _, err := range errs {
+			fmt.Println("FAIL:", err)
+		}
 
-		iterations++
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
 
-		fmt.Printf("Sent: %d msgs - ", curSent)
-		fmt.Printf("Received: %d msgs ", curReceived)
-		fmt.Printf("(Buffered: %d msgs) ", curDelta)
-		fmt.Printf("(Average Throughput: %d msg/s)\n", curTotal/iterations)
+		fmt.Println("PASS")
+	}
 
-		atomic.StoreInt32(&sent, 0)
-		atomic.StoreInt32(&received, 0)
+	if len(results) < count {
+		os.Exit(1)
 	}
 }
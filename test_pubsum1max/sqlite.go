@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// link the sqlite driver for -sink sqlite:///path/to/results.db
+import _ "github.com/mattn/go-sqlite3"
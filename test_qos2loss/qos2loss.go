@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+)
+
+// QoS2 握手丢包恢复验证工具
+// 逐条发布 QoS2 消息，按配置丢弃发布端或订阅端的 PUBREC/PUBREL 报文，以持久会话重连后验证双方按协议重传并完成握手，且每条消息只投递一次
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var topic = flag.String("topic", "qos2loss/test", "topic the messages are published to")
+var count = flag.Int("count", 100, "number of messages to publish")
+var size = flag.Int("size", 64, "payload size in bytes")
+var drop = flag.String("drop", "pubrec", "handshake packet that is lost (pubrec, pubrel or both)")
+var sides = flag.String("side", "both", "client that loses the packets (publisher, subscriber or both)")
+var every = flag.Int("every", 10, "lose the packets of every n-th message")
+var ackTimeout = flag.Duration("ack-timeout", time.Second, "time without progress before a client that lost a packet reconnects")
+var timeout = flag.Duration("timeout", 30*time.Second, "maximum time to complete the handshake of a message")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like failed==0, duplicates==0 or retries.publisher.pubrel>0 (repeatable)")
+}
+
+// the payload starts with a sequence number
+const headerSize = 8
+
+// the packets of the handshake in the order they are exchanged
+var stages = []packet.Type{packet.PUBLISH, packet.PUBREC, packet.PUBREL, packet.PUBCOMP}
+
+// a side is a client of the handshake that may lose packets and recovers by
+// resuming its persistent session
+type side struct {
+	name   string
+	config *client.Config
+	client *client.Client
+
+	// the packets that are lost by this side
+	lose map[packet.Type]bool
+
+	// the sequence numbers of the packet ids, the transmissions per stage
+	// and message and the lost packets
+	ids           map[packet.ID]uint64
+	transmissions map[packet.Type]map[uint64]int
+	lost          map[packet.Type]map[uint64]bool
+	completed     map[uint64]bool
+	delivered     map[uint64]int
+	reconnects    int
+
+	progress chan struct{}
+	mutex    sync.Mutex
+}
+
+func newSide(name, clientID string) *side {
+	s := &side{
+		name:          name,
+		lose:          map[packet.Type]bool{},
+		ids:           map[packet.ID]uint64{},
+		transmissions: map[packet.Type]map[uint64]int{},
+		lost:          map[packet.Type]map[uint64]bool{},
+		completed:     map[uint64]bool{},
+		delivered:     map[uint64]int{},
+		progress:      make(chan struct{}, 1),
+	}
+
+	for _, t := range stages {
+		s.transmissions[t] = map[uint64]int{}
+		s.lost[t] = map[uint64]bool{}
+	}
+
+	s.config = client.NewConfigWithClientID(*urlString, clientID)
+	s.config.CleanSession = false
+
+	return s
+}
+
+// observe records a sent or received packet of the handshake and returns
+// whether it is lost
+func (s *side) observe(pkt packet.GenericPacket) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// resolve the message
+	var seq uint64
+	switch p := pkt.(type) {
+	case *packet.PublishPacket:
+		if p.Message.QOS != 2 || len(p.Message.Payload) < headerSize {
+			return false
+		}
+
+		seq = binary.BigEndian.Uint64(p.Message.Payload)
+		s.ids[p.ID] = seq
+	case *packet.PubrecPacket, *packet.PubrelPacket, *packet.PubcompPacket:
+		id, _ := packet.GetID(pkt)
+		var ok bool
+		seq, ok = s.ids[id]
+		if !ok {
+			return false
+		}
+	default:
+		return false
+	}
+
+	t := pkt.Type()
+	s.transmissions[t][seq]++
+
+	// lose the first transmission
+	if s.lose[t] && seq%uint64(*every) == 0 && !s.lost[t][seq] {
+		s.lost[t][seq] = true
+		return true
+	}
+
+	if t == packet.PUBCOMP {
+		s.completed[seq] = true
+		s.notify()
+	}
+
+	return false
+}
+
+// deliver records a delivered message
+func (s *side) deliver(msg *packet.Message, err error) error {
+	if err != nil || len(msg.Payload) < headerSize {
+		return nil
+	}
+
+	s.mutex.Lock()
+	s.delivered[binary.BigEndian.Uint64(msg.Payload)]++
+	s.mutex.Unlock()
+
+	s.notify()
+
+	return nil
+}
+
+func (s *side) notify() {
+	select {
+	case s.progress <- struct{}{}:
+	default:
+	}
+}
+
+// done returns whether the handshake of the message has been completed and
+// whether a packet of it has been lost by this side
+func (s *side) done(seq uint64) (bool, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lost := false
+	for _, t := range stages {
+		lost = lost || s.lost[t][seq]
+	}
+
+	return s.completed[seq], lost
+}
+
+// connect connects a new client that resumes the session of the previous one
+// and resends its unacknowledged packets
+func (s *side) connect() error {
+	c := client.New()
+	if s.client != nil {
+		s.client.Close()
+		c.Session = s.client.Session
+	}
+
+	c.Hooks.DropIncoming = s.observe
+	c.Hooks.DropOutgoing = s.observe
+	c.Callback = s.deliver
+
+	cf, err := c.Connect(s.config)
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.client = c
+
+	return nil
+}
+
+// reconnect drops the connection and resumes the session
+func (s *side) reconnect() error {
+	s.mutex.Lock()
+	s.reconnects++
+	s.mutex.Unlock()
+
+	return s.connect()
+}
+
+// metrics returns the retransmissions and losses per stage
+func (s *side) metrics(metrics bench.Metrics) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, t := range stages {
+		name := strings.ToLower(t.String())
+
+		retries := 0
+		for _, n := range s.transmissions[t] {
+			retries += n - 1
+		}
+
+		metrics["retries."+s.name+"."+name] = float64(retries)
+		metrics["lost."+s.name+"."+name] = float64(len(s.lost[t]))
+	}
+
+	metrics["reconnects."+s.name] = float64(s.reconnects)
+}
+
+func main() {
+	flag.Parse()
+
+	if *every < 1 {
+		fmt.Println("invalid every:", *every)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Start QoS 2 loss verification of %s with %d messages losing %s on %s.\n", *urlString, *count, *drop, *sides)
+
+	result := bench.NewResult("qos2loss")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	publisher := newSide("publisher", "qos2loss/pub")
+	subscriber := newSide("subscriber", "qos2loss/sub")
+
+	// select the lost packets
+	var losing []*side
+	switch *sides {
+	case "publisher":
+		losing = []*side{publisher}
+	case "subscriber":
+		losing = []*side{subscriber}
+	case "both":
+		losing = []*side{publisher, subscriber}
+	default:
+		fmt.Println("invalid side:", *sides)
+		os.Exit(1)
+	}
+
+	for _, s := range losing {
+		switch *drop {
+		case "pubrec":
+			s.lose[packet.PUBREC] = true
+		case "pubrel":
+			s.lose[packet.PUBREL] = true
+		case "both":
+			s.lose[packet.PUBREC] = true
+			s.lose[packet.PUBREL] = true
+		default:
+			fmt.Println("invalid drop:", *drop)
+			os.Exit(1)
+		}
+	}
+
+	// clear previous sessions and create persistent ones
+	for _, s := range []*side{publisher, subscriber} {
+		err := removeSession(s.config)
+		if err == nil {
+			err = s.connect()
+		}
+		if err != nil {
+			fmt.Println("connect", err)
+			os.Exit(1)
+		}
+	}
+
+	sf, err := subscriber.client.Subscribe(*topic, 2)
+	if err == nil {
+		err = sf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("subscribe", err)
+		os.Exit(1)
+	}
+
+	payloadSize := *size
+	if payloadSize < headerSize {
+		payloadSize = headerSize
+	}
+
+	// publish messages one at a time and wait for both handshakes
+	var failed []uint64
+	for seq := uint64(0); seq < uint64(*count); seq++ {
+		payload := make([]byte, payloadSize)
+		binary.BigEndian.PutUint64(payload, seq)
+
+		_, err := publisher.client.Publish(*topic, payload, 2, false)
+		if err != nil {
+			fmt.Println("publish", err)
+			os.Exit(1)
+		}
+
+		deadline := time.Now().Add(*timeout)
+		for {
+			pubDone, _ := publisher.done(seq)
+			subDone, _ := subscriber.done(seq)
+			if pubDone && subDone {
+				break
+			} else if time.Now().After(deadline) {
+				fmt.Printf("Message %d not completed (Publisher: %t) (Subscriber: %t)\n", seq, pubDone, subDone)
+				failed = append(failed, seq)
+				break
+			}
+
+			select {
+			case <-publisher.progress:
+				continue
+			case <-subscriber.progress:
+				continue
+			case <-time.After(*ackTimeout):
+			}
+
+			// resume the sessions of the stalled clients that lost a packet
+			for _, s := range []*side{publisher, subscriber} {
+				if done, lost := s.done(seq); !done && lost {
+					err := s.reconnect()
+					if err != nil {
+						fmt.Printf("Reconnect of %s failed: %s\n", s.name, err)
+					}
+				}
+			}
+		}
+	}
+
+	publisher.client.Disconnect()
+	subscriber.client.Disconnect()
+
+	// remove the sessions
+	removeSession(publisher.config)
+	removeSession(subscriber.config)
+
+	// collect metrics
+	subscriber.mutex.Lock()
+	received := len(subscriber.delivered)
+	duplicates := 0
+	for _, n := range subscriber.delivered {
+		duplicates += n - 1
+	}
+	subscriber.mutex.Unlock()
+
+	metrics := bench.Metrics{
+		"sent":       float64(*count),
+		"received":   float64(received),
+		"loss":       float64(*count-received) / float64(*count),
+		"duplicates": float64(duplicates),
+		"failed":     float64(len(failed)),
+	}
+
+	publisher.metrics(metrics)
+	subscriber.metrics(metrics)
+
+	fmt.Printf("Sent: %d msgs - Received: %d msgs (Loss: %.2f%%) (Duplicates: %d) (Failed: %d)\n",
+		*count, received, metrics["loss"]*100, duplicates, len(failed))
+
+	for _, s := range []*side{publisher, subscriber} {
+		fmt.Printf("%-10s reconnects %3.0f", s.name, metrics["reconnects."+s.name])
+		for _, t := range stages {
+			name := strings.ToLower(t.String())
+			fmt.Printf(" - %s: lost %.0f retries %.0f", t, metrics["lost."+s.name+"."+name], metrics["retries."+s.name+"."+name])
+		}
+		fmt.Println()
+	}
+
+	if len(failed) > 0 {
+		fmt.Println("Not completed:", failed)
+	}
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+// removeSession connects with a clean session to remove a previous session
+func removeSession(config *client.Config) error {
+	clean := *config
+	clean.CleanSession = true
+
+	c := client.New()
+	cf, err := c.Connect(&clean)
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Disconnect()
+}
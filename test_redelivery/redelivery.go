@@ -0,0 +1,454 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+	"transport"
+)
+
+// 重连重投验证工具
+// 持续发布 QoS1 消息，订阅者在收到消息但未确认时强制断开连接，以持久会话重新连接后逐条统计未确认消息是否被重投、已确认消息是否被重复投递以及丢失的消息
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var topic = flag.String("topic", "redelivery/test", "topic the messages are published to")
+var count = flag.Int("count", 10000, "number of messages to publish")
+var rate = flag.Int("rate", 1000, "publish rate in messages per second")
+var size = flag.Int("size", 64, "payload size in bytes")
+var drops = flag.Int("drops", 10, "number of forced subscriber disconnects")
+var dropAfter = flag.Int("drop-after", 500, "number of messages acknowledged per connection before it is dropped")
+var unacked = flag.Int("unacked", 10, "number of messages received without acknowledgment before the connection is dropped")
+var timeout = flag.Duration("timeout", time.Minute, "maximum time to wait for the messages and their redeliveries after publishing")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like redelivery.missing==0, loss==0 or duplicates==0 (repeatable)")
+}
+
+const subscriberID = "redelivery/sub"
+
+// a ledger records the fate of every message received by the subscriber
+type ledger struct {
+	copies       map[uint64]int
+	acked        map[uint64]bool
+	inflight     map[uint64]bool
+	redelivered  int
+	duplicates   int
+	missingDup   int
+	sessionsLost int
+	drops        int
+	reconnects   bench.Latencies
+	conn         transport.Conn
+	done         chan struct{}
+	finished     bool
+	mutex        sync.Mutex
+}
+
+func newLedger() *ledger {
+	return &ledger{
+		copies:   make(map[uint64]int, *count),
+		acked:    make(map[uint64]bool, *count),
+		inflight: make(map[uint64]bool),
+		done:     make(chan struct{}),
+	}
+}
+
+// add records a received message and classifies its copies, a message whose
+// acknowledgment is held back for a drop awaits its redelivery. It returns
+// whether all messages have been received.
+func (l *ledger) add(seq uint64, dup bool, held bool) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.copies[seq]++
+
+	// classify the copy
+	if l.copies[seq] > 1 {
+		if l.inflight[seq] && !l.acked[seq] {
+			l.redelivered++
+		} else {
+			l.duplicates++
+		}
+
+		if !dup {
+			l.missingDup++
+		}
+	}
+
+	if held {
+		l.inflight[seq] = true
+	}
+
+	l.complete()
+
+	return len(l.copies) == *count
+}
+
+// complete closes done once all messages have been received and every message
+// held back by a drop has been redelivered, the mutex must be held
+func (l *ledger) complete() {
+	if l.finished || len(l.copies) < *count || len(l.unredelivered()) > 0 {
+		return
+	}
+
+	l.finished = true
+	close(l.done)
+}
+
+func (l *ledger) ack(seq uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.acked[seq] = true
+}
+
+func (l *ledger) drop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.drops++
+}
+
+// setConn sets the current connection, which is closed when stopping
+func (l *ledger) setConn(conn transport.Conn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.conn = conn
+}
+
+// missing returns the messages that were unacknowledged when a connection was
+// dropped and have never been redelivered
+func (l *ledger) missing() []uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	list := l.unredelivered()
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+
+	return list
+}
+
+// unredelivered returns the messages that wait for a redelivery, the mutex must
+// be held
+func (l *ledger) unredelivered() []uint64 {
+	var list []uint64
+	for seq := range l.inflight {
+		if l.copies[seq] < 2 && !l.acked[seq] {
+			list = append(list, seq)
+		}
+	}
+
+	return list
+}
+
+var stopped int32
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start redelivery verification of %s with %d messages and %d drops.\n", *urlString, *count, *drops)
+
+	result := bench.NewResult("redelivery")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	// clear a previous session and create a persistent one
+	conn, _, err := connect(true)
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+	conn.Send(packet.NewDisconnectPacket())
+	conn.Close()
+
+	conn, _, err = connect(false)
+	if err == nil {
+		err = subscribe(conn)
+	}
+	if err != nil {
+		fmt.Println("subscribe", err)
+		os.Exit(1)
+	}
+
+	l := newLedger()
+
+	subscriberDone := make(chan struct{})
+	go func() {
+		defer close(subscriberDone)
+		subscriber(conn, l)
+	}()
+
+	// publish messages
+	publisher := client.New()
+	cf, err := publisher.Connect(&client.Config{
+		BrokerURL:    *urlString,
+		ClientID:     "redelivery/pub",
+		CleanSession: true,
+		KeepAlive:    "30s",
+	})
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	schedule := bench.NewSchedule(float64(*rate), bench.NoJitter, time.Now().UnixNano())
+	for seq := 0; seq < *count; seq++ {
+		payload := bench.NewPayload(*size)
+		bench.PutHeader(payload, bench.Header{Seq: uint64(seq), Time: time.Now()})
+
+		pf, err := publisher.Publish(*topic, payload, 1, false)
+		if err == nil {
+			err = pf.Wait(10 * time.Second)
+		}
+		if err != nil {
+			fmt.Println("publish", err)
+			os.Exit(1)
+		}
+
+		schedule.Wait()
+	}
+
+	publisher.Disconnect()
+
+	// wait for the messages and the redelivery of the held back ones
+	select {
+	case <-l.done:
+	case <-time.After(*timeout):
+	}
+
+	atomic.StoreInt32(&stopped, 1)
+
+	l.mutex.Lock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.mutex.Unlock()
+
+	<-subscriberDone
+
+	// remove the session
+	conn, _, err = connect(true)
+	if err == nil {
+		conn.Send(packet.NewDisconnectPacket())
+		conn.Close()
+	}
+
+	// collect metrics
+	missing := l.missing()
+
+	l.mutex.Lock()
+	received := len(l.copies)
+	metrics := bench.Metrics{
+		"sent":               float64(*count),
+		"received":           float64(received),
+		"loss":               float64(*count-received) / float64(*count),
+		"drops":              float64(l.drops),
+		"inflight":           float64(len(l.inflight)),
+		"redelivered":        float64(l.redelivered),
+		"redelivery.missing": float64(len(missing)),
+		"duplicates":         float64(l.duplicates),
+		"dup_flag.missing":   float64(l.missingDup),
+		"sessions.lost":      float64(l.sessionsLost),
+		"reconnect.p50":      l.reconnects.Percentile(50),
+		"reconnect.max":      l.reconnects.Percentile(100),
+	}
+	l.mutex.Unlock()
+
+	fmt.Printf("Sent: %d msgs - Received: %d msgs (Loss: %.2f%%)\n", *count, received, metrics["loss"]*100)
+	fmt.Printf("Drops: %d - Unacknowledged: %d - Redelivered: %.0f - Not redelivered: %d\n",
+		l.drops, len(l.inflight), metrics["redelivered"], len(missing))
+	fmt.Printf("Duplicates of acknowledged messages: %.0f - Copies without DUP flag: %.0f - Lost sessions: %.0f\n",
+		metrics["duplicates"], metrics["dup_flag.missing"], metrics["sessions.lost"])
+
+	if len(missing) > 0 {
+		fmt.Println("Not redelivered:", missing)
+	}
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+// subscriber receives the messages and drops the connection after holding back
+// the acknowledgments of the last received messages
+func subscriber(conn transport.Conn, l *ledger) {
+	acked := 0
+	var held []uint64
+
+	l.setConn(conn)
+
+	for {
+		pkt, err := conn.Receive()
+		if err != nil {
+			conn.Close()
+
+			if atomic.LoadInt32(&stopped) == 1 {
+				return
+			}
+
+			// reconnect after a failure of the broker
+			conn = reconnect(l)
+			if conn == nil {
+				return
+			}
+
+			acked = 0
+			held = nil
+			continue
+		}
+
+		publish, ok := pkt.(*packet.PublishPacket)
+		if !ok {
+			continue
+		}
+
+		header, err := bench.ParseHeader(publish.Message.Payload)
+		if err != nil {
+			continue
+		}
+
+		// hold back the acknowledgment before a drop
+		l.mutex.Lock()
+		dropping := l.drops < *drops && acked >= *dropAfter
+		l.mutex.Unlock()
+
+		seq := header.Seq
+		all := l.add(seq, publish.Dup, dropping)
+
+		if dropping {
+			// drop early if no more messages follow the held ones
+			held = append(held, seq)
+			if len(held) < *unacked && !all {
+				continue
+			}
+
+			// drop the connection without a disconnect packet
+			conn.Close()
+			l.drop()
+
+			conn = reconnect(l)
+			if conn == nil {
+				return
+			}
+
+			acked = 0
+			held = nil
+			continue
+		}
+
+		puback := packet.NewPubackPacket()
+		puback.ID = publish.ID
+
+		err = conn.Send(puback)
+		if err != nil {
+			continue
+		}
+
+		l.ack(seq)
+		acked++
+	}
+}
+
+// reconnect resumes the persistent session and subscribes again if the broker
+// lost it, it returns nil if stopped
+func reconnect(l *ledger) transport.Conn {
+	start := time.Now()
+
+	for atomic.LoadInt32(&stopped) == 0 {
+		conn, present, err := connect(false)
+		if err == nil && !present {
+			l.mutex.Lock()
+			l.sessionsLost++
+			l.mutex.Unlock()
+
+			err = subscribe(conn)
+		}
+		if err != nil {
+			fmt.Println("reconnect", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		l.reconnects.Add(time.Since(start))
+		l.setConn(conn)
+
+		return conn
+	}
+
+	return nil
+}
+
+// connect opens a subscriber connection and returns whether a session is
+// present
+func connect(clean bool) (transport.Conn, bool, error) {
+	conn, err := transport.Dial(*urlString)
+	if err != nil {
+		return nil, false, err
+	}
+
+	connect := packet.NewConnectPacket()
+	connect.ClientID = subscriberID
+	connect.CleanSession = clean
+	connect.KeepAlive = 30
+
+	err = conn.Send(connect)
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+
+	pkt, err := conn.Receive()
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+
+	connack, ok := pkt.(*packet.ConnackPacket)
+	if !ok {
+		conn.Close()
+		return nil, false, fmt.Errorf("expected connack but got %s", pkt.Type())
+	} else if connack.ReturnCode != packet.ConnectionAccepted {
+		conn.Close()
+		return nil, false, connack.ReturnCode
+	}
+
+	return conn, connack.SessionPresent, nil
+}
+
+func subscribe(conn transport.Conn) error {
+	subscribe := packet.NewSubscribePacket()
+	subscribe.ID = 1
+	subscribe.Subscriptions = []packet.Subscription{
+		{Topic: *topic, QOS: 1},
+	}
+
+	err := conn.Send(subscribe)
+	if err != nil {
+		return err
+	}
+
+	// a lost session has no queued messages that precede the suback
+	pkt, err := conn.Receive()
+	if err != nil {
+		return err
+	} else if pkt.Type() != packet.SUBACK {
+		return fmt.Errorf("expected suback but got %s", pkt.Type())
+	}
+
+	return nil
+}
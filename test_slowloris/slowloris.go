@@ -0,0 +1,311 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"bench"
+	"packet"
+	"transport"
+)
+
+// CONNECT 洪水及慢速攻击模拟工具
+// 建立大量套接字，发送空的、不完整的或极慢的 CONNECT 报文，同时由探测客户端测量正常连接的延迟，评估代理在滥用情况下接入资源的退化程度
+
+var address = flag.String("address", "127.0.0.1:1883", "broker tcp address")
+var sockets = flag.Int("sockets", 1000, "number of attacking sockets")
+var mode = flag.String("mode", "slow", "attack mode (idle, partial or slow)")
+var openRate = flag.Int("open-rate", 100, "attacking sockets opened per second (0 opens them at once)")
+var interval = flag.Duration("interval", 10*time.Second, "delay between the bytes sent in slow mode")
+var probeInterval = flag.Duration("probe-interval", time.Second, "delay between legitimate probe connects")
+var probeTimeout = flag.Duration("probe-timeout", 5*time.Second, "timeout of a probe connect")
+var duration = flag.Duration("duration", time.Minute, "duration of the attack")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like probe.p99<1s or probe.failures==0 (repeatable)")
+}
+
+var opened int64
+var refused int64
+var held int64
+var closed int64
+
+var closedAfter bench.Latencies
+var probes bench.Latencies
+var probeFailures int64
+
+func main() {
+	flag.Parse()
+
+	// check mode
+	if *mode != "idle" && *mode != "partial" && *mode != "slow" {
+		fmt.Println("invalid mode:", *mode)
+		os.Exit(2)
+	}
+
+	// check open rate
+	if *openRate < 0 {
+		fmt.Println("invalid open rate:", *openRate)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Start %s CONNECT attack on %s using %d sockets for %s.\n", *mode, *address, *sockets, *duration)
+
+	result := bench.NewResult("slowloris")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+	stop := make(chan struct{})
+
+	go func() {
+		done := make(chan os.Signal, 1)
+		signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+
+		select {
+		case <-done:
+			fmt.Println("Closing...")
+		case <-time.After(*duration):
+			fmt.Println("Finishing...")
+		}
+
+		close(stop)
+	}()
+
+	var wg sync.WaitGroup
+
+	// open attacking sockets
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// open unthrottled without a rate or if it exceeds the timer resolution
+		var tick <-chan time.Time
+		if *openRate > 0 && time.Second/time.Duration(*openRate) > 0 {
+			ticker := time.NewTicker(time.Second / time.Duration(*openRate))
+			defer ticker.Stop()
+
+			tick = ticker.C
+		}
+
+		for i := 0; i < *sockets; i++ {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-stop:
+					return
+				}
+			} else {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				attack(id, stop)
+			}(i)
+		}
+	}()
+
+	// probe legitimate connects
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		probe(stop)
+	}()
+
+	// report progress
+	go func() {
+		for {
+			select {
+			case <-time.After(time.Second):
+			case <-stop:
+				return
+			}
+
+			fmt.Printf("Opened: %d - Refused: %d - Held: %d - Closed by broker: %d - Probe p50: %s (Failures: %d)\n",
+				atomic.LoadInt64(&opened), atomic.LoadInt64(&refused), atomic.LoadInt64(&held),
+				atomic.LoadInt64(&closed), seconds(probes.Percentile(50)), atomic.LoadInt64(&probeFailures))
+		}
+	}()
+
+	wg.Wait()
+
+	// collect metrics
+	metrics := bench.Metrics{
+		"attack.opened":  float64(atomic.LoadInt64(&opened)),
+		"attack.refused": float64(atomic.LoadInt64(&refused)),
+		"attack.closed":  float64(atomic.LoadInt64(&closed)),
+		"probe.failures": float64(atomic.LoadInt64(&probeFailures)),
+	}
+
+	for name, value := range closedAfter.Metrics("attack.closed_after.") {
+		metrics[name] = value
+	}
+
+	for name, value := range probes.Metrics("probe.") {
+		metrics[name] = value
+	}
+
+	fmt.Printf("Opened: %.0f - Refused: %.0f - Closed by broker: %.0f (p50 after %s) - Probe p50: %s p99: %s (Failures: %.0f)\n",
+		metrics["attack.opened"], metrics["attack.refused"], metrics["attack.closed"],
+		seconds(metrics["attack.closed_after.p50"]), seconds(metrics["probe.p50"]),
+		seconds(metrics["probe.p99"]), metrics["probe.failures"])
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func attack(id int, stop chan struct{}) {
+	conn, err := net.DialTimeout("tcp", *address, 10*time.Second)
+	if err != nil {
+		atomic.AddInt64(&refused, 1)
+		return
+	}
+
+	atomic.AddInt64(&opened, 1)
+	atomic.AddInt64(&held, 1)
+	defer atomic.AddInt64(&held, -1)
+
+	start := time.Now()
+
+	// detect close by the broker
+	brokerClosed := make(chan struct{})
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			_, err := conn.Read(buf)
+			if err != nil {
+				close(brokerClosed)
+				return
+			}
+		}
+	}()
+
+	// encode connect
+	connect := packet.NewConnectPacket()
+	connect.ClientID = "slowloris/" + strconv.Itoa(id)
+	connect.CleanSession = true
+
+	buf := make([]byte, connect.Len())
+	connect.Encode(buf)
+
+	// select the bytes to send
+	switch *mode {
+	case "idle":
+		buf = nil
+	case "partial":
+		buf = buf[:len(buf)-1]
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		// write next bytes
+		if len(buf) > 0 {
+			n := len(buf)
+			if *mode == "slow" {
+				n = 1
+			}
+
+			_, err := conn.Write(buf[:n])
+			if err != nil {
+				atomic.AddInt64(&closed, 1)
+				closedAfter.Add(time.Since(start))
+				conn.Close()
+				return
+			}
+
+			buf = buf[n:]
+		}
+
+		select {
+		case <-ticker.C:
+		case <-brokerClosed:
+			atomic.AddInt64(&closed, 1)
+			closedAfter.Add(time.Since(start))
+			conn.Close()
+			return
+		case <-stop:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func probe(stop chan struct{}) {
+	for i := 0; ; i++ {
+		select {
+		case <-time.After(*probeInterval):
+		case <-stop:
+			return
+		}
+
+		start := time.Now()
+		err := connect("slowloris/probe/" + strconv.Itoa(i))
+		if err != nil {
+			atomic.AddInt64(&probeFailures, 1)
+			fmt.Println("Probe failed:", err)
+			continue
+		}
+
+		probes.Add(time.Since(start))
+	}
+}
+
+func connect(clientID string) error {
+	c, err := net.DialTimeout("tcp", *address, *probeTimeout)
+	if err != nil {
+		return err
+	}
+
+	c.SetDeadline(time.Now().Add(*probeTimeout))
+
+	conn := transport.NewNetConn(c)
+	defer conn.Close()
+
+	pkt := packet.NewConnectPacket()
+	pkt.ClientID = clientID
+	pkt.CleanSession = true
+
+	err = conn.Send(pkt)
+	if err != nil {
+		return err
+	}
+
+	res, err := conn.Receive()
+	if err != nil {
+		return err
+	}
+
+	connack, ok := res.(*packet.ConnackPacket)
+	if !ok {
+		return fmt.Errorf("expected connack, got %s", res.Type())
+	}
+
+	if connack.ReturnCode != packet.ConnectionAccepted {
+		return connack.ReturnCode
+	}
+
+	return conn.Send(packet.NewDisconnectPacket())
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"bench"
+	"packet"
+	"transport"
+	"transport/flow"
+	"transport/flow/flows"
+)
+
+// 协议违规注入测试工具
+// 故意发送违反协议的报文（重复 CONNECT、CONNECT 之前的 PUBLISH、保留类型 0/15 的报文），按照规范断言代理会关闭连接
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var timeout = flag.Duration("timeout", 5*time.Second, "time to wait for the broker to close the connection")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+type check struct {
+	name string
+	flow *flow.Flow
+}
+
+func main() {
+	flag.Parse()
+
+	fmt.Printf("Start protocol violation checks of %s.\n", *urlString)
+
+	result := bench.NewResult("violations")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+
+	msg := packet.Message{
+		Topic:   "violations",
+		Payload: []byte("violation"),
+	}
+
+	checks := []check{
+		{"duplicate_connect", flows.DuplicateConnect("violations/duplicate")},
+		{"publish_before_connect", flows.PublishBeforeConnect(msg)},
+		{"reserved_type_0", flows.ReservedType("violations/reserved0", 0)},
+		{"reserved_type_15", flows.ReservedType("violations/reserved15", 15)},
+	}
+
+	// run checks
+	metrics := bench.Metrics{}
+	failed := 0
+	for _, c := range checks {
+		err := run(c.flow)
+		if err != nil {
+			failed++
+			metrics["violations."+c.name] = 0
+			fmt.Printf("FAIL: %s: %s\n", c.name, err)
+			continue
+		}
+
+		metrics["violations."+c.name] = 1
+		fmt.Printf("PASS: %s\n", c.name)
+	}
+
+	metrics["passed"] = float64(len(checks) - failed)
+	metrics["failed"] = float64(failed)
+
+	// write result
+	result.Metrics = metrics
+	bench.Finish(*out, result, nil)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(f *flow.Flow) error {
+	conn, err := transport.Dial(*urlString)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	return f.TestContext(ctx, conn)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"bench"
+	"client"
+	"packet"
+	"topic"
+)
+
+// 通配符订阅压力测试工具
+// 多个客户端订阅相互重叠的 + / # 通配符，向深层主题树发布消息，测量订阅数量增长时代理匹配延迟的变化
+
+var urlString = flag.String("url", "tcp://127.0.0.1:1883", "broker url")
+var clients = flag.Int("clients", 10, "number of subscribing clients")
+var steps = flag.String("steps", "100,1000,10000", "comma separated total filter counts to measure")
+var depth = flag.Int("depth", 6, "depth of the topic tree")
+var fanout = flag.Int("fanout", 4, "segments per level of the topic tree")
+var prefix = flag.String("prefix", "wildcard", "first segment of all topics")
+var rate = flag.Int("rate", 100, "messages published per second")
+var jitter = flag.String("jitter", "none", "distribution of the publish intervals (none, uniform or exponential)")
+var duration = flag.Duration("duration", 10*time.Second, "measuring duration of every step")
+var qos = flag.Uint("qos", 0, "sub and pub qos level")
+var seed = flag.Int64("seed", 1, "seed of the topic and filter generator")
+var out = flag.String("out", "", "write the result as JSON to this file")
+
+var thresholds bench.Thresholds
+
+func init() {
+	flag.Var(&thresholds, "assert", "acceptance criterion like filters_10000.p99<50ms (repeatable)")
+}
+
+var latencies atomic.Value
+var received int64
+
+func main() {
+	flag.Parse()
+
+	// parse steps
+	var targets []int
+	for _, str := range strings.Split(*steps, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil || n <= 0 {
+			fmt.Println("invalid step:", str)
+			os.Exit(2)
+		}
+
+		targets = append(targets, n)
+	}
+
+	// parse jitter
+	publishJitter, err := bench.ParseJitter(*jitter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Start wildcard benchmark of %s using %d clients and a topic tree of depth %d.\n", *urlString, *clients, *depth)
+
+	result := bench.NewResult("wildcard")
+	result.SetConfig(bench.FlagConfig(flag.CommandLine, "out"))
+	tree := bench.NewTopicTree(*prefix, *depth, *fanout)
+	r := rand.New(rand.NewSource(*seed))
+	latencies.Store(&bench.Latencies{})
+
+	// connect subscribers
+	subscribers := make([]*client.Client, *clients)
+	for i := range subscribers {
+		subscribers[i] = connect("wildcard/sub/"+strconv.Itoa(i), func(msg *packet.Message, err error) error {
+			if err != nil {
+				fmt.Println("callback", err)
+				return nil
+			}
+
+			if len(msg.Payload) >= 8 {
+				sent := int64(binary.BigEndian.Uint64(msg.Payload))
+				latencies.Load().(*bench.Latencies).Add(time.Duration(time.Now().UnixNano() - sent))
+			}
+
+			atomic.AddInt64(&received, 1)
+
+			return nil
+		})
+	}
+
+	publisher := connect("wildcard/pub", nil)
+
+	// the filters of all clients used to compute the expected deliveries
+	matches := topic.NewTree()
+	filters := 0
+
+	metrics := bench.Metrics{}
+
+	fmt.Println("Filters  Subscribe  Sent  Expected  Received  p50  p90  p99  max")
+
+	for _, target := range targets {
+		// add filters round-robin
+		subscribeStart := time.Now()
+		for ; filters < target; filters++ {
+			index := filters % len(subscribers)
+			filter := tree.Filter(r)
+
+			sf, err := subscribers[index].Subscribe(filter, uint8(*qos))
+			if err == nil {
+				err = sf.Wait(10 * time.Second)
+			}
+			if err != nil {
+				fmt.Println("subscribe", err)
+				os.Exit(1)
+			}
+
+			matches.Add(filter, index)
+		}
+		subscribeTime := time.Since(subscribeStart)
+
+		// reset counters
+		step := &bench.Latencies{}
+		latencies.Store(step)
+		atomic.StoreInt64(&received, 0)
+
+		// publish for the duration of the step
+		sent, expected := 0, 0
+		schedule := bench.NewSchedule(float64(*rate), publishJitter, r.Int63())
+		deadline := time.Now().Add(*duration)
+		for time.Now().Before(deadline) {
+			schedule.Wait()
+
+			t := tree.Topic(r)
+			expected += len(matches.Match(t))
+
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+
+			_, err := publisher.Publish(t, payload, uint8(*qos), false)
+			if err != nil {
+				fmt.Println("publish", err)
+				os.Exit(1)
+			}
+
+			sent++
+		}
+
+		// wait for in flight messages
+		time.Sleep(time.Second)
+
+		name := "filters_" + strconv.Itoa(target) + "."
+		stepMetrics := step.Metrics(name)
+		stepMetrics[name+"subscribe"] = subscribeTime.Seconds()
+		stepMetrics[name+"sent"] = float64(sent)
+		stepMetrics[name+"expected"] = float64(expected)
+		stepMetrics[name+"received"] = float64(atomic.LoadInt64(&received))
+
+		for key, value := range stepMetrics {
+			metrics[key] = value
+		}
+
+		fmt.Printf("%7d  %9s  %4d  %8d  %8d  %s  %s  %s  %s\n", target, subscribeTime.Round(time.Millisecond), sent, expected,
+			atomic.LoadInt64(&received), seconds(stepMetrics[name+"p50"]), seconds(stepMetrics[name+"p90"]),
+			seconds(stepMetrics[name+"p99"]), seconds(stepMetrics[name+"max"]))
+	}
+
+	// disconnect clients
+	publisher.Disconnect()
+	for _, subscriber := range subscribers {
+		subscriber.Disconnect()
+	}
+
+	// write result and check thresholds
+	result.Metrics = metrics
+	if bench.Finish(*out, result, thresholds) != nil {
+		os.Exit(1)
+	}
+}
+
+func connect(clientID string, callback client.Callback) *client.Client {
+	c := client.New()
+	c.Callback = callback
+
+	cf, err := c.Connect(&client.Config{
+		BrokerURL:    *urlString,
+		ClientID:     clientID,
+		CleanSession: true,
+		KeepAlive:    "30s",
+	})
+	if err == nil {
+		err = cf.Wait(10 * time.Second)
+	}
+	if err != nil {
+		fmt.Println("connect", err)
+		os.Exit(1)
+	}
+
+	return c
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second)).Round(time.Microsecond)
+}